@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
+)
+
+// jsonEvent is one line of -json output. Event is "progress" for each
+// calibration.Progress step, then "complete" with the result and the path it
+// was written to, or "error" if the run failed.
+type jsonEvent struct {
+	Event    string                         `json:"event"`
+	Progress *calibration.Progress          `json:"progress,omitempty"`
+	Result   *calibration.CalibrationResult `json:"result,omitempty"`
+	Path     string                         `json:"path,omitempty"`
+	Error    string                         `json:"error,omitempty"`
+}
+
+// writeEvent writes ev to w as a single JSON line.
+func writeEvent(w io.Writer, ev jsonEvent) {
+	if err := json.NewEncoder(w).Encode(ev); err != nil {
+		log.Printf("write JSON event: %v", err)
+	}
+}
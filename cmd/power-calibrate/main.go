@@ -3,177 +3,160 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/user"
 	"path/filepath"
-	"strconv"
-	"time"
 
 	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 )
 
 func main() {
+	notify := flag.Bool("notify", true, "send a desktop notification with the results when calibration completes")
+	settleWait := flag.Duration("settle", calibration.DefaultSettleWait, "wait after each brightness change before measuring")
+	sampleDuration := flag.Duration("sample", calibration.DefaultSampleDuration, "power measurement window per brightness level; longer reduces charge quantization error")
+	samplePoll := flag.Duration("poll", calibration.DefaultSamplePoll, "battery polling interval during measurement")
+	stepWait := flag.Duration("step-wait", calibration.DefaultMaxStepWait, "longest wait for a battery charge step before and after each window; the measurement then continues with a larger error")
+	var yes bool
+	flag.BoolVar(&yes, "yes", false, "skip the preparation prompt and start immediately, assuming the system is already prepared")
+	flag.BoolVar(&yes, "noninteractive", false, "alias for -yes")
+	output := flag.String("output", "", "write the result to this path instead of $XDG_CONFIG_HOME/power-monitor/calibration.json (default ~/.config)")
+	backlight := flag.String("backlight", "", "/sys/class/backlight device name or glob to calibrate (default: the internal panel)")
+	battery := flag.String("battery", "", "/sys/class/power_supply battery name or glob to measure (default: the first BAT*)")
+	restoreOnly := flag.Bool("restore", false, "restore CPU settings left pinned by a calibration run that crashed or was killed, then exit")
+	jsonOut := flag.Bool("json", false, "emit progress and the result as JSON lines on stdout; human-readable text goes to stderr")
+	exportAnon := flag.String("export-anon", "", "write the existing calibration (from -output or the default path) in the anonymised community format to this path (\"-\" for stdout), then exit")
+	flag.Parse()
+
+	if *exportAnon != "" {
+		inPath := *output
+		if inPath == "" {
+			var err error
+			if inPath, err = calibration.ResultPath(); err != nil {
+				log.Fatalf("resolve calibration path: %v", err)
+			}
+		}
+		if err := exportCommunity(inPath, *exportAnon, *battery); err != nil {
+			log.Fatalf("export: %v", err)
+		}
+		return
+	}
+
+	var human io.Writer = os.Stdout
+	if *jsonOut {
+		human = os.Stderr
+	}
+
+	levels := calibration.DefaultLevels
+	opts := calibration.RunOptions{
+		// Use a 30-second averaging window for charge-delta power calculation.
+		Sampler:        collector.NewBatteryCollector(30, false, *battery),
+		Levels:         levels,
+		SettleWait:     *settleWait,
+		SampleDuration: *sampleDuration,
+		SamplePoll:     *samplePoll,
+		MaxStepWait:    *stepWait,
+		Backlight:      *backlight,
+	}
+	if err := opts.Validate(); err != nil {
+		log.Fatalf("invalid timing: %v", err)
+	}
+
 	if os.Geteuid() != 0 {
 		log.Fatal("power-calibrate must be run as root (needed for CPU frequency and backlight control)")
 	}
 
-	fmt.Println("=== Power Monitor Display Calibration ===")
-	fmt.Println()
-	fmt.Println("This tool measures your display's power consumption at various brightness levels.")
-	fmt.Println()
-	fmt.Println("Before pressing Enter, please:")
-	fmt.Println("  1. Close ALL unnecessary programs (browser, IDE, etc.)")
-	fmt.Println("  2. Turn off WiFi and Bluetooth")
-	fmt.Println("  3. Unplug all external devices (USB, monitors, etc.)")
-	fmt.Println("  4. Ensure the laptop is running on battery (unplug AC adapter)")
-	fmt.Println("  5. Wait a few seconds after making these changes")
-	fmt.Println()
-	fmt.Println("IMPORTANT: Do not touch the laptop or change anything once calibration starts.")
-	fmt.Println()
-	fmt.Print("Press Enter when ready...")
-	bufio.NewReader(os.Stdin).ReadBytes('\n')
-	fmt.Println()
-
-	// Save original brightness to restore later.
-	origCur, origMax, err := calibration.GetBrightness()
-	if err != nil {
-		log.Fatalf("get brightness: %v", err)
+	// Undo a previous run that died with the CPU pinned.
+	restored, err := calibration.RestoreStalePin()
+	if *restoreOnly {
+		switch {
+		case err != nil:
+			log.Fatalf("restore: %v", err)
+		case restored:
+			fmt.Fprintln(human, "Restored CPU settings from an interrupted calibration run.")
+		default:
+			fmt.Fprintln(human, "No pinned CPU settings to restore.")
+		}
+		return
 	}
-	origPct := int(origCur * 100 / origMax)
-	defer func() {
-		fmt.Printf("Restoring brightness to %d%%\n", origPct)
-		calibration.SetBrightness(origPct)
-	}()
-
-	// Pin CPU frequency.
-	fmt.Println("[1/3] Locking CPU frequency and disabling turbo boost...")
-	restoreCPU, err := calibration.PinCPU()
 	if err != nil {
-		log.Fatalf("pin CPU: %v", err)
-	}
-	defer func() {
-		fmt.Println("Restoring CPU settings...")
-		restoreCPU()
-	}()
-
-	cpuFreq, _ := calibration.GetCPUFrequency()
-	fmt.Printf("       CPU locked to %d kHz\n", cpuFreq)
-
-	// Set brightness to 0% as the starting point for measurements.
-	fmt.Println("       Setting brightness to 0%...")
-	if err := calibration.SetBrightness(0); err != nil {
-		log.Fatalf("set brightness: %v", err)
-	}
-	fmt.Println("       Ready.")
-	fmt.Println()
-
-	// Create battery collector for calibration measurements.
-	// Use a 30-second averaging window for charge-delta power calculation.
-	bc := collector.NewBatteryCollector(30)
-
-	// Measure power at each brightness level.
-	levels := []int{0, 25, 50, 75, 100}
-	var samples []calibration.BrightnessSample
-	var baselinePower int64
-
-	// Use a short settling wait after each brightness change.
-	settleWait := 5 * time.Second
-	// Longer window reduces quantization error from charge-step endpoints.
-	sampleDuration := 30 * 2 * 5 * time.Second
-	samplePoll := 500 * time.Millisecond
-
-	fmt.Printf("[2/3] Measuring power at %d brightness levels (settle %v + sample %v each)...\n",
-		len(levels), settleWait, sampleDuration)
-	for i, pct := range levels {
-		brightnessWarned := false
-		lastReassertSec := -1
-
-		fmt.Printf("       Level %d/%d: brightness %d%%", i+1, len(levels), pct)
-		if err := calibration.SetBrightness(pct); err != nil {
-			log.Fatalf("set brightness %d%%: %v", pct, err)
+		log.Fatalf("restore CPU settings: %v", err)
+	}
+	if restored {
+		log.Print("restored CPU settings left pinned by an interrupted calibration run")
+	}
+
+	fmt.Fprintln(human, "=== Power Monitor Display Calibration ===")
+	fmt.Fprintln(human)
+	if !yes {
+		fmt.Fprintln(human, "This tool measures your display's power consumption at various brightness levels.")
+		fmt.Fprintln(human)
+		fmt.Fprintln(human, "Before pressing Enter, please:")
+		fmt.Fprintln(human, "  1. Close ALL unnecessary programs (browser, IDE, etc.)")
+		fmt.Fprintln(human, "  2. Turn off WiFi and Bluetooth")
+		fmt.Fprintln(human, "  3. Unplug all external devices (USB, monitors, etc.)")
+		fmt.Fprintln(human, "  4. Ensure the laptop is running on battery (unplug AC adapter)")
+		fmt.Fprintln(human, "  5. Wait a few seconds after making these changes")
+		fmt.Fprintln(human)
+		fmt.Fprintln(human, "IMPORTANT: Do not touch the laptop or change anything once calibration starts.")
+		fmt.Fprintln(human)
+		fmt.Fprint(human, "Press Enter when ready...")
+		bufio.NewReader(os.Stdin).ReadBytes('\n')
+		fmt.Fprintln(human)
+	}
+
+	step := "[1/3]"
+	result, err := calibration.Run(opts, func(p calibration.Progress) {
+		if *jsonOut {
+			writeEvent(os.Stdout, jsonEvent{Event: "progress", Progress: &p})
+			return
 		}
-
-		// Keep reasserting brightness to counter desktop idle dimming.
-		fmt.Printf(" (settling %v)...", settleWait)
-		fmt.Println()
-		waitWithProgress("         [settle]", settleWait, 1*time.Second, func() {
-			reassertBrightness(pct, &brightnessWarned)
-		})
-
-		// Measure power usage over the next fixed sampling window.
-		fmt.Printf(" sampling %v\n", sampleDuration)
-		avg, avgErr, deltaChargeUAH, chargeQuantUAH, err := calibration.MeasurePowerOverWindowWithDiagnostics(
-			bc,
-			sampleDuration,
-			samplePoll,
-			func(phase string, elapsed, remaining time.Duration, chargeNowUAH, voltageUV int64) {
-				sec := int(elapsed.Seconds())
-				if sec != lastReassertSec {
-					reassertBrightness(pct, &brightnessWarned)
-					lastReassertSec = sec
-				}
-
-				switch phase {
-				case "wait-charge-step":
-					fmt.Printf("         [diag] waiting charge-step t=%2ds charge=%d uAh voltage=%.3f V\n",
-						int(elapsed.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
-				case "window":
-					fmt.Printf("         [diag] sample t=%2ds remaining=%2ds charge=%d uAh voltage=%.3f V\n",
-						int(elapsed.Seconds()), int(remaining.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
-				case "wait-end-charge-step":
-					fmt.Printf("         [diag] waiting end charge-step t=%2ds charge=%d uAh voltage=%.3f V\n",
-						int(elapsed.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
-				case "end":
-					fmt.Printf("         [diag] end t=%2ds charge=%d uAh voltage=%.3f V\n",
-						int(elapsed.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
-				}
-			},
-		)
-		if err != nil {
-			log.Fatalf("measure power at %d%%: %v", pct, err)
+		switch p.Phase {
+		case "prepare":
+			fmt.Fprintf(human, "%-6s %s\n", step, p.Message)
+			step = ""
+		case "level":
+			if p.Level == 1 {
+				fmt.Fprintln(human, "       Ready.")
+				fmt.Fprintln(human)
+				fmt.Fprintf(human, "[2/3] Measuring power at %d brightness levels (settle %v + sample %v each)...\n",
+					len(levels), *settleWait, *sampleDuration)
+			}
+			fmt.Fprintf(human, "       %s...\n", p.Message)
+		case "result":
+			fmt.Fprintf(human, "       %s\n", p.Message)
+		case "warning":
+			log.Print(p.Message)
+		case "restore":
+			fmt.Fprintln(human, p.Message)
+		default:
+			fmt.Fprintf(human, "         %s\n", p.Message)
 		}
-		fmt.Printf("       -> avg: %.2f W +/- %.3f W (delta charge: %d uAh, q=%d uAh)\n",
-			float64(avg)/1e6, float64(avgErr)/1e6, deltaChargeUAH, chargeQuantUAH)
-
-		samples = append(samples, calibration.BrightnessSample{
-			BrightnessPct:         pct,
-			AvgPowerUW:            avg,
-			AvgPowerErrorUW:       avgErr,
-			DeltaChargeUAH:        deltaChargeUAH,
-			ChargeQuantizationUAH: chargeQuantUAH,
-		})
-		if pct == 0 {
-			baselinePower = avg
+	})
+	if err != nil {
+		if *jsonOut {
+			writeEvent(os.Stdout, jsonEvent{Event: "error", Error: err.Error()})
 		}
+		log.Fatalf("calibration: %v", err)
 	}
-	fmt.Println()
+	fmt.Fprintln(human)
+	samples := result.Samples
+	baselinePower := result.BaselinePowerUW
 
 	// Write results.
-	result := calibration.CalibrationResult{
-		UpdateIntervalMs: 0,
-		LatencyMs:        0,
-		StaleCycles:      0,
-		BaselinePowerUW:  baselinePower,
-		Samples:          samples,
-		CPUFrequencyKHz:  cpuFreq,
-		CalibratedAt:     time.Now().UTC().Format(time.RFC3339),
-	}
-
-	// Resolve the real user's home directory when running under sudo,
-	// so the config file is written to the invoking user's home, not root's.
-	home := os.Getenv("HOME")
-	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
-		home = filepath.Join("/home", sudoUser)
-	}
-	configDir := filepath.Join(home, ".config")
-	outDir := filepath.Join(configDir, "power-monitor")
+	outPath := *output
+	if outPath == "" {
+		if outPath, err = calibration.ResultPath(); err != nil {
+			log.Fatalf("resolve output path: %v", err)
+		}
+	}
+	outDir := filepath.Dir(outPath)
 	if err := os.MkdirAll(outDir, 0755); err != nil {
-		log.Fatalf("create config dir: %v", err)
+		log.Fatalf("create output dir: %v", err)
 	}
-	outPath := filepath.Join(outDir, "calibration.json")
 
 	data, err := json.MarshalIndent(result, "", "  ")
 	if err != nil {
@@ -184,58 +167,65 @@ func main() {
 	}
 
 	// Fix ownership if running under sudo so the real user can read the file.
-	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
-		if u, err := user.Lookup(sudoUser); err == nil {
-			uid, _ := strconv.Atoi(u.Uid)
-			gid, _ := strconv.Atoi(u.Gid)
-			os.Chown(outDir, uid, gid)
-			os.Chown(outPath, uid, gid)
-		}
+	// A custom -output directory is left alone; it may be shared.
+	if *output == "" {
+		calibration.ChownToSudoUser(outDir, outPath)
+	} else {
+		calibration.ChownToSudoUser(outPath)
 	}
 
-	fmt.Printf("[3/3] Calibration complete! Results written to:\n")
-	fmt.Printf("       %s\n", outPath)
-	fmt.Println()
-	fmt.Println("Summary:")
-	fmt.Printf("  Baseline power:   %.2f W (display off)\n", float64(baselinePower)/1e6)
+	if *jsonOut {
+		writeEvent(os.Stdout, jsonEvent{Event: "complete", Result: &result, Path: outPath})
+	}
+	fmt.Fprintf(human, "[3/3] Calibration complete! Results written to:\n")
+	fmt.Fprintf(human, "       %s\n", outPath)
+	fmt.Fprintln(human)
+	fmt.Fprintln(human, "Summary:")
+	if result.BacklightDevice != "" {
+		fmt.Fprintf(human, "  Backlight:        %s\n", result.BacklightDevice)
+	}
+	fmt.Fprintf(human, "  Baseline power:   %.2f W (display off)\n", float64(baselinePower)/1e6)
 	for _, s := range samples {
 		displayPower := float64(s.AvgPowerUW-baselinePower) / 1e6
-		fmt.Printf("  Brightness %3d%%:  %.2f +/- %.3f W total (%.2f W display)\n",
-			s.BrightnessPct, float64(s.AvgPowerUW)/1e6, float64(s.AvgPowerErrorUW)/1e6, displayPower)
+		steps := "power_now"
+		if s.DeltaChargeUAH != 0 {
+			steps = fmt.Sprintf("%d charge steps", s.ChargeSteps)
+		}
+		fmt.Fprintf(human, "  Brightness %3d%%:  %.2f +/- %.3f W total (%.2f W display, %s)\n",
+			s.BrightnessPct, float64(s.AvgPowerUW)/1e6, float64(s.AvgPowerErrorUW)/1e6, displayPower, steps)
+	}
+
+	if *notify {
+		notifyCompletion(result)
 	}
 }
 
-func waitWithProgress(prefix string, total, tick time.Duration, onTick func()) {
-	if total <= 0 {
-		return
+// exportCommunity reads the calibration at inPath and writes it, with the
+// battery and laptop model but no serial numbers, to outPath ("-" for
+// stdout). A missing battery is not fatal; its fields are left empty.
+func exportCommunity(inPath, outPath, batteryPattern string) error {
+	data, err := os.ReadFile(inPath)
+	if err != nil {
+		return err
 	}
-	if tick <= 0 {
-		tick = time.Second
+	var result calibration.CalibrationResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return fmt.Errorf("parse %s: %w", inPath, err)
 	}
-
-	deadline := time.Now().Add(total)
-	for {
-		remaining := time.Until(deadline)
-		if remaining <= 0 {
-			fmt.Printf("%s done\n", prefix)
-			return
-		}
-
-		fmt.Printf("%s remaining: %2ds\n", prefix, int(remaining.Round(time.Second).Seconds()))
-		if onTick != nil {
-			onTick()
-		}
-		sleepFor := tick
-		if sleepFor > remaining {
-			sleepFor = remaining
-		}
-		time.Sleep(sleepFor)
+	health, err := collector.CollectBatteryHealth(batteryPattern)
+	if err != nil {
+		log.Printf("battery health unavailable, exporting without it: %v", err)
+		health = nil
 	}
-}
-
-func reassertBrightness(pct int, warned *bool) {
-	if err := calibration.SetBrightness(pct); err != nil && !*warned {
-		log.Printf("warning: failed to reassert brightness %d%%: %v", pct, err)
-		*warned = true
+	exp := calibration.NewCommunityExport(&result, health, collector.CollectMachineInfo())
+	out, err := json.MarshalIndent(exp, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	if outPath == "-" {
+		_, err = os.Stdout.Write(out)
+		return err
 	}
+	return os.WriteFile(outPath, out, 0644)
 }
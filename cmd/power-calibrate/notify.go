@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	godbus "github.com/godbus/dbus/v5"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
+)
+
+// notifyCompletion sends a desktop notification summarizing the calibration
+// result to the invoking user's session. This matters when the tool is
+// launched from the GUI via pkexec and the terminal output is never seen.
+// Failures are ignored: a missing session bus or notification service is normal
+// for headless or SSH runs.
+func notifyCompletion(result calibration.CalibrationResult) {
+	conn, err := userSessionBus()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Baseline: %.2f W (display off)", float64(result.BaselinePowerUW)/1e6)
+	for _, s := range result.Samples {
+		fmt.Fprintf(&body, "\n%3d%%: %.2f W display", s.BrightnessPct, float64(s.AvgPowerUW-result.BaselinePowerUW)/1e6)
+	}
+
+	obj := conn.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications")
+	obj.Call("org.freedesktop.Notifications.Notify", 0,
+		"Power Monitor",              // app_name
+		uint32(0),                    // replaces_id
+		"preferences-color-symbolic", // app_icon
+		"Display calibration complete",
+		body.String(),
+		[]string{},                  // actions
+		map[string]godbus.Variant{}, // hints
+		int32(-1),                   // expire_timeout (server default)
+	)
+}
+
+// userSessionBus connects to the session bus of the user who invoked the tool
+// through sudo or pkexec, falling back to the current environment's session bus.
+func userSessionBus() (*godbus.Conn, error) {
+	uid := os.Getenv("PKEXEC_UID")
+	if uid == "" {
+		if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+			if u, err := user.Lookup(sudoUser); err == nil {
+				uid = u.Uid
+			}
+		}
+	}
+	if uid == "" {
+		return godbus.SessionBusPrivate()
+	}
+
+	conn, err := godbus.Dial("unix:path=/run/user/" + uid + "/bus")
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Auth(nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.Hello(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
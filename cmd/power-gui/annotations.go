@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// annotationListRange is how far back the Annotations page lists notes; it
+// matches the longest range the daemon serves in one query.
+const annotationListRange = 365 * 24 * time.Hour
+
+type annotationsPage struct {
+	container *gtk.Box
+
+	entry     *adw.EntryRow
+	listGroup *adw.PreferencesGroup
+	listRows  []*adw.ActionRow
+}
+
+func newAnnotationsPage() *annotationsPage {
+	p := &annotationsPage{}
+
+	p.container = gtk.NewBox(gtk.OrientationVertical, 12)
+	p.container.SetMarginStart(24)
+	p.container.SetMarginEnd(24)
+	p.container.SetMarginTop(24)
+	p.container.SetMarginBottom(24)
+
+	addGroup := adw.NewPreferencesGroup()
+	addGroup.SetTitle("Add Annotation")
+	addGroup.SetDescription("Mark the current moment on the graphs, e.g. \"started video call\" or \"enabled TLP\".")
+
+	p.entry = adw.NewEntryRow()
+	p.entry.SetTitle("Note")
+	p.entry.SetShowApplyButton(true)
+	p.entry.ConnectApply(p.add)
+	p.entry.ConnectEntryActivated(p.add)
+	addGroup.Add(p.entry)
+	p.container.Append(addGroup)
+
+	p.listGroup = adw.NewPreferencesGroup()
+	p.listGroup.SetTitle("Annotations")
+	p.container.Append(p.listGroup)
+
+	p.reload()
+	return p
+}
+
+// add stores the entry's text as an annotation at the current time.
+func (p *annotationsPage) add() {
+	text := strings.TrimSpace(p.entry.Text())
+	if text == "" {
+		return
+	}
+	if _, err := client.AddAnnotation(time.Now(), text); err != nil {
+		p.listGroup.SetDescription(fmt.Sprintf("Failed to add annotation: %v", err))
+		return
+	}
+	p.entry.SetText("")
+	p.reload()
+	refreshData()
+}
+
+// reload rebuilds the list of annotations, newest first.
+func (p *annotationsPage) reload() {
+	for _, row := range p.listRows {
+		p.listGroup.Remove(row)
+	}
+	p.listRows = p.listRows[:0]
+
+	now := time.Now()
+	annotations, err := client.GetAnnotations(now.Add(-annotationListRange), now)
+	switch {
+	case err != nil:
+		p.listGroup.SetDescription(fmt.Sprintf("Unavailable: %v", err))
+		return
+	case len(annotations) == 0:
+		p.listGroup.SetDescription("No annotations yet")
+		return
+	}
+	p.listGroup.SetDescription("")
+
+	for i := len(annotations) - 1; i >= 0; i-- {
+		a := annotations[i]
+		row := adw.NewActionRow()
+		row.SetUseMarkup(false)
+		row.SetTitle(a.Text)
+		subtitle := formatTime(time.Unix(a.Timestamp, 0), timeStyleFullDayClock)
+		if isAutoAnnotation(a) {
+			subtitle += " · automatic"
+		}
+		row.SetSubtitle(subtitle)
+
+		del := gtk.NewButtonFromIconName("user-trash-symbolic")
+		del.SetTooltipText("Delete annotation")
+		del.SetVAlign(gtk.AlignCenter)
+		del.AddCSSClass("flat")
+		del.ConnectClicked(func() {
+			if err := client.DeleteAnnotation(a.ID); err != nil {
+				p.listGroup.SetDescription(fmt.Sprintf("Failed to delete annotation: %v", err))
+				return
+			}
+			p.reload()
+			refreshData()
+		})
+		row.AddSuffix(del)
+
+		p.listGroup.Add(row)
+		p.listRows = append(p.listRows, row)
+	}
+}
@@ -2,9 +2,14 @@ package main
 
 import (
 	"fmt"
+	"maps"
+	"slices"
+	"time"
 
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 )
 
 type batteryHealthPage struct {
@@ -43,22 +48,195 @@ func newBatteryHealthPage() *batteryHealthPage {
 	healthGroup := adw.NewPreferencesGroup()
 	healthGroup.SetTitle("Health")
 
-	designWh := chargeToWh(health.ChargeFullDesignUAH, health.VoltageMinDesignUV)
-	currentWh := chargeToWh(health.ChargeFullUAH, health.VoltageMinDesignUV)
-	healthGroup.Add(makeRow("Design Capacity", fmt.Sprintf("%.1f Wh", designWh)))
-	healthGroup.Add(makeRow("Current Capacity", fmt.Sprintf("%.1f Wh", currentWh)))
+	healthGroup.Add(makeRow("Design Capacity", fmt.Sprintf("%.1f Wh", health.DesignWh)))
+	healthGroup.Add(makeRow("Current Capacity", fmt.Sprintf("%.1f Wh", health.FullWh)))
+	if health.WhVoltageUV > 0 && (health.EnergyFullDesignUWH == 0 || health.EnergyFullUWH == 0) {
+		healthGroup.Add(makeRow("Wh Voltage Basis", fmt.Sprintf("%.2f V (%s)", float64(health.WhVoltageUV)/1e6, whBasisLabel(health.WhBasis))))
+	}
 
-	if health.ChargeFullDesignUAH > 0 {
-		pct := float64(health.ChargeFullUAH) / float64(health.ChargeFullDesignUAH) * 100
+	if health.DesignWh > 0 {
+		pct := health.FullWh / health.DesignWh * 100
 		healthGroup.Add(makeRow("Health", fmt.Sprintf("%.1f%%", pct)))
 	}
 
-	healthGroup.Add(makeRow("Cycle Count", fmt.Sprintf("%d", health.CycleCount)))
+	healthGroup.Add(makeRow("Firmware Cycle Count", fmt.Sprintf("%d", health.CycleCount)))
+
+	switch {
+	case health.AlarmUWH > 0:
+		healthGroup.Add(makeRow("Low Battery Alarm", fmt.Sprintf("%.1f Wh", float64(health.AlarmUWH)/1e6)))
+	case health.AlarmUAH > 0:
+		alarm := fmt.Sprintf("%.0f mAh", float64(health.AlarmUAH)/1e3)
+		if health.ChargeFullUAH > 0 {
+			alarm += fmt.Sprintf(" (%.0f%%)", float64(health.AlarmUAH)/float64(health.ChargeFullUAH)*100)
+		}
+		healthGroup.Add(makeRow("Low Battery Alarm", alarm))
+	}
 	p.container.Append(healthGroup)
 
+	p.container.Append(newChargeThresholdsGroup())
+	p.container.Append(newChargeCyclesGroup())
+
+	// Capacity drop history
+	dropsGroup := adw.NewPreferencesGroup()
+	dropsGroup.SetTitle("Capacity Changes")
+	drops, err := client.GetCapacityDrops()
+	switch {
+	case err != nil:
+		dropsGroup.SetDescription(fmt.Sprintf("Unavailable: %v", err))
+	case len(drops) == 0:
+		dropsGroup.SetDescription("No significant capacity drops recorded")
+	default:
+		for _, d := range drops {
+			date := formatTime(time.Unix(d.Timestamp, 0), timeStyleFullDay)
+			dropsGroup.Add(makeRow(fmt.Sprintf("Capacity dropped %.1f%%", d.DropPct), date))
+		}
+	}
+	p.container.Append(dropsGroup)
+
+	p.container.Append(newPowerPercentilesGroup())
+	p.container.Append(newSuspendDrainGroup())
+
 	return p
 }
 
+// newChargeThresholdsGroup lists the charge thresholds of each battery pack,
+// since dual-battery laptops set them per pack.
+func newChargeThresholdsGroup() *adw.PreferencesGroup {
+	group := adw.NewPreferencesGroup()
+	group.SetTitle("Charge Thresholds")
+
+	thresholds, err := client.GetChargeThresholds()
+	switch {
+	case err != nil:
+		group.SetDescription(fmt.Sprintf("Unavailable: %v", err))
+		return group
+	case len(thresholds) == 0:
+		group.SetDescription("No batteries found")
+		return group
+	}
+	for _, name := range slices.Sorted(maps.Keys(thresholds)) {
+		group.Add(makeRow(name, chargeThresholdLabel(thresholds[name])))
+	}
+	return group
+}
+
+// newChargeCyclesGroup estimates the charge cycles put on the battery in each
+// of cyclePeriods from the discharge the daemon recorded, next to the
+// firmware's cumulative counter, which cannot say when cycles happened.
+func newChargeCyclesGroup() *adw.PreferencesGroup {
+	group := adw.NewPreferencesGroup()
+	group.SetTitle("Charge Cycles")
+	group.SetDescription("Estimated from recorded discharge, one cycle per design capacity drained")
+	now := time.Now()
+	for _, period := range cyclePeriods {
+		cycles, err := client.GetChargeCycles(period.Start(now), now)
+		value := "Unavailable"
+		if err == nil {
+			value = cycleLabel(*cycles)
+		}
+		group.Add(makeRow(period.Label, value))
+	}
+	return group
+}
+
+// Standby drain shows suspends from the last suspendDrainDays, newest first,
+// listing at most suspendDrainRows of them.
+const (
+	suspendDrainDays = 30
+	suspendDrainRows = 10
+)
+
+// newSuspendDrainGroup shows how fast the battery drains in suspend, per
+// suspend and as a rolling average, so a jump after a firmware or kernel
+// update stands out.
+func newSuspendDrainGroup() *adw.PreferencesGroup {
+	group := adw.NewPreferencesGroup()
+	group.SetTitle("Standby Drain")
+
+	now := time.Now()
+	rates, err := client.GetSuspendDrainRates(now.AddDate(0, 0, -suspendDrainDays), now)
+	switch {
+	case err != nil:
+		group.SetDescription(fmt.Sprintf("Unavailable: %v", err))
+		return group
+	case len(rates) == 0:
+		group.SetDescription(fmt.Sprintf("No suspends of %d minutes or more with battery readings on both sides in the last %d days", collector.MinSuspendDrainSecs/60, suspendDrainDays))
+		return group
+	}
+
+	latest := rates[len(rates)-1]
+	group.SetDescription(fmt.Sprintf("Typically %.2f%%/h over the last %d suspends", latest.AvgPctPerHour, min(len(rates), collector.SuspendDrainWindow)))
+	for i := len(rates) - 1; i >= max(0, len(rates)-suspendDrainRows); i-- {
+		r := rates[i]
+		title := formatTime(time.Unix(r.StartTime, 0), timeStyleFullDayClock)
+		if r.Subtype != "" {
+			title += " (" + r.Subtype + ")"
+		}
+		value := fmt.Sprintf("%.2f%%/h, %d%% in %s · avg %.2f%%/h", r.PctPerHour, r.DrainPct, sleepSpan(r.EndTime-r.StartTime), r.AvgPctPerHour)
+		group.Add(makeRow(title, value))
+	}
+	return group
+}
+
+// percentileRangeDefault is the timeRanges index the power draw summary
+// starts on (24h).
+const percentileRangeDefault = 4
+
+// newPowerPercentilesGroup shows the typical discharging power draw over a
+// window chosen from timeRanges.
+func newPowerPercentilesGroup() *adw.PreferencesGroup {
+	group := adw.NewPreferencesGroup()
+	group.SetTitle("Typical Power Draw")
+
+	labels := make([]string, len(timeRanges))
+	for i, tr := range timeRanges {
+		labels[i] = tr.Label
+	}
+	rangeDrop := gtk.NewDropDownFromStrings(labels)
+	rangeDrop.SetVAlign(gtk.AlignCenter)
+	rangeDrop.SetSelected(percentileRangeDefault)
+	group.SetHeaderSuffix(rangeDrop)
+
+	var values []*gtk.Label
+	for _, title := range []string{"Median (p50)", "p90", "p99"} {
+		row := adw.NewActionRow()
+		row.SetTitle(title)
+		label := gtk.NewLabel("—")
+		label.AddCSSClass("dim-label")
+		row.AddSuffix(label)
+		group.Add(row)
+		values = append(values, label)
+	}
+
+	update := func() {
+		idx := int(rangeDrop.Selected())
+		if idx < 0 || idx >= len(timeRanges) {
+			return
+		}
+		now := time.Now()
+		pp, err := client.GetPowerPercentiles(now.Add(-timeRanges[idx].Duration), now)
+		if err != nil || pp.Count == 0 {
+			if err != nil {
+				group.SetDescription(fmt.Sprintf("Unavailable: %v", err))
+			} else {
+				group.SetDescription("No discharging samples in this window")
+			}
+			for _, l := range values {
+				l.SetLabel("—")
+			}
+			return
+		}
+		group.SetDescription(fmt.Sprintf("While discharging, from %d samples", pp.Count))
+		for i, uw := range []int64{pp.P50UW, pp.P90UW, pp.P99UW} {
+			values[i].SetLabel(fmt.Sprintf("%.2f W", float64(uw)/1e6))
+		}
+	}
+	rangeDrop.NotifyProperty("selected", update)
+	update()
+
+	return group
+}
+
 func makeRow(title, value string) *adw.ActionRow {
 	row := adw.NewActionRow()
 	row.SetTitle(title)
@@ -68,6 +246,10 @@ func makeRow(title, value string) *adw.ActionRow {
 	return row
 }
 
-func chargeToWh(chargeUAH, voltageUV int64) float64 {
-	return float64(chargeUAH) * float64(voltageUV) / 1e12
+// whBasisLabel names a Wh voltage basis for display.
+func whBasisLabel(basis collector.WhVoltageBasis) string {
+	if basis == collector.WhBasisNominal {
+		return "nominal"
+	}
+	return "minimum design"
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// bucketDuration picks the energy graph bucket width for a visible time span.
+func bucketDuration(d time.Duration) time.Duration {
+	switch {
+	case d <= 15*time.Minute:
+		return 15 * time.Second
+	case d <= time.Hour:
+		return time.Minute
+	case d <= 3*time.Hour:
+		return 5 * time.Minute
+	case d <= 6*time.Hour:
+		return 10 * time.Minute
+	case d <= 24*time.Hour:
+		return 30 * time.Minute
+	default:
+		return time.Hour
+	}
+}
+
+type powerBucket struct {
+	sumPowerUW int64
+	count      int
+	charging   bool
+	chgCount   int
+	chgSumUW   int64 // power of the charging samples, included in sumPowerUW
+}
+
+// avgPowerW returns the bucket's mean power in watts, or 0 for an empty bucket.
+func (b powerBucket) avgPowerW() float64 {
+	if b.count == 0 {
+		return 0
+	}
+	return float64(b.sumPowerUW) / float64(b.count) / 1e6
+}
+
+// dischargePowerW returns the mean power of the bucket's samples taken while
+// not charging, in watts, or 0 if there are none.
+func (b powerBucket) dischargePowerW() float64 {
+	if n := b.count - b.chgCount; n > 0 {
+		return float64(b.sumPowerUW-b.chgSumUW) / float64(n) / 1e6
+	}
+	return 0
+}
+
+// aboveBaselineW returns powerW minus baselineW, clamped at zero, so a
+// baseline-subtracted chart shows only consumption above the idle floor.
+func aboveBaselineW(powerW, baselineW float64) float64 {
+	return max(powerW-baselineW, 0)
+}
+
+// bucketPower groups samples in [from, to) into fixed-width buckets sized by
+// bucketDuration. A bucket is marked charging when more than half of its
+// samples were taken while charging. Samples outside the range are dropped.
+func bucketPower(samples []collector.BatterySample, from, to time.Time) []powerBucket {
+	fromUnix := from.Unix()
+	toUnix := to.Unix()
+	if toUnix <= fromUnix {
+		return nil
+	}
+
+	bucketSecs := int64(bucketDuration(to.Sub(from)).Seconds())
+	numBuckets := int((toUnix - fromUnix) / bucketSecs)
+	if numBuckets < 1 {
+		numBuckets = 1
+	}
+
+	buckets := make([]powerBucket, numBuckets)
+	for _, s := range samples {
+		if s.Timestamp < fromUnix {
+			continue
+		}
+		idx := int((s.Timestamp - fromUnix) / bucketSecs)
+		if idx >= numBuckets {
+			continue
+		}
+		buckets[idx].sumPowerUW += s.PowerUW
+		buckets[idx].count++
+		if s.Status == "Charging" {
+			buckets[idx].chgCount++
+			buckets[idx].chgSumUW += s.PowerUW
+		}
+	}
+	for i := range buckets {
+		if buckets[i].count > 0 {
+			buckets[i].charging = buckets[i].chgCount > buckets[i].count/2
+		}
+	}
+	return buckets
+}
+
+// chargingRuns returns the [start, end) index ranges of consecutive charging
+// buckets, which the discharge-only energy graph blanks out.
+func chargingRuns(buckets []powerBucket) [][2]int {
+	var runs [][2]int
+	for i := 0; i < len(buckets); i++ {
+		if !buckets[i].charging {
+			continue
+		}
+		start := i
+		for i < len(buckets) && buckets[i].charging {
+			i++
+		}
+		runs = append(runs, [2]int{start, i})
+	}
+	return runs
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestBucketDuration(t *testing.T) {
+	tests := []struct {
+		span time.Duration
+		want time.Duration
+	}{
+		{10 * time.Minute, 15 * time.Second},
+		{15 * time.Minute, 15 * time.Second},
+		{time.Hour, time.Minute},
+		{3 * time.Hour, 5 * time.Minute},
+		{6 * time.Hour, 10 * time.Minute},
+		{24 * time.Hour, 30 * time.Minute},
+		{7 * 24 * time.Hour, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := bucketDuration(tt.span); got != tt.want {
+			t.Errorf("bucketDuration(%v) = %v, want %v", tt.span, got, tt.want)
+		}
+	}
+}
+
+func TestBucketPower_Empty(t *testing.T) {
+	from := time.Unix(1000, 0)
+	to := from.Add(time.Hour)
+
+	buckets := bucketPower(nil, from, to)
+	if len(buckets) != 60 {
+		t.Fatalf("len(buckets) = %d, want 60 one-minute buckets", len(buckets))
+	}
+	for i, b := range buckets {
+		if b.count != 0 || b.avgPowerW() != 0 {
+			t.Fatalf("bucket %d = %#v, want empty", i, b)
+		}
+	}
+
+	if got := bucketPower(nil, to, from); got != nil {
+		t.Fatalf("bucketPower(reversed range) = %#v, want nil", got)
+	}
+}
+
+func TestBucketPower_DropsSamplesOutsideRange(t *testing.T) {
+	from := time.Unix(1000, 0)
+	to := from.Add(time.Hour)
+	samples := []collector.BatterySample{
+		{Timestamp: 999, PowerUW: 9_000_000},  // just before range
+		{Timestamp: 1000, PowerUW: 4_000_000}, // first bucket
+		{Timestamp: 1059, PowerUW: 6_000_000}, // still first bucket
+		{Timestamp: 4599, PowerUW: 2_000_000}, // last bucket
+		{Timestamp: 4600, PowerUW: 9_000_000}, // at range end
+	}
+
+	buckets := bucketPower(samples, from, to)
+	if buckets[0].count != 2 || buckets[0].avgPowerW() != 5 {
+		t.Fatalf("first bucket = %#v, want 2 samples averaging 5 W", buckets[0])
+	}
+	last := buckets[len(buckets)-1]
+	if last.count != 1 || last.avgPowerW() != 2 {
+		t.Fatalf("last bucket = %#v, want 1 sample at 2 W", last)
+	}
+	total := 0
+	for _, b := range buckets {
+		total += b.count
+	}
+	if total != 3 {
+		t.Fatalf("bucketed %d samples, want 3", total)
+	}
+}
+
+func TestBucketPower_ChargingMajority(t *testing.T) {
+	from := time.Unix(0, 0)
+	to := from.Add(time.Hour)
+	samples := []collector.BatterySample{
+		// Bucket 0: 2 of 3 charging -> charging.
+		{Timestamp: 0, Status: "Charging"},
+		{Timestamp: 10, Status: "Charging"},
+		{Timestamp: 20, Status: "Discharging"},
+		// Bucket 1: exactly half charging -> not charging.
+		{Timestamp: 60, Status: "Charging"},
+		{Timestamp: 70, Status: "Discharging"},
+		// Bucket 2: single charging sample -> charging.
+		{Timestamp: 120, Status: "Charging"},
+	}
+
+	buckets := bucketPower(samples, from, to)
+	want := []bool{true, false, true, false}
+	for i, w := range want {
+		if buckets[i].charging != w {
+			t.Errorf("bucket %d charging = %v, want %v (%#v)", i, buckets[i].charging, w, buckets[i])
+		}
+	}
+}
+
+func TestBucketPower_ShortRangeUsesSingleBucket(t *testing.T) {
+	from := time.Unix(0, 0)
+	to := from.Add(5 * time.Second)
+
+	buckets := bucketPower([]collector.BatterySample{{Timestamp: 3, PowerUW: 1_000_000}}, from, to)
+	if len(buckets) != 1 || buckets[0].count != 1 {
+		t.Fatalf("buckets = %#v, want one bucket holding the sample", buckets)
+	}
+}
+
+func TestAboveBaselineW(t *testing.T) {
+	tests := []struct {
+		power, baseline, want float64
+	}{
+		{10, 4, 6},
+		{4, 4, 0},
+		{3, 4, 0},
+		{7.5, 0, 7.5},
+	}
+	for _, tt := range tests {
+		if got := aboveBaselineW(tt.power, tt.baseline); got != tt.want {
+			t.Fatalf("aboveBaselineW(%v, %v) = %v, want %v", tt.power, tt.baseline, got, tt.want)
+		}
+	}
+}
+
+func TestPowerBucket_DischargePowerW(t *testing.T) {
+	from := time.Unix(0, 0)
+	to := from.Add(time.Hour)
+	samples := []collector.BatterySample{
+		{Timestamp: 0, PowerUW: 30_000_000, Status: "Charging"},
+		{Timestamp: 10, PowerUW: 4_000_000, Status: "Discharging"},
+		{Timestamp: 20, PowerUW: 6_000_000, Status: "Discharging"},
+		{Timestamp: 60, PowerUW: 25_000_000, Status: "Charging"},
+	}
+	buckets := bucketPower(samples, from, to)
+	if got := buckets[0].dischargePowerW(); got != 5 {
+		t.Errorf("mixed bucket dischargePowerW() = %v, want 5", got)
+	}
+	if got := buckets[1].dischargePowerW(); got != 0 {
+		t.Errorf("charging bucket dischargePowerW() = %v, want 0", got)
+	}
+}
+
+func TestChargingRuns(t *testing.T) {
+	buckets := []powerBucket{
+		{charging: true}, {}, {charging: true}, {charging: true}, {}, {charging: true},
+	}
+	got := chargingRuns(buckets)
+	want := [][2]int{{0, 1}, {2, 4}, {5, 6}}
+	if !slices.Equal(got, want) {
+		t.Errorf("chargingRuns() = %v, want %v", got, want)
+	}
+	if got := chargingRuns([]powerBucket{{}, {}}); got != nil {
+		t.Errorf("chargingRuns(no charging) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// readCalibration parses the calibration file at path. A missing file is
+// not an error: it returns nil, nil.
+func readCalibration(path string) (*calibration.CalibrationResult, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result calibration.CalibrationResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// loadCalibration reads the user's calibration results, or nil if the
+// display has never been calibrated.
+func loadCalibration() (*calibration.CalibrationResult, error) {
+	path, err := calibration.ResultPath()
+	if err != nil {
+		return nil, err
+	}
+	return readCalibration(path)
+}
+
+// systemCommunityDir holds community calibrations shipped with the package.
+const systemCommunityDir = "/usr/share/power-monitor/community"
+
+// communityCalibrationDirs returns where community calibration exports are
+// looked up: "community" next to calibration.json, then systemCommunityDir.
+func communityCalibrationDirs() []string {
+	var dirs []string
+	if path, err := calibration.ResultPath(); err == nil {
+		dirs = append(dirs, filepath.Join(filepath.Dir(path), "community"))
+	}
+	return append(dirs, systemCommunityDir)
+}
+
+// loadCommunityCalibration returns a community estimate for health's
+// battery model, or nil if no export matches. It stands in for
+// calibration.json until the user calibrates and is never saved over it.
+func loadCommunityCalibration(health *collector.BatteryHealth) (*calibration.CalibrationResult, string) {
+	exp, path := calibration.FindCommunityCalibration(communityCalibrationDirs(), health, collector.CollectMachineInfo())
+	if exp == nil {
+		return nil, ""
+	}
+	return exp.Estimate(), path
+}
+
+// isCommunityCalibration reports whether result is a community estimate
+// rather than a calibration measured on this device.
+func isCommunityCalibration(result *calibration.CalibrationResult) bool {
+	return result != nil && result.Source == calibration.SourceCommunity
+}
+
+// saveCalibration writes result to calibration.ResultPath and returns the
+// path written.
+func saveCalibration(result *calibration.CalibrationResult) (string, error) {
+	outPath, err := calibration.ResultPath()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(outPath, data, 0644); err != nil {
+		return "", err
+	}
+	calibration.ChownToSudoUser(filepath.Dir(outPath), outPath)
+	return outPath, nil
+}
+
+// estimateDisplayPowerUW estimates the display's share of power at
+// brightnessPct by interpolating the calibrated per-level power above the
+// display-off baseline, and its error the same way from the levels'
+// AvgPowerErrorUW. Brightness outside the measured levels is clamped to the
+// nearest one. ok is false without calibration samples.
+func estimateDisplayPowerUW(result *calibration.CalibrationResult, brightnessPct float64) (uw, errUW int64, ok bool) {
+	if result == nil || len(result.Samples) == 0 {
+		return 0, 0, false
+	}
+	samples := append([]calibration.BrightnessSample(nil), result.Samples...)
+	sort.Slice(samples, func(i, j int) bool { return samples[i].BrightnessPct < samples[j].BrightnessPct })
+	display := func(s calibration.BrightnessSample) float64 {
+		return max(float64(s.AvgPowerUW-result.BaselinePowerUW), 0)
+	}
+	errOf := func(s calibration.BrightnessSample) float64 {
+		return float64(s.AvgPowerErrorUW)
+	}
+
+	first, last := samples[0], samples[len(samples)-1]
+	if brightnessPct <= float64(first.BrightnessPct) {
+		return int64(display(first)), first.AvgPowerErrorUW, true
+	}
+	for i := 1; i < len(samples); i++ {
+		lo, hi := samples[i-1], samples[i]
+		if brightnessPct <= float64(hi.BrightnessPct) {
+			frac := (brightnessPct - float64(lo.BrightnessPct)) / float64(hi.BrightnessPct-lo.BrightnessPct)
+			return int64(display(lo) + frac*(display(hi)-display(lo))),
+				int64(errOf(lo) + frac*(errOf(hi)-errOf(lo))), true
+		}
+	}
+	return int64(display(last)), last.AvgPowerErrorUW, true
+}
+
+// displayPowerEstimate estimates the display's power at brightnessPct, and
+// its error, from the saved calibration (or community estimate), or failing that from the daemon's
+// background model once it has at least medium confidence. source describes
+// which was used.
+func displayPowerEstimate(result *calibration.CalibrationResult, model *calibration.DisplayPowerModel, brightnessPct float64) (uw, errUW int64, source string, ok bool) {
+	if uw, errUW, ok := estimateDisplayPowerUW(result, brightnessPct); ok {
+		if isCommunityCalibration(result) {
+			return uw, errUW, "community estimate, not measured on this device", true
+		}
+		return uw, errUW, "calibration", true
+	}
+	if model == nil {
+		return 0, 0, "", false
+	}
+	switch model.Confidence {
+	case calibration.ConfidenceMedium, calibration.ConfidenceHigh:
+		errUW := int64(math.Round(model.DisplayErrorUWPerPct * max(brightnessPct, 0)))
+		return model.DisplayUW(brightnessPct), errUW, model.Confidence + "-confidence background model", true
+	}
+	return 0, 0, "", false
+}
+
+// formatPowerWithError formats a power and its error in watts, e.g.
+// "1.5 ± 0.2 W", with a second decimal for errors under 0.1 W so they do not
+// round to zero. The error is left out when it is zero, as in results from
+// before errors were recorded.
+func formatPowerWithError(uw, errUW int64) string {
+	switch {
+	case errUW <= 0:
+		return fmt.Sprintf("%.1f W", float64(uw)/1e6)
+	case errUW < 100000:
+		return fmt.Sprintf("%.2f ± %.2f W", float64(uw)/1e6, float64(errUW)/1e6)
+	}
+	return fmt.Sprintf("%.1f ± %.1f W", float64(uw)/1e6, float64(errUW)/1e6)
+}
+
+// calibrationPoint is one calibrated level as plotted on the calibration
+// page: display power above the baseline, in watts, with its error.
+type calibrationPoint struct {
+	BrightnessPct int
+	DisplayW      float64
+	ErrorW        float64
+}
+
+// calibrationPoints returns the result's levels in brightness order with the
+// display-off baseline subtracted. Display power below the baseline (noise
+// at low brightness) is kept negative so the error bar still shows it.
+func calibrationPoints(result *calibration.CalibrationResult) []calibrationPoint {
+	if result == nil {
+		return nil
+	}
+	pts := make([]calibrationPoint, 0, len(result.Samples))
+	for _, s := range result.Samples {
+		pts = append(pts, calibrationPoint{
+			BrightnessPct: s.BrightnessPct,
+			DisplayW:      float64(s.AvgPowerUW-result.BaselinePowerUW) / 1e6,
+			ErrorW:        float64(s.AvgPowerErrorUW) / 1e6,
+		})
+	}
+	sort.Slice(pts, func(i, j int) bool { return pts[i].BrightnessPct < pts[j].BrightnessPct })
+	return pts
+}
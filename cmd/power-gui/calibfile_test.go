@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestReadCalibration(t *testing.T) {
+	dir := t.TempDir()
+
+	got, err := readCalibration(filepath.Join(dir, "missing.json"))
+	if err != nil || got != nil {
+		t.Fatalf("readCalibration(missing) = %#v, %v; want nil, nil", got, err)
+	}
+
+	path := filepath.Join(dir, "calibration.json")
+	data := `{"baseline_power_uw": 4200000, "samples": [{"brightness_pct": 50, "avg_power_uw": 5100000}]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	got, err = readCalibration(path)
+	if err != nil {
+		t.Fatalf("readCalibration() error = %v", err)
+	}
+	if got.BaselinePowerUW != 4200000 || len(got.Samples) != 1 {
+		t.Fatalf("readCalibration() = %#v, want baseline 4200000 and one sample", got)
+	}
+
+	if err := os.WriteFile(path, []byte("{broken"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if _, err := readCalibration(path); err == nil {
+		t.Fatal("readCalibration(corrupt) error = nil, want parse error")
+	}
+}
+
+func TestSaveCalibration_RoundTrip(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	want := &calibration.CalibrationResult{BaselinePowerUW: 3000000, CalibratedAt: "2026-01-01T00:00:00Z"}
+
+	path, err := saveCalibration(want)
+	if err != nil {
+		t.Fatalf("saveCalibration() error = %v", err)
+	}
+	if wantPath, _ := calibration.ResultPath(); path != wantPath {
+		t.Fatalf("saveCalibration() path = %q, want %q", path, wantPath)
+	}
+	got, err := loadCalibration()
+	if err != nil {
+		t.Fatalf("loadCalibration() error = %v", err)
+	}
+	if got == nil || got.BaselinePowerUW != want.BaselinePowerUW || got.CalibratedAt != want.CalibratedAt {
+		t.Fatalf("loadCalibration() = %#v, want %#v", got, want)
+	}
+}
+
+func TestEstimateDisplayPowerUW(t *testing.T) {
+	result := &calibration.CalibrationResult{
+		BaselinePowerUW: 4000000,
+		Samples: []calibration.BrightnessSample{
+			{BrightnessPct: 100, AvgPowerUW: 8000000, AvgPowerErrorUW: 40000},
+			{BrightnessPct: 0, AvgPowerUW: 4500000, AvgPowerErrorUW: 200000},
+			{BrightnessPct: 50, AvgPowerUW: 6000000, AvgPowerErrorUW: 100000},
+		},
+	}
+	tests := []struct {
+		pct     float64
+		want    int64
+		wantErr int64
+	}{
+		{0, 500000, 200000},
+		{25, 1250000, 150000},
+		{50, 2000000, 100000},
+		{75, 3000000, 70000},
+		{100, 4000000, 40000},
+		{120, 4000000, 40000},
+		{-5, 500000, 200000},
+	}
+	for _, tt := range tests {
+		got, gotErr, ok := estimateDisplayPowerUW(result, tt.pct)
+		if !ok || got != tt.want || gotErr != tt.wantErr {
+			t.Fatalf("estimateDisplayPowerUW(%v) = %d, %d, %v; want %d, %d, true", tt.pct, got, gotErr, ok, tt.want, tt.wantErr)
+		}
+	}
+
+	if _, _, ok := estimateDisplayPowerUW(nil, 50); ok {
+		t.Fatal("estimateDisplayPowerUW(nil) ok = true, want false")
+	}
+	if _, _, ok := estimateDisplayPowerUW(&calibration.CalibrationResult{}, 50); ok {
+		t.Fatal("estimateDisplayPowerUW(no samples) ok = true, want false")
+	}
+}
+
+func TestDisplayPowerEstimate(t *testing.T) {
+	result := &calibration.CalibrationResult{
+		BaselinePowerUW: 4000000,
+		Samples: []calibration.BrightnessSample{
+			{BrightnessPct: 0, AvgPowerUW: 4000000, AvgPowerErrorUW: 100000},
+			{BrightnessPct: 100, AvgPowerUW: 6000000, AvgPowerErrorUW: 100000},
+		},
+	}
+	model := &calibration.DisplayPowerModel{DisplayUWPerPct: 30000, DisplayErrorUWPerPct: 2000, Confidence: calibration.ConfidenceMedium}
+
+	if uw, errUW, source, ok := displayPowerEstimate(result, model, 50); !ok || uw != 1000000 || errUW != 100000 || source != "calibration" {
+		t.Fatalf("with calibration = %d, %d, %q, %v; want the calibration's 1000000 ± 100000", uw, errUW, source, ok)
+	}
+	if uw, errUW, source, ok := displayPowerEstimate(nil, model, 50); !ok || uw != 1500000 || errUW != 100000 || source != "medium-confidence background model" {
+		t.Fatalf("model only = %d, %d, %q, %v; want the model's 1500000 ± 100000", uw, errUW, source, ok)
+	}
+	for _, conf := range []string{calibration.ConfidenceNone, calibration.ConfidenceLow} {
+		weak := *model
+		weak.Confidence = conf
+		if _, _, _, ok := displayPowerEstimate(nil, &weak, 50); ok {
+			t.Fatalf("%s-confidence model ok = true, want false", conf)
+		}
+	}
+	if _, _, _, ok := displayPowerEstimate(nil, nil, 50); ok {
+		t.Fatal("no calibration or model ok = true, want false")
+	}
+}
+
+func TestFormatPowerWithError(t *testing.T) {
+	tests := []struct {
+		uw, errUW int64
+		want      string
+	}{
+		{1500000, 200000, "1.5 ± 0.2 W"},
+		{1500000, 0, "1.5 W"},
+		{2340000, 30000, "2.34 ± 0.03 W"},
+	}
+	for _, tt := range tests {
+		if got := formatPowerWithError(tt.uw, tt.errUW); got != tt.want {
+			t.Errorf("formatPowerWithError(%d, %d) = %q, want %q", tt.uw, tt.errUW, got, tt.want)
+		}
+	}
+}
+
+func TestCalibrationPoints(t *testing.T) {
+	if pts := calibrationPoints(nil); pts != nil {
+		t.Fatalf("calibrationPoints(nil) = %#v, want nil", pts)
+	}
+
+	result := &calibration.CalibrationResult{
+		BaselinePowerUW: 5000000,
+		Samples: []calibration.BrightnessSample{
+			{BrightnessPct: 100, AvgPowerUW: 8000000, AvgPowerErrorUW: 50000},
+			{BrightnessPct: 0, AvgPowerUW: 4900000, AvgPowerErrorUW: 200000},
+			{BrightnessPct: 50, AvgPowerUW: 6500000, AvgPowerErrorUW: 100000},
+		},
+	}
+	want := []calibrationPoint{
+		{BrightnessPct: 0, DisplayW: -0.1, ErrorW: 0.2},
+		{BrightnessPct: 50, DisplayW: 1.5, ErrorW: 0.1},
+		{BrightnessPct: 100, DisplayW: 3, ErrorW: 0.05},
+	}
+	got := calibrationPoints(result)
+	if len(got) != len(want) {
+		t.Fatalf("calibrationPoints() = %#v, want %#v", got, want)
+	}
+	for i := range want {
+		if got[i].BrightnessPct != want[i].BrightnessPct ||
+			math.Abs(got[i].DisplayW-want[i].DisplayW) > 1e-9 ||
+			math.Abs(got[i].ErrorW-want[i].ErrorW) > 1e-9 {
+			t.Fatalf("point %d = %#v, want %#v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadCommunityCalibration(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	health := &collector.BatteryHealth{Manufacturer: "SMP", Model: "5B10W51867"}
+	if got, _ := loadCommunityCalibration(health); got != nil {
+		t.Fatalf("no exports: got %#v, want nil", got)
+	}
+
+	exp := calibration.NewCommunityExport(&calibration.CalibrationResult{
+		BaselinePowerUW: 3000000,
+		CalibratedAt:    "2026-03-14T09:26:53Z",
+		Samples:         []calibration.BrightnessSample{{BrightnessPct: 100, AvgPowerUW: 5000000}},
+	}, health, collector.MachineInfo{})
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(config, "power-monitor", "community")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "t14.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, path := loadCommunityCalibration(health)
+	if got == nil || !isCommunityCalibration(got) || path != filepath.Join(dir, "t14.json") {
+		t.Fatalf("loadCommunityCalibration() = %#v, %q", got, path)
+	}
+	if _, _, source, ok := displayPowerEstimate(got, nil, 100); !ok || source != "community estimate, not measured on this device" {
+		t.Errorf("displayPowerEstimate source = %q, %v", source, ok)
+	}
+	other := &collector.BatteryHealth{Manufacturer: "SMP", Model: "other"}
+	if got, _ := loadCommunityCalibration(other); got != nil {
+		t.Errorf("other battery model: got %#v, want nil", got)
+	}
+}
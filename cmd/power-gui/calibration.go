@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
+)
+
+type calibrationPage struct {
+	container *gtk.Box
+
+	startButton  *gtk.Button
+	progressBar  *gtk.ProgressBar
+	levelLabel   *gtk.Label
+	detailLabel  *gtk.Label
+	resultsGroup *adw.PreferencesGroup
+	resultsGraph *calibrationGraph
+	resultRows   []*adw.ActionRow
+
+	// ownRun is set while a run this window started is active; only that
+	// window saves the result, though every open one shows the progress.
+	ownRun bool
+}
+
+func newCalibrationPage() *calibrationPage {
+	p := &calibrationPage{}
+
+	p.container = gtk.NewBox(gtk.OrientationVertical, 12)
+	p.container.SetMarginStart(24)
+	p.container.SetMarginEnd(24)
+	p.container.SetMarginTop(24)
+	p.container.SetMarginBottom(24)
+
+	header := adw.NewPreferencesGroup()
+	header.SetTitle("Display Calibration")
+	header.SetDescription("Measures display power at several brightness levels. " +
+		"Run on battery with other programs closed and do not touch the laptop until it finishes.")
+	p.container.Append(header)
+
+	progressGroup := adw.NewPreferencesGroup()
+	progressGroup.SetTitle("Progress")
+
+	p.progressBar = gtk.NewProgressBar()
+	p.progressBar.SetShowText(true)
+	p.progressBar.SetText("Idle")
+
+	p.levelLabel = gtk.NewLabel("Not running")
+	p.levelLabel.SetXAlign(0)
+	p.levelLabel.AddCSSClass("heading")
+
+	p.detailLabel = gtk.NewLabel("")
+	p.detailLabel.SetXAlign(0)
+	p.detailLabel.SetWrap(true)
+	p.detailLabel.AddCSSClass("dim-label")
+	p.detailLabel.AddCSSClass("monospace")
+
+	progressBox := gtk.NewBox(gtk.OrientationVertical, 6)
+	progressBox.Append(p.progressBar)
+	progressBox.Append(p.levelLabel)
+	progressBox.Append(p.detailLabel)
+	progressGroup.Add(progressBox)
+	p.container.Append(progressGroup)
+
+	p.startButton = gtk.NewButtonWithLabel("Start Calibration")
+	p.startButton.AddCSSClass("suggested-action")
+	p.startButton.SetHAlign(gtk.AlignStart)
+	p.startButton.ConnectClicked(p.start)
+	p.container.Append(p.startButton)
+
+	p.resultsGroup = adw.NewPreferencesGroup()
+	p.resultsGroup.SetTitle("Results")
+	p.resultsGroup.SetVisible(false)
+	p.resultsGraph = newCalibrationGraph()
+	p.resultsGraph.area.SetMarginBottom(12)
+	p.resultsGroup.Add(p.resultsGraph.area)
+	p.container.Append(p.resultsGroup)
+
+	p.container.Append(newDisplayModelGroup())
+
+	if err := client.WatchCalibration(
+		func(prog calibration.Progress) {
+			glib.IdleAdd(func() { p.showProgress(prog) })
+		},
+		func(done calibrationComplete) {
+			glib.IdleAdd(func() { p.finish(done) })
+		},
+	); err != nil {
+		p.startButton.SetSensitive(false)
+		p.levelLabel.SetLabel(fmt.Sprintf("Calibration unavailable: %v", err))
+	} else if isCommunityCalibration(calib) {
+		p.levelLabel.SetLabel("Using a community estimate, not measured on this device. Calibrate for accurate results.")
+	} else if calib != nil {
+		p.levelLabel.SetLabel(fmt.Sprintf("Last calibrated %s", calib.CalibratedAt))
+	}
+	if calib != nil {
+		p.showResults(calib)
+	}
+
+	return p
+}
+
+func (p *calibrationPage) start() {
+	p.startButton.SetSensitive(false)
+	p.progressBar.SetFraction(0)
+	p.progressBar.SetText("Starting")
+	p.levelLabel.SetLabel("Preparing...")
+	p.detailLabel.SetLabel("")
+	// The daemon may wait for polkit to ask for a password; keep the window
+	// responsive meanwhile.
+	go func() {
+		err := client.RunCalibration()
+		glib.IdleAdd(func() {
+			if err != nil {
+				p.startButton.SetSensitive(true)
+				p.progressBar.SetText("Idle")
+				p.levelLabel.SetLabel(fmt.Sprintf("Failed to start: %v", err))
+				return
+			}
+			p.ownRun = true
+		})
+	}()
+}
+
+func (p *calibrationPage) showProgress(prog calibration.Progress) {
+	// Another client may have started the run; reflect it here too.
+	p.startButton.SetSensitive(false)
+	frac := calibrationFraction(prog)
+	p.progressBar.SetFraction(frac)
+	p.progressBar.SetText(fmt.Sprintf("%.0f%%", frac*100))
+	switch prog.Phase {
+	case "prepare", "restore":
+		p.levelLabel.SetLabel(prog.Message)
+	case "level":
+		p.levelLabel.SetLabel(prog.Message)
+		p.detailLabel.SetLabel("")
+	default:
+		p.detailLabel.SetLabel(prog.Message)
+	}
+}
+
+func (p *calibrationPage) finish(done calibrationComplete) {
+	p.startButton.SetSensitive(true)
+	ownRun := p.ownRun
+	p.ownRun = false
+	if done.Error != "" || done.Result == nil {
+		p.progressBar.SetText("Failed")
+		p.levelLabel.SetLabel("Calibration failed")
+		p.detailLabel.SetLabel(done.Error)
+		return
+	}
+
+	p.progressBar.SetFraction(1)
+	p.progressBar.SetText("Done")
+	p.levelLabel.SetLabel("Calibration complete")
+	calib = done.Result
+	if !ownRun {
+		p.detailLabel.SetLabel("Started from another window; results are saved there")
+	} else if path, err := saveCalibration(done.Result); err != nil {
+		p.detailLabel.SetLabel(fmt.Sprintf("Failed to save results: %v", err))
+	} else {
+		p.detailLabel.SetLabel(fmt.Sprintf("Results written to %s", path))
+	}
+	p.showResults(done.Result)
+}
+
+func (p *calibrationPage) showResults(result *calibration.CalibrationResult) {
+	for _, row := range p.resultRows {
+		p.resultsGroup.Remove(row)
+	}
+	p.resultRows = p.resultRows[:0]
+	if isCommunityCalibration(result) {
+		p.resultsGroup.SetTitle("Community Estimate")
+		p.resultsGroup.SetDescription(fmt.Sprintf("Measured on another device with the same battery model on %s, with a wider error", result.CalibratedAt))
+	} else {
+		p.resultsGroup.SetTitle("Results")
+		p.resultsGroup.SetDescription("")
+	}
+
+	add := func(title, value string) {
+		row := makeRow(title, value)
+		p.resultsGroup.Add(row)
+		p.resultRows = append(p.resultRows, row)
+	}
+	if result.BacklightDevice != "" {
+		add("Backlight", result.BacklightDevice)
+	}
+	add("Baseline (display off)", fmt.Sprintf("%.2f W", float64(result.BaselinePowerUW)/1e6))
+	for _, s := range result.Samples {
+		add(fmt.Sprintf("Brightness %d%%", s.BrightnessPct),
+			fmt.Sprintf("%.2f W display (± %.3f W)",
+				float64(s.AvgPowerUW-result.BaselinePowerUW)/1e6, float64(s.AvgPowerErrorUW)/1e6))
+	}
+	p.resultsGraph.SetData(calibrationPoints(result))
+	p.resultsGroup.SetVisible(true)
+}
+
+// calibrationFraction estimates overall run completion from a progress event.
+func calibrationFraction(prog calibration.Progress) float64 {
+	if prog.Levels <= 0 || prog.Level <= 0 {
+		return 0
+	}
+	frac := float64(prog.Level-1) / float64(prog.Levels)
+	if prog.Phase == "window" && prog.ElapsedSec+prog.RemainingSec > 0 {
+		frac += float64(prog.ElapsedSec) / float64(prog.ElapsedSec+prog.RemainingSec) / float64(prog.Levels)
+	}
+	if prog.Phase == "result" || prog.Phase == "end" {
+		frac = float64(prog.Level) / float64(prog.Levels)
+	}
+	return min(frac, 1)
+}
+
+// newDisplayModelGroup summarizes the daemon's background display power
+// model, which refines itself from everyday use when
+// collection.refine_display_model is on.
+func newDisplayModelGroup() *adw.PreferencesGroup {
+	group := adw.NewPreferencesGroup()
+	group.SetTitle("Background Model")
+
+	m, err := client.GetDisplayPowerModel()
+	switch {
+	case err != nil:
+		group.SetDescription(fmt.Sprintf("Unavailable: %v", err))
+		return group
+	case m.Points == 0:
+		group.SetDescription("No data yet. Enable \"Refine Display Model\" in Settings to learn display power from normal use on battery, without a calibration run.")
+		return group
+	case m.Confidence == calibration.ConfidenceNone:
+		group.SetDescription(fmt.Sprintf("Collecting: %d stable periods between %.0f%% and %.0f%% brightness so far. "+
+			"The model needs more periods across a wider brightness range.", m.Points, m.MinBrightness, m.MaxBrightness))
+		return group
+	}
+	group.SetDescription("Fitted from stable periods on battery. Used for display power estimates when there is no calibration.")
+	group.Add(makeRow("Confidence", m.Confidence))
+	group.Add(makeRow("Stable Periods", fmt.Sprintf("%d (%.0f%%–%.0f%% brightness)", m.Points, m.MinBrightness, m.MaxBrightness)))
+	group.Add(makeRow("Baseline", fmt.Sprintf("%.2f W", float64(m.BaselinePowerUW)/1e6)))
+	group.Add(makeRow("Display at 100%", fmt.Sprintf("%.2f W (± %.2f W)", float64(m.DisplayUW(100))/1e6, m.DisplayErrorUWPerPct*100/1e6)))
+	if m.UpdatedAt > 0 {
+		group.Add(makeRow("Last Updated", formatTime(time.Unix(m.UpdatedAt, 0), timeStyleDayClock)))
+	}
+	return group
+}
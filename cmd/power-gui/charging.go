@@ -0,0 +1,33 @@
+package main
+
+import "github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+
+// chargingSpan is a run of consecutive charging samples, from the first
+// charging sample to the sample that follows the run. A run at the end of
+// the data ends at its own last sample.
+type chargingSpan struct {
+	start int64
+	end   int64
+}
+
+// chargingSpans merges consecutive charging samples into spans so each run
+// is filled once. Filling per sample overlaps neighbouring bars when samples
+// are closer than a pixel, and the translucent bar then blends over itself.
+func chargingSpans(samples []collector.BatterySample) []chargingSpan {
+	var spans []chargingSpan
+	for i := 0; i < len(samples); i++ {
+		if samples[i].Status != "Charging" {
+			continue
+		}
+		span := chargingSpan{start: samples[i].Timestamp, end: samples[i].Timestamp}
+		for i+1 < len(samples) && samples[i+1].Status == "Charging" {
+			i++
+		}
+		span.end = samples[i].Timestamp
+		if i+1 < len(samples) {
+			span.end = samples[i+1].Timestamp
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestChargingSpans(t *testing.T) {
+	sample := func(ts int64, status string) collector.BatterySample {
+		return collector.BatterySample{Timestamp: ts, Status: status}
+	}
+	tests := []struct {
+		name    string
+		samples []collector.BatterySample
+		want    []chargingSpan
+	}{
+		{"empty", nil, nil},
+		{"never charging", []collector.BatterySample{sample(0, "Discharging"), sample(5, "Discharging")}, nil},
+		{"single run", []collector.BatterySample{
+			sample(0, "Discharging"), sample(5, "Charging"), sample(10, "Charging"), sample(15, "Full"),
+		}, []chargingSpan{{5, 15}}},
+		{"two runs", []collector.BatterySample{
+			sample(0, "Charging"), sample(5, "Discharging"), sample(10, "Charging"), sample(15, "Discharging"),
+		}, []chargingSpan{{0, 5}, {10, 15}}},
+		{"run at end", []collector.BatterySample{
+			sample(0, "Discharging"), sample(5, "Charging"), sample(10, "Charging"),
+		}, []chargingSpan{{5, 10}}},
+		{"lone last sample", []collector.BatterySample{
+			sample(0, "Discharging"), sample(5, "Charging"),
+		}, []chargingSpan{{5, 5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chargingSpans(tt.samples); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("chargingSpans() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
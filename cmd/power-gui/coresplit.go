@@ -0,0 +1,37 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// pCoreShare returns the P-core fraction of the split, by estimated energy
+// when there is any and by CPU ticks otherwise, and false when neither core
+// class has anything attributed to it.
+func pCoreShare(s coreClassEnergy) (float64, bool) {
+	if e := s.Split.PCoreEnergyUWH + s.Split.ECoreEnergyUWH; e > 0 {
+		return float64(s.Split.PCoreEnergyUWH) / float64(e), true
+	}
+	if t := s.Split.PCoreTicks + s.Split.ECoreTicks; t > 0 {
+		return float64(s.Split.PCoreTicks) / float64(t), true
+	}
+	return 0, false
+}
+
+// coreSplitSummary describes the split as e.g. "P-core 72% · 1.2 Wh  /
+// E-core 28% · 0.5 Wh", leaving out the energy when none was estimated. It
+// returns "" when nothing was attributed to either core class.
+func coreSplitSummary(s coreClassEnergy) string {
+	share, ok := pCoreShare(s)
+	if !ok {
+		return ""
+	}
+	pName := cmp.Or(s.PCoreLabel, "P-core")
+	eName := cmp.Or(s.ECoreLabel, "E-core")
+	pPct := int(share*100 + 0.5)
+	if s.Split.PCoreEnergyUWH+s.Split.ECoreEnergyUWH == 0 {
+		return fmt.Sprintf("%s %d%%  /  %s %d%% of CPU time", pName, pPct, eName, 100-pPct)
+	}
+	return fmt.Sprintf("%s %d%% · %.1f Wh  /  %s %d%% · %.1f Wh", pName, pPct,
+		float64(s.Split.PCoreEnergyUWH)/1e6, eName, 100-pPct, float64(s.Split.ECoreEnergyUWH)/1e6)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestCoreSplitSummary(t *testing.T) {
+	tests := []struct {
+		name  string
+		split coreClassEnergy
+		want  string
+	}{
+		{name: "nothing attributed", split: coreClassEnergy{}, want: ""},
+		{
+			name:  "unknown ticks only",
+			split: coreClassEnergy{Split: collector.CoreClassEnergy{UnknownTicks: 50}},
+			want:  "",
+		},
+		{
+			name:  "ticks without energy",
+			split: coreClassEnergy{Split: collector.CoreClassEnergy{PCoreTicks: 30, ECoreTicks: 10}},
+			want:  "P-core 75%  /  E-core 25% of CPU time",
+		},
+		{
+			name: "energy with labels",
+			split: coreClassEnergy{
+				Split: collector.CoreClassEnergy{
+					PCoreTicks: 10, ECoreTicks: 90,
+					PCoreEnergyUWH: 1_200_000, ECoreEnergyUWH: 800_000,
+				},
+				PCoreLabel: "Performance",
+				ECoreLabel: "Efficiency",
+			},
+			want: "Performance 60% · 1.2 Wh  /  Efficiency 40% · 0.8 Wh",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coreSplitSummary(tt.split); got != tt.want {
+				t.Errorf("coreSplitSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
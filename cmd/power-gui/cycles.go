@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// cyclePeriod is a window the battery page reports charge cycles over.
+type cyclePeriod struct {
+	Label string
+	Start func(now time.Time) time.Time
+}
+
+// cyclePeriods are the charge cycle windows on the battery page. The
+// daemon caps ranges at a year.
+var cyclePeriods = []cyclePeriod{
+	{"This Month", func(now time.Time) time.Time {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	}},
+	{"Last 30 Days", func(now time.Time) time.Time { return now.AddDate(0, 0, -30) }},
+	// A fixed duration, since a calendar year can exceed the cap by a DST hour.
+	{"Last 365 Days", func(now time.Time) time.Time { return now.Add(-365 * 24 * time.Hour) }},
+}
+
+// cycleLabel describes the estimated cycles in a period next to the
+// firmware counter's increase, when the firmware has one.
+func cycleLabel(c collector.ChargeCycles) string {
+	if c.Basis == "" {
+		return "No samples"
+	}
+	label := fmt.Sprintf("%.2f estimated", c.Cycles)
+	if c.Basis == collector.CycleBasisCapacity {
+		label += " (of full capacity)"
+	}
+	if c.FirmwareCycleCount > 0 {
+		label += fmt.Sprintf(" · %d by firmware", c.FirmwareCycles)
+	}
+	return label
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestCycleLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		c    collector.ChargeCycles
+		want string
+	}{
+		{"no samples", collector.ChargeCycles{}, "No samples"},
+		{"design charge with firmware", collector.ChargeCycles{Cycles: 1.456, Basis: collector.CycleBasisDesignCharge, FirmwareCycleCount: 120, FirmwareCycles: 1},
+			"1.46 estimated · 1 by firmware"},
+		{"capacity without firmware", collector.ChargeCycles{Cycles: 0.3, Basis: collector.CycleBasisCapacity},
+			"0.30 estimated (of full capacity)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cycleLabel(tt.c); got != tt.want {
+				t.Fatalf("cycleLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCyclePeriods(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 10, 30, 0, 0, time.UTC)
+	want := []time.Time{
+		time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2026, time.February, 13, 10, 30, 0, 0, time.UTC),
+		time.Date(2025, time.March, 15, 10, 30, 0, 0, time.UTC),
+	}
+	for i, p := range cyclePeriods {
+		if got := p.Start(now); !got.Equal(want[i]) {
+			t.Fatalf("%s starts %v, want %v", p.Label, got, want[i])
+		}
+		if now.Sub(p.Start(now)) > 365*24*time.Hour {
+			t.Fatalf("%s spans more than the daemon's one-year cap", p.Label)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	godbus "github.com/godbus/dbus/v5"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 	pmconfig "github.com/cptspacemanspiff/gnome-power-display/internal/config"
 )
@@ -15,11 +16,25 @@ const (
 	dbusName  = "org.gnome.PowerMonitor"
 	dbusPath  = "/org/gnome/PowerMonitor"
 	dbusIface = "org.gnome.PowerMonitor"
+	// dbusAPIVersion is the newest reply envelope version this client
+	// understands.
+	dbusAPIVersion = 1
 )
 
 type currentStats struct {
-	Battery   *collector.BatterySample   `json:"battery"`
-	Backlight *collector.BacklightSample `json:"backlight"`
+	Battery         *collector.BatterySample   `json:"battery"`
+	Backlight       *collector.BacklightSample `json:"backlight"`
+	IntervalSeconds int                        `json:"interval_seconds"`
+	PowerEWMAUW     int64                      `json:"power_ewma_uw"`
+	DaemonStarted   int64                      `json:"daemon_started"`
+}
+
+// coreClassEnergy is GetCoreClassEnergy's reply: the split and the names the
+// daemon is configured to show for each core class.
+type coreClassEnergy struct {
+	Split      collector.CoreClassEnergy `json:"split"`
+	PCoreLabel string                    `json:"p_core_label"`
+	ECoreLabel string                    `json:"e_core_label"`
 }
 
 type historyData struct {
@@ -27,6 +42,34 @@ type historyData struct {
 	Backlight []collector.BacklightSample `json:"backlight"`
 }
 
+type powerHistogram struct {
+	Buckets []collector.PowerHistogramBucket `json:"buckets"`
+	Total   int                              `json:"total"`
+}
+
+type calibrationComplete struct {
+	Result *calibration.CalibrationResult `json:"result"`
+	Error  string                         `json:"error"`
+}
+
+// decodeReply unmarshals a daemon reply or signal payload into v. Replies come
+// wrapped as {"v":N,"data":...}; daemons predating the envelope send the data
+// bare, which is still accepted. A newer version than dbusAPIVersion is an
+// error, since its shapes may have changed incompatibly.
+func decodeReply(payload string, v any) error {
+	var env struct {
+		V    int             `json:"v"`
+		Data json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal([]byte(payload), &env) != nil || env.V == 0 || env.Data == nil {
+		return json.Unmarshal([]byte(payload), v)
+	}
+	if env.V > dbusAPIVersion {
+		return fmt.Errorf("daemon reply version %d is newer than supported version %d; update the GUI", env.V, dbusAPIVersion)
+	}
+	return json.Unmarshal(env.Data, v)
+}
+
 type dbusClient struct {
 	conn *godbus.Conn
 	obj  godbus.BusObject
@@ -48,7 +91,7 @@ func (c *dbusClient) GetCurrentStats() (*currentStats, error) {
 		return nil, err
 	}
 	var stats currentStats
-	if err := json.Unmarshal([]byte(jsonStr), &stats); err != nil {
+	if err := decodeReply(jsonStr, &stats); err != nil {
 		return nil, err
 	}
 	return &stats, nil
@@ -61,12 +104,51 @@ func (c *dbusClient) GetHistory(from, to time.Time) (*historyData, error) {
 		return nil, err
 	}
 	var data historyData
-	if err := json.Unmarshal([]byte(jsonStr), &data); err != nil {
+	if err := decodeReply(jsonStr, &data); err != nil {
 		return nil, err
 	}
 	return &data, nil
 }
 
+func (c *dbusClient) GetHistoryBuckets(from, to time.Time, bucket time.Duration) ([]collector.BatteryBucket, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetHistoryBuckets", 0, from.Unix(), to.Unix(), int64(bucket.Seconds())).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var buckets []collector.BatteryBucket
+	if err := decodeReply(jsonStr, &buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+func (c *dbusClient) GetPowerHistogram(from, to time.Time, buckets int) (*powerHistogram, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetPowerHistogram", 0, from.Unix(), to.Unix(), int32(buckets)).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var hist powerHistogram
+	if err := decodeReply(jsonStr, &hist); err != nil {
+		return nil, err
+	}
+	return &hist, nil
+}
+
+func (c *dbusClient) GetPowerPercentiles(from, to time.Time) (*collector.PowerPercentiles, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetPowerPercentiles", 0, from.Unix(), to.Unix()).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var pp collector.PowerPercentiles
+	if err := decodeReply(jsonStr, &pp); err != nil {
+		return nil, err
+	}
+	return &pp, nil
+}
+
 func (c *dbusClient) GetBatteryHealth() (*collector.BatteryHealth, error) {
 	var jsonStr string
 	err := c.obj.Call(dbusIface+".GetBatteryHealth", 0).Store(&jsonStr)
@@ -74,12 +156,64 @@ func (c *dbusClient) GetBatteryHealth() (*collector.BatteryHealth, error) {
 		return nil, err
 	}
 	var health collector.BatteryHealth
-	if err := json.Unmarshal([]byte(jsonStr), &health); err != nil {
+	if err := decodeReply(jsonStr, &health); err != nil {
 		return nil, err
 	}
 	return &health, nil
 }
 
+func (c *dbusClient) GetChargeCycles(from, to time.Time) (*collector.ChargeCycles, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetChargeCycles", 0, from.Unix(), to.Unix()).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var cycles collector.ChargeCycles
+	if err := decodeReply(jsonStr, &cycles); err != nil {
+		return nil, err
+	}
+	return &cycles, nil
+}
+
+func (c *dbusClient) GetChargeThresholds() (map[string]collector.ChargeThreshold, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetChargeThresholds", 0).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var thresholds map[string]collector.ChargeThreshold
+	if err := decodeReply(jsonStr, &thresholds); err != nil {
+		return nil, err
+	}
+	return thresholds, nil
+}
+
+func (c *dbusClient) GetCapacityDrops() ([]collector.CapacityDrop, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetCapacityDrops", 0).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var drops []collector.CapacityDrop
+	if err := decodeReply(jsonStr, &drops); err != nil {
+		return nil, err
+	}
+	return drops, nil
+}
+
+func (c *dbusClient) GetDisplayPowerModel() (*calibration.DisplayPowerModel, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetDisplayPowerModel", 0).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var m calibration.DisplayPowerModel
+	if err := decodeReply(jsonStr, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
 func (c *dbusClient) GetPowerStateEvents(from, to time.Time) ([]collector.PowerStateEvent, error) {
 	var jsonStr string
 	err := c.obj.Call(dbusIface+".GetPowerStateEvents", 0, from.Unix(), to.Unix()).Store(&jsonStr)
@@ -87,12 +221,109 @@ func (c *dbusClient) GetPowerStateEvents(from, to time.Time) ([]collector.PowerS
 		return nil, err
 	}
 	var events []collector.PowerStateEvent
-	if err := json.Unmarshal([]byte(jsonStr), &events); err != nil {
+	if err := decodeReply(jsonStr, &events); err != nil {
 		return nil, err
 	}
 	return events, nil
 }
 
+func (c *dbusClient) GetSuspendDrainRates(from, to time.Time) ([]collector.SuspendDrainRate, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetSuspendDrainRates", 0, from.Unix(), to.Unix()).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var rates []collector.SuspendDrainRate
+	if err := decodeReply(jsonStr, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (c *dbusClient) GetThrottleEvents(from, to time.Time) ([]collector.ThrottleEvent, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetThrottleEvents", 0, from.Unix(), to.Unix()).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var events []collector.ThrottleEvent
+	if err := decodeReply(jsonStr, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (c *dbusClient) GetIdleIntervals(from, to time.Time) ([]collector.IdleInterval, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetIdleIntervals", 0, from.Unix(), to.Unix()).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var intervals []collector.IdleInterval
+	if err := decodeReply(jsonStr, &intervals); err != nil {
+		return nil, err
+	}
+	return intervals, nil
+}
+
+func (c *dbusClient) GetCoreClassEnergy(from, to time.Time, baselineUW int64) (*coreClassEnergy, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetCoreClassEnergy", 0, from.Unix(), to.Unix(), baselineUW).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var split coreClassEnergy
+	if err := decodeReply(jsonStr, &split); err != nil {
+		return nil, err
+	}
+	return &split, nil
+}
+
+// GetPowerRegression returns the daemon's latest idle power regression
+// report, or nil if it has raised none.
+func (c *dbusClient) GetPowerRegression() (*collector.PowerRegression, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetPowerRegression", 0).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var r *collector.PowerRegression
+	if err := decodeReply(jsonStr, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c *dbusClient) AddAnnotation(at time.Time, text string) (*collector.Annotation, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".AddAnnotation", 0, at.Unix(), text).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var a collector.Annotation
+	if err := decodeReply(jsonStr, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (c *dbusClient) GetAnnotations(from, to time.Time) ([]collector.Annotation, error) {
+	var jsonStr string
+	err := c.obj.Call(dbusIface+".GetAnnotations", 0, from.Unix(), to.Unix()).Store(&jsonStr)
+	if err != nil {
+		return nil, err
+	}
+	var annotations []collector.Annotation
+	if err := decodeReply(jsonStr, &annotations); err != nil {
+		return nil, err
+	}
+	return annotations, nil
+}
+
+func (c *dbusClient) DeleteAnnotation(id int64) error {
+	return c.obj.Call(dbusIface+".DeleteAnnotation", 0, id).Err
+}
+
 func (c *dbusClient) GetConfig() (*pmconfig.Config, error) {
 	var jsonStr string
 	err := c.obj.Call(dbusIface+".GetConfig", 0).Store(&jsonStr)
@@ -100,7 +331,7 @@ func (c *dbusClient) GetConfig() (*pmconfig.Config, error) {
 		return nil, err
 	}
 	var cfg pmconfig.Config
-	if err := json.Unmarshal([]byte(jsonStr), &cfg); err != nil {
+	if err := decodeReply(jsonStr, &cfg); err != nil {
 		return nil, err
 	}
 	return &cfg, nil
@@ -119,8 +350,50 @@ func (c *dbusClient) UpdateConfig(cfg *pmconfig.Config) (*pmconfig.Config, error
 	}
 
 	var updated pmconfig.Config
-	if err := json.Unmarshal([]byte(jsonStr), &updated); err != nil {
+	if err := decodeReply(jsonStr, &updated); err != nil {
 		return nil, err
 	}
 	return &updated, nil
 }
+
+func (c *dbusClient) RunCalibration() error {
+	return c.obj.Call(dbusIface+".RunCalibration", godbus.FlagAllowInteractiveAuthorization).Err
+}
+
+// WatchCalibration subscribes to the daemon's calibration signals. The
+// callbacks run on a background goroutine.
+func (c *dbusClient) WatchCalibration(onProgress func(calibration.Progress), onComplete func(calibrationComplete)) error {
+	if err := c.conn.AddMatchSignal(
+		godbus.WithMatchObjectPath(dbusPath),
+		godbus.WithMatchInterface(dbusIface),
+	); err != nil {
+		return fmt.Errorf("subscribe calibration signals: %w", err)
+	}
+
+	ch := make(chan *godbus.Signal, 16)
+	c.conn.Signal(ch)
+	go func() {
+		for sig := range ch {
+			if sig.Path != dbusPath || len(sig.Body) != 1 {
+				continue
+			}
+			payload, ok := sig.Body[0].(string)
+			if !ok {
+				continue
+			}
+			switch sig.Name {
+			case dbusIface + ".CalibrationProgress":
+				var p calibration.Progress
+				if decodeReply(payload, &p) == nil {
+					onProgress(p)
+				}
+			case dbusIface + ".CalibrationComplete":
+				var done calibrationComplete
+				if decodeReply(payload, &done) == nil {
+					onComplete(done)
+				}
+			}
+		}
+	}()
+	return nil
+}
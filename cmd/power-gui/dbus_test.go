@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    int
+		wantErr string
+	}{
+		{name: "envelope", payload: `{"v":1,"data":{"interval_seconds":5}}`, want: 5},
+		{name: "bare legacy object", payload: `{"interval_seconds":7}`, want: 7},
+		{name: "newer version", payload: `{"v":2,"data":{"interval_seconds":5}}`, wantErr: "version 2 is newer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stats currentStats
+			err := decodeReply(tt.payload, &stats)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeReply() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeReply() error = %v", err)
+			}
+			if stats.IntervalSeconds != tt.want {
+				t.Fatalf("IntervalSeconds = %d, want %d", stats.IntervalSeconds, tt.want)
+			}
+		})
+	}
+
+	var events []int
+	if err := decodeReply(`[1,2]`, &events); err != nil || len(events) != 2 {
+		t.Fatalf("decodeReply(bare array) = %v, %v; want [1 2]", events, err)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	pmconfig "github.com/cptspacemanspiff/gnome-power-display/internal/config"
+)
+
+// formatDerivedSeries writes derived series one per line as
+// "name = expression", the form the settings page edits them in.
+func formatDerivedSeries(series []pmconfig.DerivedSeriesConfig) string {
+	var b strings.Builder
+	for _, ds := range series {
+		b.WriteString(ds.String() + "\n")
+	}
+	return b.String()
+}
+
+// parseDerivedSeries reads the settings page's "name = expression" lines,
+// skipping blank ones. Names and expressions are checked when the config is
+// validated.
+func parseDerivedSeries(text string) ([]pmconfig.DerivedSeriesConfig, error) {
+	var series []pmconfig.DerivedSeriesConfig
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		name, expr, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("derived series line %d: want name = expression", i+1)
+		}
+		series = append(series, pmconfig.DerivedSeriesConfig{Name: strings.TrimSpace(name), Expression: strings.TrimSpace(expr)})
+	}
+	return series, nil
+}
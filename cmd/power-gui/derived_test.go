@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	pmconfig "github.com/cptspacemanspiff/gnome-power-display/internal/config"
+)
+
+func TestParseDerivedSeries_RoundTrip(t *testing.T) {
+	series := []pmconfig.DerivedSeriesConfig{
+		{Name: "residual", Expression: "power - display_est - cpu_est"},
+		{Name: "display_share", Expression: "display_est / power * 100"},
+	}
+	text := formatDerivedSeries(series)
+	got, err := parseDerivedSeries("\n" + text + "  \n")
+	if err != nil {
+		t.Fatalf("parseDerivedSeries() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, series) {
+		t.Fatalf("parseDerivedSeries(%q) = %+v, want %+v", text, got, series)
+	}
+	if got, err := parseDerivedSeries(""); err != nil || got != nil {
+		t.Fatalf("parseDerivedSeries(\"\") = %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestParseDerivedSeries_MissingEquals(t *testing.T) {
+	if _, err := parseDerivedSeries("residual = power\nbroken\n"); err == nil || err.Error() != "derived series line 2: want name = expression" {
+		t.Fatalf("parseDerivedSeries() error = %v, want line 2 error", err)
+	}
+}
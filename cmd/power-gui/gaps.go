@@ -0,0 +1,47 @@
+package main
+
+import "github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+
+const (
+	// defaultGapThreshold is used until the daemon's collection interval is
+	// known. It matches gapIntervalMultiple times the default 5s interval.
+	defaultGapThreshold = 30 // seconds
+	// gapIntervalMultiple is how many collection intervals may pass between
+	// samples before the span is treated as missing data. The slack absorbs
+	// scheduling jitter and slow collection cycles.
+	gapIntervalMultiple = 6
+)
+
+// gap is a span with no samples, bounded by the timestamps of the samples on
+// either side.
+type gap struct {
+	start int64
+	end   int64
+}
+
+// gapThresholdFor returns the gap threshold in seconds for a daemon
+// collection interval, falling back to defaultGapThreshold when unknown.
+func gapThresholdFor(intervalSecs int) int64 {
+	if intervalSecs <= 0 {
+		return defaultGapThreshold
+	}
+	return int64(intervalSecs) * gapIntervalMultiple
+}
+
+// isGap reports whether the spacing between two consecutive samples exceeds
+// thresholdSecs.
+func isGap(prev, next collector.BatterySample, thresholdSecs int64) bool {
+	return next.Timestamp-prev.Timestamp > thresholdSecs
+}
+
+// detectGaps returns every span between consecutive samples longer than
+// thresholdSecs. Samples must be in ascending timestamp order.
+func detectGaps(samples []collector.BatterySample, thresholdSecs int64) []gap {
+	var gaps []gap
+	for i := 1; i < len(samples); i++ {
+		if isGap(samples[i-1], samples[i], thresholdSecs) {
+			gaps = append(gaps, gap{start: samples[i-1].Timestamp, end: samples[i].Timestamp})
+		}
+	}
+	return gaps
+}
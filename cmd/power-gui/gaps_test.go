@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func samplesAt(timestamps ...int64) []collector.BatterySample {
+	samples := make([]collector.BatterySample, len(timestamps))
+	for i, ts := range timestamps {
+		samples[i].Timestamp = ts
+	}
+	return samples
+}
+
+func TestDetectGaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		samples   []collector.BatterySample
+		threshold int64
+		want      []gap
+	}{
+		{"empty", nil, 30, nil},
+		{"single sample", samplesAt(100), 30, nil},
+		{"regular cadence", samplesAt(0, 5, 10, 15), 30, nil},
+		{"spacing equal to threshold", samplesAt(0, 30), 30, nil},
+		{"one gap", samplesAt(0, 5, 100, 105), 30, []gap{{5, 100}}},
+		{"two gaps", samplesAt(0, 40, 45, 200), 30, []gap{{0, 40}, {45, 200}}},
+		{"short interval exposes small gap", samplesAt(0, 1, 2, 10, 11), 6, []gap{{2, 10}}},
+		{"long interval hides normal spacing", samplesAt(0, 60, 120), gapThresholdFor(60), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectGaps(tt.samples, tt.threshold); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("detectGaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGapThresholdFor(t *testing.T) {
+	tests := []struct {
+		interval int
+		want     int64
+	}{
+		{0, defaultGapThreshold},
+		{-1, defaultGapThreshold},
+		{1, 6},
+		{5, 30},
+		{60, 360},
+	}
+	for _, tt := range tests {
+		if got := gapThresholdFor(tt.interval); got != tt.want {
+			t.Errorf("gapThresholdFor(%d) = %d, want %d", tt.interval, got, tt.want)
+		}
+	}
+}
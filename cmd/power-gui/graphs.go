@@ -23,12 +23,20 @@ var (
 	colLabel       = rgba{1, 1, 1, 0.50}
 	colTitle       = rgba{1, 1, 1, 0.70}
 	colGreenLine   = rgba{0.30, 0.75, 0.40, 1.0}
-	colGreenFill   = rgba{0.30, 0.75, 0.40, 0.25}
+	colGreenBand   = rgba{0.30, 0.75, 0.40, 0.30}
 	colBlueLine    = rgba{0.35, 0.55, 0.90, 1.0}
 	colSleepBg     = rgba{0.30, 0.35, 0.55, 0.35}
+	colHibernateBg = rgba{0.45, 0.30, 0.55, 0.35}
 	colSleepLabel  = rgba{0.65, 0.70, 0.90, 0.60}
 	colNoDataBg    = rgba{0.31, 0.31, 0.31, 0.24}
 	colChargingBar = rgba{0.30, 0.75, 0.40, 0.71}
+	colChargingBg  = rgba{0.30, 0.75, 0.40, 0.12}
+	colChargeLine  = rgba{0.30, 0.75, 0.85, 1.0}
+	colAnnotation  = rgba{0.95, 0.75, 0.30, 0.85}
+	colAutoNote    = rgba{0.65, 0.70, 0.80, 0.60}
+	colThrottleBg  = rgba{0.90, 0.35, 0.25, 0.12}
+	colThrottleBar = rgba{0.90, 0.35, 0.25, 0.80}
+	colIdleBar     = rgba{0.75, 0.75, 0.75, 0.55}
 )
 
 const (
@@ -36,7 +44,6 @@ const (
 	padRight  = 15
 	padTop    = 30
 	padBottom = 30
-	gapThresh = 30 // seconds
 )
 
 func (c rgba) set(cr *cairo.Context) {
@@ -45,22 +52,47 @@ func (c rgba) set(cr *cairo.Context) {
 
 // batteryGraph renders a battery level line chart using Cairo
 type batteryGraph struct {
-	area    *gtk.DrawingArea
-	battery []collector.BatterySample
-	sleep   []collector.PowerStateEvent
-	from    time.Time
-	to      time.Time
+	area          *gtk.DrawingArea
+	battery       []collector.BatterySample
+	sleep         []collector.PowerStateEvent
+	from          time.Time
+	to            time.Time
+	gapThreshold  int64 // seconds between samples before a span is hatched as no-data
+	daemonStarted int64 // daemon start epoch for the no-data message; 0 if unknown
+
+	// Optional min/max capacity band, drawn behind the line for long ranges
+	// where averaging would hide charge cycles.
+	band       []collector.BatteryBucket
+	bandBucket int64 // bucket width in seconds
+
+	annotations []collector.Annotation
+	throttle    []collector.ThrottleEvent
 }
 
 func newBatteryGraph() *batteryGraph {
-	g := &batteryGraph{}
+	g := &batteryGraph{gapThreshold: defaultGapThreshold}
 	g.area = gtk.NewDrawingArea()
 	g.area.SetVExpand(true)
 	g.area.SetHExpand(true)
 	g.area.SetDrawFunc(g.draw)
+	connectAnnotationTooltip(g.area, func() ([]collector.Annotation, time.Time, time.Time) {
+		return g.annotations, g.from, g.to
+	})
 	return g
 }
 
+// SetAnnotations sets the annotations drawn as markers over the graph.
+func (g *batteryGraph) SetAnnotations(annotations []collector.Annotation) {
+	g.annotations = annotations
+	g.area.QueueDraw()
+}
+
+// SetThrottleEvents sets the CPU throttling intervals shaded on the graph.
+func (g *batteryGraph) SetThrottleEvents(events []collector.ThrottleEvent) {
+	g.throttle = events
+	g.area.QueueDraw()
+}
+
 func (g *batteryGraph) SetData(battery []collector.BatterySample, sleep []collector.PowerStateEvent, from, to time.Time) {
 	g.battery = battery
 	g.sleep = sleep
@@ -69,6 +101,33 @@ func (g *batteryGraph) SetData(battery []collector.BatterySample, sleep []collec
 	g.area.QueueDraw()
 }
 
+// SetCapacityBand sets the per-bucket min/max capacity band; nil disables it.
+func (g *batteryGraph) SetCapacityBand(buckets []collector.BatteryBucket, bucket time.Duration) {
+	g.band = buckets
+	g.bandBucket = int64(bucket.Seconds())
+	g.area.QueueDraw()
+}
+
+// SetGapThreshold sets the sample spacing, in seconds, above which the graph
+// shows a no-data gap instead of connecting the samples.
+func (g *batteryGraph) SetGapThreshold(secs int64) {
+	if secs == g.gapThreshold {
+		return
+	}
+	g.gapThreshold = secs
+	g.area.QueueDraw()
+}
+
+// SetDaemonStarted sets the daemon's start epoch, shown in the message drawn
+// while there are no samples; 0 hides the message.
+func (g *batteryGraph) SetDaemonStarted(epoch int64) {
+	if epoch == g.daemonStarted {
+		return
+	}
+	g.daemonStarted = epoch
+	g.area.QueueDraw()
+}
+
 func (g *batteryGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
 	// Background
 	colGraphBg.set(cr)
@@ -106,107 +165,162 @@ func (g *batteryGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
 		return
 	}
 
-	// Sleep regions
-	for _, ev := range g.sleep {
-		x1 := float64(padLeft) + float64(ev.StartTime-fromUnix)/timeSpan*float64(plotW)
-		x2 := float64(padLeft) + float64(ev.EndTime-fromUnix)/timeSpan*float64(plotW)
-		x1 = math.Max(x1, float64(padLeft))
-		x2 = math.Min(x2, float64(padLeft+plotW))
-		colSleepBg.set(cr)
-		cr.Rectangle(x1, float64(padTop), x2-x1, float64(plotH))
-		cr.Fill()
-		label := "Sleep"
-		if ev.Type == "hibernate" {
-			label = "Hibernate"
-		}
-		mid := (x1 + x2) / 2
-		drawLabel(cr, label, int(mid)-15, padTop+plotH/2, colSleepLabel, 9)
-	}
+	drawSleepRegions(cr, g.sleep, fromUnix, timeSpan, plotW, plotH)
+	drawThrottleRegions(cr, g.throttle, fromUnix, timeSpan, plotW, plotH)
+	// Annotation markers go on top, even when there are no samples.
+	defer drawAnnotationMarkers(cr, g.annotations, fromUnix, timeSpan, plotW, plotH)
 
 	samples := g.battery
 	if len(samples) == 0 {
+		drawNoData(cr, g.daemonStarted, plotW, plotH)
 		return
 	}
 
 	// No-data gap hatching
-	for i := 1; i < len(samples); i++ {
-		dt := samples[i].Timestamp - samples[i-1].Timestamp
-		if dt > gapThresh {
-			x1 := float64(padLeft) + float64(samples[i-1].Timestamp-fromUnix)/timeSpan*float64(plotW)
-			x2 := float64(padLeft) + float64(samples[i].Timestamp-fromUnix)/timeSpan*float64(plotW)
-			x1 = math.Max(x1, float64(padLeft))
-			x2 = math.Min(x2, float64(padLeft+plotW))
-			drawHatched(cr, x1, float64(padTop), x2-x1, float64(plotH))
-		}
+	for _, gp := range detectGaps(samples, g.gapThreshold) {
+		x1 := float64(padLeft) + float64(gp.start-fromUnix)/timeSpan*float64(plotW)
+		x2 := float64(padLeft) + float64(gp.end-fromUnix)/timeSpan*float64(plotW)
+		x1 = math.Max(x1, float64(padLeft))
+		x2 = math.Min(x2, float64(padLeft+plotW))
+		drawHatched(cr, x1, float64(padTop), x2-x1, float64(plotH))
 	}
 
 	// Charging indicator bar below x-axis
-	for i := 0; i < len(samples); i++ {
-		if samples[i].Status == "Charging" {
-			x := float64(padLeft) + float64(samples[i].Timestamp-fromUnix)/timeSpan*float64(plotW)
-			barW := 2.0
-			if i+1 < len(samples) {
-				x2 := float64(padLeft) + float64(samples[i+1].Timestamp-fromUnix)/timeSpan*float64(plotW)
-				barW = x2 - x
-				if barW < 1 {
-					barW = 1
-				}
-			}
-			colChargingBar.set(cr)
-			cr.Rectangle(x, float64(padTop+plotH+2), barW, 4)
-			cr.Fill()
+	colChargingBar.set(cr)
+	for _, sp := range chargingSpans(samples) {
+		x1 := float64(padLeft) + float64(sp.start-fromUnix)/timeSpan*float64(plotW)
+		x2 := float64(padLeft) + float64(sp.end-fromUnix)/timeSpan*float64(plotW)
+		barW := math.Max(x2-x1, 1)
+		if sp.end == sp.start {
+			barW = 2
 		}
+		cr.Rectangle(x1, float64(padTop+plotH+2), barW, 4)
+		cr.Fill()
+	}
+
+	// Min/max capacity band
+	colGreenBand.set(cr)
+	for _, b := range g.band {
+		x1 := float64(padLeft) + float64(b.Timestamp-fromUnix)/timeSpan*float64(plotW)
+		x2 := float64(padLeft) + float64(b.Timestamp+g.bandBucket-fromUnix)/timeSpan*float64(plotW)
+		x1 = math.Max(x1, float64(padLeft))
+		x2 = math.Min(x2, float64(padLeft+plotW))
+		yMax := float64(padTop+plotH) - float64(plotH)*float64(b.MaxCapacityPct)/100.0
+		yMin := float64(padTop+plotH) - float64(plotH)*float64(b.MinCapacityPct)/100.0
+		cr.Rectangle(x1, yMax, x2-x1, math.Max(yMin-yMax, 1))
+		cr.Fill()
 	}
 
-	// Battery line with fill
-	for i := 1; i < len(samples); i++ {
-		dt := samples[i].Timestamp - samples[i-1].Timestamp
-		if dt > gapThresh {
+	// Battery line with fill. Each unbroken run is filled as one path so the
+	// translucent fill composites once over the sleep and throttle shading
+	// instead of doubling up where per-segment shapes would meet. The line
+	// is stroked in stretches of the same charging state, each segment
+	// colored by the status of the sample that ends it.
+	fill := colGreenLine
+	fill.a = float64(fillOpacityPct) / 100
+	bottom := float64(padTop + plotH)
+	xOf := func(s collector.BatterySample) float64 {
+		return float64(padLeft) + float64(s.Timestamp-fromUnix)/timeSpan*float64(plotW)
+	}
+	yOf := func(s collector.BatterySample) float64 {
+		return float64(padTop+plotH) - float64(plotH)*float64(s.CapacityPct)/100.0
+	}
+	start := 0
+	for i := 1; i <= len(samples); i++ {
+		if i < len(samples) && !isGap(samples[i-1], samples[i], g.gapThreshold) {
+			continue
+		}
+		run := samples[start:i]
+		start = i
+		if len(run) < 2 {
 			continue
 		}
 
-		x1 := float64(padLeft) + float64(samples[i-1].Timestamp-fromUnix)/timeSpan*float64(plotW)
-		y1 := float64(padTop+plotH) - float64(plotH)*float64(samples[i-1].CapacityPct)/100.0
-		x2 := float64(padLeft) + float64(samples[i].Timestamp-fromUnix)/timeSpan*float64(plotW)
-		y2 := float64(padTop+plotH) - float64(plotH)*float64(samples[i].CapacityPct)/100.0
-		bottom := float64(padTop + plotH)
-
-		// Fill area under line segment
-		colGreenFill.set(cr)
-		cr.MoveTo(x1, y1)
-		cr.LineTo(x2, y2)
-		cr.LineTo(x2, bottom)
-		cr.LineTo(x1, bottom)
+		cr.MoveTo(xOf(run[0]), yOf(run[0]))
+		for _, s := range run[1:] {
+			cr.LineTo(xOf(s), yOf(s))
+		}
+		cr.LineTo(xOf(run[len(run)-1]), bottom)
+		cr.LineTo(xOf(run[0]), bottom)
 		cr.ClosePath()
+		fill.set(cr)
 		cr.Fill()
 
-		// Line
-		colGreenLine.set(cr)
 		cr.SetLineWidth(2)
-		cr.MoveTo(x1, y1)
-		cr.LineTo(x2, y2)
-		cr.Stroke()
+		for j := 1; j < len(run); {
+			charging := run[j].Status == "Charging"
+			cr.MoveTo(xOf(run[j-1]), yOf(run[j-1]))
+			for ; j < len(run) && (run[j].Status == "Charging") == charging; j++ {
+				cr.LineTo(xOf(run[j]), yOf(run[j]))
+			}
+			if charging {
+				colChargeLine.set(cr)
+			} else {
+				colGreenLine.set(cr)
+			}
+			cr.Stroke()
+		}
 	}
 }
 
 // energyGraph renders a power usage bar chart using Cairo
 type energyGraph struct {
-	area    *gtk.DrawingArea
-	battery []collector.BatterySample
-	sleep   []collector.PowerStateEvent
-	from    time.Time
-	to      time.Time
+	area          *gtk.DrawingArea
+	battery       []collector.BatterySample
+	sleep         []collector.PowerStateEvent
+	from          time.Time
+	to            time.Time
+	gapThreshold  int64   // seconds between samples before a span is hatched as no-data
+	daemonStarted int64   // daemon start epoch for the no-data message; 0 if unknown
+	baselineW     float64 // idle power subtracted from every bar; 0 shows absolute power
+	dischargeOnly bool    // plot only on-battery power and blank charging buckets
+	annotations   []collector.Annotation
+	throttle      []collector.ThrottleEvent
+	idle          []collector.IdleInterval
+	hidden        map[string]bool // overlays toggled off, by energyOverlays id
 }
 
 func newEnergyGraph() *energyGraph {
-	g := &energyGraph{}
+	g := &energyGraph{gapThreshold: defaultGapThreshold, hidden: make(map[string]bool)}
 	g.area = gtk.NewDrawingArea()
 	g.area.SetVExpand(true)
 	g.area.SetHExpand(true)
 	g.area.SetDrawFunc(g.draw)
+	connectAnnotationTooltip(g.area, func() ([]collector.Annotation, time.Time, time.Time) {
+		return g.annotations, g.from, g.to
+	})
 	return g
 }
 
+// SetAnnotations sets the annotations drawn as markers over the graph.
+func (g *energyGraph) SetAnnotations(annotations []collector.Annotation) {
+	g.annotations = annotations
+	g.area.QueueDraw()
+}
+
+// SetThrottleEvents sets the CPU throttling intervals shaded on the graph.
+func (g *energyGraph) SetThrottleEvents(events []collector.ThrottleEvent) {
+	g.throttle = events
+	g.area.QueueDraw()
+}
+
+// SetIdleIntervals sets the user-idle intervals marked along the bottom of
+// the graph.
+func (g *energyGraph) SetIdleIntervals(intervals []collector.IdleInterval) {
+	g.idle = intervals
+	g.area.QueueDraw()
+}
+
+// SetOverlayVisible shows or hides the overlay with the given energyOverlays
+// id.
+func (g *energyGraph) SetOverlayVisible(id string, visible bool) {
+	if g.hidden[id] == !visible {
+		return
+	}
+	g.hidden[id] = !visible
+	g.area.QueueDraw()
+}
+
 func (g *energyGraph) SetData(battery []collector.BatterySample, sleep []collector.PowerStateEvent, from, to time.Time) {
 	g.battery = battery
 	g.sleep = sleep
@@ -215,28 +329,57 @@ func (g *energyGraph) SetData(battery []collector.BatterySample, sleep []collect
 	g.area.QueueDraw()
 }
 
-func bucketDuration(d time.Duration) time.Duration {
-	switch {
-	case d <= 15*time.Minute:
-		return 15 * time.Second
-	case d <= time.Hour:
-		return time.Minute
-	case d <= 3*time.Hour:
-		return 5 * time.Minute
-	case d <= 6*time.Hour:
-		return 10 * time.Minute
-	case d <= 24*time.Hour:
-		return 30 * time.Minute
-	default:
-		return time.Hour
+// SetGapThreshold sets the sample spacing, in seconds, above which the graph
+// hatches the span as missing data.
+func (g *energyGraph) SetGapThreshold(secs int64) {
+	if secs == g.gapThreshold {
+		return
 	}
+	g.gapThreshold = secs
+	g.area.QueueDraw()
 }
 
-type powerBucket struct {
-	sumPowerUW int64
-	count      int
-	charging   bool
-	chgCount   int
+// SetDaemonStarted sets the daemon's start epoch, shown in the message drawn
+// while there are no samples; 0 hides the message.
+func (g *energyGraph) SetDaemonStarted(epoch int64) {
+	if epoch == g.daemonStarted {
+		return
+	}
+	g.daemonStarted = epoch
+	g.area.QueueDraw()
+}
+
+// SetBaseline sets the idle power, in watts, subtracted from each bar so the
+// chart shows only consumption above it. 0 shows absolute power.
+func (g *energyGraph) SetBaseline(w float64) {
+	if w == g.baselineW {
+		return
+	}
+	g.baselineW = w
+	g.area.QueueDraw()
+}
+
+// SetDischargeOnly switches between plotting all power and plotting only
+// power drawn while not charging, with charging periods blanked.
+func (g *energyGraph) SetDischargeOnly(on bool) {
+	if on == g.dischargeOnly {
+		return
+	}
+	g.dischargeOnly = on
+	g.area.QueueDraw()
+}
+
+// barPowerW returns the power a bucket's bar represents before baseline
+// subtraction: the discharge-only mean in discharge-only mode, where
+// charging buckets are not plotted at all.
+func (g *energyGraph) barPowerW(b powerBucket) float64 {
+	if !g.dischargeOnly {
+		return b.avgPowerW()
+	}
+	if b.charging {
+		return 0
+	}
+	return b.dischargePowerW()
 }
 
 func (g *energyGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
@@ -251,7 +394,14 @@ func (g *energyGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
 	plotW := w - padLeft - padRight
 	plotH := h - padTop - padBottom
 
-	drawLabel(cr, "Energy Usage", padLeft, 8, colTitle, 11)
+	title := "Energy Usage"
+	if g.dischargeOnly {
+		title = "Energy Usage on Battery"
+	}
+	if g.baselineW > 0 {
+		title = fmt.Sprintf("%s above %.1f W idle baseline", title, g.baselineW)
+	}
+	drawLabel(cr, title, padLeft, 8, colTitle, 11)
 
 	fromUnix := g.from.Unix()
 	toUnix := g.to.Unix()
@@ -262,57 +412,41 @@ func (g *energyGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
 
 	drawTimeAxis(cr, g.from, g.to, padLeft, padTop+plotH, plotW, padTop, plotH)
 
-	// Sleep regions
-	for _, ev := range g.sleep {
-		x1 := float64(padLeft) + float64(ev.StartTime-fromUnix)/timeSpan*float64(plotW)
-		x2 := float64(padLeft) + float64(ev.EndTime-fromUnix)/timeSpan*float64(plotW)
-		x1 = math.Max(x1, float64(padLeft))
-		x2 = math.Min(x2, float64(padLeft+plotW))
-		colSleepBg.set(cr)
-		cr.Rectangle(x1, float64(padTop), x2-x1, float64(plotH))
-		cr.Fill()
-		label := "Sleep"
-		if ev.Type == "hibernate" {
-			label = "Hibernate"
-		}
-		mid := (x1 + x2) / 2
-		drawLabel(cr, label, int(mid)-15, padTop+plotH/2, colSleepLabel, 9)
+	if !g.hidden[overlaySleep] {
+		drawSleepRegions(cr, g.sleep, fromUnix, timeSpan, plotW, plotH)
+	}
+	if !g.hidden[overlayThrottle] {
+		drawThrottleRegions(cr, g.throttle, fromUnix, timeSpan, plotW, plotH)
+	}
+	// Annotation markers go on top, even when there are no samples.
+	defer drawAnnotationMarkers(cr, g.annotations, fromUnix, timeSpan, plotW, plotH)
+	// Idle strips run along the bottom edge, over the bars.
+	if !g.hidden[overlayIdle] {
+		defer drawIdleRegions(cr, g.idle, fromUnix, timeSpan, plotW, plotH)
 	}
 
 	samples := g.battery
 	if len(samples) == 0 {
+		drawNoData(cr, g.daemonStarted, plotW, plotH)
 		return
 	}
 
-	// Bucket samples
-	bucketDur := bucketDuration(g.to.Sub(g.from))
-	bucketSecs := int64(bucketDur.Seconds())
-	numBuckets := int((toUnix - fromUnix) / bucketSecs)
-	if numBuckets < 1 {
-		numBuckets = 1
+	// No-data gap hatching
+	for _, gp := range detectGaps(samples, g.gapThreshold) {
+		x1 := float64(padLeft) + float64(gp.start-fromUnix)/timeSpan*float64(plotW)
+		x2 := float64(padLeft) + float64(gp.end-fromUnix)/timeSpan*float64(plotW)
+		x1 = math.Max(x1, float64(padLeft))
+		x2 = math.Min(x2, float64(padLeft+plotW))
+		drawHatched(cr, x1, float64(padTop), x2-x1, float64(plotH))
 	}
 
-	buckets := make([]powerBucket, numBuckets)
-	for _, s := range samples {
-		idx := int((s.Timestamp - fromUnix) / bucketSecs)
-		if idx < 0 || idx >= numBuckets {
-			continue
-		}
-		buckets[idx].sumPowerUW += s.PowerUW
-		buckets[idx].count++
-		if s.Status == "Charging" {
-			buckets[idx].chgCount++
-		}
-	}
+	buckets := bucketPower(samples, g.from, g.to)
+	numBuckets := len(buckets)
 
 	var maxPowerW float64
-	for i := range buckets {
-		if buckets[i].count > 0 {
-			buckets[i].charging = buckets[i].chgCount > buckets[i].count/2
-			avg := float64(buckets[i].sumPowerUW) / float64(buckets[i].count) / 1e6
-			if avg > maxPowerW {
-				maxPowerW = avg
-			}
+	for _, b := range buckets {
+		if avg := aboveBaselineW(g.barPowerW(b), g.baselineW); avg > maxPowerW {
+			maxPowerW = avg
 		}
 	}
 	if maxPowerW <= 0 {
@@ -342,11 +476,25 @@ func (g *energyGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
 		gap = 0
 	}
 
+	if g.dischargeOnly {
+		// Blank charging periods the way sleep is shaded, instead of bars.
+		for _, run := range chargingRuns(buckets) {
+			x1 := float64(padLeft) + float64(run[0])*barW
+			x2 := float64(padLeft) + float64(run[1])*barW
+			colChargingBg.set(cr)
+			cr.Rectangle(x1, float64(padTop), x2-x1, float64(plotH))
+			cr.Fill()
+			if x2-x1 >= 50 {
+				drawLabel(cr, "Charging", int((x1+x2)/2)-20, padTop+plotH/2, colSleepLabel, 9)
+			}
+		}
+	}
+
 	for i, b := range buckets {
-		if b.count == 0 {
+		if b.count == 0 || (g.dischargeOnly && b.charging) {
 			continue
 		}
-		avgW := float64(b.sumPowerUW) / float64(b.count) / 1e6
+		avgW := aboveBaselineW(g.barPowerW(b), g.baselineW)
 		barH := float64(plotH) * avgW / maxPowerW
 		x := float64(padLeft) + float64(i)*float64(plotW)/float64(numBuckets) + gap
 		y := float64(padTop+plotH) - barH
@@ -361,40 +509,326 @@ func (g *energyGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
 	}
 }
 
+// histogramGraph renders the distribution of power readings over the
+// selected range as a bar chart, with the 90th percentile marked.
+type histogramGraph struct {
+	area    *gtk.DrawingArea
+	buckets []collector.PowerHistogramBucket
+	total   int
+}
+
+func newHistogramGraph() *histogramGraph {
+	g := &histogramGraph{}
+	g.area = gtk.NewDrawingArea()
+	g.area.SetVExpand(true)
+	g.area.SetHExpand(true)
+	g.area.SetDrawFunc(g.draw)
+	return g
+}
+
+func (g *histogramGraph) SetData(hist *powerHistogram) {
+	if hist == nil {
+		g.buckets, g.total = nil, 0
+	} else {
+		g.buckets, g.total = hist.Buckets, hist.Total
+	}
+	g.area.QueueDraw()
+}
+
+func (g *histogramGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
+	colGraphBg.set(cr)
+	cr.Rectangle(0, 0, float64(w), float64(h))
+	cr.Fill()
+
+	if w < padLeft+padRight+10 || h < padTop+padBottom+10 {
+		return
+	}
+
+	plotW := w - padLeft - padRight
+	plotH := h - padTop - padBottom
+
+	drawLabel(cr, "Power Distribution", padLeft, 8, colTitle, 11)
+
+	if g.total == 0 || len(g.buckets) == 0 {
+		return
+	}
+
+	p90W := float64(histogramPercentile(g.buckets, 0.9)) / 1e6
+	drawLabel(cr, fmt.Sprintf("90%% of the time under %.1f W", p90W), padLeft+140, 10, colLabel, 9)
+
+	maxCount := 0
+	for _, b := range g.buckets {
+		if b.Count > maxCount {
+			maxCount = b.Count
+		}
+	}
+	minW := float64(g.buckets[0].MinUW) / 1e6
+	maxW := float64(g.buckets[len(g.buckets)-1].MaxUW) / 1e6
+	spanW := maxW - minW
+	if spanW <= 0 {
+		return
+	}
+
+	// Y-axis grid, as a share of all samples
+	maxPct := float64(maxCount) / float64(g.total) * 100
+	numYLines := 4
+	for i := 0; i <= numYLines; i++ {
+		val := maxPct * float64(i) / float64(numYLines)
+		y := float64(padTop+plotH) - float64(plotH)*float64(i)/float64(numYLines)
+		colGrid.set(cr)
+		cr.MoveTo(float64(padLeft), y)
+		cr.LineTo(float64(padLeft+plotW), y)
+		cr.Stroke()
+		drawLabel(cr, fmt.Sprintf("%.0f%%", val), 5, int(y)-5, colLabel, 9)
+	}
+
+	// X-axis labels in watts
+	numXLabels := 5
+	for i := 0; i <= numXLabels; i++ {
+		val := minW + spanW*float64(i)/float64(numXLabels)
+		x := float64(padLeft) + float64(plotW)*float64(i)/float64(numXLabels)
+		drawLabel(cr, fmt.Sprintf("%.1fW", val), int(x)-12, padTop+plotH+5, colLabel, 8)
+	}
+
+	// Draw bars
+	barW := float64(plotW) / float64(len(g.buckets))
+	gap := 1.0
+	if barW <= 2 {
+		gap = 0
+	}
+	colBlueLine.set(cr)
+	for i, b := range g.buckets {
+		if b.Count == 0 {
+			continue
+		}
+		barH := float64(plotH) * float64(b.Count) / float64(maxCount)
+		x := float64(padLeft) + float64(i)*barW + gap
+		y := float64(padTop+plotH) - barH
+		cr.Rectangle(x, y, barW-gap*2, barH)
+		cr.Fill()
+	}
+
+	// 90th percentile marker
+	px := float64(padLeft) + (p90W-minW)/spanW*float64(plotW)
+	colGreenLine.set(cr)
+	cr.SetLineWidth(1.5)
+	cr.MoveTo(px, float64(padTop))
+	cr.LineTo(px, float64(padTop+plotH))
+	cr.Stroke()
+}
+
+// calibrationGraph plots calibrated display power (above the display-off
+// baseline) against brightness, with each level's error bar.
+type calibrationGraph struct {
+	area   *gtk.DrawingArea
+	points []calibrationPoint
+}
+
+func newCalibrationGraph() *calibrationGraph {
+	g := &calibrationGraph{}
+	g.area = gtk.NewDrawingArea()
+	g.area.SetHExpand(true)
+	g.area.SetSizeRequest(400, 220)
+	g.area.SetDrawFunc(g.draw)
+	return g
+}
+
+func (g *calibrationGraph) SetData(points []calibrationPoint) {
+	g.points = points
+	g.area.QueueDraw()
+}
+
+func (g *calibrationGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
+	colGraphBg.set(cr)
+	cr.Rectangle(0, 0, float64(w), float64(h))
+	cr.Fill()
+
+	if w < padLeft+padRight+10 || h < padTop+padBottom+10 {
+		return
+	}
+
+	plotW := w - padLeft - padRight
+	plotH := h - padTop - padBottom
+
+	drawLabel(cr, "Display Power vs Brightness", padLeft, 8, colTitle, 11)
+
+	if len(g.points) == 0 {
+		return
+	}
+
+	// Y range covers every error bar, and always includes 0 W.
+	minW, maxW := 0.0, 0.0
+	for _, p := range g.points {
+		minW = min(minW, p.DisplayW-p.ErrorW)
+		maxW = max(maxW, p.DisplayW+p.ErrorW)
+	}
+	maxW = max(maxW*1.1, 0.5)
+	spanW := maxW - minW
+
+	toX := func(pct int) float64 {
+		return float64(padLeft) + float64(plotW)*float64(pct)/100
+	}
+	toY := func(watts float64) float64 {
+		return float64(padTop+plotH) - float64(plotH)*(watts-minW)/spanW
+	}
+
+	// Y-axis grid in watts
+	numYLines := 4
+	for i := 0; i <= numYLines; i++ {
+		val := minW + spanW*float64(i)/float64(numYLines)
+		y := toY(val)
+		colGrid.set(cr)
+		cr.MoveTo(float64(padLeft), y)
+		cr.LineTo(float64(padLeft+plotW), y)
+		cr.Stroke()
+		drawLabel(cr, fmt.Sprintf("%.1fW", val), 5, int(y)-5, colLabel, 9)
+	}
+
+	// X-axis labels in brightness percent
+	for pct := 0; pct <= 100; pct += 25 {
+		drawLabel(cr, fmt.Sprintf("%d%%", pct), int(toX(pct))-10, padTop+plotH+5, colLabel, 8)
+	}
+
+	// Zero line, when the low levels measured below the baseline
+	if minW < 0 {
+		colAxis.set(cr)
+		cr.MoveTo(float64(padLeft), toY(0))
+		cr.LineTo(float64(padLeft+plotW), toY(0))
+		cr.Stroke()
+	}
+
+	// Connecting line
+	colBlueLine.set(cr)
+	cr.SetLineWidth(1.5)
+	for i, p := range g.points {
+		if i == 0 {
+			cr.MoveTo(toX(p.BrightnessPct), toY(p.DisplayW))
+		} else {
+			cr.LineTo(toX(p.BrightnessPct), toY(p.DisplayW))
+		}
+	}
+	cr.Stroke()
+
+	// Error bars and points
+	colGreenLine.set(cr)
+	cr.SetLineWidth(1)
+	const capW = 4.0
+	for _, p := range g.points {
+		x := toX(p.BrightnessPct)
+		lo, hi := toY(p.DisplayW-p.ErrorW), toY(p.DisplayW+p.ErrorW)
+		cr.MoveTo(x, lo)
+		cr.LineTo(x, hi)
+		cr.MoveTo(x-capW, lo)
+		cr.LineTo(x+capW, lo)
+		cr.MoveTo(x-capW, hi)
+		cr.LineTo(x+capW, hi)
+		cr.Stroke()
+		cr.Arc(x, toY(p.DisplayW), 3, 0, 2*math.Pi)
+		cr.Fill()
+	}
+}
+
+// sparklineGraph is a tiny battery level line for the sidebar, without axes
+// or labels.
+type sparklineGraph struct {
+	area     *gtk.DrawingArea
+	segments [][]sparkPoint
+}
+
+func newSparklineGraph() *sparklineGraph {
+	g := &sparklineGraph{}
+	g.area = gtk.NewDrawingArea()
+	g.area.SetSizeRequest(64, 18)
+	g.area.SetVAlign(gtk.AlignCenter)
+	g.area.SetTooltipText("Battery level, last 24 hours")
+	g.area.SetDrawFunc(g.draw)
+	return g
+}
+
+func (g *sparklineGraph) SetData(segments [][]sparkPoint) {
+	g.segments = segments
+	g.area.QueueDraw()
+}
+
+func (g *sparklineGraph) draw(_ *gtk.DrawingArea, cr *cairo.Context, w, h int) {
+	// Inset by the line width so the stroke is not clipped at 0% and 100%.
+	const inset = 1.5
+	pw, ph := float64(w)-2*inset, float64(h)-2*inset
+	if pw <= 0 || ph <= 0 {
+		return
+	}
+	colGreenLine.set(cr)
+	cr.SetLineWidth(1.5)
+	for _, seg := range g.segments {
+		if len(seg) == 1 {
+			// A lone bucket still shows as a dot.
+			cr.Arc(inset+seg[0].X*pw, inset+(1-seg[0].Y)*ph, 1, 0, 2*math.Pi)
+			cr.Fill()
+			continue
+		}
+		for i, p := range seg {
+			x, y := inset+p.X*pw, inset+(1-p.Y)*ph
+			if i == 0 {
+				cr.MoveTo(x, y)
+			} else {
+				cr.LineTo(x, y)
+			}
+		}
+		cr.Stroke()
+	}
+}
+
 // Drawing helpers
 
 func drawLabel(cr *cairo.Context, text string, x, y int, col rgba, fontSize int) {
 	col.set(cr)
+	layout := labelLayout(cr, text, fontSize)
+	cr.MoveTo(float64(x), float64(y))
+	pangocairo.ShowLayout(cr, layout)
+}
+
+// drawNoData centers the noDataMessage in the plot area.
+func drawNoData(cr *cairo.Context, daemonStarted int64, plotW, plotH int) {
+	if msg := noDataMessage(daemonStarted, time.Now()); msg != "" {
+		drawCenteredLabel(cr, msg, padLeft+plotW/2, padTop+plotH/2-8, colLabel, 11)
+	}
+}
+
+// drawCenteredLabel draws text horizontally centered on x.
+func drawCenteredLabel(cr *cairo.Context, text string, x, y int, col rgba, fontSize int) {
+	col.set(cr)
+	layout := labelLayout(cr, text, fontSize)
+	w, _ := layout.PixelSize()
+	cr.MoveTo(float64(x-w/2), float64(y))
+	pangocairo.ShowLayout(cr, layout)
+}
+
+func labelLayout(cr *cairo.Context, text string, fontSize int) *pango.Layout {
 	layout := pangocairo.CreateLayout(cr)
 	fd := pango.NewFontDescription()
 	fd.SetFamily("Sans")
 	fd.SetSize(fontSize * pango.SCALE)
 	layout.SetFontDescription(fd)
 	layout.SetText(text)
-	cr.MoveTo(float64(x), float64(y))
-	pangocairo.ShowLayout(cr, layout)
+	return layout
 }
 
 func drawTimeAxis(cr *cairo.Context, from, to time.Time, x, y, w, plotTop, plotH int) {
 	dur := to.Sub(from)
 	var step time.Duration
-	var format string
+	style := timeStyleClock
 	switch {
 	case dur <= 30*time.Minute:
 		step = 5 * time.Minute
-		format = "15:04"
 	case dur <= 2*time.Hour:
 		step = 15 * time.Minute
-		format = "15:04"
 	case dur <= 8*time.Hour:
 		step = time.Hour
-		format = "15:04"
 	case dur <= 2*24*time.Hour:
 		step = 3 * time.Hour
-		format = "15:04"
 	default:
 		step = 24 * time.Hour
-		format = "Jan 2"
+		style = timeStyleDay
 	}
 
 	t := from.Truncate(step).Add(step)
@@ -409,11 +843,127 @@ func drawTimeAxis(cr *cairo.Context, from, to time.Time, x, y, w, plotTop, plotH
 		cr.LineTo(px, float64(plotTop+plotH))
 		cr.Stroke()
 
-		drawLabel(cr, t.Format(format), int(px)-15, y+5, colLabel, 8)
+		drawCenteredLabel(cr, formatTime(t, style), int(px), y+5, colLabel, 8)
 		t = t.Add(step)
 	}
 }
 
+// drawSleepRegions shades each power state event, hibernate spans in a
+// separate tone, and labels it at the middle of its whole span.
+func drawSleepRegions(cr *cairo.Context, events []collector.PowerStateEvent, fromUnix int64, timeSpan float64, plotW, plotH int) {
+	toX := func(ts int64) float64 {
+		x := float64(padLeft) + float64(ts-fromUnix)/timeSpan*float64(plotW)
+		return math.Min(math.Max(x, float64(padLeft)), float64(padLeft+plotW))
+	}
+	for _, ev := range events {
+		for _, seg := range sleepSegments(ev) {
+			x1, x2 := toX(seg.start), toX(seg.end)
+			if seg.hibernate {
+				colHibernateBg.set(cr)
+			} else {
+				colSleepBg.set(cr)
+			}
+			cr.Rectangle(x1, float64(padTop), x2-x1, float64(plotH))
+			cr.Fill()
+		}
+		mid := (toX(ev.StartTime) + toX(ev.EndTime)) / 2
+		drawLabel(cr, sleepLabel(ev), int(mid)-15, padTop+plotH/2, colSleepLabel, 9)
+		if drain := sleepDrainLabel(ev); drain != "" {
+			drawLabel(cr, drain, int(mid)-15, padTop+plotH/2+12, colSleepLabel, 9)
+		}
+	}
+}
+
+// drawThrottleRegions tints each CPU throttling interval and marks it with a
+// strip along the top of the plot.
+func drawThrottleRegions(cr *cairo.Context, events []collector.ThrottleEvent, fromUnix int64, timeSpan float64, plotW, plotH int) {
+	toX := func(ts int64) float64 {
+		x := float64(padLeft) + float64(ts-fromUnix)/timeSpan*float64(plotW)
+		return math.Min(math.Max(x, float64(padLeft)), float64(padLeft+plotW))
+	}
+	for _, ev := range events {
+		x1, x2 := toX(ev.StartTime), toX(ev.EndTime)
+		w := math.Max(x2-x1, 1)
+		colThrottleBg.set(cr)
+		cr.Rectangle(x1, float64(padTop), w, float64(plotH))
+		cr.Fill()
+		colThrottleBar.set(cr)
+		cr.Rectangle(x1, float64(padTop), w, 3)
+		cr.Fill()
+	}
+}
+
+// drawIdleRegions marks each user-idle interval with a strip along the
+// bottom of the plot.
+func drawIdleRegions(cr *cairo.Context, intervals []collector.IdleInterval, fromUnix int64, timeSpan float64, plotW, plotH int) {
+	toX := func(ts int64) float64 {
+		x := float64(padLeft) + float64(ts-fromUnix)/timeSpan*float64(plotW)
+		return math.Min(math.Max(x, float64(padLeft)), float64(padLeft+plotW))
+	}
+	colIdleBar.set(cr)
+	for _, iv := range intervals {
+		x1, x2 := toX(iv.StartTime), toX(iv.EndTime)
+		cr.Rectangle(x1, float64(padTop+plotH-3), math.Max(x2-x1, 1), 3)
+		cr.Fill()
+	}
+}
+
+// drawAnnotationMarkers draws each annotation as a vertical line with a small
+// flag at the top of the plot. Automatic annotations are drawn first in a
+// muted color, so the user's own stay on top and stand out.
+func drawAnnotationMarkers(cr *cairo.Context, annotations []collector.Annotation, fromUnix int64, timeSpan float64, plotW, plotH int) {
+	cr.SetLineWidth(1)
+	for _, auto := range []bool{true, false} {
+		col := colAnnotation
+		if auto {
+			col = colAutoNote
+		}
+		col.set(cr)
+		for _, a := range annotations {
+			if isAutoAnnotation(a) == auto {
+				drawAnnotationMarker(cr, a, fromUnix, timeSpan, plotW, plotH)
+			}
+		}
+	}
+}
+
+// drawAnnotationMarker draws one annotation marker in the current color,
+// unless it lies outside the plot.
+func drawAnnotationMarker(cr *cairo.Context, a collector.Annotation, fromUnix int64, timeSpan float64, plotW, plotH int) {
+	x := float64(padLeft) + float64(a.Timestamp-fromUnix)/timeSpan*float64(plotW)
+	if x < float64(padLeft) || x > float64(padLeft+plotW) {
+		return
+	}
+	x = math.Round(x) + 0.5
+	cr.MoveTo(x, float64(padTop))
+	cr.LineTo(x, float64(padTop+plotH))
+	cr.Stroke()
+	cr.MoveTo(x, float64(padTop))
+	cr.LineTo(x+6, float64(padTop)+3)
+	cr.LineTo(x, float64(padTop)+6)
+	cr.ClosePath()
+	cr.Fill()
+}
+
+// connectAnnotationTooltip shows the text of the annotation under the pointer
+// as a tooltip on a graph. current returns the graph's annotations and range.
+func connectAnnotationTooltip(area *gtk.DrawingArea, current func() ([]collector.Annotation, time.Time, time.Time)) {
+	area.SetHasTooltip(true)
+	area.ConnectQueryTooltip(func(x, y int, _ bool, tooltip *gtk.Tooltip) bool {
+		if y < padTop || y > area.Height()-padBottom {
+			return false
+		}
+		annotations, from, to := current()
+		plotW := area.Width() - padLeft - padRight
+		a, ok := annotationAt(annotations, from, to, plotW, float64(x-padLeft))
+		if !ok {
+			return false
+		}
+		tooltip.SetText(annotationTooltip(a))
+		return true
+	})
+}
+
 func drawHatched(cr *cairo.Context, x, y, w, h float64) {
 	cr.Save()
 	cr.Rectangle(x, y, w, h)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// guiState is the window and navigation state restored on the next launch.
+type guiState struct {
+	RangeIndex        int    `json:"range_index"`
+	Width             int    `json:"width"`
+	Height            int    `json:"height"`
+	Maximized         bool   `json:"maximized"`
+	Page              string `json:"page"`
+	RefreshIntervalMs uint   `json:"refresh_interval_ms"`
+	SmoothPower       bool   `json:"smooth_power"`
+	SubtractBaseline  bool   `json:"subtract_baseline"`
+	DischargeOnly     bool   `json:"discharge_only"`
+	FillOpacityPct    int    `json:"fill_opacity_pct"`
+	// HiddenOverlays are the energy graph overlays toggled off.
+	HiddenOverlays []string `json:"hidden_overlays,omitempty"`
+}
+
+const (
+	defaultRefreshIntervalMs = 5000
+	defaultFillOpacityPct    = 25
+)
+
+// refreshIntervals are the selectable GUI refresh cadences.
+var refreshIntervals = []struct {
+	Label string
+	Ms    uint
+}{
+	{"0.5 seconds", 500},
+	{"1 second", 1000},
+	{"2 seconds", 2000},
+	{"5 seconds", 5000},
+	{"10 seconds", 10000},
+	{"30 seconds", 30000},
+	{"1 minute", 60000},
+}
+
+// refreshIntervalIndex returns the position of ms in refreshIntervals, or -1.
+func refreshIntervalIndex(ms uint) int {
+	for i, ri := range refreshIntervals {
+		if ri.Ms == ms {
+			return i
+		}
+	}
+	return -1
+}
+
+func defaultGUIState() guiState {
+	return guiState{
+		RangeIndex:        3, // 6h
+		Width:             900,
+		Height:            600,
+		Page:              "overview",
+		RefreshIntervalMs: defaultRefreshIntervalMs,
+		SmoothPower:       true,
+		FillOpacityPct:    defaultFillOpacityPct,
+	}
+}
+
+// guiStatePath returns the GUI state file under the XDG config directory.
+func guiStatePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "power-monitor", "gui-state.json"), nil
+}
+
+// loadGUIState reads the state file at path. Missing or unreadable fields
+// fall back to defaults so a corrupt file never prevents startup.
+func loadGUIState(path string) (guiState, error) {
+	state := defaultGUIState()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return defaultGUIState(), err
+	}
+	return state.sanitized(), nil
+}
+
+// sanitized replaces out-of-range values with their defaults.
+func (s guiState) sanitized() guiState {
+	def := defaultGUIState()
+	if s.RangeIndex < 0 || s.RangeIndex >= len(timeRanges) {
+		s.RangeIndex = def.RangeIndex
+	}
+	if s.Width < 200 || s.Height < 200 {
+		s.Width, s.Height = def.Width, def.Height
+	}
+	if refreshIntervalIndex(s.RefreshIntervalMs) < 0 {
+		s.RefreshIntervalMs = def.RefreshIntervalMs
+	}
+	if s.FillOpacityPct < 0 || s.FillOpacityPct > 100 {
+		s.FillOpacityPct = def.FillOpacityPct
+	}
+	valid := false
+	for _, e := range sidebarEntries {
+		if e.id == s.Page {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		s.Page = def.Page
+	}
+	s.HiddenOverlays = slices.DeleteFunc(s.HiddenOverlays, func(id string) bool { return !isEnergyOverlay(id) })
+	if len(s.HiddenOverlays) == 0 {
+		s.HiddenOverlays = nil
+	}
+	return s
+}
+
+// saveGUIState writes state to path, creating the parent directory.
+func saveGUIState(path string, state guiState) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadGUIState_MissingFileUsesDefaults(t *testing.T) {
+	state, err := loadGUIState(filepath.Join(t.TempDir(), "gui-state.json"))
+	if err != nil {
+		t.Fatalf("loadGUIState() error = %v", err)
+	}
+	if !reflect.DeepEqual(state, defaultGUIState()) {
+		t.Fatalf("state = %#v, want defaults %#v", state, defaultGUIState())
+	}
+}
+
+func TestGUIState_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "power-monitor", "gui-state.json")
+	want := guiState{RangeIndex: 5, Width: 1280, Height: 800, Maximized: true, Page: "battery", RefreshIntervalMs: 500, SmoothPower: false, SubtractBaseline: true, DischargeOnly: true, FillOpacityPct: 60, HiddenOverlays: []string{overlayIdle}}
+
+	if err := saveGUIState(path, want); err != nil {
+		t.Fatalf("saveGUIState() error = %v", err)
+	}
+	got, err := loadGUIState(path)
+	if err != nil {
+		t.Fatalf("loadGUIState() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("loadGUIState() = %#v, want %#v", got, want)
+	}
+}
+
+func TestLoadGUIState_SanitizesInvalidValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gui-state.json")
+	data := `{"range_index": 42, "width": 10, "height": 10, "page": "nope", "refresh_interval_ms": 7, "fill_opacity_pct": 150, "hidden_overlays": ["temperature"]}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	got, err := loadGUIState(path)
+	if err != nil {
+		t.Fatalf("loadGUIState() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, defaultGUIState()) {
+		t.Fatalf("loadGUIState() = %#v, want defaults", got)
+	}
+}
+
+func TestLoadGUIState_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gui-state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	got, err := loadGUIState(path)
+	if err == nil {
+		t.Fatal("loadGUIState() error = nil, want parse error")
+	}
+	if !reflect.DeepEqual(got, defaultGUIState()) {
+		t.Fatalf("loadGUIState() = %#v, want defaults", got)
+	}
+}
+
+func TestLoadGUIState_OlderFileGetsNewDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gui-state.json")
+	data := `{"range_index": 1, "width": 900, "height": 600, "page": "overview"}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	got, err := loadGUIState(path)
+	if err != nil {
+		t.Fatalf("loadGUIState() error = %v", err)
+	}
+	if got.RefreshIntervalMs != defaultRefreshIntervalMs || !got.SmoothPower || got.FillOpacityPct != defaultFillOpacityPct || got.RangeIndex != 1 {
+		t.Fatalf("loadGUIState() = %#v, want range 1 with default refresh, smoothing and fill opacity", got)
+	}
+}
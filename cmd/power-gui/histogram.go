@@ -0,0 +1,30 @@
+package main
+
+import "github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+
+// histogramBucketCount is how many power buckets the distribution view asks
+// the daemon for.
+const histogramBucketCount = 40
+
+// histogramPercentile returns the power, in microwatts, that fraction p of
+// the histogram's samples fall under: the upper bound of the first bucket at
+// which the cumulative count reaches p of the total. It returns 0 for an
+// empty histogram.
+func histogramPercentile(buckets []collector.PowerHistogramBucket, p float64) int64 {
+	total := 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total == 0 {
+		return 0
+	}
+	need := p * float64(total)
+	cum := 0
+	for _, b := range buckets {
+		cum += b.Count
+		if float64(cum) >= need {
+			return b.MaxUW
+		}
+	}
+	return buckets[len(buckets)-1].MaxUW
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestHistogramPercentile(t *testing.T) {
+	buckets := []collector.PowerHistogramBucket{
+		{MinUW: 0, MaxUW: 2000000, Count: 10},
+		{MinUW: 2000000, MaxUW: 4000000, Count: 70},
+		{MinUW: 4000000, MaxUW: 6000000, Count: 10},
+		{MinUW: 6000000, MaxUW: 8000000, Count: 0},
+		{MinUW: 8000000, MaxUW: 10000000, Count: 10},
+	}
+	tests := []struct {
+		name string
+		p    float64
+		want int64
+	}{
+		{"low percentile", 0.05, 2000000},
+		{"median", 0.5, 4000000},
+		{"exact boundary", 0.9, 6000000},
+		{"above boundary skips empty bucket", 0.95, 10000000},
+		{"all samples", 1, 10000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := histogramPercentile(buckets, tt.p); got != tt.want {
+				t.Fatalf("histogramPercentile(%v) = %d, want %d", tt.p, got, tt.want)
+			}
+		})
+	}
+
+	if got := histogramPercentile(nil, 0.9); got != 0 {
+		t.Fatalf("histogramPercentile(nil) = %d, want 0", got)
+	}
+	empty := []collector.PowerHistogramBucket{{MinUW: 0, MaxUW: 1}}
+	if got := histogramPercentile(empty, 0.9); got != 0 {
+		t.Fatalf("histogramPercentile(no samples) = %d, want 0", got)
+	}
+}
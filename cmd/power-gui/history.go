@@ -0,0 +1,60 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// historyCache holds the battery samples for the selected time range so that
+// steady-state refreshes only fetch samples newer than the last one seen.
+type historyCache struct {
+	rangeDur time.Duration
+	battery  []collector.BatterySample
+	lastTs   int64 // timestamp of the newest cached sample
+	valid    bool
+}
+
+// fetchFrom returns the start of the next GetHistory query for a view of
+// rangeDur ending at now, and whether it is a full refetch. A full refetch
+// happens on first use, whenever the range changes, and when the newest
+// cached sample is ahead of now because the clock stepped backward.
+func (c *historyCache) fetchFrom(now time.Time, rangeDur time.Duration) (from time.Time, full bool) {
+	if !c.valid || c.rangeDur != rangeDur || c.lastTs > now.Unix() {
+		return now.Add(-rangeDur), true
+	}
+	return time.Unix(c.lastTs+1, 0), false
+}
+
+// merge stores the result of a fetch starting at from and drops samples that
+// have aged out of the window [now-rangeDur, now].
+func (c *historyCache) merge(fetched []collector.BatterySample, full bool, from, now time.Time, rangeDur time.Duration) {
+	if full {
+		c.battery = c.battery[:0]
+		c.rangeDur = rangeDur
+		c.lastTs = from.Unix() - 1
+		c.valid = true
+	}
+	// Track the newest sample rather than the query end so that a sample
+	// stamped just before the query but committed after it is not skipped.
+	for _, s := range fetched {
+		if s.Timestamp > c.lastTs {
+			c.battery = append(c.battery, s)
+			c.lastTs = s.Timestamp
+		}
+	}
+
+	windowStart := now.Add(-rangeDur).Unix()
+	trim := 0
+	for trim < len(c.battery) && c.battery[trim].Timestamp < windowStart {
+		trim++
+	}
+	if trim > 0 {
+		c.battery = append([]collector.BatterySample(nil), c.battery[trim:]...)
+	}
+}
+
+// invalidate forces the next fetch to reload the whole range.
+func (c *historyCache) invalidate() {
+	c.valid = false
+}
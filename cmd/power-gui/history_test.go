@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func cachedTimestamps(c *historyCache) []int64 {
+	ts := make([]int64, len(c.battery))
+	for i, s := range c.battery {
+		ts[i] = s.Timestamp
+	}
+	return ts
+}
+
+func TestHistoryCache_FullThenIncremental(t *testing.T) {
+	var c historyCache
+	rangeDur := 100 * time.Second
+	now := time.Unix(1000, 0)
+
+	from, full := c.fetchFrom(now, rangeDur)
+	if !full || from.Unix() != 900 {
+		t.Fatalf("first fetchFrom() = (%d, %v), want (900, true)", from.Unix(), full)
+	}
+	c.merge(samplesAt(900, 950, 1000), full, from, now, rangeDur)
+
+	now = time.Unix(1010, 0)
+	from, full = c.fetchFrom(now, rangeDur)
+	if full || from.Unix() != 1001 {
+		t.Fatalf("steady fetchFrom() = (%d, %v), want (1001, false)", from.Unix(), full)
+	}
+	// A duplicate of the last sample is ignored; 900 ages out of [910, 1010].
+	c.merge(samplesAt(1000, 1005, 1010), full, from, now, rangeDur)
+
+	want := []int64{950, 1000, 1005, 1010}
+	got := cachedTimestamps(&c)
+	if len(got) != len(want) {
+		t.Fatalf("cached = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("cached = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHistoryCache_EmptyFullFetchResumesFromRangeStart(t *testing.T) {
+	var c historyCache
+	rangeDur := time.Minute
+	now := time.Unix(600, 0)
+
+	from, full := c.fetchFrom(now, rangeDur)
+	c.merge(nil, full, from, now, rangeDur)
+
+	from, full = c.fetchFrom(time.Unix(605, 0), rangeDur)
+	if full || from.Unix() != 540 {
+		t.Fatalf("fetchFrom() after empty fetch = (%d, %v), want (540, false)", from.Unix(), full)
+	}
+}
+
+func TestHistoryCache_RangeChangeRefetches(t *testing.T) {
+	var c historyCache
+	now := time.Unix(10_000, 0)
+
+	from, full := c.fetchFrom(now, time.Hour)
+	c.merge(samplesAt(9_000, 9_500), full, from, now, time.Hour)
+
+	from, full = c.fetchFrom(now, 15*time.Minute)
+	if !full || from.Unix() != 9_100 {
+		t.Fatalf("fetchFrom() after range change = (%d, %v), want (9100, true)", from.Unix(), full)
+	}
+	c.merge(samplesAt(9_500), full, from, now, 15*time.Minute)
+	if got := cachedTimestamps(&c); len(got) != 1 || got[0] != 9_500 {
+		t.Fatalf("cached = %v, want [9500]", got)
+	}
+
+	c.invalidate()
+	if _, full := c.fetchFrom(now, 15*time.Minute); !full {
+		t.Fatal("fetchFrom() after invalidate full = false, want true")
+	}
+}
+
+func TestHistoryCache_BackwardClockStepRefetches(t *testing.T) {
+	var c historyCache
+	now := time.Unix(1000, 0)
+
+	from, full := c.fetchFrom(now, time.Minute)
+	c.merge(samplesAt(990, 1000), full, from, now, time.Minute)
+
+	now = time.Unix(700, 0)
+	from, full = c.fetchFrom(now, time.Minute)
+	if !full || from.Unix() != 640 {
+		t.Fatalf("fetchFrom() after clock step = (%d, %v), want (640, true)", from.Unix(), full)
+	}
+}
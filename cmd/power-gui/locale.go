@@ -0,0 +1,30 @@
+package main
+
+import (
+	"time"
+
+	"github.com/diamondburned/gotk4/pkg/gio/v2"
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+)
+
+// loadTimeFormat reads the desktop's 12/24-hour clock preference and switches
+// formatTime to GLib, which names months in the user's locale. Without the
+// GNOME interface schema the clock stays 24-hour.
+func loadTimeFormat() {
+	const schemaID = "org.gnome.desktop.interface"
+	if src := gio.SettingsSchemaSourceGetDefault(); src != nil {
+		if schema := src.Lookup(schemaID, true); schema != nil && schema.HasKey("clock-format") {
+			use12HourClock = gio.NewSettings(schemaID).String("clock-format") == "12h"
+		}
+	}
+
+	formatTime = func(t time.Time, style timeStyle) string {
+		pattern, layout := timePatterns(style, use12HourClock)
+		if dt := glib.NewDateTimeFromUnixLocal(t.Unix()); dt != nil {
+			if s := dt.Format(pattern); s != "" {
+				return s
+			}
+		}
+		return t.Format(layout)
+	}
+}
@@ -3,12 +3,15 @@ package main
 import (
 	"log"
 	"os"
+	"slices"
 	"time"
 
 	"github.com/diamondburned/gotk4-adwaita/pkg/adw"
 	"github.com/diamondburned/gotk4/pkg/gio/v2"
 	"github.com/diamondburned/gotk4/pkg/glib/v2"
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 )
 
 var (
@@ -16,9 +19,50 @@ var (
 	stats         *statsBar
 	battGraph     *batteryGraph
 	energyGr      *energyGraph
-	selectedRange int = 3 // default 6h
+	overlays      *overlayBar
+	histGr        *histogramGraph
+	coreSplit     *gtk.Label
+	sparkline     *sparklineGraph
+	refreshBanner *adw.Banner
+	// regressionBanner shows an active idle power regression until the user
+	// dismisses it; dismissedRegression is the start time of the one they
+	// dismissed.
+	regressionBanner    *adw.Banner
+	dismissedRegression int64
+	history             historyCache
+	selectedRange       int = 3 // default 6h
+
+	refreshIntervalMs uint = defaultRefreshIntervalMs
+	refreshSource     glib.SourceHandle
+	smoothPower       = true
+	fillOpacityPct    = defaultFillOpacityPct
+
+	// calib is the user's display calibration, a community estimate for the
+	// battery model if never calibrated, or nil if there is neither.
+	calib            *calibration.CalibrationResult
+	subtractBaseline bool
+	// dischargeOnly plots only on-battery power in the energy graph.
+	dischargeOnly bool
+	// hiddenOverlays are the energy graph overlays toggled off.
+	hiddenOverlays []string
+
+	// displayModel is the daemon's background display power model, refetched
+	// every displayModelRefresh; nil until fetched.
+	displayModel        *calibration.DisplayPowerModel
+	displayModelFetched time.Time
+
+	sparklineFetched time.Time
 )
 
+// displayModelRefresh is how often the background model is refetched. It
+// gains at most one point a minute, so there is no need to refit it on
+// every refresh.
+const displayModelRefresh = 10 * time.Minute
+
+// capacityBandMinRange is the shortest time range that shows the min/max
+// capacity band on the battery graph.
+const capacityBandMinRange = 24 * time.Hour
+
 type sidebarEntry struct {
 	id       string
 	title    string
@@ -28,6 +72,7 @@ type sidebarEntry struct {
 var sidebarEntries = []sidebarEntry{
 	{"overview", "Overview", "utilities-system-monitor-symbolic"},
 	{"battery", "Battery Status", "battery-full-symbolic"},
+	{"annotations", "Annotations", "document-edit-symbolic"},
 	{"calibration", "Calibration", "preferences-color-symbolic"},
 	{"settings", "Settings", "preferences-system-symbolic"},
 }
@@ -47,11 +92,41 @@ func activate(app *adw.Application) {
 		log.Fatalf("Failed to connect to D-Bus: %v", err)
 	}
 
+	state := defaultGUIState()
+	statePath, err := guiStatePath()
+	if err == nil {
+		if state, err = loadGUIState(statePath); err != nil {
+			log.Printf("load GUI state: %v", err)
+		}
+	}
+	selectedRange = state.RangeIndex
+	refreshIntervalMs = state.RefreshIntervalMs
+	smoothPower = state.SmoothPower
+	subtractBaseline = state.SubtractBaseline
+	dischargeOnly = state.DischargeOnly
+	fillOpacityPct = state.FillOpacityPct
+	hiddenOverlays = state.HiddenOverlays
+	if calib, err = loadCalibration(); err != nil {
+		log.Printf("load calibration: %v", err)
+	}
+	if calib == nil {
+		if health, err := client.GetBatteryHealth(); err == nil {
+			var path string
+			if calib, path = loadCommunityCalibration(health); calib != nil {
+				log.Printf("not calibrated; using community estimate %s", path)
+			}
+		}
+	}
+
 	win := adw.NewApplicationWindow(&app.Application)
 	win.SetTitle("Power Monitor")
-	win.SetDefaultSize(900, 600)
+	win.SetDefaultSize(state.Width, state.Height)
+	if state.Maximized {
+		win.Maximize()
+	}
 
 	loadCSS()
+	loadTimeFormat()
 
 	// Content stack
 	stack := gtk.NewStack()
@@ -63,9 +138,26 @@ func activate(app *adw.Application) {
 	stats = newStatsBar()
 	battGraph = newBatteryGraph()
 	energyGr = newEnergyGraph()
+	for _, id := range hiddenOverlays {
+		energyGr.SetOverlayVisible(id, false)
+	}
+	overlays = newOverlayBar(hiddenOverlays, func(id string, visible bool) {
+		energyGr.SetOverlayVisible(id, visible)
+		hiddenOverlays = slices.DeleteFunc(hiddenOverlays, func(h string) bool { return h == id })
+		if !visible {
+			hiddenOverlays = append(hiddenOverlays, id)
+		}
+	})
+	histGr = newHistogramGraph()
+	coreSplit = gtk.NewLabel("")
+	coreSplit.AddCSSClass("dim-label")
+	coreSplit.SetHAlign(gtk.AlignEnd)
+	coreSplit.SetTooltipText("Battery energy above the idle baseline, split by the CPU time of the top processes on each core class")
+	coreSplit.SetVisible(false)
 
 	battGraph.area.SetSizeRequest(600, 220)
 	energyGr.area.SetSizeRequest(600, 220)
+	histGr.area.SetSizeRequest(600, 180)
 
 	timeBar := newTimeRangeBar(selectedRange, func(idx int) {
 		selectedRange = idx
@@ -73,7 +165,10 @@ func activate(app *adw.Application) {
 
 	graphBox := gtk.NewBox(gtk.OrientationVertical, 8)
 	graphBox.Append(battGraph.area)
+	graphBox.Append(overlays.container)
 	graphBox.Append(energyGr.area)
+	graphBox.Append(histGr.area)
+	graphBox.Append(coreSplit)
 
 	overviewBox := gtk.NewBox(gtk.OrientationVertical, 8)
 	overviewBox.SetMarginStart(12)
@@ -90,11 +185,11 @@ func activate(app *adw.Application) {
 	batteryPage := newBatteryHealthPage()
 	stack.AddNamed(batteryPage.container, "battery")
 
-	calibrationPage := adw.NewStatusPage()
-	calibrationPage.SetTitle("Calibration")
-	calibrationPage.SetDescription("Coming Soon")
-	calibrationPage.SetIconName("preferences-color-symbolic")
-	stack.AddNamed(calibrationPage, "calibration")
+	annotationsPage := newAnnotationsPage()
+	stack.AddNamed(annotationsPage.container, "annotations")
+
+	calibrationPage := newCalibrationPage()
+	stack.AddNamed(calibrationPage.container, "calibration")
 
 	settingsPage := newSettingsPage()
 	stack.AddNamed(settingsPage.container, "settings")
@@ -104,8 +199,12 @@ func activate(app *adw.Application) {
 	sidebar.SetSelectionMode(gtk.SelectionBrowse)
 	sidebar.AddCSSClass("navigation-sidebar")
 
+	sparkline = newSparklineGraph()
 	for _, entry := range sidebarEntries {
 		row := newSidebarRow(entry.iconName, entry.title)
+		if entry.id == "overview" {
+			row.Append(sparkline.area)
+		}
 		sidebar.Append(row)
 	}
 
@@ -120,12 +219,18 @@ func activate(app *adw.Application) {
 		if idx >= 0 && idx < len(sidebarEntries) {
 			contentTitle.SetLabel(sidebarEntries[idx].title)
 			stack.SetVisibleChildName(sidebarEntries[idx].id)
+			state.Page = sidebarEntries[idx].id
 		}
 	})
 
-	// Select first row
-	if first := sidebar.RowAtIndex(0); first != nil {
-		sidebar.SelectRow(first)
+	// Select the last viewed page
+	for i, entry := range sidebarEntries {
+		if entry.id != state.Page {
+			continue
+		}
+		if row := sidebar.RowAtIndex(i); row != nil {
+			sidebar.SelectRow(row)
+		}
 	}
 
 	sidebarScroll := gtk.NewScrolledWindow()
@@ -171,18 +276,63 @@ func activate(app *adw.Application) {
 	rightPane := gtk.NewBox(gtk.OrientationVertical, 0)
 	rightPane.SetHExpand(true)
 	rightPane.Append(rightHeader)
+
+	refreshBanner = adw.NewBanner("Cannot reach power-monitor-daemon")
+	refreshBanner.SetButtonLabel("Retry")
+	refreshBanner.ConnectButtonClicked(refreshData)
+	rightPane.Append(refreshBanner)
+	regressionBanner = adw.NewBanner("")
+	regressionBanner.SetButtonLabel("Dismiss")
+	regressionBanner.ConnectButtonClicked(func() {
+		if r, err := client.GetPowerRegression(); err == nil && r != nil {
+			dismissedRegression = r.StartTime
+		}
+		regressionBanner.SetRevealed(false)
+	})
+	rightPane.Append(regressionBanner)
 	rightPane.Append(contentScroll)
 
 	splitBox.Append(rightPane)
 
 	win.SetContent(splitBox)
+	installShortcuts(win, timeBar)
+
+	win.ConnectCloseRequest(func() bool {
+		if statePath == "" {
+			return false
+		}
+		state.RangeIndex = selectedRange
+		state.RefreshIntervalMs = refreshIntervalMs
+		state.SmoothPower = smoothPower
+		state.SubtractBaseline = subtractBaseline
+		state.DischargeOnly = dischargeOnly
+		state.FillOpacityPct = fillOpacityPct
+		state.HiddenOverlays = hiddenOverlays
+		state.Maximized = win.IsMaximized()
+		if !state.Maximized {
+			state.Width, state.Height = win.DefaultSize()
+		}
+		if err := saveGUIState(statePath, state); err != nil {
+			log.Printf("save GUI state: %v", err)
+		}
+		return false
+	})
 	win.Show()
 
 	// Initial data load
 	refreshData()
 
-	// Auto-refresh every 5 seconds
-	glib.TimeoutSecondsAdd(5, func() bool {
+	setRefreshInterval(refreshIntervalMs)
+}
+
+// setRefreshInterval (re)schedules the periodic refresh to run every ms
+// milliseconds.
+func setRefreshInterval(ms uint) {
+	if refreshSource != 0 {
+		glib.SourceRemove(refreshSource)
+	}
+	refreshIntervalMs = ms
+	refreshSource = glib.TimeoutAdd(ms, func() bool {
 		refreshData()
 		return true
 	})
@@ -203,20 +353,103 @@ func newSidebarRow(iconName, label string) *gtk.Box {
 
 func refreshData() {
 	now := time.Now()
-	from := now.Add(-timeRanges[selectedRange].Duration)
+	rangeDur := timeRanges[selectedRange].Duration
+	from := now.Add(-rangeDur)
 
 	current, err := client.GetCurrentStats()
-	if err == nil {
-		stats.Update(current)
+	if err != nil {
+		refreshBanner.SetRevealed(true)
+		battGraph.SetDaemonStarted(0)
+		energyGr.SetDaemonStarted(0)
+		// The daemon may come back with a reset database; reload everything.
+		history.invalidate()
+		return
 	}
-
-	history, err := client.GetHistory(from, now)
+	if now.Sub(displayModelFetched) >= displayModelRefresh {
+		if m, err := client.GetDisplayPowerModel(); err == nil {
+			displayModel = m
+		}
+		displayModelFetched = now
+	}
+	if now.Sub(sparklineFetched) >= sparklineRefresh {
+		sparkFrom := now.Add(-sparklineRange)
+		if buckets, err := client.GetHistoryBuckets(sparkFrom, now, sparklineBucket); err == nil {
+			sparkline.SetData(sparklineSegments(buckets, sparkFrom, now, sparklineBucket))
+			sparklineFetched = now
+		}
+	}
+	stats.Update(current)
+	if r, err := client.GetPowerRegression(); err == nil {
+		notice := ""
+		if r != nil && r.StartTime != dismissedRegression {
+			notice = regressionNotice(r, now)
+		}
+		regressionBanner.SetTitle(notice)
+		regressionBanner.SetRevealed(notice != "")
+	}
+	threshold := gapThresholdFor(current.IntervalSeconds)
+	battGraph.SetGapThreshold(threshold)
+	energyGr.SetGapThreshold(threshold)
+	battGraph.SetDaemonStarted(current.DaemonStarted)
+	energyGr.SetDaemonStarted(current.DaemonStarted)
+
+	fetchFrom, full := history.fetchFrom(now, rangeDur)
+	fetched, err := client.GetHistory(fetchFrom, now)
 	if err != nil {
+		refreshBanner.SetRevealed(true)
+		history.invalidate()
 		return
 	}
+	refreshBanner.SetRevealed(false)
+	history.merge(fetched.Battery, full, fetchFrom, now, rangeDur)
 
 	sleep, _ := client.GetPowerStateEvents(from, now)
 
-	battGraph.SetData(history.Battery, sleep, from, now)
-	energyGr.SetData(history.Battery, sleep, from, now)
+	// At day-plus ranges show the per-bucket capacity spread so charge
+	// cycles stay visible.
+	if rangeDur >= capacityBandMinRange {
+		bucket := bucketDuration(rangeDur)
+		band, _ := client.GetHistoryBuckets(from, now, bucket)
+		battGraph.SetCapacityBand(band, bucket)
+	} else {
+		battGraph.SetCapacityBand(nil, 0)
+	}
+
+	annotations, _ := client.GetAnnotations(from, now)
+	battGraph.SetAnnotations(annotations)
+	energyGr.SetAnnotations(annotations)
+	throttle, _ := client.GetThrottleEvents(from, now)
+	battGraph.SetThrottleEvents(throttle)
+	energyGr.SetThrottleEvents(throttle)
+	idle, _ := client.GetIdleIntervals(from, now)
+	energyGr.SetIdleIntervals(idle)
+	overlays.Update(overlayData{sleep: sleep, throttle: throttle, idle: idle})
+
+	battGraph.SetData(history.battery, sleep, from, now)
+	energyGr.SetBaseline(energyBaselineW())
+	energyGr.SetDischargeOnly(dischargeOnly)
+	energyGr.SetData(history.battery, sleep, from, now)
+
+	hist, _ := client.GetPowerHistogram(from, now, histogramBucketCount)
+	histGr.SetData(hist)
+
+	var baselineUW int64
+	if calib != nil {
+		baselineUW = calib.BaselinePowerUW
+	}
+	var summary string
+	if split, err := client.GetCoreClassEnergy(from, now, baselineUW); err == nil {
+		summary = coreSplitSummary(*split)
+	}
+	coreSplit.SetText(summary)
+	coreSplit.SetVisible(summary != "")
+}
+
+// energyBaselineW returns the calibrated idle power to subtract from the
+// energy graph, or 0 when subtraction is off or no calibration exists.
+func energyBaselineW() float64 {
+	if !subtractBaseline || calib == nil {
+		return 0
+	}
+	return float64(calib.BaselinePowerUW) / 1e6
 }
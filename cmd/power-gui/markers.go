@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// annotationHitPx is how close, in pixels, the pointer must be to an
+// annotation marker for the graph to show its text.
+const annotationHitPx = 4.0
+
+// annotationAt returns the annotation whose marker is nearest to x, given in
+// pixels from the left edge of a plotW-wide plot spanning from..to, if one
+// lies within annotationHitPx.
+func annotationAt(annotations []collector.Annotation, from, to time.Time, plotW int, x float64) (collector.Annotation, bool) {
+	timeSpan := float64(to.Unix() - from.Unix())
+	if timeSpan <= 0 || plotW <= 0 {
+		return collector.Annotation{}, false
+	}
+	var best collector.Annotation
+	bestDist := math.Inf(1)
+	for _, a := range annotations {
+		ax := float64(a.Timestamp-from.Unix()) / timeSpan * float64(plotW)
+		if dist := math.Abs(ax - x); dist <= annotationHitPx && dist < bestDist {
+			best, bestDist = a, dist
+		}
+	}
+	return best, !math.IsInf(bestDist, 1)
+}
+
+// annotationTooltip returns the hover text for an annotation marker.
+// Automatic annotations are marked as such.
+func annotationTooltip(a collector.Annotation) string {
+	text := formatTime(time.Unix(a.Timestamp, 0), timeStyleDayClock) + " — " + a.Text
+	if isAutoAnnotation(a) {
+		text += " (automatic)"
+	}
+	return text
+}
+
+// isAutoAnnotation reports whether the daemon placed a rather than the user.
+func isAutoAnnotation(a collector.Annotation) bool {
+	return a.Source == collector.AnnotationSourceAuto
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestAnnotationAt(t *testing.T) {
+	from := time.Unix(1000, 0)
+	to := time.Unix(2000, 0)
+	annotations := []collector.Annotation{
+		{ID: 1, Timestamp: 1100, Text: "first"},  // x = 100
+		{ID: 2, Timestamp: 1105, Text: "second"}, // x = 105
+		{ID: 3, Timestamp: 1500, Text: "third"},  // x = 500
+	}
+
+	tests := []struct {
+		name   string
+		x      float64
+		wantID int64
+		wantOK bool
+	}{
+		{"on marker", 500, 3, true},
+		{"within hit distance", 503, 3, true},
+		{"outside hit distance", 510, 0, false},
+		{"nearest of close markers", 104, 2, true},
+		{"nearest of close markers other side", 101, 1, true},
+		{"empty space", 300, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := annotationAt(annotations, from, to, 1000, tt.x)
+			if ok != tt.wantOK || got.ID != tt.wantID {
+				t.Fatalf("annotationAt(x=%v) = id %d, %v; want id %d, %v", tt.x, got.ID, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := annotationAt(annotations, to, from, 1000, 100); ok {
+		t.Fatal("annotationAt() with empty range ok = true, want false")
+	}
+}
+
+func TestAnnotationTooltip(t *testing.T) {
+	ts := time.Date(2026, time.March, 4, 9, 30, 0, 0, time.Local)
+	got := annotationTooltip(collector.Annotation{Timestamp: ts.Unix(), Text: "enabled TLP"})
+	if want := "Mar 4 09:30 — enabled TLP"; got != want {
+		t.Fatalf("annotationTooltip() = %q, want %q", got, want)
+	}
+
+	got = annotationTooltip(collector.Annotation{Timestamp: ts.Unix(), Text: "AC unplugged", Source: collector.AnnotationSourceAuto})
+	if want := "Mar 4 09:30 — AC unplugged (automatic)"; got != want {
+		t.Fatalf("annotationTooltip(auto) = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// overlayBar is the row of checkboxes above the energy graph that toggles
+// its overlays. Only overlays with data in the visible range get a toggle.
+type overlayBar struct {
+	container *gtk.Box
+	checks    map[string]*gtk.CheckButton
+}
+
+// newOverlayBar builds the toggles, checked unless listed in hidden, and
+// calls onToggle when the user flips one.
+func newOverlayBar(hidden []string, onToggle func(id string, visible bool)) *overlayBar {
+	bar := &overlayBar{checks: make(map[string]*gtk.CheckButton)}
+	bar.container = gtk.NewBox(gtk.OrientationHorizontal, 12)
+	bar.container.SetHAlign(gtk.AlignEnd)
+	bar.container.SetVisible(false)
+
+	for _, o := range energyOverlays {
+		id := o.id
+		check := gtk.NewCheckButtonWithLabel(o.label)
+		check.SetActive(!slices.Contains(hidden, id))
+		check.SetVisible(false)
+		check.ConnectToggled(func() {
+			onToggle(id, check.Active())
+		})
+		bar.checks[id] = check
+		bar.container.Append(check)
+	}
+	return bar
+}
+
+// Update shows the toggles of the overlays with data and hides the rest,
+// hiding the whole bar when none have any.
+func (b *overlayBar) Update(d overlayData) {
+	available := availableOverlays(d)
+	for id, check := range b.checks {
+		check.SetVisible(slices.Contains(available, id))
+	}
+	b.container.SetVisible(len(available) > 0)
+}
@@ -0,0 +1,61 @@
+package main
+
+import "github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+
+// IDs of the series the energy graph can draw over its power bars, as
+// persisted in guiState.HiddenOverlays.
+const (
+	overlaySleep    = "sleep"
+	overlayThrottle = "throttle"
+	overlayIdle     = "idle"
+)
+
+// energyOverlays lists the overlays in the order of their toggles above the
+// energy graph.
+var energyOverlays = []struct {
+	id    string
+	label string
+}{
+	{overlaySleep, "Sleep"},
+	{overlayThrottle, "CPU throttling"},
+	{overlayIdle, "User idle"},
+}
+
+// overlayData holds what the energy graph's overlays draw for the visible
+// range.
+type overlayData struct {
+	sleep    []collector.PowerStateEvent
+	throttle []collector.ThrottleEvent
+	idle     []collector.IdleInterval
+}
+
+// availableOverlays returns the IDs of the overlays with anything to draw,
+// in energyOverlays order. Toggles for the others are hidden.
+func availableOverlays(d overlayData) []string {
+	var ids []string
+	for _, o := range energyOverlays {
+		var n int
+		switch o.id {
+		case overlaySleep:
+			n = len(d.sleep)
+		case overlayThrottle:
+			n = len(d.throttle)
+		case overlayIdle:
+			n = len(d.idle)
+		}
+		if n > 0 {
+			ids = append(ids, o.id)
+		}
+	}
+	return ids
+}
+
+// isEnergyOverlay reports whether id names one of energyOverlays.
+func isEnergyOverlay(id string) bool {
+	for _, o := range energyOverlays {
+		if o.id == id {
+			return true
+		}
+	}
+	return false
+}
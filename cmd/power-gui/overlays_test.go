@@ -0,0 +1,39 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestAvailableOverlays(t *testing.T) {
+	tests := []struct {
+		name string
+		data overlayData
+		want []string
+	}{
+		{name: "no data", data: overlayData{}, want: nil},
+		{
+			name: "idle only",
+			data: overlayData{idle: []collector.IdleInterval{{StartTime: 1, EndTime: 2}}},
+			want: []string{overlayIdle},
+		},
+		{
+			name: "all in toggle order",
+			data: overlayData{
+				idle:     []collector.IdleInterval{{StartTime: 1, EndTime: 2}},
+				throttle: []collector.ThrottleEvent{{StartTime: 1, EndTime: 2}},
+				sleep:    []collector.PowerStateEvent{{StartTime: 1, EndTime: 2}},
+			},
+			want: []string{overlaySleep, overlayThrottle, overlayIdle},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := availableOverlays(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("availableOverlays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// regressionNotice is the overview banner text for an active idle power
+// regression, e.g. "Idle power is up 50% (4.0 W → 6.0 W) for 2h". It returns
+// "" when r is nil or has cleared.
+func regressionNotice(r *collector.PowerRegression, now time.Time) string {
+	if r == nil || !r.Active || r.BaselineUW <= 0 {
+		return ""
+	}
+	pct := int((float64(r.PowerUW)/float64(r.BaselineUW) - 1) * 100)
+	return fmt.Sprintf("Idle power is up %d%% (%.1f W → %.1f W) for %s",
+		pct, float64(r.BaselineUW)/1e6, float64(r.PowerUW)/1e6, formatAge(now.Sub(time.Unix(r.StartTime, 0))))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestRegressionNotice(t *testing.T) {
+	now := time.Unix(10_000, 0)
+	tests := []struct {
+		name string
+		r    *collector.PowerRegression
+		want string
+	}{
+		{name: "none", r: nil, want: ""},
+		{name: "cleared", r: &collector.PowerRegression{Active: false, BaselineUW: 4_000_000, PowerUW: 4_100_000}, want: ""},
+		{
+			name: "active",
+			r:    &collector.PowerRegression{Active: true, StartTime: 10_000 - 7200, BaselineUW: 4_000_000, PowerUW: 6_000_000},
+			want: "Idle power is up 50% (4.0 W → 6.0 W) for 2h",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regressionNotice(tt.r, now); got != tt.want {
+				t.Errorf("regressionNotice() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,17 +15,77 @@ type settingsPage struct {
 
 	dbPathEntry       *gtk.Entry
 	stateLogPathEntry *gtk.Entry
+	archiveDirEntry   *gtk.Entry
+	maxSleepDaysSpin  *gtk.SpinButton
+	commitSecsSpin    *gtk.SpinButton
+	commitRowsSpin    *gtk.SpinButton
+	tmpfsDirEntry     *gtk.Entry
+	snapshotSpin      *gtk.SpinButton
+	onCorruptionDrop  *gtk.DropDown
 
 	intervalSpin      *gtk.SpinButton
 	topProcessesSpin  *gtk.SpinButton
 	wallClockSpin     *gtk.SpinButton
 	powerAverageSpin  *gtk.SpinButton
+	powerSmoothSpin   *gtk.SpinButton
+	powerRoundSpin    *gtk.SpinButton
+	procWorkersSpin   *gtk.SpinButton
+	preferSysfsSwitch *gtk.Switch
+	powerQuantityDrop *gtk.DropDown
+	whBasisDrop       *gtk.DropDown
+	refineModelSwitch *gtk.Switch
+	processesSwitch   *gtk.Switch
+	onlyBatterySwitch *gtk.Switch
+	backlightEntry    *gtk.Entry
+	batteryEntry      *gtk.Entry
+	pCoreLabelEntry   *gtk.Entry
+	eCoreLabelEntry   *gtk.Entry
+	freqChangeSpin    *gtk.SpinButton
+	freqHeartbeatSpin *gtk.SpinButton
+	busyIntervalSpin  *gtk.SpinButton
+	busyExponentSpin  *gtk.SpinButton
+	freqExponentSpin  *gtk.SpinButton
 	retentionDaysSpin *gtk.SpinButton
+	busyRetentionSpin *gtk.SpinButton
 	cleanupHoursSpin  *gtk.SpinButton
+	maxDeleteSpin     *gtk.SpinButton
+
+	spikesSwitch      *gtk.Switch
+	spikeWattsSpin    *gtk.SpinButton
+	acSwitch          *gtk.Switch
+	sleepSwitch       *gtk.Switch
+	calibrationSwitch *gtk.Switch
+	capacitySwitch    *gtk.Switch
+	capacityDropSpin  *gtk.SpinButton
+	debugDumpSwitch   *gtk.Switch
+	derivedBuffer     *gtk.TextBuffer
+
+	refreshDropDown *gtk.DropDown
 
 	statusLabel *gtk.Label
 }
 
+// onCorruptionModes are the storage.on_corruption values in drop-down order,
+// labelled by onCorruptionLabels.
+var (
+	onCorruptionModes  = []string{pmconfig.OnCorruptionRecover, pmconfig.OnCorruptionFail}
+	onCorruptionLabels = []string{"Move aside and start fresh", "Stop the daemon"}
+)
+
+// powerQuantities are the collection.power_quantity values in drop-down
+// order, labelled by powerQuantityLabels.
+var (
+	powerQuantities     = []string{pmconfig.PowerQuantityAuto, pmconfig.PowerQuantityCharge, pmconfig.PowerQuantityEnergy}
+	powerQuantityLabels = []string{"Automatic", "Charge", "Energy"}
+)
+
+// whBases are the collection.wh_voltage_basis values in drop-down order,
+// labelled by whBasisLabels.
+var (
+	whBases       = []string{pmconfig.WhBasisMinDesign, pmconfig.WhBasisNominal}
+	whBasisLabels = []string{"Minimum design voltage", "Nominal voltage"}
+)
+
 func newSettingsPage() *settingsPage {
 	p := &settingsPage{}
 
@@ -46,6 +106,36 @@ func newSettingsPage() *settingsPage {
 	p.stateLogPathEntry = gtk.NewEntry()
 	storageGroup.Add(makeEntryRow("Database Path", p.dbPathEntry))
 	storageGroup.Add(makeEntryRow("State Log Path", p.stateLogPathEntry))
+	p.archiveDirEntry = gtk.NewEntry()
+	p.archiveDirEntry.SetPlaceholderText("off")
+	archiveRow := makeEntryRow("State Log Archive Directory", p.archiveDirEntry)
+	archiveRow.SetSubtitle("Keep a copy of each consumed sleep state log, for bug reports about sleep accounting")
+	storageGroup.Add(archiveRow)
+	p.maxSleepDaysSpin = newConfigSpin(1, 3650, 1)
+	maxSleepRow := makeSpinRow("Max Sleep Duration (days)", p.maxSleepDaysSpin)
+	maxSleepRow.SetSubtitle("Longer sleeps are cut to this and marked as uncertain")
+	storageGroup.Add(maxSleepRow)
+	p.commitSecsSpin = newConfigSpin(0, 3600, 1)
+	commitRow := makeSpinRow("Commit Interval (seconds)", p.commitSecsSpin)
+	commitRow.SetSubtitle("Batch sample writes into one commit this often; 0 writes every cycle")
+	storageGroup.Add(commitRow)
+	p.commitRowsSpin = newConfigSpin(1, 100000, 100)
+	storageGroup.Add(makeSpinRow("Commit After Rows", p.commitRowsSpin))
+	p.tmpfsDirEntry = gtk.NewEntry()
+	p.tmpfsDirEntry.SetPlaceholderText("off")
+	tmpfsRow := makeEntryRow("Live Database Directory (tmpfs)", p.tmpfsDirEntry)
+	tmpfsRow.SetSubtitle("Keep the database in RAM, e.g. /dev/shm/power-monitor, to spare the disk. A crash loses data since the last snapshot.")
+	storageGroup.Add(tmpfsRow)
+	p.snapshotSpin = newConfigSpin(1, 1440, 1)
+	snapshotRow := makeSpinRow("Snapshot Interval (minutes)", p.snapshotSpin)
+	snapshotRow.SetSubtitle("How often the RAM database is saved to the database path")
+	storageGroup.Add(snapshotRow)
+	p.onCorruptionDrop = gtk.NewDropDownFromStrings(onCorruptionLabels)
+	p.onCorruptionDrop.SetVAlign(gtk.AlignCenter)
+	corruptionRow := adw.NewActionRow()
+	corruptionRow.SetTitle("On Database Corruption")
+	corruptionRow.AddSuffix(p.onCorruptionDrop)
+	storageGroup.Add(corruptionRow)
 	p.container.Append(storageGroup)
 
 	collectionGroup := adw.NewPreferencesGroup()
@@ -54,20 +144,140 @@ func newSettingsPage() *settingsPage {
 	p.topProcessesSpin = newConfigSpin(1, 200, 1)
 	p.wallClockSpin = newConfigSpin(1, 3600, 1)
 	p.powerAverageSpin = newConfigSpin(1, 3600, 1)
+	p.procWorkersSpin = newConfigSpin(1, 64, 1)
 	collectionGroup.Add(makeSpinRow("Interval (seconds)", p.intervalSpin))
 	collectionGroup.Add(makeSpinRow("Top Processes", p.topProcessesSpin))
 	collectionGroup.Add(makeSpinRow("Wall Clock Jump Threshold (seconds)", p.wallClockSpin))
 	collectionGroup.Add(makeSpinRow("Power Average Window (seconds)", p.powerAverageSpin))
+	p.powerSmoothSpin = newConfigSpin(0, 3600, 1)
+	smoothedRow := makeSpinRow("Smoothed Power Window (seconds)", p.powerSmoothSpin)
+	smoothedRow.SetSubtitle("Longer average shown live; 0 turns it off")
+	collectionGroup.Add(smoothedRow)
+	p.powerRoundSpin = newConfigSpin(0, 1000, 1)
+	roundRow := makeSpinRow("Power Rounding (mW)", p.powerRoundSpin)
+	roundRow.SetSubtitle("Round stored power readings to this step; 0 keeps full precision")
+	collectionGroup.Add(roundRow)
+	collectionGroup.Add(makeSpinRow("Process Scan Workers", p.procWorkersSpin))
+	p.preferSysfsSwitch = gtk.NewSwitch()
+	p.preferSysfsSwitch.SetVAlign(gtk.AlignCenter)
+	preferSysfsRow := adw.NewActionRow()
+	preferSysfsRow.SetTitle("Prefer Instantaneous Power")
+	preferSysfsRow.SetSubtitle("Use the battery's power_now reading instead of the charge-delta average. Lower latency, but only accurate on some hardware.")
+	preferSysfsRow.AddSuffix(p.preferSysfsSwitch)
+	preferSysfsRow.SetActivatableWidget(p.preferSysfsSwitch)
+	collectionGroup.Add(preferSysfsRow)
+	p.powerQuantityDrop = gtk.NewDropDownFromStrings(powerQuantityLabels)
+	p.powerQuantityDrop.SetVAlign(gtk.AlignCenter)
+	quantityRow := adw.NewActionRow()
+	quantityRow.SetTitle("Averaged Power From")
+	quantityRow.SetSubtitle("For batteries reporting both charge and energy. Automatic uses energy under heavy load and charge otherwise.")
+	quantityRow.AddSuffix(p.powerQuantityDrop)
+	collectionGroup.Add(quantityRow)
+	p.whBasisDrop = gtk.NewDropDownFromStrings(whBasisLabels)
+	p.whBasisDrop.SetVAlign(gtk.AlignCenter)
+	whBasisRow := adw.NewActionRow()
+	whBasisRow.SetTitle("Capacity Wh Voltage")
+	whBasisRow.SetSubtitle("Voltage battery capacities in mAh are converted to Wh at. Nominal matches the Wh printed on most batteries.")
+	whBasisRow.AddSuffix(p.whBasisDrop)
+	collectionGroup.Add(whBasisRow)
+	p.refineModelSwitch = gtk.NewSwitch()
+	p.refineModelSwitch.SetVAlign(gtk.AlignCenter)
+	refineModelRow := adw.NewActionRow()
+	refineModelRow.SetTitle("Refine Display Model")
+	refineModelRow.SetSubtitle("Learn display power from brightness changes during steady use on battery. Slower to converge than a calibration run, but needs no setup. Applies after a daemon restart.")
+	refineModelRow.AddSuffix(p.refineModelSwitch)
+	refineModelRow.SetActivatableWidget(p.refineModelSwitch)
+	collectionGroup.Add(refineModelRow)
+	p.processesSwitch = gtk.NewSwitch()
+	p.processesSwitch.SetVAlign(gtk.AlignCenter)
+	processesRow := adw.NewActionRow()
+	processesRow.SetTitle("Collect Processes")
+	processesRow.SetSubtitle("Record the busiest processes, their command lines and CPU frequencies. When off, process collection is disabled and nothing about running programs is stored.")
+	processesRow.AddSuffix(p.processesSwitch)
+	processesRow.SetActivatableWidget(p.processesSwitch)
+	collectionGroup.Add(processesRow)
+	p.onlyBatterySwitch = gtk.NewSwitch()
+	p.onlyBatterySwitch.SetVAlign(gtk.AlignCenter)
+	onlyBatteryRow := adw.NewActionRow()
+	onlyBatteryRow.SetTitle("Collect Processes Only on Battery")
+	onlyBatteryRow.SetSubtitle("Pause process and CPU frequency collection while plugged in. Battery and brightness are still recorded.")
+	onlyBatteryRow.AddSuffix(p.onlyBatterySwitch)
+	onlyBatteryRow.SetActivatableWidget(p.onlyBatterySwitch)
+	collectionGroup.Add(onlyBatteryRow)
+	p.freqChangeSpin = newConfigSpin(0, 10000000, 1000)
+	p.freqHeartbeatSpin = newConfigSpin(1, 86400, 1)
+	collectionGroup.Add(makeSpinRow("CPU Frequency Change Threshold (kHz, 0 = off)", p.freqChangeSpin))
+	collectionGroup.Add(makeSpinRow("CPU Frequency Heartbeat (seconds)", p.freqHeartbeatSpin))
+	p.busyIntervalSpin = newConfigSpin(0, 3600, 1)
+	p.busyExponentSpin = newConfigSpin(25, 400, 5)
+	collectionGroup.Add(makeSpinRow("CPU Busy Sample Interval (seconds, 0 = off)", p.busyIntervalSpin))
+	collectionGroup.Add(makeSpinRow("CPU Busy Weighting Exponent (%)", p.busyExponentSpin))
+	p.freqExponentSpin = newConfigSpin(0, 400, 5)
+	collectionGroup.Add(makeSpinRow("CPU Frequency Power Exponent (%, 0 = off)", p.freqExponentSpin))
+	p.backlightEntry = gtk.NewEntry()
+	p.backlightEntry.SetPlaceholderText("internal panel")
+	p.batteryEntry = gtk.NewEntry()
+	p.batteryEntry.SetPlaceholderText("BAT*")
+	collectionGroup.Add(makeEntryRow("Backlight Device (name or glob)", p.backlightEntry))
+	collectionGroup.Add(makeEntryRow("Battery Device (name or glob)", p.batteryEntry))
+	p.pCoreLabelEntry = gtk.NewEntry()
+	p.eCoreLabelEntry = gtk.NewEntry()
+	collectionGroup.Add(makeEntryRow("Performance Core Label", p.pCoreLabelEntry))
+	collectionGroup.Add(makeEntryRow("Efficiency Core Label", p.eCoreLabelEntry))
 	p.container.Append(collectionGroup)
 
 	cleanupGroup := adw.NewPreferencesGroup()
 	cleanupGroup.SetTitle("Cleanup")
 	p.retentionDaysSpin = newConfigSpin(1, 3650, 1)
 	p.cleanupHoursSpin = newConfigSpin(1, 720, 1)
+	p.maxDeleteSpin = newConfigSpin(1, 100, 1)
+	p.busyRetentionSpin = newConfigSpin(1, 3650, 1)
 	cleanupGroup.Add(makeSpinRow("Retention (days)", p.retentionDaysSpin))
+	cleanupGroup.Add(makeSpinRow("CPU Busy Retention (days)", p.busyRetentionSpin))
 	cleanupGroup.Add(makeSpinRow("Cleanup Interval (hours)", p.cleanupHoursSpin))
+	cleanupGroup.Add(makeSpinRow("Max Rows Deleted per Cleanup (%)", p.maxDeleteSpin))
 	p.container.Append(cleanupGroup)
 
+	annotationsGroup := adw.NewPreferencesGroup()
+	annotationsGroup.SetTitle("Automatic Annotations")
+	annotationsGroup.SetDescription("Mark notable events on the graphs. Existing annotations are kept when a detector is turned off.")
+	p.spikesSwitch = gtk.NewSwitch()
+	annotationsGroup.Add(makeSwitchRow("Power Spikes", "Draw on battery rising to the threshold below.", p.spikesSwitch))
+	p.spikeWattsSpin = newConfigSpin(1, 1000, 1)
+	annotationsGroup.Add(makeSpinRow("Power Spike Threshold (W)", p.spikeWattsSpin))
+	p.acSwitch = gtk.NewSwitch()
+	annotationsGroup.Add(makeSwitchRow("AC Transitions", "Plugging in and unplugging the charger.", p.acSwitch))
+	p.sleepSwitch = gtk.NewSwitch()
+	annotationsGroup.Add(makeSwitchRow("Suspend and Resume", "Where each sleep or shutdown began and ended.", p.sleepSwitch))
+	p.calibrationSwitch = gtk.NewSwitch()
+	annotationsGroup.Add(makeSwitchRow("Calibration Runs", "Display calibrations started from this app.", p.calibrationSwitch))
+	p.capacitySwitch = gtk.NewSwitch()
+	annotationsGroup.Add(makeSwitchRow("Capacity Drops", "Full-charge capacity falling by the percentage below.", p.capacitySwitch))
+	p.capacityDropSpin = newConfigSpin(1, 100, 1)
+	annotationsGroup.Add(makeSpinRow("Capacity Drop Threshold (%)", p.capacityDropSpin))
+	p.container.Append(annotationsGroup)
+
+	debugGroup := adw.NewPreferencesGroup()
+	debugGroup.SetTitle("Debugging")
+	p.debugDumpSwitch = gtk.NewSwitch()
+	debugGroup.Add(makeSwitchRow("Allow Debug Dump", "Let any user read the collectors' internal state with the DebugDump D-Bus method.", p.debugDumpSwitch))
+	p.container.Append(debugGroup)
+
+	derivedGroup := adw.NewPreferencesGroup()
+	derivedGroup.SetTitle("Derived Series")
+	derivedGroup.SetDescription("One per line as name = expression, over power, display_est and cpu_est in watts, e.g. residual = power - display_est - cpu_est")
+	derivedView := gtk.NewTextView()
+	derivedView.SetMonospace(true)
+	derivedView.SetTopMargin(6)
+	derivedView.SetBottomMargin(6)
+	derivedView.SetLeftMargin(6)
+	derivedView.SetRightMargin(6)
+	derivedView.AddCSSClass("card")
+	derivedView.SetSizeRequest(-1, 80)
+	p.derivedBuffer = derivedView.Buffer()
+	derivedGroup.Add(derivedView)
+	p.container.Append(derivedGroup)
+
 	actions := gtk.NewBox(gtk.OrientationHorizontal, 8)
 	reloadBtn := gtk.NewButtonWithLabel("Reload")
 	saveBtn := gtk.NewButtonWithLabel("Save")
@@ -82,6 +292,84 @@ func newSettingsPage() *settingsPage {
 	p.statusLabel.AddCSSClass("dim-label")
 	p.container.Append(p.statusLabel)
 
+	// GUI preferences apply immediately and are stored locally, not in the
+	// daemon config.
+	guiGroup := adw.NewPreferencesGroup()
+	guiGroup.SetTitle("Display")
+	labels := make([]string, len(refreshIntervals))
+	for i, ri := range refreshIntervals {
+		labels[i] = ri.Label
+	}
+	p.refreshDropDown = gtk.NewDropDownFromStrings(labels)
+	p.refreshDropDown.SetVAlign(gtk.AlignCenter)
+	if idx := refreshIntervalIndex(refreshIntervalMs); idx >= 0 {
+		p.refreshDropDown.SetSelected(uint(idx))
+	}
+	p.refreshDropDown.NotifyProperty("selected", func() {
+		idx := int(p.refreshDropDown.Selected())
+		if idx >= 0 && idx < len(refreshIntervals) {
+			setRefreshInterval(refreshIntervals[idx].Ms)
+		}
+	})
+	refreshRow := adw.NewActionRow()
+	refreshRow.SetTitle("Refresh Interval")
+	refreshRow.AddSuffix(p.refreshDropDown)
+	guiGroup.Add(refreshRow)
+
+	smoothSwitch := gtk.NewSwitch()
+	smoothSwitch.SetVAlign(gtk.AlignCenter)
+	smoothSwitch.SetActive(smoothPower)
+	smoothSwitch.NotifyProperty("active", func() {
+		smoothPower = smoothSwitch.Active()
+		refreshData()
+	})
+	smoothRow := adw.NewActionRow()
+	smoothRow.SetTitle("Smooth Current Power")
+	smoothRow.SetSubtitle("Show a moving average instead of the latest reading")
+	smoothRow.AddSuffix(smoothSwitch)
+	smoothRow.SetActivatableWidget(smoothSwitch)
+	guiGroup.Add(smoothRow)
+
+	baselineSwitch := gtk.NewSwitch()
+	baselineSwitch.SetVAlign(gtk.AlignCenter)
+	baselineSwitch.SetActive(subtractBaseline)
+	baselineSwitch.NotifyProperty("active", func() {
+		subtractBaseline = baselineSwitch.Active()
+		refreshData()
+	})
+	baselineRow := adw.NewActionRow()
+	baselineRow.SetTitle("Subtract Idle Baseline")
+	baselineRow.SetSubtitle("Chart energy use above the calibrated display-off power")
+	if calib == nil {
+		baselineRow.SetSubtitle("Requires a display calibration")
+	}
+	baselineRow.AddSuffix(baselineSwitch)
+	baselineRow.SetActivatableWidget(baselineSwitch)
+	guiGroup.Add(baselineRow)
+
+	dischargeSwitch := gtk.NewSwitch()
+	dischargeSwitch.SetVAlign(gtk.AlignCenter)
+	dischargeSwitch.SetActive(dischargeOnly)
+	dischargeSwitch.NotifyProperty("active", func() {
+		dischargeOnly = dischargeSwitch.Active()
+		refreshData()
+	})
+	dischargeRow := adw.NewActionRow()
+	dischargeRow.SetTitle("Discharge-Only Energy Graph")
+	dischargeRow.SetSubtitle("Chart only power drawn on battery and blank charging periods")
+	dischargeRow.AddSuffix(dischargeSwitch)
+	dischargeRow.SetActivatableWidget(dischargeSwitch)
+	guiGroup.Add(dischargeRow)
+
+	fillSpin := newConfigSpin(0, 100, 5)
+	fillSpin.SetValue(float64(fillOpacityPct))
+	fillSpin.ConnectValueChanged(func() {
+		fillOpacityPct = fillSpin.ValueAsInt()
+		battGraph.area.QueueDraw()
+	})
+	guiGroup.Add(makeSpinRow("Battery Fill Opacity (%)", fillSpin))
+	p.container.Append(guiGroup)
+
 	reloadBtn.ConnectClicked(func() {
 		p.loadConfig()
 	})
@@ -114,6 +402,16 @@ func makeSpinRow(title string, spin *gtk.SpinButton) *adw.ActionRow {
 	return row
 }
 
+func makeSwitchRow(title, subtitle string, sw *gtk.Switch) *adw.ActionRow {
+	sw.SetVAlign(gtk.AlignCenter)
+	row := adw.NewActionRow()
+	row.SetTitle(title)
+	row.SetSubtitle(subtitle)
+	row.AddSuffix(sw)
+	row.SetActivatableWidget(sw)
+	return row
+}
+
 func makeEntryRow(title string, entry *gtk.Entry) *adw.ActionRow {
 	row := adw.NewActionRow()
 	row.SetTitle(title)
@@ -137,24 +435,122 @@ func (p *settingsPage) loadConfig() {
 func (p *settingsPage) applyConfig(cfg *pmconfig.Config) {
 	p.dbPathEntry.SetText(cfg.Storage.DBPath)
 	p.stateLogPathEntry.SetText(cfg.Storage.StateLogPath)
+	p.archiveDirEntry.SetText(cfg.Storage.StateLogArchiveDir)
+	p.maxSleepDaysSpin.SetValue(float64(cfg.Storage.MaxSleepDays))
+	p.commitSecsSpin.SetValue(float64(cfg.Storage.CommitIntervalSeconds))
+	p.commitRowsSpin.SetValue(float64(cfg.Storage.CommitMaxRows))
+	p.tmpfsDirEntry.SetText(cfg.Storage.TmpfsDir)
+	p.snapshotSpin.SetValue(float64(cfg.Storage.SnapshotIntervalMinutes))
+	p.onCorruptionDrop.SetSelected(0)
+	for i, mode := range onCorruptionModes {
+		if mode == cfg.Storage.OnCorruption {
+			p.onCorruptionDrop.SetSelected(uint(i))
+		}
+	}
 	p.intervalSpin.SetValue(float64(cfg.Collection.IntervalSeconds))
 	p.topProcessesSpin.SetValue(float64(cfg.Collection.TopProcesses))
 	p.wallClockSpin.SetValue(float64(cfg.Collection.WallClockJumpThresholdSeconds))
 	p.powerAverageSpin.SetValue(float64(cfg.Collection.PowerAverageSeconds))
+	p.powerSmoothSpin.SetValue(float64(cfg.Collection.PowerSmoothedSeconds))
+	p.powerRoundSpin.SetValue(float64(cfg.Collection.PowerRoundingMW))
+	p.procWorkersSpin.SetValue(float64(cfg.Collection.ProcScanWorkers))
+	p.preferSysfsSwitch.SetActive(cfg.Collection.PreferSysfsPower)
+	p.whBasisDrop.SetSelected(0)
+	for i, b := range whBases {
+		if b == cfg.Collection.WhVoltageBasis {
+			p.whBasisDrop.SetSelected(uint(i))
+		}
+	}
+	p.powerQuantityDrop.SetSelected(0)
+	for i, q := range powerQuantities {
+		if q == cfg.Collection.PowerQuantity {
+			p.powerQuantityDrop.SetSelected(uint(i))
+		}
+	}
+	p.refineModelSwitch.SetActive(cfg.Collection.RefineDisplayModel)
+	p.processesSwitch.SetActive(cfg.Collection.ProcessesEnabled)
+	p.onlyBatterySwitch.SetActive(cfg.Collection.OnlyOnBattery)
+	p.freqChangeSpin.SetValue(float64(cfg.Collection.CPUFreqChangeKHz))
+	p.freqHeartbeatSpin.SetValue(float64(cfg.Collection.CPUFreqHeartbeatSeconds))
+	p.busyIntervalSpin.SetValue(float64(cfg.Collection.CPUBusyIntervalSeconds))
+	p.busyExponentSpin.SetValue(float64(cfg.Collection.CPUBusyExponentPercent))
+	p.freqExponentSpin.SetValue(float64(cfg.Collection.FreqPowerExponentPercent))
+	p.backlightEntry.SetText(cfg.Collection.BacklightDevice)
+	p.batteryEntry.SetText(cfg.Collection.BatteryDevice)
+	p.pCoreLabelEntry.SetText(cfg.Collection.PCoreLabel)
+	p.eCoreLabelEntry.SetText(cfg.Collection.ECoreLabel)
 	p.retentionDaysSpin.SetValue(float64(cfg.Cleanup.RetentionDays))
+	p.busyRetentionSpin.SetValue(float64(cfg.Cleanup.CPUBusyRetentionDays))
 	p.cleanupHoursSpin.SetValue(float64(cfg.Cleanup.IntervalHours))
+	p.maxDeleteSpin.SetValue(float64(cfg.Cleanup.MaxDeletePercent))
+	p.spikesSwitch.SetActive(cfg.Annotations.PowerSpikes)
+	p.spikeWattsSpin.SetValue(float64(cfg.Annotations.PowerSpikeWatts))
+	p.acSwitch.SetActive(cfg.Annotations.ACTransitions)
+	p.sleepSwitch.SetActive(cfg.Annotations.SuspendResume)
+	p.calibrationSwitch.SetActive(cfg.Annotations.CalibrationRuns)
+	p.capacitySwitch.SetActive(cfg.Annotations.CapacityDrops)
+	p.capacityDropSpin.SetValue(float64(cfg.Annotations.CapacityDropPercent))
+	p.debugDumpSwitch.SetActive(cfg.Debug.DumpEnabled)
+	p.derivedBuffer.SetText(formatDerivedSeries(cfg.Derived.Series))
 }
 
 func (p *settingsPage) saveConfig() error {
 	cfg := &pmconfig.Config{}
 	cfg.Storage.DBPath = strings.TrimSpace(p.dbPathEntry.Text())
 	cfg.Storage.StateLogPath = strings.TrimSpace(p.stateLogPathEntry.Text())
+	cfg.Storage.StateLogArchiveDir = strings.TrimSpace(p.archiveDirEntry.Text())
+	cfg.Storage.MaxSleepDays = p.maxSleepDaysSpin.ValueAsInt()
+	cfg.Storage.CommitIntervalSeconds = p.commitSecsSpin.ValueAsInt()
+	cfg.Storage.CommitMaxRows = p.commitRowsSpin.ValueAsInt()
+	cfg.Storage.TmpfsDir = strings.TrimSpace(p.tmpfsDirEntry.Text())
+	cfg.Storage.SnapshotIntervalMinutes = p.snapshotSpin.ValueAsInt()
+	if idx := int(p.onCorruptionDrop.Selected()); idx >= 0 && idx < len(onCorruptionModes) {
+		cfg.Storage.OnCorruption = onCorruptionModes[idx]
+	}
 	cfg.Collection.IntervalSeconds = p.intervalSpin.ValueAsInt()
 	cfg.Collection.TopProcesses = p.topProcessesSpin.ValueAsInt()
 	cfg.Collection.WallClockJumpThresholdSeconds = p.wallClockSpin.ValueAsInt()
 	cfg.Collection.PowerAverageSeconds = p.powerAverageSpin.ValueAsInt()
+	cfg.Collection.PowerSmoothedSeconds = p.powerSmoothSpin.ValueAsInt()
+	cfg.Collection.PowerRoundingMW = p.powerRoundSpin.ValueAsInt()
+	cfg.Collection.ProcScanWorkers = p.procWorkersSpin.ValueAsInt()
+	cfg.Collection.PreferSysfsPower = p.preferSysfsSwitch.Active()
+	if idx := int(p.powerQuantityDrop.Selected()); idx >= 0 && idx < len(powerQuantities) {
+		cfg.Collection.PowerQuantity = powerQuantities[idx]
+	}
+	if idx := int(p.whBasisDrop.Selected()); idx >= 0 && idx < len(whBases) {
+		cfg.Collection.WhVoltageBasis = whBases[idx]
+	}
+	cfg.Collection.RefineDisplayModel = p.refineModelSwitch.Active()
+	cfg.Collection.ProcessesEnabled = p.processesSwitch.Active()
+	cfg.Collection.OnlyOnBattery = p.onlyBatterySwitch.Active()
+	cfg.Collection.CPUFreqChangeKHz = p.freqChangeSpin.ValueAsInt()
+	cfg.Collection.CPUFreqHeartbeatSeconds = p.freqHeartbeatSpin.ValueAsInt()
+	cfg.Collection.CPUBusyIntervalSeconds = p.busyIntervalSpin.ValueAsInt()
+	cfg.Collection.CPUBusyExponentPercent = p.busyExponentSpin.ValueAsInt()
+	cfg.Collection.FreqPowerExponentPercent = p.freqExponentSpin.ValueAsInt()
+	cfg.Collection.BacklightDevice = strings.TrimSpace(p.backlightEntry.Text())
+	cfg.Collection.BatteryDevice = strings.TrimSpace(p.batteryEntry.Text())
+	cfg.Collection.PCoreLabel = strings.TrimSpace(p.pCoreLabelEntry.Text())
+	cfg.Collection.ECoreLabel = strings.TrimSpace(p.eCoreLabelEntry.Text())
 	cfg.Cleanup.RetentionDays = p.retentionDaysSpin.ValueAsInt()
+	cfg.Cleanup.CPUBusyRetentionDays = p.busyRetentionSpin.ValueAsInt()
 	cfg.Cleanup.IntervalHours = p.cleanupHoursSpin.ValueAsInt()
+	cfg.Cleanup.MaxDeletePercent = p.maxDeleteSpin.ValueAsInt()
+	cfg.Annotations.PowerSpikes = p.spikesSwitch.Active()
+	cfg.Annotations.PowerSpikeWatts = p.spikeWattsSpin.ValueAsInt()
+	cfg.Annotations.ACTransitions = p.acSwitch.Active()
+	cfg.Annotations.SuspendResume = p.sleepSwitch.Active()
+	cfg.Annotations.CalibrationRuns = p.calibrationSwitch.Active()
+	cfg.Annotations.CapacityDrops = p.capacitySwitch.Active()
+	cfg.Annotations.CapacityDropPercent = p.capacityDropSpin.ValueAsInt()
+	cfg.Debug.DumpEnabled = p.debugDumpSwitch.Active()
+	start, end := p.derivedBuffer.Bounds()
+	series, err := parseDerivedSeries(p.derivedBuffer.Text(start, end, false))
+	if err != nil {
+		return err
+	}
+	cfg.Derived.Series = series
 
 	sanitized, err := pmconfig.NormalizeAndValidate(cfg)
 	if err != nil {
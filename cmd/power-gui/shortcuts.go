@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/diamondburned/gotk4/pkg/glib/v2"
+	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+)
+
+// installShortcuts adds window-wide keyboard shortcuts: Ctrl+R refreshes
+// immediately and 1–6 select the matching time range.
+func installShortcuts(win gtk.Widgetter, timeBar *timeRangeBar) {
+	ctrl := gtk.NewShortcutController()
+	ctrl.SetScope(gtk.ShortcutScopeManaged)
+
+	add := func(trigger string, fn func()) {
+		ctrl.AddShortcut(gtk.NewShortcut(
+			gtk.NewShortcutTriggerParseString(trigger),
+			gtk.NewCallbackAction(func(gtk.Widgetter, *glib.Variant) bool {
+				fn()
+				return true
+			}),
+		))
+	}
+
+	add("<Control>r", refreshData)
+	for i := range timeRanges {
+		idx := i
+		add(fmt.Sprintf("%d", i+1), func() { timeBar.Select(idx) })
+	}
+
+	gtk.BaseWidget(win).AddController(ctrl)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// sleepSegment is one shaded span of a power state event on the graphs.
+type sleepSegment struct {
+	start, end int64
+	hibernate  bool
+}
+
+// sleepSegments splits a power state event into the spans to shade. A
+// suspend-then-hibernate event with both phase durations becomes a suspend
+// span followed by a hibernate span; every other event is a single span.
+func sleepSegments(ev collector.PowerStateEvent) []sleepSegment {
+	if ev.Type == "suspend-then-hibernate" && ev.SuspendSecs > 0 && ev.HibernateSecs > 0 {
+		split := min(ev.StartTime+ev.SuspendSecs, ev.EndTime)
+		return []sleepSegment{
+			{start: ev.StartTime, end: split},
+			{start: split, end: ev.EndTime, hibernate: true},
+		}
+	}
+	return []sleepSegment{{start: ev.StartTime, end: ev.EndTime, hibernate: ev.Type == "hibernate"}}
+}
+
+// sleepLabel returns the text drawn over a power state event's region, with
+// the suspend mode when it was recorded so s2idle stands out from deep sleep.
+func sleepLabel(ev collector.PowerStateEvent) string {
+	var label string
+	switch ev.Type {
+	case "hibernate":
+		return "Hibernate"
+	case "suspend-then-hibernate":
+		label = "Sleep → Hibernate"
+	case "hybrid-sleep":
+		label = "Hybrid Sleep"
+	default:
+		label = "Sleep"
+	}
+	if ev.Subtype != "" {
+		label += " (" + ev.Subtype + ")"
+	}
+	return label
+}
+
+// sleepDrainLabel returns the battery used during a sleep, e.g. "drained 4%
+// in 8h", "duration uncertain" for a clamped event, or "" when the drain is
+// unknown.
+func sleepDrainLabel(ev collector.PowerStateEvent) string {
+	if ev.Suspect {
+		return "duration uncertain"
+	}
+	if !ev.DrainKnown {
+		return ""
+	}
+	span := sleepSpan(ev.EndTime - ev.StartTime)
+	if ev.DrainPct < 0 {
+		return fmt.Sprintf("gained %d%% in %s", -ev.DrainPct, span)
+	}
+	return fmt.Sprintf("drained %d%% in %s", ev.DrainPct, span)
+}
+
+// sleepSpan renders a sleep duration compactly: "20m", "1.5h" or "12h".
+func sleepSpan(secs int64) string {
+	switch {
+	case secs < 3600:
+		return fmt.Sprintf("%dm", secs/60)
+	case secs < 10*3600:
+		return fmt.Sprintf("%gh", math.Round(float64(secs)/360)/10)
+	default:
+		return fmt.Sprintf("%dh", secs/3600)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestSleepSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		ev   collector.PowerStateEvent
+		want []sleepSegment
+	}{
+		{
+			name: "suspend",
+			ev:   collector.PowerStateEvent{StartTime: 100, EndTime: 200, Type: "suspend", SuspendSecs: 100},
+			want: []sleepSegment{{start: 100, end: 200}},
+		},
+		{
+			name: "hibernate",
+			ev:   collector.PowerStateEvent{StartTime: 100, EndTime: 200, Type: "hibernate", HibernateSecs: 100},
+			want: []sleepSegment{{start: 100, end: 200, hibernate: true}},
+		},
+		{
+			name: "suspend-then-hibernate splits at suspend duration",
+			ev:   collector.PowerStateEvent{StartTime: 100, EndTime: 400, Type: "suspend-then-hibernate", SuspendSecs: 120, HibernateSecs: 180},
+			want: []sleepSegment{{start: 100, end: 220}, {start: 220, end: 400, hibernate: true}},
+		},
+		{
+			name: "suspend phase longer than event is clamped",
+			ev:   collector.PowerStateEvent{StartTime: 100, EndTime: 200, Type: "suspend-then-hibernate", SuspendSecs: 150, HibernateSecs: 10},
+			want: []sleepSegment{{start: 100, end: 200}, {start: 200, end: 200, hibernate: true}},
+		},
+		{
+			name: "suspend-then-hibernate without breakdown",
+			ev:   collector.PowerStateEvent{StartTime: 100, EndTime: 200, Type: "suspend-then-hibernate", SuspendSecs: 100},
+			want: []sleepSegment{{start: 100, end: 200}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sleepSegments(tt.ev); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("sleepSegments() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSleepLabel(t *testing.T) {
+	for typ, want := range map[string]string{
+		"suspend":                "Sleep",
+		"hibernate":              "Hibernate",
+		"hybrid-sleep":           "Hybrid Sleep",
+		"suspend-then-hibernate": "Sleep → Hibernate",
+		"shutdown":               "Sleep",
+	} {
+		if got := sleepLabel(collector.PowerStateEvent{Type: typ}); got != want {
+			t.Fatalf("sleepLabel(%q) = %q, want %q", typ, got, want)
+		}
+	}
+}
+
+func TestSleepLabel_Subtype(t *testing.T) {
+	tests := []struct {
+		ev   collector.PowerStateEvent
+		want string
+	}{
+		{collector.PowerStateEvent{Type: "suspend", Subtype: "s2idle"}, "Sleep (s2idle)"},
+		{collector.PowerStateEvent{Type: "suspend", Subtype: "deep"}, "Sleep (deep)"},
+		{collector.PowerStateEvent{Type: "suspend-then-hibernate", Subtype: "s2idle"}, "Sleep → Hibernate (s2idle)"},
+		{collector.PowerStateEvent{Type: "hibernate", Subtype: "s2idle"}, "Hibernate"},
+	}
+	for _, tt := range tests {
+		if got := sleepLabel(tt.ev); got != tt.want {
+			t.Fatalf("sleepLabel(%+v) = %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+}
+
+func TestSleepDrainLabel(t *testing.T) {
+	tests := []struct {
+		ev   collector.PowerStateEvent
+		want string
+	}{
+		{collector.PowerStateEvent{StartTime: 0, EndTime: 8 * 3600}, ""},
+		{collector.PowerStateEvent{StartTime: 0, EndTime: 12 * 3600, DrainPct: 4, DrainKnown: true}, "drained 4% in 12h"},
+		{collector.PowerStateEvent{StartTime: 0, EndTime: 5400, DrainPct: 1, DrainKnown: true}, "drained 1% in 1.5h"},
+		{collector.PowerStateEvent{StartTime: 0, EndTime: 1200, DrainPct: 0, DrainKnown: true}, "drained 0% in 20m"},
+		{collector.PowerStateEvent{StartTime: 0, EndTime: 3600, DrainPct: -10, DrainKnown: true}, "gained 10% in 1h"},
+		{collector.PowerStateEvent{StartTime: 0, EndTime: 30 * 86400, Suspect: true}, "duration uncertain"},
+	}
+	for _, tt := range tests {
+		if got := sleepDrainLabel(tt.ev); got != tt.want {
+			t.Fatalf("sleepDrainLabel(%+v) = %q, want %q", tt.ev, got, tt.want)
+		}
+	}
+}
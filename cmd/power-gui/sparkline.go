@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// The sidebar sparkline shows the battery level over the last sparklineRange
+// from sparklineBucket-wide history buckets, refetched at most every
+// sparklineRefresh.
+const (
+	sparklineRange   = 24 * time.Hour
+	sparklineBucket  = 30 * time.Minute
+	sparklineRefresh = time.Minute
+)
+
+// sparkPoint is a sparkline vertex with both coordinates in [0, 1]: X across
+// the range, Y the battery level.
+type sparkPoint struct{ X, Y float64 }
+
+// sparklineSegments converts history buckets in [from, to) into line
+// segments, one point per non-empty bucket at its midpoint. A missing bucket,
+// e.g. during suspend, starts a new segment.
+func sparklineSegments(buckets []collector.BatteryBucket, from, to time.Time, bucket time.Duration) [][]sparkPoint {
+	span := to.Sub(from).Seconds()
+	bucketSecs := int64(bucket.Seconds())
+	if span <= 0 || bucketSecs <= 0 {
+		return nil
+	}
+
+	var segments [][]sparkPoint
+	var cur []sparkPoint
+	prevTS := int64(0)
+	for _, b := range buckets {
+		if b.Count == 0 || b.Timestamp < from.Unix() || b.Timestamp >= to.Unix() {
+			continue
+		}
+		if len(cur) > 0 && b.Timestamp-prevTS > bucketSecs {
+			segments = append(segments, cur)
+			cur = nil
+		}
+		x := (float64(b.Timestamp-from.Unix()) + float64(bucketSecs)/2) / span
+		y := min(max(b.AvgCapacityPct/100, 0), 1)
+		cur = append(cur, sparkPoint{X: min(x, 1), Y: y})
+		prevTS = b.Timestamp
+	}
+	if len(cur) > 0 {
+		segments = append(segments, cur)
+	}
+	return segments
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestSparklineSegments(t *testing.T) {
+	from := time.Unix(0, 0)
+	to := time.Unix(400, 0)
+	buckets := []collector.BatteryBucket{
+		{Timestamp: 0, Count: 3, AvgCapacityPct: 100},
+		{Timestamp: 100, Count: 3, AvgCapacityPct: 50},
+		// 200 missing: suspended
+		{Timestamp: 300, Count: 2, AvgCapacityPct: 25},
+		{Timestamp: 400, Count: 2, AvgCapacityPct: 20}, // outside the range
+	}
+
+	got := sparklineSegments(buckets, from, to, 100*time.Second)
+	want := [][]sparkPoint{
+		{{X: 0.125, Y: 1}, {X: 0.375, Y: 0.5}},
+		{{X: 0.875, Y: 0.25}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sparklineSegments() = %#v, want %#v", got, want)
+	}
+}
+
+func TestSparklineSegments_Empty(t *testing.T) {
+	from := time.Unix(0, 0)
+	if got := sparklineSegments(nil, from, from.Add(time.Hour), time.Minute); got != nil {
+		t.Fatalf("sparklineSegments(nil) = %#v, want nil", got)
+	}
+	if got := sparklineSegments([]collector.BatteryBucket{{Count: 1}}, from, from, time.Minute); got != nil {
+		t.Fatalf("sparklineSegments(empty range) = %#v, want nil", got)
+	}
+}
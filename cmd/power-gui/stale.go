@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// sampleAge returns how old a sample taken at sampleTs is, and whether it is
+// stale: older than the gap threshold for the daemon's collection interval,
+// meaning several collection cycles have been missed.
+func sampleAge(sampleTs int64, intervalSecs int, now time.Time) (age time.Duration, stale bool) {
+	age = now.Sub(time.Unix(sampleTs, 0))
+	return age, age > time.Duration(gapThresholdFor(intervalSecs))*time.Second
+}
+
+// formatStaleAge renders an age as "stale (Xs ago)", "stale (Xm ago)" or
+// "stale (Xh ago)".
+func formatStaleAge(age time.Duration) string {
+	return fmt.Sprintf("stale (%s ago)", formatAge(age))
+}
+
+// formatAge renders an age as "Xs", "Xm" or "Xh", truncated.
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(max(age, 0).Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	default:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	}
+}
+
+// noDataMessage is drawn in a graph with no samples, so a fresh install does
+// not look broken. daemonStarted is the daemon's start epoch from
+// GetCurrentStats; 0 while the daemon is unreachable returns "", leaving the
+// explanation to the refresh banner.
+func noDataMessage(daemonStarted int64, now time.Time) string {
+	if daemonStarted <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("Collecting data… (daemon started %s ago)", formatAge(now.Sub(time.Unix(daemonStarted, 0))))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSampleAge(t *testing.T) {
+	now := time.Unix(10_000, 0)
+	tests := []struct {
+		name      string
+		sampleTs  int64
+		interval  int
+		wantAge   time.Duration
+		wantStale bool
+	}{
+		{"fresh", 9_995, 5, 5 * time.Second, false},
+		{"at threshold", 9_970, 5, 30 * time.Second, false},
+		{"missed several intervals", 9_900, 5, 100 * time.Second, true},
+		{"long interval tolerates spacing", 9_900, 60, 100 * time.Second, false},
+		{"unknown interval uses default", 9_960, 0, 40 * time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			age, stale := sampleAge(tt.sampleTs, tt.interval, now)
+			if age != tt.wantAge || stale != tt.wantStale {
+				t.Fatalf("sampleAge() = (%v, %v), want (%v, %v)", age, stale, tt.wantAge, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestFormatStaleAge(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{45 * time.Second, "stale (45s ago)"},
+		{12*time.Minute + 30*time.Second, "stale (12m ago)"},
+		{3*time.Hour + 59*time.Minute, "stale (3h ago)"},
+	}
+	for _, tt := range tests {
+		if got := formatStaleAge(tt.age); got != tt.want {
+			t.Errorf("formatStaleAge(%v) = %q, want %q", tt.age, got, tt.want)
+		}
+	}
+}
+
+func TestNoDataMessage(t *testing.T) {
+	now := time.Unix(10_000, 0)
+	tests := []struct {
+		name    string
+		started int64
+		want    string
+	}{
+		{"daemon unreachable", 0, ""},
+		{"just started", 9_988, "Collecting data… (daemon started 12s ago)"},
+		{"minutes ago", 9_000, "Collecting data… (daemon started 16m ago)"},
+		{"clock behind daemon", 10_005, "Collecting data… (daemon started 0s ago)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := noDataMessage(tt.started, now); got != tt.want {
+				t.Fatalf("noDataMessage(%d) = %q, want %q", tt.started, got, tt.want)
+			}
+		})
+	}
+}
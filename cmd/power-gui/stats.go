@@ -1,9 +1,13 @@
 package main
 
 import (
+	"cmp"
 	"fmt"
+	"time"
 
 	"github.com/diamondburned/gotk4/pkg/gtk/v4"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 )
 
 type statsBar struct {
@@ -11,6 +15,7 @@ type statsBar struct {
 	batteryVal *gtk.Label
 	statusVal  *gtk.Label
 	brightVal  *gtk.Label
+	staleLabel *gtk.Label
 	container  *gtk.Box
 }
 
@@ -38,13 +43,21 @@ func newStatsBar() *statsBar {
 		return box
 	}
 
-	s.container = gtk.NewBox(gtk.OrientationHorizontal, 0)
+	values := gtk.NewBox(gtk.OrientationHorizontal, 0)
+	values.SetHomogeneous(true)
+	values.Append(mkGroup("Power", s.powerVal))
+	values.Append(mkGroup("Battery", s.batteryVal))
+	values.Append(mkGroup("Status", s.statusVal))
+	values.Append(mkGroup("Brightness", s.brightVal))
+
+	s.staleLabel = gtk.NewLabel("")
+	s.staleLabel.AddCSSClass("stat-stale")
+	s.staleLabel.SetVisible(false)
+
+	s.container = gtk.NewBox(gtk.OrientationVertical, 4)
 	s.container.AddCSSClass("stats-bar")
-	s.container.SetHomogeneous(true)
-	s.container.Append(mkGroup("Power", s.powerVal))
-	s.container.Append(mkGroup("Battery", s.batteryVal))
-	s.container.Append(mkGroup("Status", s.statusVal))
-	s.container.Append(mkGroup("Brightness", s.brightVal))
+	s.container.Append(values)
+	s.container.Append(s.staleLabel)
 
 	return s
 }
@@ -54,13 +67,73 @@ func (s *statsBar) Update(stats *currentStats) {
 		return
 	}
 	if stats.Battery != nil {
-		watts := float64(stats.Battery.PowerUW) / 1e6
-		s.powerVal.SetLabel(fmt.Sprintf("%.1f W", watts))
+		powerUW := stats.Battery.PowerUW
+		tooltip := powerSourceDescription(stats.Battery.PowerSource)
+		if smoothed := cmp.Or(stats.Battery.PowerSmoothedUW, stats.PowerEWMAUW); smoothPower && smoothed > 0 {
+			powerUW = smoothed
+			tooltip = fmt.Sprintf("Smoothed; latest reading %.1f W. %s",
+				float64(stats.Battery.PowerUW)/1e6, tooltip)
+		}
+		s.powerVal.SetLabel(fmt.Sprintf("%.1f W", float64(powerUW)/1e6))
+		s.powerVal.SetTooltipText(tooltip)
 		s.batteryVal.SetLabel(fmt.Sprintf("%d%%", stats.Battery.CapacityPct))
-		s.statusVal.SetLabel(stats.Battery.Status)
+		s.statusVal.SetLabel(formatStatus(stats.Battery))
 	}
+	s.updateStale(stats)
 	if stats.Backlight != nil && stats.Backlight.MaxBrightness > 0 {
 		pct := float64(stats.Backlight.Brightness) * 100 / float64(stats.Backlight.MaxBrightness)
-		s.brightVal.SetLabel(fmt.Sprintf("%.0f%%", pct))
+		if uw, errUW, source, ok := displayPowerEstimate(calib, displayModel, pct); ok {
+			s.brightVal.SetLabel(fmt.Sprintf("%.0f%% · %s", pct, formatPowerWithError(uw, errUW)))
+			s.brightVal.SetTooltipText("Estimated display power from " + source + ", with its measurement error")
+		} else {
+			s.brightVal.SetLabel(fmt.Sprintf("%.0f%%", pct))
+			s.brightVal.SetTooltipText("")
+		}
+	}
+}
+
+// updateStale grays out the values and shows their age when the latest sample
+// is several collection intervals old, e.g. because the daemon stopped.
+func (s *statsBar) updateStale(stats *currentStats) {
+	stale := false
+	var age time.Duration
+	if stats.Battery != nil {
+		age, stale = sampleAge(stats.Battery.Timestamp, stats.IntervalSeconds, time.Now())
+	}
+	if stale {
+		s.container.AddCSSClass("stale")
+		s.staleLabel.SetLabel(formatStaleAge(age))
+	} else {
+		s.container.RemoveCSSClass("stale")
+	}
+	s.staleLabel.SetVisible(stale)
+}
+
+// powerSourceDescription explains how a power reading was derived.
+func powerSourceDescription(src collector.PowerSource) string {
+	switch src {
+	case collector.PowerSourceChargeDelta:
+		return "Averaged from battery charge change"
+	case collector.PowerSourceEnergyDelta:
+		return "Averaged from battery energy change"
+	case collector.PowerSourceSysfsPowerNow:
+		return "Instantaneous reading from power_now"
+	case collector.PowerSourceSysfsVoltageCurrent:
+		return "Instantaneous voltage × current"
+	default:
+		return "No power reading available"
+	}
+}
+
+// formatStatus returns the battery status, annotated with the charger rating
+// when known (e.g. "Charging at 45 W / 65 W charger").
+func formatStatus(b *collector.BatterySample) string {
+	if b.ChargerPowerUW <= 0 {
+		return b.Status
+	}
+	chargerW := float64(b.ChargerPowerUW) / 1e6
+	if b.Status == "Charging" {
+		return fmt.Sprintf("Charging at %.0f W / %.0f W charger", float64(b.PowerUW)/1e6, chargerW)
 	}
+	return fmt.Sprintf("%s (%.0f W charger)", b.Status, chargerW)
 }
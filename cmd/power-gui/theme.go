@@ -26,6 +26,13 @@ func loadCSS() {
 			font-weight: bold;
 			color: @window_fg_color;
 		}
+		.stats-bar.stale .stat-value {
+			opacity: 0.4;
+		}
+		.stat-stale {
+			font-size: 11px;
+			color: @warning_color;
+		}
 		.time-range-bar {
 			padding: 4px 0;
 		}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// chargeThresholdLabel describes a battery's charge thresholds, e.g.
+// "Charges from 40% to 80%".
+func chargeThresholdLabel(t collector.ChargeThreshold) string {
+	switch {
+	case t.StartPct != nil && t.EndPct != nil:
+		return fmt.Sprintf("Charges from %d%% to %d%%", *t.StartPct, *t.EndPct)
+	case t.EndPct != nil:
+		return fmt.Sprintf("Stops charging at %d%%", *t.EndPct)
+	case t.StartPct != nil:
+		return fmt.Sprintf("Starts charging below %d%%", *t.StartPct)
+	default:
+		return "Not supported"
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestChargeThresholdLabel(t *testing.T) {
+	pct := func(v int) *int { return &v }
+	tests := []struct {
+		name string
+		t    collector.ChargeThreshold
+		want string
+	}{
+		{"both", collector.ChargeThreshold{StartPct: pct(40), EndPct: pct(80)}, "Charges from 40% to 80%"},
+		{"end only", collector.ChargeThreshold{EndPct: pct(95)}, "Stops charging at 95%"},
+		{"start only", collector.ChargeThreshold{StartPct: pct(75)}, "Starts charging below 75%"},
+		{"unsupported", collector.ChargeThreshold{}, "Not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := chargeThresholdLabel(tt.t); got != tt.want {
+				t.Fatalf("chargeThresholdLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
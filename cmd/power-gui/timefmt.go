@@ -0,0 +1,46 @@
+package main
+
+import "time"
+
+// timeStyle selects how a timestamp is labelled.
+type timeStyle int
+
+const (
+	timeStyleClock        timeStyle = iota // 15:04
+	timeStyleDay                           // Jan 2
+	timeStyleDayClock                      // Jan 2 15:04
+	timeStyleFullDay                       // Jan 2, 2006
+	timeStyleFullDayClock                  // Jan 2, 2006 15:04
+)
+
+// use12HourClock follows the desktop's clock-format preference; see
+// loadTimeFormat.
+var use12HourClock bool
+
+// timePatterns returns the GLib strftime pattern for style, which uses the
+// locale's month names, and the Go layout used when GLib cannot format.
+func timePatterns(style timeStyle, twelveHour bool) (strftime, layout string) {
+	clockF, clockL := "%H:%M", "15:04"
+	if twelveHour {
+		clockF, clockL = "%-l:%M %p", "3:04 PM"
+	}
+	switch style {
+	case timeStyleDay:
+		return "%b %-e", "Jan 2"
+	case timeStyleDayClock:
+		return "%b %-e " + clockF, "Jan 2 " + clockL
+	case timeStyleFullDay:
+		return "%b %-e, %Y", "Jan 2, 2006"
+	case timeStyleFullDayClock:
+		return "%b %-e, %Y " + clockF, "Jan 2, 2006 " + clockL
+	default:
+		return clockF, clockL
+	}
+}
+
+// formatTime labels t in style. Until loadTimeFormat installs the
+// locale-aware formatter it uses the English Go layouts.
+var formatTime = func(t time.Time, style timeStyle) string {
+	_, layout := timePatterns(style, use12HourClock)
+	return t.Format(layout)
+}
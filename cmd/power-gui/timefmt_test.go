@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatTime_Fallback(t *testing.T) {
+	ts := time.Date(2026, time.March, 4, 15, 7, 0, 0, time.Local)
+	tests := []struct {
+		style      timeStyle
+		twelveHour bool
+		want       string
+	}{
+		{timeStyleClock, false, "15:07"},
+		{timeStyleClock, true, "3:07 PM"},
+		{timeStyleDay, true, "Mar 4"},
+		{timeStyleDayClock, false, "Mar 4 15:07"},
+		{timeStyleDayClock, true, "Mar 4 3:07 PM"},
+		{timeStyleFullDay, false, "Mar 4, 2026"},
+		{timeStyleFullDayClock, true, "Mar 4, 2026 3:07 PM"},
+	}
+	orig := use12HourClock
+	t.Cleanup(func() { use12HourClock = orig })
+	for _, tt := range tests {
+		use12HourClock = tt.twelveHour
+		if got := formatTime(ts, tt.style); got != tt.want {
+			t.Errorf("formatTime(%v, 12h=%v) = %q, want %q", tt.style, tt.twelveHour, got, tt.want)
+		}
+	}
+}
+
+func TestTimePatterns_ClockMatchesPreference(t *testing.T) {
+	if f, _ := timePatterns(timeStyleClock, false); f != "%H:%M" {
+		t.Fatalf("24h clock pattern = %q, want %%H:%%M", f)
+	}
+	if f, _ := timePatterns(timeStyleDayClock, true); f != "%b %-e %-l:%M %p" {
+		t.Fatalf("12h day-clock pattern = %q", f)
+	}
+}
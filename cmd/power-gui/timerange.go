@@ -55,3 +55,12 @@ func newTimeRangeBar(selected int, onSelect func(int)) *timeRangeBar {
 
 	return bar
 }
+
+// Select activates the button for time range idx. The toggle handler updates
+// the other buttons and refreshes the graphs, as with a click.
+func (bar *timeRangeBar) Select(idx int) {
+	if idx < 0 || idx >= len(bar.buttons) {
+		return
+	}
+	bar.buttons[idx].SetActive(true)
+}
@@ -1,82 +1,42 @@
 package main
 
 import (
-	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/config"
 	dbussvc "github.com/cptspacemanspiff/gnome-power-display/internal/dbus"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/diagnostics"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/logtopic"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/storage"
 )
 
-// topicHandler wraps an slog.Handler and filters records by a "topic" attribute.
-// Records without a topic attribute always pass through (startup messages, errors).
-// Records with a topic only pass if that topic is enabled.
-type topicHandler struct {
-	inner  slog.Handler
-	topics map[string]bool
-	topic  string // set when WithAttrs includes a "topic" key
-}
-
-func (h *topicHandler) Enabled(_ context.Context, level slog.Level) bool {
-	return h.inner.Enabled(context.Background(), level)
-}
-
-func (h *topicHandler) Handle(ctx context.Context, r slog.Record) error {
-	if h.topics["all"] {
-		return h.inner.Handle(ctx, r)
-	}
-	topic := h.topic
-	if topic == "" {
-		// Check record-level attrs as fallback.
-		r.Attrs(func(a slog.Attr) bool {
-			if a.Key == "topic" {
-				topic = a.Value.String()
-				return false
-			}
-			return true
-		})
-	}
-	if topic != "" && !h.topics[topic] {
-		return nil
-	}
-	return h.inner.Handle(ctx, r)
-}
-
-func (h *topicHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	topic := h.topic
-	for _, a := range attrs {
-		if a.Key == "topic" {
-			topic = a.Value.String()
-		}
-	}
-	return &topicHandler{inner: h.inner.WithAttrs(attrs), topics: h.topics, topic: topic}
-}
-
-func (h *topicHandler) WithGroup(name string) slog.Handler {
-	return &topicHandler{inner: h.inner.WithGroup(name), topics: h.topics, topic: h.topic}
-}
-
 func main() {
 	verbose := flag.Bool("verbose", false, "enable all verbose logging (equivalent to -log=all)")
 	logFlag := flag.String("log", "", "comma-separated log topics: battery,backlight,process,sleep (or 'all')")
 	resetDB := flag.Bool("reset-db", false, "delete the database and start fresh")
 	configPath := flag.String("config", "/etc/power-monitor/config.toml", "path to config file")
+	bundlePath := flag.String("diagnostic-bundle", "", "write a diagnostic zip for bug reports to this path and exit")
+	redact := flag.Bool("redact", false, "with -diagnostic-bundle, replace file paths, the battery serial and process command lines")
+	replayPath := flag.String("replay-state-log", "", "reconstruct the sleep events of an archived state log, print them as JSON and exit")
 	flag.Parse()
 
 	topics := make(map[string]bool)
 	if *verbose {
-		topics["all"] = true
+		topics[logtopic.All] = true
 	}
 	if *logFlag != "" {
 		for _, t := range strings.Split(*logFlag, ",") {
@@ -84,10 +44,7 @@ func main() {
 		}
 	}
 
-	handler := &topicHandler{
-		inner:  slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}),
-		topics: topics,
-	}
+	handler := logtopic.NewHandler(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}), topics)
 	logger := slog.New(handler)
 
 	// Load config.
@@ -109,34 +66,96 @@ func main() {
 	processLog := logger.With("topic", "process")
 	sleepLog := logger.With("topic", "sleep")
 
-	dbPath := cfg.Storage.DBPath
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		logger.Error("create data dir", "err", err)
-		os.Exit(1)
+	if *replayPath != "" {
+		if err := replayStateLog(*replayPath, cfg.Storage, sleepLog); err != nil {
+			logger.Error("replay state log", "path", *replayPath, "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	dbPath := cfg.Storage.LiveDBPath()
+	for _, dir := range []string{filepath.Dir(cfg.Storage.DBPath), filepath.Dir(dbPath)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Error("create data dir", "err", err)
+			os.Exit(1)
+		}
 	}
 
 	if *resetDB {
-		for _, suffix := range []string{"", "-wal", "-shm"} {
-			if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
-				logger.Error("delete database", "err", err)
-				os.Exit(1)
+		// With tmpfs_dir, both the live copy and its snapshot go.
+		for _, path := range []string{dbPath, cfg.Storage.DBPath} {
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+					logger.Error("delete database", "err", err)
+					os.Exit(1)
+				}
 			}
+			logger.Info("database deleted", "path", path)
 		}
-		logger.Info("database deleted", "path", dbPath)
 		return
 	}
 
-	store, err := storage.Open(dbPath)
+	if *bundlePath != "" {
+		if err := writeDiagnosticBundle(*bundlePath, cfg, *redact); err != nil {
+			logger.Error("write diagnostic bundle", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("diagnostic bundle written", "path", *bundlePath)
+		return
+	}
+
+	if cfg.Storage.TmpfsDir != "" {
+		restored, err := storage.RestoreSnapshot(cfg.Storage.DBPath, dbPath)
+		if err != nil {
+			logger.Error("restore database snapshot", "snapshot", cfg.Storage.DBPath, "path", dbPath, "err", err)
+			os.Exit(1)
+		}
+		if restored {
+			logger.Info("restored database snapshot to tmpfs", "snapshot", cfg.Storage.DBPath, "path", dbPath)
+		}
+	}
+
+	var store *storage.DB
+	if cfg.Storage.OnCorruption == config.OnCorruptionRecover {
+		var moved string
+		store, moved, err = storage.OpenWithRecovery(dbPath)
+		if moved != "" {
+			logger.Error("database was corrupt; moved it aside and started a fresh one",
+				"path", dbPath, "corrupt_copy", moved)
+		}
+	} else {
+		store, err = storage.Open(dbPath)
+	}
 	if err != nil {
 		logger.Error("open database", "err", err)
 		os.Exit(1)
 	}
 	defer store.Close()
 
+	// Optionally batch sample writes into one commit per interval. Reads
+	// through the store still see buffered samples.
+	var commitCh <-chan time.Time
+	if cfg.Storage.CommitIntervalSeconds > 0 {
+		store.EnableWriteBuffer(cfg.Storage.CommitMaxRows)
+		commitTicker := time.NewTicker(time.Duration(cfg.Storage.CommitIntervalSeconds) * time.Second)
+		defer commitTicker.Stop()
+		commitCh = commitTicker.C
+	}
+
+	// With the live database on tmpfs, persist it periodically; nothing
+	// written since the last snapshot survives a crash.
+	var snapshotCh <-chan time.Time
+	if cfg.Storage.TmpfsDir != "" {
+		snapshotTicker := time.NewTicker(time.Duration(cfg.Storage.SnapshotIntervalMinutes) * time.Minute)
+		defer snapshotTicker.Stop()
+		snapshotCh = snapshotTicker.C
+	}
+
 	// Run cleanup on startup.
-	runCleanup(store, cfg.Cleanup.RetentionDays, logger)
+	runCleanup(store, cfg.Cleanup, logger)
 
-	svc, err := dbussvc.NewService(store, cfg, *configPath)
+	svc, err := dbussvc.NewService(store, cfg, *configPath, logger)
 	if err != nil {
 		logger.Error("initialize dbus service", "err", err)
 		os.Exit(1)
@@ -149,8 +168,17 @@ func main() {
 	defer conn.Close()
 	logger.Info("D-Bus service registered", "name", dbussvc.BusName)
 
+	// Record battery health on startup and hourly thereafter; unchanged
+	// snapshots are skipped by the store.
+	recordHealthSnapshot(store, cfg.Collection.BatteryDevice, capacityDropPercent(cfg.Annotations), cfg.Cleanup.RetentionDays, batteryLog)
+	if dropPct := capacityDropPercent(cfg.Annotations); dropPct > 0 {
+		annotateCapacityDrops(store, batteryLog, float64(dropPct), cfg.Cleanup.RetentionDays)
+	}
+	healthTicker := time.NewTicker(time.Hour)
+	defer healthTicker.Stop()
+
 	// Import any power state events from the systemd hook state log.
-	importStateLog(store, sleepLog, cfg.Storage.StateLogPath)
+	importStateLog(store, sleepLog, cfg.Storage, cfg.Annotations.SuspendResume)
 
 	// Start sleep monitor; its wake channel triggers state log re-reads
 	// (catches short sleeps that don't produce a wall-clock jump).
@@ -163,11 +191,86 @@ func main() {
 		defer sleepMon.Close()
 	}
 
+	// Put back CPU settings a calibration run left pinned when it crashed
+	// or was killed.
+	if restored, err := calibration.RestoreStalePin(); err != nil {
+		logger.Warn("restore pinned CPU settings", "err", err)
+	} else if restored {
+		logger.Info("restored CPU settings left pinned by an interrupted calibration run")
+	}
+
 	// Start battery collector with averaging window.
-	batteryCollector := collector.NewBatteryCollector(int64(cfg.Collection.PowerAverageSeconds))
+	batteryCollector := collector.NewBatteryCollector(int64(cfg.Collection.PowerAverageSeconds), cfg.Collection.PreferSysfsPower, cfg.Collection.BatteryDevice)
+	batteryCollector.SetSmoothedWindow(int64(cfg.Collection.PowerSmoothedSeconds))
+	batteryCollector.SetPowerRounding(int64(cfg.Collection.PowerRoundingMW) * 1000)
+	batteryCollector.SetDeltaQuantity(collector.DeltaQuantity(cfg.Collection.PowerQuantity))
+
+	// Start process collector unless process collection is turned off.
+	// Without sysfs cpufreq it reads frequencies from /proc/cpuinfo, which
+	// is logged the first time a collector is created.
+	cpuinfoFreqsLogged := false
+	newProcCollector := func() *collector.ProcessCollector {
+		pc := collector.NewProcessCollector(cfg.Collection.TopProcesses, cfg.Collection.ProcScanWorkers)
+		if pc.UsesCPUInfoFreqs() && !cpuinfoFreqsLogged {
+			processLog.Info("sysfs cpufreq unavailable, reading CPU frequencies from /proc/cpuinfo")
+			cpuinfoFreqsLogged = true
+		}
+		return pc
+	}
+	var procCollector *collector.ProcessCollector
+	if cfg.Collection.ProcessesEnabled {
+		procCollector = newProcCollector()
+	} else {
+		processLog.Info("process collection disabled")
+	}
+
+	// With only_on_battery, process collection pauses while AC is online.
+	procPaused := false
+
+	// Annotate power spikes and AC transitions on the timeline.
+	annotator := collector.NewEventAnnotator()
+
+	// Detect CPU throttling intervals from the same per-CPU sysfs tree.
+	throttleDetector := collector.NewThrottleDetector()
+
+	// Record user-idle intervals from logind when it reports them.
+	var idleDetector *collector.IdleDetector
+	idleMon, err := collector.NewIdleMonitor()
+	if err != nil {
+		logger.Warn("idle monitor unavailable", "err", err)
+	} else {
+		defer idleMon.Close()
+		idleDetector = collector.NewIdleDetector(int64(cfg.Collection.IntervalSeconds))
+	}
+
+	// Sample per-core busy time from /proc/stat every cpu_busy_interval_seconds.
+	cpuBusyCollector := collector.NewCPUBusyCollector()
+	var lastCPUBusy time.Time
+
+	// Watch idle power for sustained rises over its rolling baseline. With
+	// logind idle data the baseline is rebuilt from the stored history.
+	var regression *collector.RegressionDetector
+	if cfg.Collection.PowerRegressionPercent > 0 {
+		regression = collector.NewRegressionDetector(int64(cfg.Collection.PowerRegressionPercent),
+			int64(cfg.Collection.PowerRegressionMinutes)*60, int64(cfg.Collection.IntervalSeconds))
+		if idleDetector != nil {
+			if err := primePowerRegression(store, regression, time.Now().Unix()); err != nil {
+				batteryLog.Warn("rebuild idle power baseline", "err", err)
+			}
+			if r := regression.Active(); r != nil {
+				svc.ReportPowerRegression(*r)
+			}
+		}
+	}
+
+	// Optionally store CPU frequencies only when they change.
+	freqFilter := collector.NewCPUFreqFilter(int64(cfg.Collection.CPUFreqChangeKHz), int64(cfg.Collection.CPUFreqHeartbeatSeconds))
 
-	// Start process collector.
-	procCollector := collector.NewProcessCollector(cfg.Collection.TopProcesses)
+	// Optionally refine the display power model from stable periods.
+	var refiner *calibration.Refiner
+	if cfg.Collection.RefineDisplayModel {
+		refiner = calibration.NewRefiner(int64(cfg.Collection.IntervalSeconds))
+	}
 
 	// Collect battery, backlight, and process data on a ticker.
 	collectInterval := time.Duration(cfg.Collection.IntervalSeconds) * time.Second
@@ -180,6 +283,8 @@ func main() {
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
 
 	jumpThreshold := time.Duration(cfg.Collection.WallClockJumpThresholdSeconds) * time.Second
 	logger.Info("power-monitor-daemon started", "interval", collectInterval)
@@ -190,31 +295,66 @@ func main() {
 			now := time.Now().Round(0)
 			if now.Sub(lastTick) > jumpThreshold {
 				logger.Info("wall-clock jump detected, re-reading state log", "gap_secs", int(now.Sub(lastTick).Seconds()))
-				importStateLog(store, sleepLog, cfg.Storage.StateLogPath)
+				importStateLog(store, sleepLog, cfg.Storage, cfg.Annotations.SuspendResume)
 			}
 			lastTick = now
-			if sample, err := batteryCollector.Collect(); err == nil {
+			var batSample *collector.BatterySample
+			var blSample *collector.BacklightSample
+			var procStats *collector.ProcessCollectStats
+			start := time.Now()
+			sample, err := batteryCollector.Collect()
+			svc.RecordCollectTime("battery", time.Since(start))
+			if ev := batteryCollector.PresenceChange(); ev != nil {
+				recordBatteryPresence(store, batteryLog, *ev)
+			}
+			if err == nil {
+				batSample = sample
 				batteryLog.Info("sample",
 					"capacity_pct", sample.CapacityPct,
 					"status", sample.Status,
-					"power_uw", sample.PowerUW)
+					"power_uw", sample.PowerUW,
+					"power_source", sample.PowerSource,
+					"ac_source", sample.ACSource)
 				if err := store.InsertBatterySample(*sample); err != nil {
 					logger.Error("store battery", "err", err)
 				}
-			} else {
+				svc.SampleInserted(sample.Timestamp)
+				recordAnnotations(store, batteryLog, annotator.Observe(*sample, annotatorOptions(cfg.Annotations)))
+			} else if !errors.Is(err, collector.ErrNoBattery) {
+				// A missing battery is logged once, as a presence change.
 				batteryLog.Debug("collect failed", "err", err)
 			}
-			if sample, err := collector.CollectBacklight(); err == nil {
+			start = time.Now()
+			bl, err := collector.CollectBacklight(cfg.Collection.BacklightDevice)
+			svc.RecordCollectTime("backlight", time.Since(start))
+			if err == nil {
+				blSample = bl
 				backlightLog.Info("sample",
-					"brightness", sample.Brightness,
-					"max_brightness", sample.MaxBrightness)
-				if err := store.InsertBacklightSample(*sample); err != nil {
+					"brightness", bl.Brightness,
+					"max_brightness", bl.MaxBrightness)
+				if err := store.InsertBacklightSample(*bl); err != nil {
 					logger.Error("store backlight", "err", err)
 				}
+				svc.SampleInserted(bl.Timestamp)
 			} else {
 				backlightLog.Debug("collect failed", "err", err)
 			}
-			if procSamples, freqSamples, stats, err := procCollector.Collect(); err == nil {
+			onAC := procCollector != nil && cfg.Collection.OnlyOnBattery && batSample != nil && batSample.ACSource != ""
+			if onAC != procPaused {
+				procPaused = onAC
+				if procPaused {
+					processLog.Info("AC online, pausing process collection", "ac_source", batSample.ACSource)
+				} else {
+					processLog.Info("on battery, resuming process collection")
+					procCollector.Reset()
+				}
+			}
+			if procCollector == nil {
+				// Process collection is disabled.
+			} else if procPaused {
+				processLog.Debug("skipped on AC power")
+			} else if procSamples, freqSamples, stats, err := timedProcessCollect(svc, procCollector); err == nil {
+				procStats = stats
 				capturedPct := 0.0
 				if stats.TotalTicks > 0 {
 					capturedPct = float64(stats.CapturedTicks) / float64(stats.TotalTicks) * 100
@@ -233,11 +373,12 @@ func main() {
 						eProcs = append(eProcs, s)
 					}
 				}
+				pLabel, eLabel := cfg.Collection.PCoreLabel, cfg.Collection.ECoreLabel
 				for _, s := range pProcs {
-					processLog.Debug("p-core process", "pid", s.PID, "comm", s.Comm, "ticks", s.CPUTicksDelta, "cpu", s.LastCPU)
+					processLog.Debug(pLabel+" process", "pid", s.PID, "comm", s.Comm, "ticks", s.CPUTicksDelta, "cpu", s.LastCPU)
 				}
 				for _, s := range eProcs {
-					processLog.Debug("e-core process", "pid", s.PID, "comm", s.Comm, "ticks", s.CPUTicksDelta, "cpu", s.LastCPU)
+					processLog.Debug(eLabel+" process", "pid", s.PID, "comm", s.Comm, "ticks", s.CPUTicksDelta, "cpu", s.LastCPU)
 				}
 				var pTicks, eTicks int64
 				var pCores, eCores []int
@@ -262,43 +403,440 @@ func main() {
 					eTicks += t
 					eParts = append(eParts, fmt.Sprintf("[%d]=%d", id, t))
 				}
-				processLog.Debug("core ticks",
-					"p_ticks", pTicks, "p_cores", strings.Join(pParts, " "),
-					"e_ticks", eTicks, "e_cores", strings.Join(eParts, " "))
+				processLog.Debug("core ticks", "class", pLabel, "ticks", pTicks, "cores", strings.Join(pParts, " "))
+				processLog.Debug("core ticks", "class", eLabel, "ticks", eTicks, "cores", strings.Join(eParts, " "))
 				if err := store.InsertProcessSamples(procSamples); err != nil {
 					logger.Error("store process samples", "err", err)
 				}
-				if err := store.InsertCPUFreqSamples(freqSamples); err != nil {
+				if err := store.InsertProcessCycleStats(stats.CycleStats()); err != nil {
+					logger.Error("store process cycle stats", "err", err)
+				}
+				if err := store.UpsertProcessLifetimes(stats.Lifetimes); err != nil {
+					logger.Error("store process lifetimes", "err", err)
+				}
+				if err := store.InsertCPUFreqSamples(freqFilter.Filter(freqSamples)); err != nil {
 					logger.Error("store cpu freq samples", "err", err)
 				}
 			} else {
 				processLog.Debug("collect failed", "err", err)
 			}
+			if ev := throttleDetector.Observe(time.Now().Unix()); ev != nil {
+				recordThrottleEvent(store, processLog, *ev)
+			}
+			if every := time.Duration(cfg.Collection.CPUBusyIntervalSeconds) * time.Second; every > 0 && now.Sub(lastCPUBusy) >= every {
+				lastCPUBusy = now
+				if busy, err := cpuBusyCollector.Collect(now.Unix()); err != nil {
+					processLog.Debug("collect cpu busy failed", "err", err)
+				} else if err := store.InsertCPUBusySamples(busy); err != nil {
+					logger.Error("store cpu busy samples", "err", err)
+				}
+			}
+			var userIdle *bool
+			if idleDetector != nil {
+				if idle, since, err := idleMon.Read(); err != nil {
+					sleepLog.Debug("read idle hint failed", "err", err)
+				} else {
+					userIdle = &idle
+					if iv := idleDetector.Observe(time.Now().Unix(), idle, since); iv != nil {
+						recordIdleInterval(store, sleepLog, *iv)
+					}
+				}
+			}
+			if regression != nil {
+				quiet := regressionQuiet(userIdle, procStats, cfg.Collection.IntervalSeconds)
+				observePowerRegression(svc, batteryLog, regression, batSample, blSample, quiet)
+			}
+			if refiner != nil {
+				observeDisplayModel(store, backlightLog, refiner, batSample, blSample, procStats)
+			}
+		case <-commitCh:
+			if err := store.Flush(); err != nil {
+				logger.Error("commit buffered samples", "err", err)
+			}
+		case <-snapshotCh:
+			snapshotDB(store, cfg.Storage.DBPath, logger)
 		case <-wakeCh:
 			logger.Info("wake signal received, re-reading state log")
-			importStateLog(store, sleepLog, cfg.Storage.StateLogPath)
+			importStateLog(store, sleepLog, cfg.Storage, cfg.Annotations.SuspendResume)
 			lastTick = time.Now().Round(0)
+		case <-healthTicker.C:
+			recordHealthSnapshot(store, cfg.Collection.BatteryDevice, capacityDropPercent(cfg.Annotations), cfg.Cleanup.RetentionDays, batteryLog)
 		case <-cleanupTicker.C:
-			runCleanup(store, cfg.Cleanup.RetentionDays, logger)
+			runCleanup(store, cfg.Cleanup, logger)
+			svc.HistoryPruned()
+		case reply := <-svc.DebugRequests():
+			reply <- collector.NewDebugState(batteryCollector, procCollector, cfg.Collection.BatteryDevice, cfg.Collection.BacklightDevice)
+		case <-hupCh:
+			loaded, applied, ok := reloadConfig(*configPath, cfg, logger)
+			if !ok {
+				break
+			}
+			if applied.Collection.IntervalSeconds != cfg.Collection.IntervalSeconds {
+				collectInterval = time.Duration(applied.Collection.IntervalSeconds) * time.Second
+				ticker.Reset(collectInterval)
+				if idleDetector != nil {
+					idleDetector.SetInterval(int64(applied.Collection.IntervalSeconds))
+				}
+				if refiner != nil {
+					refiner.SetInterval(int64(applied.Collection.IntervalSeconds))
+				}
+				if regression != nil {
+					regression.SetInterval(int64(applied.Collection.IntervalSeconds))
+				}
+			}
+			batteryCollector.SetWindow(int64(applied.Collection.PowerAverageSeconds))
+			batteryCollector.SetSmoothedWindow(int64(applied.Collection.PowerSmoothedSeconds))
+			batteryCollector.SetPowerRounding(int64(applied.Collection.PowerRoundingMW) * 1000)
+			batteryCollector.SetDeltaQuantity(collector.DeltaQuantity(applied.Collection.PowerQuantity))
+			if applied.Collection.ProcessesEnabled != (procCollector != nil) {
+				if applied.Collection.ProcessesEnabled {
+					procCollector = newProcCollector()
+					processLog.Info("process collection enabled")
+				} else {
+					procCollector = nil
+					procPaused = false
+					processLog.Info("process collection disabled")
+				}
+			}
+			if applied.Collection.CPUBusyIntervalSeconds != cfg.Collection.CPUBusyIntervalSeconds {
+				// Start a fresh baseline so no sample spans the old interval.
+				cpuBusyCollector.Reset()
+				lastCPUBusy = time.Time{}
+			}
+			if applied.Cleanup.IntervalHours != cfg.Cleanup.IntervalHours {
+				cleanupTicker.Reset(time.Duration(applied.Cleanup.IntervalHours) * time.Hour)
+			}
+			cfg = applied
+			svc.SetConfig(applied, loaded)
 		case <-sigCh:
 			logger.Info("shutting down")
+			if ev := throttleDetector.Flush(); ev != nil {
+				recordThrottleEvent(store, processLog, *ev)
+			}
+			if idleDetector != nil {
+				if iv := idleDetector.Flush(); iv != nil {
+					recordIdleInterval(store, sleepLog, *iv)
+				}
+			}
+			if err := store.Flush(); err != nil {
+				logger.Error("commit buffered samples", "err", err)
+			}
+			if snapshotCh != nil {
+				snapshotDB(store, cfg.Storage.DBPath, logger)
+			}
 			return
 		}
 	}
 }
 
-func runCleanup(store *storage.DB, retentionDays int, logger *slog.Logger) {
-	before := time.Now().AddDate(0, 0, -retentionDays).Unix()
-	deleted, err := store.DeleteOlderThan(before)
-	if err != nil {
+// snapshotDB persists the tmpfs database to path.
+func snapshotDB(store *storage.DB, path string, logger *slog.Logger) {
+	start := time.Now()
+	if err := store.Snapshot(path); err != nil {
+		logger.Error("snapshot database", "path", path, "err", err)
+		return
+	}
+	logger.Debug("database snapshot written", "path", path, "duration", time.Since(start))
+}
+
+func runCleanup(store *storage.DB, cleanup config.CleanupConfig, logger *slog.Logger) {
+	before := time.Now().AddDate(0, 0, -cleanup.RetentionDays).Unix()
+	deleted, err := store.DeleteOlderThan(before, cleanup.MaxDeletePercent)
+	switch {
+	case errors.Is(err, storage.ErrCleanupTooLarge):
+		logger.Warn("cleanup skipped, check the system clock", "err", err)
+	case err != nil:
 		logger.Error("cleanup failed", "err", err)
-	} else if deleted > 0 {
-		logger.Info("cleanup completed", "deleted_rows", deleted, "retention_days", retentionDays)
+	case deleted > 0:
+		logger.Info("cleanup completed", "deleted_rows", deleted, "retention_days", cleanup.RetentionDays)
+	}
+	if err != nil || cleanup.CPUBusyRetentionDays >= cleanup.RetentionDays {
+		return
 	}
+	before = time.Now().AddDate(0, 0, -cleanup.CPUBusyRetentionDays).Unix()
+	deleted, err = store.DeleteCPUBusyOlderThan(before)
+	switch {
+	case err != nil:
+		logger.Error("cpu busy cleanup failed", "err", err)
+	case deleted > 0:
+		logger.Info("cpu busy cleanup completed", "deleted_rows", deleted, "retention_days", cleanup.CPUBusyRetentionDays)
+	}
+}
+
+// recordBatteryPresence logs and stores a battery removal or reinsertion.
+func recordBatteryPresence(store *storage.DB, logger *slog.Logger, ev collector.BatteryPresenceEvent) {
+	if ev.Present {
+		logger.Info("battery inserted, charge history reset", "battery", ev.Battery)
+	} else {
+		logger.Info("battery removed", "battery", ev.Battery)
+	}
+	if err := store.InsertBatteryPresenceEvent(ev); err != nil {
+		logger.Error("store battery presence event", "err", err)
+	}
+}
+
+func recordThrottleEvent(store *storage.DB, logger *slog.Logger, ev collector.ThrottleEvent) {
+	logger.Info("cpu throttled",
+		"reason", ev.Reason,
+		"start", ev.StartTime,
+		"end", ev.EndTime)
+	if err := store.InsertThrottleEvent(ev); err != nil {
+		logger.Error("store throttle event", "err", err)
+	}
+}
+
+func recordIdleInterval(store *storage.DB, logger *slog.Logger, iv collector.IdleInterval) {
+	logger.Info("user idle",
+		"start", iv.StartTime,
+		"end", iv.EndTime)
+	if err := store.InsertIdleInterval(iv); err != nil {
+		logger.Error("store idle interval", "err", err)
+	}
+}
+
+// quietTicksPerSecond is the CPU use below which a cycle counts as quiet for
+// the power regression baseline when logind reports no idle state: a tenth
+// of one CPU at the kernel's 100 ticks per second.
+const quietTicksPerSecond = 10
+
+// regressionQuiet reports whether a cycle belongs in the idle power baseline:
+// the user is idle according to logind or, without logind, the CPU is
+// nearly idle. With neither reading no cycle is quiet.
+func regressionQuiet(userIdle *bool, stats *collector.ProcessCollectStats, intervalSec int) bool {
+	if userIdle != nil {
+		return *userIdle
+	}
+	return stats != nil && stats.TotalTicks <= int64(quietTicksPerSecond*intervalSec)
+}
+
+// observePowerRegression feeds one cycle to the power regression detector and
+// reports a regression being raised or cleared.
+func observePowerRegression(svc *dbussvc.Service, logger *slog.Logger, det *collector.RegressionDetector,
+	bat *collector.BatterySample, bl *collector.BacklightSample, quiet bool) {
+	if bat == nil {
+		return
+	}
+	r := det.Observe(collector.RegressionObservation{
+		Timestamp:     bat.Timestamp,
+		PowerUW:       bat.PowerUW,
+		BrightnessPct: brightnessPct(bl),
+		Discharging:   bat.Status == "Discharging",
+		Quiet:         quiet,
+	})
+	if r == nil {
+		return
+	}
+	if r.Active {
+		logger.Warn("idle power regression",
+			"baseline_uw", r.BaselineUW,
+			"power_uw", r.PowerUW,
+			"brightness_pct", r.BrightnessPct,
+			"since", r.StartTime)
+	} else {
+		logger.Info("idle power back to baseline", "baseline_uw", r.BaselineUW, "power_uw", r.PowerUW)
+	}
+	svc.ReportPowerRegression(*r)
+}
+
+// brightnessPct returns the backlight level in percent, or -1 without a
+// usable sample.
+func brightnessPct(bl *collector.BacklightSample) float64 {
+	if bl == nil || bl.MaxBrightness <= 0 {
+		return -1
+	}
+	return float64(bl.Brightness) * 100 / float64(bl.MaxBrightness)
+}
+
+// primePowerRegression replays the stored battery, backlight and user-idle
+// history of the baseline window into det, so the baseline survives a
+// restart. Reports raised during the replay are dropped; a regression still
+// active at the end stays active.
+func primePowerRegression(store *storage.DB, det *collector.RegressionDetector, now int64) error {
+	from := now - collector.RegressionBaselineSeconds
+	bats, err := store.BatterySamplesInRange(from, now)
+	if err != nil {
+		return fmt.Errorf("query battery samples: %w", err)
+	}
+	bls, err := store.BacklightSamplesInRange(from, now)
+	if err != nil {
+		return fmt.Errorf("query backlight samples: %w", err)
+	}
+	idle, err := store.IdleIntervalsInRange(from, now)
+	if err != nil {
+		return fmt.Errorf("query idle intervals: %w", err)
+	}
+	bi, ii := 0, 0
+	for _, bat := range bats {
+		for bi < len(bls) && bls[bi].Timestamp <= bat.Timestamp {
+			bi++
+		}
+		var bl *collector.BacklightSample
+		if bi > 0 {
+			bl = &bls[bi-1]
+		}
+		for ii < len(idle) && idle[ii].EndTime < bat.Timestamp {
+			ii++
+		}
+		det.Observe(collector.RegressionObservation{
+			Timestamp:     bat.Timestamp,
+			PowerUW:       bat.PowerUW,
+			BrightnessPct: brightnessPct(bl),
+			Discharging:   bat.Status == "Discharging",
+			Quiet:         ii < len(idle) && idle[ii].StartTime <= bat.Timestamp,
+		})
+	}
+	return nil
+}
+
+// observeDisplayModel feeds one collection cycle to the background display
+// power model and stores any stable period it completes. A cycle with a
+// missing reading breaks the current period.
+func observeDisplayModel(store *storage.DB, logger *slog.Logger, refiner *calibration.Refiner,
+	bat *collector.BatterySample, bl *collector.BacklightSample, stats *collector.ProcessCollectStats) {
+	if bat == nil || bl == nil || bl.MaxBrightness <= 0 || stats == nil {
+		refiner.Reset()
+		return
+	}
+	p := refiner.Observe(calibration.RefineObservation{
+		Timestamp:     bat.Timestamp,
+		BrightnessPct: float64(bl.Brightness) * 100 / float64(bl.MaxBrightness),
+		PowerUW:       bat.PowerUW,
+		CPUTicks:      stats.TotalTicks,
+		Discharging:   bat.Status == "Discharging",
+	})
+	if p == nil {
+		return
+	}
+	logger.Info("display model point",
+		"brightness_pct", fmt.Sprintf("%.1f", p.BrightnessPct),
+		"power_uw", p.PowerUW,
+		"cpu_ticks", fmt.Sprintf("%.1f", p.CPUTicks))
+	if err := store.InsertDisplayModelPoint(*p); err != nil {
+		logger.Error("store display model point", "err", err)
+	}
+}
+
+// timedProcessCollect runs one process scan and records its duration as the
+// "process" collector timing.
+func timedProcessCollect(svc *dbussvc.Service, pc *collector.ProcessCollector) ([]collector.ProcessSample, []collector.CPUFreqSample, *collector.ProcessCollectStats, error) {
+	start := time.Now()
+	defer func() { svc.RecordCollectTime("process", time.Since(start)) }()
+	return pc.Collect()
+}
+
+// reloadConfig re-reads the config file on SIGHUP. It logs every changed
+// setting and returns the file's config along with cur updated by only the
+// settings that apply without a restart; the rest are logged as warnings.
+// ok is false when the file cannot be loaded and cur stays in effect.
+func reloadConfig(path string, cur *config.Config, logger *slog.Logger) (loaded, applied *config.Config, ok bool) {
+	loaded, err := config.Load(path)
+	if err != nil {
+		logger.Error("reload config, keeping current settings", "path", path, "err", err)
+		return nil, nil, false
+	}
+	changes := config.Diff(cur, loaded)
+	if len(changes) == 0 {
+		logger.Info("reloaded config, nothing changed", "path", path)
+	}
+	for _, c := range changes {
+		if c.Hot {
+			logger.Info("config setting changed", "key", c.Key, "old", c.Old, "new", c.New)
+		} else {
+			logger.Warn("config setting changed, restart the daemon to apply it", "key", c.Key, "old", c.Old, "new", c.New)
+		}
+	}
+	return loaded, config.ApplyHot(cur, loaded), true
+}
+
+// recordAnnotations stores automatic timeline annotations.
+func recordAnnotations(store *storage.DB, logger *slog.Logger, annotations []collector.Annotation) {
+	for _, a := range annotations {
+		logger.Info("annotating timeline", "timestamp", a.Timestamp, "text", a.Text)
+		if _, err := store.InsertAnnotation(a); err != nil {
+			logger.Error("store annotation", "err", err)
+		}
+	}
+}
+
+// annotatorOptions maps the annotation settings onto the battery event
+// detectors.
+func annotatorOptions(cfg config.AnnotationsConfig) collector.AnnotatorOptions {
+	opts := collector.AnnotatorOptions{ACTransitions: cfg.ACTransitions}
+	if cfg.PowerSpikes {
+		opts.PowerSpikeUW = int64(cfg.PowerSpikeWatts) * 1_000_000
+	}
+	return opts
+}
+
+// capacityDropPercent returns the capacity drop to annotate, or 0 when
+// capacity drops are not annotated.
+func capacityDropPercent(cfg config.AnnotationsConfig) int {
+	if !cfg.CapacityDrops {
+		return 0
+	}
+	return cfg.CapacityDropPercent
+}
+
+// recordHealthSnapshot stores the battery's health when it changed. With a
+// positive dropPct, a new snapshot at least that many percent below the
+// previous one is annotated on the timeline.
+func recordHealthSnapshot(store *storage.DB, battery string, dropPct, retentionDays int, logger *slog.Logger) {
+	health, err := collector.CollectBatteryHealth(battery)
+	if err != nil {
+		logger.Debug("collect battery health failed", "err", err)
+		return
+	}
+	inserted, err := store.InsertBatteryHealthSnapshot(collector.BatteryHealthSnapshot{
+		Timestamp:           time.Now().Unix(),
+		ChargeFullUAH:       health.ChargeFullUAH,
+		ChargeFullDesignUAH: health.ChargeFullDesignUAH,
+		CycleCount:          health.CycleCount,
+	})
+	if err != nil {
+		logger.Error("store battery health snapshot", "err", err)
+	} else if inserted {
+		logger.Info("recorded battery health snapshot",
+			"charge_full_uah", health.ChargeFullUAH,
+			"cycle_count", health.CycleCount)
+		if dropPct > 0 {
+			annotateCapacityDrops(store, logger, float64(dropPct), retentionDays)
+		}
+	}
+}
+
+// annotateCapacityDrops annotates each capacity drop of at least minDropPct
+// across the stored health snapshots that has no capacity drop annotation
+// yet, so drops recorded before annotating was turned on are marked too.
+// Drops older than the retention period are skipped, as cleanup would prune
+// their annotations again.
+func annotateCapacityDrops(store *storage.DB, logger *slog.Logger, minDropPct float64, retentionDays int) {
+	snapshots, err := store.BatteryHealthSnapshots()
+	if err != nil {
+		logger.Error("query battery health snapshots", "err", err)
+		return
+	}
+	since := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	var annotations []collector.Annotation
+	for _, d := range collector.DetectCapacityDrops(snapshots, minDropPct) {
+		if d.Timestamp < since {
+			continue
+		}
+		existing, err := store.AnnotationsInRange(d.Timestamp, d.Timestamp)
+		if err != nil {
+			logger.Error("query annotations", "err", err)
+			return
+		}
+		if !slices.ContainsFunc(existing, collector.IsCapacityDropAnnotation) {
+			annotations = append(annotations, collector.CapacityDropAnnotation(d))
+		}
+	}
+	recordAnnotations(store, logger, annotations)
 }
 
-func importStateLog(store *storage.DB, logger *slog.Logger, stateLogPath string) {
-	events := collector.ReadAndConsumeStateLog(logger, time.Now(), stateLogPath)
+// importStateLog stores the new power state events from the state log and,
+// with annotate, marks each on the timeline.
+func importStateLog(store *storage.DB, logger *slog.Logger, storageCfg config.StorageConfig, annotate bool) {
+	events := collector.ReadAndConsumeStateLog(logger, time.Now(), storageCfg.StateLogPath, stateLogOptions(storageCfg))
 	if len(events) == 0 {
 		logger.Debug("no new power state events in state log")
 		return
@@ -310,12 +848,75 @@ func importStateLog(store *storage.DB, logger *slog.Logger, stateLogPath string)
 		} else if inserted {
 			logger.Info("imported power state event",
 				"type", evt.Type,
+				"subtype", evt.Subtype,
 				"start", evt.StartTime,
 				"end", evt.EndTime,
 				"suspend_secs", evt.SuspendSecs,
-				"hibernate_secs", evt.HibernateSecs)
+				"hibernate_secs", evt.HibernateSecs,
+				"suspect", evt.Suspect)
+			if annotate {
+				recordAnnotations(store, logger, collector.PowerStateAnnotations(evt))
+			}
 		} else {
-			logger.Debug("duplicate power state event skipped", "start", evt.StartTime)
+			logger.Debug("power state event already covered, skipped", "start", evt.StartTime)
 		}
 	}
 }
+
+// stateLogOptions maps the storage settings onto state log handling.
+func stateLogOptions(storageCfg config.StorageConfig) collector.StateLogOptions {
+	return collector.StateLogOptions{
+		ArchiveDir:   storageCfg.StateLogArchiveDir,
+		MaxSleepSecs: int64(storageCfg.MaxSleepDays) * 86400,
+	}
+}
+
+// replayStateLog prints the events reconstructed from an archived state log
+// as indented JSON on stdout, without touching the database.
+func replayStateLog(path string, storageCfg config.StorageConfig, logger *slog.Logger) error {
+	events, err := collector.ReplayStateLog(logger, path, stateLogOptions(storageCfg))
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		events = []collector.PowerStateEvent{}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(events)
+}
+
+// diagnosticBundleWindow is how much recent time-series data a diagnostic
+// bundle includes.
+const diagnosticBundleWindow = 24 * time.Hour
+
+// writeDiagnosticBundle writes a diagnostic zip to path. The database is
+// opened without recovery so a corrupt file is reported, not moved aside;
+// the bundle is still written without its data.
+func writeDiagnosticBundle(path string, cfg *config.Config, redact bool) error {
+	// With tmpfs_dir the live copy is the newest, unless a reboot cleared it.
+	dbPath := cfg.Storage.LiveDBPath()
+	if _, err := os.Stat(dbPath); err != nil {
+		dbPath = cfg.Storage.DBPath
+	}
+	store, storeErr := storage.Open(dbPath)
+	if storeErr == nil {
+		defer store.Close()
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = diagnostics.WriteBundle(f, diagnostics.Options{
+		Store:    store,
+		StoreErr: storeErr,
+		Config:   cfg,
+		Since:    time.Now().Add(-diagnosticBundleWindow),
+		Redact:   redact,
+	})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -37,6 +37,21 @@ const PowerMonitorProxyIface = `
 
 const PowerMonitorProxy = Gio.DBusProxy.makeProxyWrapper(PowerMonitorProxyIface);
 
+// Newest reply envelope version the extension understands.
+const DBUS_API_VERSION = 1;
+
+// Parses a daemon reply. Replies are wrapped as {"v":N,"data":...}; daemons
+// predating the envelope send the data bare, which is still accepted.
+function parseReply(json) {
+    const reply = JSON.parse(json);
+    if (reply === null || typeof reply !== 'object' || Array.isArray(reply) ||
+        typeof reply.v !== 'number' || !('data' in reply))
+        return reply;
+    if (reply.v > DBUS_API_VERSION)
+        throw new Error(`daemon reply version ${reply.v} is newer than supported version ${DBUS_API_VERSION}`);
+    return reply.data;
+}
+
 const TIME_RANGES = [
     {label: '15m', seconds: 900},
     {label: '1h',  seconds: 3600},
@@ -253,11 +268,13 @@ class PowerMonitorIndicator extends PanelMenu.Button {
         this._proxy.GetCurrentStatsRemote((result, error) => {
             if (error) { this._label.text = '?? W'; return; }
             try {
-                const data = JSON.parse(result[0]);
+                const data = parseReply(result[0]);
                 const bat = data.battery;
                 const bl = data.backlight;
                 if (bat) {
-                    const watts = (bat.power_uw / 1e6).toFixed(1);
+                    // Prefer the daemon's long-window average when it keeps one.
+                    const uw = bat.power_smoothed_uw > 0 ? bat.power_smoothed_uw : bat.power_uw;
+                    const watts = (uw / 1e6).toFixed(1);
                     this._label.text = `${watts} W`;
                     this._powerLabel.text = `${watts} W`;
                     this._batteryLabel.text = `${bat.capacity_pct}%`;
@@ -280,13 +297,13 @@ class PowerMonitorIndicator extends PanelMenu.Button {
 
         this._proxy.GetHistoryRemote(from, to, (result, error) => {
             if (error) return;
-            try { this._graphData = JSON.parse(result[0]); } catch (e) { /* */ }
+            try { this._graphData = parseReply(result[0]); } catch (e) { /* */ }
             this._batteryGraphArea.queue_repaint();
             this._energyGraphArea.queue_repaint();
         });
         this._proxy.GetPowerStateEventsRemote(from, to, (result, error) => {
             if (error) return;
-            try { this._sleepData = JSON.parse(result[0]); } catch (e) { /* */ }
+            try { this._sleepData = parseReply(result[0]); } catch (e) { /* */ }
             this._batteryGraphArea.queue_repaint();
             this._energyGraphArea.queue_repaint();
         });
@@ -1,12 +1,18 @@
 package calibration
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
@@ -20,7 +26,11 @@ type CalibrationResult struct {
 	BaselinePowerUW  int64              `json:"baseline_power_uw"`
 	Samples          []BrightnessSample `json:"samples"`
 	CPUFrequencyKHz  int64              `json:"cpu_frequency_khz"`
+	BacklightDevice  string             `json:"backlight_device,omitempty"`
 	CalibratedAt     string             `json:"calibrated_at"`
+	// Source is empty for a calibration measured on this device and
+	// SourceCommunity for an estimate built from a CommunityExport.
+	Source string `json:"source,omitempty"`
 }
 
 // BrightnessSample holds power at a given brightness level.
@@ -30,6 +40,10 @@ type BrightnessSample struct {
 	AvgPowerErrorUW       int64 `json:"avg_power_error_uw"`
 	DeltaChargeUAH        int64 `json:"delta_charge_uah"`
 	ChargeQuantizationUAH int64 `json:"charge_quantization_uah"`
+	// ChargeSteps counts the charge_now changes between the window's start
+	// and end readings; more steps mean a smaller relative quantization
+	// error. 0 for the power_now fallback.
+	ChargeSteps int `json:"charge_steps"`
 }
 
 // BatterySampler provides battery samples for calibration measurements.
@@ -39,20 +53,53 @@ type BatterySampler interface {
 
 const defaultChargeQuantizationUAH int64 = 1000
 
+// powerNowErrorFloorPct is the minimum uncertainty, as a percentage of the
+// average, assigned to a power_now measurement. Unlike the charge delta,
+// power_now is a firmware estimate with no known quantization, so the
+// scatter of the readings alone understates its error.
+const powerNowErrorFloorPct = 5
+
+// PinRecoveryPath is where PinCPU records the original CPU settings until they
+// are restored, so a crashed or killed run can be undone later by
+// RestoreStalePin. It lives under /run because a reboot resets the settings
+// anyway.
+var PinRecoveryPath = "/run/power-monitor/cpu-pin.json"
+
+// pinWrite is one sysfs value to write back when unpinning.
+type pinWrite struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// pinRecovery is the content of PinRecoveryPath.
+type pinRecovery struct {
+	PID      int        `json:"pid"`
+	PinnedAt string     `json:"pinned_at"`
+	Restore  []pinWrite `json:"restore"` // applied in order
+}
+
 // PinCPU disables turbo boost and locks all CPU cores to base frequency.
 // Returns a restore function that undoes the changes.
+//
+// The original settings are saved to PinRecoveryPath before anything is
+// changed and the file is removed by restore. A stale file from an earlier
+// run that died while pinned is restored first.
 func PinCPU() (restore func(), err error) {
-	var restoreFns []func()
+	if _, err := RestoreStalePin(); err != nil {
+		return nil, err
+	}
+
+	// undo lists the writes that reverse the pinning, in the order they
+	// must be applied: the reverse of the order they are planned in.
+	var undo []pinWrite
+	var apply []func() error
 
 	// Disable turbo boost (intel_pstate).
 	turboPath := "/sys/devices/system/cpu/intel_pstate/no_turbo"
+	hasTurbo := false
 	if origTurbo, err := readSysFile(turboPath); err == nil {
-		if err := os.WriteFile(turboPath, []byte("1"), 0644); err != nil {
-			return nil, fmt.Errorf("disable turbo: %w", err)
-		}
-		restoreFns = append(restoreFns, func() {
-			os.WriteFile(turboPath, []byte(origTurbo), 0644)
-		})
+		hasTurbo = true
+		undo = append(undo, pinWrite{turboPath, origTurbo})
 	}
 
 	// Find all CPU cores.
@@ -80,60 +127,197 @@ func PinCPU() (restore func(), err error) {
 		curGov, _ := readSysFile(filepath.Join(cpufreqDir, "scaling_governor"))
 		log.Printf("  cpu-pin: %s: base=%s kHz  current min=%s max=%s gov=%s", cpuName, baseFreq, curMin, curMax, curGov)
 
-		// Save and set governor.
 		govPath := filepath.Join(cpufreqDir, "scaling_governor")
-		if err := os.WriteFile(govPath, []byte("powersave"), 0644); err == nil {
-			origGovCopy := curGov
-			govPathCopy := govPath
-			restoreFns = append(restoreFns, func() {
-				os.WriteFile(govPathCopy, []byte(origGovCopy), 0644)
-			})
-		}
-
-		// Order matters: if target < current min, lower min first.
-		// If target > current max, raise max first.
 		minPath := filepath.Join(cpufreqDir, "scaling_min_freq")
 		maxPath := filepath.Join(cpufreqDir, "scaling_max_freq")
-		origMin := curMin
-		origMax := curMax
-
-		// Lower min first (so max can go below old min).
-		if err := os.WriteFile(minPath, []byte(baseFreq), 0644); err != nil {
-			log.Printf("  cpu-pin: %s: set min=%s failed: %v", cpuName, baseFreq, err)
-		}
-		// Then set max.
-		if err := os.WriteFile(maxPath, []byte(baseFreq), 0644); err != nil {
-			log.Printf("  cpu-pin: %s: set max=%s failed: %v", cpuName, baseFreq, err)
-		}
-		// Re-set min in case it needed max lowered first.
-		if err := os.WriteFile(minPath, []byte(baseFreq), 0644); err != nil {
-			log.Printf("  cpu-pin: %s: set min=%s (retry) failed: %v", cpuName, baseFreq, err)
-		}
-
-		// Verify.
-		actualFreq, _ := readSysFile(filepath.Join(cpufreqDir, "scaling_cur_freq"))
-		log.Printf("  cpu-pin: %s: locked to %s kHz (actual: %s kHz)", cpuName, baseFreq, actualFreq)
-
-		// Restore closures — restore max first, then min (reverse of lock order).
-		origMaxCopy := origMax
-		maxPathCopy := maxPath
-		origMinCopy := origMin
-		minPathCopy := minPath
-		restoreFns = append(restoreFns, func() {
-			os.WriteFile(maxPathCopy, []byte(origMaxCopy), 0644)
-			os.WriteFile(minPathCopy, []byte(origMinCopy), 0644)
+
+		// Restore max first, then min (reverse of lock order), then the
+		// governor; undo is applied back to front.
+		undo = append(undo, pinWrite{govPath, curGov}, pinWrite{minPath, curMin}, pinWrite{maxPath, curMax})
+
+		apply = append(apply, func() error {
+			gov, err := lockCPUFreq(cpufreqDir, baseFreq)
+			if err != nil {
+				return fmt.Errorf("%s: %w", cpuName, err)
+			}
+
+			// Verify.
+			actualFreq, _ := readSysFile(filepath.Join(cpufreqDir, "scaling_cur_freq"))
+			log.Printf("  cpu-pin: %s: locked to %s kHz with %s governor (actual: %s kHz)", cpuName, baseFreq, gov, actualFreq)
+			return nil
 		})
 	}
 
+	slices.Reverse(undo)
+	if err := writePinRecovery(pinRecovery{
+		PID:      os.Getpid(),
+		PinnedAt: time.Now().UTC().Format(time.RFC3339),
+		Restore:  undo,
+	}); err != nil {
+		return nil, fmt.Errorf("save CPU settings for recovery: %w", err)
+	}
+
+	if hasTurbo {
+		if err := os.WriteFile(turboPath, []byte("1"), 0644); err != nil {
+			restorePinWrites(undo)
+			os.Remove(PinRecoveryPath)
+			return nil, fmt.Errorf("disable turbo: %w", err)
+		}
+	}
+	for _, f := range apply {
+		if err := f(); err != nil {
+			restorePinWrites(undo)
+			os.Remove(PinRecoveryPath)
+			return nil, fmt.Errorf("pin CPU frequency: %w", err)
+		}
+	}
+
 	restore = func() {
-		// Restore in reverse order.
-		for i := len(restoreFns) - 1; i >= 0; i-- {
-			restoreFns[i]()
+		restorePinWrites(undo)
+		if err := os.Remove(PinRecoveryPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("  cpu-pin: remove %s: %v", PinRecoveryPath, err)
 		}
 	}
 	return restore, nil
 }
 
+// lockGovernors are the cpufreq governors that hold a core at a fixed
+// frequency once scaling_min_freq = scaling_max_freq, in order of preference.
+// userspace additionally pins scaling_setspeed, so it does not depend on the
+// governor honoring the limits.
+var lockGovernors = []string{"userspace", "powersave"}
+
+// chooseGovernor picks the preferred lockGovernors entry from a
+// scaling_available_governors list.
+func chooseGovernor(available []string) (string, error) {
+	for _, g := range lockGovernors {
+		if slices.Contains(available, g) {
+			return g, nil
+		}
+	}
+	return "", fmt.Errorf("no governor that can lock the frequency (need one of %s, have %s)",
+		strings.Join(lockGovernors, ", "), strings.Join(available, ", "))
+}
+
+// lockCPUFreq fixes the core in cpufreqDir at freq kHz: it selects a
+// governor from scaling_available_governors (powersave when the list is
+// missing), sets min = max = freq, and for userspace also scaling_setspeed.
+// The governor is read back to make sure the kernel accepted it.
+func lockCPUFreq(cpufreqDir, freq string) (governor string, err error) {
+	governor = "powersave"
+	if list, err := readSysFile(filepath.Join(cpufreqDir, "scaling_available_governors")); err == nil {
+		if governor, err = chooseGovernor(strings.Fields(list)); err != nil {
+			return "", err
+		}
+	}
+
+	govPath := filepath.Join(cpufreqDir, "scaling_governor")
+	if err := os.WriteFile(govPath, []byte(governor), 0644); err != nil {
+		return "", fmt.Errorf("set governor %s: %w", governor, err)
+	}
+	if got, err := readSysFile(govPath); err != nil || got != governor {
+		return "", fmt.Errorf("set governor %s: kernel reports %q", governor, got)
+	}
+
+	// Order matters: if target < current min, lower min first.
+	// If target > current max, raise max first.
+	minPath := filepath.Join(cpufreqDir, "scaling_min_freq")
+	maxPath := filepath.Join(cpufreqDir, "scaling_max_freq")
+	cpuName := filepath.Base(filepath.Dir(cpufreqDir))
+
+	// Lower min first (so max can go below old min).
+	if err := os.WriteFile(minPath, []byte(freq), 0644); err != nil {
+		log.Printf("  cpu-pin: %s: set min=%s failed: %v", cpuName, freq, err)
+	}
+	// Then set max.
+	if err := os.WriteFile(maxPath, []byte(freq), 0644); err != nil {
+		log.Printf("  cpu-pin: %s: set max=%s failed: %v", cpuName, freq, err)
+	}
+	// Re-set min in case it needed max lowered first.
+	if err := os.WriteFile(minPath, []byte(freq), 0644); err != nil {
+		log.Printf("  cpu-pin: %s: set min=%s (retry) failed: %v", cpuName, freq, err)
+	}
+
+	if governor == "userspace" {
+		if err := os.WriteFile(filepath.Join(cpufreqDir, "scaling_setspeed"), []byte(freq), 0644); err != nil {
+			return "", fmt.Errorf("set userspace speed %s: %w", freq, err)
+		}
+	}
+	return governor, nil
+}
+
+// RestoreStalePin restores the CPU settings saved in PinRecoveryPath by a run
+// that ended without unpinning, and removes the file. It reports whether
+// anything was restored. A file owned by a process that is still running is
+// left alone and reported as an error.
+func RestoreStalePin() (restored bool, err error) {
+	data, err := os.ReadFile(PinRecoveryPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read CPU pin recovery file: %w", err)
+	}
+	var rec pinRecovery
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return false, fmt.Errorf("parse CPU pin recovery file %s: %w", PinRecoveryPath, err)
+	}
+	if rec.PID != os.Getpid() && processAlive(rec.PID) {
+		return false, fmt.Errorf("CPU is pinned by running process %d (since %s)", rec.PID, rec.PinnedAt)
+	}
+
+	log.Printf("  cpu-pin: restoring CPU settings left pinned by process %d at %s", rec.PID, rec.PinnedAt)
+	restorePinWrites(rec.Restore)
+	if err := os.Remove(PinRecoveryPath); err != nil {
+		return true, fmt.Errorf("remove CPU pin recovery file: %w", err)
+	}
+	return true, nil
+}
+
+// restorePinWrites applies writes in order. Failures are logged and skipped
+// so one missing core does not leave the rest pinned.
+func restorePinWrites(writes []pinWrite) {
+	for _, w := range writes {
+		if err := os.WriteFile(w.Path, []byte(w.Value), 0644); err != nil {
+			log.Printf("  cpu-pin: restore %s=%s failed: %v", w.Path, w.Value, err)
+		}
+	}
+}
+
+// writePinRecovery atomically replaces PinRecoveryPath with rec.
+func writePinRecovery(rec pinRecovery) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(PinRecoveryPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".cpu-pin-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), PinRecoveryPath)
+}
+
+// processAlive reports whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
 // GetCPUFrequency returns the current scaling frequency of cpu0 in kHz.
 func GetCPUFrequency() (int64, error) {
 	s, err := readSysFile("/sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq")
@@ -143,12 +327,9 @@ func GetCPUFrequency() (int64, error) {
 	return strconv.ParseInt(s, 10, 64)
 }
 
-// SetBrightness sets the backlight brightness as a percentage (0-100).
-func SetBrightness(pct int) error {
-	blDir, err := findBacklightDir()
-	if err != nil {
-		return err
-	}
+// SetBrightness sets the brightness of the backlight in sysfs directory blDir
+// as a percentage (0-100).
+func SetBrightness(blDir string, pct int) error {
 	maxStr, err := readSysFile(filepath.Join(blDir, "max_brightness"))
 	if err != nil {
 		return fmt.Errorf("read max_brightness: %w", err)
@@ -161,12 +342,9 @@ func SetBrightness(pct int) error {
 	return os.WriteFile(filepath.Join(blDir, "brightness"), []byte(strconv.FormatInt(target, 10)), 0644)
 }
 
-// GetBrightness returns the current and max brightness values.
-func GetBrightness() (current, max int64, err error) {
-	blDir, err := findBacklightDir()
-	if err != nil {
-		return 0, 0, err
-	}
+// GetBrightness returns the current and max brightness values of the
+// backlight in sysfs directory blDir.
+func GetBrightness(blDir string) (current, max int64, err error) {
 	curStr, err := readSysFile(filepath.Join(blDir, "brightness"))
 	if err != nil {
 		return 0, 0, err
@@ -184,50 +362,68 @@ func GetBrightness() (current, max int64, err error) {
 // It waits for the next quantized charge-step change, then measures energy
 // using charge delta across the window and average sampled voltage.
 func MeasurePowerOverWindow(bs BatterySampler, window, poll time.Duration) (int64, error) {
-	powerUW, _, _, _, err := MeasurePowerOverWindowWithDiagnostics(bs, window, poll, nil)
+	powerUW, _, _, _, _, err := MeasurePowerOverWindowWithDiagnostics(bs, window, poll, DefaultMaxStepWait, nil)
 	return powerUW, err
 }
 
 // MeasurePowerOverWindowWithDiagnostics measures average power over the next
 // fixed window and emits optional per-sample diagnostics.
+//
+// On batteries that report no charge_now it averages the instantaneous
+// power_now (or voltage × current) readings over the window instead, and
+// returns a zero deltaChargeUAH, chargeQuantizationUAH and chargeSteps to
+// mark the result as the less certain fallback.
+//
+// Each wait for a charge step, before and after the window, gives up after
+// maxStepWait (reported as a "charge-step-timeout" or
+// "end-charge-step-timeout" phase) and uses the charge reading at hand. Such
+// an endpoint is not on a step boundary, so it adds a full quantization step
+// to the error instead of half of one.
 func MeasurePowerOverWindowWithDiagnostics(
 	bs BatterySampler,
-	window, poll time.Duration,
+	window, poll, maxStepWait time.Duration,
 	onSample func(phase string, elapsed, remaining time.Duration, chargeNowUAH, voltageUV int64),
-) (powerUW, powerErrorUW, deltaChargeUAH, chargeQuantizationUAH int64, err error) {
+) (powerUW, powerErrorUW, deltaChargeUAH, chargeQuantizationUAH int64, chargeSteps int, err error) {
 	if window <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("window must be > 0")
+		return 0, 0, 0, 0, 0, fmt.Errorf("window must be > 0")
 	}
 	if poll <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("poll interval must be > 0")
+		return 0, 0, 0, 0, 0, fmt.Errorf("poll interval must be > 0")
+	}
+	if maxStepWait <= 0 {
+		return 0, 0, 0, 0, 0, fmt.Errorf("max charge-step wait must be > 0")
 	}
 
 	initialSample, err := bs.Collect()
 	if err != nil {
-		return 0, 0, 0, 0, fmt.Errorf("collect initial sample: %w", err)
+		return 0, 0, 0, 0, 0, fmt.Errorf("collect initial sample: %w", err)
 	}
 	if initialSample.ChargeNowUAH <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("initial charge sample unavailable")
+		if initialSample.SysfsPowerUW <= 0 {
+			return 0, 0, 0, 0, 0, fmt.Errorf("battery reports neither charge nor power")
+		}
+		powerUW, powerErrorUW, err = measurePowerNowOverWindow(bs, window, poll, initialSample, onSample)
+		return powerUW, powerErrorUW, 0, 0, 0, err
 	}
 
 	waitStart := time.Now()
-	maxWait := 10 * window
-	if maxWait < 500*time.Millisecond {
-		maxWait = 500 * time.Millisecond
-	}
-
 	chargeBeforeStep := initialSample.ChargeNowUAH
 	startSample := initialSample
 	observedQuantizationUAH := int64(0)
+	unalignedEnds := int64(0) // endpoints taken without a charge step
 	for {
-		if time.Since(waitStart) > maxWait {
-			return 0, 0, 0, 0, fmt.Errorf("timed out waiting for charge-step change")
+		if time.Since(waitStart) > maxStepWait {
+			unalignedEnds++
+			if onSample != nil {
+				onSample("charge-step-timeout", time.Since(waitStart), 0, startSample.ChargeNowUAH, startSample.VoltageUV)
+			}
+			break
 		}
 
 		time.Sleep(poll)
 		sample, err := bs.Collect()
 		if err != nil {
-			return 0, 0, 0, 0, fmt.Errorf("collect charge-step sample: %w", err)
+			return 0, 0, 0, 0, 0, fmt.Errorf("collect charge-step sample: %w", err)
 		}
 
 		if onSample != nil {
@@ -240,8 +436,8 @@ func MeasurePowerOverWindowWithDiagnostics(
 		if step := absInt64(sample.ChargeNowUAH - chargeBeforeStep); step > 0 {
 			observedQuantizationUAH = minNonZeroInt64(observedQuantizationUAH, step)
 		}
+		startSample = sample
 		if sample.ChargeNowUAH != chargeBeforeStep {
-			startSample = sample
 			break
 		}
 	}
@@ -271,12 +467,13 @@ func MeasurePowerOverWindowWithDiagnostics(
 
 		sample, err := bs.Collect()
 		if err != nil {
-			return 0, 0, 0, 0, fmt.Errorf("collect window sample: %w", err)
+			return 0, 0, 0, 0, 0, fmt.Errorf("collect window sample: %w", err)
 		}
 		now := time.Now()
 		if sample.ChargeNowUAH > 0 && lastChargeUAH > 0 {
 			if step := absInt64(sample.ChargeNowUAH - lastChargeUAH); step > 0 {
 				observedQuantizationUAH = minNonZeroInt64(observedQuantizationUAH, step)
+				chargeSteps++
 			}
 			lastChargeUAH = sample.ChargeNowUAH
 		}
@@ -296,22 +493,23 @@ func MeasurePowerOverWindowWithDiagnostics(
 	}
 
 	endWaitStart := time.Now()
-	endWaitMax := 10 * window
-	if endWaitMax < 500*time.Millisecond {
-		endWaitMax = 500 * time.Millisecond
-	}
-
 	endSample := startSample
+	endSample.ChargeNowUAH = lastChargeUAH
 	endTime := time.Time{}
 	for {
-		if time.Since(endWaitStart) > endWaitMax {
-			return 0, 0, 0, 0, fmt.Errorf("timed out waiting for end charge-step change")
+		if time.Since(endWaitStart) > maxStepWait {
+			unalignedEnds++
+			endTime = time.Now()
+			if onSample != nil {
+				onSample("end-charge-step-timeout", endTime.Sub(startTime), 0, endSample.ChargeNowUAH, endSample.VoltageUV)
+			}
+			break
 		}
 
 		time.Sleep(poll)
 		sample, err := bs.Collect()
 		if err != nil {
-			return 0, 0, 0, 0, fmt.Errorf("collect end charge-step sample: %w", err)
+			return 0, 0, 0, 0, 0, fmt.Errorf("collect end charge-step sample: %w", err)
 		}
 		now := time.Now()
 
@@ -330,6 +528,7 @@ func MeasurePowerOverWindowWithDiagnostics(
 		if sample.ChargeNowUAH != lastChargeUAH {
 			endSample = sample
 			endTime = now
+			chargeSteps++
 			break
 		}
 	}
@@ -340,29 +539,32 @@ func MeasurePowerOverWindowWithDiagnostics(
 
 	elapsed := endTime.Sub(startTime)
 	if elapsed <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("measurement window elapsed time is zero")
+		return 0, 0, 0, 0, 0, fmt.Errorf("measurement window elapsed time is zero")
 	}
 	if startChargeUAH <= 0 || endSample.ChargeNowUAH <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("charge samples unavailable for measurement")
+		return 0, 0, 0, 0, 0, fmt.Errorf("charge samples unavailable for measurement")
 	}
 
 	deltaChargeUAH = absInt64(startChargeUAH - endSample.ChargeNowUAH)
 	if deltaChargeUAH == 0 {
-		return 0, 0, 0, 0, fmt.Errorf("charge did not change over measurement window")
+		if unalignedEnds > 0 {
+			return 0, 0, 0, 0, 0, fmt.Errorf("charge did not change over measurement window (no charge step within %v; is the battery charging or not updating?)", maxStepWait)
+		}
+		return 0, 0, 0, 0, 0, fmt.Errorf("charge did not change over measurement window")
 	}
 
 	if voltageCount <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("no valid voltage samples for measurement")
+		return 0, 0, 0, 0, 0, fmt.Errorf("no valid voltage samples for measurement")
 	}
 	avgVoltageUV := voltageSum / voltageCount
 	if avgVoltageUV <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("average voltage is not positive")
+		return 0, 0, 0, 0, 0, fmt.Errorf("average voltage is not positive")
 	}
 
 	// power_uW = delta_charge_uAh * avg_voltage_uV * 3_600_000 / elapsed_ns
 	powerUW = (deltaChargeUAH * avgVoltageUV * 3600000) / elapsed.Nanoseconds()
 	if powerUW <= 0 {
-		return 0, 0, 0, 0, fmt.Errorf("computed power is not positive")
+		return 0, 0, 0, 0, 0, fmt.Errorf("computed power is not positive")
 	}
 
 	chargeQuantizationUAH = observedQuantizationUAH
@@ -371,13 +573,79 @@ func MeasurePowerOverWindowWithDiagnostics(
 	}
 
 	// Propagate dominant uncertainty from quantized charge readings.
-	// With endpoint quantization +/-q/2 each, delta-charge uncertainty is +/-q.
-	powerErrorUW = (chargeQuantizationUAH * avgVoltageUV * 3600000) / elapsed.Nanoseconds()
+	// An endpoint on a step boundary is good to +/-q/2, one taken after a
+	// step-wait timeout only to +/-q, so with both aligned the delta-charge
+	// uncertainty is +/-q.
+	chargeErrorUAH := chargeQuantizationUAH * (2 + unalignedEnds) / 2
+	powerErrorUW = (chargeErrorUAH * avgVoltageUV * 3600000) / elapsed.Nanoseconds()
 	if powerErrorUW < 0 {
 		powerErrorUW = -powerErrorUW
 	}
 
-	return powerUW, powerErrorUW, deltaChargeUAH, chargeQuantizationUAH, nil
+	return powerUW, powerErrorUW, deltaChargeUAH, chargeQuantizationUAH, chargeSteps, nil
+}
+
+// measurePowerNowOverWindow averages the sysfs power readings over window,
+// starting with first. The error is the standard error of the mean, but never
+// less than powerNowErrorFloorPct of the average.
+func measurePowerNowOverWindow(
+	bs BatterySampler,
+	window, poll time.Duration,
+	first *collector.BatterySample,
+	onSample func(phase string, elapsed, remaining time.Duration, chargeNowUAH, voltageUV int64),
+) (powerUW, powerErrorUW int64, err error) {
+	var readings []float64
+	if first.SysfsPowerUW > 0 {
+		readings = append(readings, float64(first.SysfsPowerUW))
+	}
+
+	startTime := time.Now()
+	deadline := startTime.Add(window)
+	last := first
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		time.Sleep(min(poll, remaining))
+
+		sample, err := bs.Collect()
+		if err != nil {
+			return 0, 0, fmt.Errorf("collect window sample: %w", err)
+		}
+		last = sample
+		if onSample != nil {
+			onSample("window", time.Since(startTime), max(time.Until(deadline), 0), sample.ChargeNowUAH, sample.VoltageUV)
+		}
+		if sample.SysfsPowerUW > 0 {
+			readings = append(readings, float64(sample.SysfsPowerUW))
+		}
+	}
+	if onSample != nil {
+		onSample("end", time.Since(startTime), 0, last.ChargeNowUAH, last.VoltageUV)
+	}
+
+	if len(readings) == 0 {
+		return 0, 0, fmt.Errorf("no power readings over measurement window")
+	}
+	var sum float64
+	for _, r := range readings {
+		sum += r
+	}
+	mean := sum / float64(len(readings))
+
+	var stdErr float64
+	if n := float64(len(readings)); n > 1 {
+		var sq float64
+		for _, r := range readings {
+			sq += (r - mean) * (r - mean)
+		}
+		stdErr = math.Sqrt(sq/(n-1)) / math.Sqrt(n)
+	}
+
+	powerUW = int64(math.Round(mean))
+	powerErrorUW = max(int64(math.Round(stdErr)), powerUW*powerNowErrorFloorPct/100)
+	return powerUW, powerErrorUW, nil
 }
 
 func absInt64(v int64) int64 {
@@ -400,14 +668,6 @@ func minNonZeroInt64(a, b int64) int64 {
 	return b
 }
 
-func findBacklightDir() (string, error) {
-	matches, err := filepath.Glob("/sys/class/backlight/*")
-	if err != nil || len(matches) == 0 {
-		return "", fmt.Errorf("no backlight found")
-	}
-	return matches[0], nil
-}
-
 func readSysFile(path string) (string, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -1,6 +1,11 @@
 package calibration
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -53,9 +58,71 @@ func TestMeasurePowerOverWindow_ErrorsWithoutChargeStep(t *testing.T) {
 		{ChargeNowUAH: 5000000, VoltageUV: 12000000, PowerUW: 6000000},
 	}}
 
-	powerUW, err := MeasurePowerOverWindow(bs, 10*time.Millisecond, 2*time.Millisecond)
+	var phases []string
+	powerUW, _, _, _, _, err := MeasurePowerOverWindowWithDiagnostics(bs, 10*time.Millisecond, 2*time.Millisecond, 20*time.Millisecond,
+		func(phase string, _, _ time.Duration, _, _ int64) {
+			if strings.HasSuffix(phase, "timeout") {
+				phases = append(phases, phase)
+			}
+		})
 	if err == nil {
-		t.Fatalf("MeasurePowerOverWindow() = %d, want error", powerUW)
+		t.Fatalf("MeasurePowerOverWindowWithDiagnostics() = %d, want error", powerUW)
+	}
+	if want := []string{"charge-step-timeout", "end-charge-step-timeout"}; !slices.Equal(phases, want) {
+		t.Fatalf("timeout phases = %q, want %q", phases, want)
+	}
+}
+
+// timedBatterySampler reports charge dropping by stepUAH at stepAt and, if
+// stepEvery is set, every stepEvery after that.
+type timedBatterySampler struct {
+	start     time.Time
+	stepAt    time.Duration
+	stepEvery time.Duration
+	stepUAH   int64
+}
+
+func (f *timedBatterySampler) Collect() (*collector.BatterySample, error) {
+	charge := int64(5000000)
+	if elapsed := time.Since(f.start); elapsed >= f.stepAt {
+		steps := int64(1)
+		if f.stepEvery > 0 {
+			steps += int64((elapsed - f.stepAt) / f.stepEvery)
+		}
+		charge -= steps * f.stepUAH
+	}
+	return &collector.BatterySample{ChargeNowUAH: charge, VoltageUV: 12000000}, nil
+}
+
+func TestMeasurePowerOverWindow_CountsChargeSteps(t *testing.T) {
+	bs := &timedBatterySampler{start: time.Now(), stepAt: 20 * time.Millisecond, stepEvery: 20 * time.Millisecond, stepUAH: 100}
+
+	_, _, deltaChargeUAH, _, steps, err := MeasurePowerOverWindowWithDiagnostics(bs, 100*time.Millisecond, time.Millisecond, time.Second, nil)
+	if err != nil {
+		t.Fatalf("MeasurePowerOverWindowWithDiagnostics() error = %v", err)
+	}
+	// About five steps fall in the window, plus the one that ends it.
+	if steps < 3 || int64(steps)*100 != deltaChargeUAH {
+		t.Fatalf("steps = %d, delta charge = %d; want at least 3 steps of 100 uAh", steps, deltaChargeUAH)
+	}
+}
+
+func TestMeasurePowerOverWindow_StepWaitTimeoutWidensError(t *testing.T) {
+	// The only charge step falls inside the window, so both endpoint waits
+	// time out.
+	bs := &timedBatterySampler{start: time.Now(), stepAt: 60 * time.Millisecond, stepUAH: 1000}
+
+	powerUW, errUW, deltaChargeUAH, quantUAH, steps, err := MeasurePowerOverWindowWithDiagnostics(bs, 100*time.Millisecond, time.Millisecond, 20*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("MeasurePowerOverWindowWithDiagnostics() error = %v", err)
+	}
+	if deltaChargeUAH != 1000 || quantUAH != 1000 || steps != 1 {
+		t.Fatalf("delta charge = %d, quantization = %d, steps = %d; want 1000, 1000, 1", deltaChargeUAH, quantUAH, steps)
+	}
+	// Two unaligned endpoints give twice the error of a single quantization
+	// step, which equals the delta here.
+	if absInt64(errUW-2*powerUW) > 2 {
+		t.Fatalf("error = %d, want 2 × power %d for two unaligned endpoints", errUW, powerUW)
 	}
 }
 
@@ -69,3 +136,242 @@ func TestMeasurePowerOverWindow_ValidatesArguments(t *testing.T) {
 		t.Fatal("expected error for zero poll interval")
 	}
 }
+
+func TestMeasurePowerOverWindow_FallsBackToPowerNow(t *testing.T) {
+	bs := &fakeBatterySampler{samples: []*collector.BatterySample{
+		{VoltageUV: 12000000, SysfsPowerUW: 4000000},
+		{VoltageUV: 12000000, SysfsPowerUW: 6000000},
+		{VoltageUV: 12000000, SysfsPowerUW: 4000000},
+		{VoltageUV: 12000000, SysfsPowerUW: 6000000},
+	}}
+
+	powerUW, errUW, deltaChargeUAH, quantUAH, steps, err := MeasurePowerOverWindowWithDiagnostics(bs, 10*time.Millisecond, 2*time.Millisecond, time.Second, nil)
+	if err != nil {
+		t.Fatalf("MeasurePowerOverWindowWithDiagnostics() error = %v", err)
+	}
+	if powerUW < 4000000 || powerUW > 6000000 {
+		t.Fatalf("power = %d, want the average of the 4-6 W readings", powerUW)
+	}
+	if errUW < powerUW*powerNowErrorFloorPct/100 {
+		t.Fatalf("error = %d, want at least %d%% of %d", errUW, powerNowErrorFloorPct, powerUW)
+	}
+	if deltaChargeUAH != 0 || quantUAH != 0 || steps != 0 {
+		t.Fatalf("delta charge = %d, quantization = %d, steps = %d; want 0, 0, 0 for power_now", deltaChargeUAH, quantUAH, steps)
+	}
+}
+
+func TestMeasurePowerOverWindow_PowerNowErrorFloor(t *testing.T) {
+	bs := &fakeBatterySampler{samples: []*collector.BatterySample{{SysfsPowerUW: 8000000}}}
+
+	powerUW, errUW, _, _, _, err := MeasurePowerOverWindowWithDiagnostics(bs, 10*time.Millisecond, 2*time.Millisecond, time.Second, nil)
+	if err != nil {
+		t.Fatalf("MeasurePowerOverWindowWithDiagnostics() error = %v", err)
+	}
+	if powerUW != 8000000 || errUW != 400000 {
+		t.Fatalf("got %d +/- %d, want 8000000 +/- 400000 (constant readings, floor only)", powerUW, errUW)
+	}
+}
+
+func TestMeasurePowerOverWindow_ErrorsWithoutChargeOrPower(t *testing.T) {
+	bs := &fakeBatterySampler{samples: []*collector.BatterySample{{VoltageUV: 12000000}}}
+
+	if _, err := MeasurePowerOverWindow(bs, 10*time.Millisecond, 2*time.Millisecond); err == nil {
+		t.Fatal("MeasurePowerOverWindow() error = nil, want error when neither charge nor power is reported")
+	}
+}
+
+func TestRunOptions_Validate(t *testing.T) {
+	valid := RunOptions{SettleWait: DefaultSettleWait, SampleDuration: DefaultSampleDuration, SamplePoll: DefaultSamplePoll, MaxStepWait: DefaultMaxStepWait}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate(defaults) error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*RunOptions)
+	}{
+		{"negative settle", func(o *RunOptions) { o.SettleWait = -time.Second }},
+		{"short sample", func(o *RunOptions) { o.SampleDuration = MinSampleDuration - time.Second }},
+		{"fast poll", func(o *RunOptions) { o.SamplePoll = MinSamplePoll / 2 }},
+		{"poll longer than sample", func(o *RunOptions) { o.SamplePoll = o.SampleDuration + time.Second }},
+		{"step wait shorter than poll", func(o *RunOptions) { o.MaxStepWait = o.SamplePoll / 2 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid
+			tt.mutate(&opts)
+			if err := opts.Validate(); err == nil {
+				t.Fatalf("Validate(%+v) error = nil, want error", opts)
+			}
+		})
+	}
+
+	zeroSettle := valid
+	zeroSettle.SettleWait = 0
+	if err := zeroSettle.Validate(); err != nil {
+		t.Fatalf("Validate(zero settle) error = %v, want nil", err)
+	}
+}
+
+func setTestPinRecoveryPath(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "run", "cpu-pin.json")
+	orig := PinRecoveryPath
+	PinRecoveryPath = path
+	t.Cleanup(func() { PinRecoveryPath = orig })
+	return path
+}
+
+func TestRestoreStalePin_NoFile(t *testing.T) {
+	setTestPinRecoveryPath(t)
+
+	if restored, err := RestoreStalePin(); restored || err != nil {
+		t.Fatalf("RestoreStalePin() = %v, %v; want false, nil", restored, err)
+	}
+}
+
+func TestRestoreStalePin_RestoresDeadProcessSettings(t *testing.T) {
+	path := setTestPinRecoveryPath(t)
+	dir := t.TempDir()
+	maxPath := filepath.Join(dir, "scaling_max_freq")
+	turboPath := filepath.Join(dir, "no_turbo")
+	for _, p := range []string{maxPath, turboPath} {
+		if err := os.WriteFile(p, []byte("pinned"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A PID that has certainly exited.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run true: %v", err)
+	}
+	if err := writePinRecovery(pinRecovery{
+		PID:     cmd.Process.Pid,
+		Restore: []pinWrite{{maxPath, "4800000"}, {turboPath, "0"}},
+	}); err != nil {
+		t.Fatalf("writePinRecovery() error = %v", err)
+	}
+
+	restored, err := RestoreStalePin()
+	if !restored || err != nil {
+		t.Fatalf("RestoreStalePin() = %v, %v; want true, nil", restored, err)
+	}
+	for p, want := range map[string]string{maxPath: "4800000", turboPath: "0"} {
+		if got, _ := os.ReadFile(p); string(got) != want {
+			t.Fatalf("%s = %q, want %q", filepath.Base(p), got, want)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("recovery file still present after restore (stat err = %v)", err)
+	}
+}
+
+func TestRestoreStalePin_LeavesLiveProcessAlone(t *testing.T) {
+	path := setTestPinRecoveryPath(t)
+	target := filepath.Join(t.TempDir(), "scaling_max_freq")
+	if err := os.WriteFile(target, []byte("pinned"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePinRecovery(pinRecovery{PID: os.Getppid(), Restore: []pinWrite{{target, "4800000"}}}); err != nil {
+		t.Fatalf("writePinRecovery() error = %v", err)
+	}
+
+	if restored, err := RestoreStalePin(); restored || err == nil {
+		t.Fatalf("RestoreStalePin() = %v, %v; want false and an error", restored, err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "pinned" {
+		t.Fatalf("value = %q, want untouched", got)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("recovery file removed for a live process: %v", err)
+	}
+}
+
+func TestChooseGovernor(t *testing.T) {
+	tests := []struct {
+		available string
+		want      string
+	}{
+		{"conservative ondemand userspace powersave performance schedutil", "userspace"},
+		{"performance powersave", "powersave"},
+		{"powersave", "powersave"},
+		{"userspace schedutil", "userspace"},
+		{"performance schedutil", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		got, err := chooseGovernor(strings.Fields(tt.available))
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("chooseGovernor(%q) = %q, %v; want %q", tt.available, got, err, tt.want)
+		}
+	}
+}
+
+// newTestCPUFreqDir creates a cpufreq directory with the given
+// scaling_available_governors (none if empty).
+func newTestCPUFreqDir(t *testing.T, governors string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "cpu0", "cpufreq")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"scaling_governor": "schedutil",
+		"scaling_min_freq": "400000",
+		"scaling_max_freq": "4800000",
+		"scaling_setspeed": "<unsupported>",
+	}
+	if governors != "" {
+		files["scaling_available_governors"] = governors
+	}
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(value+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLockCPUFreq_PicksGovernor(t *testing.T) {
+	tests := []struct {
+		name, governors string
+		wantGov         string
+		wantSetspeed    string
+	}{
+		{"userspace", "performance powersave userspace schedutil", "userspace", "2100000"},
+		{"powersave", "performance powersave", "powersave", "<unsupported>\n"},
+		{"no list", "", "powersave", "<unsupported>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newTestCPUFreqDir(t, tt.governors)
+
+			gov, err := lockCPUFreq(dir, "2100000")
+			if err != nil || gov != tt.wantGov {
+				t.Fatalf("lockCPUFreq() = %q, %v; want %q", gov, err, tt.wantGov)
+			}
+			for name, want := range map[string]string{
+				"scaling_governor": tt.wantGov,
+				"scaling_min_freq": "2100000",
+				"scaling_max_freq": "2100000",
+				"scaling_setspeed": tt.wantSetspeed,
+			} {
+				if got, _ := os.ReadFile(filepath.Join(dir, name)); string(got) != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLockCPUFreq_FailsWithoutLockingGovernor(t *testing.T) {
+	dir := newTestCPUFreqDir(t, "performance schedutil")
+
+	if gov, err := lockCPUFreq(dir, "2100000"); err == nil {
+		t.Fatalf("lockCPUFreq() = %q, nil; want an error", gov)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "scaling_governor")); string(got) != "schedutil\n" {
+		t.Fatalf("scaling_governor = %q, want untouched", got)
+	}
+}
@@ -0,0 +1,167 @@
+package calibration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// CommunityExportFormat and CommunityExportVersion identify the shareable
+// calibration format. Bump the version on any incompatible field change.
+const (
+	CommunityExportFormat  = "power-monitor-calibration"
+	CommunityExportVersion = 1
+)
+
+// CommunityExport is a calibration result stripped of anything that
+// identifies the individual machine, for submission to a shared database of
+// display power curves. It carries the laptop and battery model so curves
+// can be grouped, but no serial numbers, device paths or exact timestamps.
+type CommunityExport struct {
+	Format      string                `json:"format"`
+	Version     int                   `json:"format_version"`
+	Machine     collector.MachineInfo `json:"machine"`
+	Battery     CommunityBattery      `json:"battery"`
+	Calibration CommunityCalibration  `json:"calibration"`
+}
+
+// CommunityBattery is the battery identity from BatteryHealth without its
+// serial number.
+type CommunityBattery struct {
+	Manufacturer        string `json:"manufacturer"`
+	Model               string `json:"model"`
+	Technology          string `json:"technology"`
+	CycleCount          int64  `json:"cycle_count"`
+	ChargeFullDesignUAH int64  `json:"charge_full_design_uah"`
+	ChargeFullUAH       int64  `json:"charge_full_uah"`
+	VoltageMinDesignUV  int64  `json:"voltage_min_design_uv"`
+}
+
+// CommunityCalibration holds the measured curve and its uncertainties.
+type CommunityCalibration struct {
+	CalibratedOn     string             `json:"calibrated_on"` // YYYY-MM-DD only
+	BaselinePowerUW  int64              `json:"baseline_power_uw"`
+	CPUFrequencyKHz  int64              `json:"cpu_frequency_khz"`
+	UpdateIntervalMs int64              `json:"update_interval_ms"`
+	LatencyMs        int64              `json:"latency_ms"`
+	Samples          []BrightnessSample `json:"samples"`
+}
+
+// NewCommunityExport builds the shareable form of result. health may be nil
+// when the battery could not be read; the battery fields are then empty.
+func NewCommunityExport(result *CalibrationResult, health *collector.BatteryHealth, machine collector.MachineInfo) CommunityExport {
+	exp := CommunityExport{
+		Format:  CommunityExportFormat,
+		Version: CommunityExportVersion,
+		Machine: machine,
+		Calibration: CommunityCalibration{
+			BaselinePowerUW:  result.BaselinePowerUW,
+			CPUFrequencyKHz:  result.CPUFrequencyKHz,
+			UpdateIntervalMs: result.UpdateIntervalMs,
+			LatencyMs:        result.LatencyMs,
+			Samples:          append([]BrightnessSample{}, result.Samples...),
+		},
+	}
+	// CalibratedAt is RFC 3339; keep only the date.
+	if len(result.CalibratedAt) >= len("2006-01-02") {
+		exp.Calibration.CalibratedOn = result.CalibratedAt[:len("2006-01-02")]
+	}
+	if health != nil {
+		exp.Battery = CommunityBattery{
+			Manufacturer:        health.Manufacturer,
+			Model:               health.Model,
+			Technology:          health.Technology,
+			CycleCount:          health.CycleCount,
+			ChargeFullDesignUAH: health.ChargeFullDesignUAH,
+			ChargeFullUAH:       health.ChargeFullUAH,
+			VoltageMinDesignUV:  health.VoltageMinDesignUV,
+		}
+	}
+	return exp
+}
+
+// SourceCommunity marks a CalibrationResult converted from a community
+// export rather than measured on this device.
+const SourceCommunity = "community"
+
+// CommunityErrorPct is added to each level's measured error, as a percentage
+// of its display power above the baseline, when a community calibration
+// stands in for one measured here. Panels and boards of the same battery
+// model still differ.
+const CommunityErrorPct = 25
+
+// MatchesBattery reports whether the export was measured with the same
+// battery manufacturer and model as health. Exports without a battery model
+// never match.
+func (e *CommunityExport) MatchesBattery(health *collector.BatteryHealth) bool {
+	if health == nil || strings.TrimSpace(e.Battery.Model) == "" {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(e.Battery.Manufacturer), strings.TrimSpace(health.Manufacturer)) &&
+		strings.EqualFold(strings.TrimSpace(e.Battery.Model), strings.TrimSpace(health.Model))
+}
+
+// Estimate converts the export into a CalibrationResult marked
+// SourceCommunity, with each level's error widened by CommunityErrorPct.
+func (e *CommunityExport) Estimate() *CalibrationResult {
+	c := e.Calibration
+	result := &CalibrationResult{
+		UpdateIntervalMs: c.UpdateIntervalMs,
+		LatencyMs:        c.LatencyMs,
+		BaselinePowerUW:  c.BaselinePowerUW,
+		CPUFrequencyKHz:  c.CPUFrequencyKHz,
+		CalibratedAt:     c.CalibratedOn,
+		Source:           SourceCommunity,
+		Samples:          make([]BrightnessSample, len(c.Samples)),
+	}
+	for i, s := range c.Samples {
+		display := s.AvgPowerUW - c.BaselinePowerUW
+		if display < 0 {
+			display = -display
+		}
+		s.AvgPowerErrorUW += display * CommunityErrorPct / 100
+		result.Samples[i] = s
+	}
+	return result
+}
+
+// FindCommunityCalibration looks through the *.json files in dirs for a
+// community export matching health's battery and returns the best one with
+// its path, or nil when none matches. An export from the same laptop
+// product is preferred, then the most recent. Unreadable files and other
+// formats are skipped.
+func FindCommunityCalibration(dirs []string, health *collector.BatteryHealth, machine collector.MachineInfo) (*CommunityExport, string) {
+	var best *CommunityExport
+	var bestPath string
+	sameMachine := func(e *CommunityExport) bool {
+		return machine.Product != "" && strings.EqualFold(e.Machine.Product, machine.Product)
+	}
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var exp CommunityExport
+			if json.Unmarshal(data, &exp) != nil ||
+				exp.Format != CommunityExportFormat || exp.Version != CommunityExportVersion ||
+				len(exp.Calibration.Samples) == 0 || !exp.MatchesBattery(health) {
+				continue
+			}
+			if best != nil {
+				if sameMachine(best) && !sameMachine(&exp) {
+					continue
+				}
+				if sameMachine(best) == sameMachine(&exp) && exp.Calibration.CalibratedOn <= best.Calibration.CalibratedOn {
+					continue
+				}
+			}
+			best, bestPath = &exp, path
+		}
+	}
+	return best, bestPath
+}
@@ -0,0 +1,163 @@
+package calibration
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestNewCommunityExport(t *testing.T) {
+	result := &CalibrationResult{
+		UpdateIntervalMs: 5000,
+		LatencyMs:        2000,
+		BaselinePowerUW:  3_000_000,
+		CPUFrequencyKHz:  800_000,
+		BacklightDevice:  "intel_backlight",
+		CalibratedAt:     "2026-03-14T09:26:53Z",
+		Samples: []BrightnessSample{
+			{BrightnessPct: 0, AvgPowerUW: 3_000_000, AvgPowerErrorUW: 40_000, ChargeQuantizationUAH: 1000, ChargeSteps: 12},
+			{BrightnessPct: 100, AvgPowerUW: 5_500_000, AvgPowerErrorUW: 55_000, ChargeQuantizationUAH: 1000, ChargeSteps: 20},
+		},
+	}
+	health := &collector.BatteryHealth{
+		Manufacturer:        "SMP",
+		Model:               "5B10W51867",
+		Serial:              "SERIAL-1234",
+		Technology:          "Li-poly",
+		CycleCount:          112,
+		ChargeFullDesignUAH: 4_000_000,
+		ChargeFullUAH:       3_600_000,
+	}
+	machine := collector.MachineInfo{Vendor: "LENOVO", Product: "21CB000GUS"}
+
+	exp := NewCommunityExport(result, health, machine)
+	if exp.Format != CommunityExportFormat || exp.Version != CommunityExportVersion {
+		t.Errorf("format = %q v%d", exp.Format, exp.Version)
+	}
+	if exp.Calibration.CalibratedOn != "2026-03-14" {
+		t.Errorf("CalibratedOn = %q, want 2026-03-14", exp.Calibration.CalibratedOn)
+	}
+	if exp.Battery.Model != "5B10W51867" || exp.Battery.CycleCount != 112 {
+		t.Errorf("Battery = %+v", exp.Battery)
+	}
+	if got := exp.Calibration.Samples[1].AvgPowerErrorUW; got != 55_000 {
+		t.Errorf("sample error = %d, want 55000", got)
+	}
+
+	data, err := json.Marshal(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leak := range []string{"SERIAL-1234", "intel_backlight", "09:26:53"} {
+		if strings.Contains(string(data), leak) {
+			t.Errorf("export contains %q: %s", leak, data)
+		}
+	}
+}
+
+func TestNewCommunityExportNoBattery(t *testing.T) {
+	exp := NewCommunityExport(&CalibrationResult{}, nil, collector.MachineInfo{})
+	if exp.Battery != (CommunityBattery{}) {
+		t.Errorf("Battery = %+v, want empty", exp.Battery)
+	}
+	if exp.Calibration.Samples == nil {
+		t.Error("Samples is nil, want empty slice")
+	}
+}
+
+func TestCommunityExportEstimate(t *testing.T) {
+	exp := CommunityExport{
+		Calibration: CommunityCalibration{
+			CalibratedOn:    "2026-03-14",
+			BaselinePowerUW: 3_000_000,
+			Samples: []BrightnessSample{
+				{BrightnessPct: 0, AvgPowerUW: 2_900_000, AvgPowerErrorUW: 40_000},
+				{BrightnessPct: 100, AvgPowerUW: 5_000_000, AvgPowerErrorUW: 50_000},
+			},
+		},
+	}
+	got := exp.Estimate()
+	if got.Source != SourceCommunity {
+		t.Errorf("Source = %q, want %q", got.Source, SourceCommunity)
+	}
+	// 40 mW measured + 25% of |−100 mW|; 50 mW + 25% of 2 W.
+	if e := got.Samples[0].AvgPowerErrorUW; e != 65_000 {
+		t.Errorf("sample 0 error = %d, want 65000", e)
+	}
+	if e := got.Samples[1].AvgPowerErrorUW; e != 550_000 {
+		t.Errorf("sample 1 error = %d, want 550000", e)
+	}
+	if exp.Calibration.Samples[1].AvgPowerErrorUW != 50_000 {
+		t.Error("Estimate modified the export's samples")
+	}
+}
+
+func TestCommunityExportMatchesBattery(t *testing.T) {
+	exp := CommunityExport{Battery: CommunityBattery{Manufacturer: "SMP", Model: "5B10W51867"}}
+	tests := []struct {
+		name   string
+		health *collector.BatteryHealth
+		want   bool
+	}{
+		{"same", &collector.BatteryHealth{Manufacturer: "SMP", Model: "5B10W51867"}, true},
+		{"case and space", &collector.BatteryHealth{Manufacturer: "smp ", Model: "5b10w51867"}, true},
+		{"other model", &collector.BatteryHealth{Manufacturer: "SMP", Model: "5B10W51868"}, false},
+		{"other manufacturer", &collector.BatteryHealth{Manufacturer: "LGC", Model: "5B10W51867"}, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := exp.MatchesBattery(tt.health); got != tt.want {
+			t.Errorf("%s: MatchesBattery = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	noModel := CommunityExport{}
+	if noModel.MatchesBattery(&collector.BatteryHealth{}) {
+		t.Error("export without a battery model matched")
+	}
+}
+
+func TestFindCommunityCalibration(t *testing.T) {
+	userDir, sysDir := t.TempDir(), t.TempDir()
+	write := func(dir, name, product, date, model string) {
+		t.Helper()
+		exp := CommunityExport{
+			Format:      CommunityExportFormat,
+			Version:     CommunityExportVersion,
+			Machine:     collector.MachineInfo{Product: product},
+			Battery:     CommunityBattery{Manufacturer: "SMP", Model: model},
+			Calibration: CommunityCalibration{CalibratedOn: date, Samples: []BrightnessSample{{BrightnessPct: 100}}},
+		}
+		data, err := json.Marshal(exp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	health := &collector.BatteryHealth{Manufacturer: "SMP", Model: "A"}
+
+	if exp, _ := FindCommunityCalibration([]string{userDir, sysDir}, health, collector.MachineInfo{}); exp != nil {
+		t.Fatalf("empty dirs: got %+v, want nil", exp)
+	}
+
+	write(sysDir, "old.json", "X1", "2025-01-01", "A")
+	write(sysDir, "new.json", "T14", "2026-01-01", "A")
+	write(userDir, "other.json", "X1", "2026-06-01", "B")
+	if err := os.WriteFile(filepath.Join(userDir, "broken.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	exp, path := FindCommunityCalibration([]string{userDir, sysDir}, health, collector.MachineInfo{})
+	if exp == nil || filepath.Base(path) != "new.json" {
+		t.Errorf("no machine: got %q, want new.json", path)
+	}
+	exp, path = FindCommunityCalibration([]string{userDir, sysDir}, health, collector.MachineInfo{Product: "x1"})
+	if exp == nil || filepath.Base(path) != "old.json" {
+		t.Errorf("machine X1: got %q, want old.json", path)
+	}
+}
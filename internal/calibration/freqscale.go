@@ -0,0 +1,21 @@
+package calibration
+
+import (
+	"math"
+)
+
+// CPU power at a fixed voltage grows roughly with frequency, and since
+// voltage rises with frequency too, dynamic power grows faster than linearly.
+// FreqPowerScale carries a power measured at one frequency to the
+// frequencies cores actually ran at, as
+//
+//	power(f) = power(calibrated) · (f / calibrated)^exponent
+
+// FreqPowerScale returns the factor that scales power measured at
+// calibratedKHz to freqKHz. It is 1 when either frequency is unknown.
+func FreqPowerScale(freqKHz, calibratedKHz int64, exponent float64) float64 {
+	if freqKHz <= 0 || calibratedKHz <= 0 {
+		return 1
+	}
+	return math.Pow(float64(freqKHz)/float64(calibratedKHz), exponent)
+}
@@ -0,0 +1,26 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFreqPowerScale(t *testing.T) {
+	tests := []struct {
+		freq, calibrated int64
+		exponent         float64
+		want             float64
+	}{
+		{2000000, 2000000, 2, 1},
+		{4000000, 2000000, 2, 4},
+		{1000000, 2000000, 2, 0.25},
+		{3000000, 2000000, 1, 1.5},
+		{0, 2000000, 2, 1},
+		{2000000, 0, 2, 1},
+	}
+	for _, tt := range tests {
+		if got := FreqPowerScale(tt.freq, tt.calibrated, tt.exponent); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("FreqPowerScale(%d, %d, %v) = %v, want %v", tt.freq, tt.calibrated, tt.exponent, got, tt.want)
+		}
+	}
+}
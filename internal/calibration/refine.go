@@ -0,0 +1,316 @@
+package calibration
+
+import (
+	"math"
+)
+
+// Background refinement builds the brightness-power model from the daemon's
+// regular samples instead of a dedicated run: each stable period (fixed
+// brightness, steady CPU activity, on battery) is averaged into a ModelPoint,
+// and FitDisplayModel fits power against brightness and CPU activity over all
+// stored points by least squares.
+
+const (
+	// RefineSettleSeconds is skipped after any disturbance before a period
+	// counts, covering the battery firmware's averaging window.
+	RefineSettleSeconds = 90
+	// RefinePeriodSeconds is how long a stable period runs before it is
+	// emitted as a point.
+	RefinePeriodSeconds = 60
+	// refineTickSlack is the absolute CPU tick deviation always tolerated
+	// within a period, so near-idle noise does not break it up.
+	refineTickSlack = 20
+)
+
+// Model confidence levels, from no usable fit to a tight one.
+const (
+	ConfidenceNone   = "none"
+	ConfidenceLow    = "low"
+	ConfidenceMedium = "medium"
+	ConfidenceHigh   = "high"
+)
+
+// RefineObservation is one collection cycle as seen by a Refiner.
+type RefineObservation struct {
+	Timestamp     int64
+	BrightnessPct float64
+	PowerUW       int64
+	CPUTicks      int64 // total CPU ticks used since the previous cycle
+	Discharging   bool
+}
+
+// ModelPoint is the average of one stable period.
+type ModelPoint struct {
+	Timestamp     int64   `json:"timestamp"` // end of the period
+	BrightnessPct float64 `json:"brightness_pct"`
+	PowerUW       int64   `json:"power_uw"`
+	CPUTicks      float64 `json:"cpu_ticks"` // mean ticks per cycle
+	Samples       int     `json:"samples"`
+}
+
+// Refiner turns consecutive observations into ModelPoints.
+type Refiner struct {
+	intervalSec int64
+
+	last       *RefineObservation
+	quietSince int64 // start of the current undisturbed stretch
+	refTicks   int64 // CPU ticks of the stretch's first cycle
+
+	periodStart int64
+	sumPower    float64
+	sumTicks    float64
+	n           int
+}
+
+// NewRefiner creates a Refiner for observations intervalSec apart.
+func NewRefiner(intervalSec int64) *Refiner {
+	return &Refiner{intervalSec: max(intervalSec, 1)}
+}
+
+// SetInterval updates the expected spacing of observations after the
+// collection interval changed.
+func (r *Refiner) SetInterval(intervalSec int64) {
+	r.intervalSec = max(intervalSec, 1)
+}
+
+// Reset discards the current period, e.g. when a cycle had missing data.
+func (r *Refiner) Reset() {
+	r.last = nil
+	r.resetPeriod()
+}
+
+func (r *Refiner) resetPeriod() {
+	r.periodStart = 0
+	r.sumPower, r.sumTicks, r.n = 0, 0, 0
+}
+
+// Observe feeds one cycle and returns a point when a stable period completes.
+func (r *Refiner) Observe(obs RefineObservation) *ModelPoint {
+	if !obs.Discharging || obs.PowerUW <= 0 {
+		r.Reset()
+		return nil
+	}
+	prev := r.last
+	r.last = &obs
+
+	disturbed := prev == nil ||
+		obs.Timestamp-prev.Timestamp > 2*r.intervalSec || // gap or suspend
+		obs.Timestamp <= prev.Timestamp ||
+		obs.BrightnessPct != prev.BrightnessPct ||
+		absInt64(obs.CPUTicks-r.refTicks) > max(r.refTicks/2, refineTickSlack)
+	if disturbed {
+		r.quietSince = obs.Timestamp
+		r.refTicks = obs.CPUTicks
+		r.resetPeriod()
+		return nil
+	}
+	if obs.Timestamp-r.quietSince < RefineSettleSeconds {
+		return nil
+	}
+
+	if r.n == 0 {
+		r.periodStart = obs.Timestamp
+	}
+	r.sumPower += float64(obs.PowerUW)
+	r.sumTicks += float64(obs.CPUTicks)
+	r.n++
+	if obs.Timestamp-r.periodStart < RefinePeriodSeconds {
+		return nil
+	}
+
+	p := &ModelPoint{
+		Timestamp:     obs.Timestamp,
+		BrightnessPct: obs.BrightnessPct,
+		PowerUW:       int64(math.Round(r.sumPower / float64(r.n))),
+		CPUTicks:      r.sumTicks / float64(r.n),
+		Samples:       r.n,
+	}
+	r.resetPeriod()
+	return p
+}
+
+// DisplayPowerModel is a least-squares fit of
+//
+//	power = BaselinePowerUW + DisplayUWPerPct·brightness + CPUUWPerTick·ticks
+//
+// over the stored ModelPoints.
+type DisplayPowerModel struct {
+	Points          int     `json:"points"`
+	MinBrightness   float64 `json:"min_brightness_pct"`
+	MaxBrightness   float64 `json:"max_brightness_pct"`
+	BaselinePowerUW int64   `json:"baseline_power_uw"`
+	DisplayUWPerPct float64 `json:"display_uw_per_pct"`
+	CPUUWPerTick    float64 `json:"cpu_uw_per_tick"`
+	// DisplayErrorUWPerPct is the standard error of DisplayUWPerPct.
+	DisplayErrorUWPerPct float64 `json:"display_error_uw_per_pct"`
+	Confidence           string  `json:"confidence"`
+	UpdatedAt            int64   `json:"updated_at"` // newest point's timestamp
+}
+
+// Thresholds for DisplayPowerModel.Confidence.
+const (
+	minModelPoints      = 5
+	minModelSpanPct     = 10
+	highModelPoints     = 20
+	highModelSpanPct    = 50
+	mediumModelRelError = 0.25
+	highModelRelError   = 0.10
+)
+
+// DisplayUW returns the model's display power at brightnessPct, clamped at
+// zero.
+func (m DisplayPowerModel) DisplayUW(brightnessPct float64) int64 {
+	return max(int64(math.Round(m.DisplayUWPerPct*brightnessPct)), 0)
+}
+
+// FitDisplayModel fits a DisplayPowerModel to points. The CPU term is dropped
+// when CPU activity barely varied, since it cannot be separated from the
+// baseline then. With too few points or too narrow a brightness range the
+// model has ConfidenceNone and zero coefficients.
+func FitDisplayModel(points []ModelPoint) DisplayPowerModel {
+	m := DisplayPowerModel{Points: len(points), Confidence: ConfidenceNone}
+	if len(points) == 0 {
+		return m
+	}
+	m.MinBrightness, m.MaxBrightness = points[0].BrightnessPct, points[0].BrightnessPct
+	for _, p := range points {
+		m.MinBrightness = min(m.MinBrightness, p.BrightnessPct)
+		m.MaxBrightness = max(m.MaxBrightness, p.BrightnessPct)
+		m.UpdatedAt = max(m.UpdatedAt, p.Timestamp)
+	}
+	if len(points) < minModelPoints || m.MaxBrightness-m.MinBrightness < minModelSpanPct {
+		return m
+	}
+
+	coef, se, ok := leastSquares(points, true)
+	if !ok {
+		coef, se, ok = leastSquares(points, false)
+	}
+	if !ok {
+		return m
+	}
+	m.BaselinePowerUW = int64(math.Round(coef[0]))
+	m.DisplayUWPerPct = coef[1]
+	if len(coef) > 2 {
+		m.CPUUWPerTick = coef[2]
+	}
+	m.DisplayErrorUWPerPct = se
+
+	// Judge the slope error against the display power at full brightness.
+	relErr := math.Inf(1)
+	if m.DisplayUWPerPct > 0 {
+		relErr = se / m.DisplayUWPerPct
+	}
+	switch {
+	case relErr <= highModelRelError && len(points) >= highModelPoints && m.MaxBrightness-m.MinBrightness >= highModelSpanPct:
+		m.Confidence = ConfidenceHigh
+	case relErr <= mediumModelRelError:
+		m.Confidence = ConfidenceMedium
+	default:
+		m.Confidence = ConfidenceLow
+	}
+	return m
+}
+
+// leastSquares solves the normal equations for power against brightness and,
+// if withCPU, CPU ticks. It returns the coefficients (intercept first) and the
+// standard error of the brightness coefficient; ok is false when the system
+// is singular or has no residual degrees of freedom.
+func leastSquares(points []ModelPoint, withCPU bool) (coef []float64, brightnessSE float64, ok bool) {
+	k := 2
+	if withCPU {
+		k = 3
+	}
+	if len(points) <= k {
+		return nil, 0, false
+	}
+	row := func(p ModelPoint) []float64 {
+		if withCPU {
+			return []float64{1, p.BrightnessPct, p.CPUTicks}
+		}
+		return []float64{1, p.BrightnessPct}
+	}
+
+	xtx := make([][]float64, k)
+	for i := range xtx {
+		xtx[i] = make([]float64, k)
+	}
+	xty := make([]float64, k)
+	for _, p := range points {
+		x := row(p)
+		for i := range k {
+			for j := range k {
+				xtx[i][j] += x[i] * x[j]
+			}
+			xty[i] += x[i] * float64(p.PowerUW)
+		}
+	}
+
+	inv, ok := invert(xtx)
+	if !ok {
+		return nil, 0, false
+	}
+	coef = make([]float64, k)
+	for i := range k {
+		for j := range k {
+			coef[i] += inv[i][j] * xty[j]
+		}
+	}
+
+	var rss float64
+	for _, p := range points {
+		x := row(p)
+		fit := 0.0
+		for i := range k {
+			fit += coef[i] * x[i]
+		}
+		d := float64(p.PowerUW) - fit
+		rss += d * d
+	}
+	variance := rss / float64(len(points)-k)
+	return coef, math.Sqrt(variance * inv[1][1]), true
+}
+
+// invert returns the inverse of the square matrix a by Gauss-Jordan
+// elimination with partial pivoting, or false if a is (nearly) singular.
+func invert(a [][]float64) ([][]float64, bool) {
+	n := len(a)
+	m := make([][]float64, n)
+	for i := range a {
+		m[i] = make([]float64, 2*n)
+		copy(m[i], a[i])
+		m[i][n+i] = 1
+	}
+	for col := range n {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(m[r][col]) > math.Abs(m[pivot][col]) {
+				pivot = r
+			}
+		}
+		// Relative to the diagonal scale, so large tick counts do not hide
+		// a degenerate column.
+		if math.Abs(m[pivot][col]) <= 1e-9*math.Max(math.Abs(a[col][col]), 1) {
+			return nil, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+		pv := m[col][col]
+		for j := range m[col] {
+			m[col][j] /= pv
+		}
+		for r := range n {
+			if r == col {
+				continue
+			}
+			f := m[r][col]
+			for j := range m[r] {
+				m[r][j] -= f * m[col][j]
+			}
+		}
+	}
+	inv := make([][]float64, n)
+	for i := range m {
+		inv[i] = m[i][n:]
+	}
+	return inv, true
+}
@@ -0,0 +1,167 @@
+package calibration
+
+import (
+	"math"
+	"testing"
+)
+
+// feed observes a steady run from start, every 5 s for secs seconds, and
+// returns the emitted points.
+func feed(r *Refiner, start, secs int64, pct float64, powerUW, ticks int64) []ModelPoint {
+	var pts []ModelPoint
+	for ts := start; ts < start+secs; ts += 5 {
+		if p := r.Observe(RefineObservation{Timestamp: ts, BrightnessPct: pct, PowerUW: powerUW, CPUTicks: ticks, Discharging: true}); p != nil {
+			pts = append(pts, *p)
+		}
+	}
+	return pts
+}
+
+func TestRefiner_EmitsPointAfterSettleAndPeriod(t *testing.T) {
+	r := NewRefiner(5)
+
+	pts := feed(r, 1000, RefineSettleSeconds+RefinePeriodSeconds, 50, 6000000, 100)
+	if len(pts) != 0 {
+		t.Fatalf("points before a full period = %#v, want none", pts)
+	}
+	pts = feed(r, 1000+RefineSettleSeconds+RefinePeriodSeconds, 5, 50, 6000000, 100)
+	if len(pts) != 1 {
+		t.Fatalf("points = %#v, want one", pts)
+	}
+	p := pts[0]
+	if p.BrightnessPct != 50 || p.PowerUW != 6000000 || p.CPUTicks != 100 || p.Samples != RefinePeriodSeconds/5+1 {
+		t.Fatalf("point = %#v", p)
+	}
+}
+
+func TestRefiner_DisturbancesRestartSettling(t *testing.T) {
+	tests := []struct {
+		name string
+		obs  RefineObservation
+	}{
+		{"brightness change", RefineObservation{BrightnessPct: 60, PowerUW: 6000000, CPUTicks: 100, Discharging: true}},
+		{"cpu burst", RefineObservation{BrightnessPct: 50, PowerUW: 9000000, CPUTicks: 400, Discharging: true}},
+		{"charging", RefineObservation{BrightnessPct: 50, PowerUW: 6000000, CPUTicks: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRefiner(5)
+			feed(r, 0, RefineSettleSeconds+30, 50, 6000000, 100)
+			tt.obs.Timestamp = RefineSettleSeconds + 30
+			if p := r.Observe(tt.obs); p != nil {
+				t.Fatalf("Observe(disturbance) = %#v, want nil", p)
+			}
+			// Another full period right away is still settling.
+			if pts := feed(r, RefineSettleSeconds+35, RefinePeriodSeconds+5, 50, 6000000, 100); len(pts) != 0 {
+				t.Fatalf("points while re-settling = %#v, want none", pts)
+			}
+		})
+	}
+}
+
+func TestRefiner_GapRestartsSettling(t *testing.T) {
+	r := NewRefiner(5)
+	feed(r, 0, RefineSettleSeconds+30, 50, 6000000, 100)
+	// A suspend-sized gap.
+	if pts := feed(r, 5000, RefinePeriodSeconds+10, 50, 6000000, 100); len(pts) != 0 {
+		t.Fatalf("points after gap = %#v, want none until settled", pts)
+	}
+}
+
+func TestRefiner_ToleratesIdleTickNoise(t *testing.T) {
+	r := NewRefiner(5)
+	var pts []ModelPoint
+	for i := range int64((RefineSettleSeconds + RefinePeriodSeconds + 10) / 5) {
+		ticks := int64(10 + (i%2)*15) // 10, 25, 10, 25: within the absolute slack
+		if p := r.Observe(RefineObservation{Timestamp: i * 5, BrightnessPct: 30, PowerUW: 5000000, CPUTicks: ticks, Discharging: true}); p != nil {
+			pts = append(pts, *p)
+		}
+	}
+	if len(pts) != 1 {
+		t.Fatalf("points = %d, want 1 despite idle tick noise", len(pts))
+	}
+}
+
+func TestFitDisplayModel_RecoversLinearModel(t *testing.T) {
+	// power = 4 W + 30 mW/% brightness + 5 mW/tick, with small noise.
+	var pts []ModelPoint
+	for i := range 30 {
+		pct := float64((i * 7) % 101)
+		ticks := float64(50 + (i*13)%200)
+		noise := float64((i%5)-2) * 20000
+		pts = append(pts, ModelPoint{
+			Timestamp:     int64(i),
+			BrightnessPct: pct,
+			CPUTicks:      ticks,
+			PowerUW:       int64(4000000 + 30000*pct + 5000*ticks + noise),
+		})
+	}
+
+	m := FitDisplayModel(pts)
+	if m.Confidence != ConfidenceHigh {
+		t.Fatalf("Confidence = %q, want high (model %#v)", m.Confidence, m)
+	}
+	if math.Abs(m.DisplayUWPerPct-30000) > 500 {
+		t.Fatalf("DisplayUWPerPct = %.0f, want ~30000", m.DisplayUWPerPct)
+	}
+	if math.Abs(m.CPUUWPerTick-5000) > 200 {
+		t.Fatalf("CPUUWPerTick = %.0f, want ~5000", m.CPUUWPerTick)
+	}
+	if math.Abs(float64(m.BaselinePowerUW)-4000000) > 50000 {
+		t.Fatalf("BaselinePowerUW = %d, want ~4000000", m.BaselinePowerUW)
+	}
+	if m.UpdatedAt != 29 || m.Points != 30 {
+		t.Fatalf("UpdatedAt, Points = %d, %d; want 29, 30", m.UpdatedAt, m.Points)
+	}
+	if got := m.DisplayUW(100); math.Abs(float64(got)-3000000) > 50000 {
+		t.Fatalf("DisplayUW(100) = %d, want ~3000000", got)
+	}
+}
+
+func TestFitDisplayModel_ConstantCPUDropsCPUTerm(t *testing.T) {
+	var pts []ModelPoint
+	for i, pct := range []float64{10, 20, 30, 40, 50, 60} {
+		pts = append(pts, ModelPoint{Timestamp: int64(i), BrightnessPct: pct, CPUTicks: 40, PowerUW: int64(5000000 + 20000*pct)})
+	}
+	m := FitDisplayModel(pts)
+	if m.Confidence == ConfidenceNone {
+		t.Fatalf("Confidence = none, want a fit (model %#v)", m)
+	}
+	if m.CPUUWPerTick != 0 || math.Abs(m.DisplayUWPerPct-20000) > 1 || m.BaselinePowerUW != 5000000 {
+		t.Fatalf("model = %#v, want 5 W + 20 mW/%% and no CPU term", m)
+	}
+}
+
+func TestFitDisplayModel_InsufficientData(t *testing.T) {
+	tests := []struct {
+		name string
+		pts  []ModelPoint
+	}{
+		{"empty", nil},
+		{"too few points", []ModelPoint{{BrightnessPct: 0, PowerUW: 1}, {BrightnessPct: 100, PowerUW: 2}}},
+		{"narrow brightness range", []ModelPoint{
+			{BrightnessPct: 50, PowerUW: 1}, {BrightnessPct: 52, PowerUW: 2}, {BrightnessPct: 54, PowerUW: 3},
+			{BrightnessPct: 51, PowerUW: 1}, {BrightnessPct: 53, PowerUW: 2}, {BrightnessPct: 55, PowerUW: 3},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := FitDisplayModel(tt.pts)
+			if m.Confidence != ConfidenceNone || m.DisplayUWPerPct != 0 {
+				t.Fatalf("FitDisplayModel() = %#v, want no fit", m)
+			}
+		})
+	}
+}
+
+func TestFitDisplayModel_NoisyDataIsLowConfidence(t *testing.T) {
+	var pts []ModelPoint
+	for i := range 8 {
+		pct := float64(i * 10)
+		noise := float64((i%2)*2-1) * 1500000
+		pts = append(pts, ModelPoint{BrightnessPct: pct, CPUTicks: 40, PowerUW: int64(6000000 + 10000*pct + noise)})
+	}
+	if m := FitDisplayModel(pts); m.Confidence != ConfidenceLow {
+		t.Fatalf("Confidence = %q, want low (model %#v)", m.Confidence, m)
+	}
+}
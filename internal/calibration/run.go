@@ -0,0 +1,258 @@
+package calibration
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// Progress describes one step of a calibration run for live reporting.
+type Progress struct {
+	Level         int    `json:"level"`  // 1-based index of the current brightness level (0 during preparation)
+	Levels        int    `json:"levels"` // total number of brightness levels
+	BrightnessPct int    `json:"brightness_pct"`
+	Phase         string `json:"phase"` // "prepare", "level", "settle", "wait-charge-step", "charge-step-timeout", "window", "wait-end-charge-step", "end-charge-step-timeout", "end", "result", "warning", "restore"
+	ElapsedSec    int    `json:"elapsed_sec"`
+	RemainingSec  int    `json:"remaining_sec"`
+	ChargeNowUAH  int64  `json:"charge_now_uah"`
+	VoltageUV     int64  `json:"voltage_uv"`
+	Message       string `json:"message"` // human-readable diagnostic text
+}
+
+// RunOptions configures a calibration run.
+type RunOptions struct {
+	Sampler        BatterySampler
+	Levels         []int
+	SettleWait     time.Duration
+	SampleDuration time.Duration
+	SamplePoll     time.Duration
+	// MaxStepWait bounds each wait for a battery charge step at the start
+	// and end of a sample window; the measurement then goes ahead with a
+	// larger error.
+	MaxStepWait time.Duration
+	// Backlight names the /sys/class/backlight device to calibrate, or a
+	// glob over them; empty picks the internal panel. It is resolved by
+	// collector.FindBacklightDir, like the daemon's backlight_device.
+	Backlight string
+}
+
+// DefaultLevels are the brightness percentages measured by a calibration run.
+var DefaultLevels = []int{0, 25, 50, 75, 100}
+
+// Default timing for a calibration run. The long sample window keeps the
+// charge-step quantization error small.
+const (
+	DefaultSettleWait     = 5 * time.Second
+	DefaultSampleDuration = 300 * time.Second
+	DefaultSamplePoll     = 500 * time.Millisecond
+	DefaultMaxStepWait    = 2 * time.Minute
+)
+
+// Lower bounds on RunOptions timing. Shorter sample windows rarely span a
+// single charge step, and faster polling only re-reads the same sysfs value.
+const (
+	MinSampleDuration = 10 * time.Second
+	MinSamplePoll     = 50 * time.Millisecond
+)
+
+// Validate checks that the run's timing is usable.
+func (o RunOptions) Validate() error {
+	if o.SettleWait < 0 {
+		return fmt.Errorf("settle wait must not be negative, got %v", o.SettleWait)
+	}
+	if o.SampleDuration < MinSampleDuration {
+		return fmt.Errorf("sample duration must be at least %v, got %v", MinSampleDuration, o.SampleDuration)
+	}
+	if o.SamplePoll < MinSamplePoll || o.SamplePoll > o.SampleDuration {
+		return fmt.Errorf("sample poll must be between %v and the sample duration, got %v", MinSamplePoll, o.SamplePoll)
+	}
+	if o.MaxStepWait < o.SamplePoll {
+		return fmt.Errorf("max charge-step wait must be at least the sample poll, got %v", o.MaxStepWait)
+	}
+	return nil
+}
+
+// Run pins the CPU, measures power at each brightness level, and restores
+// brightness and CPU settings before returning. onProgress (optional) receives
+// each step as it happens.
+func Run(opts RunOptions, onProgress func(Progress)) (result CalibrationResult, err error) {
+	if opts.Sampler == nil {
+		return result, fmt.Errorf("battery sampler must not be nil")
+	}
+	if len(opts.Levels) == 0 {
+		opts.Levels = DefaultLevels
+	}
+	if err := opts.Validate(); err != nil {
+		return result, err
+	}
+	report := func(p Progress) {
+		if onProgress != nil {
+			p.Levels = len(opts.Levels)
+			onProgress(p)
+		}
+	}
+
+	blDir, err := collector.FindBacklightDir(opts.Backlight)
+	if err != nil {
+		return result, fmt.Errorf("find backlight: %w", err)
+	}
+	backlight := filepath.Base(blDir)
+	report(Progress{Phase: "prepare", Message: fmt.Sprintf("Using backlight %s", backlight)})
+
+	// Save original brightness to restore later.
+	origCur, origMax, err := GetBrightness(blDir)
+	if err != nil {
+		return result, fmt.Errorf("get brightness: %w", err)
+	}
+	origPct := 0
+	if origMax > 0 {
+		origPct = int(origCur * 100 / origMax)
+	}
+	defer func() {
+		report(Progress{Phase: "restore", Message: fmt.Sprintf("Restoring brightness to %d%%", origPct)})
+		SetBrightness(blDir, origPct)
+	}()
+
+	report(Progress{Phase: "prepare", Message: "Locking CPU frequency and disabling turbo boost..."})
+	restoreCPU, err := PinCPU()
+	if err != nil {
+		return result, fmt.Errorf("pin CPU: %w", err)
+	}
+	defer func() {
+		report(Progress{Phase: "restore", Message: "Restoring CPU settings..."})
+		restoreCPU()
+	}()
+
+	cpuFreq, _ := GetCPUFrequency()
+	report(Progress{Phase: "prepare", Message: fmt.Sprintf("CPU locked to %d kHz", cpuFreq)})
+
+	// Set brightness to 0% as the starting point for measurements.
+	if err := SetBrightness(blDir, 0); err != nil {
+		return result, fmt.Errorf("set brightness: %w", err)
+	}
+
+	var samples []BrightnessSample
+	var baselinePower int64
+	powerNowWarned := false
+	for i, pct := range opts.Levels {
+		level := i + 1
+		brightnessWarned := false
+		reassert := func() {
+			if err := SetBrightness(blDir, pct); err != nil && !brightnessWarned {
+				report(Progress{Level: level, BrightnessPct: pct, Phase: "warning",
+					Message: fmt.Sprintf("warning: failed to reassert brightness %d%%: %v", pct, err)})
+				brightnessWarned = true
+			}
+		}
+
+		report(Progress{Level: level, BrightnessPct: pct, Phase: "level",
+			Message: fmt.Sprintf("Level %d/%d: brightness %d%% (settling %v)", level, len(opts.Levels), pct, opts.SettleWait)})
+		if err := SetBrightness(blDir, pct); err != nil {
+			return result, fmt.Errorf("set brightness %d%%: %w", pct, err)
+		}
+
+		// Keep reasserting brightness to counter desktop idle dimming.
+		settleStart := time.Now()
+		deadline := settleStart.Add(opts.SettleWait)
+		for remaining := time.Until(deadline); remaining > 0; remaining = time.Until(deadline) {
+			report(Progress{Level: level, BrightnessPct: pct, Phase: "settle",
+				ElapsedSec:   int(time.Since(settleStart).Seconds()),
+				RemainingSec: int(remaining.Round(time.Second).Seconds()),
+				Message:      fmt.Sprintf("[settle] remaining: %2ds", int(remaining.Round(time.Second).Seconds()))})
+			reassert()
+			time.Sleep(min(time.Second, remaining))
+		}
+
+		// Measure power usage over the next fixed sampling window.
+		lastReassertSec := -1
+		avg, avgErr, deltaChargeUAH, chargeQuantUAH, chargeSteps, err := MeasurePowerOverWindowWithDiagnostics(
+			opts.Sampler,
+			opts.SampleDuration,
+			opts.SamplePoll,
+			opts.MaxStepWait,
+			func(phase string, elapsed, remaining time.Duration, chargeNowUAH, voltageUV int64) {
+				sec := int(elapsed.Seconds())
+				if sec != lastReassertSec {
+					reassert()
+					lastReassertSec = sec
+				}
+				report(Progress{
+					Level:         level,
+					BrightnessPct: pct,
+					Phase:         phase,
+					ElapsedSec:    sec,
+					RemainingSec:  int(remaining.Seconds()),
+					ChargeNowUAH:  chargeNowUAH,
+					VoltageUV:     voltageUV,
+					Message:       diagnosticMessage(phase, elapsed, remaining, chargeNowUAH, voltageUV),
+				})
+			},
+		)
+		if err != nil {
+			return result, fmt.Errorf("measure power at %d%%: %w", pct, err)
+		}
+		// A zero charge delta only comes back from the power_now fallback.
+		if deltaChargeUAH == 0 {
+			if !powerNowWarned {
+				report(Progress{Level: level, BrightnessPct: pct, Phase: "warning",
+					Message: "warning: battery reports no charge level; averaging power_now instead, expect higher uncertainty"})
+				powerNowWarned = true
+			}
+			report(Progress{Level: level, BrightnessPct: pct, Phase: "result",
+				Message: fmt.Sprintf("-> avg: %.2f W +/- %.3f W (power_now)",
+					float64(avg)/1e6, float64(avgErr)/1e6)})
+		} else {
+			report(Progress{Level: level, BrightnessPct: pct, Phase: "result",
+				Message: fmt.Sprintf("-> avg: %.2f W +/- %.3f W (delta charge: %d uAh in %d steps, q=%d uAh)",
+					float64(avg)/1e6, float64(avgErr)/1e6, deltaChargeUAH, chargeSteps, chargeQuantUAH)})
+		}
+
+		samples = append(samples, BrightnessSample{
+			BrightnessPct:         pct,
+			AvgPowerUW:            avg,
+			AvgPowerErrorUW:       avgErr,
+			DeltaChargeUAH:        deltaChargeUAH,
+			ChargeQuantizationUAH: chargeQuantUAH,
+			ChargeSteps:           chargeSteps,
+		})
+		if pct == 0 {
+			baselinePower = avg
+		}
+	}
+
+	return CalibrationResult{
+		BaselinePowerUW: baselinePower,
+		Samples:         samples,
+		CPUFrequencyKHz: cpuFreq,
+		BacklightDevice: backlight,
+		CalibratedAt:    time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// diagnosticMessage formats a measurement diagnostic for display.
+func diagnosticMessage(phase string, elapsed, remaining time.Duration, chargeNowUAH, voltageUV int64) string {
+	switch phase {
+	case "wait-charge-step":
+		return fmt.Sprintf("[diag] waiting charge-step t=%2ds charge=%d uAh voltage=%.3f V",
+			int(elapsed.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
+	case "charge-step-timeout":
+		return fmt.Sprintf("warning: no charge step after %ds; starting at charge=%d uAh, expect higher uncertainty",
+			int(elapsed.Seconds()), chargeNowUAH)
+	case "window":
+		return fmt.Sprintf("[diag] sample t=%2ds remaining=%2ds charge=%d uAh voltage=%.3f V",
+			int(elapsed.Seconds()), int(remaining.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
+	case "wait-end-charge-step":
+		return fmt.Sprintf("[diag] waiting end charge-step t=%2ds charge=%d uAh voltage=%.3f V",
+			int(elapsed.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
+	case "end-charge-step-timeout":
+		return fmt.Sprintf("warning: no end charge step; ending at t=%2ds charge=%d uAh, expect higher uncertainty",
+			int(elapsed.Seconds()), chargeNowUAH)
+	case "end":
+		return fmt.Sprintf("[diag] end t=%2ds charge=%d uAh voltage=%.3f V",
+			int(elapsed.Seconds()), chargeNowUAH, float64(voltageUV)/1e6)
+	default:
+		return phase
+	}
+}
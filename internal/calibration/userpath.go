@@ -0,0 +1,46 @@
+package calibration
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// ResultPath returns where the user's calibration result is kept:
+// power-monitor/calibration.json under the XDG config directory. Under sudo
+// it resolves the invoking user's directory rather than root's, so
+// power-calibrate and the GUI agree on the file.
+func ResultPath() (string, error) {
+	if sudoUser := os.Getenv("SUDO_USER"); sudoUser != "" {
+		home := filepath.Join("/home", sudoUser)
+		if u, err := user.Lookup(sudoUser); err == nil && u.HomeDir != "" {
+			home = u.HomeDir
+		}
+		return filepath.Join(home, ".config", "power-monitor", "calibration.json"), nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "power-monitor", "calibration.json"), nil
+}
+
+// ChownToSudoUser hands paths to the user who invoked sudo, so files written
+// as root stay readable and writable without it. Without sudo, or when the
+// user can't be looked up, it does nothing; root can still use the files.
+func ChownToSudoUser(paths ...string) {
+	sudoUser := os.Getenv("SUDO_USER")
+	if sudoUser == "" {
+		return
+	}
+	u, err := user.Lookup(sudoUser)
+	if err != nil {
+		return
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	for _, path := range paths {
+		os.Chown(path, uid, gid)
+	}
+}
@@ -0,0 +1,31 @@
+package calibration
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResultPath(t *testing.T) {
+	t.Setenv("SUDO_USER", "")
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	path, err := ResultPath()
+	if err != nil {
+		t.Fatalf("ResultPath() error = %v", err)
+	}
+	if want := filepath.Join(dir, "power-monitor", "calibration.json"); path != want {
+		t.Fatalf("ResultPath() = %q, want %q", path, want)
+	}
+}
+
+func TestResultPath_SudoUser(t *testing.T) {
+	t.Setenv("SUDO_USER", "no-such-user-for-test")
+	path, err := ResultPath()
+	if err != nil {
+		t.Fatalf("ResultPath() error = %v", err)
+	}
+	want := "/home/no-such-user-for-test/.config/power-monitor/calibration.json"
+	if path != want {
+		t.Fatalf("ResultPath() = %q, want %q", path, want)
+	}
+}
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EventAnnotator turns battery samples into automatic timeline annotations:
+// a power spike when the draw on battery rises to at least a threshold, and
+// each AC plug or unplug. A spike is annotated once when it starts; the draw
+// must fall back below the threshold before the next one counts.
+type EventAnnotator struct {
+	acKnown bool
+	onAC    bool
+	inSpike bool
+}
+
+// AnnotatorOptions selects which battery events EventAnnotator annotates.
+type AnnotatorOptions struct {
+	PowerSpikeUW  int64 // draw that counts as a spike; 0 turns spikes off
+	ACTransitions bool
+}
+
+// NewEventAnnotator creates an EventAnnotator.
+func NewEventAnnotator() *EventAnnotator {
+	return &EventAnnotator{}
+}
+
+// Observe returns the annotations for one battery sample. State is tracked
+// whatever the options, so turning a detector on does not annotate the
+// current state as a new event.
+func (a *EventAnnotator) Observe(s BatterySample, opts AnnotatorOptions) []Annotation {
+	var out []Annotation
+	onAC := s.ACSource != ""
+	if a.acKnown && onAC != a.onAC && opts.ACTransitions {
+		text := "AC unplugged"
+		if onAC {
+			text = "AC plugged in (" + s.ACSource + ")"
+		}
+		out = append(out, autoAnnotation(s.Timestamp, text))
+	}
+	a.acKnown, a.onAC = true, onAC
+
+	// On AC the reading is charge power, not what the machine draws.
+	spike := !onAC && opts.PowerSpikeUW > 0 && s.PowerUW >= opts.PowerSpikeUW
+	if spike && !a.inSpike {
+		out = append(out, autoAnnotation(s.Timestamp, fmt.Sprintf("Power spike: %.1f W", float64(s.PowerUW)/1e6)))
+	}
+	a.inSpike = spike
+	return out
+}
+
+// PowerStateAnnotations returns the annotations marking a sleep or shutdown
+// event: one where it began and one where the machine came back.
+func PowerStateAnnotations(e PowerStateEvent) []Annotation {
+	span := formatSpan(e.EndTime - e.StartTime)
+	if e.Type == "shutdown" {
+		return []Annotation{
+			autoAnnotation(e.StartTime, "Shut down"),
+			autoAnnotation(e.EndTime, "Booted after "+span),
+		}
+	}
+	kind := e.Type
+	if e.Subtype != "" {
+		kind += " (" + e.Subtype + ")"
+	}
+	return []Annotation{
+		autoAnnotation(e.StartTime, "Sleep: "+kind),
+		autoAnnotation(e.EndTime, "Resumed after "+span),
+	}
+}
+
+const capacityDropText = "Battery capacity dropped"
+
+// CapacityDropAnnotation returns the annotation marking a full-charge
+// capacity drop.
+func CapacityDropAnnotation(d CapacityDrop) Annotation {
+	return autoAnnotation(d.Timestamp, fmt.Sprintf("%s %.1f%%", capacityDropText, d.DropPct))
+}
+
+// IsCapacityDropAnnotation reports whether a was placed by
+// CapacityDropAnnotation.
+func IsCapacityDropAnnotation(a Annotation) bool {
+	return a.Source == AnnotationSourceAuto && strings.HasPrefix(a.Text, capacityDropText)
+}
+
+func autoAnnotation(ts int64, text string) Annotation {
+	return Annotation{Timestamp: ts, Text: text, Source: AnnotationSourceAuto}
+}
+
+// formatSpan formats secs as "2h 5m", "5m" or "40s".
+func formatSpan(secs int64) string {
+	switch {
+	case secs >= 3600:
+		return fmt.Sprintf("%dh %dm", secs/3600, secs%3600/60)
+	case secs >= 60:
+		return fmt.Sprintf("%dm", secs/60)
+	default:
+		return fmt.Sprintf("%ds", max(secs, 0))
+	}
+}
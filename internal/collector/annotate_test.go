@@ -0,0 +1,81 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventAnnotator_PowerSpikesAndACTransitions(t *testing.T) {
+	a := NewEventAnnotator()
+	opts := AnnotatorOptions{PowerSpikeUW: 30_000_000, ACTransitions: true}
+
+	steps := []struct {
+		sample BatterySample
+		want   []Annotation
+	}{
+		{BatterySample{Timestamp: 10, PowerUW: 8_000_000}, nil},
+		{BatterySample{Timestamp: 15, PowerUW: 35_000_000}, []Annotation{autoAnnotation(15, "Power spike: 35.0 W")}},
+		{BatterySample{Timestamp: 20, PowerUW: 40_000_000}, nil}, // same spike
+		{BatterySample{Timestamp: 25, PowerUW: 9_000_000}, nil},
+		// Charge power on AC is not a spike.
+		{BatterySample{Timestamp: 30, PowerUW: 45_000_000, ACSource: "ACAD"}, []Annotation{autoAnnotation(30, "AC plugged in (ACAD)")}},
+		{BatterySample{Timestamp: 35, PowerUW: 31_000_000}, []Annotation{
+			autoAnnotation(35, "AC unplugged"),
+			autoAnnotation(35, "Power spike: 31.0 W"),
+		}},
+	}
+	for _, step := range steps {
+		if got := a.Observe(step.sample, opts); !reflect.DeepEqual(got, step.want) {
+			t.Fatalf("Observe(t=%d) = %+v, want %+v", step.sample.Timestamp, got, step.want)
+		}
+	}
+}
+
+func TestEventAnnotator_DisabledDetectorsStillTrackState(t *testing.T) {
+	a := NewEventAnnotator()
+	off := AnnotatorOptions{}
+	on := AnnotatorOptions{PowerSpikeUW: 30_000_000, ACTransitions: true}
+
+	if got := a.Observe(BatterySample{Timestamp: 10, PowerUW: 35_000_000}, off); got != nil {
+		t.Fatalf("Observe() with detectors off = %+v, want none", got)
+	}
+	if got := a.Observe(BatterySample{Timestamp: 15, PowerUW: 1_000_000, ACSource: "ACAD"}, off); got != nil {
+		t.Fatalf("Observe() with detectors off = %+v, want none", got)
+	}
+	// Turning them on while still on AC annotates nothing.
+	if got := a.Observe(BatterySample{Timestamp: 20, PowerUW: 1_000_000, ACSource: "ACAD"}, on); got != nil {
+		t.Fatalf("Observe() after turning detectors on = %+v, want none", got)
+	}
+}
+
+func TestPowerStateAnnotations(t *testing.T) {
+	got := PowerStateAnnotations(PowerStateEvent{StartTime: 100, EndTime: 100 + 7500, Type: "suspend", Subtype: "s2idle"})
+	want := []Annotation{autoAnnotation(100, "Sleep: suspend (s2idle)"), autoAnnotation(7600, "Resumed after 2h 5m")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PowerStateAnnotations(suspend) = %+v, want %+v", got, want)
+	}
+
+	got = PowerStateAnnotations(PowerStateEvent{StartTime: 100, EndTime: 400, Type: "shutdown"})
+	want = []Annotation{autoAnnotation(100, "Shut down"), autoAnnotation(400, "Booted after 5m")}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("PowerStateAnnotations(shutdown) = %+v, want %+v", got, want)
+	}
+}
+
+func TestCapacityDropAnnotation(t *testing.T) {
+	got := CapacityDropAnnotation(CapacityDrop{Timestamp: 500, DropPct: 4.25})
+	if want := autoAnnotation(500, "Battery capacity dropped 4.2%"); got != want {
+		t.Fatalf("CapacityDropAnnotation() = %+v, want %+v", got, want)
+	}
+	if got.Source != AnnotationSourceAuto {
+		t.Fatalf("Source = %q, want %q", got.Source, AnnotationSourceAuto)
+	}
+	if !IsCapacityDropAnnotation(got) {
+		t.Fatal("IsCapacityDropAnnotation(CapacityDropAnnotation()) = false, want true")
+	}
+	user := got
+	user.Source = AnnotationSourceUser
+	if IsCapacityDropAnnotation(user) {
+		t.Fatal("IsCapacityDropAnnotation(user annotation) = true, want false")
+	}
+}
@@ -9,17 +9,13 @@ import (
 	"time"
 )
 
-// CollectBacklight reads backlight brightness from /sys/class/backlight/*.
-func CollectBacklight() (*BacklightSample, error) {
-	matches, err := filepath.Glob(filepath.Join(sysfsRoot, "class/backlight/*"))
+// CollectBacklight reads backlight brightness from the device FindBacklightDir
+// picks for pattern.
+func CollectBacklight(pattern string) (*BacklightSample, error) {
+	dir, err := FindBacklightDir(pattern)
 	if err != nil {
-		return nil, fmt.Errorf("glob backlight: %w", err)
+		return nil, err
 	}
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("no backlight found")
-	}
-
-	dir := matches[0]
 	brightness, err := readIntFile(filepath.Join(dir, "brightness"))
 	if err != nil {
 		return nil, fmt.Errorf("read brightness: %w", err)
@@ -12,7 +12,7 @@ func TestCollectBacklight_ParsesValues(t *testing.T) {
 	writeTestFile(t, filepath.Join(dir, "brightness"), "123\n")
 	writeTestFile(t, filepath.Join(dir, "max_brightness"), "456\n")
 
-	sample, err := CollectBacklight()
+	sample, err := CollectBacklight("")
 	if err != nil {
 		t.Fatalf("CollectBacklight() error = %v", err)
 	}
@@ -31,7 +31,7 @@ func TestCollectBacklight_ParsesValues(t *testing.T) {
 func TestCollectBacklight_NoBacklightFound(t *testing.T) {
 	_ = setTestSysfsRoot(t)
 
-	_, err := CollectBacklight()
+	_, err := CollectBacklight("")
 	if err == nil {
 		t.Fatal("CollectBacklight() error = nil, want no backlight found error")
 	}
@@ -45,7 +45,7 @@ func TestCollectBacklight_BrightnessReadError(t *testing.T) {
 	dir := filepath.Join(root, "class/backlight/intel_backlight")
 	writeTestFile(t, filepath.Join(dir, "max_brightness"), "456\n")
 
-	_, err := CollectBacklight()
+	_, err := CollectBacklight("")
 	if err == nil {
 		t.Fatal("CollectBacklight() error = nil, want read brightness error")
 	}
@@ -59,7 +59,7 @@ func TestCollectBacklight_MaxBrightnessReadError(t *testing.T) {
 	dir := filepath.Join(root, "class/backlight/intel_backlight")
 	writeTestFile(t, filepath.Join(dir, "brightness"), "123\n")
 
-	_, err := CollectBacklight()
+	_, err := CollectBacklight("")
 	if err == nil {
 		t.Fatal("CollectBacklight() error = nil, want read max_brightness error")
 	}
@@ -74,7 +74,7 @@ func TestCollectBacklight_InvalidBrightnessValue(t *testing.T) {
 	writeTestFile(t, filepath.Join(dir, "brightness"), "not-a-number\n")
 	writeTestFile(t, filepath.Join(dir, "max_brightness"), "456\n")
 
-	_, err := CollectBacklight()
+	_, err := CollectBacklight("")
 	if err == nil {
 		t.Fatal("CollectBacklight() error = nil, want parse error")
 	}
@@ -1,90 +1,489 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 )
 
-var sysfsRoot = "/sys"
+const (
+	// ueventReadAttempts bounds how often Collect tries to read the battery
+	// uevent in one cycle; embedded controllers occasionally fail a read
+	// that succeeds immediately afterwards.
+	ueventReadAttempts = 2
+	ueventRetryDelay   = 5 * time.Millisecond
+)
+
+// ErrNoBattery is returned by FindBatteryDirs, and so by Collect, when no
+// battery matches, e.g. because a removable or dock battery was taken out.
+var ErrNoBattery = errors.New("no battery found")
+
+// ErrNoBatteryData is returned by Collect when the battery reports a status
+// but no voltage, current, power, charge or capacity. Storing such a reading
+// would show as an empty battery drawing nothing.
+var ErrNoBatteryData = errors.New("battery reports no numeric data")
+
+// batteryDataKeys are the uevent properties Collect reads numbers from.
+var batteryDataKeys = []string{
+	"POWER_SUPPLY_VOLTAGE_NOW",
+	"POWER_SUPPLY_CURRENT_NOW",
+	"POWER_SUPPLY_POWER_NOW",
+	"POWER_SUPPLY_CHARGE_NOW",
+	"POWER_SUPPLY_CAPACITY",
+}
 
-// historyEntry records a charge/voltage reading at a point in time.
+// hasBatteryData reports whether any of batteryDataKeys holds a non-zero
+// number.
+func hasBatteryData(props map[string]string) bool {
+	for _, key := range batteryDataKeys {
+		if v, err := strconv.ParseInt(props[key], 10, 64); err == nil && v != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile is swapped out in tests to simulate transient read failures.
+var readFile = os.ReadFile
+
+// historyEntry records a charge/energy/voltage reading at a point in time.
+// chargeUAH or energyUWH is 0 when the battery does not report it.
 type historyEntry struct {
 	timestamp int64
 	chargeUAH int64
+	energyUWH int64
 	voltageUV int64
 }
 
+// DeltaQuantity selects which battery counter BatteryCollector derives the
+// averaged power from.
+type DeltaQuantity string
+
+const (
+	// DeltaQuantityAuto uses charge_now, switching to energy_now while a
+	// battery that reports both is under load (see energyLoadUW).
+	DeltaQuantityAuto DeltaQuantity = "auto"
+	// DeltaQuantityCharge uses charge_now whenever the battery reports it.
+	DeltaQuantityCharge DeltaQuantity = "charge"
+	// DeltaQuantityEnergy uses energy_now whenever the battery reports it.
+	DeltaQuantityEnergy DeltaQuantity = "energy"
+)
+
+// energyLoadUW is the energy-delta power from which DeltaQuantityAuto
+// prefers energy_now. Batteries reporting both counters derive one from the
+// other in the EC, and under load the charge figure lags the voltage sag, so
+// energy more directly reflects the work done. At light load the two agree
+// and charge keeps its finer resolution.
+const energyLoadUW = 15_000_000
+
+// chargeWindow averages power from the charge and energy changes across
+// windowSec seconds of readings.
+type chargeWindow struct {
+	windowSec  int64
+	history    []historyEntry
+	voltageSum int64 // sum of history voltages, kept in step with history
+}
+
+// packWindows holds the averaging windows of one battery pack.
+type packWindows struct {
+	chargeWindow              // reported as PowerUW
+	smoothed     chargeWindow // reported as PowerSmoothedUW
+}
+
 // BatteryCollector tracks battery readings and computes averaged power from
-// charge deltas over a configurable time window.
+// charge deltas over a configurable time window, and optionally over a second,
+// longer window for display. Every battery pack matching the device pattern
+// is read, and the packs are combined into one sample.
 type BatteryCollector struct {
-	windowSec int64
-	history   []historyEntry
+	windowSec         int64
+	smoothedWindowSec int64                   // 0 disables the smoothed average
+	packs             map[string]*packWindows // by power supply name
+	preferSysfs       bool
+	quantity          DeltaQuantity
+	device            string // FindBatteryDirs pattern; "" picks the default
+	roundingUW        int64  // granularity power readings are rounded to; 0 keeps them
+
+	// Battery presence as of the last Collect, for detecting removal and
+	// reinsertion. presenceKnown is false until the first Collect.
+	presenceKnown  bool
+	present        bool
+	lastBattery    string // names of the batteries last found, comma-separated
+	presenceChange *BatteryPresenceEvent
 }
 
 // NewBatteryCollector creates a BatteryCollector that averages charge deltas
-// over the given window (in seconds).
-func NewBatteryCollector(windowSec int64) *BatteryCollector {
-	return &BatteryCollector{windowSec: windowSec}
+// over the given window (in seconds). With preferSysfs the instantaneous sysfs
+// reading is reported whenever available and the charge-delta average is only
+// a fallback, trading the averaging's smoothing for lower latency. device is
+// the FindBatteryDirs pattern selecting the batteries.
+func NewBatteryCollector(windowSec int64, preferSysfs bool, device string) *BatteryCollector {
+	return &BatteryCollector{windowSec: windowSec, packs: make(map[string]*packWindows), preferSysfs: preferSysfs, quantity: DeltaQuantityAuto, device: device}
+}
+
+// pack returns the averaging windows of the named battery, creating empty
+// ones on its first reading.
+func (bc *BatteryCollector) pack(name string) *packWindows {
+	p := bc.packs[name]
+	if p == nil {
+		p = &packWindows{
+			chargeWindow: chargeWindow{windowSec: bc.windowSec},
+			smoothed:     chargeWindow{windowSec: bc.smoothedWindowSec},
+		}
+		bc.packs[name] = p
+	}
+	return p
 }
 
-// Collect reads battery info from /sys/class/power_supply/BAT* and computes
-// power from charge deltas averaged over the configured window.
+// SetDeltaQuantity selects the counter the averaged power is derived from.
+// The histories keep both counters, so a change applies from the next Collect.
+func (bc *BatteryCollector) SetDeltaQuantity(q DeltaQuantity) {
+	bc.quantity = q
+}
+
+// SetWindow changes the charge-delta averaging window, in seconds. Samples
+// already in the history are kept and trimmed to the new window on the next
+// Collect.
+func (bc *BatteryCollector) SetWindow(windowSec int64) {
+	bc.windowSec = windowSec
+	for _, p := range bc.packs {
+		p.windowSec = windowSec
+	}
+}
+
+// SetSmoothedWindow sets the window, in seconds, of the second charge-delta
+// average reported as PowerSmoothedUW. 0 turns it off and drops its history.
+func (bc *BatteryCollector) SetSmoothedWindow(windowSec int64) {
+	bc.smoothedWindowSec = windowSec
+	for _, p := range bc.packs {
+		p.smoothed.windowSec = windowSec
+		if windowSec <= 0 {
+			p.smoothed.history = nil
+			p.smoothed.voltageSum = 0
+		}
+	}
+}
+
+// SetPowerRounding sets the granularity, in µW, that Collect rounds every
+// power value of a sample to. 0 turns rounding off. The charge-delta
+// averages are computed from unrounded readings either way.
+func (bc *BatteryCollector) SetPowerRounding(stepUW int64) {
+	bc.roundingUW = max(stepUW, 0)
+}
+
+// roundPower rounds uw to the nearest multiple of stepUW, halves away from
+// zero. A stepUW of 0 or less returns uw unchanged.
+func roundPower(uw, stepUW int64) int64 {
+	if stepUW <= 0 {
+		return uw
+	}
+	if uw < 0 {
+		return -roundPower(-uw, stepUW)
+	}
+	return (uw + stepUW/2) / stepUW * stepUW
+}
+
+// Collect reads every battery FindBatteryDirs finds and combines them into
+// one sample. Each pack's power comes from its charge deltas averaged over
+// the configured window, or directly from sysfs when the collector prefers
+// that, and the packs' powers are summed.
 func (bc *BatteryCollector) Collect() (*BatterySample, error) {
-	matches, err := filepath.Glob(filepath.Join(sysfsRoot, "class/power_supply/BAT*"))
+	dirs, err := FindBatteryDirs(bc.device)
+	if errors.Is(err, ErrNoBattery) {
+		bc.notePresence(false, "")
+	}
 	if err != nil {
-		return nil, fmt.Errorf("glob battery: %w", err)
+		return nil, err
 	}
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("no battery found")
+	names := make([]string, len(dirs))
+	for i, dir := range dirs {
+		names[i] = filepath.Base(dir)
 	}
+	bc.notePresence(true, strings.Join(names, ","))
+	// A pack that is gone takes its history with it, so one put back later
+	// starts afresh rather than averaging across its absence.
+	maps.DeleteFunc(bc.packs, func(name string, _ *packWindows) bool {
+		return !slices.Contains(names, name)
+	})
 
-	ueventPath := filepath.Join(matches[0], "uevent")
-	data, err := os.ReadFile(ueventPath)
-	if err != nil {
-		return nil, fmt.Errorf("read uevent: %w", err)
+	ts := time.Now().Unix()
+	var packs []packReading
+	for i, dir := range dirs {
+		data, err := readUevent(filepath.Join(dir, "uevent"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: read uevent: %w", names[i], err)
+		}
+		props := parseUevent(string(data))
+		if hasBatteryData(props) {
+			packs = append(packs, bc.readPack(names[i], ts, props))
+		}
+	}
+	if len(packs) == 0 {
+		return nil, fmt.Errorf("%s: %w", names[0], ErrNoBatteryData)
 	}
+	s := combinePacks(packs)
+	s.Timestamp = ts
 
-	props := parseUevent(string(data))
-	s := &BatterySample{
-		Timestamp: time.Now().Unix(),
-		Status:    props["POWER_SUPPLY_STATUS"],
+	var acDir string
+	s.ACSource, acDir = onlineACSupply()
+	if acDir != "" {
+		s.ChargerPowerUW = readChargerPowerUW(acDir)
+	}
+
+	// Some firmware reports "Discharging" at full capacity while on AC power.
+	// The numeric capacity may stall just short of 100 while capacity_level
+	// already says Full, so accept either.
+	full := s.CapacityPct >= 100 || s.CapacityLevel == "Full"
+	if s.Status == "Discharging" && full && s.ACSource != "" {
+		s.Status = "Full"
+	}
+
+	s.PowerUW = roundPower(s.PowerUW, bc.roundingUW)
+	s.PowerSmoothedUW = roundPower(s.PowerSmoothedUW, bc.roundingUW)
+	s.SysfsPowerUW = roundPower(s.SysfsPowerUW, bc.roundingUW)
+	s.ChargerPowerUW = roundPower(s.ChargerPowerUW, bc.roundingUW)
+
+	return s, nil
+}
+
+// notePresence records whether Collect found a battery. When that changes
+// after the first Collect it queues a BatteryPresenceEvent for
+// PresenceChange and clears the charge histories: readings from before a
+// removal say nothing about the charge of the battery that comes back.
+func (bc *BatteryCollector) notePresence(present bool, name string) {
+	changed := bc.presenceKnown && present != bc.present
+	bc.presenceKnown, bc.present = true, present
+	if present {
+		bc.lastBattery = name
+	}
+	if !changed {
+		return
 	}
-	s.VoltageUV, _ = strconv.ParseInt(props["POWER_SUPPLY_VOLTAGE_NOW"], 10, 64)
-	s.CurrentUA, _ = strconv.ParseInt(props["POWER_SUPPLY_CURRENT_NOW"], 10, 64)
-	s.ChargeNowUAH, _ = strconv.ParseInt(props["POWER_SUPPLY_CHARGE_NOW"], 10, 64)
-	cap, _ := strconv.ParseInt(props["POWER_SUPPLY_CAPACITY"], 10, 64)
-	s.CapacityPct = int(cap)
+	clear(bc.packs)
+	bc.presenceChange = &BatteryPresenceEvent{Timestamp: time.Now().Unix(), Present: present, Battery: bc.lastBattery}
+}
+
+// PresenceChange returns the battery removal or reinsertion detected by the
+// last Collect, or nil if there was none. Each change is returned once.
+func (bc *BatteryCollector) PresenceChange() *BatteryPresenceEvent {
+	ev := bc.presenceChange
+	bc.presenceChange = nil
+	return ev
+}
+
+// packReading is one battery pack's contribution to a BatterySample.
+type packReading struct {
+	status          string
+	capacityLevel   string
+	capacityPct     int
+	voltageUV       int64
+	currentUA       int64
+	chargeUAH       int64
+	designChargeUAH int64
+	designEnergyUWH int64
+	powerUW         int64
+	powerSource     PowerSource
+	smoothedUW      int64
+	sysfsPowerUW    int64
+}
+
+// readPack parses the named pack's uevent properties and adds the reading
+// taken at ts to its averaging windows.
+func (bc *BatteryCollector) readPack(name string, ts int64, props map[string]string) packReading {
+	num := func(key string) int64 {
+		v, _ := strconv.ParseInt(props["POWER_SUPPLY_"+key], 10, 64)
+		return v
+	}
+	r := packReading{
+		status:          props["POWER_SUPPLY_STATUS"],
+		capacityLevel:   props["POWER_SUPPLY_CAPACITY_LEVEL"],
+		capacityPct:     int(num("CAPACITY")),
+		voltageUV:       num("VOLTAGE_NOW"),
+		currentUA:       num("CURRENT_NOW"),
+		chargeUAH:       num("CHARGE_NOW"),
+		designChargeUAH: num("CHARGE_FULL_DESIGN"),
+		designEnergyUWH: num("ENERGY_FULL_DESIGN"),
+	}
+	energyNowUWH := num("ENERGY_NOW")
 
 	// Compute sysfs power: prefer power_now, fall back to voltage × current.
-	sysfsPower, _ := strconv.ParseInt(props["POWER_SUPPLY_POWER_NOW"], 10, 64)
-	if sysfsPower == 0 && s.VoltageUV > 0 && s.CurrentUA > 0 {
-		sysfsPower = (s.VoltageUV / 1000) * (s.CurrentUA / 1000)
+	r.sysfsPowerUW = num("POWER_NOW")
+	sysfsSource := PowerSourceSysfsPowerNow
+	if r.sysfsPowerUW == 0 && r.voltageUV > 0 && r.currentUA > 0 {
+		r.sysfsPowerUW = (r.voltageUV / 1000) * (r.currentUA / 1000)
+		sysfsSource = PowerSourceSysfsVoltageCurrent
 	}
-	s.SysfsPowerUW = sysfsPower
 
-	// Gap detection: if the last history entry is too old, clear history.
+	w := bc.pack(name)
+	r.powerUW, r.powerSource = pickDeltaPower(bc.quantity, w.deltaPower(ts, r.chargeUAH, energyNowUWH, r.voltageUV))
+	if bc.smoothedWindowSec > 0 {
+		r.smoothedUW, _ = pickDeltaPower(bc.quantity, w.smoothed.deltaPower(ts, r.chargeUAH, energyNowUWH, r.voltageUV))
+	}
+
+	// Use sysfs power when preferred, or as a fallback if there is not
+	// enough history for averaging. History is kept either way so the
+	// average is ready when sysfs stops reporting.
+	if r.sysfsPowerUW > 0 && (r.powerUW == 0 || bc.preferSysfs) {
+		r.powerUW = r.sysfsPowerUW
+		r.powerSource = sysfsSource
+	}
+	return r
+}
+
+// combinePacks merges pack readings into one sample. Currents, charges and
+// powers are summed; voltage and capacity are averaged weighted by each
+// pack's design capacity (see packWeights). The power source is that of the
+// pack contributing the most power, and the capacity level that of the
+// emptiest pack.
+func combinePacks(packs []packReading) *BatterySample {
+	s := &BatterySample{
+		Status:        combineStatus(packs),
+		BatteryCount:  len(packs),
+		PowerSource:   packs[0].powerSource,
+		CapacityLevel: packs[0].capacityLevel,
+	}
+	weights := packWeights(packs)
+	var weightSum, capacitySum, voltageWeight, voltageSum int64
+	largest, emptiest := packs[0].powerUW, packs[0].capacityPct
+	for i, p := range packs {
+		s.CurrentUA += p.currentUA
+		s.ChargeNowUAH += p.chargeUAH
+		s.PowerUW += p.powerUW
+		s.PowerSmoothedUW += p.smoothedUW
+		s.SysfsPowerUW += p.sysfsPowerUW
+		if p.powerUW > largest {
+			largest, s.PowerSource = p.powerUW, p.powerSource
+		}
+		if p.capacityPct < emptiest {
+			emptiest, s.CapacityLevel = p.capacityPct, p.capacityLevel
+		}
+		weightSum += weights[i]
+		capacitySum += int64(p.capacityPct) * weights[i]
+		// A pack not reporting its voltage would drag the average to 0.
+		if p.voltageUV > 0 {
+			voltageWeight += weights[i]
+			voltageSum += p.voltageUV * weights[i]
+		}
+	}
+	s.CapacityPct = int((capacitySum + weightSum/2) / weightSum)
+	if voltageWeight > 0 {
+		s.VoltageUV = voltageSum / voltageWeight
+	}
+	return s
+}
+
+// packWeights returns the weight of each pack when averaging voltage and
+// capacity: its design charge when every pack reports one, else its design
+// energy when every pack reports that, else equal weights.
+func packWeights(packs []packReading) []int64 {
+	allCharge, allEnergy := true, true
+	for _, p := range packs {
+		allCharge = allCharge && p.designChargeUAH > 0
+		allEnergy = allEnergy && p.designEnergyUWH > 0
+	}
+	weights := make([]int64, len(packs))
+	for i, p := range packs {
+		switch {
+		case allCharge:
+			weights[i] = p.designChargeUAH
+		case allEnergy:
+			weights[i] = p.designEnergyUWH
+		default:
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+// combineStatus resolves the packs' statuses: Charging if any pack is
+// charging, else Discharging if any is discharging, else Full. A single pack
+// keeps the status it reports.
+func combineStatus(packs []packReading) string {
+	if len(packs) == 1 {
+		return packs[0].status
+	}
+	has := func(status string) bool {
+		return slices.ContainsFunc(packs, func(p packReading) bool { return p.status == status })
+	}
+	switch {
+	case has("Charging"):
+		return "Charging"
+	case has("Discharging"):
+		return "Discharging"
+	default:
+		return "Full"
+	}
+}
+
+// pickDeltaPower returns the delta power to report for quantity q, and its
+// source. A forced quantity the battery does not report falls back to the
+// other; "" is returned when neither average is available.
+func pickDeltaPower(q DeltaQuantity, d deltaPowers) (int64, PowerSource) {
+	useEnergy := d.energyUW > 0
+	switch {
+	case d.chargeUW <= 0 || d.energyUW <= 0:
+		// Only one counter (or neither) is available.
+	case q == DeltaQuantityCharge:
+		useEnergy = false
+	case q == DeltaQuantityEnergy:
+		useEnergy = true
+	default:
+		useEnergy = d.energyUW >= energyLoadUW
+	}
+	switch {
+	case useEnergy:
+		return d.energyUW, PowerSourceEnergyDelta
+	case d.chargeUW > 0:
+		return d.chargeUW, PowerSourceChargeDelta
+	default:
+		return 0, ""
+	}
+}
+
+// deltaPowers holds the power, in µW, implied by the charge and the energy
+// change across a window; each is 0 when unavailable.
+type deltaPowers struct {
+	chargeUW int64
+	energyUW int64
+}
+
+// deltaPower adds a reading taken at ts to the history and returns the power
+// implied by the charge and energy changes across the window. Each is 0 when
+// the battery does not report that counter at both ends of the window or the
+// history spans less than a second. The average voltage comes from a running
+// sum, so each call costs O(1) amortized however long the window is.
+func (bc *chargeWindow) deltaPower(ts, chargeUAH, energyUWH, voltageUV int64) deltaPowers {
+	// Gap detection: if the last history entry is too old, or newer than now
+	// because the wall clock stepped backward (e.g. NTP correction), the
+	// history no longer measures elapsed time, so clear it.
 	if len(bc.history) > 0 {
 		last := bc.history[len(bc.history)-1]
-		if s.Timestamp-last.timestamp > 2*bc.windowSec {
+		if ts-last.timestamp > 2*bc.windowSec || ts < last.timestamp {
 			bc.history = bc.history[:0]
+			bc.voltageSum = 0
 		}
 	}
 
-	// Append current reading to history.
-	if s.ChargeNowUAH > 0 {
+	// Append current reading to history, keeping timestamps strictly
+	// increasing; a second reading within the same second is skipped.
+	if (chargeUAH > 0 || energyUWH > 0) && (len(bc.history) == 0 || ts > bc.history[len(bc.history)-1].timestamp) {
 		bc.history = append(bc.history, historyEntry{
-			timestamp: s.Timestamp,
-			chargeUAH: s.ChargeNowUAH,
-			voltageUV: s.VoltageUV,
+			timestamp: ts,
+			chargeUAH: chargeUAH,
+			energyUWH: energyUWH,
+			voltageUV: voltageUV,
 		})
+		bc.voltageSum += voltageUV
 	}
 
 	// Prune entries older than the window.
-	cutoff := s.Timestamp - bc.windowSec
+	cutoff := ts - bc.windowSec
 	pruneIdx := 0
 	for pruneIdx < len(bc.history) && bc.history[pruneIdx].timestamp < cutoff {
 		pruneIdx++
@@ -93,59 +492,83 @@ func (bc *BatteryCollector) Collect() (*BatterySample, error) {
 	if pruneIdx > 0 && pruneIdx < len(bc.history) {
 		pruneIdx-- // keep one entry before cutoff
 	}
-	if pruneIdx > 0 {
-		bc.history = bc.history[pruneIdx:]
+	for _, e := range bc.history[:pruneIdx] {
+		bc.voltageSum -= e.voltageUV
 	}
+	bc.history = bc.history[pruneIdx:]
 
 	// Compute averaged power from oldest to newest history entry.
-	if len(bc.history) >= 2 {
-		oldest := bc.history[0]
-		newest := bc.history[len(bc.history)-1]
-		deltaTimeSec := newest.timestamp - oldest.timestamp
-		if deltaTimeSec > 0 {
-			deltaCharge := oldest.chargeUAH - newest.chargeUAH // positive when discharging
-			if deltaCharge < 0 {
-				deltaCharge = -deltaCharge
-			}
-			// Average voltage across all entries in window.
-			var voltageSum int64
-			for _, e := range bc.history {
-				voltageSum += e.voltageUV
-			}
-			avgVoltageUV := voltageSum / int64(len(bc.history))
-			if avgVoltageUV > 0 {
-				s.PowerUW = (deltaCharge * (avgVoltageUV / 1000) * 3600) / (deltaTimeSec * 1000)
-				s.PowerFromChargeDelta = s.PowerUW > 0
-			}
-		}
+	var d deltaPowers
+	if len(bc.history) < 2 {
+		return d
 	}
-
-	// Fall back to sysfs power if not enough history for averaging.
-	if s.PowerUW == 0 {
-		s.PowerUW = s.SysfsPowerUW
+	oldest := bc.history[0]
+	newest := bc.history[len(bc.history)-1]
+	deltaTimeSec := newest.timestamp - oldest.timestamp
+	if deltaTimeSec <= 0 {
+		return d
 	}
+	if oldest.energyUWH > 0 && newest.energyUWH > 0 {
+		// µWh per second × 3600 is µW.
+		d.energyUW = abs(oldest.energyUWH-newest.energyUWH) * 3600 / deltaTimeSec
+	}
+	// Average voltage across all entries in window.
+	avgVoltageUV := bc.voltageSum / int64(len(bc.history))
+	if oldest.chargeUAH > 0 && newest.chargeUAH > 0 && avgVoltageUV > 0 {
+		deltaCharge := abs(oldest.chargeUAH - newest.chargeUAH)
+		d.chargeUW = (deltaCharge * (avgVoltageUV / 1000) * 3600) / (deltaTimeSec * 1000)
+	}
+	return d
+}
 
-	// Some firmware reports "Discharging" at full capacity while on AC power.
-	if s.Status == "Discharging" && s.CapacityPct >= 100 && isACOnline() {
-		s.Status = "Full"
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
 	}
+	return v
+}
 
-	return s, nil
+// readUevent reads a uevent file, retrying briefly after transient errors. A
+// missing file is reported immediately since retrying cannot help.
+func readUevent(path string) ([]byte, error) {
+	var err error
+	for attempt := 0; attempt < ueventReadAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(ueventRetryDelay)
+		}
+		var data []byte
+		data, err = readFile(path)
+		if err == nil {
+			return data, nil
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+	return nil, err
 }
 
-// isACOnline checks if any AC adapter is online.
-func isACOnline() bool {
-	matches, err := filepath.Glob(filepath.Join(sysfsRoot, "class/power_supply/AC*/online"))
-	if err != nil {
-		return false
+// readChargerPowerUW returns the rated/negotiated power of the charger at dir
+// in µW, or 0 if the firmware doesn't expose enough to compute it. Drivers vary
+// widely: prefer an explicit input_power_limit, then the negotiated maximum
+// voltage × current_max (USB-PD), then the present voltage × current_max.
+func readChargerPowerUW(dir string) int64 {
+	if limit, _ := readIntFile(filepath.Join(dir, "input_power_limit")); limit > 0 {
+		return limit
 	}
-	for _, path := range matches {
-		data, err := os.ReadFile(path)
-		if err == nil && strings.TrimSpace(string(data)) == "1" {
-			return true
-		}
+	currentMax, _ := readIntFile(filepath.Join(dir, "current_max"))
+	if currentMax <= 0 {
+		return 0
 	}
-	return false
+	voltage, _ := readIntFile(filepath.Join(dir, "voltage_max"))
+	if voltage <= 0 {
+		voltage, _ = readIntFile(filepath.Join(dir, "voltage_now"))
+	}
+	if voltage <= 0 {
+		return 0
+	}
+	// Divide first to avoid int64 overflow (µV × µA).
+	return (voltage / 1000) * (currentMax / 1000)
 }
 
 func parseUevent(data string) map[string]string {
@@ -7,17 +7,29 @@ import (
 	"strconv"
 )
 
-// CollectBatteryHealth reads battery identity and health info from sysfs.
-func CollectBatteryHealth() (*BatteryHealth, error) {
-	matches, err := filepath.Glob(filepath.Join(sysfsRoot, "class/power_supply/BAT*"))
+// WhVoltageBasis is the voltage charge capacities are converted to Wh at.
+type WhVoltageBasis string
+
+const (
+	// WhBasisMinDesign uses voltage_min_design. Many ACPI batteries report
+	// the design voltage there; on others it is the empty voltage, which
+	// undercounts the Wh other tools show.
+	WhBasisMinDesign WhVoltageBasis = "min_design"
+	// WhBasisNominal approximates the nominal voltage as the midpoint of
+	// voltage_min_design and voltage_max_design, or the one reported.
+	WhBasisNominal WhVoltageBasis = "nominal"
+)
+
+// CollectBatteryHealth reads battery identity and health info from sysfs, for
+// the battery FindBatteryDir picks for pattern. Wh capacities use
+// WhBasisMinDesign until SetWhBasis picks another basis.
+func CollectBatteryHealth(pattern string) (*BatteryHealth, error) {
+	dir, err := FindBatteryDir(pattern)
 	if err != nil {
-		return nil, fmt.Errorf("glob battery: %w", err)
-	}
-	if len(matches) == 0 {
-		return nil, fmt.Errorf("no battery found")
+		return nil, err
 	}
 
-	data, err := os.ReadFile(filepath.Join(matches[0], "uevent"))
+	data, err := os.ReadFile(filepath.Join(dir, "uevent"))
 	if err != nil {
 		return nil, fmt.Errorf("read uevent: %w", err)
 	}
@@ -33,6 +45,95 @@ func CollectBatteryHealth() (*BatteryHealth, error) {
 	h.ChargeFullDesignUAH, _ = strconv.ParseInt(props["POWER_SUPPLY_CHARGE_FULL_DESIGN"], 10, 64)
 	h.ChargeFullUAH, _ = strconv.ParseInt(props["POWER_SUPPLY_CHARGE_FULL"], 10, 64)
 	h.VoltageMinDesignUV, _ = strconv.ParseInt(props["POWER_SUPPLY_VOLTAGE_MIN_DESIGN"], 10, 64)
+	h.VoltageMaxDesignUV, _ = strconv.ParseInt(props["POWER_SUPPLY_VOLTAGE_MAX_DESIGN"], 10, 64)
+	h.VoltageNowUV, _ = strconv.ParseInt(props["POWER_SUPPLY_VOLTAGE_NOW"], 10, 64)
+	h.EnergyFullDesignUWH, _ = strconv.ParseInt(props["POWER_SUPPLY_ENERGY_FULL_DESIGN"], 10, 64)
+	h.EnergyFullUWH, _ = strconv.ParseInt(props["POWER_SUPPLY_ENERGY_FULL"], 10, 64)
+	h.SetWhBasis(WhBasisMinDesign)
+
+	// Most consumer laptops have no alarm attribute; absence or an
+	// unparsable value just leaves the threshold unset.
+	if alarm, err := readIntFile(filepath.Join(dir, "alarm")); err == nil && alarm > 0 {
+		if reportsEnergy(props) {
+			h.AlarmUWH = alarm
+		} else {
+			h.AlarmUAH = alarm
+		}
+	}
 
 	return h, nil
 }
+
+// SetWhBasis recomputes DesignWh and FullWh with charges converted at the
+// basis voltage. A battery missing the voltages the basis needs falls back to
+// the other design voltage, then to voltage_now, so some figure is shown.
+func (h *BatteryHealth) SetWhBasis(basis WhVoltageBasis) {
+	h.WhBasis = basis
+	h.WhVoltageUV = whVoltage(h, basis)
+	h.DesignWh = capacityWh(h.EnergyFullDesignUWH, h.ChargeFullDesignUAH, h.WhVoltageUV)
+	h.FullWh = capacityWh(h.EnergyFullUWH, h.ChargeFullUAH, h.WhVoltageUV)
+}
+
+func whVoltage(h *BatteryHealth, basis WhVoltageBasis) int64 {
+	lo, hi := h.VoltageMinDesignUV, h.VoltageMaxDesignUV
+	switch {
+	case basis == WhBasisNominal && lo > 0 && hi > lo:
+		return (lo + hi) / 2
+	case lo > 0:
+		return lo
+	case hi > 0:
+		return hi
+	default:
+		return h.VoltageNowUV
+	}
+}
+
+// capacityWh returns energyUWH in Wh when reported, else chargeUAH at
+// voltageUV.
+func capacityWh(energyUWH, chargeUAH, voltageUV int64) float64 {
+	if energyUWH > 0 {
+		return float64(energyUWH) / 1e6
+	}
+	return float64(chargeUAH) * float64(voltageUV) / 1e12
+}
+
+// reportsEnergy reports whether a battery exposes energy (µWh) rather than
+// charge (µAh) readings, which decides the unit of attributes like alarm.
+func reportsEnergy(props map[string]string) bool {
+	_, full := props["POWER_SUPPLY_ENERGY_FULL"]
+	_, now := props["POWER_SUPPLY_ENERGY_NOW"]
+	return full || now
+}
+
+// DefaultCapacityDropPct is the minimum full-charge capacity decrease (in percent)
+// between consecutive snapshots that counts as a real drop rather than
+// recalibration jitter.
+const DefaultCapacityDropPct = 3.0
+
+// DetectCapacityDrops scans time-ordered health snapshots and returns every
+// consecutive pair where ChargeFullUAH fell by at least minDropPct percent.
+// Snapshots without a full-charge reading are ignored.
+func DetectCapacityDrops(snapshots []BatteryHealthSnapshot, minDropPct float64) []CapacityDrop {
+	var drops []CapacityDrop
+	var prev *BatteryHealthSnapshot
+	for i := range snapshots {
+		cur := &snapshots[i]
+		if cur.ChargeFullUAH <= 0 {
+			continue
+		}
+		if prev != nil && cur.ChargeFullUAH < prev.ChargeFullUAH {
+			pct := float64(prev.ChargeFullUAH-cur.ChargeFullUAH) / float64(prev.ChargeFullUAH) * 100
+			if pct >= minDropPct {
+				drops = append(drops, CapacityDrop{
+					Timestamp:     cur.Timestamp,
+					PrevTimestamp: prev.Timestamp,
+					FromUAH:       prev.ChargeFullUAH,
+					ToUAH:         cur.ChargeFullUAH,
+					DropPct:       pct,
+				})
+			}
+		}
+		prev = cur
+	}
+	return drops
+}
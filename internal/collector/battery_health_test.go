@@ -0,0 +1,142 @@
+package collector
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectBatteryHealth_ParsesUevent(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_MANUFACTURER=ACME",
+		"POWER_SUPPLY_MODEL_NAME=5B10",
+		"POWER_SUPPLY_CYCLE_COUNT=42",
+		"POWER_SUPPLY_CHARGE_FULL_DESIGN=5000000",
+		"POWER_SUPPLY_CHARGE_FULL=4500000",
+		"",
+	}, "\n"))
+
+	h, err := CollectBatteryHealth("")
+	if err != nil {
+		t.Fatalf("CollectBatteryHealth() error = %v", err)
+	}
+	if h.Manufacturer != "ACME" || h.Model != "5B10" {
+		t.Fatalf("identity = %q/%q, want ACME/5B10", h.Manufacturer, h.Model)
+	}
+	if h.CycleCount != 42 || h.ChargeFullDesignUAH != 5000000 || h.ChargeFullUAH != 4500000 {
+		t.Fatalf("health = %#v, want cycles=42 design=5000000 full=4500000", h)
+	}
+}
+
+func TestBatteryHealth_SetWhBasis(t *testing.T) {
+	// A 3-cell pack: 9.0 V empty, 13.05 V full, 5000 mAh design, 4500 mAh full.
+	charge := []string{
+		"POWER_SUPPLY_CHARGE_FULL_DESIGN=5000000",
+		"POWER_SUPPLY_CHARGE_FULL=4500000",
+		"POWER_SUPPLY_VOLTAGE_NOW=11800000",
+	}
+	tests := []struct {
+		name        string
+		lines       []string
+		basis       WhVoltageBasis
+		wantVoltage int64
+		wantDesign  float64
+		wantFull    float64
+	}{
+		{"min design", append(charge, "POWER_SUPPLY_VOLTAGE_MIN_DESIGN=9000000", "POWER_SUPPLY_VOLTAGE_MAX_DESIGN=13050000"),
+			WhBasisMinDesign, 9000000, 45, 40.5},
+		{"nominal", append(charge, "POWER_SUPPLY_VOLTAGE_MIN_DESIGN=9000000", "POWER_SUPPLY_VOLTAGE_MAX_DESIGN=13050000"),
+			WhBasisNominal, 11025000, 55.125, 49.6125},
+		{"nominal without max design", append(charge, "POWER_SUPPLY_VOLTAGE_MIN_DESIGN=11400000"),
+			WhBasisNominal, 11400000, 57, 51.3},
+		{"min design without design voltages", charge,
+			WhBasisMinDesign, 11800000, 59, 53.1},
+		{"energy reported", []string{
+			"POWER_SUPPLY_ENERGY_FULL_DESIGN=57000000",
+			"POWER_SUPPLY_ENERGY_FULL=51000000",
+			"POWER_SUPPLY_VOLTAGE_MIN_DESIGN=9000000",
+		}, WhBasisMinDesign, 9000000, 57, 51},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setTestSysfsRoot(t)
+			writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join(append(tt.lines, ""), "\n"))
+
+			h, err := CollectBatteryHealth("")
+			if err != nil {
+				t.Fatalf("CollectBatteryHealth() error = %v", err)
+			}
+			h.SetWhBasis(tt.basis)
+			if h.WhBasis != tt.basis || h.WhVoltageUV != tt.wantVoltage {
+				t.Fatalf("basis = %q at %d µV, want %q at %d µV", h.WhBasis, h.WhVoltageUV, tt.basis, tt.wantVoltage)
+			}
+			if math.Abs(h.DesignWh-tt.wantDesign) > 1e-9 || math.Abs(h.FullWh-tt.wantFull) > 1e-9 {
+				t.Fatalf("capacity = %v/%v Wh, want %v/%v", h.DesignWh, h.FullWh, tt.wantDesign, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestCollectBatteryHealth_Alarm(t *testing.T) {
+	tests := []struct {
+		name    string
+		uevent  []string
+		alarm   string // "" means no alarm file
+		wantUAH int64
+		wantUWH int64
+	}{
+		{"absent", []string{"POWER_SUPPLY_CHARGE_FULL=4500000"}, "", 0, 0},
+		{"charge units", []string{"POWER_SUPPLY_CHARGE_FULL=4500000"}, "225000\n", 225000, 0},
+		{"energy units", []string{"POWER_SUPPLY_ENERGY_FULL=50000000", "POWER_SUPPLY_ENERGY_NOW=40000000"}, "2500000\n", 0, 2500000},
+		{"disabled", []string{"POWER_SUPPLY_ENERGY_FULL=50000000"}, "0\n", 0, 0},
+		{"garbage", []string{"POWER_SUPPLY_CHARGE_FULL=4500000"}, "n/a\n", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setTestSysfsRoot(t)
+			dir := filepath.Join(root, "class/power_supply/BAT0")
+			writeTestFile(t, filepath.Join(dir, "uevent"), strings.Join(append(tt.uevent, ""), "\n"))
+			if tt.alarm != "" {
+				writeTestFile(t, filepath.Join(dir, "alarm"), tt.alarm)
+			}
+
+			h, err := CollectBatteryHealth("")
+			if err != nil {
+				t.Fatalf("CollectBatteryHealth() error = %v", err)
+			}
+			if h.AlarmUAH != tt.wantUAH || h.AlarmUWH != tt.wantUWH {
+				t.Fatalf("alarm = %d µAh / %d µWh, want %d / %d", h.AlarmUAH, h.AlarmUWH, tt.wantUAH, tt.wantUWH)
+			}
+		})
+	}
+}
+
+func TestDetectCapacityDrops(t *testing.T) {
+	snapshots := []BatteryHealthSnapshot{
+		{Timestamp: 100, ChargeFullUAH: 5000000},
+		{Timestamp: 200, ChargeFullUAH: 4950000}, // -1%: jitter
+		{Timestamp: 300, ChargeFullUAH: 0},       // missing reading
+		{Timestamp: 400, ChargeFullUAH: 4700000}, // ~-5.05%: drop
+		{Timestamp: 500, ChargeFullUAH: 4800000}, // recalibrated up
+	}
+
+	drops := DetectCapacityDrops(snapshots, DefaultCapacityDropPct)
+	if len(drops) != 1 {
+		t.Fatalf("DetectCapacityDrops() len = %d, want 1: %#v", len(drops), drops)
+	}
+	d := drops[0]
+	if d.Timestamp != 400 || d.PrevTimestamp != 200 || d.FromUAH != 4950000 || d.ToUAH != 4700000 {
+		t.Fatalf("drop = %#v, want 4950000->4700000 between ts 200 and 400", d)
+	}
+	if d.DropPct < 5 || d.DropPct > 5.1 {
+		t.Fatalf("DropPct = %.3f, want ~5.05", d.DropPct)
+	}
+}
+
+func TestDetectCapacityDrops_Empty(t *testing.T) {
+	if drops := DetectCapacityDrops(nil, DefaultCapacityDropPct); len(drops) != 0 {
+		t.Fatalf("DetectCapacityDrops(nil) = %#v, want none", drops)
+	}
+}
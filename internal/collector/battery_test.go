@@ -1,10 +1,14 @@
 package collector
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func setTestSysfsRoot(t *testing.T) string {
@@ -32,7 +36,7 @@ func writeTestFile(t *testing.T, path, contents string) {
 }
 
 func newTestCollector() *BatteryCollector {
-	return NewBatteryCollector(30)
+	return NewBatteryCollector(30, false, "")
 }
 
 func TestCollect_ParsesUevent(t *testing.T) {
@@ -72,6 +76,9 @@ func TestCollect_ParsesUevent(t *testing.T) {
 	if sample.PowerUW != 3456000 {
 		t.Fatalf("PowerUW = %d, want 3456000", sample.PowerUW)
 	}
+	if sample.PowerSource != PowerSourceSysfsPowerNow {
+		t.Fatalf("PowerSource = %q, want %q", sample.PowerSource, PowerSourceSysfsPowerNow)
+	}
 	if sample.ChargeNowUAH != 5000000 {
 		t.Fatalf("ChargeNowUAH = %d, want 5000000", sample.ChargeNowUAH)
 	}
@@ -104,6 +111,9 @@ func TestCollect_SysfsPowerFallbackVoltageTimesCurrent(t *testing.T) {
 	if sample.PowerUW != 24000000 {
 		t.Fatalf("PowerUW = %d, want 24000000", sample.PowerUW)
 	}
+	if sample.PowerSource != PowerSourceSysfsVoltageCurrent {
+		t.Fatalf("PowerSource = %q, want %q", sample.PowerSource, PowerSourceSysfsVoltageCurrent)
+	}
 }
 
 func TestCollect_AveragingWindow(t *testing.T) {
@@ -118,14 +128,14 @@ func TestCollect_AveragingWindow(t *testing.T) {
 		"",
 	}, "\n"))
 
-	bc := NewBatteryCollector(60)
+	bc := NewBatteryCollector(60, false, "")
 
 	// Seed history directly to simulate multiple past readings.
-	bc.history = []historyEntry{
+	seedHistory(bc, "BAT0", []historyEntry{
 		{timestamp: 100, chargeUAH: 5010000, voltageUV: 12000000},
 		{timestamp: 110, chargeUAH: 5005000, voltageUV: 12000000},
 		{timestamp: 120, chargeUAH: 5000000, voltageUV: 12000000},
-	}
+	})
 
 	// Override Collect to use a controlled timestamp by injecting directly.
 	// Instead, let's test the averaging math directly by calling Collect
@@ -172,6 +182,210 @@ func TestCollect_AveragingWindow(t *testing.T) {
 		if second.PowerUW != expected {
 			t.Fatalf("PowerUW = %d, want %d", second.PowerUW, expected)
 		}
+		if second.PowerSource != PowerSourceChargeDelta {
+			t.Fatalf("PowerSource = %q, want %q", second.PowerSource, PowerSourceChargeDelta)
+		}
+	}
+}
+
+func TestCollect_PreferSysfsPower(t *testing.T) {
+	tests := []struct {
+		name        string
+		preferSysfs bool
+		powerNow    string
+		currentNow  string
+		wantSource  PowerSource
+	}{
+		{"charge delta preferred", false, "5000000", "1000000", PowerSourceChargeDelta},
+		{"sysfs preferred", true, "5000000", "1000000", PowerSourceSysfsPowerNow},
+		{"sysfs preferred voltage times current", true, "0", "1000000", PowerSourceSysfsVoltageCurrent},
+		{"sysfs preferred but unavailable", true, "0", "0", PowerSourceChargeDelta},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setTestSysfsRoot(t)
+			writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+				"POWER_SUPPLY_STATUS=Discharging",
+				"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+				"POWER_SUPPLY_CURRENT_NOW=" + tt.currentNow,
+				"POWER_SUPPLY_POWER_NOW=" + tt.powerNow,
+				"POWER_SUPPLY_CHARGE_NOW=4990000",
+				"POWER_SUPPLY_CAPACITY=74",
+				"",
+			}, "\n"))
+
+			bc := NewBatteryCollector(30, tt.preferSysfs, "")
+			// Seed a reading inside the window so a charge-delta average is
+			// available alongside the sysfs value.
+			seedHistory(bc, "BAT0", []historyEntry{
+				{timestamp: time.Now().Unix() - 20, chargeUAH: 5000000, voltageUV: 12000000},
+			})
+
+			s := sample(t, root, bc)
+			if s.PowerSource != tt.wantSource {
+				t.Fatalf("PowerSource = %q, want %q", s.PowerSource, tt.wantSource)
+			}
+			switch tt.wantSource {
+			case PowerSourceSysfsPowerNow, PowerSourceSysfsVoltageCurrent:
+				if s.PowerUW != s.SysfsPowerUW {
+					t.Fatalf("PowerUW = %d, want sysfs reading %d", s.PowerUW, s.SysfsPowerUW)
+				}
+			case PowerSourceChargeDelta:
+				if s.PowerUW <= 0 || s.PowerUW == s.SysfsPowerUW {
+					t.Fatalf("PowerUW = %d, want a charge-delta average distinct from sysfs %d", s.PowerUW, s.SysfsPowerUW)
+				}
+			}
+			if len(bc.pack("BAT0").history) != 2 {
+				t.Fatalf("history has %d entries, want 2: readings must be kept for the fallback", len(bc.pack("BAT0").history))
+			}
+		})
+	}
+}
+
+// seedHistory appends entries to the named pack's history as earlier
+// readings would, keeping the running voltage sum in step.
+func seedHistory(bc *BatteryCollector, name string, entries []historyEntry) {
+	w := bc.pack(name)
+	for _, e := range entries {
+		w.history = append(w.history, e)
+		w.voltageSum += e.voltageUV
+	}
+}
+
+func TestCollect_SmoothedWindow(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+		"POWER_SUPPLY_CHARGE_NOW=4990000",
+		"POWER_SUPPLY_CAPACITY=74",
+		"",
+	}, "\n"))
+
+	bc := NewBatteryCollector(30, false, "")
+	if s := sample(t, root, bc); s.PowerSmoothedUW != 0 {
+		t.Fatalf("PowerSmoothedUW = %d with the smoothed window off, want 0", s.PowerSmoothedUW)
+	}
+
+	bc = NewBatteryCollector(30, false, "")
+	bc.SetSmoothedWindow(120)
+	// The short window sees a slow drain over the last 20 s; the long one
+	// also sees a fast drain 100 s ago.
+	now := time.Now().Unix()
+	seedHistory(bc, "BAT0", []historyEntry{{timestamp: now - 20, chargeUAH: 5000000, voltageUV: 12000000}})
+	bc.pack("BAT0").smoothed.history = []historyEntry{{timestamp: now - 100, chargeUAH: 5100000, voltageUV: 12000000}}
+	bc.pack("BAT0").smoothed.voltageSum = 12000000
+
+	s := sample(t, root, bc)
+	wantShort := (int64(10000) * 12000 * 3600) / ((s.Timestamp - (now - 20)) * 1000)
+	wantLong := (int64(110000) * 12000 * 3600) / ((s.Timestamp - (now - 100)) * 1000)
+	if s.PowerUW != wantShort {
+		t.Fatalf("PowerUW = %d, want short-window %d", s.PowerUW, wantShort)
+	}
+	if s.PowerSmoothedUW != wantLong {
+		t.Fatalf("PowerSmoothedUW = %d, want long-window %d", s.PowerSmoothedUW, wantLong)
+	}
+
+	bc.SetSmoothedWindow(0)
+	if n := len(bc.pack("BAT0").smoothed.history); n != 0 {
+		t.Fatalf("smoothed history has %d entries after turning it off, want 0", n)
+	}
+}
+
+func TestCollect_ChargeAndEnergyReported(t *testing.T) {
+	// Over 20 s the charge falls 10000 µAh at 12 V (21.6 W), while the
+	// energy falls 150000 µWh (27 W, above energyLoadUW) or 50000 µWh (9 W).
+	tests := []struct {
+		name       string
+		quantity   DeltaQuantity
+		chargeUAH  string // "" when the battery does not report it
+		energyDrop int64  // µWh the energy fell over the window
+		wantSource PowerSource
+	}{
+		{"auto under load prefers energy", DeltaQuantityAuto, "4990000", 150000, PowerSourceEnergyDelta},
+		{"auto at light load keeps charge", DeltaQuantityAuto, "4990000", 50000, PowerSourceChargeDelta},
+		{"forced charge under load", DeltaQuantityCharge, "4990000", 150000, PowerSourceChargeDelta},
+		{"forced energy at light load", DeltaQuantityEnergy, "4990000", 50000, PowerSourceEnergyDelta},
+		{"energy only", DeltaQuantityCharge, "", 50000, PowerSourceEnergyDelta},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setTestSysfsRoot(t)
+			writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+				"POWER_SUPPLY_STATUS=Discharging",
+				"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+				"POWER_SUPPLY_CHARGE_NOW=" + tt.chargeUAH,
+				fmt.Sprintf("POWER_SUPPLY_ENERGY_NOW=%d", 60000000-tt.energyDrop),
+				"POWER_SUPPLY_CAPACITY=74",
+				"",
+			}, "\n"))
+
+			bc := NewBatteryCollector(30, false, "")
+			bc.SetDeltaQuantity(tt.quantity)
+			start := time.Now().Unix() - 20
+			seed := historyEntry{timestamp: start, energyUWH: 60000000, voltageUV: 12000000}
+			if tt.chargeUAH != "" {
+				seed.chargeUAH = 5000000
+			}
+			seedHistory(bc, "BAT0", []historyEntry{seed})
+
+			s := sample(t, root, bc)
+			elapsed := s.Timestamp - start
+			want := tt.energyDrop * 3600 / elapsed
+			if tt.wantSource == PowerSourceChargeDelta {
+				want = (int64(10000) * 12000 * 3600) / (elapsed * 1000)
+			}
+			if s.PowerSource != tt.wantSource || s.PowerUW != want {
+				t.Fatalf("power = %d from %q, want %d from %q", s.PowerUW, s.PowerSource, want, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestDeltaPower_IncrementalVoltageSum(t *testing.T) {
+	bc := NewBatteryCollector(3600, false, "")
+	w := bc.pack("BAT0")
+	naive := func() int64 {
+		var sum int64
+		for _, e := range w.history {
+			sum += e.voltageUV
+		}
+		return sum
+	}
+
+	ts := int64(1_000_000)
+	charge := int64(5_000_000)
+	for i := range 10_000 {
+		switch {
+		case i == 4000:
+			ts += 3 * 3600 // suspend: gap clears the history
+		case i == 6000:
+			ts -= 120 // wall clock stepped back
+		case i == 8000:
+			bc.SetWindow(60)
+		case i%7 == 0:
+			// same second: reading skipped
+		default:
+			ts++
+		}
+		charge -= int64(i % 3)
+		voltage := int64(11_000_000 + (i*7919)%1_000_000)
+		w.deltaPower(ts, charge, 0, voltage)
+		if got, want := w.voltageSum, naive(); got != want {
+			t.Fatalf("cycle %d: voltageSum = %d, naive sum = %d over %d entries", i, got, want, len(w.history))
+		}
+	}
+	if n := len(w.history); n > 62 {
+		t.Fatalf("history has %d entries after shrinking the window to 60 s", n)
+	}
+}
+
+func BenchmarkDeltaPower_HourWindow(b *testing.B) {
+	w := NewBatteryCollector(3600, false, "").pack("BAT0")
+	ts := int64(1_000_000)
+	for b.Loop() {
+		ts++
+		w.deltaPower(ts, 5_000_000-ts%1000, 0, 12_000_000)
 	}
 }
 
@@ -196,11 +410,11 @@ func TestCollect_GapClearsHistory(t *testing.T) {
 		"",
 	}, "\n"))
 
-	bc := NewBatteryCollector(30)
+	bc := NewBatteryCollector(30, false, "")
 	// Seed with ancient history entry — gap > 2×window.
-	bc.history = []historyEntry{
+	seedHistory(bc, "BAT0", []historyEntry{
 		{timestamp: 1, chargeUAH: 5100000, voltageUV: 12000000},
-	}
+	})
 
 	s, err := bc.Collect()
 	if err != nil {
@@ -208,11 +422,44 @@ func TestCollect_GapClearsHistory(t *testing.T) {
 	}
 
 	// Gap should clear history, so only 1 entry, falls back to sysfs.
-	if s.PowerUW != 7000000 {
-		t.Fatalf("PowerUW = %d, want 7000000 (sysfs fallback after gap clear)", s.PowerUW)
+	if s.PowerUW != 7000000 || s.PowerSource != PowerSourceSysfsPowerNow {
+		t.Fatalf("PowerUW = %d (source %q), want 7000000 sysfs fallback after gap clear", s.PowerUW, s.PowerSource)
 	}
-	if len(bc.history) != 1 {
-		t.Fatalf("history len = %d, want 1 (gap cleared old, added current)", len(bc.history))
+	if len(bc.pack("BAT0").history) != 1 {
+		t.Fatalf("history len = %d, want 1 (gap cleared old, added current)", len(bc.pack("BAT0").history))
+	}
+}
+
+func TestCollect_BackwardClockStepClearsHistory(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+		"POWER_SUPPLY_CURRENT_NOW=1000000",
+		"POWER_SUPPLY_POWER_NOW=7000000",
+		"POWER_SUPPLY_CHARGE_NOW=5000000",
+		"POWER_SUPPLY_CAPACITY=75",
+		"",
+	}, "\n"))
+
+	bc := NewBatteryCollector(30, false, "")
+	// History recorded before the clock stepped back by ten minutes.
+	future := time.Now().Unix() + 600
+	seedHistory(bc, "BAT0", []historyEntry{
+		{timestamp: future - 10, chargeUAH: 5200000, voltageUV: 12000000},
+		{timestamp: future, chargeUAH: 5100000, voltageUV: 12000000},
+	})
+
+	s, err := bc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	if s.PowerUW != 7000000 || s.PowerSource != PowerSourceSysfsPowerNow {
+		t.Fatalf("PowerUW = %d (source %q), want 7000000 sysfs fallback after clock step", s.PowerUW, s.PowerSource)
+	}
+	if len(bc.pack("BAT0").history) != 1 || bc.pack("BAT0").history[0].timestamp != s.Timestamp {
+		t.Fatalf("history = %#v, want only the current reading", bc.pack("BAT0").history)
 	}
 }
 
@@ -238,6 +485,29 @@ func TestCollect_CorrectsStatusToFullWhenACOnline(t *testing.T) {
 	}
 }
 
+func TestCollect_CorrectsStatusToFullFromCapacityLevel(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_POWER_NOW=1100000",
+		"POWER_SUPPLY_CAPACITY=99",
+		"POWER_SUPPLY_CAPACITY_LEVEL=Full",
+		"",
+	}, "\n"))
+	writeTestFile(t, filepath.Join(root, "class/power_supply/AC0/online"), "1\n")
+
+	s, err := newTestCollector().Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if s.CapacityLevel != "Full" {
+		t.Fatalf("CapacityLevel = %q, want Full", s.CapacityLevel)
+	}
+	if s.Status != "Full" {
+		t.Fatalf("Status = %q, want Full (capacity_level Full at 99%%)", s.Status)
+	}
+}
+
 func TestCollect_LeavesStatusWhenACOffline(t *testing.T) {
 	root := setTestSysfsRoot(t)
 	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
@@ -273,6 +543,24 @@ func TestCollect_NoBatteryFound(t *testing.T) {
 	}
 }
 
+func TestCollect_NoNumericData(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	// A dock battery that reports only its status.
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_NAME=BAT0",
+		"POWER_SUPPLY_STATUS=Unknown",
+		"POWER_SUPPLY_PRESENT=1",
+		"POWER_SUPPLY_CAPACITY=0",
+		"",
+	}, "\n"))
+
+	bc := newTestCollector()
+	sample, err := bc.Collect()
+	if !errors.Is(err, ErrNoBatteryData) {
+		t.Fatalf("Collect() = %+v, %v; want ErrNoBatteryData", sample, err)
+	}
+}
+
 func TestCollect_UeventReadError(t *testing.T) {
 	root := setTestSysfsRoot(t)
 	if err := os.MkdirAll(filepath.Join(root, "class/power_supply/BAT0"), 0o755); err != nil {
@@ -288,3 +576,299 @@ func TestCollect_UeventReadError(t *testing.T) {
 		t.Fatalf("Collect() error = %q, want contains %q", err.Error(), "read uevent")
 	}
 }
+
+func TestCollect_RetriesTransientUeventReadError(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_POWER_NOW=1100000",
+		"POWER_SUPPLY_CAPACITY=50",
+		"",
+	}, "\n"))
+
+	calls := 0
+	oldReadFile := readFile
+	readFile = func(path string) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			return nil, syscall.EIO
+		}
+		return oldReadFile(path)
+	}
+	t.Cleanup(func() { readFile = oldReadFile })
+
+	s, err := newTestCollector().Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v, want success after retry", err)
+	}
+	if calls != 2 || s.CapacityPct != 50 {
+		t.Fatalf("calls = %d, capacity = %d, want 2 reads and capacity 50", calls, s.CapacityPct)
+	}
+}
+
+func TestCollect_PersistentUeventReadError(t *testing.T) {
+	setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(sysfsRoot, "class/power_supply/BAT0/uevent"), "")
+
+	calls := 0
+	oldReadFile := readFile
+	readFile = func(string) ([]byte, error) {
+		calls++
+		return nil, syscall.EIO
+	}
+	t.Cleanup(func() { readFile = oldReadFile })
+
+	_, err := newTestCollector().Collect()
+	if err == nil || !strings.Contains(err.Error(), "read uevent") {
+		t.Fatalf("Collect() error = %v, want read uevent error", err)
+	}
+	if calls != ueventReadAttempts {
+		t.Fatalf("calls = %d, want %d", calls, ueventReadAttempts)
+	}
+}
+
+func TestCollect_CorrectsStatusWithUSBPDSource(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_VOLTAGE_NOW=11000000",
+		"POWER_SUPPLY_CAPACITY=100",
+		"",
+	}, "\n"))
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/type"), "Battery\n")
+	// Offline port first, then the active USB-PD source.
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ucsi-source-psy-USBC000:001/type"), "USB\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ucsi-source-psy-USBC000:001/online"), "0\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ucsi-source-psy-USBC000:002/type"), "USB_PD\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ucsi-source-psy-USBC000:002/online"), "1\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ucsi-source-psy-USBC000:002/voltage_max"), "20000000\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ucsi-source-psy-USBC000:002/current_max"), "3250000\n")
+
+	bc := newTestCollector()
+	s, err := bc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if s.Status != "Full" {
+		t.Fatalf("Status = %q, want Full", s.Status)
+	}
+	if s.ACSource != "ucsi-source-psy-USBC000:002" {
+		t.Fatalf("ACSource = %q, want ucsi-source-psy-USBC000:002", s.ACSource)
+	}
+	if s.ChargerPowerUW != 65000000 {
+		t.Fatalf("ChargerPowerUW = %d, want 65000000", s.ChargerPowerUW)
+	}
+}
+
+func TestReadChargerPowerUW(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  int64
+	}{
+		{
+			name:  "input power limit",
+			files: map[string]string{"input_power_limit": "45000000\n", "current_max": "3000000\n", "voltage_max": "20000000\n"},
+			want:  45000000,
+		},
+		{
+			name:  "usb-pd negotiated",
+			files: map[string]string{"current_max": "3250000\n", "voltage_max": "20000000\n", "voltage_now": "5000000\n"},
+			want:  65000000,
+		},
+		{
+			name:  "voltage now fallback",
+			files: map[string]string{"current_max": "3000000\n", "voltage_now": "15000000\n"},
+			want:  45000000,
+		},
+		{
+			name:  "barrel charger without ratings",
+			files: map[string]string{"online": "1\n"},
+			want:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, contents := range tt.files {
+				writeTestFile(t, filepath.Join(dir, name), contents)
+			}
+			if got := readChargerPowerUW(dir); got != tt.want {
+				t.Fatalf("readChargerPowerUW() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollect_BatteryRemovalAndReinsertion(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	dir := filepath.Join(root, "class/power_supply/BAT1")
+	insert := func(chargeUAH int) {
+		t.Helper()
+		writeTestFile(t, filepath.Join(dir, "uevent"), strings.Join([]string{
+			"POWER_SUPPLY_STATUS=Discharging",
+			"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+			"POWER_SUPPLY_POWER_NOW=7000000",
+			fmt.Sprintf("POWER_SUPPLY_CHARGE_NOW=%d", chargeUAH),
+			"POWER_SUPPLY_CAPACITY=75",
+			"",
+		}, "\n"))
+	}
+
+	insert(5000000)
+	bc := newTestCollector()
+	sample(t, root, bc)
+	if ev := bc.PresenceChange(); ev != nil {
+		t.Fatalf("first Collect PresenceChange() = %+v, want nil", ev)
+	}
+	seedHistory(bc, "BAT1", []historyEntry{{timestamp: time.Now().Unix() - 10, chargeUAH: 5100000, voltageUV: 12000000}})
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.Collect(); !errors.Is(err, ErrNoBattery) {
+		t.Fatalf("Collect() after removal error = %v, want ErrNoBattery", err)
+	}
+	if ev := bc.PresenceChange(); ev == nil || ev.Present || ev.Battery != "BAT1" {
+		t.Fatalf("removal PresenceChange() = %+v, want BAT1 absent", ev)
+	}
+	if _, err := bc.Collect(); !errors.Is(err, ErrNoBattery) {
+		t.Fatalf("second Collect() after removal error = %v, want ErrNoBattery", err)
+	}
+	if ev := bc.PresenceChange(); ev != nil {
+		t.Fatalf("PresenceChange() while still removed = %+v, want nil", ev)
+	}
+
+	// Reinsertion with a different charge: the pre-removal history is gone,
+	// so power falls back to sysfs instead of a bogus charge delta.
+	insert(3000000)
+	s := sample(t, root, bc)
+	if ev := bc.PresenceChange(); ev == nil || !ev.Present || ev.Battery != "BAT1" {
+		t.Fatalf("reinsertion PresenceChange() = %+v, want BAT1 present", ev)
+	}
+	if s.PowerSource != PowerSourceSysfsPowerNow || len(bc.pack("BAT1").history) != 1 {
+		t.Fatalf("after reinsertion source = %q, history len = %d; want sysfs fallback and fresh history", s.PowerSource, len(bc.pack("BAT1").history))
+	}
+}
+
+func TestCollect_CombinesBatteries(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+		"POWER_SUPPLY_CURRENT_NOW=1000000",
+		"POWER_SUPPLY_POWER_NOW=12000000",
+		"POWER_SUPPLY_CHARGE_NOW=3000000",
+		"POWER_SUPPLY_CHARGE_FULL_DESIGN=6000000",
+		"POWER_SUPPLY_CAPACITY=50",
+		"POWER_SUPPLY_CAPACITY_LEVEL=Normal",
+		"",
+	}, "\n"))
+	bat1 := filepath.Join(root, "class/power_supply/BAT1")
+	writeTestFile(t, filepath.Join(bat1, "uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Not charging",
+		"POWER_SUPPLY_VOLTAGE_NOW=12600000",
+		"POWER_SUPPLY_CURRENT_NOW=0",
+		"POWER_SUPPLY_POWER_NOW=0",
+		"POWER_SUPPLY_CHARGE_NOW=2000000",
+		"POWER_SUPPLY_CHARGE_FULL_DESIGN=2000000",
+		"POWER_SUPPLY_CAPACITY=100",
+		"POWER_SUPPLY_CAPACITY_LEVEL=Full",
+		"",
+	}, "\n"))
+
+	bc := newTestCollector()
+	s := sample(t, root, bc)
+	// Voltage and capacity are weighted 3:1 by design charge.
+	if s.BatteryCount != 2 || s.Status != "Discharging" || s.CurrentUA != 1000000 || s.ChargeNowUAH != 5000000 {
+		t.Fatalf("sample = %+v, want 2 discharging batteries drawing 1 A with 5 Ah left", s)
+	}
+	if s.VoltageUV != 12150000 || s.CapacityPct != 63 || s.CapacityLevel != "Normal" {
+		t.Fatalf("voltage = %d, capacity = %d%% (%s); want 12150000, 63%% (Normal)", s.VoltageUV, s.CapacityPct, s.CapacityLevel)
+	}
+	if s.PowerUW != 12000000 || s.SysfsPowerUW != 12000000 || s.PowerSource != PowerSourceSysfsPowerNow {
+		t.Fatalf("power = %d (sysfs %d) from %q, want 12000000 from sysfs", s.PowerUW, s.SysfsPowerUW, s.PowerSource)
+	}
+
+	// Unplugging one pack drops only its window and is no presence change.
+	seedHistory(bc, "BAT0", []historyEntry{{timestamp: time.Now().Unix() - 10, chargeUAH: 3010000, voltageUV: 12000000}})
+	if err := os.RemoveAll(bat1); err != nil {
+		t.Fatal(err)
+	}
+	s = sample(t, root, bc)
+	if s.BatteryCount != 1 || s.ChargeNowUAH != 3000000 || s.CapacityPct != 50 {
+		t.Fatalf("after unplugging BAT1 sample = %+v, want BAT0 alone", s)
+	}
+	if _, ok := bc.packs["BAT1"]; ok || len(bc.pack("BAT0").history) < 2 {
+		t.Fatalf("packs = %v, want BAT1 dropped and BAT0's history kept", bc.packs)
+	}
+	if ev := bc.PresenceChange(); ev != nil {
+		t.Fatalf("PresenceChange() = %+v with one battery left, want nil", ev)
+	}
+}
+
+func TestCombineStatus(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{[]string{"Discharging"}, "Discharging"},
+		{[]string{"Not charging"}, "Not charging"},
+		{[]string{"Discharging", "Charging"}, "Charging"},
+		{[]string{"Full", "Discharging"}, "Discharging"},
+		{[]string{"Not charging", "Not charging"}, "Full"},
+		{[]string{"Unknown", "Unknown"}, "Full"},
+		{[]string{"Full", "Not charging"}, "Full"},
+	}
+	for _, tt := range tests {
+		packs := make([]packReading, len(tt.statuses))
+		for i, st := range tt.statuses {
+			packs[i].status = st
+		}
+		if got := combineStatus(packs); got != tt.want {
+			t.Errorf("combineStatus(%q) = %q, want %q", tt.statuses, got, tt.want)
+		}
+	}
+}
+
+func TestRoundPower(t *testing.T) {
+	tests := []struct {
+		uw, step, want int64
+	}{
+		{7_234_567, 0, 7_234_567},
+		{7_234_567, 10_000, 7_230_000},
+		{7_235_000, 10_000, 7_240_000},
+		{4_999, 10_000, 0},
+		{-7_235_000, 10_000, -7_240_000},
+		{0, 10_000, 0},
+	}
+	for _, tt := range tests {
+		if got := roundPower(tt.uw, tt.step); got != tt.want {
+			t.Errorf("roundPower(%d, %d) = %d, want %d", tt.uw, tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestCollect_PowerRounding(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+		"POWER_SUPPLY_POWER_NOW=7234567",
+		"POWER_SUPPLY_CHARGE_NOW=5000000",
+		"POWER_SUPPLY_CAPACITY=75",
+		"",
+	}, "\n"))
+
+	bc := newTestCollector()
+	bc.SetPowerRounding(10_000)
+	s := sample(t, root, bc)
+	if s.PowerUW != 7_230_000 || s.SysfsPowerUW != 7_230_000 {
+		t.Fatalf("PowerUW = %d, SysfsPowerUW = %d; want both rounded to 7230000", s.PowerUW, s.SysfsPowerUW)
+	}
+
+	bc.SetPowerRounding(0)
+	if s := sample(t, root, bc); s.SysfsPowerUW != 7_234_567 {
+		t.Fatalf("SysfsPowerUW with rounding off = %d, want 7234567", s.SysfsPowerUW)
+	}
+}
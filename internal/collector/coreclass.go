@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"math"
+	"sort"
+)
+
+// CoreFreqs looks up the frequency each core ran at from stored frequency
+// samples.
+type CoreFreqs map[int][]CPUFreqSample
+
+// NewCoreFreqs groups samples, which must be in ascending time order, by CPU.
+func NewCoreFreqs(samples []CPUFreqSample) CoreFreqs {
+	cf := make(CoreFreqs)
+	for _, s := range samples {
+		cf[s.CPUID] = append(cf[s.CPUID], s)
+	}
+	return cf
+}
+
+// At returns the frequency of cpu in its latest sample at or before ts, or 0
+// when there is none.
+func (cf CoreFreqs) At(cpu int, ts int64) int64 {
+	samples := cf[cpu]
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp > ts })
+	if i == 0 {
+		return 0
+	}
+	return samples[i-1].FreqKHz
+}
+
+// SplitCoreClassEnergy sums the ticks in procs by the class of the CPU each
+// process last ran on, looked up in cores (CPU ID → is a P-core). It also
+// estimates each class's energy: every process cycle is charged the battery
+// power above baselineUW over the time since the previous cycle, split
+// between the classes by their share of the cycle's classified ticks.
+//
+// When a busy sample period covers the cycle, the energy is split by busy
+// time instead, which counts every process rather than the stored top N:
+// each class is weighted by the sum over its cores of the busy fraction
+// raised to busyExponent. An exponent above 1 favours heavily loaded cores,
+// which run at higher clocks and voltages.
+//
+// coreWeight, when not nil, scales the weight of each process's ticks and
+// each core's busy time by the power the core draws per unit of work at ts,
+// e.g. from the frequency it ran at. The tick totals are not scaled.
+//
+// procs, battery and busy must be in ascending time order. Only cycles whose
+// latest battery sample is discharging count towards energy, since battery
+// power on AC does not measure consumption, and a gap of more than maxGapSecs
+// since the previous cycle (sleep, paused collection) contributes none.
+func SplitCoreClassEnergy(procs []ProcessSample, cores map[int]bool, battery []BatterySample, busy []CPUBusySample, busyExponent float64, coreWeight func(cpu int, ts int64) float64, baselineUW, maxGapSecs int64) CoreClassEnergy {
+	weight := func(cpu int, ts int64) float64 {
+		if coreWeight == nil {
+			return 1
+		}
+		return coreWeight(cpu, ts)
+	}
+	var out CoreClassEnergy
+	var prevTS int64
+	bi, ui := 0, 0
+	for i := 0; i < len(procs); {
+		ts := procs[i].Timestamp
+		var pTicks, eTicks int64
+		var pWeight, eWeight float64
+		for ; i < len(procs) && procs[i].Timestamp == ts; i++ {
+			isP, known := cores[procs[i].LastCPU]
+			switch {
+			case !known:
+				out.UnknownTicks += procs[i].CPUTicksDelta
+			case isP:
+				pTicks += procs[i].CPUTicksDelta
+				pWeight += float64(procs[i].CPUTicksDelta) * weight(procs[i].LastCPU, ts)
+			default:
+				eTicks += procs[i].CPUTicksDelta
+				eWeight += float64(procs[i].CPUTicksDelta) * weight(procs[i].LastCPU, ts)
+			}
+		}
+		out.PCoreTicks += pTicks
+		out.ECoreTicks += eTicks
+
+		for bi < len(battery) && battery[bi].Timestamp <= ts {
+			bi++
+		}
+		// The busy period covering ts is the first one ending at or after it.
+		for ui < len(busy) && busy[ui].Timestamp < ts {
+			ui++
+		}
+		byBusy := false
+		if ui < len(busy) && busy[ui].Timestamp-busy[ui].PeriodSecs < ts {
+			var pBusy, eBusy float64
+			for _, s := range busy[ui:] {
+				if s.Timestamp != busy[ui].Timestamp {
+					break
+				}
+				w := math.Pow(s.BusyFraction, busyExponent) * weight(s.CPUID, ts)
+				if s.IsPCore {
+					pBusy += w
+				} else {
+					eBusy += w
+				}
+			}
+			if pBusy+eBusy > 0 {
+				pWeight, eWeight, byBusy = pBusy, eBusy, true
+			}
+		}
+
+		dt := ts - prevTS
+		if prevTS > 0 && dt <= maxGapSecs && bi > 0 && pWeight+eWeight > 0 {
+			bat := battery[bi-1]
+			if bat.Status == "Discharging" && ts-bat.Timestamp <= maxGapSecs {
+				uwh := max(bat.PowerUW-baselineUW, 0) * dt / 3600
+				pUWH := int64(float64(uwh) * pWeight / (pWeight + eWeight))
+				out.PCoreEnergyUWH += pUWH
+				out.ECoreEnergyUWH += uwh - pUWH
+				if byBusy {
+					out.BusyWeightedUWH += uwh
+				}
+			}
+		}
+		prevTS = ts
+	}
+	return out
+}
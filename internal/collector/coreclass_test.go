@@ -0,0 +1,156 @@
+package collector
+
+import "testing"
+
+func TestSplitCoreClassEnergy(t *testing.T) {
+	// CPUs 0-1 are P-cores, 2 an E-core; CPU 7 has no recorded class.
+	cores := map[int]bool{0: true, 1: true, 2: false}
+	procs := []ProcessSample{
+		{Timestamp: 100, LastCPU: 0, CPUTicksDelta: 50},
+		{Timestamp: 105, LastCPU: 0, CPUTicksDelta: 30},
+		{Timestamp: 105, LastCPU: 2, CPUTicksDelta: 10},
+		{Timestamp: 105, LastCPU: 7, CPUTicksDelta: 5},
+		{Timestamp: 110, LastCPU: 1, CPUTicksDelta: 20},
+		{Timestamp: 110, LastCPU: 2, CPUTicksDelta: 20},
+		// After a sleep: ticks count, energy does not.
+		{Timestamp: 5000, LastCPU: 2, CPUTicksDelta: 40},
+		// On AC: ticks count, energy does not.
+		{Timestamp: 5005, LastCPU: 0, CPUTicksDelta: 40},
+	}
+	battery := []BatterySample{
+		{Timestamp: 100, PowerUW: 10_000_000, Status: "Discharging"},
+		{Timestamp: 105, PowerUW: 10_000_000, Status: "Discharging"},
+		{Timestamp: 110, PowerUW: 13_600_000, Status: "Discharging"},
+		{Timestamp: 5000, PowerUW: 8_000_000, Status: "Discharging"},
+		{Timestamp: 5005, PowerUW: 20_000_000, Status: "Charging"},
+	}
+
+	got := SplitCoreClassEnergy(procs, cores, battery, nil, 1, nil, 2_800_000, 15)
+	// Cycle 105: (10 W - 2.8 W) × 5 s = 10000 µWh, split 30:10.
+	// Cycle 110: (13.6 W - 2.8 W) × 5 s = 15000 µWh, split 20:20.
+	want := CoreClassEnergy{
+		PCoreTicks:     50 + 30 + 20 + 40,
+		ECoreTicks:     10 + 20 + 40,
+		UnknownTicks:   5,
+		PCoreEnergyUWH: 7500 + 7500,
+		ECoreEnergyUWH: 2500 + 7500,
+	}
+	if got != want {
+		t.Fatalf("SplitCoreClassEnergy() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitCoreClassEnergy_BaselineAboveDraw(t *testing.T) {
+	cores := map[int]bool{0: true}
+	procs := []ProcessSample{
+		{Timestamp: 100, LastCPU: 0, CPUTicksDelta: 1},
+		{Timestamp: 105, LastCPU: 0, CPUTicksDelta: 1},
+	}
+	battery := []BatterySample{{Timestamp: 105, PowerUW: 2_000_000, Status: "Discharging"}}
+
+	got := SplitCoreClassEnergy(procs, cores, battery, nil, 1, nil, 3_000_000, 15)
+	if got.PCoreEnergyUWH != 0 || got.ECoreEnergyUWH != 0 {
+		t.Fatalf("energy = %d, %d µWh with the baseline above the draw, want 0", got.PCoreEnergyUWH, got.ECoreEnergyUWH)
+	}
+}
+
+func TestSplitCoreClassEnergy_BusyWeighted(t *testing.T) {
+	cores := map[int]bool{0: true, 1: false}
+	procs := []ProcessSample{
+		{Timestamp: 100, LastCPU: 0, CPUTicksDelta: 10},
+		{Timestamp: 105, LastCPU: 0, CPUTicksDelta: 10},
+		{Timestamp: 110, LastCPU: 0, CPUTicksDelta: 10},
+		{Timestamp: 115, LastCPU: 0, CPUTicksDelta: 10},
+	}
+	battery := []BatterySample{
+		{Timestamp: 100, PowerUW: 3_600_000, Status: "Discharging"},
+		{Timestamp: 105, PowerUW: 3_600_000, Status: "Discharging"},
+		{Timestamp: 110, PowerUW: 3_600_000, Status: "Discharging"},
+		{Timestamp: 115, PowerUW: 3_600_000, Status: "Discharging"},
+	}
+	// One busy period covers cycles 105 and 110; cycle 115 has none and
+	// falls back to ticks.
+	busy := []CPUBusySample{
+		{Timestamp: 110, CPUID: 0, IsPCore: true, BusyFraction: 0.8, PeriodSecs: 10},
+		{Timestamp: 110, CPUID: 1, IsPCore: false, BusyFraction: 0.4, PeriodSecs: 10},
+	}
+
+	tests := []struct {
+		name     string
+		exponent float64
+		wantP    int64
+	}{
+		// Each cycle is 3.6 W × 5 s = 5000 µWh. Busy 0.8:0.4 gives P-cores
+		// 2/3 linearly and 0.64:0.16 = 4/5 squared.
+		{name: "linear", exponent: 1, wantP: 3333 + 3333 + 5000},
+		{name: "squared", exponent: 2, wantP: 4000 + 4000 + 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SplitCoreClassEnergy(procs, cores, battery, busy, tt.exponent, nil, 0, 15)
+			if got.PCoreEnergyUWH != tt.wantP || got.ECoreEnergyUWH != 15000-tt.wantP {
+				t.Errorf("energy = %d P, %d E µWh, want %d P, %d E", got.PCoreEnergyUWH, got.ECoreEnergyUWH, tt.wantP, 15000-tt.wantP)
+			}
+			if got.BusyWeightedUWH != 10000 {
+				t.Errorf("BusyWeightedUWH = %d, want 10000", got.BusyWeightedUWH)
+			}
+		})
+	}
+}
+
+func TestSplitCoreClassEnergy_CoreWeight(t *testing.T) {
+	cores := map[int]bool{0: true, 1: false}
+	procs := []ProcessSample{
+		{Timestamp: 100, LastCPU: 0, CPUTicksDelta: 10},
+		{Timestamp: 100, LastCPU: 1, CPUTicksDelta: 10},
+		{Timestamp: 105, LastCPU: 0, CPUTicksDelta: 10},
+		{Timestamp: 105, LastCPU: 1, CPUTicksDelta: 10},
+	}
+	battery := []BatterySample{
+		{Timestamp: 100, PowerUW: 3_600_000, Status: "Discharging"},
+		{Timestamp: 105, PowerUW: 3_600_000, Status: "Discharging"},
+	}
+	freqs := NewCoreFreqs([]CPUFreqSample{
+		{Timestamp: 90, CPUID: 0, FreqKHz: 4_000_000, IsPCore: true},
+		{Timestamp: 90, CPUID: 1, FreqKHz: 2_000_000},
+	})
+	// Equal ticks, but the P-core ran at twice the clock: squared, it draws
+	// 4/5 of the cycle's 5000 µWh.
+	coreWeight := func(cpu int, ts int64) float64 {
+		f := float64(freqs.At(cpu, ts)) / 4_000_000
+		return f * f
+	}
+
+	got := SplitCoreClassEnergy(procs, cores, battery, nil, 1, coreWeight, 0, 15)
+	if got.PCoreEnergyUWH != 4000 || got.ECoreEnergyUWH != 1000 {
+		t.Errorf("energy = %d P, %d E µWh, want 4000 P, 1000 E", got.PCoreEnergyUWH, got.ECoreEnergyUWH)
+	}
+	if got.PCoreTicks != 20 || got.ECoreTicks != 20 {
+		t.Errorf("ticks = %d P, %d E, want the unscaled 20, 20", got.PCoreTicks, got.ECoreTicks)
+	}
+}
+
+func TestCoreFreqsAt(t *testing.T) {
+	cf := NewCoreFreqs([]CPUFreqSample{
+		{Timestamp: 100, CPUID: 0, FreqKHz: 1_000_000},
+		{Timestamp: 100, CPUID: 1, FreqKHz: 3_000_000},
+		{Timestamp: 110, CPUID: 0, FreqKHz: 2_000_000},
+	})
+	tests := []struct {
+		cpu  int
+		ts   int64
+		want int64
+	}{
+		{0, 99, 0},
+		{0, 100, 1_000_000},
+		{0, 109, 1_000_000},
+		{0, 110, 2_000_000},
+		{1, 200, 3_000_000},
+		{2, 200, 0},
+	}
+	for _, tt := range tests {
+		if got := cf.At(tt.cpu, tt.ts); got != tt.want {
+			t.Errorf("At(%d, %d) = %d, want %d", tt.cpu, tt.ts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CPUBusyCollector turns the per-CPU jiffy counters in /proc/stat into busy
+// fractions: the share of the time since the previous reading each core
+// spent outside idle and iowait. It covers every process, unlike the top-N
+// process samples, which makes it a cheap proxy for CPU power.
+type CPUBusyCollector struct {
+	cpuTopology map[int]bool       // cpu_id -> is_p_core (computed once at init)
+	prev        map[int]cpuJiffies // counters at the previous reading
+	prevTime    int64
+}
+
+// cpuJiffies are one CPU's cumulative /proc/stat counters.
+type cpuJiffies struct {
+	total int64 // all fields except guest time, which user time includes
+	idle  int64 // idle + iowait
+}
+
+// NewCPUBusyCollector creates a CPUBusyCollector, detecting CPU topology once.
+func NewCPUBusyCollector() *CPUBusyCollector {
+	return &CPUBusyCollector{cpuTopology: detectCPUTopology()}
+}
+
+// Reset forgets the previous counters, so the next Collect only records a
+// baseline.
+func (c *CPUBusyCollector) Reset() {
+	c.prev = nil
+}
+
+// Collect reads /proc/stat at now and returns each core's busy fraction since
+// the previous call. The first call only records a baseline and returns no
+// samples.
+func (c *CPUBusyCollector) Collect(now int64) ([]CPUBusySample, error) {
+	cur, err := readCPUJiffies()
+	if err != nil {
+		return nil, err
+	}
+	prev, prevTime := c.prev, c.prevTime
+	c.prev, c.prevTime = cur, now
+	if prev == nil || now <= prevTime {
+		return nil, nil
+	}
+
+	var samples []CPUBusySample
+	for id, j := range cur {
+		p, ok := prev[id]
+		if !ok || j.total <= p.total {
+			continue
+		}
+		// A hotplugged core restarts its counters; clamp rather than
+		// report a negative idle delta.
+		total := j.total - p.total
+		busy := float64(total-max(j.idle-p.idle, 0)) / float64(total)
+		samples = append(samples, CPUBusySample{
+			Timestamp:    now,
+			CPUID:        id,
+			IsPCore:      c.cpuTopology[id],
+			BusyFraction: min(max(busy, 0), 1),
+			PeriodSecs:   now - prevTime,
+		})
+	}
+	sort.Slice(samples, func(a, b int) bool { return samples[a].CPUID < samples[b].CPUID })
+	return samples, nil
+}
+
+// readCPUJiffies parses the per-CPU "cpuN" lines of /proc/stat.
+func readCPUJiffies() (map[int]cpuJiffies, error) {
+	path := filepath.Join(procRoot, "stat")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	out := make(map[int]cpuJiffies)
+	for line := range strings.Lines(string(data)) {
+		fields := strings.Fields(line)
+		// cpuN user nice system idle iowait irq softirq steal [guest guest_nice]
+		if len(fields) < 9 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		id, err := strconv.Atoi(fields[0][3:])
+		if err != nil {
+			continue // the aggregate "cpu" line
+		}
+		var j cpuJiffies
+		for i, f := range fields[1:9] {
+			n, err := strconv.ParseInt(f, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parse %s line %q: %w", path, fields[0], err)
+			}
+			j.total += n
+			if i == 3 || i == 4 {
+				j.idle += n
+			}
+		}
+		out[id] = j
+	}
+	return out, nil
+}
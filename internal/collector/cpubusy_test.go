@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCPUBusyCollector_Collect(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	writeCPUFixture(t, []int64{4000000, 2500000}, []int64{0, 0})
+	stat := filepath.Join(procRoot, "stat")
+
+	c := NewCPUBusyCollector()
+	writeTestFile(t, stat, "cpu  300 0 100 1600 0 0 0 0 0 0\n"+
+		"cpu0 100 0 50 800 0 0 0 0 0 0\n"+
+		"cpu1 200 0 50 800 0 0 0 0 0 0\n")
+	if got, err := c.Collect(100); err != nil || got != nil {
+		t.Fatalf("first Collect() = %v, %v, want a baseline with no samples", got, err)
+	}
+
+	// cpu0: 75 busy of 100 jiffies; cpu1: 10 busy, 80 idle, 10 iowait.
+	writeTestFile(t, stat, "cpu  385 0 100 1690 10 0 0 0 0 0\n"+
+		"cpu0 150 0 75 825 0 0 0 0 0 0\n"+
+		"cpu1 210 0 50 880 10 0 0 0 0 0\n")
+	got, err := c.Collect(130)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	want := []CPUBusySample{
+		{Timestamp: 130, CPUID: 0, IsPCore: true, BusyFraction: 0.75, PeriodSecs: 30},
+		{Timestamp: 130, CPUID: 1, IsPCore: false, BusyFraction: 0.1, PeriodSecs: 30},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Collect() = %+v, want %+v", got, want)
+	}
+
+	c.Reset()
+	if got, err := c.Collect(160); err != nil || got != nil {
+		t.Fatalf("Collect() after Reset = %v, %v, want a baseline with no samples", got, err)
+	}
+}
@@ -0,0 +1,44 @@
+package collector
+
+// EstimateChargeCycles turns the drain over [from, to] into charge cycles:
+// the discharged charge over the design charge of the latest health snapshot
+// by to, or the discharged capacity percent over 100 when either is
+// unknown. The firmware counter is read from the same snapshots, which are
+// in time order.
+func EstimateChargeCycles(d Discharge, snapshots []BatteryHealthSnapshot, from, to int64) ChargeCycles {
+	c := ChargeCycles{From: from, To: to, DischargedUAH: d.ChargeUAH, DischargedPct: d.CapacityPct}
+
+	var design int64
+	var atFrom, atTo *BatteryHealthSnapshot
+	for i := range snapshots {
+		s := &snapshots[i]
+		if s.ChargeFullDesignUAH > 0 && (s.Timestamp <= to || design == 0) {
+			design = s.ChargeFullDesignUAH
+		}
+		if s.CycleCount <= 0 || s.Timestamp > to {
+			continue
+		}
+		// The counter at from is the snapshot in effect then, or the
+		// first one after it when recording started later.
+		if s.Timestamp <= from || atFrom == nil {
+			atFrom = s
+		}
+		atTo = s
+	}
+	if atTo != nil {
+		c.FirmwareCycleCount = atTo.CycleCount
+		c.FirmwareCycles = atTo.CycleCount - atFrom.CycleCount
+	}
+
+	switch {
+	case d.Samples == 0:
+	case d.HasCharge && design > 0:
+		c.Basis = CycleBasisDesignCharge
+		c.DesignUAH = design
+		c.Cycles = float64(d.ChargeUAH) / float64(design)
+	default:
+		c.Basis = CycleBasisCapacity
+		c.Cycles = float64(d.CapacityPct) / 100
+	}
+	return c
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateChargeCycles(t *testing.T) {
+	snapshots := []BatteryHealthSnapshot{
+		{Timestamp: 50, ChargeFullDesignUAH: 5000000, CycleCount: 100},
+		{Timestamp: 150, ChargeFullDesignUAH: 5000000, CycleCount: 101},
+		{Timestamp: 250, ChargeFullDesignUAH: 5000000, CycleCount: 102},
+		{Timestamp: 350, ChargeFullDesignUAH: 5000000, CycleCount: 104}, // after the range
+	}
+	tests := []struct {
+		name          string
+		d             Discharge
+		snapshots     []BatteryHealthSnapshot
+		wantBasis     string
+		wantCycles    float64
+		wantFirmware  int64
+		wantFwInRange int64
+	}{
+		{"design charge", Discharge{ChargeUAH: 7500000, CapacityPct: 160, Samples: 50, HasCharge: true}, snapshots,
+			CycleBasisDesignCharge, 1.5, 102, 2},
+		{"no charge_now", Discharge{CapacityPct: 160, Samples: 50}, snapshots,
+			CycleBasisCapacity, 1.6, 102, 2},
+		{"no design charge", Discharge{ChargeUAH: 7500000, CapacityPct: 160, Samples: 50, HasCharge: true},
+			[]BatteryHealthSnapshot{{Timestamp: 150, CycleCount: 7}},
+			CycleBasisCapacity, 1.6, 7, 0},
+		{"no samples", Discharge{}, nil, "", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateChargeCycles(tt.d, tt.snapshots, 100, 300)
+			if got.Basis != tt.wantBasis || math.Abs(got.Cycles-tt.wantCycles) > 1e-9 {
+				t.Fatalf("cycles = %v (%q), want %v (%q)", got.Cycles, got.Basis, tt.wantCycles, tt.wantBasis)
+			}
+			if got.FirmwareCycleCount != tt.wantFirmware || got.FirmwareCycles != tt.wantFwInRange {
+				t.Fatalf("firmware = %d (+%d), want %d (+%d)", got.FirmwareCycleCount, got.FirmwareCycles, tt.wantFirmware, tt.wantFwInRange)
+			}
+			if got.From != 100 || got.To != 300 || got.DischargedUAH != tt.d.ChargeUAH || got.DischargedPct != tt.d.CapacityPct {
+				t.Fatalf("ChargeCycles = %+v, want the range and totals carried over", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"maps"
+	"slices"
+)
+
+// DebugState is a snapshot of the collectors' internal state, returned by
+// the DebugDump D-Bus method for live triage.
+type DebugState struct {
+	Battery      BatteryDebugState  `json:"battery"`
+	Process      *ProcessDebugState `json:"process"`       // nil when process collection is off
+	BatteryDir   string             `json:"battery_dir"`   // resolved sysfs path, "" if none matched
+	BacklightDir string             `json:"backlight_dir"` // resolved sysfs path, "" if none matched
+	DeviceErrors []string           `json:"device_errors"` // why a device path did not resolve
+}
+
+// ChargeReading is one reading in a BatteryCollector averaging window.
+type ChargeReading struct {
+	Timestamp int64 `json:"timestamp"`
+	ChargeUAH int64 `json:"charge_uah"`
+	EnergyUWH int64 `json:"energy_uwh"`
+	VoltageUV int64 `json:"voltage_uv"`
+}
+
+// BatteryDebugState is a BatteryCollector's settings and averaging windows.
+type BatteryDebugState struct {
+	Battery           string           `json:"battery"` // last batteries found, "" before one was
+	Present           bool             `json:"present"`
+	PreferSysfs       bool             `json:"prefer_sysfs"`
+	Quantity          DeltaQuantity    `json:"power_quantity"`
+	RoundingUW        int64            `json:"rounding_uw"`
+	WindowSec         int64            `json:"window_sec"`
+	SmoothedWindowSec int64            `json:"smoothed_window_sec"`
+	Packs             []PackDebugState `json:"packs"` // sorted by name
+}
+
+// PackDebugState is the averaging windows of one battery pack.
+type PackDebugState struct {
+	Battery         string          `json:"battery"`
+	History         []ChargeReading `json:"history"`
+	SmoothedHistory []ChargeReading `json:"smoothed_history"`
+}
+
+// ProcessDebugState is a ProcessCollector's CPU topology and cache sizes.
+type ProcessDebugState struct {
+	CPUTopology      map[int]bool `json:"cpu_topology"` // cpu_id -> is_p_core
+	CPUInfoFreqs     bool         `json:"cpuinfo_freqs"`
+	TrackedPIDs      int          `json:"tracked_pids"`
+	CmdlineCacheSize int          `json:"cmdline_cache_size"`
+	Lifetimes        int          `json:"lifetimes"`
+	BootTime         int64        `json:"boot_time"`
+}
+
+// NewDebugState snapshots bc and pc, which is nil when process collection is
+// off, and resolves the battery and backlight device patterns as the
+// collectors would.
+func NewDebugState(bc *BatteryCollector, pc *ProcessCollector, batteryDevice, backlightDevice string) DebugState {
+	st := DebugState{Battery: bc.DebugState(), DeviceErrors: []string{}}
+	if pc != nil {
+		p := pc.DebugState()
+		st.Process = &p
+	}
+	var err error
+	if st.BatteryDir, err = FindBatteryDir(batteryDevice); err != nil {
+		st.DeviceErrors = append(st.DeviceErrors, "battery: "+err.Error())
+	}
+	if st.BacklightDir, err = FindBacklightDir(backlightDevice); err != nil {
+		st.DeviceErrors = append(st.DeviceErrors, "backlight: "+err.Error())
+	}
+	return st
+}
+
+// DebugState returns a copy of the collector's state.
+func (bc *BatteryCollector) DebugState() BatteryDebugState {
+	st := BatteryDebugState{
+		Battery:           bc.lastBattery,
+		Present:           bc.present,
+		PreferSysfs:       bc.preferSysfs,
+		Quantity:          bc.quantity,
+		RoundingUW:        bc.roundingUW,
+		WindowSec:         bc.windowSec,
+		SmoothedWindowSec: bc.smoothedWindowSec,
+		Packs:             []PackDebugState{},
+	}
+	for _, name := range slices.Sorted(maps.Keys(bc.packs)) {
+		p := bc.packs[name]
+		st.Packs = append(st.Packs, PackDebugState{
+			Battery:         name,
+			History:         chargeReadings(p.history),
+			SmoothedHistory: chargeReadings(p.smoothed.history),
+		})
+	}
+	return st
+}
+
+func chargeReadings(history []historyEntry) []ChargeReading {
+	out := make([]ChargeReading, len(history))
+	for i, e := range history {
+		out[i] = ChargeReading{Timestamp: e.timestamp, ChargeUAH: e.chargeUAH, EnergyUWH: e.energyUWH, VoltageUV: e.voltageUV}
+	}
+	return out
+}
+
+// DebugState returns a copy of the collector's state.
+func (pc *ProcessCollector) DebugState() ProcessDebugState {
+	return ProcessDebugState{
+		CPUTopology:      maps.Clone(pc.cpuTopology),
+		CPUInfoFreqs:     pc.cpuinfoFreqs,
+		TrackedPIDs:      len(pc.prevTicks),
+		CmdlineCacheSize: len(pc.cmdlineCache),
+		Lifetimes:        len(pc.lifetimes),
+		BootTime:         pc.bootTime,
+	}
+}
@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewDebugState(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), strings.Join([]string{
+		"POWER_SUPPLY_STATUS=Discharging",
+		"POWER_SUPPLY_VOLTAGE_NOW=12000000",
+		"POWER_SUPPLY_CHARGE_NOW=4990000",
+		"POWER_SUPPLY_CAPACITY=74",
+		"",
+	}, "\n"))
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/type"), "Battery\n")
+
+	bc := NewBatteryCollector(30, false, "")
+	seedHistory(bc, "BAT0", []historyEntry{{timestamp: time.Now().Unix() - 10, chargeUAH: 5000000, voltageUV: 12000000}})
+	sample(t, root, bc)
+
+	st := NewDebugState(bc, nil, "", "")
+	if st.Process != nil {
+		t.Fatalf("Process = %+v with process collection off, want nil", st.Process)
+	}
+	if want := filepath.Join(root, "class/power_supply/BAT0"); st.BatteryDir != want {
+		t.Fatalf("BatteryDir = %q, want %q", st.BatteryDir, want)
+	}
+	if st.BacklightDir != "" || len(st.DeviceErrors) != 1 || !strings.HasPrefix(st.DeviceErrors[0], "backlight: ") {
+		t.Fatalf("BacklightDir = %q, DeviceErrors = %q, want only a backlight error", st.BacklightDir, st.DeviceErrors)
+	}
+	b := st.Battery
+	if b.Battery != "BAT0" || !b.Present || b.Quantity != DeltaQuantityAuto || b.WindowSec != 30 {
+		t.Fatalf("Battery = %+v, want BAT0 present with the default settings", b)
+	}
+	if len(b.Packs) != 1 || b.Packs[0].Battery != "BAT0" {
+		t.Fatalf("Packs = %+v, want one BAT0 window", b.Packs)
+	}
+	h := b.Packs[0].History
+	if len(h) != 2 || h[0].ChargeUAH != 5000000 || h[1].ChargeUAH != 4990000 {
+		t.Fatalf("History = %+v, want the seeded and collected readings", h)
+	}
+
+	// The snapshot must not alias the collector's window.
+	h[0].ChargeUAH = 1
+	if bc.pack("BAT0").history[0].chargeUAH != 5000000 {
+		t.Fatal("DebugState shares its history with the collector")
+	}
+}
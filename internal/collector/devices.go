@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sysfsRoot is where every device resolver looks for /sys; tests point it at
+// a fixture tree.
+var sysfsRoot = "/sys"
+
+// DefaultBatteryPattern selects the system battery when no battery is
+// configured.
+const DefaultBatteryPattern = "BAT*"
+
+// ValidateDevicePattern checks a configured device name or glob: it must be a
+// valid filepath.Match pattern naming a single sysfs class entry.
+func ValidateDevicePattern(pattern string) error {
+	if strings.ContainsRune(pattern, '/') || pattern == "." || pattern == ".." {
+		return fmt.Errorf("invalid device pattern %q", pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid device pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// matchDevices returns the entries of /sys/class/<class> matching pattern,
+// sorted by name.
+func matchDevices(class, pattern string) ([]string, error) {
+	if err := ValidateDevicePattern(pattern); err != nil {
+		return nil, err
+	}
+	matches, err := filepath.Glob(filepath.Join(sysfsRoot, "class", class, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", class, err)
+	}
+	return matches, nil
+}
+
+// backlightTypeRank orders /sys/class/backlight/*/type values by preference,
+// following the kernel's advice: firmware interfaces know the panel best,
+// then platform drivers, then raw GPU registers.
+var backlightTypeRank = map[string]int{"firmware": 0, "platform": 1, "raw": 2}
+
+// FindBacklightDir returns the sysfs directory of the backlight to use.
+// pattern is a device name or glob (e.g. "intel_backlight", "amdgpu_bl*")
+// restricting the candidates; "" considers every device. Among the
+// candidates the internal panel is preferred: external monitors driven over
+// DDC/CI ("ddcci*") are skipped unless they are the only match, and the rest
+// are ranked by backlightTypeRank, then by name.
+func FindBacklightDir(pattern string) (string, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+	matches, err := matchDevices("backlight", pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		if pattern == "*" {
+			return "", fmt.Errorf("no backlight found")
+		}
+		return "", fmt.Errorf("backlight %q not found", pattern)
+	}
+
+	rank := func(dir string) int {
+		r := len(backlightTypeRank)
+		if data, err := os.ReadFile(filepath.Join(dir, "type")); err == nil {
+			if tr, ok := backlightTypeRank[strings.TrimSpace(string(data))]; ok {
+				r = tr
+			}
+		}
+		if strings.HasPrefix(filepath.Base(dir), "ddcci") {
+			r += 10
+		}
+		return r
+	}
+	// Glob returns names sorted, so the first of equal rank wins ties.
+	best, bestRank := matches[0], rank(matches[0])
+	for _, dir := range matches[1:] {
+		if r := rank(dir); r < bestRank {
+			best, bestRank = dir, r
+		}
+	}
+	return best, nil
+}
+
+// FindBatteryDir returns the sysfs directory of the first battery
+// FindBatteryDirs finds.
+func FindBatteryDir(pattern string) (string, error) {
+	dirs, err := FindBatteryDirs(pattern)
+	if err != nil {
+		return "", err
+	}
+	return dirs[0], nil
+}
+
+// FindBatteryDirs returns the sysfs directories of the batteries to read,
+// sorted by name. pattern is a power supply name or glob; "" means
+// DefaultBatteryPattern. Matches whose type is not Battery (chargers, USB
+// ports) are skipped. Batteries reporting no numeric data, as some docks and
+// UPSes do, are left out too, unless no other battery matches: then the first
+// of them is returned alone.
+func FindBatteryDirs(pattern string) ([]string, error) {
+	if pattern == "" {
+		pattern = DefaultBatteryPattern
+	}
+	matches, err := matchDevices("power_supply", pattern)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	var dataless string
+	for _, dir := range matches {
+		data, err := os.ReadFile(filepath.Join(dir, "type"))
+		if err == nil && strings.TrimSpace(string(data)) != "Battery" {
+			continue
+		}
+		if data, err := os.ReadFile(filepath.Join(dir, "uevent")); err == nil && !hasBatteryData(parseUevent(string(data))) {
+			if dataless == "" {
+				dataless = dir
+			}
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	if len(dirs) > 0 {
+		return dirs, nil
+	}
+	if dataless != "" {
+		return []string{dataless}, nil
+	}
+	if pattern == DefaultBatteryPattern {
+		return nil, ErrNoBattery
+	}
+	return nil, fmt.Errorf("%w matching %q", ErrNoBattery, pattern)
+}
+
+// BatteryDirs returns the sysfs directories of every battery, sorted by name:
+// power supplies whose type is Battery, or named BAT* when the driver
+// exposes no type.
+func BatteryDirs() ([]string, error) {
+	matches, err := matchDevices("power_supply", "*")
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, dir := range matches {
+		data, err := os.ReadFile(filepath.Join(dir, "type"))
+		if err != nil {
+			if strings.HasPrefix(filepath.Base(dir), "BAT") {
+				dirs = append(dirs, dir)
+			}
+			continue
+		}
+		if strings.TrimSpace(string(data)) == "Battery" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+// onlineACSupply returns the name (e.g. "AC", "ucsi-source-psy-USBC000:001")
+// and sysfs directory of the first online external power supply, or "" and ""
+// when running on battery. Supplies are identified by their sysfs type: Mains,
+// Wireless, or any USB variant (USB, USB_PD, USB_C, ...). Supplies without a
+// type file fall back to the traditional AC* naming.
+func onlineACSupply() (name, dir string) {
+	matches, err := matchDevices("power_supply", "*")
+	if err != nil {
+		return "", ""
+	}
+	for _, dir := range matches {
+		name := filepath.Base(dir)
+		if !isExternalSupply(dir, name) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, "online"))
+		if err == nil && strings.TrimSpace(string(data)) == "1" {
+			return name, dir
+		}
+	}
+	return "", ""
+}
+
+// isExternalSupply reports whether the power supply at dir delivers external power.
+func isExternalSupply(dir, name string) bool {
+	data, err := os.ReadFile(filepath.Join(dir, "type"))
+	if err != nil {
+		return strings.HasPrefix(name, "AC")
+	}
+	switch t := strings.TrimSpace(string(data)); {
+	case t == "Mains", t == "Wireless":
+		return true
+	case strings.HasPrefix(t, "USB"):
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindBacklightDir_PrefersInternalPanel(t *testing.T) {
+	tests := []struct {
+		name    string
+		devices map[string]string // name -> type ("" writes no type file)
+		want    string
+	}{
+		{
+			name:    "single device",
+			devices: map[string]string{"intel_backlight": "raw"},
+			want:    "intel_backlight",
+		},
+		{
+			name:    "firmware over raw",
+			devices: map[string]string{"acpi_video0": "firmware", "intel_backlight": "raw"},
+			want:    "acpi_video0",
+		},
+		{
+			name:    "platform over raw",
+			devices: map[string]string{"amdgpu_bl0": "raw", "dell_backlight": "platform"},
+			want:    "dell_backlight",
+		},
+		{
+			name:    "skips external ddcci monitor",
+			devices: map[string]string{"ddcci5": "firmware", "intel_backlight": "raw"},
+			want:    "intel_backlight",
+		},
+		{
+			name:    "ddcci when it is the only device",
+			devices: map[string]string{"ddcci5": "raw"},
+			want:    "ddcci5",
+		},
+		{
+			name:    "ties broken by name",
+			devices: map[string]string{"nvidia_1": "raw", "nvidia_0": "raw"},
+			want:    "nvidia_0",
+		},
+		{
+			name:    "unknown type ranks last",
+			devices: map[string]string{"mystery": "", "intel_backlight": "raw"},
+			want:    "intel_backlight",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setTestSysfsRoot(t)
+			for name, typ := range tt.devices {
+				dir := filepath.Join(root, "class/backlight", name)
+				writeTestFile(t, filepath.Join(dir, "brightness"), "1\n")
+				if typ != "" {
+					writeTestFile(t, filepath.Join(dir, "type"), typ+"\n")
+				}
+			}
+
+			got, err := FindBacklightDir("")
+			if err != nil {
+				t.Fatalf("FindBacklightDir() error = %v", err)
+			}
+			if filepath.Base(got) != tt.want {
+				t.Fatalf("FindBacklightDir() = %q, want %q", filepath.Base(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBacklightDir_ByName(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/backlight/acpi_video0/type"), "firmware\n")
+	writeTestFile(t, filepath.Join(root, "class/backlight/intel_backlight/type"), "raw\n")
+
+	got, err := FindBacklightDir("intel_backlight")
+	if err != nil {
+		t.Fatalf("FindBacklightDir(intel_backlight) error = %v", err)
+	}
+	if filepath.Base(got) != "intel_backlight" {
+		t.Fatalf("FindBacklightDir(intel_backlight) = %q", got)
+	}
+
+	for _, name := range []string{"missing", "../power_supply", "..", "[bad"} {
+		if _, err := FindBacklightDir(name); err == nil {
+			t.Fatalf("FindBacklightDir(%q) error = nil, want error", name)
+		}
+	}
+}
+
+func TestFindBacklightDir_Glob(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/backlight/acpi_video0/type"), "firmware\n")
+	writeTestFile(t, filepath.Join(root, "class/backlight/amdgpu_bl1/type"), "raw\n")
+	writeTestFile(t, filepath.Join(root, "class/backlight/amdgpu_bl0/type"), "raw\n")
+
+	got, err := FindBacklightDir("amdgpu_bl*")
+	if err != nil {
+		t.Fatalf("FindBacklightDir(amdgpu_bl*) error = %v", err)
+	}
+	if filepath.Base(got) != "amdgpu_bl0" {
+		t.Fatalf("FindBacklightDir(amdgpu_bl*) = %q, want amdgpu_bl0", filepath.Base(got))
+	}
+	if _, err := FindBacklightDir("nvidia_*"); err == nil {
+		t.Fatal("FindBacklightDir(nvidia_*) error = nil, want not found")
+	}
+}
+
+func TestFindBatteryDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		supplies map[string]string // name -> type ("" writes no type file)
+		pattern  string
+		want     string // "" expects an error
+	}{
+		{"default picks first BAT", map[string]string{"BAT1": "Battery", "BAT0": "Battery", "AC": "Mains"}, "", "BAT0"},
+		{"default without type file", map[string]string{"BAT0": ""}, "", "BAT0"},
+		{"no battery", map[string]string{"AC": "Mains"}, "", ""},
+		{"named battery", map[string]string{"BAT0": "Battery", "BAT1": "Battery"}, "BAT1", "BAT1"},
+		{"glob skips non-batteries", map[string]string{"ADP1": "Mains", "CMB0": "Battery"}, "*", "CMB0"},
+		{"configured battery missing", map[string]string{"BAT0": "Battery"}, "CMB*", ""},
+		{"invalid pattern", map[string]string{"BAT0": "Battery"}, "../BAT0", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := setTestSysfsRoot(t)
+			for name, typ := range tt.supplies {
+				dir := filepath.Join(root, "class/power_supply", name)
+				writeTestFile(t, filepath.Join(dir, "uevent"), "\n")
+				if typ != "" {
+					writeTestFile(t, filepath.Join(dir, "type"), typ+"\n")
+				}
+			}
+
+			got, err := FindBatteryDir(tt.pattern)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("FindBatteryDir(%q) = %q, want error", tt.pattern, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindBatteryDir(%q) error = %v", tt.pattern, err)
+			}
+			if filepath.Base(got) != tt.want {
+				t.Fatalf("FindBatteryDir(%q) = %q, want %q", tt.pattern, filepath.Base(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBatteryDir_SkipsDatalessBattery(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/uevent"), "POWER_SUPPLY_STATUS=Unknown\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT0/type"), "Battery\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT1/uevent"), "POWER_SUPPLY_STATUS=Discharging\nPOWER_SUPPLY_CAPACITY=80\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/BAT1/type"), "Battery\n")
+
+	got, err := FindBatteryDir("")
+	if err != nil {
+		t.Fatalf("FindBatteryDir() error = %v", err)
+	}
+	if filepath.Base(got) != "BAT1" {
+		t.Fatalf("FindBatteryDir() = %q, want BAT1", filepath.Base(got))
+	}
+}
+
+func TestFindBatteryDirs(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	for name, uevent := range map[string]string{
+		"BAT0": "POWER_SUPPLY_CAPACITY=80\n",
+		"BAT1": "POWER_SUPPLY_CAPACITY=60\n",
+		"BAT2": "POWER_SUPPLY_STATUS=Unknown\n", // dock bay without data
+	} {
+		writeTestFile(t, filepath.Join(root, "class/power_supply", name, "uevent"), uevent)
+		writeTestFile(t, filepath.Join(root, "class/power_supply", name, "type"), "Battery\n")
+	}
+	writeTestFile(t, filepath.Join(root, "class/power_supply/AC/type"), "Mains\n")
+
+	dirs, err := FindBatteryDirs("")
+	if err != nil {
+		t.Fatalf("FindBatteryDirs() error = %v", err)
+	}
+	var names []string
+	for _, dir := range dirs {
+		names = append(names, filepath.Base(dir))
+	}
+	if strings.Join(names, ",") != "BAT0,BAT1" {
+		t.Fatalf("FindBatteryDirs() = %q, want BAT0 and BAT1", names)
+	}
+}
+
+func TestCollectBacklight_UsesPattern(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	for name, brightness := range map[string]string{"acpi_video0": "7\n", "intel_backlight": "300\n"} {
+		dir := filepath.Join(root, "class/backlight", name)
+		writeTestFile(t, filepath.Join(dir, "brightness"), brightness)
+		writeTestFile(t, filepath.Join(dir, "max_brightness"), "1000\n")
+	}
+
+	s, err := CollectBacklight("intel_*")
+	if err != nil {
+		t.Fatalf("CollectBacklight() error = %v", err)
+	}
+	if s.Brightness != 300 {
+		t.Fatalf("Brightness = %d, want 300 from intel_backlight", s.Brightness)
+	}
+}
+
+func TestOnlineACSupply_IgnoresNonExternalSupplies(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	// A peripheral battery (e.g. wireless mouse) reporting online must not count as AC.
+	writeTestFile(t, filepath.Join(root, "class/power_supply/hidpp_battery_0/type"), "Battery\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/hidpp_battery_0/online"), "1\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ADP1/type"), "Mains\n")
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ADP1/online"), "0\n")
+
+	if name, dir := onlineACSupply(); name != "" || dir != "" {
+		t.Fatalf("onlineACSupply() = %q, %q; want empty", name, dir)
+	}
+
+	writeTestFile(t, filepath.Join(root, "class/power_supply/ADP1/online"), "1\n")
+	if name, dir := onlineACSupply(); name != "ADP1" || filepath.Base(dir) != "ADP1" {
+		t.Fatalf("onlineACSupply() = %q, %q; want ADP1 and its directory", name, dir)
+	}
+}
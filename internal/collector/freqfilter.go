@@ -0,0 +1,44 @@
+package collector
+
+// CPUFreqFilter implements sample-on-change storage for CPU frequencies: a
+// core's sample is kept only when it differs by at least the threshold from
+// the core's last kept sample, or when the heartbeat interval has passed
+// since then, so every online core still appears periodically.
+type CPUFreqFilter struct {
+	thresholdKHz int64
+	heartbeatSec int64
+	last         map[int]CPUFreqSample // cpu_id -> last kept sample
+}
+
+// NewCPUFreqFilter creates a CPUFreqFilter. A thresholdKHz of 0 disables
+// filtering and keeps every sample.
+func NewCPUFreqFilter(thresholdKHz, heartbeatSec int64) *CPUFreqFilter {
+	return &CPUFreqFilter{
+		thresholdKHz: thresholdKHz,
+		heartbeatSec: heartbeatSec,
+		last:         make(map[int]CPUFreqSample),
+	}
+}
+
+// Filter returns the samples to store from one collection cycle.
+func (f *CPUFreqFilter) Filter(samples []CPUFreqSample) []CPUFreqSample {
+	if f.thresholdKHz <= 0 {
+		return samples
+	}
+	kept := samples[:0:0]
+	for _, s := range samples {
+		last, ok := f.last[s.CPUID]
+		delta := s.FreqKHz - last.FreqKHz
+		if delta < 0 {
+			delta = -delta
+		}
+		// A timestamp before the last kept one means the wall clock stepped
+		// back; store so the series restarts from the new time base.
+		if ok && delta < f.thresholdKHz && s.Timestamp >= last.Timestamp && s.Timestamp-last.Timestamp < f.heartbeatSec {
+			continue
+		}
+		f.last[s.CPUID] = s
+		kept = append(kept, s)
+	}
+	return kept
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCPUFreqFilter_Disabled(t *testing.T) {
+	f := NewCPUFreqFilter(0, 300)
+	samples := []CPUFreqSample{{Timestamp: 100, CPUID: 0, FreqKHz: 800000}}
+	for range 3 {
+		if got := f.Filter(samples); !reflect.DeepEqual(got, samples) {
+			t.Fatalf("Filter() = %#v, want every sample kept", got)
+		}
+	}
+}
+
+func TestCPUFreqFilter_ChangesAndHeartbeat(t *testing.T) {
+	f := NewCPUFreqFilter(100000, 60)
+
+	cycles := []struct {
+		samples []CPUFreqSample
+		wantIDs []int
+		label   string
+	}{
+		{
+			[]CPUFreqSample{{Timestamp: 100, CPUID: 0, FreqKHz: 800000}, {Timestamp: 100, CPUID: 1, FreqKHz: 800000}},
+			[]int{0, 1}, "first sample of each core is kept",
+		},
+		{
+			[]CPUFreqSample{{Timestamp: 105, CPUID: 0, FreqKHz: 850000}, {Timestamp: 105, CPUID: 1, FreqKHz: 2400000}},
+			[]int{1}, "only the change beyond the threshold is kept",
+		},
+		{
+			[]CPUFreqSample{{Timestamp: 110, CPUID: 0, FreqKHz: 700000}, {Timestamp: 110, CPUID: 1, FreqKHz: 2400000}},
+			[]int{0}, "threshold is measured from the last kept value",
+		},
+		{
+			[]CPUFreqSample{{Timestamp: 165, CPUID: 0, FreqKHz: 700000}, {Timestamp: 165, CPUID: 1, FreqKHz: 2400000}},
+			[]int{1}, "heartbeat keeps a core unchanged for 60s",
+		},
+		{
+			[]CPUFreqSample{{Timestamp: 50, CPUID: 0, FreqKHz: 700000}, {Timestamp: 50, CPUID: 1, FreqKHz: 2400000}},
+			[]int{0, 1}, "clock stepping back keeps every core",
+		},
+	}
+	for _, c := range cycles {
+		var gotIDs []int
+		for _, s := range f.Filter(c.samples) {
+			gotIDs = append(gotIDs, s.CPUID)
+		}
+		if !reflect.DeepEqual(gotIDs, c.wantIDs) {
+			t.Fatalf("%s: kept cores %v, want %v", c.label, gotIDs, c.wantIDs)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+// IdleDetector turns periodic observations of the user-idle state into idle
+// intervals. An interval starts at the idle-since time reported with the
+// first idle observation and ends at the first active one. A gap between
+// observations longer than maxGap (e.g. a suspend) ends the interval at the
+// last observation, so sleep is not counted as idle use.
+type IdleDetector struct {
+	maxGap  int64
+	lastObs int64
+	open    *IdleInterval
+}
+
+// NewIdleDetector creates an IdleDetector for observations about intervalSec
+// apart.
+func NewIdleDetector(intervalSec int64) *IdleDetector {
+	return &IdleDetector{maxGap: 2 * max(intervalSec, 1)}
+}
+
+// SetInterval updates the expected spacing of observations after the
+// collection interval changed; an open interval is kept.
+func (d *IdleDetector) SetInterval(intervalSec int64) {
+	d.maxGap = 2 * max(intervalSec, 1)
+}
+
+// Observe records the idle state at now; idleSince is when the current idle
+// period began (0 if unknown). When an idle interval ends, it returns that
+// interval.
+func (d *IdleDetector) Observe(now int64, idle bool, idleSince int64) *IdleInterval {
+	prev := d.lastObs
+	d.lastObs = now
+	gap := prev > 0 && now-prev > d.maxGap
+
+	var ended *IdleInterval
+	if gap {
+		ended = d.close(prev)
+	}
+	if !idle {
+		if ended == nil {
+			ended = d.close(now)
+		}
+		return ended
+	}
+
+	if d.open == nil {
+		// idleSince is trusted back to the previous observation, or fully
+		// on the first one; after a gap it would count the sleep.
+		start := now
+		if idleSince > 0 && idleSince <= now && !gap && (prev == 0 || idleSince >= prev) {
+			start = idleSince
+		}
+		d.open = &IdleInterval{StartTime: start}
+	}
+	d.open.EndTime = now
+	return ended
+}
+
+// Flush ends any open idle interval at the last observation and returns it.
+// Call it on shutdown.
+func (d *IdleDetector) Flush() *IdleInterval {
+	return d.close(d.lastObs)
+}
+
+func (d *IdleDetector) close(end int64) *IdleInterval {
+	iv := d.open
+	d.open = nil
+	if iv == nil {
+		return nil
+	}
+	iv.EndTime = end
+	if iv.EndTime <= iv.StartTime {
+		return nil
+	}
+	return iv
+}
+
+// IdleMonitor reads the user-idle state from systemd-logind, which GNOME
+// updates from its own idle tracking on both X11 and Wayland. logind's
+// manager-level IdleHint is set only when every session is idle.
+type IdleMonitor struct {
+	conn *dbus.Conn
+	obj  dbus.BusObject
+}
+
+// NewIdleMonitor connects to the system bus and checks that logind exposes
+// the idle hint.
+func NewIdleMonitor() (*IdleMonitor, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	m := &IdleMonitor{
+		conn: conn,
+		obj:  conn.Object("org.freedesktop.login1", "/org/freedesktop/login1"),
+	}
+	if _, _, err := m.Read(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Read returns whether the user is idle and, if so, since when (unix seconds,
+// 0 if logind does not say).
+func (m *IdleMonitor) Read() (idle bool, since int64, err error) {
+	v, err := m.obj.GetProperty("org.freedesktop.login1.Manager.IdleHint")
+	if err != nil {
+		return false, 0, err
+	}
+	if err := v.Store(&idle); err != nil {
+		return false, 0, err
+	}
+	if !idle {
+		return false, 0, nil
+	}
+	// IdleSinceHint is in microseconds of CLOCK_REALTIME.
+	if v, err := m.obj.GetProperty("org.freedesktop.login1.Manager.IdleSinceHint"); err == nil {
+		var usec uint64
+		if v.Store(&usec) == nil {
+			since = int64(usec / 1000000)
+		}
+	}
+	return true, since, nil
+}
+
+// Close disconnects from the system bus.
+func (m *IdleMonitor) Close() {
+	m.conn.Close()
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIdleDetector_RecordsIdleInterval(t *testing.T) {
+	d := NewIdleDetector(5)
+
+	if iv := d.Observe(100, false, 0); iv != nil {
+		t.Fatalf("Observe(active) = %#v, want nil", iv)
+	}
+	for now := int64(105); now <= 200; now += 5 {
+		if iv := d.Observe(now, true, 103); iv != nil {
+			t.Fatalf("Observe(idle at %d) = %#v, want nil", now, iv)
+		}
+	}
+	iv := d.Observe(205, false, 0)
+	if want := (&IdleInterval{StartTime: 103, EndTime: 205}); !reflect.DeepEqual(iv, want) {
+		t.Fatalf("Observe(active) = %#v, want %#v", iv, want)
+	}
+	if iv := d.Flush(); iv != nil {
+		t.Fatalf("Flush() after close = %#v, want nil", iv)
+	}
+}
+
+func TestIdleDetector_IgnoresStaleIdleSince(t *testing.T) {
+	d := NewIdleDetector(5)
+	d.Observe(100, false, 0)
+
+	// An idle-since before the previous observation cannot be right.
+	d.Observe(105, true, 50)
+	iv := d.Observe(110, false, 0)
+	if want := (&IdleInterval{StartTime: 105, EndTime: 110}); !reflect.DeepEqual(iv, want) {
+		t.Fatalf("interval = %#v, want %#v", iv, want)
+	}
+}
+
+func TestIdleDetector_GapEndsInterval(t *testing.T) {
+	d := NewIdleDetector(5)
+	d.Observe(100, true, 90)
+	d.Observe(105, true, 90)
+
+	// Suspended for an hour, still idle on wake.
+	iv := d.Observe(3705, true, 90)
+	if want := (&IdleInterval{StartTime: 90, EndTime: 105}); !reflect.DeepEqual(iv, want) {
+		t.Fatalf("Observe(after gap) = %#v, want %#v", iv, want)
+	}
+	d.Observe(3710, true, 90)
+	iv = d.Flush()
+	if want := (&IdleInterval{StartTime: 3705, EndTime: 3710}); !reflect.DeepEqual(iv, want) {
+		t.Fatalf("Flush() = %#v, want %#v (resumed at wake, not the old idle-since)", iv, want)
+	}
+}
+
+func TestIdleDetector_SetIntervalWidensGap(t *testing.T) {
+	d := NewIdleDetector(5)
+	d.Observe(100, true, 90)
+	d.SetInterval(60)
+
+	// 60 s apart is a normal cycle at the new interval, not a suspend.
+	if iv := d.Observe(160, true, 90); iv != nil {
+		t.Fatalf("Observe(160) = %#v, want interval still open", iv)
+	}
+	if want := (&IdleInterval{StartTime: 90, EndTime: 160}); !reflect.DeepEqual(d.Flush(), want) {
+		t.Fatalf("Flush() want %#v", want)
+	}
+}
+
+func TestIdleDetector_DropsZeroLengthInterval(t *testing.T) {
+	d := NewIdleDetector(5)
+	d.Observe(100, true, 0)
+	if iv := d.Observe(105, false, 0); iv == nil || iv.StartTime != 100 || iv.EndTime != 105 {
+		t.Fatalf("Observe(active) = %#v, want 100-105", iv)
+	}
+
+	d.Observe(110, true, 0)
+	if iv := d.Flush(); iv != nil {
+		t.Fatalf("Flush() of a zero-length interval = %#v, want nil", iv)
+	}
+}
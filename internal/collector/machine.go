@@ -0,0 +1,24 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CollectMachineInfo reads the laptop vendor and model from
+// /sys/class/dmi/id. Fields the firmware does not expose are left empty.
+func CollectMachineInfo() MachineInfo {
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(sysfsRoot, "class/dmi/id", name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return MachineInfo{
+		Vendor:  read("sys_vendor"),
+		Product: read("product_name"),
+		Version: read("product_version"),
+	}
+}
@@ -0,0 +1,20 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectMachineInfo(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	dmi := filepath.Join(root, "class/dmi/id")
+	writeTestFile(t, filepath.Join(dmi, "sys_vendor"), "LENOVO\n")
+	writeTestFile(t, filepath.Join(dmi, "product_name"), "21CB000GUS\n")
+	writeTestFile(t, filepath.Join(dmi, "product_serial"), "PF3XXXXX\n")
+
+	got := CollectMachineInfo()
+	want := MachineInfo{Vendor: "LENOVO", Product: "21CB000GUS"}
+	if got != want {
+		t.Fatalf("CollectMachineInfo() = %+v, want %+v", got, want)
+	}
+}
@@ -8,32 +8,97 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
+// procRoot is the procfs mount point; tests point it at a fixture tree.
+var procRoot = "/proc"
+
 // ProcessCollector tracks per-process CPU tick deltas across sampling intervals.
 type ProcessCollector struct {
-	prevTicks   map[int]int64  // pid -> previous utime+stime
-	cmdlineCache map[int]string // pid -> cmdline (read once per pid lifetime)
-	cpuTopology map[int]bool   // cpu_id -> is_p_core (computed once at init)
-	topN        int
+	prevTicks    map[int]procTicks // pid -> previous utime+stime and start time
+	cmdlineCache map[int]string    // pid -> cmdline (read once per pid lifetime)
+	cpuTopology  map[int]bool      // cpu_id -> is_p_core (computed once at init)
+	topN         int
+	scanWorkers  int // goroutines reading /proc/<pid>/stat in parallel
+	// cpuinfoFreqs is set when no CPU has a sysfs cpufreq directory (VMs,
+	// some ARM boards); frequencies then come from /proc/cpuinfo.
+	cpuinfoFreqs bool
+	// lifetimes holds the running processes seen with activity so far;
+	// entries are dropped once their pid exits or is reused.
+	lifetimes map[lifetimeKey]ProcessLifetime
+	bootTime  int64 // unix time of boot, from the btime line of /proc/stat
+}
+
+// procTicks identifies one process lifetime's CPU counter. The kernel may
+// reuse a pid between cycles; the start time tells the two processes apart.
+type procTicks struct {
+	ticks     int64 // utime + stime
+	startTime int64 // clock ticks after boot when the process started
+}
+
+// lifetimeKey identifies one process across cycles.
+type lifetimeKey struct {
+	pid       int
+	startTime int64 // clock ticks after boot
 }
 
+// userHZ is the kernel's USER_HZ, the unit of the start time in
+// /proc/<pid>/stat. It is 100 on every architecture Linux supports today.
+const userHZ = 100
+
 // NewProcessCollector creates a ProcessCollector, detecting CPU topology once.
-func NewProcessCollector(topN int) *ProcessCollector {
+// scanWorkers bounds the goroutines reading /proc each cycle; 1 or less scans
+// serially.
+func NewProcessCollector(topN, scanWorkers int) *ProcessCollector {
 	if topN <= 0 {
 		topN = 10
 	}
+	if scanWorkers <= 0 {
+		scanWorkers = 1
+	}
 	pc := &ProcessCollector{
-		prevTicks:    make(map[int]int64),
+		prevTicks:    make(map[int]procTicks),
 		cmdlineCache: make(map[int]string),
-		cpuTopology:  make(map[int]bool),
+		lifetimes:    make(map[lifetimeKey]ProcessLifetime),
+		cpuTopology:  detectCPUTopology(),
 		topN:         topN,
+		scanWorkers:  scanWorkers,
 	}
-	pc.detectTopology()
+	pc.cpuinfoFreqs = !hasCPUFreq()
+	pc.bootTime = readBootTime()
 	return pc
 }
 
+// readBootTime returns the btime line of /proc/stat, or 0 when it can't be
+// read, leaving process start times relative to boot.
+func readBootTime() int64 {
+	data, err := os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return 0
+	}
+	for line := range strings.Lines(string(data)) {
+		if v, ok := strings.CutPrefix(line, "btime "); ok {
+			t, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return t
+		}
+	}
+	return 0
+}
+
+// UsesCPUInfoFreqs reports whether the sysfs cpufreq interface is missing, so
+// frequencies are read from the "cpu MHz" lines of /proc/cpuinfo instead.
+func (pc *ProcessCollector) UsesCPUInfoFreqs() bool {
+	return pc.cpuinfoFreqs
+}
+
+// hasCPUFreq reports whether any CPU exposes a sysfs cpufreq directory.
+func hasCPUFreq() bool {
+	dirs, _ := filepath.Glob(filepath.Join(sysfsRoot, "devices/system/cpu/cpu[0-9]*/cpufreq"))
+	return len(dirs) > 0
+}
+
 // IsPCore returns whether the given CPU ID is a P-core.
 func (pc *ProcessCollector) IsPCore(cpuID int) bool {
 	return pc.cpuTopology[cpuID]
@@ -44,13 +109,14 @@ func (pc *ProcessCollector) CPUIDs() map[int]bool {
 	return pc.cpuTopology
 }
 
-// detectTopology determines P-core vs E-core for each CPU.
-// On hybrid Intel, E-cores have a lower base frequency than P-cores.
-// On non-hybrid systems, all cores are marked as P-cores.
-func (pc *ProcessCollector) detectTopology() {
-	cpuDirs, err := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*")
+// detectCPUTopology determines P-core vs E-core for each CPU, returning
+// cpu_id -> is_p_core. On hybrid Intel, E-cores have a lower base frequency
+// than P-cores. On non-hybrid systems, all cores are marked as P-cores.
+func detectCPUTopology() map[int]bool {
+	topology := make(map[int]bool)
+	cpuDirs, err := filepath.Glob(filepath.Join(sysfsRoot, "devices/system/cpu/cpu[0-9]*"))
 	if err != nil {
-		return
+		return topology
 	}
 
 	type cpuInfo struct {
@@ -74,7 +140,7 @@ func (pc *ProcessCollector) detectTopology() {
 	}
 
 	if len(cpus) == 0 {
-		return
+		return topology
 	}
 
 	// Find max base frequency — cores at max are P-cores
@@ -86,41 +152,51 @@ func (pc *ProcessCollector) detectTopology() {
 	}
 
 	for _, c := range cpus {
-		pc.cpuTopology[c.id] = (c.base == maxBase)
+		topology[c.id] = (c.base == maxBase)
 	}
+	return topology
 }
 
 // ProcessCollectStats holds summary statistics from a process collection cycle.
 type ProcessCollectStats struct {
-	TotalProcs    int              // number of processes with nonzero delta
-	TotalTicks    int64            // sum of all process tick deltas
-	CapturedTicks int64            // sum of tick deltas for top N kept
-	PerCoreTicks  map[int]int64    // cpu_id -> total ticks on that core (all procs)
+	Timestamp     int64         // unix time of the collection cycle
+	TotalProcs    int           // number of processes with nonzero delta
+	TotalTicks    int64         // sum of all process tick deltas
+	CapturedTicks int64         // sum of tick deltas for top N kept
+	PerCoreTicks  map[int]int64 // cpu_id -> total ticks on that core (all procs)
+	// Lifetimes are the lifetimes of every process with a nonzero delta this
+	// cycle, LastSeen set to the cycle time, ordered by pid.
+	Lifetimes []ProcessLifetime
 }
 
 type procEntry struct {
-	pid    int
-	comm   string
-	ticks  int64 // utime + stime
-	cpu    int
+	pid       int
+	comm      string
+	ticks     int64 // utime + stime
+	startTime int64 // clock ticks after boot
+	cpu       int
+}
+
+// Reset forgets the previous tick counts, so the next Collect only records a
+// baseline instead of charging processes for everything since the last call.
+// Call it when collection resumes after a pause.
+func (pc *ProcessCollector) Reset() {
+	clear(pc.prevTicks)
 }
 
 // Collect reads /proc/*/stat, computes tick deltas from the previous call,
 // and returns the top N processes by CPU usage, current CPU frequencies, and
-// summary statistics for logging.
+// summary statistics for logging. The statistics also carry the lifetime of
+// every active process, not just the top N.
 func (pc *ProcessCollector) Collect() ([]ProcessSample, []CPUFreqSample, *ProcessCollectStats, error) {
 	now := time.Now().Unix()
 
-	entries, err := os.ReadDir("/proc")
+	entries, err := os.ReadDir(procRoot)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("read /proc: %w", err)
+		return nil, nil, nil, fmt.Errorf("read %s: %w", procRoot, err)
 	}
 
-	currentTicks := make(map[int]int64, len(entries))
-	var procs []procEntry
-	perCoreTicks := make(map[int]int64)
-	var totalTicks int64
-
+	var pids []int
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
@@ -129,28 +205,60 @@ func (pc *ProcessCollector) Collect() ([]ProcessSample, []CPUFreqSample, *Proces
 		if err != nil {
 			continue
 		}
-		pe, err := readProcStat(pid)
-		if err != nil {
+		pids = append(pids, pid)
+	}
+	stats := pc.readProcStats(pids)
+
+	currentTicks := make(map[int]procTicks, len(pids))
+	var procs []procEntry
+	perCoreTicks := make(map[int]int64)
+	var totalTicks int64
+	var lifetimes []ProcessLifetime
+
+	for i, pid := range pids {
+		if stats[i].err != nil {
 			continue
 		}
-		currentTicks[pid] = pe.ticks
+		pe := stats[i].entry
+		currentTicks[pid] = procTicks{ticks: pe.ticks, startTime: pe.startTime}
 
 		prev, ok := pc.prevTicks[pid]
 		if !ok {
 			continue // first observation, no delta
 		}
-		delta := pe.ticks - prev
+		if prev.startTime != pe.startTime {
+			// The pid was reused by a new process; its counter starts over.
+			delete(pc.cmdlineCache, pid)
+			continue
+		}
+		delta := pe.ticks - prev.ticks
 		if delta <= 0 {
 			continue
 		}
 		totalTicks += delta
 		perCoreTicks[pe.cpu] += delta
 		procs = append(procs, procEntry{pid: pid, comm: pe.comm, ticks: delta, cpu: pe.cpu})
+
+		key := lifetimeKey{pid, pe.startTime}
+		lt, ok := pc.lifetimes[key]
+		if !ok {
+			lt = ProcessLifetime{PID: pid, StartTime: pc.bootTime + pe.startTime/userHZ, FirstSeen: now}
+		}
+		lt.Comm = pe.comm
+		lt.LastSeen = now
+		pc.lifetimes[key] = lt
+		lifetimes = append(lifetimes, lt)
 	}
 
-	// Sort by delta descending, keep top N
+	sort.Slice(lifetimes, func(i, j int) bool { return lifetimes[i].PID < lifetimes[j].PID })
+
+	// Sort by delta descending, keep top N. Ties break on pid so the
+	// selection does not depend on scan order.
 	sort.Slice(procs, func(i, j int) bool {
-		return procs[i].ticks > procs[j].ticks
+		if procs[i].ticks != procs[j].ticks {
+			return procs[i].ticks > procs[j].ticks
+		}
+		return procs[i].pid < procs[j].pid
 	})
 	totalProcs := len(procs)
 	if len(procs) > pc.topN {
@@ -177,11 +285,13 @@ func (pc *ProcessCollector) Collect() ([]ProcessSample, []CPUFreqSample, *Proces
 		}
 	}
 
-	stats := &ProcessCollectStats{
+	cycle := &ProcessCollectStats{
+		Timestamp:     now,
 		TotalProcs:    totalProcs,
 		TotalTicks:    totalTicks,
 		CapturedTicks: capturedTicks,
 		PerCoreTicks:  perCoreTicks,
+		Lifetimes:     lifetimes,
 	}
 
 	// Update state: replace prevTicks, prune dead pids from cmdline cache
@@ -191,32 +301,82 @@ func (pc *ProcessCollector) Collect() ([]ProcessSample, []CPUFreqSample, *Proces
 			delete(pc.cmdlineCache, pid)
 		}
 	}
+	// A lifetime ends when its pid disappears or comes back as a new process.
+	for key := range pc.lifetimes {
+		if cur, ok := pc.prevTicks[key.pid]; !ok || cur.startTime != key.startTime {
+			delete(pc.lifetimes, key)
+		}
+	}
 
 	// Collect CPU frequencies
 	freqSamples := pc.collectFreqs(now)
 
-	return samples, freqSamples, stats, nil
+	return samples, freqSamples, cycle, nil
+}
+
+// procStatResult is the outcome of reading one pid's stat file.
+type procStatResult struct {
+	entry procEntry
+	err   error
+}
+
+// readProcStats reads the stat file of every pid, spreading the reads over up
+// to pc.scanWorkers goroutines. Results are indexed like pids, so callers see
+// the same order whatever the worker count.
+func (pc *ProcessCollector) readProcStats(pids []int) []procStatResult {
+	results := make([]procStatResult, len(pids))
+	workers := min(pc.scanWorkers, len(pids))
+	if workers <= 1 {
+		for i, pid := range pids {
+			results[i].entry, results[i].err = readProcStat(pid)
+		}
+		return results
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].entry, results[i].err = readProcStat(pids[i])
+			}
+		}()
+	}
+	for i := range pids {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// CycleStats returns the persisted subset of the collection statistics.
+func (s *ProcessCollectStats) CycleStats() ProcessCycleStats {
+	return ProcessCycleStats{
+		Timestamp:     s.Timestamp,
+		TotalTicks:    s.TotalTicks,
+		CapturedTicks: s.CapturedTicks,
+		TotalProcs:    s.TotalProcs,
+	}
 }
 
 func (pc *ProcessCollector) collectFreqs(now int64) []CPUFreqSample {
-	cpuDirs, err := filepath.Glob("/sys/devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq")
+	if pc.cpuinfoFreqs {
+		return pc.collectCPUInfoFreqs(now)
+	}
+	cpuDirs, err := filepath.Glob(filepath.Join(sysfsRoot, "devices/system/cpu/cpu[0-9]*"))
 	if err != nil {
 		return nil
 	}
 	samples := make([]CPUFreqSample, 0, len(cpuDirs))
-	for _, path := range cpuDirs {
-		// path: /sys/devices/system/cpu/cpu0/cpufreq/scaling_cur_freq
-		parts := strings.Split(path, "/")
-		// parts[5] = "cpu0"
-		if len(parts) < 6 {
-			continue
-		}
-		cpuName := parts[5]
-		id, err := strconv.Atoi(cpuName[3:])
+	for _, dir := range cpuDirs {
+		id, err := strconv.Atoi(filepath.Base(dir)[3:])
 		if err != nil {
 			continue
 		}
-		freq, _ := readIntFile(path)
+		freq, _ := readIntFile(filepath.Join(dir, "cpufreq", "scaling_cur_freq"))
 		if freq == 0 {
 			continue
 		}
@@ -230,9 +390,45 @@ func (pc *ProcessCollector) collectFreqs(now int64) []CPUFreqSample {
 	return samples
 }
 
+// collectCPUInfoFreqs reads each processor's "cpu MHz" line from
+// /proc/cpuinfo. Processors without one (most ARM kernels) are skipped.
+func (pc *ProcessCollector) collectCPUInfoFreqs(now int64) []CPUFreqSample {
+	data, err := os.ReadFile(filepath.Join(procRoot, "cpuinfo"))
+	if err != nil {
+		return nil
+	}
+	var samples []CPUFreqSample
+	id := -1
+	for line := range strings.Lines(string(data)) {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "processor":
+			if id, err = strconv.Atoi(value); err != nil {
+				id = -1
+			}
+		case "cpu MHz":
+			mhz, err := strconv.ParseFloat(value, 64)
+			if id < 0 || err != nil || mhz <= 0 {
+				continue
+			}
+			samples = append(samples, CPUFreqSample{
+				Timestamp: now,
+				CPUID:     id,
+				FreqKHz:   int64(mhz*1000 + 0.5),
+				IsPCore:   pc.cpuTopology[id],
+			})
+		}
+	}
+	return samples
+}
+
 // readProcStat parses /proc/[pid]/stat for comm, utime, stime, and processor.
 func readProcStat(pid int) (procEntry, error) {
-	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
 	if err != nil {
 		return procEntry{}, err
 	}
@@ -249,6 +445,7 @@ func readProcStat(pid int) (procEntry, error) {
 	fields := strings.Fields(string(data[end+2:]))
 	// utime = field index 13 (0-based from pid), but after comm it's index 11
 	// stime = field index 14 -> index 12
+	// starttime = field index 21 -> index 19
 	// processor = field index 38 -> index 36
 	if len(fields) < 37 {
 		return procEntry{}, fmt.Errorf("too few fields for pid %d", pid)
@@ -256,19 +453,21 @@ func readProcStat(pid int) (procEntry, error) {
 
 	utime, _ := strconv.ParseInt(fields[11], 10, 64)
 	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	startTime, _ := strconv.ParseInt(fields[19], 10, 64)
 	cpu, _ := strconv.Atoi(fields[36])
 
 	return procEntry{
-		pid:   pid,
-		comm:  comm,
-		ticks: utime + stime,
-		cpu:   cpu,
+		pid:       pid,
+		comm:      comm,
+		ticks:     utime + stime,
+		startTime: startTime,
+		cpu:       cpu,
 	}, nil
 }
 
 // readCmdline reads /proc/[pid]/cmdline, replacing null bytes with spaces.
 func readCmdline(pid int) string {
-	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "cmdline"))
 	if err != nil || len(data) == 0 {
 		return ""
 	}
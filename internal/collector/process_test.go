@@ -0,0 +1,493 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func setTestProcRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	oldRoot := procRoot
+	procRoot = root
+	t.Cleanup(func() {
+		procRoot = oldRoot
+	})
+
+	return root
+}
+
+// procStat describes the /proc/<pid>/stat fields the collector reads.
+type procStat struct {
+	comm         string
+	utime, stime int64
+	startTime    int64
+	cpu          int
+}
+
+// writeProcStat writes a /proc/<pid>/stat line with the given fields and
+// zeros everywhere else.
+func writeProcStat(t *testing.T, pid int, s procStat) {
+	t.Helper()
+
+	// Fields after "(comm)", starting with state.
+	fields := make([]string, 50)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = "S"
+	fields[11] = strconv.FormatInt(s.utime, 10)
+	fields[12] = strconv.FormatInt(s.stime, 10)
+	fields[19] = strconv.FormatInt(s.startTime, 10)
+	fields[36] = strconv.Itoa(s.cpu)
+	line := fmt.Sprintf("%d (%s) %s\n", pid, s.comm, strings.Join(fields, " "))
+	writeTestFile(t, filepath.Join(procRoot, strconv.Itoa(pid), "stat"), line)
+}
+
+// writeProcSnapshot replaces the fixture /proc with one cycle's processes.
+func writeProcSnapshot(t *testing.T, procs map[int]procStat) {
+	t.Helper()
+
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		t.Fatalf("read proc root: %v", err)
+	}
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(procRoot, e.Name())); err != nil {
+			t.Fatalf("clear proc root: %v", err)
+		}
+	}
+	for pid, s := range procs {
+		writeProcStat(t, pid, s)
+	}
+}
+
+// writeCPUFixture creates sysfs cpu directories with the given base and
+// current frequencies, indexed by CPU id.
+func writeCPUFixture(t *testing.T, baseKHz, curKHz []int64) {
+	t.Helper()
+
+	for id := range baseKHz {
+		dir := filepath.Join(sysfsRoot, "devices/system/cpu", fmt.Sprintf("cpu%d", id), "cpufreq")
+		writeTestFile(t, filepath.Join(dir, "base_frequency"), fmt.Sprintf("%d\n", baseKHz[id]))
+		writeTestFile(t, filepath.Join(dir, "scaling_cur_freq"), fmt.Sprintf("%d\n", curKHz[id]))
+	}
+}
+
+func TestProcessCollector_TickDeltasAcrossCycles(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	writeCPUFixture(t, []int64{3000000, 3000000, 2000000, 2000000}, []int64{2800000, 1200000, 1500000, 900000})
+	pc := NewProcessCollector(2, 1)
+
+	writeProcSnapshot(t, map[int]procStat{
+		1:   {comm: "init", utime: 100, stime: 50, cpu: 0},
+		200: {comm: "Web Content", utime: 1000, stime: 100, cpu: 1},
+		300: {comm: "kworker/0:1", utime: 0, stime: 400, cpu: 2},
+		400: {comm: "idle (sleeper)", utime: 5, stime: 5, cpu: 3},
+		500: {comm: "exits", utime: 70, stime: 0, cpu: 0},
+	})
+	writeTestFile(t, filepath.Join(procRoot, "200", "cmdline"), "firefox\x00-contentproc\x00")
+	writeTestFile(t, filepath.Join(procRoot, "self"), "not a pid directory")
+
+	samples, _, stats, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() first cycle error = %v", err)
+	}
+	if len(samples) != 0 || stats.TotalTicks != 0 || stats.TotalProcs != 0 {
+		t.Fatalf("first cycle = %d samples, stats %#v; want no deltas yet", len(samples), stats)
+	}
+
+	writeProcSnapshot(t, map[int]procStat{
+		1:   {comm: "init", utime: 101, stime: 50, cpu: 0},          // +1
+		200: {comm: "Web Content", utime: 1250, stime: 150, cpu: 1}, // +300
+		300: {comm: "kworker/0:1", utime: 0, stime: 500, cpu: 2},    // +100
+		400: {comm: "idle (sleeper)", utime: 5, stime: 5, cpu: 3},   // unchanged
+		600: {comm: "newcomer", utime: 9000, stime: 0, cpu: 3},      // first seen
+	})
+	writeTestFile(t, filepath.Join(procRoot, "200", "cmdline"), "firefox\x00-contentproc\x00")
+
+	samples, freqs, stats, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() second cycle error = %v", err)
+	}
+
+	type got struct {
+		pid     int
+		comm    string
+		cmdline string
+		delta   int64
+		cpu     int
+	}
+	var gotSamples []got
+	for _, s := range samples {
+		gotSamples = append(gotSamples, got{s.PID, s.Comm, s.Cmdline, s.CPUTicksDelta, s.LastCPU})
+		if s.Timestamp != stats.Timestamp {
+			t.Fatalf("sample timestamp = %d, want cycle timestamp %d", s.Timestamp, stats.Timestamp)
+		}
+	}
+	wantSamples := []got{
+		{200, "Web Content", "firefox -contentproc", 300, 1},
+		{300, "kworker/0:1", "", 100, 2},
+	}
+	if !reflect.DeepEqual(gotSamples, wantSamples) {
+		t.Fatalf("top-N samples = %#v, want %#v", gotSamples, wantSamples)
+	}
+
+	if stats.TotalProcs != 3 || stats.TotalTicks != 401 || stats.CapturedTicks != 400 {
+		t.Fatalf("stats = procs %d, total %d, captured %d; want 3, 401, 400",
+			stats.TotalProcs, stats.TotalTicks, stats.CapturedTicks)
+	}
+	wantPerCore := map[int]int64{0: 1, 1: 300, 2: 100}
+	if !reflect.DeepEqual(stats.PerCoreTicks, wantPerCore) {
+		t.Fatalf("PerCoreTicks = %#v, want %#v", stats.PerCoreTicks, wantPerCore)
+	}
+
+	wantFreqs := []CPUFreqSample{
+		{Timestamp: stats.Timestamp, CPUID: 0, FreqKHz: 2800000, IsPCore: true},
+		{Timestamp: stats.Timestamp, CPUID: 1, FreqKHz: 1200000, IsPCore: true},
+		{Timestamp: stats.Timestamp, CPUID: 2, FreqKHz: 1500000, IsPCore: false},
+		{Timestamp: stats.Timestamp, CPUID: 3, FreqKHz: 900000, IsPCore: false},
+	}
+	if !reflect.DeepEqual(freqs, wantFreqs) {
+		t.Fatalf("freqs = %#v, want %#v", freqs, wantFreqs)
+	}
+}
+
+func TestProcessCollector_SkipsCounterDecrease(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	pc := NewProcessCollector(10, 1)
+
+	writeProcSnapshot(t, map[int]procStat{42: {comm: "a", utime: 500, cpu: 0}})
+	if _, _, _, err := pc.Collect(); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	writeProcSnapshot(t, map[int]procStat{42: {comm: "a", utime: 10, cpu: 0}})
+	samples, _, stats, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 0 || stats.TotalTicks != 0 {
+		t.Fatalf("Collect() = %#v, total %d; want decreasing counter ignored", samples, stats.TotalTicks)
+	}
+
+	// The lower counter becomes the new baseline.
+	writeProcSnapshot(t, map[int]procStat{42: {comm: "a", utime: 25, cpu: 0}})
+	samples, _, _, err = pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].CPUTicksDelta != 15 {
+		t.Fatalf("Collect() = %#v, want one sample with delta 15", samples)
+	}
+}
+
+func TestProcessCollector_ResetStartsNewBaseline(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	pc := NewProcessCollector(10, 1)
+
+	writeProcSnapshot(t, map[int]procStat{42: {comm: "a", utime: 100, cpu: 0}})
+	if _, _, _, err := pc.Collect(); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+
+	// Collection pauses; the process keeps running meanwhile.
+	pc.Reset()
+	writeProcSnapshot(t, map[int]procStat{42: {comm: "a", utime: 9000, cpu: 0}})
+	samples, _, stats, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 0 || stats.TotalTicks != 0 {
+		t.Fatalf("Collect() after Reset = %#v, total %d; want a baseline only", samples, stats.TotalTicks)
+	}
+
+	writeProcSnapshot(t, map[int]procStat{42: {comm: "a", utime: 9020, cpu: 0}})
+	samples, _, _, err = pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].CPUTicksDelta != 20 {
+		t.Fatalf("Collect() = %#v, want one sample with delta 20", samples)
+	}
+}
+
+func TestProcessCollector_PidReuse(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	pc := NewProcessCollector(10, 1)
+
+	writeProcSnapshot(t, map[int]procStat{77: {comm: "old", utime: 100, startTime: 1000, cpu: 0}})
+	writeTestFile(t, filepath.Join(procRoot, "77", "cmdline"), "old\x00")
+	if _, _, _, err := pc.Collect(); err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	writeProcSnapshot(t, map[int]procStat{77: {comm: "old", utime: 110, startTime: 1000, cpu: 0}})
+	writeTestFile(t, filepath.Join(procRoot, "77", "cmdline"), "old\x00")
+	samples, _, _, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].Cmdline != "old" {
+		t.Fatalf("Collect() = %#v, want one sample for the old process", samples)
+	}
+
+	// The old process exits and a new one gets pid 77 with a higher
+	// counter, which would otherwise be charged as a bogus +400 delta.
+	writeProcSnapshot(t, map[int]procStat{77: {comm: "new", utime: 500, startTime: 5000, cpu: 1}})
+	writeTestFile(t, filepath.Join(procRoot, "77", "cmdline"), "new\x00")
+	samples, _, stats, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 0 || stats.TotalTicks != 0 {
+		t.Fatalf("Collect() after pid reuse = %#v, total %d; want no delta", samples, stats.TotalTicks)
+	}
+
+	writeProcSnapshot(t, map[int]procStat{77: {comm: "new", utime: 530, startTime: 5000, cpu: 1}})
+	writeTestFile(t, filepath.Join(procRoot, "77", "cmdline"), "new\x00")
+	samples, _, _, err = pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(samples) != 1 || samples[0].CPUTicksDelta != 30 || samples[0].Cmdline != "new" {
+		t.Fatalf("Collect() = %#v, want new process with delta 30 and fresh cmdline", samples)
+	}
+}
+
+func TestProcessCollector_TracksLifetimes(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	writeTestFile(t, filepath.Join(procRoot, "stat"), "cpu  1 2 3 4\nbtime 1700000000\n")
+	pc := NewProcessCollector(1, 1)
+
+	cycle := func(procs map[int]procStat) *ProcessCollectStats {
+		t.Helper()
+		writeProcSnapshot(t, procs)
+		_, _, stats, err := pc.Collect()
+		if err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		return stats
+	}
+
+	cycle(map[int]procStat{
+		10: {comm: "steady", utime: 100, startTime: 500},
+		20: {comm: "spike", utime: 0, startTime: 700},
+	})
+	stats := cycle(map[int]procStat{
+		10: {comm: "steady", utime: 150, startTime: 500},
+		20: {comm: "spike", utime: 10, startTime: 700},
+	})
+	first := stats.Timestamp
+	// Only the top process becomes a sample, but every active one gets a
+	// lifetime.
+	want := []ProcessLifetime{
+		{PID: 10, StartTime: 1700000005, Comm: "steady", FirstSeen: first, LastSeen: first},
+		{PID: 20, StartTime: 1700000007, Comm: "spike", FirstSeen: first, LastSeen: first},
+	}
+	if !reflect.DeepEqual(stats.Lifetimes, want) {
+		t.Fatalf("Lifetimes = %+v, want %+v", stats.Lifetimes, want)
+	}
+
+	// The spike goes quiet; its lifetime is not extended.
+	stats = cycle(map[int]procStat{
+		10: {comm: "steady", utime: 160, startTime: 500},
+		20: {comm: "spike", utime: 10, startTime: 700},
+	})
+	want = []ProcessLifetime{{PID: 10, StartTime: 1700000005, Comm: "steady", FirstSeen: first, LastSeen: stats.Timestamp}}
+	if !reflect.DeepEqual(stats.Lifetimes, want) {
+		t.Fatalf("Lifetimes = %+v, want %+v", stats.Lifetimes, want)
+	}
+
+	// Pid 10 exits and is reused: the new process starts a new lifetime.
+	cycle(map[int]procStat{10: {comm: "reused", utime: 0, startTime: 900}})
+	stats = cycle(map[int]procStat{10: {comm: "reused", utime: 5, startTime: 900}})
+	want = []ProcessLifetime{{PID: 10, StartTime: 1700000009, Comm: "reused", FirstSeen: stats.Timestamp, LastSeen: stats.Timestamp}}
+	if !reflect.DeepEqual(stats.Lifetimes, want) {
+		t.Fatalf("Lifetimes after pid reuse = %+v, want %+v", stats.Lifetimes, want)
+	}
+	if len(pc.lifetimes) != 1 {
+		t.Fatalf("tracked lifetimes = %d, want 1 after the others exited", len(pc.lifetimes))
+	}
+}
+
+func TestProcessCollector_DetectsHybridTopology(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseKHz []int64
+		want    map[int]bool
+	}{
+		{"hybrid", []int64{4000000, 4000000, 2500000}, map[int]bool{0: true, 1: true, 2: false}},
+		{"uniform", []int64{3000000, 3000000}, map[int]bool{0: true, 1: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestSysfsRoot(t)
+			writeCPUFixture(t, tt.baseKHz, make([]int64, len(tt.baseKHz)))
+
+			pc := NewProcessCollector(10, 1)
+			if got := pc.CPUIDs(); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("CPUIDs() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessCollector_CPUInfoFreqFallback(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	// A VM-style layout: CPU directories without cpufreq.
+	for id := range 2 {
+		writeTestFile(t, filepath.Join(sysfsRoot, "devices/system/cpu", fmt.Sprintf("cpu%d", id), "online"), "1\n")
+	}
+	writeTestFile(t, filepath.Join(procRoot, "cpuinfo"),
+		"processor\t: 0\nmodel name\t: QEMU Virtual CPU\ncpu MHz\t\t: 2399.998\n\n"+
+			"processor\t: 1\nmodel name\t: QEMU Virtual CPU\ncpu MHz\t\t: 1200.000\n\n")
+
+	pc := NewProcessCollector(10, 1)
+	if !pc.UsesCPUInfoFreqs() {
+		t.Fatal("UsesCPUInfoFreqs() = false without sysfs cpufreq")
+	}
+	if got, want := pc.CPUIDs(), map[int]bool{0: true, 1: true}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("CPUIDs() = %#v, want %#v", got, want)
+	}
+	_, freqs, _, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	for i := range freqs {
+		freqs[i].Timestamp = 0
+	}
+	want := []CPUFreqSample{
+		{CPUID: 0, FreqKHz: 2399998, IsPCore: true},
+		{CPUID: 1, FreqKHz: 1200000, IsPCore: true},
+	}
+	if !reflect.DeepEqual(freqs, want) {
+		t.Fatalf("Collect() freqs = %#v, want %#v", freqs, want)
+	}
+}
+
+func TestProcessCollector_PrefersSysfsCPUFreq(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+	writeCPUFixture(t, []int64{3000000}, []int64{2800000})
+	writeTestFile(t, filepath.Join(procRoot, "cpuinfo"), "processor\t: 0\ncpu MHz\t\t: 800.000\n")
+
+	pc := NewProcessCollector(10, 1)
+	if pc.UsesCPUInfoFreqs() {
+		t.Fatal("UsesCPUInfoFreqs() = true with sysfs cpufreq present")
+	}
+	_, freqs, _, err := pc.Collect()
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(freqs) != 1 || freqs[0].FreqKHz != 2800000 {
+		t.Fatalf("Collect() freqs = %#v, want one sample at 2800000 kHz", freqs)
+	}
+}
+
+func TestReadProcStat_Malformed(t *testing.T) {
+	setTestProcRoot(t)
+	writeTestFile(t, filepath.Join(procRoot, "7", "stat"), "7 (short) S 1 2 3\n")
+
+	if _, err := readProcStat(7); err == nil {
+		t.Fatal("readProcStat(too few fields) error = nil, want error")
+	}
+	if _, err := readProcStat(8); err == nil {
+		t.Fatal("readProcStat(missing) error = nil, want error")
+	}
+}
+
+// writeSyntheticProc fills the fixture /proc with n processes. Ticks repeat
+// every 7 pids so the top-N selection has to break ties.
+func writeSyntheticProc(t testing.TB, n int, cycle int64) {
+	t.Helper()
+
+	for pid := 1; pid <= n; pid++ {
+		fields := make([]string, 50)
+		for i := range fields {
+			fields[i] = "0"
+		}
+		fields[0] = "S"
+		fields[11] = strconv.FormatInt(cycle*int64(pid%7+1), 10)
+		fields[19] = strconv.Itoa(pid)
+		fields[36] = strconv.Itoa(pid % 4)
+		path := filepath.Join(procRoot, strconv.Itoa(pid), "stat")
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir %s: %v", filepath.Dir(path), err)
+		}
+		line := fmt.Sprintf("%d (proc-%d) %s\n", pid, pid, strings.Join(fields, " "))
+		if err := os.WriteFile(path, []byte(line), 0o644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+	}
+}
+
+func TestProcessCollector_ConcurrentScanMatchesSerial(t *testing.T) {
+	setTestSysfsRoot(t)
+	setTestProcRoot(t)
+
+	collect := func(workers int) ([]ProcessSample, *ProcessCollectStats) {
+		writeSyntheticProc(t, 200, 1)
+		pc := NewProcessCollector(15, workers)
+		if _, _, _, err := pc.Collect(); err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		writeSyntheticProc(t, 200, 2)
+		samples, _, stats, err := pc.Collect()
+		if err != nil {
+			t.Fatalf("Collect() error = %v", err)
+		}
+		for i := range samples {
+			samples[i].Timestamp = 0
+		}
+		stats.Timestamp = 0
+		for i := range stats.Lifetimes {
+			stats.Lifetimes[i].FirstSeen, stats.Lifetimes[i].LastSeen = 0, 0
+		}
+		return samples, stats
+	}
+
+	wantSamples, wantStats := collect(1)
+	if len(wantSamples) != 15 {
+		t.Fatalf("serial Collect() len = %d, want 15", len(wantSamples))
+	}
+	for _, workers := range []int{2, 8, 500} {
+		gotSamples, gotStats := collect(workers)
+		if !reflect.DeepEqual(gotSamples, wantSamples) {
+			t.Fatalf("workers=%d samples = %#v, want serial result %#v", workers, gotSamples, wantSamples)
+		}
+		if !reflect.DeepEqual(gotStats, wantStats) {
+			t.Fatalf("workers=%d stats = %#v, want serial result %#v", workers, gotStats, wantStats)
+		}
+	}
+}
+
+func benchmarkProcScan(b *testing.B, workers int) {
+	root := b.TempDir()
+	oldProc, oldSys := procRoot, sysfsRoot
+	procRoot, sysfsRoot = root, b.TempDir()
+	b.Cleanup(func() { procRoot, sysfsRoot = oldProc, oldSys })
+
+	writeSyntheticProc(b, 2000, 1)
+	pc := NewProcessCollector(10, workers)
+	b.ResetTimer()
+	for range b.N {
+		if _, _, _, err := pc.Collect(); err != nil {
+			b.Fatalf("Collect() error = %v", err)
+		}
+	}
+}
+
+func BenchmarkProcessCollect_Serial(b *testing.B)   { benchmarkProcScan(b, 1) }
+func BenchmarkProcessCollect_4Workers(b *testing.B) { benchmarkProcScan(b, 4) }
+func BenchmarkProcessCollect_8Workers(b *testing.B) { benchmarkProcScan(b, 8) }
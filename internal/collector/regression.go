@@ -0,0 +1,207 @@
+package collector
+
+import "sort"
+
+const (
+	// RegressionBaselineSeconds is how far back the rolling baseline reaches.
+	RegressionBaselineSeconds = 7 * 86400
+	// regressionBucketSeconds of quiet cycles are averaged into one baseline
+	// bucket; the baseline is the median bucket.
+	regressionBucketSeconds = 600
+	// regressionMinBuckets is how much quiet history a brightness band needs
+	// before it is compared against.
+	regressionMinBuckets = 6
+	// regressionMinIncreaseUW is the smallest increase ever reported, so a
+	// percentage of a very low idle draw does not flag noise.
+	regressionMinIncreaseUW = 500_000
+)
+
+// RegressionObservation is one collection cycle as seen by a
+// RegressionDetector.
+type RegressionObservation struct {
+	Timestamp     int64
+	PowerUW       int64
+	BrightnessPct float64 // negative if unknown
+	Discharging   bool
+	Quiet         bool // the user is idle, or failing that the CPU is
+}
+
+// RegressionDetector watches battery power during quiet, discharging cycles
+// for a sustained rise over its usual level. Quiet cycles are averaged into
+// regressionBucketSeconds buckets kept per 10% brightness band for
+// RegressionBaselineSeconds, and the band's median bucket is the baseline. When
+// the mean of an unbroken quiet run at one band over the last sustainSecs
+// exceeds that baseline by thresholdPct (and regressionMinIncreaseUW), a
+// regression is raised; a later sustained window back within the threshold
+// clears it.
+type RegressionDetector struct {
+	thresholdPct int64
+	sustainSecs  int64
+	maxGap       int64
+
+	history map[int][]regressionBucket // brightness band -> buckets, oldest first
+
+	// The current quiet run at one band.
+	band     int
+	lastObs  int64
+	runStart int64
+	window   []regressionPoint // cycles in the last sustainSecs
+	bucket   regressionBucket  // bucket being filled
+
+	active *PowerRegression // raised and not yet cleared
+}
+
+type regressionBucket struct {
+	start, end int64
+	sum        float64 // power in µW, summed over n cycles
+	n          int
+}
+
+type regressionPoint struct {
+	ts      int64
+	powerUW int64
+}
+
+// NewRegressionDetector creates a RegressionDetector for observations about
+// intervalSec apart.
+func NewRegressionDetector(thresholdPct, sustainSecs, intervalSec int64) *RegressionDetector {
+	return &RegressionDetector{
+		thresholdPct: thresholdPct,
+		sustainSecs:  sustainSecs,
+		maxGap:       2 * max(intervalSec, 1),
+		history:      make(map[int][]regressionBucket),
+	}
+}
+
+// SetInterval updates the expected spacing of observations after the
+// collection interval changed.
+func (d *RegressionDetector) SetInterval(intervalSec int64) {
+	d.maxGap = 2 * max(intervalSec, 1)
+}
+
+// Active returns the regression currently raised, or nil.
+func (d *RegressionDetector) Active() *PowerRegression {
+	if d.active == nil {
+		return nil
+	}
+	r := *d.active
+	return &r
+}
+
+// Observe feeds one cycle. It returns a PowerRegression when one is raised,
+// and the same report with Active false when it clears.
+func (d *RegressionDetector) Observe(obs RegressionObservation) *PowerRegression {
+	band := brightnessBand(obs.BrightnessPct)
+	if !obs.Quiet || !obs.Discharging || obs.PowerUW <= 0 {
+		d.endRun()
+		return nil
+	}
+	if d.runStart == 0 || band != d.band || obs.Timestamp-d.lastObs > d.maxGap || obs.Timestamp <= d.lastObs {
+		d.endRun()
+		d.band = band
+		d.runStart = obs.Timestamp
+		d.bucket = regressionBucket{start: obs.Timestamp}
+	}
+	d.lastObs = obs.Timestamp
+
+	d.bucket.sum += float64(obs.PowerUW)
+	d.bucket.n++
+	d.bucket.end = obs.Timestamp
+	if d.bucket.end-d.bucket.start >= regressionBucketSeconds {
+		d.addBucket(d.bucket)
+		d.bucket = regressionBucket{start: obs.Timestamp}
+	}
+
+	d.window = append(d.window, regressionPoint{obs.Timestamp, obs.PowerUW})
+	cut := 0
+	for cut < len(d.window) && d.window[cut].ts < obs.Timestamp-d.sustainSecs {
+		cut++
+	}
+	d.window = d.window[cut:]
+	if obs.Timestamp-d.runStart < d.sustainSecs {
+		return nil
+	}
+	return d.evaluate(obs.Timestamp)
+}
+
+// evaluate compares the sustained window against the baseline built before
+// the current run began.
+func (d *RegressionDetector) evaluate(now int64) *PowerRegression {
+	baseline, ok := d.baseline(d.band, d.runStart)
+	if !ok {
+		return nil
+	}
+	var sum float64
+	for _, p := range d.window {
+		sum += float64(p.powerUW)
+	}
+	mean := int64(sum / float64(len(d.window)))
+	limit := max(baseline*(100+d.thresholdPct)/100, baseline+regressionMinIncreaseUW)
+
+	switch {
+	case d.active == nil && mean > limit:
+		d.active = &PowerRegression{
+			Active:        true,
+			StartTime:     d.window[0].ts,
+			DetectedAt:    now,
+			BaselineUW:    baseline,
+			PowerUW:       mean,
+			BrightnessPct: d.band * 10,
+		}
+		if d.band < 0 {
+			d.active.BrightnessPct = -1
+		}
+		return d.Active()
+	case d.active != nil && mean <= limit:
+		cleared := *d.active
+		cleared.Active = false
+		cleared.DetectedAt = now
+		cleared.BaselineUW = baseline
+		cleared.PowerUW = mean
+		d.active = nil
+		return &cleared
+	}
+	return nil
+}
+
+// baseline returns the median of band's buckets that ended before the given
+// time.
+func (d *RegressionDetector) baseline(band int, before int64) (int64, bool) {
+	var means []float64
+	for _, b := range d.history[band] {
+		if b.end < before {
+			means = append(means, b.sum/float64(b.n))
+		}
+	}
+	if len(means) < regressionMinBuckets {
+		return 0, false
+	}
+	sort.Float64s(means)
+	return int64(means[len(means)/2]), true
+}
+
+func (d *RegressionDetector) addBucket(b regressionBucket) {
+	h := append(d.history[d.band], b)
+	cut := 0
+	for cut < len(h) && h[cut].end < b.end-RegressionBaselineSeconds {
+		cut++
+	}
+	d.history[d.band] = h[cut:]
+}
+
+// endRun closes the current quiet run. A partial bucket is dropped so every
+// bucket averages a comparable stretch.
+func (d *RegressionDetector) endRun() {
+	d.runStart = 0
+	d.window = d.window[:0]
+	d.bucket = regressionBucket{}
+}
+
+// brightnessBand groups brightness into 10% bands so baselines are only
+// compared at similar screen power; -1 holds cycles with no reading.
+func brightnessBand(pct float64) int {
+	if pct < 0 {
+		return -1
+	}
+	return min(int(pct/10), 10)
+}
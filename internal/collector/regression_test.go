@@ -0,0 +1,80 @@
+package collector
+
+import "testing"
+
+// feedRegression observes quiet, discharging cycles every 10s from start for
+// secs at the given power and brightness, returning the reports raised.
+func feedRegression(d *RegressionDetector, start, secs, powerUW int64, brightnessPct float64) []PowerRegression {
+	var out []PowerRegression
+	for ts := start; ts < start+secs; ts += 10 {
+		if r := d.Observe(RegressionObservation{Timestamp: ts, PowerUW: powerUW, BrightnessPct: brightnessPct, Discharging: true, Quiet: true}); r != nil {
+			out = append(out, *r)
+		}
+	}
+	return out
+}
+
+func TestRegressionDetector_RaisesAndClears(t *testing.T) {
+	d := NewRegressionDetector(25, 1800, 10)
+
+	// Two hours of quiet history at 4 W build the baseline.
+	if got := feedRegression(d, 1000, 7200, 4_000_000, 50); len(got) != 0 {
+		t.Fatalf("baseline run raised %+v", got)
+	}
+	// A busy stretch ends the run.
+	d.Observe(RegressionObservation{Timestamp: 8200, PowerUW: 15_000_000, BrightnessPct: 50, Discharging: true})
+
+	// Idle power jumps to 6 W: raised once the window is sustained.
+	got := feedRegression(d, 8210, 3600, 6_000_000, 50)
+	if len(got) != 1 || !got[0].Active {
+		t.Fatalf("reports = %+v, want one raised regression", got)
+	}
+	if r := got[0]; r.BaselineUW != 4_000_000 || r.PowerUW != 6_000_000 || r.BrightnessPct != 50 || r.DetectedAt != 8210+1800 {
+		t.Fatalf("regression = %+v, want 4 W -> 6 W at 50%% detected at %d", r, 8210+1800)
+	}
+	if d.Active() == nil {
+		t.Fatal("Active() = nil while raised")
+	}
+
+	// Back to normal in a new run: cleared.
+	d.Observe(RegressionObservation{Timestamp: 11900, PowerUW: 15_000_000, BrightnessPct: 50, Discharging: true})
+	got = feedRegression(d, 11910, 1810, 4_100_000, 50)
+	if len(got) != 1 || got[0].Active {
+		t.Fatalf("reports = %+v, want one cleared regression", got)
+	}
+	if d.Active() != nil {
+		t.Fatalf("Active() = %+v after clearing", d.Active())
+	}
+}
+
+func TestRegressionDetector_IgnoresOtherBrightnessAndSmallRises(t *testing.T) {
+	d := NewRegressionDetector(25, 1800, 10)
+	feedRegression(d, 1000, 7200, 1_000_000, 50)
+
+	// Much higher power at a brightness with no baseline is not compared.
+	d.Observe(RegressionObservation{Timestamp: 8200, Discharging: true})
+	if got := feedRegression(d, 8210, 3600, 3_000_000, 100); len(got) != 0 {
+		t.Fatalf("other brightness raised %+v", got)
+	}
+
+	// +40% of a 1 W draw is below the absolute floor.
+	d.Observe(RegressionObservation{Timestamp: 11900, Discharging: true})
+	if got := feedRegression(d, 11910, 3600, 1_400_000, 50); len(got) != 0 {
+		t.Fatalf("small rise raised %+v", got)
+	}
+}
+
+func TestRegressionDetector_NeedsSustainedQuietRun(t *testing.T) {
+	d := NewRegressionDetector(25, 1800, 10)
+	feedRegression(d, 1000, 7200, 4_000_000, 50)
+
+	// High power in quiet runs that keep being interrupted never sustains.
+	ts := int64(8200)
+	for range 10 {
+		d.Observe(RegressionObservation{Timestamp: ts, PowerUW: 4_000_000, BrightnessPct: 50, Discharging: true})
+		if got := feedRegression(d, ts+10, 1200, 8_000_000, 50); len(got) != 0 {
+			t.Fatalf("interrupted runs raised %+v", got)
+		}
+		ts += 1220
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+import "math"
+
+// DefaultPowerEWMASeconds is the EWMA time constant used for the smoothed
+// current power shown to users.
+const DefaultPowerEWMASeconds = 30
+
+// PowerEWMA returns an exponentially weighted moving average of PowerUW over
+// samples in ascending timestamp order. Each sample's weight depends on the
+// time since the previous one (alpha = 1 - exp(-dt/tau)), so irregular spacing
+// such as missed cycles does not skew the result. Samples with a non-positive
+// time step are skipped. Returns 0 for no samples.
+func PowerEWMA(samples []BatterySample, tauSecs float64) int64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	avg := float64(samples[0].PowerUW)
+	prevTs := samples[0].Timestamp
+	for _, s := range samples[1:] {
+		dt := float64(s.Timestamp - prevTs)
+		if dt <= 0 {
+			continue
+		}
+		alpha := 1.0
+		if tauSecs > 0 {
+			alpha = 1 - math.Exp(-dt/tauSecs)
+		}
+		avg += alpha * (float64(s.PowerUW) - avg)
+		prevTs = s.Timestamp
+	}
+	return int64(math.Round(avg))
+}
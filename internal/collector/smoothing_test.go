@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPowerEWMA(t *testing.T) {
+	if got := PowerEWMA(nil, 30); got != 0 {
+		t.Fatalf("PowerEWMA(nil) = %d, want 0", got)
+	}
+
+	constant := []BatterySample{{Timestamp: 0, PowerUW: 5000000}, {Timestamp: 5, PowerUW: 5000000}, {Timestamp: 10, PowerUW: 5000000}}
+	if got := PowerEWMA(constant, 30); got != 5000000 {
+		t.Fatalf("PowerEWMA(constant) = %d, want 5000000", got)
+	}
+
+	// A single step from 4 W to 8 W after one time constant moves the
+	// average 1-1/e of the way.
+	step := []BatterySample{{Timestamp: 0, PowerUW: 4000000}, {Timestamp: 30, PowerUW: 8000000}}
+	want := int64(math.Round(4000000 + (1-math.Exp(-1))*4000000))
+	if got := PowerEWMA(step, 30); got != want {
+		t.Fatalf("PowerEWMA(step) = %d, want %d", got, want)
+	}
+
+	// Zero time constant disables smoothing.
+	if got := PowerEWMA(step, 0); got != 8000000 {
+		t.Fatalf("PowerEWMA(tau=0) = %d, want latest 8000000", got)
+	}
+}
+
+func TestPowerEWMA_DampsJitter(t *testing.T) {
+	var samples []BatterySample
+	for i := 0; i < 20; i++ {
+		p := int64(4000000)
+		if i%2 == 1 {
+			p = 8000000
+		}
+		samples = append(samples, BatterySample{Timestamp: int64(i * 5), PowerUW: p})
+	}
+
+	got := PowerEWMA(samples, 30)
+	if got < 5500000 || got > 6500000 {
+		t.Fatalf("PowerEWMA(alternating 4/8 W) = %d, want within 0.5 W of 6 W", got)
+	}
+}
+
+func TestPowerEWMA_SkipsNonIncreasingTimestamps(t *testing.T) {
+	samples := []BatterySample{{Timestamp: 10, PowerUW: 4000000}, {Timestamp: 10, PowerUW: 100000000}, {Timestamp: 5, PowerUW: 100000000}}
+	if got := PowerEWMA(samples, 30); got != 4000000 {
+		t.Fatalf("PowerEWMA() = %d, want 4000000 (non-increasing samples skipped)", got)
+	}
+}
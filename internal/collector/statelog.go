@@ -2,24 +2,49 @@ package collector
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"log/slog"
+	"math"
 	"os"
+	"path/filepath"
 	"time"
 )
 
 // stateLogEntry is a single line from the state log file written by the systemd hooks.
 type stateLogEntry struct {
 	Ts          int64  `json:"ts"`
-	Action      string `json:"action"`      // "pre" or "post"
+	Action      string `json:"action"`       // "pre" or "post"
 	What        string `json:"what"`         // "suspend", "hibernate", "suspend-then-hibernate", "shutdown", etc.
 	SleepAction string `json:"sleep_action"` // from SYSTEMD_SLEEP_ACTION env var
+	MemSleep    string `json:"mem_sleep"`    // selected /sys/power/mem_sleep mode on "pre": "s2idle", "shallow", "deep"
+	// Uptime is /proc/uptime when the hook ran: CLOCK_BOOTTIME seconds,
+	// which keep counting while asleep but ignore wall-clock changes. 0 in
+	// logs from older hooks.
+	Uptime float64 `json:"uptime"`
 }
 
+// StateLogOptions controls how consumed state logs are handled.
+type StateLogOptions struct {
+	// ArchiveDir keeps a copy of each consumed log for ReplayStateLog; ""
+	// disables archiving.
+	ArchiveDir string
+	// MaxSleepSecs is the longest plausible sleep. Longer events are
+	// clamped to it and marked Suspect; 0 disables the cap.
+	MaxSleepSecs int64
+}
+
+// clockSkewSecs is how far a sleep's wall-clock duration may differ from its
+// boottime duration before the wall clock is assumed to have changed while
+// asleep.
+const clockSkewSecs = 60
+
 // ReadAndConsumeStateLog atomically reads the state log file and removes it,
 // returning reconstructed PowerStateEvents. now is used as the end time for
 // events that have no "post" entry (daemon started after hibernate/shutdown).
-func ReadAndConsumeStateLog(logger *slog.Logger, now time.Time, stateLogPath string) []PowerStateEvent {
+// Events are checked for plausibility with clampSleepEvents, and the consumed
+// contents are archived as opts asks.
+func ReadAndConsumeStateLog(logger *slog.Logger, now time.Time, stateLogPath string, opts StateLogOptions) []PowerStateEvent {
 	processingPath := stateLogPath + ".processing"
 
 	// Atomic rename so the hook creates a fresh file for new entries.
@@ -30,17 +55,64 @@ func ReadAndConsumeStateLog(logger *slog.Logger, now time.Time, stateLogPath str
 		logger.Error("rename failed", "err", err)
 		return nil
 	}
+	defer os.Remove(processingPath)
 
-	f, err := os.Open(processingPath)
+	data, err := os.ReadFile(processingPath)
 	if err != nil {
-		logger.Error("open processing file", "err", err)
+		logger.Error("read state log", "err", err)
 		return nil
 	}
-	defer f.Close()
-	defer os.Remove(processingPath)
+	if opts.ArchiveDir != "" {
+		if path, err := archiveStateLog(opts.ArchiveDir, data, now); err != nil {
+			logger.Error("archive state log", "err", err)
+		} else {
+			logger.Debug("archived state log", "path", path)
+		}
+	}
+
+	entries := parseStateLog(logger, data)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return clampSleepEvents(reconstructEvents(entries, now.Unix()), opts.MaxSleepSecs)
+}
+
+// archiveStateLog writes consumed state log contents to
+// <dir>/state-log-<YYYYMMDDTHHMMSSZ>.jsonl, with the file's mtime set to now
+// so ReplayStateLog can reuse it as the end time of open events.
+func archiveStateLog(dir string, data []byte, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "state-log-"+now.UTC().Format("20060102T150405Z")+".jsonl")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return "", err
+	}
+	return path, os.Chtimes(path, now, now)
+}
+
+// ReplayStateLog reconstructs the events of an archived state log offline,
+// exactly as ReadAndConsumeStateLog did when it consumed it. Open events end
+// at the archive's mtime, which archiveStateLog set to the consume time. The
+// file is left in place; opts.ArchiveDir is ignored.
+func ReplayStateLog(logger *slog.Logger, path string, opts StateLogOptions) ([]PowerStateEvent, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	events := reconstructEvents(parseStateLog(logger, data), info.ModTime().Unix())
+	return clampSleepEvents(events, opts.MaxSleepSecs), nil
+}
 
+// parseStateLog decodes state log lines, skipping malformed ones.
+func parseStateLog(logger *slog.Logger, data []byte) []stateLogEntry {
 	var entries []stateLogEntry
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
 		var e stateLogEntry
 		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
@@ -52,12 +124,7 @@ func ReadAndConsumeStateLog(logger *slog.Logger, now time.Time, stateLogPath str
 	if err := scanner.Err(); err != nil {
 		logger.Error("read state log", "err", err)
 	}
-
-	if len(entries) == 0 {
-		return nil
-	}
-
-	return reconstructEvents(entries, now.Unix())
+	return entries
 }
 
 // reconstructEvents processes ordered state log entries into PowerStateEvents.
@@ -86,26 +153,34 @@ func reconstructEvents(entries []stateLogEntry, nowUnix int64) []PowerStateEvent
 
 		if e.What == "suspend-then-hibernate" {
 			event, consumed := reconstructSuspendThenHibernate(entries[i:], nowUnix)
+			event.Subtype = e.MemSleep
 			events = append(events, event)
 			i += consumed
 			continue
 		}
 
-		// Simple suspend or hibernate.
+		// Simple suspend or hibernate. Hybrid sleep writes a hibernation
+		// image and then suspends, so the time counts as suspended; it
+		// keeps its own type whatever SYSTEMD_SLEEP_ACTION says.
 		sleepAction := e.SleepAction
-		if sleepAction == "" {
+		if sleepAction == "" || e.What == "hybrid-sleep" {
 			sleepAction = e.What
 		}
+		// The mem_sleep mode only describes the suspend-to-RAM part.
+		subtype := e.MemSleep
+		if sleepAction == "hibernate" {
+			subtype = ""
+		}
 
 		// Look for matching post.
 		if i+1 < len(entries) && entries[i+1].Action == "post" {
-			post := entries[i+1]
+			duration := sleepSpan(e, entries[i+1])
 			evt := PowerStateEvent{
 				StartTime: e.Ts,
-				EndTime:   post.Ts,
+				EndTime:   e.Ts + duration,
 				Type:      sleepAction,
+				Subtype:   subtype,
 			}
-			duration := post.Ts - e.Ts
 			if sleepAction == "hibernate" {
 				evt.HibernateSecs = duration
 			} else {
@@ -119,6 +194,7 @@ func reconstructEvents(entries []stateLogEntry, nowUnix int64) []PowerStateEvent
 				StartTime: e.Ts,
 				EndTime:   nowUnix,
 				Type:      sleepAction,
+				Subtype:   subtype,
 			}
 			duration := nowUnix - e.Ts
 			if sleepAction == "hibernate" {
@@ -149,25 +225,28 @@ func reconstructSuspendThenHibernate(entries []stateLogEntry, nowUnix int64) (Po
 	// Check for post suspend (woke from suspend for hibernate transition).
 	if consumed < len(entries) && entries[consumed].Action == "post" && entries[consumed].SleepAction == "suspend" {
 		postSuspendTs := entries[consumed].Ts
+		suspendSecs := sleepSpan(entries[0], entries[consumed])
 		consumed++
-
-		suspendSecs := postSuspendTs - preTs
+		// Where the suspend phase ended, by the boottime clock when the
+		// wall clock changed during it.
+		suspendEnd := preTs + suspendSecs
 
 		// Check for pre hibernate.
 		if consumed < len(entries) && entries[consumed].Action == "pre" && entries[consumed].SleepAction == "hibernate" {
-			preHibTs := entries[consumed].Ts
+			preHib := entries[consumed]
+			preHibTs := preHib.Ts
 			consumed++
 
 			// Check for post hibernate.
 			if consumed < len(entries) && entries[consumed].Action == "post" && entries[consumed].SleepAction == "hibernate" {
-				postHibTs := entries[consumed].Ts
+				hibernateSecs := sleepSpan(preHib, entries[consumed])
 				consumed++
 				return PowerStateEvent{
 					StartTime:     preTs,
-					EndTime:       postHibTs,
+					EndTime:       suspendEnd + (preHibTs - postSuspendTs) + hibernateSecs,
 					Type:          "suspend-then-hibernate",
 					SuspendSecs:   suspendSecs,
-					HibernateSecs: postHibTs - preHibTs,
+					HibernateSecs: hibernateSecs,
 				}, consumed
 			}
 
@@ -184,7 +263,7 @@ func reconstructSuspendThenHibernate(entries []stateLogEntry, nowUnix int64) (Po
 		// Only suspend phase completed (user woke before hibernate timer).
 		return PowerStateEvent{
 			StartTime:   preTs,
-			EndTime:     postSuspendTs,
+			EndTime:     suspendEnd,
 			Type:        "suspend",
 			SuspendSecs: suspendSecs,
 		}, consumed
@@ -198,3 +277,43 @@ func reconstructSuspendThenHibernate(entries []stateLogEntry, nowUnix int64) (Po
 		SuspendSecs: nowUnix - preTs,
 	}, consumed
 }
+
+// sleepSpan returns the seconds between a pre and its post hook entry. When
+// both logged their uptime in the same boot and it disagrees with the wall
+// clock by more than clockSkewSecs, the clock was changed while asleep (or by
+// NTP on wake) and the boottime difference is used instead.
+func sleepSpan(pre, post stateLogEntry) int64 {
+	wall := post.Ts - pre.Ts
+	if pre.Uptime > 0 && post.Uptime >= pre.Uptime {
+		boot := int64(math.Round(post.Uptime - pre.Uptime))
+		if d := boot - wall; d > clockSkewSecs || d < -clockSkewSecs {
+			return boot
+		}
+	}
+	return wall
+}
+
+// clampSleepEvents guards against implausible durations from a wall clock
+// that moved while asleep without uptime to correct it, or an orphaned pre
+// ended at a far-off now. Events running backwards are collapsed to their
+// start, and sleeps longer than maxSecs (if positive) are cut to it; both are
+// marked Suspect. Shutdowns are only checked for running backwards, since a
+// machine can legitimately stay off for months.
+func clampSleepEvents(events []PowerStateEvent, maxSecs int64) []PowerStateEvent {
+	for i := range events {
+		e := &events[i]
+		if e.EndTime < e.StartTime || e.SuspendSecs < 0 || e.HibernateSecs < 0 {
+			e.EndTime = max(e.EndTime, e.StartTime)
+			e.SuspendSecs = max(e.SuspendSecs, 0)
+			e.HibernateSecs = max(e.HibernateSecs, 0)
+			e.Suspect = true
+		}
+		if maxSecs > 0 && e.Type != "shutdown" && e.EndTime-e.StartTime > maxSecs {
+			e.EndTime = e.StartTime + maxSecs
+			e.SuspendSecs = min(e.SuspendSecs, maxSecs)
+			e.HibernateSecs = min(e.HibernateSecs, maxSecs-e.SuspendSecs)
+			e.Suspect = true
+		}
+	}
+	return events
+}
@@ -34,6 +34,40 @@ func TestReconstructEvents(t *testing.T) {
 			},
 			want: []PowerStateEvent{{StartTime: 100, EndTime: 130, Type: "hibernate", HibernateSecs: 30}},
 		},
+		{
+			name: "s2idle suspend records mode",
+			entries: []stateLogEntry{
+				{Ts: 100, Action: "pre", What: "suspend", SleepAction: "suspend", MemSleep: "s2idle"},
+				{Ts: 160, Action: "post", What: "suspend", SleepAction: "suspend"},
+			},
+			want: []PowerStateEvent{{StartTime: 100, EndTime: 160, Type: "suspend", Subtype: "s2idle", SuspendSecs: 60}},
+		},
+		{
+			name: "hybrid sleep keeps its type",
+			entries: []stateLogEntry{
+				{Ts: 100, Action: "pre", What: "hybrid-sleep", SleepAction: "suspend", MemSleep: "deep"},
+				{Ts: 150, Action: "post", What: "hybrid-sleep", SleepAction: "suspend"},
+			},
+			want: []PowerStateEvent{{StartTime: 100, EndTime: 150, Type: "hybrid-sleep", Subtype: "deep", SuspendSecs: 50}},
+		},
+		{
+			name: "suspend-then-hibernate records mode",
+			entries: []stateLogEntry{
+				{Ts: 100, Action: "pre", What: "suspend-then-hibernate", SleepAction: "suspend", MemSleep: "s2idle"},
+				{Ts: 130, Action: "post", SleepAction: "suspend"},
+				{Ts: 140, Action: "pre", SleepAction: "hibernate"},
+				{Ts: 190, Action: "post", SleepAction: "hibernate"},
+			},
+			want: []PowerStateEvent{{StartTime: 100, EndTime: 190, Type: "suspend-then-hibernate", Subtype: "s2idle", SuspendSecs: 30, HibernateSecs: 50}},
+		},
+		{
+			name: "hibernate drops mem_sleep mode",
+			entries: []stateLogEntry{
+				{Ts: 100, Action: "pre", What: "hibernate", MemSleep: "s2idle"},
+				{Ts: 130, Action: "post", What: "hibernate"},
+			},
+			want: []PowerStateEvent{{StartTime: 100, EndTime: 130, Type: "hibernate", HibernateSecs: 30}},
+		},
 		{
 			name: "shutdown pre only",
 			entries: []stateLogEntry{
@@ -88,6 +122,108 @@ func TestReconstructEvents(t *testing.T) {
 	}
 }
 
+func TestReconstructEvents_BoottimeSpan(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []stateLogEntry
+		want    []PowerStateEvent
+	}{
+		{
+			name: "clock jumped forward while asleep",
+			entries: []stateLogEntry{
+				{Ts: 1000, Action: "pre", What: "suspend", SleepAction: "suspend", Uptime: 500.2},
+				{Ts: 1000 + 86400*400, Action: "post", What: "suspend", SleepAction: "suspend", Uptime: 3100.4},
+			},
+			want: []PowerStateEvent{{StartTime: 1000, EndTime: 3600, Type: "suspend", SuspendSecs: 2600}},
+		},
+		{
+			name: "small skew keeps wall clock",
+			entries: []stateLogEntry{
+				{Ts: 1000, Action: "pre", What: "suspend", SleepAction: "suspend", Uptime: 500},
+				{Ts: 1630, Action: "post", What: "suspend", SleepAction: "suspend", Uptime: 1100},
+			},
+			want: []PowerStateEvent{{StartTime: 1000, EndTime: 1630, Type: "suspend", SuspendSecs: 630}},
+		},
+		{
+			name: "uptime from another boot is ignored",
+			entries: []stateLogEntry{
+				{Ts: 1000, Action: "pre", What: "hibernate", Uptime: 5000},
+				{Ts: 1600, Action: "post", What: "hibernate", Uptime: 20},
+			},
+			want: []PowerStateEvent{{StartTime: 1000, EndTime: 1600, Type: "hibernate", HibernateSecs: 600}},
+		},
+		{
+			name: "suspend then hibernate phases",
+			entries: []stateLogEntry{
+				{Ts: 1000, Action: "pre", What: "suspend-then-hibernate", SleepAction: "suspend", Uptime: 100},
+				{Ts: 9000, Action: "post", SleepAction: "suspend", Uptime: 400},
+				{Ts: 9010, Action: "pre", SleepAction: "hibernate", Uptime: 410},
+				{Ts: 9510, Action: "post", SleepAction: "hibernate", Uptime: 910},
+			},
+			want: []PowerStateEvent{{StartTime: 1000, EndTime: 1810, Type: "suspend-then-hibernate", SuspendSecs: 300, HibernateSecs: 500}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reconstructEvents(tt.entries, 100000)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("reconstructEvents() mismatch\n got: %#v\nwant: %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampSleepEvents(t *testing.T) {
+	const maxSecs = 30 * 86400
+
+	tests := []struct {
+		name string
+		in   PowerStateEvent
+		want PowerStateEvent
+	}{
+		{
+			name: "plausible event untouched",
+			in:   PowerStateEvent{StartTime: 1000, EndTime: 9000, Type: "suspend", SuspendSecs: 8000},
+			want: PowerStateEvent{StartTime: 1000, EndTime: 9000, Type: "suspend", SuspendSecs: 8000},
+		},
+		{
+			name: "far-future post clamped",
+			in:   PowerStateEvent{StartTime: 1000, EndTime: 1000 + 86400*3650, Type: "suspend", SuspendSecs: 86400 * 3650},
+			want: PowerStateEvent{StartTime: 1000, EndTime: 1000 + maxSecs, Type: "suspend", SuspendSecs: maxSecs, Suspect: true},
+		},
+		{
+			name: "suspend then hibernate phases fit the cap",
+			in:   PowerStateEvent{StartTime: 0, EndTime: maxSecs + 7200, Type: "suspend-then-hibernate", SuspendSecs: 3600, HibernateSecs: maxSecs},
+			want: PowerStateEvent{StartTime: 0, EndTime: maxSecs, Type: "suspend-then-hibernate", SuspendSecs: 3600, HibernateSecs: maxSecs - 3600, Suspect: true},
+		},
+		{
+			name: "negative duration collapsed",
+			in:   PowerStateEvent{StartTime: 5000, EndTime: 1000, Type: "hibernate", HibernateSecs: -4000},
+			want: PowerStateEvent{StartTime: 5000, EndTime: 5000, Type: "hibernate", Suspect: true},
+		},
+		{
+			name: "long shutdown kept",
+			in:   PowerStateEvent{StartTime: 1000, EndTime: 1000 + 86400*90, Type: "shutdown"},
+			want: PowerStateEvent{StartTime: 1000, EndTime: 1000 + 86400*90, Type: "shutdown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := clampSleepEvents([]PowerStateEvent{tt.in}, maxSecs)
+			if !reflect.DeepEqual(got[0], tt.want) {
+				t.Fatalf("clampSleepEvents() mismatch\n got: %#v\nwant: %#v", got[0], tt.want)
+			}
+		})
+	}
+
+	far := PowerStateEvent{StartTime: 0, EndTime: 86400 * 3650, Type: "suspend", SuspendSecs: 86400 * 3650}
+	if got := clampSleepEvents([]PowerStateEvent{far}, 0); got[0] != far {
+		t.Fatalf("clampSleepEvents(max 0) = %#v, want unchanged", got[0])
+	}
+}
+
 func TestReconstructSuspendThenHibernate(t *testing.T) {
 	nowUnix := int64(300)
 
@@ -156,7 +292,7 @@ func TestReadAndConsumeStateLog(t *testing.T) {
 
 	t.Run("missing file returns nil", func(t *testing.T) {
 		path := filepath.Join(t.TempDir(), "state-log.jsonl")
-		got := ReadAndConsumeStateLog(logger, time.Unix(200, 0), path)
+		got := ReadAndConsumeStateLog(logger, time.Unix(200, 0), path, StateLogOptions{})
 		if len(got) != 0 {
 			t.Fatalf("len(events) = %d, want 0", len(got))
 		}
@@ -172,7 +308,7 @@ func TestReadAndConsumeStateLog(t *testing.T) {
 			t.Fatalf("write state log: %v", err)
 		}
 
-		got := ReadAndConsumeStateLog(logger, time.Unix(200, 0), path)
+		got := ReadAndConsumeStateLog(logger, time.Unix(200, 0), path, StateLogOptions{})
 		want := []PowerStateEvent{{StartTime: 100, EndTime: 140, Type: "suspend", SuspendSecs: 40}}
 		if !reflect.DeepEqual(got, want) {
 			t.Fatalf("ReadAndConsumeStateLog() mismatch\n got: %#v\nwant: %#v", got, want)
@@ -187,3 +323,50 @@ func TestReadAndConsumeStateLog(t *testing.T) {
 		}
 	})
 }
+
+func TestReadAndConsumeStateLog_ArchiveReplays(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state-log.jsonl")
+	archiveDir := filepath.Join(dir, "archive")
+	// The hibernate has no "post" yet, so it ends at the consume time.
+	content := `{"ts":100,"action":"pre","what":"suspend","sleep_action":"suspend","mem_sleep":"s2idle"}` + "\n" +
+		`{"ts":140,"action":"post","what":"suspend","sleep_action":"suspend"}` + "\n" +
+		`{"ts":300,"action":"pre","what":"hibernate","sleep_action":"hibernate"}` + "\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write state log: %v", err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	consumed := ReadAndConsumeStateLog(logger, now, path, StateLogOptions{ArchiveDir: archiveDir})
+	if len(consumed) != 2 {
+		t.Fatalf("ReadAndConsumeStateLog() = %#v, want 2 events", consumed)
+	}
+
+	archived := filepath.Join(archiveDir, "state-log-20231114T221320Z.jsonl")
+	data, err := os.ReadFile(archived)
+	if err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	if string(data) != content {
+		t.Fatalf("archive = %q, want the consumed contents", data)
+	}
+
+	replayed, err := ReplayStateLog(logger, archived, StateLogOptions{})
+	if err != nil {
+		t.Fatalf("ReplayStateLog() error = %v", err)
+	}
+	if !reflect.DeepEqual(replayed, consumed) {
+		t.Fatalf("ReplayStateLog() mismatch\n got: %#v\nwant: %#v", replayed, consumed)
+	}
+	if _, err := os.Stat(archived); err != nil {
+		t.Fatalf("ReplayStateLog() should leave the archive, stat err = %v", err)
+	}
+}
+
+func TestReplayStateLog_MissingFile(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := ReplayStateLog(logger, filepath.Join(t.TempDir(), "missing.jsonl"), StateLogOptions{}); err == nil {
+		t.Fatal("ReplayStateLog() error = nil, want not-exist error")
+	}
+}
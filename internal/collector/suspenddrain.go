@@ -0,0 +1,45 @@
+package collector
+
+const (
+	// MinSuspendDrainSecs is the shortest suspend whose drain rate is
+	// reported. Capacity is reported in whole percent, so a short suspend's
+	// rate is mostly rounding.
+	MinSuspendDrainSecs = 30 * 60
+	// SuspendDrainWindow is how many suspends the rolling average covers.
+	SuspendDrainWindow = 5
+)
+
+// SuspendDrainRates returns the drain rate of each suspend in events, which
+// must be in ascending start order. Only suspend and hybrid-sleep events of
+// at least MinSuspendDrainSecs with a known, non-negative drain count:
+// hibernation draws almost nothing, and a battery that charged while asleep
+// says nothing about standby power. Each rate carries the average over it and
+// the SuspendDrainWindow-1 counted suspends before it, weighted by duration,
+// so a regression after an update shows as a step in the average.
+func SuspendDrainRates(events []PowerStateEvent) []SuspendDrainRate {
+	var rates []SuspendDrainRate
+	var hours []float64
+	for _, e := range events {
+		secs := e.EndTime - e.StartTime
+		if (e.Type != "suspend" && e.Type != "hybrid-sleep") || !e.DrainKnown || e.DrainPct < 0 || secs < MinSuspendDrainSecs {
+			continue
+		}
+		h := float64(secs) / 3600
+		rates = append(rates, SuspendDrainRate{
+			StartTime:  e.StartTime,
+			EndTime:    e.EndTime,
+			Subtype:    e.Subtype,
+			DrainPct:   e.DrainPct,
+			PctPerHour: float64(e.DrainPct) / h,
+		})
+		hours = append(hours, h)
+
+		var sumPct, sumHours float64
+		for i := max(0, len(rates)-SuspendDrainWindow); i < len(rates); i++ {
+			sumPct += float64(rates[i].DrainPct)
+			sumHours += hours[i]
+		}
+		rates[len(rates)-1].AvgPctPerHour = sumPct / sumHours
+	}
+	return rates
+}
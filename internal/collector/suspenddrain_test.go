@@ -0,0 +1,52 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSuspendDrainRates(t *testing.T) {
+	const hour = 3600
+	night := func(day int64, hours int64, drain int) PowerStateEvent {
+		start := day * 24 * hour
+		return PowerStateEvent{StartTime: start, EndTime: start + hours*hour, Type: "suspend", SuspendSecs: hours * hour, DrainPct: drain, DrainKnown: true}
+	}
+	events := []PowerStateEvent{
+		night(0, 8, 4),
+		{StartTime: 1 * 24 * hour, EndTime: 1*24*hour + 600, Type: "suspend", DrainPct: 1, DrainKnown: true}, // too short
+		{StartTime: 2 * 24 * hour, EndTime: 2*24*hour + 8*hour, Type: "hibernate", DrainKnown: true},
+		{StartTime: 3 * 24 * hour, EndTime: 3*24*hour + 8*hour, Type: "suspend"}, // drain unknown
+		{StartTime: 4 * 24 * hour, EndTime: 4*24*hour + 8*hour, Type: "suspend", DrainPct: -20, DrainKnown: true},
+		night(5, 4, 4),
+	}
+	for day := int64(6); day < 11; day++ {
+		night := night(day, 10, 10)
+		night.Type = "hybrid-sleep"
+		events = append(events, night)
+	}
+
+	rates := SuspendDrainRates(events)
+	if len(rates) != 7 {
+		t.Fatalf("SuspendDrainRates() returned %d rates, want 7: %+v", len(rates), rates)
+	}
+	want := []struct{ rate, avg float64 }{
+		{0.5, 0.5},
+		{1, 8.0 / 12},
+		{1, 18.0 / 22},
+		{1, 28.0 / 32},
+		{1, 38.0 / 42},
+		{1, 1}, // the first night has left the window
+		{1, 1},
+	}
+	for i, w := range want {
+		if math.Abs(rates[i].PctPerHour-w.rate) > 1e-9 || math.Abs(rates[i].AvgPctPerHour-w.avg) > 1e-9 {
+			t.Fatalf("rates[%d] = %+v, want rate %v avg %v", i, rates[i], w.rate, w.avg)
+		}
+	}
+}
+
+func TestSuspendDrainRates_Empty(t *testing.T) {
+	if rates := SuspendDrainRates(nil); rates != nil {
+		t.Fatalf("SuspendDrainRates(nil) = %+v, want nil", rates)
+	}
+}
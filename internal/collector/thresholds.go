@@ -0,0 +1,40 @@
+package collector
+
+import "path/filepath"
+
+// ChargeThreshold holds one battery's charge_control thresholds, in percent.
+// A nil field means the driver does not expose that threshold; on dual-battery
+// ThinkPads each pack has its own pair.
+type ChargeThreshold struct {
+	StartPct *int `json:"start_pct"` // charging resumes below this level
+	EndPct   *int `json:"end_pct"`   // charging stops at this level
+}
+
+// CollectChargeThresholds reads the charge thresholds of every battery
+// BatteryDirs finds, keyed by power supply name (e.g. "BAT0", "BAT1").
+// Batteries without threshold support are included with nil fields.
+func CollectChargeThresholds() (map[string]ChargeThreshold, error) {
+	dirs, err := BatteryDirs()
+	if err != nil {
+		return nil, err
+	}
+	thresholds := make(map[string]ChargeThreshold, len(dirs))
+	for _, dir := range dirs {
+		thresholds[filepath.Base(dir)] = ChargeThreshold{
+			StartPct: readThreshold(filepath.Join(dir, "charge_control_start_threshold")),
+			EndPct:   readThreshold(filepath.Join(dir, "charge_control_end_threshold")),
+		}
+	}
+	return thresholds, nil
+}
+
+// readThreshold returns the percentage in path, or nil when the attribute is
+// missing or out of range.
+func readThreshold(path string) *int {
+	v, err := readIntFile(path)
+	if err != nil || v < 0 || v > 100 {
+		return nil
+	}
+	pct := int(v)
+	return &pct
+}
@@ -0,0 +1,56 @@
+package collector
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectChargeThresholds_PerBattery(t *testing.T) {
+	root := setTestSysfsRoot(t)
+	ps := filepath.Join(root, "class/power_supply")
+	writeTestFile(t, filepath.Join(ps, "BAT0/type"), "Battery\n")
+	writeTestFile(t, filepath.Join(ps, "BAT0/charge_control_start_threshold"), "40\n")
+	writeTestFile(t, filepath.Join(ps, "BAT0/charge_control_end_threshold"), "80\n")
+	writeTestFile(t, filepath.Join(ps, "BAT1/type"), "Battery\n")
+	writeTestFile(t, filepath.Join(ps, "BAT1/charge_control_end_threshold"), "95\n")
+	writeTestFile(t, filepath.Join(ps, "BAT2/uevent"), "\n") // no type file, no thresholds
+	writeTestFile(t, filepath.Join(ps, "AC/type"), "Mains\n")
+	writeTestFile(t, filepath.Join(ps, "hid-mouse/type"), "Battery\n")
+	writeTestFile(t, filepath.Join(ps, "hid-mouse/charge_control_end_threshold"), "250\n")
+
+	got, err := CollectChargeThresholds()
+	if err != nil {
+		t.Fatalf("CollectChargeThresholds() error = %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("CollectChargeThresholds() = %v, want BAT0, BAT1, BAT2 and hid-mouse", got)
+	}
+	if _, ok := got["AC"]; ok {
+		t.Fatal("CollectChargeThresholds() includes the AC adapter")
+	}
+
+	check := func(name string, start, end *int) {
+		t.Helper()
+		th := got[name]
+		if !samePct(th.StartPct, start) || !samePct(th.EndPct, end) {
+			t.Fatalf("%s = {%v, %v}, want {%v, %v}", name, derefPct(th.StartPct), derefPct(th.EndPct), derefPct(start), derefPct(end))
+		}
+	}
+	check("BAT0", pctPtr(40), pctPtr(80))
+	check("BAT1", nil, pctPtr(95))
+	check("BAT2", nil, nil)
+	check("hid-mouse", nil, nil) // out-of-range value ignored
+}
+
+func pctPtr(v int) *int { return &v }
+
+func samePct(a, b *int) bool {
+	return (a == nil) == (b == nil) && (a == nil || *a == *b)
+}
+
+func derefPct(p *int) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
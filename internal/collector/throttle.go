@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"path/filepath"
+	"strconv"
+)
+
+// MinThrottleCycles is how many consecutive throttled observations make an
+// interval worth recording; single-cycle blips are common and not
+// user-meaningful.
+const MinThrottleCycles = 2
+
+// ThrottleDetector turns periodic observations of the CPU throttle state into
+// throttling intervals. A cycle is throttled when any thermal_throttle event
+// counter increased since the previous observation or, on CPUs without those
+// counters, when scaling_max_freq sits below its value at the first
+// observation. Comparing against that baseline rather than cpuinfo_max_freq
+// ignores static caps such as disabled turbo.
+type ThrottleDetector struct {
+	prevCount   int64         // sum of thermal_throttle counters; -1 before the first observation
+	baseMaxFreq map[int]int64 // cpu_id -> highest scaling_max_freq seen
+	lastObs     int64         // time of the previous observation
+
+	open   *ThrottleEvent // interval in progress, nil when not throttled
+	cycles int            // throttled observations in the open interval
+}
+
+// NewThrottleDetector creates a ThrottleDetector.
+func NewThrottleDetector() *ThrottleDetector {
+	return &ThrottleDetector{prevCount: -1, baseMaxFreq: make(map[int]int64)}
+}
+
+// Observe reads the throttle state at now. When a throttling interval of at
+// least MinThrottleCycles observations ends, it returns that interval.
+func (d *ThrottleDetector) Observe(now int64) *ThrottleEvent {
+	reason, throttled := d.read()
+	prev := d.lastObs
+	d.lastObs = now
+
+	if throttled {
+		if d.open == nil {
+			// Counters only tell us throttling happened since the previous
+			// observation, so the interval starts there.
+			start := now
+			if reason == ThrottleReasonThermal && prev > 0 {
+				start = prev
+			}
+			d.open = &ThrottleEvent{StartTime: start, Reason: reason}
+			d.cycles = 0
+		}
+		d.open.EndTime = now
+		d.cycles++
+		return nil
+	}
+	return d.Flush()
+}
+
+// Flush ends any open throttling interval, returning it if it lasted at least
+// MinThrottleCycles observations. Call it on shutdown.
+func (d *ThrottleDetector) Flush() *ThrottleEvent {
+	ev, cycles := d.open, d.cycles
+	d.open, d.cycles = nil, 0
+	if ev == nil || cycles < MinThrottleCycles {
+		return nil
+	}
+	return ev
+}
+
+// read reports whether the CPU is throttled now and why.
+func (d *ThrottleDetector) read() (ThrottleReason, bool) {
+	cpuDirs, err := filepath.Glob(filepath.Join(sysfsRoot, "devices/system/cpu/cpu[0-9]*"))
+	if err != nil {
+		return "", false
+	}
+
+	var count int64
+	haveCounters := false
+	capped := false
+	for _, dir := range cpuDirs {
+		for _, name := range []string{"core_throttle_count", "package_throttle_count"} {
+			if n, err := readIntFile(filepath.Join(dir, "thermal_throttle", name)); err == nil {
+				count += n
+				haveCounters = true
+			}
+		}
+
+		id, err := strconv.Atoi(filepath.Base(dir)[3:])
+		if err != nil {
+			continue
+		}
+		maxFreq, _ := readIntFile(filepath.Join(dir, "cpufreq", "scaling_max_freq"))
+		if maxFreq <= 0 {
+			continue
+		}
+		if base := d.baseMaxFreq[id]; maxFreq < base {
+			capped = true
+		} else {
+			d.baseMaxFreq[id] = maxFreq
+		}
+	}
+
+	if haveCounters {
+		prev := d.prevCount
+		d.prevCount = count
+		if prev >= 0 && count > prev {
+			return ThrottleReasonThermal, true
+		}
+		return "", false
+	}
+	if capped {
+		return ThrottleReasonFreqCap, true
+	}
+	return "", false
+}
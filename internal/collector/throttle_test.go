@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func writeThrottleCount(t *testing.T, cpu int, count int64) {
+	t.Helper()
+	dir := filepath.Join(sysfsRoot, "devices/system/cpu", fmt.Sprintf("cpu%d", cpu), "thermal_throttle")
+	writeTestFile(t, filepath.Join(dir, "core_throttle_count"), fmt.Sprintf("%d\n", count))
+	writeTestFile(t, filepath.Join(dir, "package_throttle_count"), "0\n")
+}
+
+func writeScalingMaxFreq(t *testing.T, cpu int, khz int64) {
+	t.Helper()
+	path := filepath.Join(sysfsRoot, "devices/system/cpu", fmt.Sprintf("cpu%d", cpu), "cpufreq", "scaling_max_freq")
+	writeTestFile(t, path, fmt.Sprintf("%d\n", khz))
+}
+
+func TestThrottleDetector_ThermalCounters(t *testing.T) {
+	setTestSysfsRoot(t)
+	writeThrottleCount(t, 0, 10)
+	writeThrottleCount(t, 1, 3)
+	d := NewThrottleDetector()
+
+	steps := []struct {
+		now   int64
+		cpu0  int64
+		want  *ThrottleEvent
+		label string
+	}{
+		{100, 10, nil, "first observation only sets the baseline"},
+		{105, 12, nil, "counter increase opens an interval"},
+		{110, 15, nil, "still throttled"},
+		{115, 15, &ThrottleEvent{StartTime: 100, EndTime: 110, Reason: ThrottleReasonThermal}, "quiet cycle closes it"},
+		{120, 16, nil, "single-cycle blip opens"},
+		{125, 16, nil, "blip is too short to record"},
+	}
+	for _, s := range steps {
+		writeThrottleCount(t, 0, s.cpu0)
+		got := d.Observe(s.now)
+		if (got == nil) != (s.want == nil) || (got != nil && *got != *s.want) {
+			t.Fatalf("%s: Observe(%d) = %+v, want %+v", s.label, s.now, got, s.want)
+		}
+	}
+}
+
+func TestThrottleDetector_FreqCapFallback(t *testing.T) {
+	setTestSysfsRoot(t)
+	// A static cap present at startup (e.g. turbo disabled) is the baseline,
+	// not throttling.
+	writeScalingMaxFreq(t, 0, 2400000)
+	writeScalingMaxFreq(t, 1, 2400000)
+	d := NewThrottleDetector()
+
+	if got := d.Observe(100); got != nil {
+		t.Fatalf("Observe(100) = %+v, want nil", got)
+	}
+	writeScalingMaxFreq(t, 1, 1200000)
+	d.Observe(105)
+	d.Observe(110)
+	writeScalingMaxFreq(t, 1, 2400000)
+	got := d.Observe(115)
+	want := &ThrottleEvent{StartTime: 105, EndTime: 110, Reason: ThrottleReasonFreqCap}
+	if got == nil || *got != *want {
+		t.Fatalf("Observe(115) = %+v, want %+v", got, want)
+	}
+
+	// Raising the cap moves the baseline up.
+	writeScalingMaxFreq(t, 0, 3000000)
+	d.Observe(120)
+	writeScalingMaxFreq(t, 0, 2400000)
+	d.Observe(125)
+	got = d.Flush()
+	if got != nil {
+		t.Fatalf("Flush() after one capped cycle = %+v, want nil", got)
+	}
+	d.Observe(130)
+	d.Observe(135)
+	got = d.Flush()
+	want = &ThrottleEvent{StartTime: 130, EndTime: 135, Reason: ThrottleReasonFreqCap}
+	if got == nil || *got != *want {
+		t.Fatalf("Flush() = %+v, want %+v", got, want)
+	}
+}
+
+func TestThrottleDetector_NoCPUData(t *testing.T) {
+	setTestSysfsRoot(t)
+	d := NewThrottleDetector()
+	for now := int64(100); now <= 120; now += 5 {
+		if got := d.Observe(now); got != nil {
+			t.Fatalf("Observe(%d) = %+v, want nil without sysfs data", now, got)
+		}
+	}
+	if got := d.Flush(); got != nil {
+		t.Fatalf("Flush() = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// CollectTimingWindow is how many recent cycles CollectTimings keeps per
+// collector: one hour at the default 5 s interval.
+const CollectTimingWindow = 720
+
+// CollectTiming summarizes how long one collector took over recent cycles.
+type CollectTiming struct {
+	Name   string  `json:"name"`
+	Cycles int     `json:"cycles"` // cycles in the window
+	MinMS  float64 `json:"min_ms"`
+	AvgMS  float64 `json:"avg_ms"`
+	MaxMS  float64 `json:"max_ms"`
+	P99MS  float64 `json:"p99_ms"`
+	LastMS float64 `json:"last_ms"` // the most recent cycle
+}
+
+// CollectTimings records the wall-clock duration of each collector call in
+// the daemon loop, keeping the last CollectTimingWindow per collector. The
+// zero value is ready to use; it is safe for concurrent use.
+type CollectTimings struct {
+	mu    sync.Mutex
+	order []string
+	rings map[string]*timingRing
+}
+
+type timingRing struct {
+	durs []time.Duration
+	next int // overwrite position once full
+}
+
+// Record adds one call of the named collector that took d.
+func (t *CollectTimings) Record(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rings == nil {
+		t.rings = make(map[string]*timingRing)
+	}
+	r, ok := t.rings[name]
+	if !ok {
+		r = &timingRing{}
+		t.rings[name] = r
+		t.order = append(t.order, name)
+	}
+	if len(r.durs) < CollectTimingWindow {
+		r.durs = append(r.durs, d)
+		return
+	}
+	r.durs[r.next] = d
+	r.next = (r.next + 1) % CollectTimingWindow
+}
+
+// Summary returns min/avg/max/p99 and the latest duration per collector, in
+// first-recorded order.
+func (t *CollectTimings) Summary() []CollectTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]CollectTiming, 0, len(t.order))
+	for _, name := range t.order {
+		r := t.rings[name]
+		last := r.durs[len(r.durs)-1]
+		if len(r.durs) == CollectTimingWindow {
+			last = r.durs[(r.next+CollectTimingWindow-1)%CollectTimingWindow]
+		}
+		durs := slices.Clone(r.durs)
+		slices.Sort(durs)
+		var sum time.Duration
+		for _, d := range durs {
+			sum += d
+		}
+		// Nearest-rank percentile: the smallest value at or above 99%.
+		p99 := durs[(len(durs)*99+99)/100-1]
+		out = append(out, CollectTiming{
+			Name:   name,
+			Cycles: len(durs),
+			MinMS:  ms(durs[0]),
+			AvgMS:  ms(sum / time.Duration(len(durs))),
+			MaxMS:  ms(durs[len(durs)-1]),
+			P99MS:  ms(p99),
+			LastMS: ms(last),
+		})
+	}
+	return out
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
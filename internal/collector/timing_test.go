@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectTimings_Summary(t *testing.T) {
+	var tm CollectTimings
+	if got := tm.Summary(); len(got) != 0 {
+		t.Fatalf("Summary() on zero value = %v, want empty", got)
+	}
+
+	for i := 1; i <= 100; i++ {
+		tm.Record("process", time.Duration(i)*time.Millisecond)
+	}
+	tm.Record("battery", 2*time.Millisecond)
+	tm.Record("battery", 4*time.Millisecond)
+
+	got := tm.Summary()
+	want := []CollectTiming{
+		{Name: "process", Cycles: 100, MinMS: 1, AvgMS: 50.5, MaxMS: 100, P99MS: 99, LastMS: 100},
+		{Name: "battery", Cycles: 2, MinMS: 2, AvgMS: 3, MaxMS: 4, P99MS: 4, LastMS: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Summary() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCollectTimings_KeepsRecentWindow(t *testing.T) {
+	var tm CollectTimings
+	// An early slow call ages out once the window has wrapped.
+	tm.Record("process", time.Second)
+	for range CollectTimingWindow {
+		tm.Record("process", time.Millisecond)
+	}
+	tm.Record("process", 3*time.Millisecond)
+
+	got := tm.Summary()[0]
+	if got.Cycles != CollectTimingWindow || got.MaxMS != 3 || got.LastMS != 3 {
+		t.Fatalf("Summary() = %+v, want %d cycles with max and last 3 ms", got, CollectTimingWindow)
+	}
+}
@@ -1,16 +1,91 @@
 package collector
 
+// PowerSource records how BatterySample.PowerUW was derived.
+type PowerSource string
+
+const (
+	// PowerSourceChargeDelta is averaged from charge_now deltas over the window.
+	PowerSourceChargeDelta PowerSource = "charge_delta"
+	// PowerSourceEnergyDelta is averaged from energy_now deltas over the window.
+	PowerSourceEnergyDelta PowerSource = "energy_delta"
+	// PowerSourceSysfsPowerNow is the instantaneous power_now reading.
+	PowerSourceSysfsPowerNow PowerSource = "sysfs_power_now"
+	// PowerSourceSysfsVoltageCurrent is voltage_now × current_now.
+	PowerSourceSysfsVoltageCurrent PowerSource = "sysfs_voltage_current"
+)
+
 // BatterySample holds a snapshot of battery state from /sys/class/power_supply/BAT*.
 type BatterySample struct {
-	Timestamp            int64  `json:"timestamp"`
-	VoltageUV            int64  `json:"voltage_uv"`
-	CurrentUA            int64  `json:"current_ua"`
-	PowerUW              int64  `json:"power_uw"`
-	PowerFromChargeDelta bool   `json:"power_from_charge_delta"`
-	SysfsPowerUW         int64  `json:"sysfs_power_uw"`
-	ChargeNowUAH         int64  `json:"charge_now_uah"`
-	CapacityPct          int    `json:"capacity_pct"`
-	Status               string `json:"status"`
+	Timestamp       int64       `json:"timestamp"`
+	VoltageUV       int64       `json:"voltage_uv"`
+	CurrentUA       int64       `json:"current_ua"`
+	PowerUW         int64       `json:"power_uw"`
+	PowerSource     PowerSource `json:"power_source"`      // "" when no power reading was available
+	PowerSmoothedUW int64       `json:"power_smoothed_uw"` // charge- or energy-delta power over the smoothing window; 0 when off or not yet filled
+	SysfsPowerUW    int64       `json:"sysfs_power_uw"`
+	ChargeNowUAH    int64       `json:"charge_now_uah"`
+	CapacityPct     int         `json:"capacity_pct"`
+	CapacityLevel   string      `json:"capacity_level"` // firmware coarse state: Normal, Low, Critical, Full, ...; "" if absent
+	Status          string      `json:"status"`
+	ACSource        string      `json:"ac_source"`        // online external supply name, "" on battery
+	ChargerPowerUW  int64       `json:"charger_power_uw"` // rated/negotiated charger power, 0 if unknown
+	BatteryCount    int         `json:"battery_count"`    // battery packs aggregated into the sample
+}
+
+// BatteryBucket aggregates the battery samples in one fixed-width time bucket.
+type BatteryBucket struct {
+	Timestamp      int64   `json:"timestamp"` // bucket start
+	Count          int     `json:"count"`
+	MinCapacityPct int     `json:"min_capacity_pct"`
+	MaxCapacityPct int     `json:"max_capacity_pct"`
+	AvgCapacityPct float64 `json:"avg_capacity_pct"`
+	MinPowerUW     int64   `json:"min_power_uw"`
+	MaxPowerUW     int64   `json:"max_power_uw"`
+	AvgPowerUW     int64   `json:"avg_power_uw"`
+}
+
+// SeriesBucket holds the averages over one fixed-width time bucket that
+// derived series are computed from.
+type SeriesBucket struct {
+	Timestamp     int64   // bucket start
+	PowerUW       float64 // average battery power
+	BrightnessPct float64 // average backlight brightness, if HasBrightness
+	HasBrightness bool
+	CPUTicks      float64 // mean total CPU ticks per process cycle, if HasCPU
+	HasCPU        bool
+}
+
+// DerivedPoint is the value of a derived series over one time bucket.
+type DerivedPoint struct {
+	Timestamp int64   `json:"timestamp"` // bucket start
+	Value     float64 `json:"value"`
+}
+
+// DerivedSeries is a configured derived series evaluated over a time range.
+// Buckets whose inputs are missing, or where the expression has no finite
+// value, have no point.
+type DerivedSeries struct {
+	Name       string         `json:"name"`
+	Expression string         `json:"expression"`
+	BucketSecs int64          `json:"bucket_secs"`
+	Points     []DerivedPoint `json:"points"`
+}
+
+// PowerHistogramBucket counts battery samples whose power falls in
+// [MinUW, MaxUW).
+type PowerHistogramBucket struct {
+	MinUW int64 `json:"min_uw"`
+	MaxUW int64 `json:"max_uw"`
+	Count int   `json:"count"`
+}
+
+// PowerPercentiles summarises battery power draw while discharging:
+// the nearest-rank 50th, 90th and 99th percentile over Count samples.
+type PowerPercentiles struct {
+	Count int   `json:"count"`
+	P50UW int64 `json:"p50_uw"`
+	P90UW int64 `json:"p90_uw"`
+	P99UW int64 `json:"p99_uw"`
 }
 
 // BacklightSample holds a snapshot of display backlight state.
@@ -24,9 +99,19 @@ type BacklightSample struct {
 type PowerStateEvent struct {
 	StartTime     int64  `json:"start_time"`
 	EndTime       int64  `json:"end_time"`
-	Type          string `json:"type"`           // "suspend", "hibernate", "suspend-then-hibernate", "shutdown"
+	Type          string `json:"type"`           // "suspend", "hibernate", "hybrid-sleep", "suspend-then-hibernate", "shutdown"
+	Subtype       string `json:"subtype"`        // suspend mode from /sys/power/mem_sleep: "s2idle", "shallow", "deep"; "" if unknown or no suspend phase
 	SuspendSecs   int64  `json:"suspend_secs"`   // seconds in suspend phase (0 if pure hibernate/shutdown)
 	HibernateSecs int64  `json:"hibernate_secs"` // seconds in hibernate phase (0 if pure suspend/shutdown)
+	// Battery used while asleep, from the samples bracketing the event;
+	// negative if it charged. DrainKnown is false when no sample lies close
+	// enough on either side. DrainUAH is 0 if the battery reports no charge.
+	DrainPct   int   `json:"drain_pct"`
+	DrainUAH   int64 `json:"drain_uah"`
+	DrainKnown bool  `json:"drain_known"`
+	// Suspect marks an event whose recorded duration was implausible and
+	// has been clamped; its span and drain are not trustworthy.
+	Suspect bool `json:"suspect"`
 }
 
 // BatteryHealth holds static/slow-changing battery identity and health info.
@@ -39,6 +124,35 @@ type BatteryHealth struct {
 	ChargeFullDesignUAH int64  `json:"charge_full_design_uah"`
 	ChargeFullUAH       int64  `json:"charge_full_uah"`
 	VoltageMinDesignUV  int64  `json:"voltage_min_design_uv"`
+	VoltageMaxDesignUV  int64  `json:"voltage_max_design_uv"`
+	VoltageNowUV        int64  `json:"voltage_now_uv"`
+	// Energy-reporting batteries give their capacities in µWh instead of
+	// the charge fields above; 0 when not reported.
+	EnergyFullDesignUWH int64 `json:"energy_full_design_uwh"`
+	EnergyFullUWH       int64 `json:"energy_full_uwh"`
+
+	// Design and full-charge capacity in Wh, set by SetWhBasis. Reported
+	// energies are used as they are; charges are multiplied by WhVoltageUV,
+	// the basis voltage, which is 0 when the battery reports none.
+	WhBasis     WhVoltageBasis `json:"wh_basis"`
+	WhVoltageUV int64          `json:"wh_voltage_uv"`
+	DesignWh    float64        `json:"design_wh"`
+	FullWh      float64        `json:"full_wh"`
+
+	// Low-capacity alarm threshold from the battery's optional sysfs
+	// "alarm" attribute. Its unit follows the battery's reporting mode, so
+	// at most one of these is set; both are 0 when the firmware exposes no
+	// alarm or it is disabled.
+	AlarmUAH int64 `json:"alarm_uah"`
+	AlarmUWH int64 `json:"alarm_uwh"`
+}
+
+// MachineInfo identifies the laptop model from its DMI data. It holds no
+// serial numbers or other per-unit identifiers.
+type MachineInfo struct {
+	Vendor  string `json:"vendor"`
+	Product string `json:"product"`
+	Version string `json:"version"` // the model's marketing name on some vendors
 }
 
 // ProcessSample holds a per-process CPU usage snapshot for one sampling interval.
@@ -51,6 +165,27 @@ type ProcessSample struct {
 	LastCPU       int    `json:"last_cpu"`
 }
 
+// ProcessLifetime records the first and last collection cycles in which one
+// process used CPU time. Pids are reused, so a process is identified by its
+// pid and start time.
+type ProcessLifetime struct {
+	PID       int    `json:"pid"`
+	StartTime int64  `json:"start_time"` // unix time the process started
+	Comm      string `json:"comm"`
+	FirstSeen int64  `json:"first_seen"`
+	LastSeen  int64  `json:"last_seen"`
+}
+
+// ProcessCycleStats summarizes one process collection cycle: how many ticks
+// and processes were active in total, and how many ticks the stored top-N
+// samples account for.
+type ProcessCycleStats struct {
+	Timestamp     int64 `json:"timestamp"`
+	TotalTicks    int64 `json:"total_ticks"`
+	CapturedTicks int64 `json:"captured_ticks"`
+	TotalProcs    int   `json:"total_procs"`
+}
+
 // CPUFreqSample holds the frequency of a single CPU core at a point in time.
 type CPUFreqSample struct {
 	Timestamp int64 `json:"timestamp"`
@@ -58,3 +193,154 @@ type CPUFreqSample struct {
 	FreqKHz   int64 `json:"freq_khz"`
 	IsPCore   bool  `json:"is_p_core"`
 }
+
+// CPUBusySample holds the share of a period a single CPU core spent busy,
+// i.e. not idle or waiting on I/O, ending at Timestamp.
+type CPUBusySample struct {
+	Timestamp    int64   `json:"timestamp"`
+	CPUID        int     `json:"cpu_id"`
+	IsPCore      bool    `json:"is_p_core"`
+	BusyFraction float64 `json:"busy_fraction"` // 0 to 1
+	PeriodSecs   int64   `json:"period_secs"`   // length of the period
+}
+
+// BatteryHealthSnapshot records the battery's reported full-charge capacity at a point in time.
+type BatteryHealthSnapshot struct {
+	Timestamp           int64 `json:"timestamp"`
+	ChargeFullUAH       int64 `json:"charge_full_uah"`
+	ChargeFullDesignUAH int64 `json:"charge_full_design_uah"`
+	CycleCount          int64 `json:"cycle_count"`
+}
+
+// Discharge totals the battery drain over a range of stored samples: the
+// decreases between consecutive samples where the later one is discharging,
+// so charging and top-ups on AC are left out.
+type Discharge struct {
+	ChargeUAH   int64 `json:"charge_uah"`   // summed charge_now decreases
+	CapacityPct int64 `json:"capacity_pct"` // summed capacity_pct decreases
+	Samples     int   `json:"samples"`      // samples in the range
+	HasCharge   bool  `json:"has_charge"`   // some sample reported charge_now
+}
+
+// Values for ChargeCycles.Basis.
+const (
+	// CycleBasisDesignCharge divides discharged charge by the design charge.
+	CycleBasisDesignCharge = "design_charge"
+	// CycleBasisCapacity divides discharged capacity percent by 100, for
+	// batteries without charge_now or a design charge; it counts cycles of
+	// the current full capacity rather than the design capacity.
+	CycleBasisCapacity = "capacity_pct"
+)
+
+// ChargeCycles estimates the charge cycles put on the battery over a time
+// range from stored samples, next to what the firmware counter says.
+type ChargeCycles struct {
+	From          int64   `json:"from"`
+	To            int64   `json:"to"`
+	Cycles        float64 `json:"cycles"`
+	Basis         string  `json:"basis"` // a CycleBasis* value; "" when there were no samples
+	DischargedUAH int64   `json:"discharged_uah"`
+	DesignUAH     int64   `json:"design_uah"` // 0 unless Basis is CycleBasisDesignCharge
+	DischargedPct int64   `json:"discharged_pct"`
+	// FirmwareCycleCount is the firmware's cumulative counter as of To and
+	// FirmwareCycles its increase over the range, both from the health
+	// snapshots; 0 when the firmware reports no count.
+	FirmwareCycleCount int64 `json:"firmware_cycle_count"`
+	FirmwareCycles     int64 `json:"firmware_cycles"`
+}
+
+// CapacityDrop records a significant decrease in full-charge capacity between
+// two consecutive health snapshots.
+type CapacityDrop struct {
+	Timestamp     int64   `json:"timestamp"`      // snapshot where the drop was observed
+	PrevTimestamp int64   `json:"prev_timestamp"` // preceding snapshot
+	FromUAH       int64   `json:"from_uah"`
+	ToUAH         int64   `json:"to_uah"`
+	DropPct       float64 `json:"drop_pct"`
+}
+
+// Annotation is a note marking a moment on the timeline, such as a
+// configuration change made while tuning power usage. Users enter them, and
+// the daemon places them at notable events such as AC transitions.
+type Annotation struct {
+	ID        int64  `json:"id"`
+	Timestamp int64  `json:"timestamp"`
+	Text      string `json:"text"`
+	Source    string `json:"source"` // AnnotationSourceUser or AnnotationSourceAuto
+}
+
+// Values for Annotation.Source.
+const (
+	AnnotationSourceUser = "user"
+	AnnotationSourceAuto = "auto"
+)
+
+// ThrottleReason says how a throttling interval was detected.
+type ThrottleReason string
+
+const (
+	// ThrottleReasonThermal means the kernel's thermal_throttle event
+	// counters increased.
+	ThrottleReasonThermal ThrottleReason = "thermal"
+	// ThrottleReasonFreqCap means a CPU's scaling_max_freq dropped below the
+	// cap it had when monitoring started, e.g. by a platform power limit.
+	ThrottleReasonFreqCap ThrottleReason = "freq_cap"
+)
+
+// BatteryPresenceEvent records a battery disappearing from or reappearing
+// in /sys/class/power_supply while the daemon runs.
+type BatteryPresenceEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Present   bool   `json:"present"` // false when removed, true when reinserted
+	Battery   string `json:"battery"` // power supply name, e.g. "BAT1"
+}
+
+// ThrottleEvent records an interval during which the CPU was throttled.
+type ThrottleEvent struct {
+	StartTime int64          `json:"start_time"`
+	EndTime   int64          `json:"end_time"`
+	Reason    ThrottleReason `json:"reason"`
+}
+
+// IdleInterval records a span during which the user was idle, as reported by
+// the desktop through logind.
+type IdleInterval struct {
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+}
+
+// PowerRegression reports that battery power while the user is idle has
+// stayed above its rolling baseline for the same brightness, or that it came
+// back down.
+type PowerRegression struct {
+	Active        bool  `json:"active"`         // false once power is back within the threshold
+	StartTime     int64 `json:"start_time"`     // start of the sustained window that raised it
+	DetectedAt    int64 `json:"detected_at"`    // when it was raised or cleared
+	BaselineUW    int64 `json:"baseline_uw"`    // usual idle power at this brightness
+	PowerUW       int64 `json:"power_uw"`       // mean idle power over the sustained window
+	BrightnessPct int   `json:"brightness_pct"` // lower end of the 10% band, -1 if unknown
+}
+
+// SuspendDrainRate is the battery drain rate of one suspend, with a rolling
+// average over it and the suspends just before it.
+type SuspendDrainRate struct {
+	StartTime     int64   `json:"start_time"`
+	EndTime       int64   `json:"end_time"`
+	Subtype       string  `json:"subtype"` // mem_sleep mode, see PowerStateEvent
+	DrainPct      int     `json:"drain_pct"`
+	PctPerHour    float64 `json:"pct_per_hour"`
+	AvgPctPerHour float64 `json:"avg_pct_per_hour"` // duration-weighted over the last SuspendDrainWindow suspends
+}
+
+// CoreClassEnergy splits the CPU ticks of the stored top processes, and the
+// battery energy estimated to go with them, between P-cores and E-cores.
+type CoreClassEnergy struct {
+	PCoreTicks     int64 `json:"p_core_ticks"`
+	ECoreTicks     int64 `json:"e_core_ticks"`
+	UnknownTicks   int64 `json:"unknown_ticks"` // last ran on a CPU with no recorded class
+	PCoreEnergyUWH int64 `json:"p_core_energy_uwh"`
+	ECoreEnergyUWH int64 `json:"e_core_energy_uwh"`
+	// BusyWeightedUWH is the part of the energy split by CPU busy time
+	// rather than process ticks.
+	BusyWeightedUWH int64 `json:"busy_weighted_uwh"`
+}
@@ -6,8 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/BurntSushi/toml"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/derived"
 )
 
 const (
@@ -19,21 +22,117 @@ const (
 	maxWallClockJumpSeconds      = 3600
 	minPowerAverageSeconds       = 1
 	maxPowerAverageSeconds       = 3600
+	maxPowerSmoothedSeconds      = 3600
+	minPowerRoundingMW           = 0
+	maxPowerRoundingMW           = 1000
+	minProcScanWorkers           = 1
+	maxProcScanWorkers           = 64
+	minCPUFreqChangeKHz          = 0
+	maxCPUFreqChangeKHz          = 10000000
+	minCPUFreqHeartbeatSeconds   = 1
+	maxCPUFreqHeartbeatSeconds   = 86400
+	minCPUBusyIntervalSeconds    = 0
+	maxCPUBusyIntervalSeconds    = 3600
+	minCPUBusyExponentPercent    = 25
+	maxCPUBusyExponentPercent    = 400
+	minFreqPowerExponentPercent  = 0
+	maxFreqPowerExponentPercent  = 400
+	minPowerRegressionPercent    = 0
+	maxPowerRegressionPercent    = 1000
+	minPowerRegressionMinutes    = 5
+	maxPowerRegressionMinutes    = 1440
 	minRetentionDays             = 1
 	maxRetentionDays             = 3650
 	minCleanupIntervalHours      = 1
 	maxCleanupIntervalHours      = 720
+	minMaxDeletePercent          = 1
+	maxMaxDeletePercent          = 100
+	minMaxSleepDays              = 1
+	maxMaxSleepDays              = 3650
+	minCommitIntervalSeconds     = 0
+	maxCommitIntervalSeconds     = 3600
+	minCommitMaxRows             = 1
+	maxCommitMaxRows             = 100000
+	minSnapshotIntervalMinutes   = 1
+	maxSnapshotIntervalMinutes   = 1440
+	minPowerSpikeWatts           = 1
+	maxPowerSpikeWatts           = 1000
+	minCapacityDropPercent       = 1
+	maxCapacityDropPercent       = 100
+	maxCoreLabelLength           = 32
+	maxDerivedSeries             = 16
+)
+
+// Values for StorageConfig.OnCorruption.
+const (
+	// OnCorruptionFail makes the daemon exit when the database is corrupt.
+	OnCorruptionFail = "fail"
+	// OnCorruptionRecover moves a corrupt database aside and starts fresh.
+	OnCorruptionRecover = "recover"
+)
+
+// Values for CollectionConfig.PowerQuantity.
+const (
+	// PowerQuantityAuto averages charge_now, or energy_now while a battery
+	// reporting both is under load.
+	PowerQuantityAuto = "auto"
+	// PowerQuantityCharge averages charge_now when the battery reports it.
+	PowerQuantityCharge = "charge"
+	// PowerQuantityEnergy averages energy_now when the battery reports it.
+	PowerQuantityEnergy = "energy"
+)
+
+// Values for CollectionConfig.WhVoltageBasis.
+const (
+	// WhBasisMinDesign converts charge to Wh at voltage_min_design.
+	WhBasisMinDesign = "min_design"
+	// WhBasisNominal converts charge to Wh at the midpoint of the battery's
+	// minimum and maximum design voltages.
+	WhBasisNominal = "nominal"
 )
 
 type Config struct {
-	Storage    StorageConfig    `toml:"storage"`
-	Collection CollectionConfig `toml:"collection"`
-	Cleanup    CleanupConfig    `toml:"cleanup"`
+	Storage     StorageConfig     `toml:"storage"`
+	Collection  CollectionConfig  `toml:"collection"`
+	Cleanup     CleanupConfig     `toml:"cleanup"`
+	Annotations AnnotationsConfig `toml:"annotations"`
+	Debug       DebugConfig       `toml:"debug"`
+	Derived     DerivedConfig     `toml:"derived"`
 }
 
 type StorageConfig struct {
 	DBPath       string `toml:"db_path"`
 	StateLogPath string `toml:"state_log_path"`
+	OnCorruption string `toml:"on_corruption"`
+	// StateLogArchiveDir, when set, keeps a timestamped copy of every
+	// consumed state log there, so sleep accounting bugs can be replayed
+	// from the exact hook input. Empty disables archiving.
+	StateLogArchiveDir string `toml:"state_log_archive_dir"`
+	// MaxSleepDays is the longest suspend or hibernate accepted from the
+	// state log. Longer ones (usually a wall clock that moved while asleep)
+	// are clamped to it and flagged as suspect.
+	MaxSleepDays int `toml:"max_sleep_days"`
+	// CommitIntervalSeconds, when positive, buffers battery, backlight,
+	// process and CPU frequency samples in memory and commits them in one
+	// transaction this often, or sooner once CommitMaxRows rows are pending.
+	// 0 commits each cycle's samples as they are collected.
+	CommitIntervalSeconds int `toml:"commit_interval_seconds"`
+	CommitMaxRows         int `toml:"commit_max_rows"`
+	// TmpfsDir, when set, keeps the live database in this directory (meant
+	// for a tmpfs such as /dev/shm) and snapshots it to DBPath every
+	// SnapshotIntervalMinutes and on shutdown. A crash or power loss loses
+	// everything since the last snapshot. Empty writes DBPath directly.
+	TmpfsDir                string `toml:"tmpfs_dir"`
+	SnapshotIntervalMinutes int    `toml:"snapshot_interval_minutes"`
+}
+
+// LiveDBPath returns the database file the daemon reads and writes: DBPath,
+// or a file of the same name in TmpfsDir when that is set.
+func (s StorageConfig) LiveDBPath() string {
+	if s.TmpfsDir == "" {
+		return s.DBPath
+	}
+	return filepath.Join(s.TmpfsDir, filepath.Base(s.DBPath))
 }
 
 type CollectionConfig struct {
@@ -41,28 +140,167 @@ type CollectionConfig struct {
 	TopProcesses                  int `toml:"top_processes"`
 	WallClockJumpThresholdSeconds int `toml:"wall_clock_jump_threshold_seconds"`
 	PowerAverageSeconds           int `toml:"power_average_seconds"`
+	// PowerSmoothedSeconds, when positive, adds a second, longer
+	// charge-delta average that clients show live, leaving the
+	// power_average_seconds one responsive for analysis. 0 turns it off.
+	PowerSmoothedSeconds int `toml:"power_smoothed_seconds"`
+	// PowerRoundingMW rounds the battery power readings to this many
+	// milliwatts before they are stored and served, dropping precision the
+	// firmware's charge quantization does not support. 0 keeps them as read.
+	PowerRoundingMW int `toml:"power_rounding_mw"`
+	// ProcScanWorkers bounds how many goroutines read /proc/<pid>/stat in
+	// parallel each cycle; 1 scans serially.
+	ProcScanWorkers int `toml:"proc_scan_workers"`
+	// PreferSysfsPower reports the battery's instantaneous power_now (or
+	// voltage × current) instead of the charge-delta average, which then
+	// only fills in when sysfs reports no power.
+	PreferSysfsPower bool `toml:"prefer_sysfs_power"`
+	// PowerQuantity picks the battery counter the averaged power is derived
+	// from when the battery reports both charge and energy: one of the
+	// PowerQuantity* values.
+	PowerQuantity string `toml:"power_quantity"`
+	// WhVoltageBasis is the voltage battery health converts charge
+	// capacities to Wh at: one of the WhBasis* values.
+	WhVoltageBasis string `toml:"wh_voltage_basis"`
+	// CPUFreqChangeKHz, when positive, stores a core's frequency only when it
+	// moved at least this far since the last stored sample, or when
+	// CPUFreqHeartbeatSeconds have passed. 0 stores every sample.
+	CPUFreqChangeKHz        int `toml:"cpu_freq_change_khz"`
+	CPUFreqHeartbeatSeconds int `toml:"cpu_freq_heartbeat_seconds"`
+	// CPUBusyIntervalSeconds is how often each core's busy fraction is read
+	// from /proc/stat and stored, averaged over the interval. 0 turns it off.
+	CPUBusyIntervalSeconds int `toml:"cpu_busy_interval_seconds"`
+	// CPUBusyExponentPercent is the exponent, in percent, each core's busy
+	// fraction is raised to when weighting the P-core vs E-core energy
+	// split; 100 weights linearly by busy time.
+	CPUBusyExponentPercent int `toml:"cpu_busy_exponent_percent"`
+	// FreqPowerExponentPercent is the exponent, in percent, of the
+	// frequency power scaling applied to each core's share of the P-core vs
+	// E-core energy split: power grows with (frequency/reference)^exponent.
+	// 0 turns frequency scaling off.
+	FreqPowerExponentPercent int `toml:"freq_power_exponent_percent"`
+	// PowerRegressionPercent flags idle power that stays this many percent
+	// above its rolling baseline for PowerRegressionMinutes. 0 turns the
+	// detector off.
+	PowerRegressionPercent int `toml:"power_regression_percent"`
+	PowerRegressionMinutes int `toml:"power_regression_minutes"`
+	// RefineDisplayModel records stable on-battery periods and fits display
+	// power against brightness from them, as a slower alternative to a
+	// calibration run.
+	RefineDisplayModel bool `toml:"refine_display_model"`
+	// ProcessesEnabled turns process and CPU frequency collection on. When
+	// off, no process names or command lines are recorded at all.
+	ProcessesEnabled bool `toml:"processes_enabled"`
+	// OnlyOnBattery pauses process and CPU frequency collection while AC
+	// power is online. Battery and backlight are still sampled.
+	OnlyOnBattery bool `toml:"only_on_battery"`
+	// BacklightDevice and BatteryDevice pin the /sys/class/backlight and
+	// /sys/class/power_supply entries to read, as a name or glob such as
+	// "amdgpu_bl*". Empty picks the internal panel and the first BAT*.
+	BacklightDevice string `toml:"backlight_device"`
+	BatteryDevice   string `toml:"battery_device"`
+	// PCoreLabel and ECoreLabel name the two CPU core classes in logs and
+	// the GUI, e.g. "big" and "little".
+	PCoreLabel string `toml:"p_core_label"`
+	ECoreLabel string `toml:"e_core_label"`
 }
 
 type CleanupConfig struct {
 	RetentionDays int `toml:"retention_days"`
 	IntervalHours int `toml:"interval_hours"`
+	// MaxDeletePercent caps the share of stored rows a single cleanup may
+	// delete; a larger cleanup is refused so a clock jumped far into the
+	// future cannot wipe the history. 100 disables the guard.
+	MaxDeletePercent int `toml:"max_delete_percent"`
+	// CPUBusyRetentionDays keeps CPU busy samples, one row per core per
+	// sample, for less time than the rest; retention_days still caps it.
+	CPUBusyRetentionDays int `toml:"cpu_busy_retention_days"`
+}
+
+// AnnotationsConfig selects the events the daemon annotates on the timeline
+// on its own, stored with source "auto" next to the user's annotations.
+type AnnotationsConfig struct {
+	// PowerSpikes annotates the draw on battery rising to at least
+	// PowerSpikeWatts; it must fall back below before the next one counts.
+	PowerSpikes     bool `toml:"power_spikes"`
+	PowerSpikeWatts int  `toml:"power_spike_watts"`
+	ACTransitions   bool `toml:"ac_transitions"`
+	// SuspendResume annotates where each sleep or shutdown began and ended.
+	SuspendResume   bool `toml:"suspend_resume"`
+	CalibrationRuns bool `toml:"calibration_runs"`
+	// CapacityDrops annotates a full-charge capacity at least
+	// CapacityDropPercent below the previous health snapshot.
+	CapacityDrops       bool `toml:"capacity_drops"`
+	CapacityDropPercent int  `toml:"capacity_drop_percent"`
+}
+
+// DebugConfig holds settings for triaging the daemon.
+type DebugConfig struct {
+	// DumpEnabled exposes the collectors' internal state through the
+	// DebugDump D-Bus method; it fails while this is off.
+	DumpEnabled bool `toml:"dump_enabled"`
+}
+
+// DerivedConfig holds the user-defined series served by GetDerivedSeries.
+type DerivedConfig struct {
+	Series []DerivedSeriesConfig `toml:"series"`
+}
+
+// DerivedSeriesConfig is one derived series: an arithmetic expression over
+// the series in derived.Variables, evaluated per time bucket.
+type DerivedSeriesConfig struct {
+	Name       string `toml:"name"`
+	Expression string `toml:"expression"`
+}
+
+// String formats the series as "name = expression", the form the reload log
+// and the GUI use.
+func (ds DerivedSeriesConfig) String() string {
+	return ds.Name + " = " + ds.Expression
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		Storage: StorageConfig{
-			DBPath:       "/var/lib/power-monitor/data.db",
-			StateLogPath: "/var/lib/power-monitor/state-log.jsonl",
+			DBPath:                  "/var/lib/power-monitor/data.db",
+			StateLogPath:            "/var/lib/power-monitor/state-log.jsonl",
+			OnCorruption:            OnCorruptionRecover,
+			MaxSleepDays:            30,
+			CommitMaxRows:           1000,
+			SnapshotIntervalMinutes: 15,
 		},
 		Collection: CollectionConfig{
 			IntervalSeconds:               5,
 			TopProcesses:                  10,
 			WallClockJumpThresholdSeconds: 15,
 			PowerAverageSeconds:           30,
+			ProcScanWorkers:               1,
+			PowerQuantity:                 PowerQuantityAuto,
+			WhVoltageBasis:                WhBasisMinDesign,
+			ProcessesEnabled:              true,
+			CPUFreqHeartbeatSeconds:       300,
+			CPUBusyIntervalSeconds:        30,
+			CPUBusyExponentPercent:        100,
+			FreqPowerExponentPercent:      200,
+			PowerRegressionPercent:        25,
+			PowerRegressionMinutes:        30,
+			PCoreLabel:                    "P-core",
+			ECoreLabel:                    "E-core",
 		},
 		Cleanup: CleanupConfig{
-			RetentionDays: 30,
-			IntervalHours: 24,
+			RetentionDays:        30,
+			IntervalHours:        24,
+			MaxDeletePercent:     90,
+			CPUBusyRetentionDays: 7,
+		},
+		Annotations: AnnotationsConfig{
+			PowerSpikes:         true,
+			PowerSpikeWatts:     30,
+			ACTransitions:       true,
+			SuspendResume:       true,
+			CalibrationRuns:     true,
+			CapacityDrops:       true,
+			CapacityDropPercent: 3,
 		},
 	}
 }
@@ -98,6 +336,52 @@ func NormalizeAndValidate(cfg *Config) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if strings.TrimSpace(sanitized.Storage.StateLogArchiveDir) != "" {
+		sanitized.Storage.StateLogArchiveDir, err = sanitizePath("storage.state_log_archive_dir", sanitized.Storage.StateLogArchiveDir)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		sanitized.Storage.StateLogArchiveDir = ""
+	}
+	if strings.TrimSpace(sanitized.Storage.TmpfsDir) != "" {
+		sanitized.Storage.TmpfsDir, err = sanitizePath("storage.tmpfs_dir", sanitized.Storage.TmpfsDir)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		sanitized.Storage.TmpfsDir = ""
+	}
+	sanitized.Storage.OnCorruption = strings.ToLower(strings.TrimSpace(sanitized.Storage.OnCorruption))
+	switch sanitized.Storage.OnCorruption {
+	case OnCorruptionFail, OnCorruptionRecover:
+	default:
+		return nil, fmt.Errorf("storage.on_corruption must be %q or %q, got %q", OnCorruptionFail, OnCorruptionRecover, cfg.Storage.OnCorruption)
+	}
+	sanitized.Collection.PowerQuantity = strings.ToLower(strings.TrimSpace(sanitized.Collection.PowerQuantity))
+	switch sanitized.Collection.PowerQuantity {
+	case PowerQuantityAuto, PowerQuantityCharge, PowerQuantityEnergy:
+	default:
+		return nil, fmt.Errorf("collection.power_quantity must be %q, %q or %q, got %q", PowerQuantityAuto, PowerQuantityCharge, PowerQuantityEnergy, cfg.Collection.PowerQuantity)
+	}
+	sanitized.Collection.WhVoltageBasis = strings.ToLower(strings.TrimSpace(sanitized.Collection.WhVoltageBasis))
+	switch sanitized.Collection.WhVoltageBasis {
+	case WhBasisMinDesign, WhBasisNominal:
+	default:
+		return nil, fmt.Errorf("collection.wh_voltage_basis must be %q or %q, got %q", WhBasisMinDesign, WhBasisNominal, cfg.Collection.WhVoltageBasis)
+	}
+	if err := validateRange("storage.max_sleep_days", sanitized.Storage.MaxSleepDays, minMaxSleepDays, maxMaxSleepDays); err != nil {
+		return nil, err
+	}
+	if err := validateRange("storage.commit_interval_seconds", sanitized.Storage.CommitIntervalSeconds, minCommitIntervalSeconds, maxCommitIntervalSeconds); err != nil {
+		return nil, err
+	}
+	if err := validateRange("storage.commit_max_rows", sanitized.Storage.CommitMaxRows, minCommitMaxRows, maxCommitMaxRows); err != nil {
+		return nil, err
+	}
+	if err := validateRange("storage.snapshot_interval_minutes", sanitized.Storage.SnapshotIntervalMinutes, minSnapshotIntervalMinutes, maxSnapshotIntervalMinutes); err != nil {
+		return nil, err
+	}
 
 	if err := validateRange("collection.interval_seconds", sanitized.Collection.IntervalSeconds, minCollectionIntervalSeconds, maxCollectionIntervalSeconds); err != nil {
 		return nil, err
@@ -111,12 +395,76 @@ func NormalizeAndValidate(cfg *Config) (*Config, error) {
 	if err := validateRange("collection.power_average_seconds", sanitized.Collection.PowerAverageSeconds, minPowerAverageSeconds, maxPowerAverageSeconds); err != nil {
 		return nil, err
 	}
+	if sanitized.Collection.PowerSmoothedSeconds != 0 {
+		if err := validateRange("collection.power_smoothed_seconds", sanitized.Collection.PowerSmoothedSeconds, sanitized.Collection.PowerAverageSeconds, maxPowerSmoothedSeconds); err != nil {
+			return nil, fmt.Errorf("%w (or 0 to turn it off)", err)
+		}
+	}
+	if err := validateRange("collection.power_rounding_mw", sanitized.Collection.PowerRoundingMW, minPowerRoundingMW, maxPowerRoundingMW); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.proc_scan_workers", sanitized.Collection.ProcScanWorkers, minProcScanWorkers, maxProcScanWorkers); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.cpu_freq_change_khz", sanitized.Collection.CPUFreqChangeKHz, minCPUFreqChangeKHz, maxCPUFreqChangeKHz); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.cpu_freq_heartbeat_seconds", sanitized.Collection.CPUFreqHeartbeatSeconds, minCPUFreqHeartbeatSeconds, maxCPUFreqHeartbeatSeconds); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.cpu_busy_interval_seconds", sanitized.Collection.CPUBusyIntervalSeconds, minCPUBusyIntervalSeconds, maxCPUBusyIntervalSeconds); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.cpu_busy_exponent_percent", sanitized.Collection.CPUBusyExponentPercent, minCPUBusyExponentPercent, maxCPUBusyExponentPercent); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.freq_power_exponent_percent", sanitized.Collection.FreqPowerExponentPercent, minFreqPowerExponentPercent, maxFreqPowerExponentPercent); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.power_regression_percent", sanitized.Collection.PowerRegressionPercent, minPowerRegressionPercent, maxPowerRegressionPercent); err != nil {
+		return nil, err
+	}
+	if err := validateRange("collection.power_regression_minutes", sanitized.Collection.PowerRegressionMinutes, minPowerRegressionMinutes, maxPowerRegressionMinutes); err != nil {
+		return nil, err
+	}
+	sanitized.Collection.BacklightDevice, err = sanitizeDevicePattern("collection.backlight_device", sanitized.Collection.BacklightDevice)
+	if err != nil {
+		return nil, err
+	}
+	sanitized.Collection.BatteryDevice, err = sanitizeDevicePattern("collection.battery_device", sanitized.Collection.BatteryDevice)
+	if err != nil {
+		return nil, err
+	}
+	sanitized.Collection.PCoreLabel, err = sanitizeLabel("collection.p_core_label", sanitized.Collection.PCoreLabel)
+	if err != nil {
+		return nil, err
+	}
+	sanitized.Collection.ECoreLabel, err = sanitizeLabel("collection.e_core_label", sanitized.Collection.ECoreLabel)
+	if err != nil {
+		return nil, err
+	}
 	if err := validateRange("cleanup.retention_days", sanitized.Cleanup.RetentionDays, minRetentionDays, maxRetentionDays); err != nil {
 		return nil, err
 	}
 	if err := validateRange("cleanup.interval_hours", sanitized.Cleanup.IntervalHours, minCleanupIntervalHours, maxCleanupIntervalHours); err != nil {
 		return nil, err
 	}
+	if err := validateRange("cleanup.max_delete_percent", sanitized.Cleanup.MaxDeletePercent, minMaxDeletePercent, maxMaxDeletePercent); err != nil {
+		return nil, err
+	}
+	if err := validateRange("cleanup.cpu_busy_retention_days", sanitized.Cleanup.CPUBusyRetentionDays, minRetentionDays, maxRetentionDays); err != nil {
+		return nil, err
+	}
+	if err := validateRange("annotations.power_spike_watts", sanitized.Annotations.PowerSpikeWatts, minPowerSpikeWatts, maxPowerSpikeWatts); err != nil {
+		return nil, err
+	}
+	if err := validateRange("annotations.capacity_drop_percent", sanitized.Annotations.CapacityDropPercent, minCapacityDropPercent, maxCapacityDropPercent); err != nil {
+		return nil, err
+	}
+	sanitized.Derived.Series, err = sanitizeDerivedSeries(sanitized.Derived.Series)
+	if err != nil {
+		return nil, err
+	}
 
 	return &sanitized, nil
 }
@@ -184,6 +532,59 @@ func sanitizePath(name, value string) (string, error) {
 	return cleaned, nil
 }
 
+// sanitizeDevicePattern trims a sysfs device name or glob and rejects values
+// that could not name a single entry of a device class.
+func sanitizeDevicePattern(name, value string) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	if strings.ContainsRune(trimmed, '/') || trimmed == "." || trimmed == ".." {
+		return "", fmt.Errorf("%s must be a device name or glob, got %q", name, value)
+	}
+	if _, err := filepath.Match(trimmed, ""); err != nil {
+		return "", fmt.Errorf("%s is not a valid glob %q: %w", name, value, err)
+	}
+	return trimmed, nil
+}
+
+// sanitizeLabel trims a display label and requires it to be non-empty and at
+// most maxCoreLabelLength characters.
+func sanitizeLabel(name, value string) (string, error) {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return "", fmt.Errorf("%s must not be empty", name)
+	}
+	if n := utf8.RuneCountInString(trimmed); n > maxCoreLabelLength {
+		return "", fmt.Errorf("%s must be at most %d characters, got %d", name, maxCoreLabelLength, n)
+	}
+	return trimmed, nil
+}
+
+// sanitizeDerivedSeries trims each series' name and expression into a new
+// slice, and checks that names are valid and unique and that every
+// expression parses.
+func sanitizeDerivedSeries(series []DerivedSeriesConfig) ([]DerivedSeriesConfig, error) {
+	if len(series) > maxDerivedSeries {
+		return nil, fmt.Errorf("derived.series has %d entries, at most %d allowed", len(series), maxDerivedSeries)
+	}
+	var out []DerivedSeriesConfig
+	seen := make(map[string]bool)
+	for _, ds := range series {
+		ds.Name = strings.TrimSpace(ds.Name)
+		ds.Expression = strings.TrimSpace(ds.Expression)
+		if err := derived.ValidateName(ds.Name); err != nil {
+			return nil, fmt.Errorf("derived.series: %w", err)
+		}
+		if seen[ds.Name] {
+			return nil, fmt.Errorf("derived.series: duplicate name %q", ds.Name)
+		}
+		seen[ds.Name] = true
+		if _, err := derived.Parse(ds.Expression); err != nil {
+			return nil, fmt.Errorf("derived.series %q: %w", ds.Name, err)
+		}
+		out = append(out, ds)
+	}
+	return out, nil
+}
+
 func validateRange(name string, value, min, max int) error {
 	if value < min || value > max {
 		return fmt.Errorf("%s must be between %d and %d, got %d", name, min, max, value)
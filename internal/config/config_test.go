@@ -79,12 +79,85 @@ interval_seconds = 8
 	if cfg.Collection.PowerAverageSeconds != 30 {
 		t.Fatalf("PowerAverageSeconds = %d, want default 30", cfg.Collection.PowerAverageSeconds)
 	}
+	if cfg.Collection.PowerSmoothedSeconds != 0 {
+		t.Fatalf("PowerSmoothedSeconds = %d, want default 0", cfg.Collection.PowerSmoothedSeconds)
+	}
+	if cfg.Collection.PowerRoundingMW != 0 {
+		t.Fatalf("PowerRoundingMW = %d, want default 0", cfg.Collection.PowerRoundingMW)
+	}
+	if cfg.Collection.ProcScanWorkers != 1 {
+		t.Fatalf("ProcScanWorkers = %d, want default 1", cfg.Collection.ProcScanWorkers)
+	}
+	if cfg.Collection.PreferSysfsPower {
+		t.Fatal("PreferSysfsPower = true, want default false")
+	}
+	if cfg.Collection.WhVoltageBasis != WhBasisMinDesign {
+		t.Fatalf("WhVoltageBasis = %q, want default %q", cfg.Collection.WhVoltageBasis, WhBasisMinDesign)
+	}
+	if cfg.Debug.DumpEnabled {
+		t.Fatal("Debug.DumpEnabled = true, want default false")
+	}
+	if cfg.Collection.PowerQuantity != PowerQuantityAuto {
+		t.Fatalf("PowerQuantity = %q, want default %q", cfg.Collection.PowerQuantity, PowerQuantityAuto)
+	}
+	if cfg.Collection.RefineDisplayModel {
+		t.Fatal("RefineDisplayModel = true, want default false")
+	}
+	if cfg.Collection.OnlyOnBattery {
+		t.Fatal("OnlyOnBattery = true, want default false")
+	}
+	if !cfg.Collection.ProcessesEnabled {
+		t.Fatal("ProcessesEnabled = false, want default true")
+	}
+	if cfg.Storage.StateLogArchiveDir != "" {
+		t.Fatalf("StateLogArchiveDir = %q, want default empty", cfg.Storage.StateLogArchiveDir)
+	}
+	if cfg.Collection.PCoreLabel != "P-core" || cfg.Collection.ECoreLabel != "E-core" {
+		t.Fatalf("PCoreLabel, ECoreLabel = %q, %q, want default P-core, E-core", cfg.Collection.PCoreLabel, cfg.Collection.ECoreLabel)
+	}
+	if cfg.Storage.MaxSleepDays != 30 {
+		t.Fatalf("MaxSleepDays = %d, want default 30", cfg.Storage.MaxSleepDays)
+	}
+	if cfg.Storage.TmpfsDir != "" || cfg.Storage.SnapshotIntervalMinutes != 15 {
+		t.Fatalf("TmpfsDir, SnapshotIntervalMinutes = %q, %d, want default \"\", 15", cfg.Storage.TmpfsDir, cfg.Storage.SnapshotIntervalMinutes)
+	}
+	if cfg.Storage.CommitIntervalSeconds != 0 || cfg.Storage.CommitMaxRows != 1000 {
+		t.Fatalf("CommitIntervalSeconds, CommitMaxRows = %d, %d, want default 0, 1000", cfg.Storage.CommitIntervalSeconds, cfg.Storage.CommitMaxRows)
+	}
+	if cfg.Collection.BacklightDevice != "" || cfg.Collection.BatteryDevice != "" {
+		t.Fatalf("BacklightDevice, BatteryDevice = %q, %q, want default empty", cfg.Collection.BacklightDevice, cfg.Collection.BatteryDevice)
+	}
+	if cfg.Collection.CPUFreqChangeKHz != 0 {
+		t.Fatalf("CPUFreqChangeKHz = %d, want default 0", cfg.Collection.CPUFreqChangeKHz)
+	}
+	if cfg.Collection.CPUFreqHeartbeatSeconds != 300 {
+		t.Fatalf("CPUFreqHeartbeatSeconds = %d, want default 300", cfg.Collection.CPUFreqHeartbeatSeconds)
+	}
+	if cfg.Collection.CPUBusyIntervalSeconds != 30 || cfg.Collection.CPUBusyExponentPercent != 100 {
+		t.Fatalf("CPUBusyIntervalSeconds, CPUBusyExponentPercent = %d, %d, want default 30, 100", cfg.Collection.CPUBusyIntervalSeconds, cfg.Collection.CPUBusyExponentPercent)
+	}
+	if cfg.Collection.PowerRegressionPercent != 25 || cfg.Collection.PowerRegressionMinutes != 30 {
+		t.Fatalf("PowerRegressionPercent, PowerRegressionMinutes = %d, %d, want default 25, 30", cfg.Collection.PowerRegressionPercent, cfg.Collection.PowerRegressionMinutes)
+	}
 	if cfg.Cleanup.RetentionDays != 30 {
 		t.Fatalf("RetentionDays = %d, want default 30", cfg.Cleanup.RetentionDays)
 	}
+	if cfg.Cleanup.CPUBusyRetentionDays != 7 {
+		t.Fatalf("CPUBusyRetentionDays = %d, want default 7", cfg.Cleanup.CPUBusyRetentionDays)
+	}
 	if cfg.Cleanup.IntervalHours != 24 {
 		t.Fatalf("IntervalHours = %d, want default 24", cfg.Cleanup.IntervalHours)
 	}
+	if cfg.Cleanup.MaxDeletePercent != 90 {
+		t.Fatalf("MaxDeletePercent = %d, want default 90", cfg.Cleanup.MaxDeletePercent)
+	}
+	wantAnnotations := AnnotationsConfig{
+		PowerSpikes: true, PowerSpikeWatts: 30, ACTransitions: true, SuspendResume: true,
+		CalibrationRuns: true, CapacityDrops: true, CapacityDropPercent: 3,
+	}
+	if cfg.Annotations != wantAnnotations {
+		t.Fatalf("Annotations = %+v, want default %+v", cfg.Annotations, wantAnnotations)
+	}
 }
 
 func TestLoad_MissingFile(t *testing.T) {
@@ -143,6 +216,103 @@ power_average_seconds = 0
 `,
 			wantErrSub: "collection.power_average_seconds must be between 1 and 3600",
 		},
+		{
+			name: "power_smoothed_seconds shorter than power_average_seconds",
+			contents: `
+[collection]
+power_average_seconds = 60
+power_smoothed_seconds = 30
+`,
+			wantErrSub: "collection.power_smoothed_seconds must be between 60 and 3600, got 30 (or 0 to turn it off)",
+		},
+		{
+			name: "power_rounding_mw too high",
+			contents: `
+[collection]
+power_rounding_mw = 1001
+`,
+			wantErrSub: "collection.power_rounding_mw must be between 0 and 1000",
+		},
+		{
+			name: "proc_scan_workers too high",
+			contents: `
+[collection]
+proc_scan_workers = 65
+`,
+			wantErrSub: "collection.proc_scan_workers must be between 1 and 64",
+		},
+		{
+			name: "negative cpu_freq_change_khz",
+			contents: `
+[collection]
+cpu_freq_change_khz = -1
+`,
+			wantErrSub: "collection.cpu_freq_change_khz must be between 0 and 10000000",
+		},
+		{
+			name: "zero cpu_freq_heartbeat_seconds",
+			contents: `
+[collection]
+cpu_freq_heartbeat_seconds = 0
+`,
+			wantErrSub: "collection.cpu_freq_heartbeat_seconds must be between 1 and 86400",
+		},
+		{
+			name: "negative cpu_busy_interval_seconds",
+			contents: `
+[collection]
+cpu_busy_interval_seconds = -1
+`,
+			wantErrSub: "collection.cpu_busy_interval_seconds must be between 0 and 3600",
+		},
+		{
+			name: "cpu_busy_exponent_percent too high",
+			contents: `
+[collection]
+cpu_busy_exponent_percent = 500
+`,
+			wantErrSub: "collection.cpu_busy_exponent_percent must be between 25 and 400",
+		},
+		{
+			name: "negative power_regression_percent",
+			contents: `
+[collection]
+power_regression_percent = -5
+`,
+			wantErrSub: "collection.power_regression_percent must be between 0 and 1000",
+		},
+		{
+			name: "power_regression_minutes too low",
+			contents: `
+[collection]
+power_regression_minutes = 1
+`,
+			wantErrSub: "collection.power_regression_minutes must be between 5 and 1440",
+		},
+		{
+			name: "unknown on_corruption",
+			contents: `
+[storage]
+on_corruption = "ignore"
+`,
+			wantErrSub: `storage.on_corruption must be "fail" or "recover", got "ignore"`,
+		},
+		{
+			name: "unknown power_quantity",
+			contents: `
+[collection]
+power_quantity = "voltage"
+`,
+			wantErrSub: `collection.power_quantity must be "auto", "charge" or "energy", got "voltage"`,
+		},
+		{
+			name: "unknown wh_voltage_basis",
+			contents: `
+[collection]
+wh_voltage_basis = "max_design"
+`,
+			wantErrSub: `collection.wh_voltage_basis must be "min_design" or "nominal", got "max_design"`,
+		},
 		{
 			name: "retention_days too low",
 			contents: `
@@ -159,6 +329,94 @@ interval_hours = 0
 `,
 			wantErrSub: "cleanup.interval_hours must be between 1 and 720",
 		},
+		{
+			name: "max_delete_percent too high",
+			contents: `
+[cleanup]
+max_delete_percent = 101
+`,
+			wantErrSub: "cleanup.max_delete_percent must be between 1 and 100",
+		},
+		{
+			name: "cpu_busy_retention_days too low",
+			contents: `
+[cleanup]
+cpu_busy_retention_days = 0
+`,
+			wantErrSub: "cleanup.cpu_busy_retention_days must be between 1 and 3650",
+		},
+		{
+			name: "power_spike_watts too low",
+			contents: `
+[annotations]
+power_spike_watts = 0
+`,
+			wantErrSub: "annotations.power_spike_watts must be between 1 and 1000",
+		},
+		{
+			name: "capacity_drop_percent too high",
+			contents: `
+[annotations]
+capacity_drop_percent = 101
+`,
+			wantErrSub: "annotations.capacity_drop_percent must be between 1 and 100",
+		},
+		{
+			name: "max_sleep_days too low",
+			contents: `
+[storage]
+max_sleep_days = 0
+`,
+			wantErrSub: "storage.max_sleep_days must be between 1 and 3650",
+		},
+		{
+			name: "commit_interval_seconds negative",
+			contents: `
+[storage]
+commit_interval_seconds = -1
+`,
+			wantErrSub: "storage.commit_interval_seconds must be between 0 and 3600",
+		},
+		{
+			name: "commit_max_rows too low",
+			contents: `
+[storage]
+commit_max_rows = 0
+`,
+			wantErrSub: "storage.commit_max_rows must be between 1 and 100000",
+		},
+		{
+			name: "snapshot_interval_minutes too low",
+			contents: `
+[storage]
+snapshot_interval_minutes = 0
+`,
+			wantErrSub: "storage.snapshot_interval_minutes must be between 1 and 1440",
+		},
+		{
+			name: "tmpfs_dir must be absolute",
+			contents: `
+[storage]
+tmpfs_dir = "shm"
+`,
+			wantErrSub: "storage.tmpfs_dir must be an absolute path",
+		},
+		{
+			name: "p_core_label must not be empty",
+			contents: `
+[collection]
+p_core_label = "  "
+`,
+			wantErrSub: "collection.p_core_label must not be empty",
+		},
+		{
+			name: "e_core_label too long",
+			contents: `
+[collection]
+e_core_label = "an extremely long name for the efficiency cores"
+`,
+			wantErrSub: "collection.e_core_label must be at most 32 characters",
+		},
 		{
 			name: "db_path must not be empty",
 			contents: `
@@ -175,6 +433,61 @@ state_log_path = "state.log"
 `,
 			wantErrSub: "storage.state_log_path must be an absolute path",
 		},
+		{
+			name: "state_log_archive_dir must be absolute",
+			contents: `
+[storage]
+state_log_archive_dir = "archive"
+`,
+			wantErrSub: "storage.state_log_archive_dir must be an absolute path",
+		},
+		{
+			name: "backlight_device with path",
+			contents: `
+[collection]
+backlight_device = "../backlight/intel_backlight"
+`,
+			wantErrSub: "collection.backlight_device must be a device name or glob",
+		},
+		{
+			name: "battery_device bad glob",
+			contents: `
+[collection]
+battery_device = "BAT["
+`,
+			wantErrSub: "collection.battery_device is not a valid glob",
+		},
+		{
+			name: "derived series bad name",
+			contents: `
+[[derived.series]]
+name = "Residual W"
+expression = "power"
+`,
+			wantErrSub: `derived.series: invalid series name "Residual W"`,
+		},
+		{
+			name: "derived series duplicate name",
+			contents: `
+[[derived.series]]
+name = "residual"
+expression = "power"
+
+[[derived.series]]
+name = "residual"
+expression = "power - cpu_est"
+`,
+			wantErrSub: `derived.series: duplicate name "residual"`,
+		},
+		{
+			name: "derived series unknown variable",
+			contents: `
+[[derived.series]]
+name = "residual"
+expression = "power - rapl"
+`,
+			wantErrSub: `derived.series "residual": offset 8: unknown series "rapl"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -192,10 +505,35 @@ state_log_path = "state.log"
 	}
 }
 
+func TestLoad_DerivedSeries(t *testing.T) {
+	path := writeTempConfig(t, `
+[[derived.series]]
+name = " residual "
+expression = " power - display_est - cpu_est "
+
+[[derived.series]]
+name = "display_share"
+expression = "display_est / power * 100"
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []DerivedSeriesConfig{
+		{Name: "residual", Expression: "power - display_est - cpu_est"},
+		{Name: "display_share", Expression: "display_est / power * 100"},
+	}
+	if !reflect.DeepEqual(cfg.Derived.Series, want) {
+		t.Fatalf("Derived.Series = %+v, want %+v", cfg.Derived.Series, want)
+	}
+}
+
 func TestNormalizeAndValidate_SanitizesPaths(t *testing.T) {
 	cfg := DefaultConfig()
 	cfg.Storage.DBPath = " /tmp/power-monitor/../data.db "
 	cfg.Storage.StateLogPath = " /var/lib/power-monitor//state-log.jsonl "
+	cfg.Collection.BacklightDevice = " amdgpu_bl* "
 
 	sanitized, err := NormalizeAndValidate(cfg)
 	if err != nil {
@@ -208,6 +546,9 @@ func TestNormalizeAndValidate_SanitizesPaths(t *testing.T) {
 	if sanitized.Storage.StateLogPath != "/var/lib/power-monitor/state-log.jsonl" {
 		t.Fatalf("StateLogPath = %q, want /var/lib/power-monitor/state-log.jsonl", sanitized.Storage.StateLogPath)
 	}
+	if sanitized.Collection.BacklightDevice != "amdgpu_bl*" {
+		t.Fatalf("BacklightDevice = %q, want amdgpu_bl*", sanitized.Collection.BacklightDevice)
+	}
 }
 
 func TestSave_RoundTrip(t *testing.T) {
@@ -229,3 +570,14 @@ func TestSave_RoundTrip(t *testing.T) {
 		t.Fatalf("Load() after Save() mismatch:\n got: %#v\nwant: %#v", loaded, cfg)
 	}
 }
+
+func TestLiveDBPath(t *testing.T) {
+	s := StorageConfig{DBPath: "/var/lib/power-monitor/data.db"}
+	if got := s.LiveDBPath(); got != s.DBPath {
+		t.Errorf("LiveDBPath() without tmpfs_dir = %q, want %q", got, s.DBPath)
+	}
+	s.TmpfsDir = "/dev/shm/power-monitor"
+	if got, want := s.LiveDBPath(), "/dev/shm/power-monitor/data.db"; got != want {
+		t.Errorf("LiveDBPath() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import "reflect"
+
+// hotKeys are the settings the daemon applies on reload without a restart.
+// Everything else is read once at startup.
+var hotKeys = map[string]bool{
+	"collection.interval_seconds":            true,
+	"collection.power_average_seconds":       true,
+	"collection.power_smoothed_seconds":      true,
+	"collection.power_rounding_mw":           true,
+	"collection.power_quantity":              true,
+	"collection.wh_voltage_basis":            true,
+	"cleanup.retention_days":                 true,
+	"cleanup.interval_hours":                 true,
+	"cleanup.max_delete_percent":             true,
+	"collection.p_core_label":                true,
+	"collection.e_core_label":                true,
+	"collection.processes_enabled":           true,
+	"collection.cpu_busy_interval_seconds":   true,
+	"collection.cpu_busy_exponent_percent":   true,
+	"collection.freq_power_exponent_percent": true,
+	"cleanup.cpu_busy_retention_days":        true,
+	"annotations.power_spikes":               true,
+	"annotations.power_spike_watts":          true,
+	"annotations.ac_transitions":             true,
+	"annotations.suspend_resume":             true,
+	"annotations.calibration_runs":           true,
+	"annotations.capacity_drops":             true,
+	"annotations.capacity_drop_percent":      true,
+	"debug.dump_enabled":                     true,
+	"derived.series":                         true,
+}
+
+// Change is one setting that differs between two configs.
+type Change struct {
+	Key string // TOML key, e.g. "collection.interval_seconds"
+	Old any
+	New any
+	Hot bool // applied on reload; otherwise the daemon must be restarted
+}
+
+// Diff lists the settings that differ between old and new, in file order.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	walkSettings(old, new, func(key string, o, n reflect.Value) {
+		if !reflect.DeepEqual(o.Interface(), n.Interface()) {
+			changes = append(changes, Change{Key: key, Old: o.Interface(), New: n.Interface(), Hot: hotKeys[key]})
+		}
+	})
+	return changes
+}
+
+// ApplyHot returns a copy of old with new's hot-reloadable settings applied
+// and all other settings kept, matching what a running daemon can honour.
+func ApplyHot(old, new *Config) *Config {
+	applied := *old
+	walkSettings(&applied, new, func(key string, o, n reflect.Value) {
+		if hotKeys[key] {
+			o.Set(n)
+		}
+	})
+	return &applied
+}
+
+// walkSettings calls fn with the "section.key" name and the matching field
+// values of a and b for every setting.
+func walkSettings(a, b *Config, fn func(key string, av, bv reflect.Value)) {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := range va.NumField() {
+		section := va.Type().Field(i).Tag.Get("toml")
+		sa, sb := va.Field(i), vb.Field(i)
+		for j := range sa.NumField() {
+			fn(section+"."+sa.Type().Field(j).Tag.Get("toml"), sa.Field(j), sb.Field(j))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := DefaultConfig()
+	if got := Diff(old, DefaultConfig()); len(got) != 0 {
+		t.Fatalf("Diff(default, default) = %v, want none", got)
+	}
+
+	next := DefaultConfig()
+	next.Storage.DBPath = "/tmp/other.db"
+	next.Collection.IntervalSeconds = 10
+	next.Cleanup.RetentionDays = 7
+
+	got := Diff(old, next)
+	want := []Change{
+		{Key: "storage.db_path", Old: "/var/lib/power-monitor/data.db", New: "/tmp/other.db", Hot: false},
+		{Key: "collection.interval_seconds", Old: 5, New: 10, Hot: true},
+		{Key: "cleanup.retention_days", Old: 30, New: 7, Hot: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Diff() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Diff()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiff_DerivedSeries(t *testing.T) {
+	old := DefaultConfig()
+	next := DefaultConfig()
+	next.Derived.Series = []DerivedSeriesConfig{{Name: "residual", Expression: "power - display_est"}}
+
+	got := Diff(old, next)
+	if len(got) != 1 || got[0].Key != "derived.series" || !got[0].Hot {
+		t.Fatalf("Diff() = %+v, want one hot derived.series change", got)
+	}
+	// The reload log prints the values with %+v.
+	if s := fmt.Sprintf("%+v -> %+v", got[0].Old, got[0].New); s != "[] -> [residual = power - display_est]" {
+		t.Fatalf("logged change = %q, want the series as name = expression", s)
+	}
+	if applied := ApplyHot(old, next); len(applied.Derived.Series) != 1 {
+		t.Fatalf("ApplyHot() derived series = %v, want the new series", applied.Derived.Series)
+	}
+}
+
+func TestApplyHot(t *testing.T) {
+	old := DefaultConfig()
+	next := DefaultConfig()
+	next.Storage.DBPath = "/tmp/other.db"
+	next.Collection.TopProcesses = 50
+	next.Collection.IntervalSeconds = 10
+	next.Collection.PowerAverageSeconds = 60
+	next.Cleanup.RetentionDays = 7
+
+	applied := ApplyHot(old, next)
+	if applied.Collection.IntervalSeconds != 10 || applied.Collection.PowerAverageSeconds != 60 || applied.Cleanup.RetentionDays != 7 {
+		t.Fatalf("ApplyHot() did not apply hot settings: %+v", applied)
+	}
+	if applied.Storage.DBPath != old.Storage.DBPath || applied.Collection.TopProcesses != old.Collection.TopProcesses {
+		t.Fatalf("ApplyHot() applied restart-only settings: %+v", applied)
+	}
+	if old.Collection.IntervalSeconds != 5 {
+		t.Fatalf("ApplyHot() modified old: IntervalSeconds = %d", old.Collection.IntervalSeconds)
+	}
+}
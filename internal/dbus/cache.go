@@ -0,0 +1,85 @@
+package dbus
+
+import "sync"
+
+// maxCachedQueries bounds the query cache. When it fills, the cache is
+// emptied rather than tracking recency; a GUI polls only a handful of
+// distinct ranges at a time.
+const maxCachedQueries = 64
+
+// queryKey identifies a cached range query. bucket is zero for methods that
+// take none.
+type queryKey struct {
+	method   string
+	from, to int64
+	bucket   int64
+}
+
+// queryCache holds marshalled replies for sample range queries. A reply stays
+// valid until a sample is inserted inside its range, so a dashboard polling
+// a fixed past range is served without rescanning the samples.
+type queryCache struct {
+	mu      sync.Mutex
+	entries map[queryKey]string
+	hits    uint64
+	misses  uint64
+	// gen counts invalidations. A reply computed across one may predate
+	// the change, so put drops it.
+	gen uint64
+}
+
+// get returns the cached reply for key and records a hit or miss. On a miss
+// it also returns the generation to pass to put with the computed reply.
+func (c *queryCache) get(key queryKey) (data string, gen uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok = c.entries[key]
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return data, c.gen, ok
+}
+
+// put stores a reply for key computed after the get that returned gen. The
+// reply is dropped if the cache was invalidated since, as it may miss the
+// samples that caused it.
+func (c *queryCache) put(key queryKey, gen uint64, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if c.entries == nil || len(c.entries) >= maxCachedQueries {
+		c.entries = make(map[queryKey]string)
+	}
+	c.entries[key] = data
+}
+
+// invalidate drops every reply whose range contains ts.
+func (c *queryCache) invalidate(ts int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for key := range c.entries {
+		if key.from <= ts && ts <= key.to {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// clear drops every reply.
+func (c *queryCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	c.entries = nil
+}
+
+// stats returns the hit and miss counts so far.
+func (c *queryCache) stats() (hits, misses uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
@@ -0,0 +1,175 @@
+package dbus
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestQueryCache_InvalidatesCoveringRanges(t *testing.T) {
+	var c queryCache
+	past := queryKey{method: "GetHistory", from: 0, to: 100}
+	live := queryKey{method: "GetHistory", from: 50, to: 200}
+	c.put(past, 0, "past")
+	c.put(live, 0, "live")
+
+	c.invalidate(150)
+	if _, _, ok := c.get(past); !ok {
+		t.Fatal("range ending before the insert was invalidated")
+	}
+	if _, _, ok := c.get(live); ok {
+		t.Fatal("range covering the insert is still cached")
+	}
+	if hits, misses := c.stats(); hits != 1 || misses != 1 {
+		t.Fatalf("stats() = %d hits, %d misses; want 1, 1", hits, misses)
+	}
+
+	c.clear()
+	if _, _, ok := c.get(past); ok {
+		t.Fatal("clear() left an entry behind")
+	}
+}
+
+func TestQueryCache_DropsReplyComputedAcrossInvalidation(t *testing.T) {
+	var c queryCache
+	key := queryKey{method: "GetHistory", from: 0, to: 200}
+
+	// A handler misses, a sample lands in its range while it queries, then
+	// it stores the reply it computed before the insert.
+	_, gen, ok := c.get(key)
+	if ok {
+		t.Fatal("get() on an empty cache hit")
+	}
+	c.invalidate(150)
+	c.put(key, gen, "stale")
+	if data, _, ok := c.get(key); ok {
+		t.Fatalf("get() = %q after put across invalidate, want a miss", data)
+	}
+
+	// The same across clear.
+	_, gen, _ = c.get(key)
+	c.clear()
+	c.put(key, gen, "stale")
+	if data, _, ok := c.get(key); ok {
+		t.Fatalf("get() = %q after put across clear, want a miss", data)
+	}
+
+	// Without an invalidation in between the reply is kept.
+	_, gen, _ = c.get(key)
+	c.put(key, gen, "fresh")
+	if data, _, ok := c.get(key); !ok || data != "fresh" {
+		t.Fatalf("get() = %q, %v; want the fresh reply", data, ok)
+	}
+}
+
+func TestQueryCache_Bounded(t *testing.T) {
+	var c queryCache
+	for i := range maxCachedQueries + 1 {
+		c.put(queryKey{method: "GetHistory", to: int64(i)}, 0, "x")
+	}
+	if len(c.entries) > maxCachedQueries {
+		t.Fatalf("cache holds %d entries, want at most %d", len(c.entries), maxCachedQueries)
+	}
+}
+
+func TestService_HistoryCache(t *testing.T) {
+	svc, db, _ := newTestService(t)
+	insert := func(ts int64) {
+		t.Helper()
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, CapacityPct: 80, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+		svc.SampleInserted(ts)
+	}
+	insert(100)
+
+	first, dbusErr := svc.GetHistory(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetHistory() error = %v", dbusErr)
+	}
+	if _, dbusErr := svc.GetHistoryBuckets(0, 200, 300); dbusErr != nil {
+		t.Fatalf("GetHistoryBuckets() error = %v", dbusErr)
+	}
+
+	// A sample past the range leaves the cached reply in place.
+	insert(300)
+	if got, _ := svc.GetHistory(0, 200); got != first {
+		t.Fatalf("GetHistory() after later insert = %s, want cached %s", got, first)
+	}
+	if hits, _ := svc.history.stats(); hits != 1 {
+		t.Fatalf("cache hits = %d, want 1", hits)
+	}
+
+	// A sample inside the range must show up.
+	insert(150)
+	got, _ := svc.GetHistory(0, 200)
+	if strings.Count(got, `"timestamp":150`) != 1 {
+		t.Fatalf("GetHistory() after insert in range = %s, want the new sample", got)
+	}
+	buckets, _ := svc.GetHistoryBuckets(0, 200, 300)
+	if !strings.Contains(buckets, `"count":2`) {
+		t.Fatalf("GetHistoryBuckets() after insert in range = %s, want the new sample counted", buckets)
+	}
+
+	// Pruning drops everything.
+	svc.HistoryPruned()
+	if _, _, ok := svc.history.get(queryKey{method: "GetHistory", from: 0, to: 200}); ok {
+		t.Fatal("HistoryPruned() left a cached reply")
+	}
+}
+
+func TestService_HistoryBucketsCacheWithWriteBuffer(t *testing.T) {
+	svc, db, _ := newTestService(t)
+	db.EnableWriteBuffer(100)
+	if err := db.InsertBatterySample(collector.BatterySample{Timestamp: 100, CapacityPct: 80, PowerUW: 5_000_000, Status: "Discharging"}); err != nil {
+		t.Fatalf("InsertBatterySample() error = %v", err)
+	}
+	svc.SampleInserted(100)
+
+	// The buffered sample is counted before its commit, so the cached reply
+	// still holds after the flush.
+	before, dbusErr := svc.GetHistoryBuckets(0, 200, 300)
+	if dbusErr != nil {
+		t.Fatalf("GetHistoryBuckets() error = %v", dbusErr)
+	}
+	if !strings.Contains(before, `"count":1`) {
+		t.Fatalf("GetHistoryBuckets() with a buffered sample = %s, want it counted", before)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	cached, _ := svc.GetHistoryBuckets(0, 200, 300)
+	svc.HistoryPruned() // compare against a fresh query
+	fresh, dbusErr := svc.GetHistoryBuckets(0, 200, 300)
+	if dbusErr != nil {
+		t.Fatalf("GetHistoryBuckets() error = %v", dbusErr)
+	}
+	if cached != fresh {
+		t.Fatalf("GetHistoryBuckets() after Flush = %s, want %s as queried afresh", cached, fresh)
+	}
+}
+
+// BenchmarkService_HistoryPolling simulates a GUI refreshing a fixed range
+// while the daemon keeps collecting: each poll follows a new sample stored
+// after the range, as on a dashboard showing an earlier hour.
+func BenchmarkService_HistoryPolling(b *testing.B) {
+	svc, db, _ := newTestService(b)
+	const from, to = 0, 3600
+	for ts := int64(from); ts <= to; ts += 5 {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, CapacityPct: 80, Status: "Discharging"}); err != nil {
+			b.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+
+	ts := int64(to)
+	for b.Loop() {
+		ts += 5
+		svc.SampleInserted(ts)
+		if _, err := svc.GetHistoryBuckets(from, to, 60); err != nil {
+			b.Fatalf("GetHistoryBuckets() error = %v", err)
+		}
+	}
+	hits, misses := svc.history.stats()
+	b.ReportMetric(float64(hits)/float64(hits+misses), "hit-rate")
+}
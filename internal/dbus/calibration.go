@@ -0,0 +1,125 @@
+package dbus
+
+import (
+	"fmt"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// CalibrationComplete is the payload of the CalibrationComplete signal.
+// Exactly one of Result or Error is set.
+type CalibrationComplete struct {
+	Result *calibration.CalibrationResult `json:"result,omitempty"`
+	Error  string                         `json:"error,omitempty"`
+}
+
+// calibrationRunner matches calibration.Run and is swapped out in tests.
+type calibrationRunner func(calibration.RunOptions, func(calibration.Progress)) (calibration.CalibrationResult, error)
+
+// RunCalibration starts a display calibration in the daemon process and
+// returns immediately. Progress is reported through CalibrationProgress
+// signals and the run ends with a CalibrationComplete signal. Only one run may
+// be active at a time. The caller must hold the CalibrateAction polkit
+// authorization, since the run pins CPUs and changes brightness as root.
+func (s *Service) RunCalibration(sender godbus.Sender) (string, *godbus.Error) {
+	authorize := s.authorize
+	if authorize == nil {
+		authorize = s.checkPolkit
+	}
+	if err := authorize(sender, CalibrateAction); err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("run calibration: %w", err))
+	}
+
+	s.calMu.Lock()
+	if s.calRunning {
+		s.calMu.Unlock()
+		return "", godbus.MakeFailedError(fmt.Errorf("calibration already running"))
+	}
+	s.calRunning = true
+	s.calMu.Unlock()
+
+	s.cfgMu.RLock()
+	collection := s.cfg.Collection
+	annotate := s.cfg.Annotations.CalibrationRuns
+	s.cfgMu.RUnlock()
+	started := time.Now().Unix()
+
+	run := s.runCalibration
+	if run == nil {
+		run = calibration.Run
+	}
+	go func() {
+		defer func() {
+			s.calMu.Lock()
+			s.calRunning = false
+			s.calMu.Unlock()
+		}()
+
+		result, err := run(calibration.RunOptions{
+			Sampler:        collector.NewBatteryCollector(30, false, collection.BatteryDevice),
+			Levels:         calibration.DefaultLevels,
+			SettleWait:     calibration.DefaultSettleWait,
+			SampleDuration: calibration.DefaultSampleDuration,
+			SamplePoll:     calibration.DefaultSamplePoll,
+			MaxStepWait:    calibration.DefaultMaxStepWait,
+			Backlight:      collection.BacklightDevice,
+		}, func(p calibration.Progress) {
+			s.emitJSON("CalibrationProgress", p)
+		})
+
+		var done CalibrationComplete
+		if err != nil {
+			s.log.Error("calibration run failed", "err", err)
+			done.Error = err.Error()
+		} else {
+			done.Result = &result
+		}
+		if annotate {
+			s.annotateCalibration(started, err)
+		}
+		s.emitJSON("CalibrationComplete", done)
+	}()
+
+	data, err := marshalReply(map[string]bool{"started": true})
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// annotateCalibration marks a calibration run started at the given time on
+// the timeline.
+func (s *Service) annotateCalibration(started int64, runErr error) {
+	text := "Calibration run"
+	if runErr != nil {
+		text = "Calibration run failed"
+	}
+	a := collector.Annotation{Timestamp: started, Text: text, Source: collector.AnnotationSourceAuto}
+	if _, err := s.store.InsertAnnotation(a); err != nil {
+		s.log.Error("store calibration annotation", "err", err)
+	}
+}
+
+// emitJSON marshals v and emits it as the single string argument of the named
+// signal on the service interface.
+func (s *Service) emitJSON(signal string, v any) {
+	data, err := marshalReply(v)
+	if err != nil {
+		s.log.Error("marshal signal", "signal", signal, "err", err)
+		return
+	}
+	if s.emit != nil {
+		s.emit(signal, string(data))
+		return
+	}
+	if s.conn == nil {
+		return
+	}
+	if err := s.conn.Emit(ObjPath, IfaceName+"."+signal, string(data)); err != nil {
+		s.log.Warn("emit signal", "signal", signal, "err", err)
+	}
+}
@@ -0,0 +1,54 @@
+package dbus
+
+import (
+	"fmt"
+	"time"
+
+	godbus "github.com/godbus/dbus/v5"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// debugDumpTimeout bounds how long DebugDump waits for the daemon loop,
+// which answers between collection cycles.
+var debugDumpTimeout = 5 * time.Second
+
+// DebugRequests returns the channel DebugDump asks for the collectors' state
+// on. The collectors are not safe for concurrent use, so the daemon loop that
+// owns them answers each request by sending one DebugState on it.
+func (s *Service) DebugRequests() <-chan chan<- collector.DebugState {
+	return s.debugReqs
+}
+
+// DebugDump returns the collectors' internal state and recent collection
+// timings as JSON, for live triage. It fails unless debug.dump_enabled is set.
+func (s *Service) DebugDump() (string, *godbus.Error) {
+	s.cfgMu.RLock()
+	enabled := s.cfg.Debug.DumpEnabled
+	s.cfgMu.RUnlock()
+	if !enabled {
+		return "", godbus.MakeFailedError(fmt.Errorf("debug dump is disabled; set debug.dump_enabled = true"))
+	}
+
+	timeout := time.NewTimer(debugDumpTimeout)
+	defer timeout.Stop()
+	reply := make(chan collector.DebugState, 1) // buffered so a late answer does not block the loop
+	select {
+	case s.debugReqs <- reply:
+	case <-timeout.C:
+		return "", godbus.MakeFailedError(fmt.Errorf("daemon loop did not take the request within %s", debugDumpTimeout))
+	}
+	var state collector.DebugState
+	select {
+	case state = <-reply:
+	case <-timeout.C:
+		return "", godbus.MakeFailedError(fmt.Errorf("daemon loop did not answer within %s", debugDumpTimeout))
+	}
+
+	result := map[string]any{"collectors": state, "timings": s.timings.Summary()}
+	data, err := marshalReply(result)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
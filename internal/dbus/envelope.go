@@ -0,0 +1,20 @@
+package dbus
+
+import "encoding/json"
+
+// APIVersion is the version of the JSON payload shapes returned by the
+// service's methods and signals. Adding fields keeps the version; bump it
+// when a field is removed, renamed or changes meaning, so clients can refuse
+// payloads they would misread.
+const APIVersion = 1
+
+// envelope wraps every JSON payload the service sends.
+type envelope struct {
+	V    int `json:"v"`
+	Data any `json:"data"`
+}
+
+// marshalReply marshals v inside a version envelope: {"v":1,"data":v}.
+func marshalReply(v any) ([]byte, error) {
+	return json.Marshal(envelope{V: APIVersion, Data: v})
+}
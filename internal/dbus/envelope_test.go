@@ -0,0 +1,54 @@
+package dbus
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// decodeReply unmarshals the data of a versioned reply into v.
+func decodeReply(raw string, v any) error {
+	var env struct {
+		V    int             `json:"v"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		return err
+	}
+	if env.V != APIVersion {
+		return fmt.Errorf("reply version %d, want %d", env.V, APIVersion)
+	}
+	return json.Unmarshal(env.Data, v)
+}
+
+func TestMarshalReply(t *testing.T) {
+	data, err := marshalReply([]int{1, 2})
+	if err != nil {
+		t.Fatalf("marshalReply() error = %v", err)
+	}
+	if got, want := string(data), `{"v":1,"data":[1,2]}`; got != want {
+		t.Fatalf("marshalReply() = %s, want %s", got, want)
+	}
+}
+
+func TestService_RepliesAreVersioned(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	stats, dbusErr := svc.GetCurrentStats()
+	if dbusErr != nil {
+		t.Fatalf("GetCurrentStats() error = %v", dbusErr)
+	}
+	rates, dbusErr := svc.GetSuspendDrainRates(0, 100)
+	if dbusErr != nil {
+		t.Fatalf("GetSuspendDrainRates() error = %v", dbusErr)
+	}
+	for _, raw := range []string{stats, rates} {
+		var data any
+		if err := decodeReply(raw, &data); err != nil {
+			t.Fatalf("decodeReply(%s) error = %v", raw, err)
+		}
+	}
+	if want := `{"v":1,"data":[]}`; rates != want {
+		t.Fatalf("GetSuspendDrainRates(empty) = %s, want %s", rates, want)
+	}
+}
@@ -0,0 +1,55 @@
+package dbus
+
+import (
+	"fmt"
+
+	godbus "github.com/godbus/dbus/v5"
+)
+
+// CalibrateAction is the polkit action that guards RunCalibration, defined in
+// packaging/org.gnome.PowerMonitor.policy.
+const CalibrateAction = "org.gnome.PowerMonitor.calibrate"
+
+// polkitAllowUserInteraction lets polkit ask the caller's authentication
+// agent for a password instead of denying outright.
+const polkitAllowUserInteraction = 1
+
+// authorizer reports whether the bus name sender may perform a polkit action.
+// It is swapped out in tests.
+type authorizer func(sender godbus.Sender, action string) error
+
+// polkitSubject is a polkit subject identifying a caller by its bus name.
+type polkitSubject struct {
+	Kind    string
+	Details map[string]godbus.Variant
+}
+
+// polkitResult is the reply of polkit's CheckAuthorization.
+type polkitResult struct {
+	IsAuthorized bool
+	IsChallenge  bool
+	Details      map[string]string
+}
+
+// checkPolkit asks polkit whether sender may perform action. The bus policy
+// lets any user call the service, so methods acting on the system as root
+// check this first.
+func (s *Service) checkPolkit(sender godbus.Sender, action string) error {
+	if s.conn == nil {
+		return fmt.Errorf("check authorization: not connected to the bus")
+	}
+	subject := polkitSubject{
+		Kind:    "system-bus-name",
+		Details: map[string]godbus.Variant{"name": godbus.MakeVariant(string(sender))},
+	}
+	var result polkitResult
+	authority := s.conn.Object("org.freedesktop.PolicyKit1", "/org/freedesktop/PolicyKit1/Authority")
+	if err := authority.Call("org.freedesktop.PolicyKit1.Authority.CheckAuthorization", 0,
+		subject, action, map[string]string{}, uint32(polkitAllowUserInteraction), "").Store(&result); err != nil {
+		return fmt.Errorf("check authorization: %w", err)
+	}
+	if !result.IsAuthorized {
+		return fmt.Errorf("not authorized for %s", action)
+	}
+	return nil
+}
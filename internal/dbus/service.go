@@ -3,12 +3,16 @@ package dbus
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"math"
 	"strings"
 	"sync"
+	"time"
 
 	godbus "github.com/godbus/dbus/v5"
 	"github.com/godbus/dbus/v5/introspect"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/config"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/storage"
@@ -20,6 +24,9 @@ const (
 	IfaceName = "org.gnome.PowerMonitor"
 
 	maxConfigPayloadBytes = 64 * 1024
+	maxHistoryBuckets     = 10000
+	maxHistogramBuckets   = 1000
+	maxAnnotationBytes    = 256
 )
 
 const introspectXML = `
@@ -33,19 +40,106 @@ const introspectXML = `
       <arg direction="in" type="x" name="to_epoch"/>
       <arg direction="out" type="s" name="json"/>
     </method>
+    <method name="GetHistoryBuckets">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="in" type="x" name="bucket_secs"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetPowerHistogram">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="in" type="i" name="buckets"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetPowerPercentiles">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
     <method name="GetPowerStateEvents">
       <arg direction="in" type="x" name="from_epoch"/>
       <arg direction="in" type="x" name="to_epoch"/>
       <arg direction="out" type="s" name="json"/>
     </method>
+    <method name="GetSuspendDrainRates">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetThrottleEvents">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetBatteryPresenceEvents">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetIdleIntervals">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetCPUBusyHistory">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetCollectionTimings">
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="DebugDump">
+      <arg direction="out" type="s" name="json"/>
+    </method>
     <method name="GetBatteryHealth">
       <arg direction="out" type="s" name="json"/>
     </method>
+    <method name="GetChargeThresholds">
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetCapacityDrops">
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetChargeCycles">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetDisplayPowerModel">
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetDerivedSeries">
+      <arg direction="in" type="s" name="name"/>
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
     <method name="GetProcessHistory">
       <arg direction="in" type="x" name="from_epoch"/>
       <arg direction="in" type="x" name="to_epoch"/>
       <arg direction="out" type="s" name="json"/>
     </method>
+    <method name="GetCoreClassEnergy">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="in" type="x" name="baseline_uw"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="AddAnnotation">
+      <arg direction="in" type="x" name="timestamp"/>
+      <arg direction="in" type="s" name="text"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetAnnotations">
+      <arg direction="in" type="x" name="from_epoch"/>
+      <arg direction="in" type="x" name="to_epoch"/>
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="DeleteAnnotation">
+      <arg direction="in" type="x" name="id"/>
+    </method>
     <method name="GetConfig">
       <arg direction="out" type="s" name="json"/>
     </method>
@@ -53,6 +147,21 @@ const introspectXML = `
       <arg direction="in" type="s" name="config_json"/>
       <arg direction="out" type="s" name="json"/>
     </method>
+    <method name="RunCalibration">
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <method name="GetPowerRegression">
+      <arg direction="out" type="s" name="json"/>
+    </method>
+    <signal name="PowerRegression">
+      <arg type="s" name="json"/>
+    </signal>
+    <signal name="CalibrationProgress">
+      <arg type="s" name="json"/>
+    </signal>
+    <signal name="CalibrationComplete">
+      <arg type="s" name="json"/>
+    </signal>
   </interface>
 ` + introspect.IntrospectDataString + `
 </node>`
@@ -60,13 +169,38 @@ const introspectXML = `
 // Service exposes the power monitor over D-Bus.
 type Service struct {
 	store      *storage.DB
+	log        *slog.Logger
 	cfgMu      sync.RWMutex
-	cfg        *config.Config
+	cfg        *config.Config // settings in effect
+	fileCfg    *config.Config // config file contents, reported by GetConfig
 	configPath string
+	started    time.Time // when the service was created, reported as daemon_started
+
+	// history caches GetHistory and GetHistoryBuckets replies; the daemon
+	// invalidates it through SampleInserted and HistoryPruned.
+	history queryCache
+
+	// timings holds per-collector durations recorded by the daemon loop.
+	timings collector.CollectTimings
+
+	// debugReqs carries DebugDump requests to the daemon loop, which owns
+	// the collectors; see DebugRequests.
+	debugReqs chan chan<- collector.DebugState
+
+	regressionMu sync.Mutex
+	regression   *collector.PowerRegression // latest report, nil if none yet
+
+	conn           *godbus.Conn
+	calMu          sync.Mutex
+	calRunning     bool
+	runCalibration calibrationRunner            // nil means calibration.Run
+	authorize      authorizer                   // nil means checkPolkit
+	emit           func(signal, payload string) // test hook; nil emits on conn
 }
 
-// NewService creates a new D-Bus service.
-func NewService(store *storage.DB, cfg *config.Config, configPath string) (*Service, error) {
+// NewService creates a new D-Bus service. logger receives errors from work
+// the service does outside a method call, such as calibration runs.
+func NewService(store *storage.DB, cfg *config.Config, configPath string, logger *slog.Logger) (*Service, error) {
 	trimmedConfigPath := strings.TrimSpace(configPath)
 	if trimmedConfigPath == "" {
 		return nil, fmt.Errorf("config path must not be empty")
@@ -75,7 +209,8 @@ func NewService(store *storage.DB, cfg *config.Config, configPath string) (*Serv
 	if err != nil {
 		return nil, fmt.Errorf("sanitize config: %w", err)
 	}
-	return &Service{store: store, cfg: sanitizedCfg, configPath: trimmedConfigPath}, nil
+	return &Service{store: store, log: logger, cfg: sanitizedCfg, fileCfg: sanitizedCfg, configPath: trimmedConfigPath, started: time.Now(),
+		debugReqs: make(chan chan<- collector.DebugState)}, nil
 }
 
 // Export registers the service on the system bus.
@@ -102,10 +237,54 @@ func (s *Service) Export() (*godbus.Conn, error) {
 		return nil, fmt.Errorf("name %s already taken", BusName)
 	}
 
+	s.conn = conn
 	return conn, nil
 }
 
-// GetCurrentStats returns the latest battery and backlight data as JSON.
+// SampleInserted tells the service a battery or backlight sample was stored
+// at ts, dropping cached history replies whose range covers it.
+func (s *Service) SampleInserted(ts int64) {
+	s.history.invalidate(ts)
+}
+
+// HistoryPruned tells the service old samples were deleted, dropping every
+// cached history reply.
+func (s *Service) HistoryPruned() {
+	s.history.clear()
+}
+
+// RecordCollectTime records how long the named collector took in one
+// collection cycle, for GetCollectionTimings.
+func (s *Service) RecordCollectTime(name string, d time.Duration) {
+	s.timings.Record(name, d)
+}
+
+// ReportPowerRegression records a power regression being raised or cleared
+// and emits it as the PowerRegression signal.
+func (s *Service) ReportPowerRegression(r collector.PowerRegression) {
+	s.regressionMu.Lock()
+	s.regression = &r
+	s.regressionMu.Unlock()
+	s.emitJSON("PowerRegression", r)
+}
+
+// GetPowerRegression returns the latest power regression report as JSON, or
+// null if none was raised since the daemon started. A report with active
+// false has cleared.
+func (s *Service) GetPowerRegression() (string, *godbus.Error) {
+	s.regressionMu.Lock()
+	r := s.regression
+	s.regressionMu.Unlock()
+	data, err := marshalReply(r)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetCurrentStats returns the latest battery and backlight data as JSON, along
+// with the configured collection interval so clients can judge sample spacing
+// and an EWMA-smoothed power for display.
 func (s *Service) GetCurrentStats() (string, *godbus.Error) {
 	bat, err := s.store.LatestBatterySample()
 	if err != nil {
@@ -115,8 +294,21 @@ func (s *Service) GetCurrentStats() (string, *godbus.Error) {
 	if err != nil {
 		return "", godbus.MakeFailedError(fmt.Errorf("query backlight sample: %w", err))
 	}
-	result := map[string]any{"battery": bat, "backlight": bl}
-	data, err := json.Marshal(result)
+	// Smooth the displayed power over recent samples; the raw reading stays
+	// in battery.power_uw.
+	var powerEWMA int64
+	if bat != nil {
+		recent, err := s.store.BatterySamplesInRange(bat.Timestamp-5*collector.DefaultPowerEWMASeconds, bat.Timestamp)
+		if err != nil {
+			return "", godbus.MakeFailedError(fmt.Errorf("query recent battery samples: %w", err))
+		}
+		powerEWMA = collector.PowerEWMA(recent, collector.DefaultPowerEWMASeconds)
+	}
+	s.cfgMu.RLock()
+	interval := s.cfg.Collection.IntervalSeconds
+	s.cfgMu.RUnlock()
+	result := map[string]any{"battery": bat, "backlight": bl, "interval_seconds": interval, "power_ewma_uw": powerEWMA, "daemon_started": s.started.Unix()}
+	data, err := marshalReply(result)
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
@@ -128,6 +320,11 @@ func (s *Service) GetHistory(fromEpoch, toEpoch int64) (string, *godbus.Error) {
 	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
 		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
 	}
+	key := queryKey{method: "GetHistory", from: fromEpoch, to: toEpoch}
+	cached, gen, ok := s.history.get(key)
+	if ok {
+		return cached, nil
+	}
 	bat, err := s.store.BatterySamplesInRange(fromEpoch, toEpoch)
 	if err != nil {
 		return "", godbus.MakeFailedError(fmt.Errorf("query battery samples: %w", err))
@@ -137,7 +334,82 @@ func (s *Service) GetHistory(fromEpoch, toEpoch int64) (string, *godbus.Error) {
 		return "", godbus.MakeFailedError(fmt.Errorf("query backlight samples: %w", err))
 	}
 	result := map[string]any{"battery": bat, "backlight": bl}
-	data, err := json.Marshal(result)
+	data, err := marshalReply(result)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	s.history.put(key, gen, string(data))
+	return string(data), nil
+}
+
+// GetHistoryBuckets returns battery samples in a time range aggregated into
+// bucket_secs-wide buckets with min/max/avg capacity and power, as JSON.
+func (s *Service) GetHistoryBuckets(fromEpoch, toEpoch, bucketSecs int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	if bucketSecs <= 0 || (toEpoch-fromEpoch)/bucketSecs > maxHistoryBuckets {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid bucket size %d for range %d-%d", bucketSecs, fromEpoch, toEpoch))
+	}
+	key := queryKey{method: "GetHistoryBuckets", from: fromEpoch, to: toEpoch, bucket: bucketSecs}
+	cached, gen, ok := s.history.get(key)
+	if ok {
+		return cached, nil
+	}
+	buckets, err := s.store.BatteryBucketsInRange(fromEpoch, toEpoch, bucketSecs)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query battery buckets: %w", err))
+	}
+	if buckets == nil {
+		buckets = []collector.BatteryBucket{}
+	}
+	data, err := marshalReply(buckets)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	s.history.put(key, gen, string(data))
+	return string(data), nil
+}
+
+// GetPowerHistogram returns the distribution of discharging battery power
+// readings in a time range as JSON: equal-width power buckets with sample counts.
+func (s *Service) GetPowerHistogram(fromEpoch, toEpoch int64, numBuckets int32) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	if numBuckets <= 0 || numBuckets > maxHistogramBuckets {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid bucket count %d (must be 1-%d)", numBuckets, maxHistogramBuckets))
+	}
+	buckets, err := s.store.PowerHistogram(fromEpoch, toEpoch, int(numBuckets))
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query power histogram: %w", err))
+	}
+	if buckets == nil {
+		buckets = []collector.PowerHistogramBucket{}
+	}
+	total := 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	result := map[string]any{"buckets": buckets, "total": total}
+	data, err := marshalReply(result)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetPowerPercentiles returns the p50/p90/p99 battery power draw while
+// discharging in a time range as JSON.
+func (s *Service) GetPowerPercentiles(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	pp, err := s.store.PowerPercentiles(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query power percentiles: %w", err))
+	}
+	data, err := marshalReply(pp)
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
@@ -153,7 +425,117 @@ func (s *Service) GetPowerStateEvents(fromEpoch, toEpoch int64) (string, *godbus
 	if err != nil {
 		return "", godbus.MakeFailedError(fmt.Errorf("query power state events: %w", err))
 	}
-	data, err := json.Marshal(events)
+	data, err := marshalReply(events)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetSuspendDrainRates returns the battery drain rate of each suspend in a
+// time range, with its rolling average, as JSON.
+func (s *Service) GetSuspendDrainRates(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	events, err := s.store.PowerStateEventsInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query power state events: %w", err))
+	}
+	rates := collector.SuspendDrainRates(events)
+	if rates == nil {
+		rates = []collector.SuspendDrainRate{}
+	}
+	data, err := marshalReply(rates)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetThrottleEvents returns CPU throttling intervals overlapping a time range
+// as JSON.
+func (s *Service) GetThrottleEvents(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	events, err := s.store.ThrottleEventsInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query throttle events: %w", err))
+	}
+	data, err := marshalReply(events)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetBatteryPresenceEvents returns battery removals and reinsertions in a
+// time range as JSON.
+func (s *Service) GetBatteryPresenceEvents(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	events, err := s.store.BatteryPresenceEventsInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query battery presence events: %w", err))
+	}
+	data, err := marshalReply(events)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetIdleIntervals returns user-idle intervals overlapping a time range as
+// JSON.
+func (s *Service) GetIdleIntervals(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	intervals, err := s.store.IdleIntervalsInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query idle intervals: %w", err))
+	}
+	if intervals == nil {
+		intervals = []collector.IdleInterval{}
+	}
+	data, err := marshalReply(intervals)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetCPUBusyHistory returns per-core busy fraction samples whose period ends
+// within a time range as JSON.
+func (s *Service) GetCPUBusyHistory(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	samples, err := s.store.CPUBusySamplesInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query CPU busy samples: %w", err))
+	}
+	if samples == nil {
+		samples = []collector.CPUBusySample{}
+	}
+	data, err := marshalReply(samples)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetCollectionTimings returns min/avg/max/p99 durations of each collector
+// over recent cycles, with the configured interval to compare them against,
+// as JSON.
+func (s *Service) GetCollectionTimings() (string, *godbus.Error) {
+	s.cfgMu.RLock()
+	interval := s.cfg.Collection.IntervalSeconds
+	s.cfgMu.RUnlock()
+	result := map[string]any{"interval_seconds": interval, "collectors": s.timings.Summary()}
+	data, err := marshalReply(result)
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
@@ -162,18 +544,97 @@ func (s *Service) GetPowerStateEvents(fromEpoch, toEpoch int64) (string, *godbus
 
 // GetBatteryHealth returns battery identity and health info as JSON.
 func (s *Service) GetBatteryHealth() (string, *godbus.Error) {
-	health, err := collector.CollectBatteryHealth()
+	s.cfgMu.RLock()
+	battery := s.cfg.Collection.BatteryDevice
+	basis := collector.WhVoltageBasis(s.cfg.Collection.WhVoltageBasis)
+	s.cfgMu.RUnlock()
+	health, err := collector.CollectBatteryHealth(battery)
 	if err != nil {
 		return "", godbus.MakeFailedError(fmt.Errorf("collect battery health: %w", err))
 	}
-	data, err := json.Marshal(health)
+	health.SetWhBasis(basis)
+	data, err := marshalReply(health)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetChargeThresholds returns the charge_control start/end thresholds of
+// every battery as a JSON object keyed by battery name.
+func (s *Service) GetChargeThresholds() (string, *godbus.Error) {
+	thresholds, err := collector.CollectChargeThresholds()
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("collect charge thresholds: %w", err))
+	}
+	data, err := marshalReply(thresholds)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetCapacityDrops returns the full-charge capacity drops of at least
+// annotations.capacity_drop_percent detected across all stored battery health
+// snapshots as JSON, the same drops the daemon annotates.
+func (s *Service) GetCapacityDrops() (string, *godbus.Error) {
+	s.cfgMu.RLock()
+	minDropPct := float64(s.cfg.Annotations.CapacityDropPercent)
+	s.cfgMu.RUnlock()
+	snapshots, err := s.store.BatteryHealthSnapshots()
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query battery health snapshots: %w", err))
+	}
+	drops := collector.DetectCapacityDrops(snapshots, minDropPct)
+	if drops == nil {
+		drops = []collector.CapacityDrop{}
+	}
+	data, err := marshalReply(drops)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetChargeCycles estimates the charge cycles put on the battery in the
+// time range from stored samples, with the firmware counter's increase over
+// the same range, as JSON.
+func (s *Service) GetChargeCycles(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	discharge, err := s.store.DischargeInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query discharge: %w", err))
+	}
+	snapshots, err := s.store.BatteryHealthSnapshots()
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query battery health snapshots: %w", err))
+	}
+	data, err := marshalReply(collector.EstimateChargeCycles(discharge, snapshots, fromEpoch, toEpoch))
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetDisplayPowerModel returns the background display power model, fitted
+// over all stored model points, as JSON.
+func (s *Service) GetDisplayPowerModel() (string, *godbus.Error) {
+	points, err := s.store.DisplayModelPointsInRange(0, math.MaxInt64)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query display model points: %w", err))
+	}
+	data, err := marshalReply(calibration.FitDisplayModel(points))
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
 	return string(data), nil
 }
 
-// GetProcessHistory returns process CPU usage and CPU frequency samples in a time range as JSON.
+// GetProcessHistory returns process CPU usage and CPU frequency samples in a
+// time range as JSON, with the lifetimes of the processes active in it and
+// whether process collection is currently enabled.
 func (s *Service) GetProcessHistory(fromEpoch, toEpoch int64) (string, *godbus.Error) {
 	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
 		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
@@ -182,32 +643,201 @@ func (s *Service) GetProcessHistory(fromEpoch, toEpoch int64) (string, *godbus.E
 	if err != nil {
 		return "", godbus.MakeFailedError(fmt.Errorf("query process samples: %w", err))
 	}
-	freqs, err := s.store.CPUFreqSamplesInRange(fromEpoch, toEpoch)
+	// In sample-on-change mode a core may have no sample inside the range, so
+	// include the one in effect at its start; the heartbeat bounds how far back
+	// that can be.
+	var freqLookback int64
+	s.cfgMu.RLock()
+	if s.cfg.Collection.CPUFreqChangeKHz > 0 {
+		freqLookback = int64(s.cfg.Collection.CPUFreqHeartbeatSeconds)
+	}
+	enabled := s.cfg.Collection.ProcessesEnabled
+	s.cfgMu.RUnlock()
+	freqs, err := s.store.CPUFreqSamplesInRange(fromEpoch, toEpoch, freqLookback)
 	if err != nil {
 		return "", godbus.MakeFailedError(fmt.Errorf("query CPU frequency samples: %w", err))
 	}
-	result := map[string]any{"processes": procs, "cpu_freq": freqs}
-	data, err := json.Marshal(result)
+	cycles, err := s.store.ProcessCycleStatsInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query process cycle stats: %w", err))
+	}
+	lifetimes, err := s.store.ProcessLifetimesInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query process lifetimes: %w", err))
+	}
+	if procs == nil {
+		procs = []collector.ProcessSample{}
+	}
+	if freqs == nil {
+		freqs = []collector.CPUFreqSample{}
+	}
+	if cycles == nil {
+		cycles = []collector.ProcessCycleStats{}
+	}
+	if lifetimes == nil {
+		lifetimes = []collector.ProcessLifetime{}
+	}
+	result := map[string]any{"processes": procs, "cpu_freq": freqs, "cycle_stats": cycles, "lifetimes": lifetimes, "collection_enabled": enabled}
+	data, err := marshalReply(result)
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
 	return string(data), nil
 }
 
-// GetConfig returns the daemon configuration as JSON.
+// GetCoreClassEnergy returns the stored top-process CPU ticks in a time range
+// split between P-cores and E-cores, with the battery energy above baselineUW
+// estimated for each, as JSON. Pass the calibrated idle power as baselineUW to
+// leave out what the machine draws at rest, or 0 to split all of it. Where
+// CPU busy samples cover a cycle, its energy is split by busy time instead of
+// ticks; see collector.SplitCoreClassEnergy. Each core's share is scaled by
+// the frequency it ran at, raised to freq_power_exponent_percent/100.
+func (s *Service) GetCoreClassEnergy(fromEpoch, toEpoch, baselineUW int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	if baselineUW < 0 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid baseline: %d", baselineUW))
+	}
+	s.cfgMu.RLock()
+	coll := s.cfg.Collection
+	s.cfgMu.RUnlock()
+	procs, err := s.store.ProcessSamplesInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query process samples: %w", err))
+	}
+	// Frequency samples carry each core's class; in sample-on-change mode a
+	// core's latest one may predate the range.
+	var freqLookback int64
+	if coll.CPUFreqChangeKHz > 0 {
+		freqLookback = int64(coll.CPUFreqHeartbeatSeconds)
+	}
+	freqs, err := s.store.CPUFreqSamplesInRange(fromEpoch, toEpoch, freqLookback)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query CPU frequency samples: %w", err))
+	}
+	cores := make(map[int]bool)
+	for _, f := range freqs {
+		cores[f.CPUID] = f.IsPCore
+	}
+	bat, err := s.store.BatterySamplesInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query battery samples: %w", err))
+	}
+	// A busy sample covers the period before it, so the one covering the
+	// end of the range may be stored up to an interval later.
+	busy, err := s.store.CPUBusySamplesInRange(fromEpoch, toEpoch+int64(coll.CPUBusyIntervalSeconds))
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query CPU busy samples: %w", err))
+	}
+	exponent := float64(coll.CPUBusyExponentPercent) / 100
+	var coreWeight func(cpu int, ts int64) float64
+	if coll.FreqPowerExponentPercent > 0 {
+		// The reference frequency cancels out of each cycle's split, so the
+		// range's highest one serves.
+		var refKHz int64
+		for _, f := range freqs {
+			refKHz = max(refKHz, f.FreqKHz)
+		}
+		coreFreqs := collector.NewCoreFreqs(freqs)
+		freqExponent := float64(coll.FreqPowerExponentPercent) / 100
+		coreWeight = func(cpu int, ts int64) float64 {
+			return calibration.FreqPowerScale(coreFreqs.At(cpu, ts), refKHz, freqExponent)
+		}
+	}
+	split := collector.SplitCoreClassEnergy(procs, cores, bat, busy, exponent, coreWeight, baselineUW, 2*int64(coll.IntervalSeconds))
+	result := map[string]any{"split": split, "p_core_label": coll.PCoreLabel, "e_core_label": coll.ECoreLabel}
+	data, err := marshalReply(result)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// AddAnnotation stores a note at the given unix time and returns the stored
+// annotation, including its ID, as JSON.
+func (s *Service) AddAnnotation(timestamp int64, text string) (string, *godbus.Error) {
+	if timestamp < 0 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid annotation timestamp: %d", timestamp))
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", godbus.MakeFailedError(fmt.Errorf("annotation text must not be empty"))
+	}
+	if len(text) > maxAnnotationBytes {
+		return "", godbus.MakeFailedError(fmt.Errorf("annotation text too long: %d bytes, limit is %d", len(text), maxAnnotationBytes))
+	}
+	a := collector.Annotation{Timestamp: timestamp, Text: text, Source: collector.AnnotationSourceUser}
+	id, err := s.store.InsertAnnotation(a)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("insert annotation: %w", err))
+	}
+	a.ID = id
+	data, err := marshalReply(a)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// GetAnnotations returns the annotations in a time range as a JSON array.
+func (s *Service) GetAnnotations(fromEpoch, toEpoch int64) (string, *godbus.Error) {
+	if fromEpoch < 0 || toEpoch < fromEpoch || (toEpoch-fromEpoch) > 86400*365 {
+		return "", godbus.MakeFailedError(fmt.Errorf("invalid time range: from=%d to=%d", fromEpoch, toEpoch))
+	}
+	annotations, err := s.store.AnnotationsInRange(fromEpoch, toEpoch)
+	if err != nil {
+		return "", godbus.MakeFailedError(fmt.Errorf("query annotations: %w", err))
+	}
+	if annotations == nil {
+		annotations = []collector.Annotation{}
+	}
+	data, err := marshalReply(annotations)
+	if err != nil {
+		return "", godbus.MakeFailedError(err)
+	}
+	return string(data), nil
+}
+
+// DeleteAnnotation removes the annotation with the given ID.
+func (s *Service) DeleteAnnotation(id int64) *godbus.Error {
+	deleted, err := s.store.DeleteAnnotation(id)
+	if err != nil {
+		return godbus.MakeFailedError(fmt.Errorf("delete annotation: %w", err))
+	}
+	if !deleted {
+		return godbus.MakeFailedError(fmt.Errorf("annotation %d not found", id))
+	}
+	return nil
+}
+
+// GetConfig returns the daemon configuration file as JSON. Settings that
+// need a restart may differ from those in effect until the daemon restarts.
 func (s *Service) GetConfig() (string, *godbus.Error) {
 	s.cfgMu.RLock()
-	cfgCopy := *s.cfg
+	cfgCopy := *s.fileCfg
 	s.cfgMu.RUnlock()
 
-	data, err := json.Marshal(cfgCopy)
+	data, err := marshalReply(cfgCopy)
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
 	return string(data), nil
 }
 
-// UpdateConfig sanitizes and persists a new daemon configuration.
+// SetConfig replaces the settings the service runs with and the config file
+// contents reported by GetConfig, e.g. after the daemon re-read the config
+// file: applied holds only the settings that took effect (config.ApplyHot),
+// loaded the file as read.
+func (s *Service) SetConfig(applied, loaded *config.Config) {
+	s.cfgMu.Lock()
+	s.cfg = applied
+	s.fileCfg = loaded
+	s.cfgMu.Unlock()
+}
+
+// UpdateConfig sanitizes and persists a new daemon configuration. It takes
+// effect when the daemon next reloads the file.
 func (s *Service) UpdateConfig(configJSON string) (string, *godbus.Error) {
 	if len(configJSON) > maxConfigPayloadBytes {
 		return "", godbus.MakeFailedError(fmt.Errorf("config update payload too large: %d bytes", len(configJSON)))
@@ -227,10 +857,10 @@ func (s *Service) UpdateConfig(configJSON string) (string, *godbus.Error) {
 	}
 
 	s.cfgMu.Lock()
-	s.cfg = sanitized
+	s.fileCfg = sanitized
 	s.cfgMu.Unlock()
 
-	data, err := json.Marshal(sanitized)
+	data, err := marshalReply(sanitized)
 	if err != nil {
 		return "", godbus.MakeFailedError(err)
 	}
@@ -2,17 +2,24 @@ package dbus
 
 import (
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	godbus "github.com/godbus/dbus/v5"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 	pmconfig "github.com/cptspacemanspiff/gnome-power-display/internal/config"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/derived"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/storage"
 )
 
-func newTestService(t *testing.T) (*Service, *storage.DB, string) {
+func newTestService(t testing.TB) (*Service, *storage.DB, string) {
 	t.Helper()
 
 	path := filepath.Join(t.TempDir(), "test.db")
@@ -33,7 +40,7 @@ func newTestService(t *testing.T) (*Service, *storage.DB, string) {
 		t.Fatalf("config.Save() error = %v", err)
 	}
 
-	svc, err := NewService(db, cfg, configPath)
+	svc, err := NewService(db, cfg, configPath, slog.New(slog.DiscardHandler))
 	if err != nil {
 		t.Fatalf("NewService() error = %v", err)
 	}
@@ -69,6 +76,41 @@ func TestService_InvalidTimeRanges(t *testing.T) {
 				return err
 			},
 		},
+		{
+			name: "GetHistoryBuckets zero bucket size",
+			call: func() *godbus.Error {
+				_, err := svc.GetHistoryBuckets(0, 100, 0)
+				return err
+			},
+		},
+		{
+			name: "GetHistoryBuckets too many buckets",
+			call: func() *godbus.Error {
+				_, err := svc.GetHistoryBuckets(0, 86400*30, 1)
+				return err
+			},
+		},
+		{
+			name: "GetPowerHistogram zero buckets",
+			call: func() *godbus.Error {
+				_, err := svc.GetPowerHistogram(0, 100, 0)
+				return err
+			},
+		},
+		{
+			name: "GetPowerHistogram too many buckets",
+			call: func() *godbus.Error {
+				_, err := svc.GetPowerHistogram(0, 100, maxHistogramBuckets+1)
+				return err
+			},
+		},
+		{
+			name: "GetPowerHistogram to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetPowerHistogram(10, 9, 10)
+				return err
+			},
+		},
 		{
 			name: "GetPowerStateEvents negative from",
 			call: func() *godbus.Error {
@@ -111,6 +153,111 @@ func TestService_InvalidTimeRanges(t *testing.T) {
 				return err
 			},
 		},
+		{
+			name: "GetCoreClassEnergy to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetCoreClassEnergy(10, 9, 0)
+				return err
+			},
+		},
+		{
+			name: "GetCoreClassEnergy negative baseline",
+			call: func() *godbus.Error {
+				_, err := svc.GetCoreClassEnergy(0, 10, -1)
+				return err
+			},
+		},
+		{
+			name: "GetPowerPercentiles to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetPowerPercentiles(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetPowerPercentiles range too large",
+			call: func() *godbus.Error {
+				_, err := svc.GetPowerPercentiles(0, 86400*366)
+				return err
+			},
+		},
+		{
+			name: "GetThrottleEvents to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetThrottleEvents(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetThrottleEvents range too large",
+			call: func() *godbus.Error {
+				_, err := svc.GetThrottleEvents(0, 86400*366)
+				return err
+			},
+		},
+		{
+			name: "GetBatteryPresenceEvents to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetBatteryPresenceEvents(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetBatteryPresenceEvents range too large",
+			call: func() *godbus.Error {
+				_, err := svc.GetBatteryPresenceEvents(0, 86400*366)
+				return err
+			},
+		},
+		{
+			name: "GetIdleIntervals to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetIdleIntervals(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetIdleIntervals range too large",
+			call: func() *godbus.Error {
+				_, err := svc.GetIdleIntervals(0, 86400*366)
+				return err
+			},
+		},
+		{
+			name: "GetCPUBusyHistory to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetCPUBusyHistory(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetCPUBusyHistory range too large",
+			call: func() *godbus.Error {
+				_, err := svc.GetCPUBusyHistory(0, 86400*366)
+				return err
+			},
+		},
+		{
+			name: "GetSuspendDrainRates to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetSuspendDrainRates(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetAnnotations to before from",
+			call: func() *godbus.Error {
+				_, err := svc.GetAnnotations(10, 9)
+				return err
+			},
+		},
+		{
+			name: "GetAnnotations range too large",
+			call: func() *godbus.Error {
+				_, err := svc.GetAnnotations(0, 86400*366)
+				return err
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -137,16 +284,28 @@ func TestService_SuccessJSONShapes(t *testing.T) {
 	if err := db.InsertProcessSamples([]collector.ProcessSample{{Timestamp: 100, PID: 1, Comm: "a", Cmdline: "a", CPUTicksDelta: 10, LastCPU: 0}}); err != nil {
 		t.Fatalf("InsertProcessSamples() error = %v", err)
 	}
+	if err := db.UpsertProcessLifetimes([]collector.ProcessLifetime{{PID: 1, StartTime: 50, Comm: "a", FirstSeen: 90, LastSeen: 100}}); err != nil {
+		t.Fatalf("UpsertProcessLifetimes() error = %v", err)
+	}
 	if err := db.InsertCPUFreqSamples([]collector.CPUFreqSample{{Timestamp: 100, CPUID: 0, FreqKHz: 2400000, IsPCore: true}}); err != nil {
 		t.Fatalf("InsertCPUFreqSamples() error = %v", err)
 	}
+	if err := db.InsertThrottleEvent(collector.ThrottleEvent{StartTime: 100, EndTime: 110, Reason: collector.ThrottleReasonThermal}); err != nil {
+		t.Fatalf("InsertThrottleEvent() error = %v", err)
+	}
+	if err := db.InsertBatteryPresenceEvent(collector.BatteryPresenceEvent{Timestamp: 120, Present: false, Battery: "BAT1"}); err != nil {
+		t.Fatalf("InsertBatteryPresenceEvent() error = %v", err)
+	}
+	if err := db.InsertIdleInterval(collector.IdleInterval{StartTime: 120, EndTime: 150}); err != nil {
+		t.Fatalf("InsertIdleInterval() error = %v", err)
+	}
 
 	currentJSON, dbusErr := svc.GetCurrentStats()
 	if dbusErr != nil {
 		t.Fatalf("GetCurrentStats() error = %v", dbusErr)
 	}
 	var current map[string]json.RawMessage
-	if err := json.Unmarshal([]byte(currentJSON), &current); err != nil {
+	if err := decodeReply(currentJSON, &current); err != nil {
 		t.Fatalf("unmarshal current JSON: %v", err)
 	}
 	if _, ok := current["battery"]; !ok {
@@ -155,13 +314,23 @@ func TestService_SuccessJSONShapes(t *testing.T) {
 	if _, ok := current["backlight"]; !ok {
 		t.Fatalf("current JSON missing key %q: %s", "backlight", currentJSON)
 	}
+	if got := string(current["interval_seconds"]); got != "5" {
+		t.Fatalf("current interval_seconds = %q, want %q", got, "5")
+	}
+	if got := string(current["power_ewma_uw"]); got != "1100000" {
+		t.Fatalf("current power_ewma_uw = %q, want %q (single sample)", got, "1100000")
+	}
+	var started int64
+	if err := json.Unmarshal(current["daemon_started"], &started); err != nil || started <= 0 {
+		t.Fatalf("current daemon_started = %s, want a positive epoch", current["daemon_started"])
+	}
 
 	historyJSON, dbusErr := svc.GetHistory(0, 200)
 	if dbusErr != nil {
 		t.Fatalf("GetHistory() error = %v", dbusErr)
 	}
 	var history map[string]json.RawMessage
-	if err := json.Unmarshal([]byte(historyJSON), &history); err != nil {
+	if err := decodeReply(historyJSON, &history); err != nil {
 		t.Fatalf("unmarshal history JSON: %v", err)
 	}
 	if _, ok := history["battery"]; !ok {
@@ -171,21 +340,105 @@ func TestService_SuccessJSONShapes(t *testing.T) {
 		t.Fatalf("history JSON missing key %q: %s", "backlight", historyJSON)
 	}
 
+	bucketsJSON, dbusErr := svc.GetHistoryBuckets(0, 200, 60)
+	if dbusErr != nil {
+		t.Fatalf("GetHistoryBuckets() error = %v", dbusErr)
+	}
+	var buckets []collector.BatteryBucket
+	if err := decodeReply(bucketsJSON, &buckets); err != nil {
+		t.Fatalf("unmarshal buckets JSON array: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Timestamp != 60 || buckets[0].MaxCapacityPct != 80 {
+		t.Fatalf("GetHistoryBuckets() = %s, want one bucket at 60 with max capacity 80", bucketsJSON)
+	}
+
+	histJSON, dbusErr := svc.GetPowerHistogram(0, 200, 10)
+	if dbusErr != nil {
+		t.Fatalf("GetPowerHistogram() error = %v", dbusErr)
+	}
+	var hist struct {
+		Buckets []collector.PowerHistogramBucket `json:"buckets"`
+		Total   int                              `json:"total"`
+	}
+	if err := decodeReply(histJSON, &hist); err != nil {
+		t.Fatalf("unmarshal histogram JSON: %v", err)
+	}
+	if hist.Total != 1 || len(hist.Buckets) != 10 || hist.Buckets[0].Count != 1 {
+		t.Fatalf("GetPowerHistogram() = %s, want one sample in the first of 10 buckets", histJSON)
+	}
+
+	pctJSON, dbusErr := svc.GetPowerPercentiles(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetPowerPercentiles() error = %v", dbusErr)
+	}
+	var pct collector.PowerPercentiles
+	if err := decodeReply(pctJSON, &pct); err != nil {
+		t.Fatalf("unmarshal percentiles JSON: %v", err)
+	}
+	if pct.Count != 1 || pct.P50UW != 1100000 || pct.P99UW != 1100000 {
+		t.Fatalf("GetPowerPercentiles() = %s, want every percentile at the single 1.1 W sample", pctJSON)
+	}
+
 	sleepJSON, dbusErr := svc.GetPowerStateEvents(0, 200)
 	if dbusErr != nil {
 		t.Fatalf("GetPowerStateEvents() error = %v", dbusErr)
 	}
 	var sleepArr []map[string]any
-	if err := json.Unmarshal([]byte(sleepJSON), &sleepArr); err != nil {
+	if err := decodeReply(sleepJSON, &sleepArr); err != nil {
 		t.Fatalf("unmarshal sleep JSON array: %v", err)
 	}
 
+	throttleJSON, dbusErr := svc.GetThrottleEvents(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetThrottleEvents() error = %v", dbusErr)
+	}
+	var throttle []collector.ThrottleEvent
+	if err := decodeReply(throttleJSON, &throttle); err != nil {
+		t.Fatalf("unmarshal throttle JSON array: %v", err)
+	}
+	if len(throttle) != 1 || throttle[0].Reason != collector.ThrottleReasonThermal {
+		t.Fatalf("GetThrottleEvents() = %s, want one thermal event", throttleJSON)
+	}
+
+	presenceJSON, dbusErr := svc.GetBatteryPresenceEvents(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetBatteryPresenceEvents() error = %v", dbusErr)
+	}
+	var presence []collector.BatteryPresenceEvent
+	if err := decodeReply(presenceJSON, &presence); err != nil {
+		t.Fatalf("unmarshal battery presence JSON array: %v", err)
+	}
+	if len(presence) != 1 || presence[0].Present || presence[0].Battery != "BAT1" {
+		t.Fatalf("GetBatteryPresenceEvents() = %s, want one BAT1 removal", presenceJSON)
+	}
+
+	idleJSON, dbusErr := svc.GetIdleIntervals(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetIdleIntervals() error = %v", dbusErr)
+	}
+	var idle []collector.IdleInterval
+	if err := decodeReply(idleJSON, &idle); err != nil {
+		t.Fatalf("unmarshal idle JSON array: %v", err)
+	}
+	if len(idle) != 1 || idle[0].StartTime != 120 || idle[0].EndTime != 150 {
+		t.Fatalf("GetIdleIntervals() = %s, want one 120-150 interval", idleJSON)
+	}
+
+	// The 5s suspend is too short for a drain rate.
+	drainJSON, dbusErr := svc.GetSuspendDrainRates(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetSuspendDrainRates() error = %v", dbusErr)
+	}
+	if drainJSON != `{"v":1,"data":[]}` {
+		t.Fatalf("GetSuspendDrainRates() = %s, want an empty list", drainJSON)
+	}
+
 	procJSON, dbusErr := svc.GetProcessHistory(0, 200)
 	if dbusErr != nil {
 		t.Fatalf("GetProcessHistory() error = %v", dbusErr)
 	}
 	var proc map[string]json.RawMessage
-	if err := json.Unmarshal([]byte(procJSON), &proc); err != nil {
+	if err := decodeReply(procJSON, &proc); err != nil {
 		t.Fatalf("unmarshal process JSON: %v", err)
 	}
 	if _, ok := proc["processes"]; !ok {
@@ -194,6 +447,130 @@ func TestService_SuccessJSONShapes(t *testing.T) {
 	if _, ok := proc["cpu_freq"]; !ok {
 		t.Fatalf("process JSON missing key %q: %s", "cpu_freq", procJSON)
 	}
+	if _, ok := proc["cycle_stats"]; !ok {
+		t.Fatalf("process JSON missing key %q: %s", "cycle_stats", procJSON)
+	}
+	var lifetimes []collector.ProcessLifetime
+	if err := json.Unmarshal(proc["lifetimes"], &lifetimes); err != nil {
+		t.Fatalf("unmarshal process lifetimes: %v", err)
+	}
+	if len(lifetimes) != 1 || lifetimes[0].FirstSeen != 90 || lifetimes[0].LastSeen != 100 {
+		t.Fatalf("process lifetimes = %s, want one 90-100 lifetime", proc["lifetimes"])
+	}
+}
+
+func TestService_GetCoreClassEnergy(t *testing.T) {
+	svc, db, _ := newTestService(t)
+	if err := db.InsertCPUFreqSamples([]collector.CPUFreqSample{
+		{Timestamp: 100, CPUID: 0, FreqKHz: 3000000, IsPCore: true},
+		{Timestamp: 100, CPUID: 4, FreqKHz: 2000000, IsPCore: false},
+	}); err != nil {
+		t.Fatalf("InsertCPUFreqSamples() error = %v", err)
+	}
+	for _, ts := range []int64{100, 105} {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, PowerUW: 7_200_000, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+		if err := db.InsertProcessSamples([]collector.ProcessSample{
+			{Timestamp: ts, PID: 1, Comm: "a", LastCPU: 0, CPUTicksDelta: 30},
+			{Timestamp: ts, PID: 2, Comm: "b", LastCPU: 4, CPUTicksDelta: 10},
+		}); err != nil {
+			t.Fatalf("InsertProcessSamples() error = %v", err)
+		}
+	}
+
+	raw, dbusErr := svc.GetCoreClassEnergy(0, 200, 3_600_000)
+	if dbusErr != nil {
+		t.Fatalf("GetCoreClassEnergy() error = %v", dbusErr)
+	}
+	var got struct {
+		Split      collector.CoreClassEnergy `json:"split"`
+		PCoreLabel string                    `json:"p_core_label"`
+	}
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("unmarshal core class JSON: %v", err)
+	}
+	// One 5 s cycle at 3.6 W above the baseline is 5000 µWh, split 30:10 by
+	// ticks and weighted by the squared clocks, 3 GHz against 2 GHz: 270:40.
+	want := collector.CoreClassEnergy{PCoreTicks: 60, ECoreTicks: 20, PCoreEnergyUWH: 4354, ECoreEnergyUWH: 646}
+	if got.Split != want || got.PCoreLabel != "P-core" {
+		t.Fatalf("GetCoreClassEnergy() = %s, want split %+v", raw, want)
+	}
+}
+
+func TestService_CPUBusy(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	busyJSON, dbusErr := svc.GetCPUBusyHistory(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetCPUBusyHistory() error = %v", dbusErr)
+	}
+	if busyJSON != `{"v":1,"data":[]}` {
+		t.Fatalf("GetCPUBusyHistory() = %s, want an empty list", busyJSON)
+	}
+
+	for _, ts := range []int64{100, 105} {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, PowerUW: 3_600_000, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+		if err := db.InsertProcessSamples([]collector.ProcessSample{{Timestamp: ts, PID: 1, Comm: "a", LastCPU: 0, CPUTicksDelta: 30}}); err != nil {
+			t.Fatalf("InsertProcessSamples() error = %v", err)
+		}
+	}
+	// Stored after the range ends but covering its last cycle.
+	busy := []collector.CPUBusySample{
+		{Timestamp: 120, CPUID: 0, IsPCore: true, BusyFraction: 0.5, PeriodSecs: 30},
+		{Timestamp: 120, CPUID: 4, IsPCore: false, BusyFraction: 0.5, PeriodSecs: 30},
+	}
+	if err := db.InsertCPUBusySamples(busy); err != nil {
+		t.Fatalf("InsertCPUBusySamples() error = %v", err)
+	}
+
+	busyJSON, dbusErr = svc.GetCPUBusyHistory(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetCPUBusyHistory() error = %v", dbusErr)
+	}
+	var gotBusy []collector.CPUBusySample
+	if err := decodeReply(busyJSON, &gotBusy); err != nil {
+		t.Fatalf("unmarshal busy JSON array: %v", err)
+	}
+	if !reflect.DeepEqual(gotBusy, busy) {
+		t.Fatalf("GetCPUBusyHistory() = %s, want %+v", busyJSON, busy)
+	}
+
+	raw, dbusErr := svc.GetCoreClassEnergy(0, 110, 0)
+	if dbusErr != nil {
+		t.Fatalf("GetCoreClassEnergy() error = %v", dbusErr)
+	}
+	var got struct {
+		Split collector.CoreClassEnergy `json:"split"`
+	}
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("unmarshal core class JSON: %v", err)
+	}
+	// Every tick ran on CPU 0 but both cores were equally busy, so the
+	// 5000 µWh cycle splits evenly. CPU 0 has no frequency sample, so its
+	// ticks are unknown.
+	want := collector.CoreClassEnergy{UnknownTicks: 60, PCoreEnergyUWH: 2500, ECoreEnergyUWH: 2500, BusyWeightedUWH: 5000}
+	if got.Split != want {
+		t.Fatalf("GetCoreClassEnergy() = %s, want split %+v", raw, want)
+	}
+}
+
+func TestService_GetProcessHistoryDisabled(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	cfg := pmconfig.DefaultConfig()
+	cfg.Collection.ProcessesEnabled = false
+	svc.SetConfig(cfg, cfg)
+
+	procJSON, dbusErr := svc.GetProcessHistory(0, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetProcessHistory() error = %v", dbusErr)
+	}
+	want := `{"v":1,"data":{"collection_enabled":false,"cpu_freq":[],"cycle_stats":[],"lifetimes":[],"processes":[]}}`
+	if procJSON != want {
+		t.Fatalf("GetProcessHistory() = %s, want %s", procJSON, want)
+	}
 }
 
 func TestService_ConfigMethods(t *testing.T) {
@@ -205,7 +582,7 @@ func TestService_ConfigMethods(t *testing.T) {
 	}
 
 	var current pmconfig.Config
-	if err := json.Unmarshal([]byte(currentJSON), &current); err != nil {
+	if err := decodeReply(currentJSON, &current); err != nil {
 		t.Fatalf("unmarshal current config JSON: %v", err)
 	}
 
@@ -223,7 +600,7 @@ func TestService_ConfigMethods(t *testing.T) {
 	}
 
 	var updated pmconfig.Config
-	if err := json.Unmarshal([]byte(updatedJSON), &updated); err != nil {
+	if err := decodeReply(updatedJSON, &updated); err != nil {
 		t.Fatalf("unmarshal updated config JSON: %v", err)
 	}
 
@@ -241,6 +618,51 @@ func TestService_ConfigMethods(t *testing.T) {
 	if persisted.Storage.DBPath != updated.Storage.DBPath {
 		t.Fatalf("persisted DBPath = %q, want %q", persisted.Storage.DBPath, updated.Storage.DBPath)
 	}
+
+	reportedJSON, dbusErr := svc.GetConfig()
+	if dbusErr != nil {
+		t.Fatalf("GetConfig() error = %v", dbusErr)
+	}
+	var reported pmconfig.Config
+	if err := decodeReply(reportedJSON, &reported); err != nil {
+		t.Fatalf("unmarshal reported config JSON: %v", err)
+	}
+	if reported.Storage.DBPath != updated.Storage.DBPath {
+		t.Fatalf("GetConfig() DBPath = %q, want %q", reported.Storage.DBPath, updated.Storage.DBPath)
+	}
+	// The saved file takes effect at the next reload.
+	if svc.cfg.Storage.DBPath == updated.Storage.DBPath || svc.cfg.Collection.IntervalSeconds == 7 {
+		t.Fatalf("running config = %+v, want the update not applied before a reload", svc.cfg)
+	}
+}
+
+func TestService_SetConfigKeepsRestartOnlySettings(t *testing.T) {
+	svc, _, _ := newTestService(t)
+	cur := pmconfig.DefaultConfig()
+	loaded := pmconfig.DefaultConfig()
+	loaded.Collection.BatteryDevice = "BAT9"
+	loaded.Collection.CPUFreqChangeKHz = 50000
+	loaded.Collection.CPUBusyExponentPercent = 200
+
+	svc.SetConfig(pmconfig.ApplyHot(cur, loaded), loaded)
+
+	if svc.cfg.Collection.BatteryDevice != cur.Collection.BatteryDevice || svc.cfg.Collection.CPUFreqChangeKHz != cur.Collection.CPUFreqChangeKHz {
+		t.Fatalf("running collection = %+v, want battery_device and cpu_freq_change_khz unchanged until a restart", svc.cfg.Collection)
+	}
+	if svc.cfg.Collection.CPUBusyExponentPercent != 200 {
+		t.Fatalf("running CPUBusyExponentPercent = %d, want the reloaded 200", svc.cfg.Collection.CPUBusyExponentPercent)
+	}
+	reportedJSON, dbusErr := svc.GetConfig()
+	if dbusErr != nil {
+		t.Fatalf("GetConfig() error = %v", dbusErr)
+	}
+	var reported pmconfig.Config
+	if err := decodeReply(reportedJSON, &reported); err != nil {
+		t.Fatalf("unmarshal reported config JSON: %v", err)
+	}
+	if reported.Collection.BatteryDevice != "BAT9" {
+		t.Fatalf("GetConfig() battery_device = %q, want the file's BAT9", reported.Collection.BatteryDevice)
+	}
 }
 
 func TestService_UpdateConfigRejectsInvalidConfig(t *testing.T) {
@@ -251,3 +673,516 @@ func TestService_UpdateConfigRejectsInvalidConfig(t *testing.T) {
 		t.Fatal("UpdateConfig() error = nil, want D-Bus error")
 	}
 }
+
+func TestService_Annotations(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	emptyJSON, dbusErr := svc.GetAnnotations(0, 1000)
+	if dbusErr != nil {
+		t.Fatalf("GetAnnotations() error = %v", dbusErr)
+	}
+	if emptyJSON != `{"v":1,"data":[]}` {
+		t.Fatalf("GetAnnotations() = %s, want an empty list", emptyJSON)
+	}
+
+	addedJSON, dbusErr := svc.AddAnnotation(500, "  enabled TLP ")
+	if dbusErr != nil {
+		t.Fatalf("AddAnnotation() error = %v", dbusErr)
+	}
+	var added collector.Annotation
+	if err := decodeReply(addedJSON, &added); err != nil {
+		t.Fatalf("unmarshal annotation JSON: %v", err)
+	}
+	if added.ID == 0 || added.Timestamp != 500 || added.Text != "enabled TLP" || added.Source != collector.AnnotationSourceUser {
+		t.Fatalf("AddAnnotation() = %#v, want trimmed user text at ts=500 with an ID", added)
+	}
+
+	listJSON, dbusErr := svc.GetAnnotations(0, 1000)
+	if dbusErr != nil {
+		t.Fatalf("GetAnnotations() error = %v", dbusErr)
+	}
+	var list []collector.Annotation
+	if err := decodeReply(listJSON, &list); err != nil {
+		t.Fatalf("unmarshal annotations JSON: %v", err)
+	}
+	if len(list) != 1 || list[0] != added {
+		t.Fatalf("GetAnnotations() = %#v, want [%#v]", list, added)
+	}
+
+	if dbusErr := svc.DeleteAnnotation(added.ID); dbusErr != nil {
+		t.Fatalf("DeleteAnnotation() error = %v", dbusErr)
+	}
+	if dbusErr := svc.DeleteAnnotation(added.ID); dbusErr == nil {
+		t.Fatal("DeleteAnnotation() of missing ID error = nil, want D-Bus error")
+	}
+}
+
+func TestService_AddAnnotationRejectsInvalidInput(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	tests := []struct {
+		name      string
+		timestamp int64
+		text      string
+	}{
+		{"negative timestamp", -1, "note"},
+		{"empty text", 100, ""},
+		{"blank text", 100, "   "},
+		{"text too long", 100, strings.Repeat("x", maxAnnotationBytes+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.AddAnnotation(tt.timestamp, tt.text); err == nil {
+				t.Fatal("expected D-Bus error, got nil")
+			}
+		})
+	}
+}
+
+func TestService_GetCapacityDrops(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	emptyJSON, dbusErr := svc.GetCapacityDrops()
+	if dbusErr != nil {
+		t.Fatalf("GetCapacityDrops() error = %v", dbusErr)
+	}
+	if emptyJSON != `{"v":1,"data":[]}` {
+		t.Fatalf("GetCapacityDrops() = %s, want an empty list", emptyJSON)
+	}
+
+	for _, s := range []collector.BatteryHealthSnapshot{
+		{Timestamp: 100, ChargeFullUAH: 5000000, CycleCount: 1},
+		{Timestamp: 200, ChargeFullUAH: 4500000, CycleCount: 2},
+	} {
+		if _, err := db.InsertBatteryHealthSnapshot(s); err != nil {
+			t.Fatalf("InsertBatteryHealthSnapshot() error = %v", err)
+		}
+	}
+
+	dropsJSON, dbusErr := svc.GetCapacityDrops()
+	if dbusErr != nil {
+		t.Fatalf("GetCapacityDrops() error = %v", dbusErr)
+	}
+	var drops []collector.CapacityDrop
+	if err := decodeReply(dropsJSON, &drops); err != nil {
+		t.Fatalf("unmarshal drops JSON: %v", err)
+	}
+	if len(drops) != 1 || drops[0].Timestamp != 200 {
+		t.Fatalf("drops = %#v, want one drop at ts=200", drops)
+	}
+
+	// The 10% drop is below a configured 15% threshold.
+	cfg := pmconfig.DefaultConfig()
+	cfg.Annotations.CapacityDropPercent = 15
+	svc.SetConfig(cfg, cfg)
+	dropsJSON, dbusErr = svc.GetCapacityDrops()
+	if dbusErr != nil {
+		t.Fatalf("GetCapacityDrops() error = %v", dbusErr)
+	}
+	if dropsJSON != `{"v":1,"data":[]}` {
+		t.Fatalf("GetCapacityDrops() with capacity_drop_percent = 15 = %s, want an empty list", dropsJSON)
+	}
+}
+
+func TestService_GetChargeCycles(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	if _, dbusErr := svc.GetChargeCycles(200, 100); dbusErr == nil {
+		t.Fatal("GetChargeCycles(200, 100) error = nil, want invalid range")
+	}
+
+	if _, err := db.InsertBatteryHealthSnapshot(collector.BatteryHealthSnapshot{Timestamp: 50, ChargeFullDesignUAH: 4000000, CycleCount: 10}); err != nil {
+		t.Fatalf("InsertBatteryHealthSnapshot() error = %v", err)
+	}
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 100, ChargeNowUAH: 4000000, CapacityPct: 100, Status: "Discharging"},
+		{Timestamp: 110, ChargeNowUAH: 1000000, CapacityPct: 25, Status: "Discharging"},
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+
+	raw, dbusErr := svc.GetChargeCycles(100, 200)
+	if dbusErr != nil {
+		t.Fatalf("GetChargeCycles() error = %v", dbusErr)
+	}
+	var got collector.ChargeCycles
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("unmarshal cycles JSON: %v", err)
+	}
+	if got.Cycles != 0.75 || got.Basis != collector.CycleBasisDesignCharge || got.FirmwareCycleCount != 10 {
+		t.Fatalf("GetChargeCycles() = %+v, want 0.75 design-charge cycles and firmware count 10", got)
+	}
+}
+
+func TestService_GetDerivedSeries(t *testing.T) {
+	svc, db, _ := newTestService(t)
+	cfg := pmconfig.DefaultConfig()
+	cfg.Derived.Series = []pmconfig.DerivedSeriesConfig{
+		{Name: "doubled", Expression: "power * 2"},
+		{Name: "residual", Expression: "power - display_est"},
+	}
+	svc.SetConfig(cfg, cfg)
+
+	if _, dbusErr := svc.GetDerivedSeries("unknown", 0, 100); dbusErr == nil {
+		t.Fatal("GetDerivedSeries(unknown) error = nil, want unknown series")
+	}
+	if _, dbusErr := svc.GetDerivedSeries("doubled", 200, 100); dbusErr == nil {
+		t.Fatal("GetDerivedSeries(200, 100) error = nil, want invalid range")
+	}
+
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 0, PowerUW: 6000000, Status: "Discharging"},
+		{Timestamp: 30, PowerUW: 8000000, Status: "Discharging"},
+		{Timestamp: 90, PowerUW: 5000000, Status: "Discharging"},
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	raw, dbusErr := svc.GetDerivedSeries("doubled", 0, 119)
+	if dbusErr != nil {
+		t.Fatalf("GetDerivedSeries() error = %v", dbusErr)
+	}
+	var got collector.DerivedSeries
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("unmarshal derived series JSON: %v", err)
+	}
+	want := []collector.DerivedPoint{{Timestamp: 0, Value: 14}, {Timestamp: 60, Value: 10}}
+	if got.BucketSecs != 60 || !reflect.DeepEqual(got.Points, want) {
+		t.Fatalf("GetDerivedSeries() = %+v, want points %+v in 60 s buckets", got, want)
+	}
+
+	// Without a display model fit there is no display estimate.
+	raw, dbusErr = svc.GetDerivedSeries("residual", 0, 119)
+	if dbusErr != nil {
+		t.Fatalf("GetDerivedSeries(residual) error = %v", dbusErr)
+	}
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("unmarshal derived series JSON: %v", err)
+	}
+	if len(got.Points) != 0 {
+		t.Fatalf("GetDerivedSeries(residual) points = %+v, want none without a display model", got.Points)
+	}
+}
+
+func TestDerivedPoints_UsesDisplayModel(t *testing.T) {
+	expr, err := derived.Parse("power - display_est - cpu_est")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	model := calibration.DisplayPowerModel{DisplayUWPerPct: 50000, CPUUWPerTick: 10000, Confidence: calibration.ConfidenceHigh}
+	buckets := []collector.SeriesBucket{
+		{Timestamp: 0, PowerUW: 10000000, BrightnessPct: 40, HasBrightness: true, CPUTicks: 100, HasCPU: true},
+		{Timestamp: 60, PowerUW: 10000000, BrightnessPct: 40, HasBrightness: true}, // no process cycles
+	}
+	got := derivedPoints(expr, buckets, model)
+	if want := []collector.DerivedPoint{{Timestamp: 0, Value: 7}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("derivedPoints() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDerivedBucketSecs(t *testing.T) {
+	for _, tt := range []struct{ from, to, want int64 }{
+		{0, 3600, 60},
+		{0, 86400, 173},
+		{100, 100, 60},
+	} {
+		if got := derivedBucketSecs(tt.from, tt.to); got != tt.want {
+			t.Errorf("derivedBucketSecs(%d, %d) = %d, want %d", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestService_GetCollectionTimings(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	emptyJSON, dbusErr := svc.GetCollectionTimings()
+	if dbusErr != nil {
+		t.Fatalf("GetCollectionTimings() error = %v", dbusErr)
+	}
+	if emptyJSON != `{"v":1,"data":{"collectors":[],"interval_seconds":5}}` {
+		t.Fatalf("GetCollectionTimings() = %s, want no collectors", emptyJSON)
+	}
+
+	svc.RecordCollectTime("battery", 2*time.Millisecond)
+	svc.RecordCollectTime("process", 40*time.Millisecond)
+	svc.RecordCollectTime("process", 60*time.Millisecond)
+
+	timingsJSON, dbusErr := svc.GetCollectionTimings()
+	if dbusErr != nil {
+		t.Fatalf("GetCollectionTimings() error = %v", dbusErr)
+	}
+	var got struct {
+		Collectors []collector.CollectTiming `json:"collectors"`
+	}
+	if err := decodeReply(timingsJSON, &got); err != nil {
+		t.Fatalf("unmarshal timings JSON: %v", err)
+	}
+	if len(got.Collectors) != 2 || got.Collectors[1].Name != "process" || got.Collectors[1].AvgMS != 50 || got.Collectors[1].MaxMS != 60 {
+		t.Fatalf("collectors = %+v, want battery then process averaging 50 ms", got.Collectors)
+	}
+}
+
+func TestService_DebugDump(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	if _, dbusErr := svc.DebugDump(); dbusErr == nil || !strings.Contains(dbusErr.Error(), "debug.dump_enabled") {
+		t.Fatalf("DebugDump() error = %v, want disabled by default", dbusErr)
+	}
+
+	svc.cfg.Debug.DumpEnabled = true
+	svc.RecordCollectTime("battery", 2*time.Millisecond)
+	// Stand in for the daemon loop.
+	go func() {
+		reply := <-svc.DebugRequests()
+		reply <- collector.DebugState{BatteryDir: "/sys/class/power_supply/BAT0", DeviceErrors: []string{}}
+	}()
+	raw, dbusErr := svc.DebugDump()
+	if dbusErr != nil {
+		t.Fatalf("DebugDump() error = %v", dbusErr)
+	}
+	var got struct {
+		Collectors collector.DebugState      `json:"collectors"`
+		Timings    []collector.CollectTiming `json:"timings"`
+	}
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("unmarshal debug dump JSON: %v", err)
+	}
+	if got.Collectors.BatteryDir != "/sys/class/power_supply/BAT0" || len(got.Timings) != 1 || got.Timings[0].LastMS != 2 {
+		t.Fatalf("DebugDump() = %+v, want the loop's state and the battery timing", got)
+	}
+
+	// Nothing answers now, as when the loop is stuck in a slow cycle.
+	old := debugDumpTimeout
+	debugDumpTimeout = 10 * time.Millisecond
+	t.Cleanup(func() { debugDumpTimeout = old })
+	if _, dbusErr := svc.DebugDump(); dbusErr == nil {
+		t.Fatal("DebugDump() error = nil with no loop answering")
+	}
+}
+
+func TestService_GetProcessHistoryCarriesForwardSparseFrequencies(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	if err := db.InsertCPUFreqSamples([]collector.CPUFreqSample{
+		{Timestamp: 50, CPUID: 0, FreqKHz: 800000},
+	}); err != nil {
+		t.Fatalf("InsertCPUFreqSamples() error = %v", err)
+	}
+
+	freqCount := func() int {
+		t.Helper()
+		raw, dbusErr := svc.GetProcessHistory(100, 200)
+		if dbusErr != nil {
+			t.Fatalf("GetProcessHistory() error = %v", dbusErr)
+		}
+		var payload struct {
+			CPUFreq []collector.CPUFreqSample `json:"cpu_freq"`
+		}
+		if err := decodeReply(raw, &payload); err != nil {
+			t.Fatalf("unmarshal process history JSON: %v", err)
+		}
+		return len(payload.CPUFreq)
+	}
+
+	if n := freqCount(); n != 0 {
+		t.Fatalf("cpu_freq with sample-on-change off has %d samples, want 0", n)
+	}
+
+	svc.cfg.Collection.CPUFreqChangeKHz = 100000
+	if n := freqCount(); n != 1 {
+		t.Fatalf("cpu_freq with sample-on-change on has %d samples, want the carried-forward one", n)
+	}
+}
+
+func TestService_GetDisplayPowerModel(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	raw, dbusErr := svc.GetDisplayPowerModel()
+	if dbusErr != nil {
+		t.Fatalf("GetDisplayPowerModel() error = %v", dbusErr)
+	}
+	var m calibration.DisplayPowerModel
+	if err := decodeReply(raw, &m); err != nil {
+		t.Fatalf("unmarshal model JSON: %v", err)
+	}
+	if m.Points != 0 || m.Confidence != calibration.ConfidenceNone {
+		t.Fatalf("GetDisplayPowerModel(no points) = %s, want no fit", raw)
+	}
+
+	for i, pct := range []float64{0, 20, 40, 60, 80, 100} {
+		p := calibration.ModelPoint{Timestamp: int64(100 + i), BrightnessPct: pct, PowerUW: int64(5000000 + 25000*pct), CPUTicks: 20, Samples: 13}
+		if err := db.InsertDisplayModelPoint(p); err != nil {
+			t.Fatalf("InsertDisplayModelPoint() error = %v", err)
+		}
+	}
+	raw, dbusErr = svc.GetDisplayPowerModel()
+	if dbusErr != nil {
+		t.Fatalf("GetDisplayPowerModel() error = %v", dbusErr)
+	}
+	if err := decodeReply(raw, &m); err != nil {
+		t.Fatalf("unmarshal model JSON: %v", err)
+	}
+	if m.Points != 6 || m.BaselinePowerUW != 5000000 || m.Confidence == calibration.ConfidenceNone {
+		t.Fatalf("GetDisplayPowerModel() = %s, want a 5 W baseline fit over 6 points", raw)
+	}
+}
+
+func TestService_RunCalibration(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	svc.authorize = func(godbus.Sender, string) error { return nil }
+	release := make(chan struct{})
+	svc.runCalibration = func(opts calibration.RunOptions, onProgress func(calibration.Progress)) (calibration.CalibrationResult, error) {
+		onProgress(calibration.Progress{Level: 1, Levels: len(opts.Levels), Phase: "level", Message: "Level 1/5"})
+		<-release
+		return calibration.CalibrationResult{BaselinePowerUW: 4_000_000}, nil
+	}
+
+	type signal struct{ name, payload string }
+	signals := make(chan signal, 4)
+	svc.emit = func(name, payload string) { signals <- signal{name, payload} }
+
+	reply, dbusErr := svc.RunCalibration(":1.42")
+	if dbusErr != nil {
+		t.Fatalf("RunCalibration() error = %v", dbusErr)
+	}
+	if want := `{"v":1,"data":{"started":true}}`; reply != want {
+		t.Fatalf("RunCalibration() = %s, want %s", reply, want)
+	}
+
+	progress := <-signals
+	if progress.name != "CalibrationProgress" {
+		t.Fatalf("first signal = %q, want CalibrationProgress", progress.name)
+	}
+	var p calibration.Progress
+	if err := decodeReply(progress.payload, &p); err != nil {
+		t.Fatalf("decodeReply(progress) error = %v", err)
+	}
+	if p.Level != 1 || p.Phase != "level" {
+		t.Fatalf("progress = %+v, want level 1 phase level", p)
+	}
+
+	if _, err := svc.RunCalibration(":1.42"); err == nil {
+		t.Fatal("RunCalibration() while running error = nil, want error")
+	}
+
+	close(release)
+	complete := <-signals
+	if complete.name != "CalibrationComplete" {
+		t.Fatalf("final signal = %q, want CalibrationComplete", complete.name)
+	}
+	var done CalibrationComplete
+	if err := decodeReply(complete.payload, &done); err != nil {
+		t.Fatalf("decodeReply(complete) error = %v", err)
+	}
+	if done.Error != "" || done.Result == nil || done.Result.BaselinePowerUW != 4_000_000 {
+		t.Fatalf("complete = %+v, want baseline result", done)
+	}
+
+	annotations, err := db.AnnotationsInRange(0, time.Now().Unix())
+	if err != nil {
+		t.Fatalf("AnnotationsInRange() error = %v", err)
+	}
+	if len(annotations) != 1 || annotations[0].Text != "Calibration run" || annotations[0].Source != collector.AnnotationSourceAuto {
+		t.Fatalf("annotations = %+v, want one automatic calibration run", annotations)
+	}
+}
+
+func TestService_PowerRegression(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	raw, dbusErr := svc.GetPowerRegression()
+	if dbusErr != nil {
+		t.Fatalf("GetPowerRegression() error = %v", dbusErr)
+	}
+	if raw != `{"v":1,"data":null}` {
+		t.Fatalf("GetPowerRegression() = %s, want null before any report", raw)
+	}
+
+	signals := make(chan string, 1)
+	svc.emit = func(name, payload string) {
+		if name == "PowerRegression" {
+			signals <- payload
+		}
+	}
+	want := collector.PowerRegression{Active: true, StartTime: 100, DetectedAt: 1900, BaselineUW: 4_000_000, PowerUW: 6_000_000, BrightnessPct: 50}
+	svc.ReportPowerRegression(want)
+
+	var signalled collector.PowerRegression
+	if err := decodeReply(<-signals, &signalled); err != nil {
+		t.Fatalf("decodeReply(signal) error = %v", err)
+	}
+	if signalled != want {
+		t.Fatalf("PowerRegression signal = %+v, want %+v", signalled, want)
+	}
+	raw, dbusErr = svc.GetPowerRegression()
+	if dbusErr != nil {
+		t.Fatalf("GetPowerRegression() error = %v", dbusErr)
+	}
+	var got collector.PowerRegression
+	if err := decodeReply(raw, &got); err != nil {
+		t.Fatalf("decodeReply() error = %v", err)
+	}
+	if got != want {
+		t.Fatalf("GetPowerRegression() = %+v, want %+v", got, want)
+	}
+}
+
+func TestService_RunCalibrationUnauthorized(t *testing.T) {
+	svc, _, _ := newTestService(t)
+
+	var gotSender godbus.Sender
+	var gotAction string
+	svc.authorize = func(sender godbus.Sender, action string) error {
+		gotSender, gotAction = sender, action
+		return errors.New("not authorized for " + action)
+	}
+	svc.runCalibration = func(calibration.RunOptions, func(calibration.Progress)) (calibration.CalibrationResult, error) {
+		t.Error("calibration ran without authorization")
+		return calibration.CalibrationResult{}, nil
+	}
+
+	if _, err := svc.RunCalibration(":1.42"); err == nil {
+		t.Fatal("RunCalibration() unauthorized error = nil, want error")
+	}
+	if gotSender != ":1.42" || gotAction != CalibrateAction {
+		t.Fatalf("authorize(%q, %q), want (%q, %q)", gotSender, gotAction, ":1.42", CalibrateAction)
+	}
+}
+
+func TestService_RunCalibrationError(t *testing.T) {
+	svc, db, _ := newTestService(t)
+
+	svc.authorize = func(godbus.Sender, string) error { return nil }
+
+	svc.runCalibration = func(calibration.RunOptions, func(calibration.Progress)) (calibration.CalibrationResult, error) {
+		return calibration.CalibrationResult{}, errors.New("pin CPU: permission denied")
+	}
+	signals := make(chan string, 1)
+	svc.emit = func(name, payload string) {
+		if name == "CalibrationComplete" {
+			signals <- payload
+		}
+	}
+
+	if _, err := svc.RunCalibration(":1.42"); err != nil {
+		t.Fatalf("RunCalibration() error = %v", err)
+	}
+	var done CalibrationComplete
+	if err := decodeReply(<-signals, &done); err != nil {
+		t.Fatalf("decodeReply(complete) error = %v", err)
+	}
+	if done.Result != nil || done.Error != "pin CPU: permission denied" {
+		t.Fatalf("complete = %+v, want error only", done)
+	}
+	annotations, err := db.AnnotationsInRange(0, time.Now().Unix())
+	if err != nil {
+		t.Fatalf("AnnotationsInRange() error = %v", err)
+	}
+	if len(annotations) != 1 || annotations[0].Text != "Calibration run failed" {
+		t.Fatalf("annotations = %+v, want one failed calibration run", annotations)
+	}
+}
@@ -0,0 +1,264 @@
+// Package derived parses and evaluates the arithmetic expressions of
+// user-defined derived series, such as "power - display_est - cpu_est".
+// Expressions hold only numbers, the series named in Variables, + - * /,
+// unary minus and parentheses, so a config file cannot run anything else.
+package derived
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Names of the series an expression can refer to, all in watts.
+const (
+	// VarPower is the average battery power.
+	VarPower = "power"
+	// VarDisplayEst is the display power the background display model
+	// predicts at the average brightness.
+	VarDisplayEst = "display_est"
+	// VarCPUEst is the CPU power the background display model's CPU term
+	// predicts at the average CPU activity.
+	VarCPUEst = "cpu_est"
+)
+
+// Variables lists the series an expression can refer to.
+var Variables = []string{VarPower, VarDisplayEst, VarCPUEst}
+
+const (
+	// MaxExpressionLength bounds the length of an expression in bytes.
+	MaxExpressionLength = 256
+	// maxDepth bounds the nesting of parentheses and unary minus, keeping
+	// the recursive descent parser's stack small.
+	maxDepth = 32
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,31}$`)
+
+// ValidateName checks the name of a derived series: a lowercase letter
+// followed by up to 31 lowercase letters, digits or underscores.
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid series name %q: want a lowercase letter followed by up to 31 lowercase letters, digits or underscores", name)
+	}
+	return nil
+}
+
+// Expr is a parsed expression.
+type Expr struct {
+	root node
+	vars []string
+}
+
+// Vars returns the series the expression refers to, sorted and without
+// duplicates.
+func (e *Expr) Vars() []string {
+	return slices.Clone(e.vars)
+}
+
+// Eval evaluates the expression with the given series values. ok is false
+// when a series it refers to is missing from vars or the result is not a
+// finite number, e.g. after a division by zero.
+func (e *Expr) Eval(vars map[string]float64) (v float64, ok bool) {
+	for _, name := range e.vars {
+		if _, ok := vars[name]; !ok {
+			return 0, false
+		}
+	}
+	v = e.root.eval(vars)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+type node interface {
+	eval(vars map[string]float64) float64
+}
+
+type number float64
+
+func (n number) eval(map[string]float64) float64 { return float64(n) }
+
+type variable string
+
+func (v variable) eval(vars map[string]float64) float64 { return vars[string(v)] }
+
+type negation struct{ x node }
+
+func (n negation) eval(vars map[string]float64) float64 { return -n.x.eval(vars) }
+
+type binary struct {
+	op   byte
+	x, y node
+}
+
+func (b binary) eval(vars map[string]float64) float64 {
+	x, y := b.x.eval(vars), b.y.eval(vars)
+	switch b.op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	default:
+		return x / y
+	}
+}
+
+// Parse parses src. Errors give the byte offset of the problem.
+func Parse(src string) (*Expr, error) {
+	if len(src) > MaxExpressionLength {
+		return nil, fmt.Errorf("expression is %d bytes, at most %d allowed", len(src), MaxExpressionLength)
+	}
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("expression is empty")
+	}
+	p := &parser{src: src}
+	root, err := p.expr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	e := &Expr{root: root}
+	for name := range p.vars {
+		e.vars = append(e.vars, name)
+	}
+	slices.Sort(e.vars)
+	return e, nil
+}
+
+// parser is a recursive descent parser over the grammar
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | name | "(" expr ")"
+type parser struct {
+	src  string
+	pos  int
+	vars map[string]bool
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end.
+func (p *parser) peek() byte {
+	p.skipSpace()
+	if p.pos == len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) expr(depth int) (node, error) {
+	x, err := p.term(depth)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		y, err := p.term(depth)
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op, x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) term(depth int) (node, error) {
+	x, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		y, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		x = binary{op, x, y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary(depth int) (node, error) {
+	if depth >= maxDepth {
+		return nil, p.errorf("nested more than %d deep", maxDepth)
+	}
+	if p.peek() == '-' {
+		p.pos++
+		x, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return negation{x}, nil
+	}
+	return p.primary(depth)
+}
+
+func (p *parser) primary(depth int) (node, error) {
+	c := p.peek()
+	start := p.pos
+	switch {
+	case c == 0:
+		return nil, p.errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		x, err := p.expr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, p.errorf("missing )")
+		}
+		p.pos++
+		return x, nil
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			p.pos = start
+			return nil, p.errorf("invalid number %q", text)
+		}
+		return number(v), nil
+	case isNameStart(c):
+		for p.pos < len(p.src) && (isNameStart(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		if !slices.Contains(Variables, name) {
+			p.pos = start
+			return nil, p.errorf("unknown series %q, want one of %s", name, strings.Join(Variables, ", "))
+		}
+		if p.vars == nil {
+			p.vars = make(map[string]bool)
+		}
+		p.vars[name] = true
+		return variable(name), nil
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isNameStart(c byte) bool { return c >= 'a' && c <= 'z' || c == '_' }
@@ -0,0 +1,86 @@
+package derived
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{VarPower: 12, VarDisplayEst: 3, VarCPUEst: 4.5}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"power - display_est - cpu_est", 4.5},
+		{"power - (display_est + cpu_est)", 4.5},
+		{"2 + 3 * 4", 14},
+		{"(2 + 3) * 4", 20},
+		{"8 / 4 / 2", 1},
+		{"-power + 1", -11},
+		{"--2", 2},
+		{"display_est / power * 100", 25},
+		{"  .5*power\t", 6},
+	}
+	for _, tt := range tests {
+		e, err := Parse(tt.src)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tt.src, err)
+		}
+		if got, ok := e.Eval(vars); !ok || got != tt.want {
+			t.Errorf("Eval(%q) = %v, %v; want %v", tt.src, got, ok, tt.want)
+		}
+	}
+}
+
+func TestEval_Unavailable(t *testing.T) {
+	e, err := Parse("cpu_est + power / display_est")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := e.Vars(); !slices.Equal(got, []string{VarCPUEst, VarDisplayEst, VarPower}) {
+		t.Fatalf("Vars() = %q, want all three, sorted", got)
+	}
+	if v, ok := e.Eval(map[string]float64{VarPower: 10, VarDisplayEst: 2}); ok {
+		t.Fatalf("Eval(without cpu_est) = %v, want not ok", v)
+	}
+	if v, ok := e.Eval(map[string]float64{VarPower: 10, VarDisplayEst: 0, VarCPUEst: 1}); ok {
+		t.Fatalf("Eval(division by zero) = %v, want not ok", v)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{"", "empty"},
+		{"power -", "unexpected end"},
+		{"power + rapl", `offset 8: unknown series "rapl"`},
+		{"(power", "missing )"},
+		{"power)", `unexpected ')'`},
+		{"power ^ 2", `unexpected '^'`},
+		{"1.2.3", `offset 0: invalid number "1.2.3"`},
+		{"os.exit(1)", `unknown series "os"`},
+		{strings.Repeat("(", 40) + "1" + strings.Repeat(")", 40), "nested more than"},
+		{strings.Repeat("1+", 200) + "1", "at most 256"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.src); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Parse(%q) error = %v, want containing %q", tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"residual", "other_w", "a1"} {
+		if err := ValidateName(name); err != nil {
+			t.Errorf("ValidateName(%q) error = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Residual", "1st", "with space", strings.Repeat("a", 33)} {
+		if err := ValidateName(name); err == nil {
+			t.Errorf("ValidateName(%q) = nil, want error", name)
+		}
+	}
+}
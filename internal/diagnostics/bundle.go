@@ -0,0 +1,200 @@
+// Package diagnostics builds a zip bundle of configuration, battery health,
+// build info and recent stored data to attach to bug reports.
+package diagnostics
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/config"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/storage"
+)
+
+// redacted replaces values removed from a bundle with Options.Redact set.
+const redacted = "<redacted>"
+
+// fullHistoryTables are not pruned as a whole and are small, so the
+// bundle includes all of their rows rather than only the recent window.
+var fullHistoryTables = []string{"battery_health_snapshots", "annotations"}
+
+// Options configures WriteBundle.
+type Options struct {
+	// Store is the database to dump. It may be nil when the database could
+	// not be opened; the bundle then records the reason instead.
+	Store    *storage.DB
+	StoreErr error
+
+	Config *config.Config
+
+	// Since bounds the rows included from the time-series tables.
+	Since time.Time
+
+	// Redact replaces file paths, the battery serial and process command
+	// lines with a placeholder.
+	Redact bool
+
+	// CollectHealth reads live battery health; nil uses
+	// collector.CollectBatteryHealth on Config's battery device, with
+	// capacities in Wh at Config's voltage basis.
+	CollectHealth func() (*collector.BatteryHealth, error)
+}
+
+// WriteBundle writes the diagnostic bundle as a zip archive to w. Parts that
+// cannot be gathered are listed in errors.txt so a partial bundle is still
+// useful; only failures writing the archive itself are returned.
+func WriteBundle(w io.Writer, opts Options) error {
+	zw := zip.NewWriter(w)
+	b := &bundle{zw: zw, now: time.Now()}
+
+	b.add("version.txt", func(w io.Writer) error {
+		_, err := io.WriteString(w, versionInfo())
+		return err
+	})
+
+	if opts.Config != nil {
+		cfg := *opts.Config
+		if opts.Redact {
+			cfg.Storage.DBPath = redacted
+			cfg.Storage.StateLogPath = redacted
+		}
+		b.add("config.toml", func(w io.Writer) error {
+			return toml.NewEncoder(w).Encode(cfg)
+		})
+	}
+
+	collect := opts.CollectHealth
+	if collect == nil {
+		var battery string
+		basis := collector.WhBasisMinDesign
+		if opts.Config != nil {
+			battery = opts.Config.Collection.BatteryDevice
+			basis = collector.WhVoltageBasis(opts.Config.Collection.WhVoltageBasis)
+		}
+		collect = func() (*collector.BatteryHealth, error) {
+			h, err := collector.CollectBatteryHealth(battery)
+			if err == nil {
+				h.SetWhBasis(basis)
+			}
+			return h, err
+		}
+	}
+	if health, err := collect(); err != nil {
+		b.fail("battery_health.json", err)
+	} else {
+		if opts.Redact {
+			health.Serial = redacted
+		}
+		b.add("battery_health.json", func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(health)
+		})
+	}
+
+	if opts.Store == nil {
+		b.fail("database", opts.StoreErr)
+	} else {
+		b.add("schema.sql", func(w io.Writer) error {
+			schema, err := opts.Store.Schema()
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, schema)
+			return err
+		})
+
+		var transform func(column, value string) string
+		if opts.Redact {
+			transform = redactColumn
+		}
+		for _, table := range storage.RetainedTables() {
+			b.add("tables/"+table+".csv", func(w io.Writer) error {
+				return opts.Store.WriteTableCSV(w, table, opts.Since.Unix(), transform)
+			})
+		}
+		for _, table := range fullHistoryTables {
+			b.add("tables/"+table+".csv", func(w io.Writer) error {
+				return opts.Store.WriteTableCSV(w, table, 0, transform)
+			})
+		}
+	}
+
+	if b.err != nil {
+		return b.err
+	}
+	if len(b.failures) > 0 {
+		b.add("errors.txt", func(w io.Writer) error {
+			_, err := io.WriteString(w, strings.Join(b.failures, "\n")+"\n")
+			return err
+		})
+		if b.err != nil {
+			return b.err
+		}
+	}
+	return zw.Close()
+}
+
+// bundle accumulates zip entries, keeping the first archive write error and
+// a list of parts that could not be gathered.
+type bundle struct {
+	zw       *zip.Writer
+	now      time.Time
+	err      error
+	failures []string
+}
+
+// add writes one entry. A failure from fill is recorded in errors.txt; the
+// partially written entry stays in the archive.
+func (b *bundle) add(name string, fill func(io.Writer) error) {
+	if b.err != nil {
+		return
+	}
+	w, err := b.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: b.now})
+	if err != nil {
+		b.err = fmt.Errorf("create %s: %w", name, err)
+		return
+	}
+	if err := fill(w); err != nil {
+		b.fail(name, err)
+	}
+}
+
+func (b *bundle) fail(name string, err error) {
+	b.failures = append(b.failures, fmt.Sprintf("%s: %v", name, err))
+}
+
+// redactColumn blanks stored process command lines, which can contain paths
+// and arguments.
+func redactColumn(column, value string) string {
+	if column == "cmdline" && value != "" {
+		return redacted
+	}
+	return value
+}
+
+// versionInfo describes the running binary from its embedded build info.
+func versionInfo() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		b.WriteString("build info: unavailable\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "module: %s %s\n", info.Main.Path, info.Main.Version)
+	for _, s := range info.Settings {
+		if strings.HasPrefix(s.Key, "vcs.") {
+			fmt.Fprintf(&b, "%s: %s\n", s.Key, s.Value)
+		}
+	}
+	return b.String()
+}
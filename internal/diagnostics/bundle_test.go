@@ -0,0 +1,165 @@
+package diagnostics
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/config"
+	"github.com/cptspacemanspiff/gnome-power-display/internal/storage"
+)
+
+func openTestDB(t *testing.T) *storage.DB {
+	t.Helper()
+	db, err := storage.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("storage.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// readBundle returns the contents of each file in a zip archive by name.
+func readBundle(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func testHealth() (*collector.BatteryHealth, error) {
+	return &collector.BatteryHealth{Manufacturer: "ACME", Serial: "SN-12345", CycleCount: 42}, nil
+}
+
+func TestWriteBundle(t *testing.T) {
+	db := openTestDB(t)
+	for _, ts := range []int64{100, 300} {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, PowerUW: 5000000, CapacityPct: 80, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	if err := db.InsertProcessSamples([]collector.ProcessSample{
+		{Timestamp: 300, PID: 7, Comm: "editor", Cmdline: "/home/user/bin/editor notes.txt", CPUTicksDelta: 3},
+	}); err != nil {
+		t.Fatalf("InsertProcessSamples() error = %v", err)
+	}
+	if _, err := db.InsertBatteryHealthSnapshot(collector.BatteryHealthSnapshot{Timestamp: 10, ChargeFullUAH: 5000000, CycleCount: 40}); err != nil {
+		t.Fatalf("InsertBatteryHealthSnapshot() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	err := WriteBundle(&buf, Options{
+		Store:         db,
+		Config:        config.DefaultConfig(),
+		Since:         time.Unix(200, 0),
+		CollectHealth: testHealth,
+	})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+
+	for _, name := range []string{"version.txt", "config.toml", "battery_health.json", "schema.sql"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("bundle is missing %s", name)
+		}
+	}
+	for _, table := range append(storage.RetainedTables(), fullHistoryTables...) {
+		if _, ok := files["tables/"+table+".csv"]; !ok {
+			t.Errorf("bundle is missing tables/%s.csv", table)
+		}
+	}
+	if errs, ok := files["errors.txt"]; ok {
+		t.Errorf("bundle has errors.txt:\n%s", errs)
+	}
+
+	if battery := files["tables/battery_samples.csv"]; strings.Contains(battery, ",100,") || !strings.Contains(battery, ",300,") {
+		t.Errorf("battery_samples.csv should hold only rows since ts=200:\n%s", battery)
+	}
+	if snapshots := files["tables/battery_health_snapshots.csv"]; !strings.Contains(snapshots, ",10,") {
+		t.Errorf("battery_health_snapshots.csv should hold the full history:\n%s", snapshots)
+	}
+	if !strings.Contains(files["config.toml"], "/var/lib/power-monitor/data.db") {
+		t.Errorf("config.toml is missing the db path:\n%s", files["config.toml"])
+	}
+	if !strings.Contains(files["battery_health.json"], "SN-12345") {
+		t.Errorf("battery_health.json is missing the serial:\n%s", files["battery_health.json"])
+	}
+}
+
+func TestWriteBundle_Redact(t *testing.T) {
+	db := openTestDB(t)
+	if err := db.InsertProcessSamples([]collector.ProcessSample{
+		{Timestamp: 300, PID: 7, Comm: "editor", Cmdline: "/home/user/bin/editor notes.txt", CPUTicksDelta: 3},
+	}); err != nil {
+		t.Fatalf("InsertProcessSamples() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	err := WriteBundle(&buf, Options{
+		Store:         db,
+		Config:        config.DefaultConfig(),
+		Redact:        true,
+		CollectHealth: testHealth,
+	})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+
+	for name, content := range files {
+		for _, secret := range []string{"/var/lib/power-monitor", "SN-12345", "/home/user"} {
+			if strings.Contains(content, secret) {
+				t.Errorf("%s contains %q after redaction", name, secret)
+			}
+		}
+	}
+	if !strings.Contains(files["tables/process_samples.csv"], "editor") {
+		t.Errorf("process_samples.csv lost the comm column:\n%s", files["tables/process_samples.csv"])
+	}
+}
+
+func TestWriteBundle_RecordsFailures(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteBundle(&buf, Options{
+		StoreErr: errors.New("database disk image is malformed"),
+		CollectHealth: func() (*collector.BatteryHealth, error) {
+			return nil, errors.New("no battery found")
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteBundle() error = %v", err)
+	}
+	files := readBundle(t, buf.Bytes())
+
+	errs := files["errors.txt"]
+	for _, want := range []string{"no battery found", "database disk image is malformed"} {
+		if !strings.Contains(errs, want) {
+			t.Errorf("errors.txt is missing %q:\n%s", want, errs)
+		}
+	}
+	if _, ok := files["version.txt"]; !ok {
+		t.Error("bundle is missing version.txt")
+	}
+}
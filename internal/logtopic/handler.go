@@ -0,0 +1,65 @@
+// Package logtopic filters slog records by topic, backing the daemon's -log
+// flag.
+package logtopic
+
+import (
+	"context"
+	"log/slog"
+)
+
+// All is the topic that enables every topic.
+const All = "all"
+
+// Handler wraps an slog.Handler and filters records by a "topic" attribute.
+// Records without a topic attribute always pass through (startup messages,
+// errors). Records with a topic only pass if that topic is enabled.
+type Handler struct {
+	inner  slog.Handler
+	topics map[string]bool
+	topic  string // set when WithAttrs includes a "topic" key
+}
+
+// NewHandler returns a Handler passing records of the enabled topics to
+// inner. Enabling All passes everything.
+func NewHandler(inner slog.Handler, topics map[string]bool) *Handler {
+	return &Handler{inner: inner, topics: topics}
+}
+
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+	if h.topics[All] {
+		return h.inner.Handle(ctx, r)
+	}
+	topic := h.topic
+	if topic == "" {
+		// Check record-level attrs as fallback.
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == "topic" {
+				topic = a.Value.String()
+				return false
+			}
+			return true
+		})
+	}
+	if topic != "" && !h.topics[topic] {
+		return nil
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	topic := h.topic
+	for _, a := range attrs {
+		if a.Key == "topic" {
+			topic = a.Value.String()
+		}
+	}
+	return &Handler{inner: h.inner.WithAttrs(attrs), topics: h.topics, topic: topic}
+}
+
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{inner: h.inner.WithGroup(name), topics: h.topics, topic: h.topic}
+}
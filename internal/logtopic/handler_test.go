@@ -0,0 +1,60 @@
+package logtopic
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// newTestLogger returns a logger filtering on topics and the buffer its
+// passed records are written to.
+func newTestLogger(topics ...string) (*slog.Logger, *bytes.Buffer) {
+	enabled := make(map[string]bool)
+	for _, t := range topics {
+		enabled[t] = true
+	}
+	var buf bytes.Buffer
+	inner := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return slog.New(NewHandler(inner, enabled)), &buf
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		topics []string
+		log    func(*slog.Logger)
+		want   bool
+	}{
+		{"no topic passes with none enabled", nil, func(l *slog.Logger) { l.Info("msg") }, true},
+		{"WithAttrs topic disabled", []string{"sleep"}, func(l *slog.Logger) { l.With("topic", "battery").Info("msg") }, false},
+		{"WithAttrs topic enabled", []string{"battery"}, func(l *slog.Logger) { l.With("topic", "battery").Info("msg") }, true},
+		{"record topic disabled", []string{"sleep"}, func(l *slog.Logger) { l.Info("msg", "topic", "battery") }, false},
+		{"record topic enabled", []string{"battery"}, func(l *slog.Logger) { l.Info("msg", "topic", "battery") }, true},
+		{"all passes WithAttrs topic", []string{All}, func(l *slog.Logger) { l.With("topic", "battery").Info("msg") }, true},
+		{"all passes record topic", []string{All}, func(l *slog.Logger) { l.Info("msg", "topic", "battery") }, true},
+		{"WithAttrs topic wins over record topic", []string{"battery"}, func(l *slog.Logger) { l.With("topic", "sleep").Info("msg", "topic", "battery") }, false},
+		{"later WithAttrs topic replaces earlier", []string{"sleep"}, func(l *slog.Logger) { l.With("topic", "battery").With("topic", "sleep").Info("msg") }, true},
+		{"topic survives WithGroup", []string{"sleep"}, func(l *slog.Logger) { l.With("topic", "battery").WithGroup("g").Info("msg") }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, buf := newTestLogger(tt.topics...)
+			tt.log(logger)
+			if got := strings.Contains(buf.String(), "msg=msg"); got != tt.want {
+				t.Fatalf("record passed = %v, want %v (output %q)", got, tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestHandler_Enabled(t *testing.T) {
+	inner := slog.NewTextHandler(&bytes.Buffer{}, &slog.HandlerOptions{Level: slog.LevelInfo})
+	h := NewHandler(inner, nil)
+	if h.Enabled(t.Context(), slog.LevelDebug) {
+		t.Fatal("Enabled(Debug) = true, want the inner handler's level")
+	}
+	if !h.Enabled(t.Context(), slog.LevelInfo) {
+		t.Fatal("Enabled(Info) = false, want true")
+	}
+}
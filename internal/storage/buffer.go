@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// pendingSeries holds rows of one time series that are waiting for the next
+// batched commit.
+type pendingSeries[T any] struct {
+	series *timeSeries[T]
+	at     func(v T) int64
+	rows   []T
+}
+
+// merge appends the pending rows within [from, to] to stored, which is in
+// time order, and keeps it so. Pending rows were inserted last, so they sort
+// after stored rows with the same time.
+func (p *pendingSeries[T]) merge(stored []T, from, to int64) []T {
+	n := len(stored)
+	for _, v := range p.rows {
+		if t := p.at(v); t >= from && t <= to {
+			stored = append(stored, v)
+		}
+	}
+	if len(stored) > n {
+		slices.SortStableFunc(stored, func(a, b T) int { return cmp.Compare(p.at(a), p.at(b)) })
+	}
+	return stored
+}
+
+func (p *pendingSeries[T]) flush(tx *sql.Tx) error {
+	return p.series.insertRows(tx, p.rows)
+}
+
+func (p *pendingSeries[T]) reset() {
+	p.rows = nil
+}
+
+// pendingLifetimes holds process lifetimes waiting for the next batched
+// commit. A process is active in many cycles, so only its widest pending
+// lifetime is kept.
+type pendingLifetimes struct {
+	rows map[lifetimeKey]collector.ProcessLifetime
+}
+
+// lifetimeKey identifies a process as the process_lifetimes table does.
+type lifetimeKey struct {
+	pid       int
+	startTime int64
+}
+
+func keyOf(l collector.ProcessLifetime) lifetimeKey {
+	return lifetimeKey{l.PID, l.StartTime}
+}
+
+// widen returns l with its first and last seen times extended to cover o.
+func widen(l, o collector.ProcessLifetime) collector.ProcessLifetime {
+	l.Comm = o.Comm
+	l.FirstSeen = min(l.FirstSeen, o.FirstSeen)
+	l.LastSeen = max(l.LastSeen, o.LastSeen)
+	return l
+}
+
+// add merges lts into the pending lifetimes and returns how many processes
+// were not pending before.
+func (p *pendingLifetimes) add(lts []collector.ProcessLifetime) int {
+	if p.rows == nil {
+		p.rows = make(map[lifetimeKey]collector.ProcessLifetime)
+	}
+	added := 0
+	for _, l := range lts {
+		if cur, ok := p.rows[keyOf(l)]; ok {
+			l = widen(cur, l)
+		} else {
+			added++
+		}
+		p.rows[keyOf(l)] = l
+	}
+	return added
+}
+
+// merge combines the pending lifetimes overlapping [from, to] with stored,
+// widening stored rows of the same process, and returns them ordered like
+// ProcessLifetimesInRange.
+func (p *pendingLifetimes) merge(stored []collector.ProcessLifetime, from, to int64) []collector.ProcessLifetime {
+	if len(p.rows) == 0 {
+		return stored
+	}
+	seen := make(map[lifetimeKey]bool, len(stored))
+	for i, l := range stored {
+		if o, ok := p.rows[keyOf(l)]; ok {
+			stored[i] = widen(l, o)
+			seen[keyOf(l)] = true
+		}
+	}
+	for k, l := range p.rows {
+		if !seen[k] && l.FirstSeen <= to && l.LastSeen >= from {
+			stored = append(stored, l)
+		}
+	}
+	slices.SortFunc(stored, func(a, b collector.ProcessLifetime) int {
+		return cmp.Or(cmp.Compare(a.FirstSeen, b.FirstSeen), cmp.Compare(a.PID, b.PID))
+	})
+	return stored
+}
+
+func (p *pendingLifetimes) flush(tx *sql.Tx) error {
+	return upsertProcessLifetimes(tx, slices.Collect(maps.Values(p.rows)))
+}
+
+func (p *pendingLifetimes) reset() {
+	p.rows = nil
+}
+
+// writeBuffer holds the samples written every collection cycle so they can
+// be committed in one transaction per interval instead of several per cycle.
+// Reads through DB merge in the pending rows, so they are visible at once.
+type writeBuffer struct {
+	mu      sync.Mutex
+	maxRows int
+	n       int
+
+	battery   pendingSeries[collector.BatterySample]
+	backlight pendingSeries[collector.BacklightSample]
+	procs     pendingSeries[collector.ProcessSample]
+	cycles    pendingSeries[collector.ProcessCycleStats]
+	freqs     pendingSeries[collector.CPUFreqSample]
+	lifetimes pendingLifetimes
+}
+
+func newWriteBuffer(maxRows int) *writeBuffer {
+	return &writeBuffer{
+		maxRows:   maxRows,
+		battery:   pendingSeries[collector.BatterySample]{series: &batterySamples, at: func(s collector.BatterySample) int64 { return s.Timestamp }},
+		backlight: pendingSeries[collector.BacklightSample]{series: &backlightSamples, at: func(s collector.BacklightSample) int64 { return s.Timestamp }},
+		procs:     pendingSeries[collector.ProcessSample]{series: &processSamples, at: func(s collector.ProcessSample) int64 { return s.Timestamp }},
+		cycles:    pendingSeries[collector.ProcessCycleStats]{series: &processCycleStats, at: func(s collector.ProcessCycleStats) int64 { return s.Timestamp }},
+		freqs:     pendingSeries[collector.CPUFreqSample]{series: &cpuFreqSamples, at: func(s collector.CPUFreqSample) int64 { return s.Timestamp }},
+	}
+}
+
+// flushLocked commits every pending row in one transaction. The rows are
+// dropped even when the commit fails, as an unbuffered insert error would
+// drop its row. b.mu must be held.
+func (b *writeBuffer) flushLocked(db *sql.DB) error {
+	if b.n == 0 {
+		return nil
+	}
+	n := b.n
+	pending := []interface {
+		flush(tx *sql.Tx) error
+		reset()
+	}{&b.battery, &b.backlight, &b.procs, &b.cycles, &b.freqs, &b.lifetimes}
+	defer func() {
+		for _, p := range pending {
+			p.reset()
+		}
+		b.n = 0
+	}()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	for _, p := range pending {
+		if err := p.flush(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("flush %d buffered rows: %w", n, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit %d buffered rows: %w", n, err)
+	}
+	return nil
+}
+
+// EnableWriteBuffer makes battery, backlight, process, process lifetime and
+// CPU frequency inserts collect in memory until Flush, or until maxRows rows are pending.
+// It must be called before the DB is shared between goroutines.
+func (d *DB) EnableWriteBuffer(maxRows int) {
+	d.buf = newWriteBuffer(max(maxRows, 1))
+}
+
+// Flush commits any buffered rows in a single transaction. It is a no-op
+// without a write buffer.
+func (d *DB) Flush() error {
+	if d.buf == nil {
+		return nil
+	}
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	return d.buf.flushLocked(d.db)
+}
+
+// bufferRows adds vs to p, flushing once the buffer reaches its row limit.
+func bufferRows[T any](d *DB, p *pendingSeries[T], vs ...T) error {
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	p.rows = append(p.rows, vs...)
+	d.buf.n += len(vs)
+	if d.buf.n >= d.buf.maxRows {
+		return d.buf.flushLocked(d.db)
+	}
+	return nil
+}
+
+// rangeWithPending returns the stored rows of p's series within [from, to]
+// with the pending ones merged in. The buffer lock is held across both so a
+// concurrent flush can't move rows between them.
+func rangeWithPending[T any](d *DB, p *pendingSeries[T], from, to int64) ([]T, error) {
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	stored, err := p.series.inRange(d.db, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return p.merge(stored, from, to), nil
+}
+
+// latestWithPending returns the last pending row of p, or the latest stored
+// one when none is pending.
+func latestWithPending[T any](d *DB, p *pendingSeries[T]) (*T, error) {
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	if n := len(p.rows); n > 0 {
+		v := p.rows[n-1]
+		return &v, nil
+	}
+	return p.series.latest(d.db)
+}
@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+// storedBatteryCount counts battery rows committed to the file at path, as
+// seen through a separate connection.
+func storedBatteryCount(t *testing.T, path string) int {
+	t.Helper()
+	other, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer other.Close()
+	samples, err := other.BatterySamplesInRange(0, 1<<62)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	return len(samples)
+}
+
+func TestWriteBufferReadsPendingRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	s1 := collector.BatterySample{Timestamp: 10, PowerUW: 1000, Status: "Discharging"}
+	if err := db.InsertBatterySample(s1); err != nil {
+		t.Fatalf("InsertBatterySample(s1) error = %v", err)
+	}
+	db.EnableWriteBuffer(100)
+	s2 := collector.BatterySample{Timestamp: 20, PowerUW: 2000, Status: "Discharging"}
+	if err := db.InsertBatterySample(s2); err != nil {
+		t.Fatalf("InsertBatterySample(s2) error = %v", err)
+	}
+	freqs := []collector.CPUFreqSample{{Timestamp: 20, CPUID: 0, FreqKHz: 800000, IsPCore: true}}
+	if err := db.InsertCPUFreqSamples(freqs); err != nil {
+		t.Fatalf("InsertCPUFreqSamples() error = %v", err)
+	}
+
+	if n := storedBatteryCount(t, path); n != 1 {
+		t.Fatalf("stored battery rows before Flush = %d, want 1", n)
+	}
+	latest, err := db.LatestBatterySample()
+	if err != nil {
+		t.Fatalf("LatestBatterySample() error = %v", err)
+	}
+	if latest == nil || *latest != s2 {
+		t.Fatalf("LatestBatterySample() = %+v, want pending %+v", latest, s2)
+	}
+	got, err := db.BatterySamplesInRange(0, 30)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	if want := []collector.BatterySample{s1, s2}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("BatterySamplesInRange() = %+v, want %+v", got, want)
+	}
+	gotFreqs, err := db.CPUFreqSamplesInRange(0, 30, 0)
+	if err != nil {
+		t.Fatalf("CPUFreqSamplesInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotFreqs, freqs) {
+		t.Fatalf("CPUFreqSamplesInRange() = %+v, want %+v", gotFreqs, freqs)
+	}
+
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if n := storedBatteryCount(t, path); n != 2 {
+		t.Fatalf("stored battery rows after Flush = %d, want 2", n)
+	}
+	got, err = db.BatterySamplesInRange(0, 30)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("BatterySamplesInRange() after Flush returned %d samples, want 2", len(got))
+	}
+}
+
+func TestWriteBufferMergesPendingLifetimes(t *testing.T) {
+	db := openTestDB(t)
+
+	stored := collector.ProcessLifetime{PID: 1, StartTime: 500, Comm: "a", FirstSeen: 10, LastSeen: 20}
+	if err := db.UpsertProcessLifetimes([]collector.ProcessLifetime{stored}); err != nil {
+		t.Fatalf("UpsertProcessLifetimes() error = %v", err)
+	}
+	db.EnableWriteBuffer(100)
+	for ts := int64(30); ts <= 50; ts += 10 {
+		if err := db.UpsertProcessLifetimes([]collector.ProcessLifetime{
+			{PID: 1, StartTime: 500, Comm: "a", FirstSeen: 30, LastSeen: ts},
+			{PID: 2, StartTime: 600, Comm: "b", FirstSeen: 30, LastSeen: ts},
+		}); err != nil {
+			t.Fatalf("UpsertProcessLifetimes(ts=%d) error = %v", ts, err)
+		}
+	}
+
+	want := []collector.ProcessLifetime{
+		{PID: 1, StartTime: 500, Comm: "a", FirstSeen: 10, LastSeen: 50},
+		{PID: 2, StartTime: 600, Comm: "b", FirstSeen: 30, LastSeen: 50},
+	}
+	for _, phase := range []string{"pending", "flushed"} {
+		if phase == "flushed" {
+			if err := db.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+		}
+		got, err := db.ProcessLifetimesInRange(0, 100)
+		if err != nil {
+			t.Fatalf("ProcessLifetimesInRange() %s error = %v", phase, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("ProcessLifetimesInRange() %s = %+v, want %+v", phase, got, want)
+		}
+	}
+	if n := countRows(t, db, "process_lifetimes"); n != 2 {
+		t.Fatalf("process_lifetimes rows after Flush = %d, want 2", n)
+	}
+}
+
+func TestWriteBufferBatteryBuckets(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	insert := func(ts, powerUW int64, pct int) {
+		t.Helper()
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, PowerUW: powerUW, CapacityPct: pct, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	insert(10, 1000, 90)
+	db.EnableWriteBuffer(100)
+	// One pending sample joins the stored one's bucket, one starts a bucket
+	// of its own and one lies past the range.
+	insert(20, 3000, 80)
+	insert(70, 4000, 70)
+	insert(200, 9000, 60)
+
+	want := []collector.BatteryBucket{
+		{Timestamp: 0, Count: 2, MinCapacityPct: 80, MaxCapacityPct: 90, AvgCapacityPct: 85, MinPowerUW: 1000, MaxPowerUW: 3000, AvgPowerUW: 2000},
+		{Timestamp: 60, Count: 1, MinCapacityPct: 70, MaxCapacityPct: 70, AvgCapacityPct: 70, MinPowerUW: 4000, MaxPowerUW: 4000, AvgPowerUW: 4000},
+	}
+	got, err := db.BatteryBucketsInRange(0, 100, 60)
+	if err != nil {
+		t.Fatalf("BatteryBucketsInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("BatteryBucketsInRange() before Flush = %+v, want %+v", got, want)
+	}
+	if err := db.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	got, err = db.BatteryBucketsInRange(0, 100, 60)
+	if err != nil {
+		t.Fatalf("BatteryBucketsInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("BatteryBucketsInRange() after Flush = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteBufferFlushesAtMaxRows(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	db.EnableWriteBuffer(3)
+
+	for ts := int64(1); ts <= 2; ts++ {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, Status: "Full"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	if n := storedBatteryCount(t, path); n != 0 {
+		t.Fatalf("stored battery rows below limit = %d, want 0", n)
+	}
+	if err := db.InsertBacklightSample(collector.BacklightSample{Timestamp: 3, Brightness: 1, MaxBrightness: 2}); err != nil {
+		t.Fatalf("InsertBacklightSample() error = %v", err)
+	}
+	if n := storedBatteryCount(t, path); n != 2 {
+		t.Fatalf("stored battery rows at limit = %d, want 2", n)
+	}
+}
+
+func TestWriteBufferFlushesOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	db.EnableWriteBuffer(100)
+	if err := db.InsertBatterySample(collector.BatterySample{Timestamp: 1, Status: "Full"}); err != nil {
+		t.Fatalf("InsertBatterySample() error = %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if n := storedBatteryCount(t, path); n != 1 {
+		t.Fatalf("stored battery rows after Close = %d, want 1", n)
+	}
+}
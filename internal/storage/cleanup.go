@@ -1,33 +1,101 @@
 package storage
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
-// DeleteOlderThan deletes rows from all tables where the timestamp is before
-// the given unix epoch. Returns the total number of deleted rows.
-func (d *DB) DeleteOlderThan(before int64) (int64, error) {
+// ErrCleanupTooLarge is returned by DeleteOlderThan when a cleanup would
+// remove more than the allowed share of stored rows. Nothing is deleted.
+var ErrCleanupTooLarge = errors.New("cleanup would delete too many rows")
+
+// timeTable names a table and the column holding its unix timestamp.
+type timeTable struct {
+	name   string
+	column string
+}
+
+// retainedTables are the time-series tables pruned by DeleteOlderThan.
+var retainedTables = []timeTable{
+	batterySamples.timeTable,
+	backlightSamples.timeTable,
+	powerStateEvents.timeTable,
+	processSamples.timeTable,
+	processCycleStats.timeTable,
+	processLifetimes.timeTable,
+	cpuFreqSamples.timeTable,
+	cpuBusySamples.timeTable,
+	throttleEvents.timeTable,
+	batteryPresenceEvents.timeTable,
+	idleIntervals.timeTable,
+	displayModelPoints.timeTable,
+}
+
+// prunedRows selects rows DeleteOlderThan prunes by age: the rows of table
+// matching where.
+type prunedRows struct {
+	timeTable
+	where string
+}
+
+// prunedSets are all the rows DeleteOlderThan prunes: every retained table in
+// full, and the automatic annotations, which the daemon adds at each spike,
+// AC change and resume. User annotations are kept for good.
+var prunedSets = append(wholeTables(retainedTables),
+	prunedRows{timeTable{"annotations", "timestamp"}, "source = 'auto'"},
+)
+
+func wholeTables(tables []timeTable) []prunedRows {
+	sets := make([]prunedRows, len(tables))
+	for i, t := range tables {
+		sets[i] = prunedRows{t, "1"}
+	}
+	return sets
+}
+
+// DeleteOlderThan deletes rows from all tables, and automatic annotations,
+// where the timestamp is before the given unix epoch. Returns the total number
+// of deleted rows.
+//
+// As a guard against a clock jumped far into the future, it refuses to delete
+// more than maxDeletePercent of all rows across the tables, returning an
+// error wrapping ErrCleanupTooLarge instead. A maxDeletePercent of 100 or more
+// disables the guard.
+func (d *DB) DeleteOlderThan(before int64, maxDeletePercent int) (int64, error) {
 	tx, err := d.db.Begin()
 	if err != nil {
 		return 0, fmt.Errorf("begin tx: %w", err)
 	}
 
-	var total int64
-	tables := []struct {
-		name   string
-		column string
-	}{
-		{"battery_samples", "timestamp"},
-		{"backlight_samples", "timestamp"},
-		{"power_state_events", "start_time"},
-		{"process_samples", "timestamp"},
-		{"cpu_freq_samples", "timestamp"},
+	// Note: table/column names and conditions are from a hardcoded slice, not user input.
+	// fmt.Sprintf is used here because SQL placeholders (?) only work for values, not identifiers.
+	// This is safe because 'prunedSets' is a compile-time constant slice.
+	if maxDeletePercent < 100 {
+		var rows, stale int64
+		for _, t := range prunedSets {
+			var n, old int64
+			err := tx.QueryRow(
+				fmt.Sprintf("SELECT COUNT(*), COALESCE(SUM(%s < ?), 0) FROM %s WHERE %s", t.column, t.name, t.where),
+				before,
+			).Scan(&n, &old)
+			if err != nil {
+				tx.Rollback()
+				return 0, fmt.Errorf("count %s: %w", t.name, err)
+			}
+			rows += n
+			stale += old
+		}
+		if stale*100 > rows*int64(maxDeletePercent) {
+			tx.Rollback()
+			return 0, fmt.Errorf("%w: %d of %d rows are older than %d, limit is %d%%",
+				ErrCleanupTooLarge, stale, rows, before, maxDeletePercent)
+		}
 	}
 
-	// Note: table/column names are from a hardcoded slice, not user input.
-	// fmt.Sprintf is used here because SQL placeholders (?) only work for values, not identifiers.
-	// This is safe because 'tables' is a compile-time constant slice.
-	for _, t := range tables {
+	var total int64
+	for _, t := range prunedSets {
 		res, err := tx.Exec(
-			fmt.Sprintf("DELETE FROM %s WHERE %s < ?", t.name, t.column),
+			fmt.Sprintf("DELETE FROM %s WHERE %s < ? AND %s", t.name, t.column, t.where),
 			before,
 		)
 		if err != nil {
@@ -43,3 +111,18 @@ func (d *DB) DeleteOlderThan(before int64) (int64, error) {
 	}
 	return total, nil
 }
+
+// DeleteCPUBusyOlderThan deletes CPU busy samples before the given unix
+// epoch, which usually have a shorter retention than the other tables, and
+// returns the number of deleted rows. Call it only after DeleteOlderThan
+// succeeded, whose guard covers this table too.
+func (d *DB) DeleteCPUBusyOlderThan(before int64) (int64, error) {
+	res, err := d.db.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE %s < ?", cpuBusySamples.name, cpuBusySamples.column),
+		before,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("delete from %s: %w", cpuBusySamples.name, err)
+	}
+	return res.RowsAffected()
+}
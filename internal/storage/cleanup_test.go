@@ -1,9 +1,11 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 )
 
@@ -18,17 +20,11 @@ func countRows(t *testing.T, db *DB, table string) int {
 	return n
 }
 
-func TestDeleteOlderThan(t *testing.T) {
-	db := openTestDB(t)
-
-	const (
-		oldTs    int64 = 50
-		cutoffTs int64 = 100
-		newTs    int64 = 150
-	)
+func insertCleanupFixture(t *testing.T, db *DB, timestamps ...int64) {
+	t.Helper()
 
 	// battery_samples
-	for _, ts := range []int64{oldTs, cutoffTs, newTs} {
+	for _, ts := range timestamps {
 		err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, VoltageUV: 11000000, CurrentUA: 1000000, PowerUW: 1100000, CapacityPct: 80, Status: "Discharging"})
 		if err != nil {
 			t.Fatalf("InsertBatterySample(ts=%d): %v", ts, err)
@@ -36,7 +32,7 @@ func TestDeleteOlderThan(t *testing.T) {
 	}
 
 	// backlight_samples
-	for _, ts := range []int64{oldTs, cutoffTs, newTs} {
+	for _, ts := range timestamps {
 		err := db.InsertBacklightSample(collector.BacklightSample{Timestamp: ts, Brightness: 100, MaxBrightness: 500})
 		if err != nil {
 			t.Fatalf("InsertBacklightSample(ts=%d): %v", ts, err)
@@ -44,7 +40,7 @@ func TestDeleteOlderThan(t *testing.T) {
 	}
 
 	// power_state_events
-	for _, ts := range []int64{oldTs, cutoffTs, newTs} {
+	for _, ts := range timestamps {
 		_, err := db.InsertPowerStateEvent(collector.PowerStateEvent{StartTime: ts, EndTime: ts + 10, Type: "suspend", SuspendSecs: 10})
 		if err != nil {
 			t.Fatalf("InsertPowerStateEvent(ts=%d): %v", ts, err)
@@ -52,31 +48,75 @@ func TestDeleteOlderThan(t *testing.T) {
 	}
 
 	// process_samples
-	err := db.InsertProcessSamples([]collector.ProcessSample{
-		{Timestamp: oldTs, PID: 1, Comm: "a", Cmdline: "a", CPUTicksDelta: 1, LastCPU: 0},
-		{Timestamp: cutoffTs, PID: 2, Comm: "b", Cmdline: "b", CPUTicksDelta: 1, LastCPU: 1},
-		{Timestamp: newTs, PID: 3, Comm: "c", Cmdline: "c", CPUTicksDelta: 1, LastCPU: 2},
-	})
-	if err != nil {
+	var procs []collector.ProcessSample
+	for i, ts := range timestamps {
+		procs = append(procs, collector.ProcessSample{Timestamp: ts, PID: i + 1, Comm: "a", Cmdline: "a", CPUTicksDelta: 1, LastCPU: i})
+	}
+	if err := db.InsertProcessSamples(procs); err != nil {
 		t.Fatalf("InsertProcessSamples(): %v", err)
 	}
 
 	// cpu_freq_samples
-	err = db.InsertCPUFreqSamples([]collector.CPUFreqSample{
-		{Timestamp: oldTs, CPUID: 0, FreqKHz: 1000000, IsPCore: true},
-		{Timestamp: cutoffTs, CPUID: 1, FreqKHz: 1000000, IsPCore: false},
-		{Timestamp: newTs, CPUID: 2, FreqKHz: 1000000, IsPCore: true},
-	})
-	if err != nil {
+	var freqs []collector.CPUFreqSample
+	for i, ts := range timestamps {
+		freqs = append(freqs, collector.CPUFreqSample{Timestamp: ts, CPUID: i, FreqKHz: 1000000, IsPCore: i%2 == 0})
+	}
+	if err := db.InsertCPUFreqSamples(freqs); err != nil {
 		t.Fatalf("InsertCPUFreqSamples(): %v", err)
 	}
 
-	deleted, err := db.DeleteOlderThan(cutoffTs)
+	// process_cycle_stats
+	for _, ts := range timestamps {
+		if err := db.InsertProcessCycleStats(collector.ProcessCycleStats{Timestamp: ts, TotalTicks: 10, CapturedTicks: 8, TotalProcs: 3}); err != nil {
+			t.Fatalf("InsertProcessCycleStats(ts=%d): %v", ts, err)
+		}
+	}
+
+	// process_lifetimes, one process per timestamp
+	for i, ts := range timestamps {
+		if err := db.UpsertProcessLifetimes([]collector.ProcessLifetime{{PID: i + 1, StartTime: 10, Comm: "p", FirstSeen: ts - 5, LastSeen: ts}}); err != nil {
+			t.Fatalf("UpsertProcessLifetimes(ts=%d): %v", ts, err)
+		}
+	}
+
+	// throttle_events
+	for _, ts := range timestamps {
+		if err := db.InsertThrottleEvent(collector.ThrottleEvent{StartTime: ts, EndTime: ts + 5, Reason: collector.ThrottleReasonThermal}); err != nil {
+			t.Fatalf("InsertThrottleEvent(ts=%d): %v", ts, err)
+		}
+	}
+
+	// battery_presence_events
+	for _, ts := range timestamps {
+		if err := db.InsertBatteryPresenceEvent(collector.BatteryPresenceEvent{Timestamp: ts, Battery: "BAT1"}); err != nil {
+			t.Fatalf("InsertBatteryPresenceEvent(ts=%d): %v", ts, err)
+		}
+	}
+
+	// display_model_points
+	for _, ts := range timestamps {
+		if err := db.InsertDisplayModelPoint(calibration.ModelPoint{Timestamp: ts, BrightnessPct: 50, PowerUW: 5000000, CPUTicks: 20, Samples: 13}); err != nil {
+			t.Fatalf("InsertDisplayModelPoint(ts=%d): %v", ts, err)
+		}
+	}
+}
+
+func TestDeleteOlderThan(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		oldTs    int64 = 50
+		cutoffTs int64 = 100
+		newTs    int64 = 150
+	)
+	insertCleanupFixture(t, db, oldTs, cutoffTs, newTs)
+
+	deleted, err := db.DeleteOlderThan(cutoffTs, 90)
 	if err != nil {
 		t.Fatalf("DeleteOlderThan() error = %v", err)
 	}
-	if deleted != 5 {
-		t.Fatalf("DeleteOlderThan() deleted = %d, want 5 (one old row per table)", deleted)
+	if deleted != 10 {
+		t.Fatalf("DeleteOlderThan() deleted = %d, want 10 (one old row per table)", deleted)
 	}
 
 	for _, table := range []string{
@@ -84,10 +124,103 @@ func TestDeleteOlderThan(t *testing.T) {
 		"backlight_samples",
 		"power_state_events",
 		"process_samples",
+		"process_cycle_stats",
+		"process_lifetimes",
 		"cpu_freq_samples",
+		"throttle_events",
+		"battery_presence_events",
+		"display_model_points",
 	} {
 		if got := countRows(t, db, table); got != 2 {
 			t.Fatalf("%s row count after cleanup = %d, want 2 (cutoff+new)", table, got)
 		}
 	}
 }
+
+func TestDeleteOlderThan_PrunesOnlyAutoAnnotations(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, a := range []collector.Annotation{
+		{Timestamp: 50, Text: "enabled TLP"},
+		{Timestamp: 50, Text: "AC unplugged", Source: collector.AnnotationSourceAuto},
+		{Timestamp: 150, Text: "AC plugged in (AC)", Source: collector.AnnotationSourceAuto},
+	} {
+		if _, err := db.InsertAnnotation(a); err != nil {
+			t.Fatalf("InsertAnnotation() error = %v", err)
+		}
+	}
+
+	deleted, err := db.DeleteOlderThan(100, 100)
+	if err != nil {
+		t.Fatalf("DeleteOlderThan() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("DeleteOlderThan() deleted = %d, want 1 (the old automatic annotation)", deleted)
+	}
+	got, err := db.AnnotationsInRange(0, 200)
+	if err != nil {
+		t.Fatalf("AnnotationsInRange() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Text != "enabled TLP" || got[1].Timestamp != 150 {
+		t.Fatalf("annotations after cleanup = %+v, want the user note and the recent automatic one", got)
+	}
+}
+
+func TestDeleteCPUBusyOlderThan(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := db.InsertCPUBusySamples([]collector.CPUBusySample{
+		{Timestamp: 50, BusyFraction: 0.5, PeriodSecs: 30},
+		{Timestamp: 100, BusyFraction: 0.5, PeriodSecs: 30},
+	}); err != nil {
+		t.Fatalf("InsertCPUBusySamples() error = %v", err)
+	}
+	if err := db.InsertCPUFreqSamples([]collector.CPUFreqSample{{Timestamp: 50, FreqKHz: 1000}}); err != nil {
+		t.Fatalf("InsertCPUFreqSamples() error = %v", err)
+	}
+
+	deleted, err := db.DeleteCPUBusyOlderThan(100)
+	if err != nil {
+		t.Fatalf("DeleteCPUBusyOlderThan() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("DeleteCPUBusyOlderThan() deleted = %d, want 1", deleted)
+	}
+	if got := countRows(t, db, "cpu_busy_samples"); got != 1 {
+		t.Fatalf("cpu_busy_samples row count = %d, want 1", got)
+	}
+	if got := countRows(t, db, "cpu_freq_samples"); got != 1 {
+		t.Fatalf("cpu_freq_samples row count = %d, want 1 (untouched)", got)
+	}
+}
+
+func TestDeleteOlderThan_RefusesMassDeletion(t *testing.T) {
+	db := openTestDB(t)
+	insertCleanupFixture(t, db, 100, 110, 120)
+
+	// A clock far in the future puts every row past the retention window.
+	futureCutoff := int64(10_000_000_000)
+	deleted, err := db.DeleteOlderThan(futureCutoff, 90)
+	if !errors.Is(err, ErrCleanupTooLarge) {
+		t.Fatalf("DeleteOlderThan(future) error = %v, want ErrCleanupTooLarge", err)
+	}
+	if deleted != 0 {
+		t.Fatalf("DeleteOlderThan(future) deleted = %d, want 0", deleted)
+	}
+	if got := countRows(t, db, "battery_samples"); got != 3 {
+		t.Fatalf("battery_samples row count after refused cleanup = %d, want 3", got)
+	}
+
+	// Deleting 2 of 3 rows per table stays under a 90% limit but not 60%.
+	if _, err := db.DeleteOlderThan(115, 60); !errors.Is(err, ErrCleanupTooLarge) {
+		t.Fatalf("DeleteOlderThan(115, 60) error = %v, want ErrCleanupTooLarge", err)
+	}
+	if deleted, err := db.DeleteOlderThan(115, 90); err != nil || deleted != 20 {
+		t.Fatalf("DeleteOlderThan(115, 90) = %d, %v; want 20, nil", deleted, err)
+	}
+
+	// 100% disables the guard.
+	if deleted, err := db.DeleteOlderThan(futureCutoff, 100); err != nil || deleted != 10 {
+		t.Fatalf("DeleteOlderThan(future, 100) = %d, %v; want 10, nil", deleted, err)
+	}
+}
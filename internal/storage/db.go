@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"cmp"
 	"database/sql"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 )
 
@@ -17,10 +22,17 @@ CREATE TABLE IF NOT EXISTS battery_samples (
 	voltage_uv INTEGER NOT NULL,
 	current_ua INTEGER NOT NULL,
 	power_uw INTEGER NOT NULL,
+	power_smoothed_uw INTEGER NOT NULL DEFAULT 0,
 	sysfs_power_uw INTEGER NOT NULL DEFAULT 0,
 	charge_now_uah INTEGER NOT NULL DEFAULT 0,
 	capacity_pct INTEGER NOT NULL,
-	status TEXT NOT NULL
+	status TEXT NOT NULL,
+	status_code INTEGER NOT NULL DEFAULT 0,
+	ac_source TEXT NOT NULL DEFAULT '',
+	charger_power_uw INTEGER NOT NULL DEFAULT 0,
+	power_source TEXT NOT NULL DEFAULT '',
+	capacity_level TEXT NOT NULL DEFAULT '',
+	battery_count INTEGER NOT NULL DEFAULT 1
 );
 CREATE INDEX IF NOT EXISTS idx_battery_ts ON battery_samples(timestamp);
 
@@ -37,8 +49,10 @@ CREATE TABLE IF NOT EXISTS power_state_events (
 	start_time INTEGER NOT NULL,
 	end_time INTEGER NOT NULL,
 	type TEXT NOT NULL,
+	subtype TEXT NOT NULL DEFAULT '',
 	suspend_secs INTEGER NOT NULL DEFAULT 0,
-	hibernate_secs INTEGER NOT NULL DEFAULT 0
+	hibernate_secs INTEGER NOT NULL DEFAULT 0,
+	suspect INTEGER NOT NULL DEFAULT 0
 );
 CREATE INDEX IF NOT EXISTS idx_power_state_ts ON power_state_events(start_time);
 
@@ -53,6 +67,26 @@ CREATE TABLE IF NOT EXISTS process_samples (
 );
 CREATE INDEX IF NOT EXISTS idx_process_ts ON process_samples(timestamp);
 
+CREATE TABLE IF NOT EXISTS process_cycle_stats (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	total_ticks INTEGER NOT NULL,
+	captured_ticks INTEGER NOT NULL,
+	total_procs INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_process_cycle_ts ON process_cycle_stats(timestamp);
+
+CREATE TABLE IF NOT EXISTS process_lifetimes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	pid INTEGER NOT NULL,
+	start_time INTEGER NOT NULL,
+	comm TEXT NOT NULL,
+	first_seen INTEGER NOT NULL,
+	last_seen INTEGER NOT NULL,
+	UNIQUE (pid, start_time)
+);
+CREATE INDEX IF NOT EXISTS idx_process_lifetimes_ts ON process_lifetimes(last_seen);
+
 CREATE TABLE IF NOT EXISTS cpu_freq_samples (
 	id INTEGER PRIMARY KEY AUTOINCREMENT,
 	timestamp INTEGER NOT NULL,
@@ -62,14 +96,76 @@ CREATE TABLE IF NOT EXISTS cpu_freq_samples (
 );
 CREATE INDEX IF NOT EXISTS idx_cpufreq_ts ON cpu_freq_samples(timestamp);
 
+CREATE TABLE IF NOT EXISTS cpu_busy_samples (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	cpu_id INTEGER NOT NULL,
+	is_p_core INTEGER NOT NULL,
+	busy_fraction REAL NOT NULL,
+	period_secs INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_cpubusy_ts ON cpu_busy_samples(timestamp);
+
+CREATE TABLE IF NOT EXISTS battery_health_snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	charge_full_uah INTEGER NOT NULL,
+	charge_full_design_uah INTEGER NOT NULL,
+	cycle_count INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_health_ts ON battery_health_snapshots(timestamp);
+
+CREATE TABLE IF NOT EXISTS throttle_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	start_time INTEGER NOT NULL,
+	end_time INTEGER NOT NULL,
+	reason TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_throttle_ts ON throttle_events(start_time);
+
+CREATE TABLE IF NOT EXISTS battery_presence_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	present INTEGER NOT NULL,
+	battery TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_battery_presence_ts ON battery_presence_events(timestamp);
+
+CREATE TABLE IF NOT EXISTS idle_intervals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	start_time INTEGER NOT NULL,
+	end_time INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_idle_ts ON idle_intervals(start_time);
+
+CREATE TABLE IF NOT EXISTS display_model_points (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	brightness_pct REAL NOT NULL,
+	power_uw INTEGER NOT NULL,
+	cpu_ticks REAL NOT NULL,
+	samples INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_display_model_ts ON display_model_points(timestamp);
+
+CREATE TABLE IF NOT EXISTS annotations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	timestamp INTEGER NOT NULL,
+	text TEXT NOT NULL,
+	source TEXT NOT NULL DEFAULT 'user'
+);
+CREATE INDEX IF NOT EXISTS idx_annotations_ts ON annotations(timestamp);
+
 `
 
 // DB wraps a SQLite database for power monitor data.
 type DB struct {
-	db *sql.DB
+	db  *sql.DB
+	buf *writeBuffer // nil unless EnableWriteBuffer was called
 }
 
-// Open opens or creates the SQLite database at the given path.
+// Open opens or creates the SQLite database at the given path. An existing
+// file that fails an integrity check yields an error wrapping ErrCorrupt.
 func Open(path string) (*DB, error) {
 	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
 	if err != nil {
@@ -78,6 +174,10 @@ func Open(path string) (*DB, error) {
 	// SQLite performs best with a single shared writer connection in-process.
 	db.SetMaxOpenConns(1)
 	db.SetMaxIdleConns(1)
+	if err := checkIntegrity(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 	if _, err := db.Exec(schema); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("init schema: %w", err)
@@ -89,9 +189,9 @@ func Open(path string) (*DB, error) {
 	return &DB{db: db}, nil
 }
 
-// Close closes the database.
+// Close commits any buffered rows and closes the database.
 func (d *DB) Close() error {
-	return d.db.Close()
+	return errors.Join(d.Flush(), d.db.Close())
 }
 
 // migrate applies schema migrations for existing databases.
@@ -106,6 +206,58 @@ func migrate(db *sql.DB) error {
 	if err != nil && !isDuplicateColumnError(err) {
 		return fmt.Errorf("add sysfs_power_uw column: %w", err)
 	}
+	// Add ac_source column if it doesn't exist (added in v4).
+	_, err = db.Exec("ALTER TABLE battery_samples ADD COLUMN ac_source TEXT NOT NULL DEFAULT ''")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add ac_source column: %w", err)
+	}
+	// Add charger_power_uw column if it doesn't exist (added in v5).
+	_, err = db.Exec("ALTER TABLE battery_samples ADD COLUMN charger_power_uw INTEGER NOT NULL DEFAULT 0")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add charger_power_uw column: %w", err)
+	}
+	// Add power_source column if it doesn't exist (added in v6).
+	_, err = db.Exec("ALTER TABLE battery_samples ADD COLUMN power_source TEXT NOT NULL DEFAULT ''")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add power_source column: %w", err)
+	}
+	// Add capacity_level column if it doesn't exist (added in v7).
+	_, err = db.Exec("ALTER TABLE battery_samples ADD COLUMN capacity_level TEXT NOT NULL DEFAULT ''")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add capacity_level column: %w", err)
+	}
+	// Add power_state_events.subtype column if it doesn't exist (added in v8).
+	_, err = db.Exec("ALTER TABLE power_state_events ADD COLUMN subtype TEXT NOT NULL DEFAULT ''")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add subtype column: %w", err)
+	}
+	// Add power_state_events.suspect column if it doesn't exist (added in v9).
+	_, err = db.Exec("ALTER TABLE power_state_events ADD COLUMN suspect INTEGER NOT NULL DEFAULT 0")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add suspect column: %w", err)
+	}
+	// Add battery_samples.status_code column if it doesn't exist (added in
+	// v10), and intern the statuses stored as text before it.
+	if err := addBatteryStatusCode(db); err != nil {
+		return err
+	}
+	// Add battery_samples.power_smoothed_uw column if it doesn't exist (added in v11).
+	_, err = db.Exec("ALTER TABLE battery_samples ADD COLUMN power_smoothed_uw INTEGER NOT NULL DEFAULT 0")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add power_smoothed_uw column: %w", err)
+	}
+	// Add annotations.source column if it doesn't exist (added in v12);
+	// annotations before it were all user-entered.
+	_, err = db.Exec("ALTER TABLE annotations ADD COLUMN source TEXT NOT NULL DEFAULT 'user'")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add annotations source column: %w", err)
+	}
+	// Add battery_samples.battery_count column if it doesn't exist (added
+	// in v13); samples before it were read from a single battery.
+	_, err = db.Exec("ALTER TABLE battery_samples ADD COLUMN battery_count INTEGER NOT NULL DEFAULT 1")
+	if err != nil && !isDuplicateColumnError(err) {
+		return fmt.Errorf("add battery_count column: %w", err)
+	}
 	return nil
 }
 
@@ -114,196 +266,792 @@ func isDuplicateColumnError(err error) bool {
 	return err != nil && strings.Contains(fmt.Sprintf("%v", err), "duplicate column name")
 }
 
-// InsertBatterySample inserts a battery sample.
+// batterySamples stores battery readings. A known status is stored as its
+// status_code with empty status text.
+var batterySamples = timeSeries[collector.BatterySample]{
+	timeTable: timeTable{"battery_samples", "timestamp"},
+	columns:   []string{"timestamp", "voltage_uv", "current_ua", "power_uw", "power_smoothed_uw", "sysfs_power_uw", "charge_now_uah", "capacity_pct", "status", "status_code", "ac_source", "charger_power_uw", "power_source", "capacity_level", "battery_count"},
+	args: func(s collector.BatterySample) []any {
+		code, text := encodeBatteryStatus(s.Status)
+		return []any{s.Timestamp, s.VoltageUV, s.CurrentUA, s.PowerUW, s.PowerSmoothedUW, s.SysfsPowerUW, s.ChargeNowUAH, s.CapacityPct, text, code, s.ACSource, s.ChargerPowerUW, s.PowerSource, s.CapacityLevel, s.BatteryCount}
+	},
+	scan: func(r scanner) (collector.BatterySample, error) {
+		var s collector.BatterySample
+		var code int
+		err := r.Scan(&s.Timestamp, &s.VoltageUV, &s.CurrentUA, &s.PowerUW, &s.PowerSmoothedUW, &s.SysfsPowerUW, &s.ChargeNowUAH, &s.CapacityPct, &s.Status, &code, &s.ACSource, &s.ChargerPowerUW, &s.PowerSource, &s.CapacityLevel, &s.BatteryCount)
+		s.Status = decodeBatteryStatus(code, s.Status)
+		return s, err
+	},
+}
+
+var backlightSamples = timeSeries[collector.BacklightSample]{
+	timeTable: timeTable{"backlight_samples", "timestamp"},
+	columns:   []string{"timestamp", "brightness", "max_brightness"},
+	args: func(s collector.BacklightSample) []any {
+		return []any{s.Timestamp, s.Brightness, s.MaxBrightness}
+	},
+	scan: func(r scanner) (collector.BacklightSample, error) {
+		var s collector.BacklightSample
+		err := r.Scan(&s.Timestamp, &s.Brightness, &s.MaxBrightness)
+		return s, err
+	},
+}
+
+// InsertBatterySample inserts a battery sample. A known status is stored as
+// its status_code.
 func (d *DB) InsertBatterySample(s collector.BatterySample) error {
-	_, err := d.db.Exec(
-		"INSERT INTO battery_samples (timestamp, voltage_uv, current_ua, power_uw, sysfs_power_uw, charge_now_uah, capacity_pct, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		s.Timestamp, s.VoltageUV, s.CurrentUA, s.PowerUW, s.SysfsPowerUW, s.ChargeNowUAH, s.CapacityPct, s.Status,
-	)
-	return err
+	if d.buf != nil {
+		return bufferRows(d, &d.buf.battery, s)
+	}
+	return batterySamples.insert(d.db, s)
 }
 
 // InsertBacklightSample inserts a backlight sample.
 func (d *DB) InsertBacklightSample(s collector.BacklightSample) error {
-	_, err := d.db.Exec(
-		"INSERT INTO backlight_samples (timestamp, brightness, max_brightness) VALUES (?, ?, ?)",
-		s.Timestamp, s.Brightness, s.MaxBrightness,
-	)
-	return err
+	if d.buf != nil {
+		return bufferRows(d, &d.buf.backlight, s)
+	}
+	return backlightSamples.insert(d.db, s)
 }
 
-// LatestBatterySample returns the most recent battery sample.
+// LatestBatterySample returns the most recently inserted battery sample. It
+// orders by insertion rather than timestamp so that a backward wall-clock step
+// doesn't leave an older, future-stamped sample reported as current.
 func (d *DB) LatestBatterySample() (*collector.BatterySample, error) {
-	row := d.db.QueryRow("SELECT timestamp, voltage_uv, current_ua, power_uw, sysfs_power_uw, charge_now_uah, capacity_pct, status FROM battery_samples ORDER BY timestamp DESC LIMIT 1")
-	var s collector.BatterySample
-	err := row.Scan(&s.Timestamp, &s.VoltageUV, &s.CurrentUA, &s.PowerUW, &s.SysfsPowerUW, &s.ChargeNowUAH, &s.CapacityPct, &s.Status)
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if d.buf != nil {
+		return latestWithPending(d, &d.buf.battery)
 	}
-	if err != nil {
-		return nil, err
-	}
-	return &s, nil
+	return batterySamples.latest(d.db)
 }
 
-// LatestBacklightSample returns the most recent backlight sample.
+// LatestBacklightSample returns the most recently inserted backlight sample.
 func (d *DB) LatestBacklightSample() (*collector.BacklightSample, error) {
-	row := d.db.QueryRow("SELECT timestamp, brightness, max_brightness FROM backlight_samples ORDER BY timestamp DESC LIMIT 1")
-	var s collector.BacklightSample
-	err := row.Scan(&s.Timestamp, &s.Brightness, &s.MaxBrightness)
-	if err == sql.ErrNoRows {
-		return nil, nil
+	if d.buf != nil {
+		return latestWithPending(d, &d.buf.backlight)
 	}
+	return backlightSamples.latest(d.db)
+}
+
+// BatterySamplesInRange returns battery samples within the given time range.
+func (d *DB) BatterySamplesInRange(from, to int64) ([]collector.BatterySample, error) {
+	if d.buf != nil {
+		return rangeWithPending(d, &d.buf.battery, from, to)
+	}
+	return batterySamples.inRange(d.db, from, to)
+}
+
+// BatteryBucketsInRange aggregates battery samples in [from, to] into
+// bucketSecs-wide buckets aligned to from. Empty buckets are omitted.
+func (d *DB) BatteryBucketsInRange(from, to, bucketSecs int64) ([]collector.BatteryBucket, error) {
+	if bucketSecs <= 0 {
+		return nil, fmt.Errorf("bucket size must be positive, got %d", bucketSecs)
+	}
+	if d.buf == nil {
+		return d.storedBatteryBuckets(from, to, bucketSecs)
+	}
+	// Hold the buffer lock so a concurrent flush can't move rows between
+	// the query and the merge.
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	buckets, err := d.storedBatteryBuckets(from, to, bucketSecs)
 	if err != nil {
 		return nil, err
 	}
-	return &s, nil
+	return mergeBatteryBuckets(buckets, d.buf.battery.rows, from, to, bucketSecs), nil
 }
 
-// BatterySamplesInRange returns battery samples within the given time range.
-func (d *DB) BatterySamplesInRange(from, to int64) ([]collector.BatterySample, error) {
+// storedBatteryBuckets aggregates the committed battery samples for
+// BatteryBucketsInRange.
+func (d *DB) storedBatteryBuckets(from, to, bucketSecs int64) ([]collector.BatteryBucket, error) {
 	rows, err := d.db.Query(
-		"SELECT timestamp, voltage_uv, current_ua, power_uw, sysfs_power_uw, charge_now_uah, capacity_pct, status FROM battery_samples WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp",
-		from, to,
+		`SELECT (timestamp - ?) / ? AS bucket, COUNT(*),
+			MIN(capacity_pct), MAX(capacity_pct), AVG(capacity_pct),
+			MIN(power_uw), MAX(power_uw), AVG(power_uw)
+		FROM battery_samples WHERE timestamp >= ? AND timestamp <= ?
+		GROUP BY bucket ORDER BY bucket`,
+		from, bucketSecs, from, to,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var samples []collector.BatterySample
+	var buckets []collector.BatteryBucket
 	for rows.Next() {
-		var s collector.BatterySample
-		if err := rows.Scan(&s.Timestamp, &s.VoltageUV, &s.CurrentUA, &s.PowerUW, &s.SysfsPowerUW, &s.ChargeNowUAH, &s.CapacityPct, &s.Status); err != nil {
+		var b collector.BatteryBucket
+		var idx int64
+		var avgPower float64
+		if err := rows.Scan(&idx, &b.Count, &b.MinCapacityPct, &b.MaxCapacityPct, &b.AvgCapacityPct, &b.MinPowerUW, &b.MaxPowerUW, &avgPower); err != nil {
 			return nil, err
 		}
-		samples = append(samples, s)
+		b.Timestamp = from + idx*bucketSecs
+		b.AvgPowerUW = int64(avgPower)
+		buckets = append(buckets, b)
 	}
-	return samples, rows.Err()
+	return buckets, rows.Err()
 }
 
-// BacklightSamplesInRange returns backlight samples within the given time range.
-func (d *DB) BacklightSamplesInRange(from, to int64) ([]collector.BacklightSample, error) {
+// mergeBatteryBuckets folds the pending samples within [from, to] into
+// buckets, which are in time order, and keeps them so.
+func mergeBatteryBuckets(buckets []collector.BatteryBucket, pending []collector.BatterySample, from, to, bucketSecs int64) []collector.BatteryBucket {
+	byStart := make(map[int64]int, len(buckets))
+	avgPower := make([]float64, len(buckets))
+	for i, b := range buckets {
+		byStart[b.Timestamp] = i
+		avgPower[i] = float64(b.AvgPowerUW)
+	}
+	added := false
+	for _, s := range pending {
+		if s.Timestamp < from || s.Timestamp > to {
+			continue
+		}
+		start := from + (s.Timestamp-from)/bucketSecs*bucketSecs
+		i, ok := byStart[start]
+		if !ok {
+			buckets = append(buckets, collector.BatteryBucket{
+				Timestamp:      start,
+				MinCapacityPct: s.CapacityPct, MaxCapacityPct: s.CapacityPct,
+				MinPowerUW: s.PowerUW, MaxPowerUW: s.PowerUW,
+			})
+			avgPower = append(avgPower, 0)
+			i = len(buckets) - 1
+			byStart[start] = i
+			added = true
+		}
+		b := &buckets[i]
+		n := float64(b.Count)
+		b.AvgCapacityPct = (b.AvgCapacityPct*n + float64(s.CapacityPct)) / (n + 1)
+		avgPower[i] = (avgPower[i]*n + float64(s.PowerUW)) / (n + 1)
+		b.AvgPowerUW = int64(avgPower[i])
+		b.MinCapacityPct = min(b.MinCapacityPct, s.CapacityPct)
+		b.MaxCapacityPct = max(b.MaxCapacityPct, s.CapacityPct)
+		b.MinPowerUW = min(b.MinPowerUW, s.PowerUW)
+		b.MaxPowerUW = max(b.MaxPowerUW, s.PowerUW)
+		b.Count++
+	}
+	if added {
+		slices.SortFunc(buckets, func(a, b collector.BatteryBucket) int { return cmp.Compare(a.Timestamp, b.Timestamp) })
+	}
+	return buckets
+}
+
+// SeriesBucketsInRange averages discharging battery power, backlight
+// brightness and per-cycle CPU ticks over bucketSecs-wide buckets of
+// [from, to] aligned to from. Battery power on AC does not measure
+// consumption, so only buckets with discharging samples are returned;
+// brightness and CPU ticks are marked missing where the bucket has none of
+// their samples.
+func (d *DB) SeriesBucketsInRange(from, to, bucketSecs int64) ([]collector.SeriesBucket, error) {
+	if bucketSecs <= 0 {
+		return nil, fmt.Errorf("bucket size must be positive, got %d", bucketSecs)
+	}
+	power, err := d.bucketAverages("power_uw", "battery_samples", fmt.Sprintf("status_code = %d", statusDischarging), from, to, bucketSecs)
+	if err != nil {
+		return nil, fmt.Errorf("average battery power: %w", err)
+	}
+	brightness, err := d.bucketAverages("brightness * 100.0 / max_brightness", "backlight_samples", "max_brightness > 0", from, to, bucketSecs)
+	if err != nil {
+		return nil, fmt.Errorf("average brightness: %w", err)
+	}
+	ticks, err := d.bucketAverages("total_ticks", "process_cycle_stats", "", from, to, bucketSecs)
+	if err != nil {
+		return nil, fmt.Errorf("average CPU ticks: %w", err)
+	}
+	buckets := make([]collector.SeriesBucket, 0, len(power))
+	for _, idx := range slices.Sorted(maps.Keys(power)) {
+		b := collector.SeriesBucket{Timestamp: from + idx*bucketSecs, PowerUW: power[idx]}
+		b.BrightnessPct, b.HasBrightness = brightness[idx]
+		b.CPUTicks, b.HasCPU = ticks[idx]
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// bucketAverages returns the average of expr over the rows of table in
+// [from, to] matching cond (none if ""), by bucket index.
+func (d *DB) bucketAverages(expr, table, cond string, from, to, bucketSecs int64) (map[int64]float64, error) {
+	if cond != "" {
+		cond = " AND " + cond
+	}
 	rows, err := d.db.Query(
-		"SELECT timestamp, brightness, max_brightness FROM backlight_samples WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp",
-		from, to,
+		`SELECT (timestamp - ?) / ? AS bucket, AVG(`+expr+`)
+		FROM `+table+` WHERE timestamp >= ? AND timestamp <= ?`+cond+`
+		GROUP BY bucket`,
+		from, bucketSecs, from, to,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var samples []collector.BacklightSample
+	avgs := make(map[int64]float64)
 	for rows.Next() {
-		var s collector.BacklightSample
-		if err := rows.Scan(&s.Timestamp, &s.Brightness, &s.MaxBrightness); err != nil {
+		var idx int64
+		var avg float64
+		if err := rows.Scan(&idx, &avg); err != nil {
 			return nil, err
 		}
-		samples = append(samples, s)
+		avgs[idx] = avg
 	}
-	return samples, rows.Err()
+	return avgs, rows.Err()
 }
 
-// InsertProcessSamples batch-inserts process samples in a single transaction.
-func (d *DB) InsertProcessSamples(samples []collector.ProcessSample) error {
-	if len(samples) == 0 {
-		return nil
+// PowerHistogram counts discharging battery samples in [from, to] into
+// numBuckets equal-width power buckets spanning their minimum to maximum
+// power. Every bucket is returned, including empty ones; no samples yields
+// nil.
+func (d *DB) PowerHistogram(from, to int64, numBuckets int) ([]collector.PowerHistogramBucket, error) {
+	if numBuckets <= 0 {
+		return nil, fmt.Errorf("bucket count must be positive, got %d", numBuckets)
 	}
-	tx, err := d.db.Begin()
+	var minUW, maxUW sql.NullInt64
+	err := d.db.QueryRow(
+		"SELECT MIN(power_uw), MAX(power_uw) FROM battery_samples WHERE timestamp >= ? AND timestamp <= ? AND status_code = ?",
+		from, to, statusDischarging,
+	).Scan(&minUW, &maxUW)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if !minUW.Valid {
+		return nil, nil
+	}
+
+	// Integer widths keep bucket bounds exact; +1 makes the maximum fall
+	// inside the last bucket.
+	width := (maxUW.Int64-minUW.Int64)/int64(numBuckets) + 1
+	buckets := make([]collector.PowerHistogramBucket, numBuckets)
+	for i := range buckets {
+		buckets[i].MinUW = minUW.Int64 + int64(i)*width
+		buckets[i].MaxUW = buckets[i].MinUW + width
 	}
-	stmt, err := tx.Prepare("INSERT INTO process_samples (timestamp, pid, comm, cmdline, cpu_ticks_delta, last_cpu) VALUES (?, ?, ?, ?, ?, ?)")
+
+	rows, err := d.db.Query(
+		`SELECT (power_uw - ?) / ? AS bucket, COUNT(*)
+		FROM battery_samples WHERE timestamp >= ? AND timestamp <= ? AND status_code = ?
+		GROUP BY bucket`,
+		minUW.Int64, width, from, to, statusDischarging,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx int64
+		var count int
+		if err := rows.Scan(&idx, &count); err != nil {
+			return nil, err
+		}
+		if idx >= 0 && idx < int64(numBuckets) {
+			buckets[idx].Count = count
+		}
+	}
+	return buckets, rows.Err()
+}
+
+// PowerPercentiles returns the 50th, 90th and 99th percentile of battery
+// power over discharging samples in [from, to], using the nearest-rank
+// method so each value is an observed reading. No samples yields a zero
+// Count and zero percentiles.
+func (d *DB) PowerPercentiles(from, to int64) (collector.PowerPercentiles, error) {
+	var pp collector.PowerPercentiles
+	err := d.db.QueryRow(
+		"SELECT COUNT(*) FROM battery_samples WHERE timestamp >= ? AND timestamp <= ? AND status_code = ?",
+		from, to, statusDischarging,
+	).Scan(&pp.Count)
+	if err != nil || pp.Count == 0 {
+		return pp, err
+	}
+	for _, p := range []struct {
+		pct int
+		dst *int64
+	}{{50, &pp.P50UW}, {90, &pp.P90UW}, {99, &pp.P99UW}} {
+		err := d.db.QueryRow(
+			`SELECT power_uw FROM battery_samples
+			WHERE timestamp >= ? AND timestamp <= ? AND status_code = ?
+			ORDER BY power_uw LIMIT 1 OFFSET ?`,
+			from, to, statusDischarging, percentileRank(pp.Count, p.pct),
+		).Scan(p.dst)
+		if err != nil {
+			return pp, fmt.Errorf("p%d: %w", p.pct, err)
+		}
+	}
+	return pp, nil
+}
+
+// DischargeInRange sums the battery drain over samples in [from, to]: each
+// decrease of charge_now and capacity_pct from one sample to the next where
+// the later sample is discharging. Rises while charging are skipped, as are
+// dips on AC such as a full battery settling before it is topped up again,
+// and steps where a pack was removed or inserted.
+func (d *DB) DischargeInRange(from, to int64) (collector.Discharge, error) {
+	var dis collector.Discharge
+	err := d.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(MAX(charge_now_uah), 0) > 0,
+			COALESCE(SUM(CASE WHEN status_code = ? AND battery_count = prev_count AND charge_now_uah > 0 AND prev_charge > charge_now_uah
+				THEN prev_charge - charge_now_uah END), 0),
+			COALESCE(SUM(CASE WHEN status_code = ? AND battery_count = prev_count AND prev_pct > capacity_pct
+				THEN prev_pct - capacity_pct END), 0)
+		FROM (SELECT status_code, charge_now_uah, capacity_pct, battery_count,
+				LAG(charge_now_uah) OVER w AS prev_charge, LAG(capacity_pct) OVER w AS prev_pct,
+				LAG(battery_count) OVER w AS prev_count
+			FROM battery_samples WHERE timestamp >= ? AND timestamp <= ?
+			WINDOW w AS (ORDER BY timestamp))`,
+		statusDischarging, statusDischarging, from, to,
+	).Scan(&dis.Samples, &dis.HasCharge, &dis.ChargeUAH, &dis.CapacityPct)
+	return dis, err
+}
+
+// percentileRank returns the zero-based index of the nearest-rank pct-th
+// percentile among n sorted values: ceil(pct/100 × n) - 1.
+func percentileRank(n, pct int) int {
+	return max((pct*n+99)/100-1, 0)
+}
+
+// BacklightSamplesInRange returns backlight samples within the given time range.
+func (d *DB) BacklightSamplesInRange(from, to int64) ([]collector.BacklightSample, error) {
+	if d.buf != nil {
+		return rangeWithPending(d, &d.buf.backlight, from, to)
+	}
+	return backlightSamples.inRange(d.db, from, to)
+}
+
+var processSamples = timeSeries[collector.ProcessSample]{
+	timeTable: timeTable{"process_samples", "timestamp"},
+	columns:   []string{"timestamp", "pid", "comm", "cmdline", "cpu_ticks_delta", "last_cpu"},
+	args: func(s collector.ProcessSample) []any {
+		return []any{s.Timestamp, s.PID, s.Comm, s.Cmdline, s.CPUTicksDelta, s.LastCPU}
+	},
+	scan: func(r scanner) (collector.ProcessSample, error) {
+		var s collector.ProcessSample
+		err := r.Scan(&s.Timestamp, &s.PID, &s.Comm, &s.Cmdline, &s.CPUTicksDelta, &s.LastCPU)
+		return s, err
+	},
+}
+
+var cpuFreqSamples = timeSeries[collector.CPUFreqSample]{
+	timeTable: timeTable{"cpu_freq_samples", "timestamp"},
+	columns:   []string{"timestamp", "cpu_id", "freq_khz", "is_p_core"},
+	args: func(s collector.CPUFreqSample) []any {
+		return []any{s.Timestamp, s.CPUID, s.FreqKHz, s.IsPCore}
+	},
+	scan: func(r scanner) (collector.CPUFreqSample, error) {
+		var s collector.CPUFreqSample
+		var isPCore int
+		err := r.Scan(&s.Timestamp, &s.CPUID, &s.FreqKHz, &isPCore)
+		s.IsPCore = isPCore != 0
+		return s, err
+	},
+}
+
+var cpuBusySamples = timeSeries[collector.CPUBusySample]{
+	timeTable: timeTable{"cpu_busy_samples", "timestamp"},
+	columns:   []string{"timestamp", "cpu_id", "is_p_core", "busy_fraction", "period_secs"},
+	args: func(s collector.CPUBusySample) []any {
+		return []any{s.Timestamp, s.CPUID, s.IsPCore, s.BusyFraction, s.PeriodSecs}
+	},
+	scan: func(r scanner) (collector.CPUBusySample, error) {
+		var s collector.CPUBusySample
+		var isPCore int
+		err := r.Scan(&s.Timestamp, &s.CPUID, &isPCore, &s.BusyFraction, &s.PeriodSecs)
+		s.IsPCore = isPCore != 0
+		return s, err
+	},
+}
+
+var processCycleStats = timeSeries[collector.ProcessCycleStats]{
+	timeTable: timeTable{"process_cycle_stats", "timestamp"},
+	columns:   []string{"timestamp", "total_ticks", "captured_ticks", "total_procs"},
+	args: func(s collector.ProcessCycleStats) []any {
+		return []any{s.Timestamp, s.TotalTicks, s.CapturedTicks, s.TotalProcs}
+	},
+	scan: func(r scanner) (collector.ProcessCycleStats, error) {
+		var s collector.ProcessCycleStats
+		err := r.Scan(&s.Timestamp, &s.TotalTicks, &s.CapturedTicks, &s.TotalProcs)
+		return s, err
+	},
+}
+
+// processLifetimes is pruned by last_seen, so a lifetime is kept while any
+// part of it is within retention.
+var processLifetimes = timeSeries[collector.ProcessLifetime]{
+	timeTable: timeTable{"process_lifetimes", "last_seen"},
+	columns:   []string{"pid", "start_time", "comm", "first_seen", "last_seen"},
+	args: func(l collector.ProcessLifetime) []any {
+		return []any{l.PID, l.StartTime, l.Comm, l.FirstSeen, l.LastSeen}
+	},
+	scan: func(r scanner) (collector.ProcessLifetime, error) {
+		var l collector.ProcessLifetime
+		err := r.Scan(&l.PID, &l.StartTime, &l.Comm, &l.FirstSeen, &l.LastSeen)
+		return l, err
+	},
+}
+
+// upsertProcessLifetimes stores lifetimes within tx, widening the stored
+// first and last seen times of a process already in the table.
+func upsertProcessLifetimes(tx *sql.Tx, lts []collector.ProcessLifetime) error {
+	if len(lts) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(processLifetimes.insertSQL() + ` ON CONFLICT (pid, start_time) DO UPDATE SET
+		comm = excluded.comm,
+		first_seen = MIN(first_seen, excluded.first_seen),
+		last_seen = MAX(last_seen, excluded.last_seen)`)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 	defer stmt.Close()
-	for _, s := range samples {
-		if _, err := stmt.Exec(s.Timestamp, s.PID, s.Comm, s.Cmdline, s.CPUTicksDelta, s.LastCPU); err != nil {
-			tx.Rollback()
+	for _, l := range lts {
+		if _, err := stmt.Exec(processLifetimes.args(l)...); err != nil {
 			return err
 		}
 	}
-	return tx.Commit()
+	return nil
+}
+
+// InsertProcessSamples batch-inserts process samples in a single transaction.
+func (d *DB) InsertProcessSamples(samples []collector.ProcessSample) error {
+	if d.buf != nil {
+		return bufferRows(d, &d.buf.procs, samples...)
+	}
+	return processSamples.insertBatch(d.db, samples)
 }
 
 // InsertCPUFreqSamples batch-inserts CPU frequency samples in a single transaction.
 func (d *DB) InsertCPUFreqSamples(samples []collector.CPUFreqSample) error {
-	if len(samples) == 0 {
+	if d.buf != nil {
+		return bufferRows(d, &d.buf.freqs, samples...)
+	}
+	return cpuFreqSamples.insertBatch(d.db, samples)
+}
+
+// InsertCPUBusySamples batch-inserts CPU busy samples in a single
+// transaction. They are written directly even with the write buffer on, as
+// they are already sampled at their own, coarser interval.
+func (d *DB) InsertCPUBusySamples(samples []collector.CPUBusySample) error {
+	return cpuBusySamples.insertBatch(d.db, samples)
+}
+
+// CPUBusySamplesInRange returns CPU busy samples whose period ends within the
+// given time range.
+func (d *DB) CPUBusySamplesInRange(from, to int64) ([]collector.CPUBusySample, error) {
+	return cpuBusySamples.inRange(d.db, from, to)
+}
+
+// ProcessSamplesInRange returns process samples within the given time range.
+func (d *DB) ProcessSamplesInRange(from, to int64) ([]collector.ProcessSample, error) {
+	if d.buf != nil {
+		return rangeWithPending(d, &d.buf.procs, from, to)
+	}
+	return processSamples.inRange(d.db, from, to)
+}
+
+// InsertProcessCycleStats stores the summary of one process collection cycle.
+func (d *DB) InsertProcessCycleStats(s collector.ProcessCycleStats) error {
+	if d.buf != nil {
+		return bufferRows(d, &d.buf.cycles, s)
+	}
+	return processCycleStats.insert(d.db, s)
+}
+
+// UpsertProcessLifetimes stores process lifetimes in a single transaction.
+// A process already stored, matched by pid and start time, has its last seen
+// time moved forward rather than getting a second row.
+func (d *DB) UpsertProcessLifetimes(lts []collector.ProcessLifetime) error {
+	if d.buf != nil {
+		d.buf.mu.Lock()
+		defer d.buf.mu.Unlock()
+		d.buf.n += d.buf.lifetimes.add(lts)
+		if d.buf.n >= d.buf.maxRows {
+			return d.buf.flushLocked(d.db)
+		}
+		return nil
+	}
+	if len(lts) == 0 {
 		return nil
 	}
 	tx, err := d.db.Begin()
 	if err != nil {
 		return err
 	}
-	stmt, err := tx.Prepare("INSERT INTO cpu_freq_samples (timestamp, cpu_id, freq_khz, is_p_core) VALUES (?, ?, ?, ?)")
-	if err != nil {
+	if err := upsertProcessLifetimes(tx, lts); err != nil {
 		tx.Rollback()
 		return err
 	}
-	defer stmt.Close()
-	for _, s := range samples {
-		isPCore := 0
-		if s.IsPCore {
-			isPCore = 1
-		}
-		if _, err := stmt.Exec(s.Timestamp, s.CPUID, s.FreqKHz, isPCore); err != nil {
-			tx.Rollback()
-			return err
+	return tx.Commit()
+}
+
+// ProcessLifetimesInRange returns the process lifetimes overlapping the given
+// time range, ordered by first seen time.
+func (d *DB) ProcessLifetimesInRange(from, to int64) ([]collector.ProcessLifetime, error) {
+	query := func() ([]collector.ProcessLifetime, error) {
+		rows, err := d.db.Query(processLifetimes.selectSQL("first_seen <= ? AND last_seen >= ?", "first_seen, pid"), to, from)
+		if err != nil {
+			return nil, err
 		}
+		return processLifetimes.collect(rows)
 	}
-	return tx.Commit()
+	if d.buf == nil {
+		return query()
+	}
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	stored, err := query()
+	if err != nil {
+		return nil, err
+	}
+	return d.buf.lifetimes.merge(stored, from, to), nil
 }
 
-// ProcessSamplesInRange returns process samples within the given time range.
-func (d *DB) ProcessSamplesInRange(from, to int64) ([]collector.ProcessSample, error) {
+// ProcessCycleStatsInRange returns process cycle summaries within the given time range.
+func (d *DB) ProcessCycleStatsInRange(from, to int64) ([]collector.ProcessCycleStats, error) {
+	if d.buf != nil {
+		return rangeWithPending(d, &d.buf.cycles, from, to)
+	}
+	return processCycleStats.inRange(d.db, from, to)
+}
+
+// CPUFreqSamplesInRange returns CPU frequency samples within the given time
+// range. With a positive lookback it also returns, for each core, the latest
+// sample in the lookback seconds before from: when samples are stored only on
+// change, that is the frequency still in effect at the start of the range.
+// Buffered samples are merged in for the range itself but not the lookback.
+func (d *DB) CPUFreqSamplesInRange(from, to, lookback int64) ([]collector.CPUFreqSample, error) {
+	if d.buf == nil {
+		return d.storedCPUFreqSamples(from, to, lookback)
+	}
+	d.buf.mu.Lock()
+	defer d.buf.mu.Unlock()
+	samples, err := d.storedCPUFreqSamples(from, to, lookback)
+	if err != nil {
+		return nil, err
+	}
+	return d.buf.freqs.merge(samples, from, to), nil
+}
+
+func (d *DB) storedCPUFreqSamples(from, to, lookback int64) ([]collector.CPUFreqSample, error) {
+	// SQLite takes the bare columns of a MAX() aggregate from the row holding
+	// the maximum, so the first query yields each core's latest sample.
 	rows, err := d.db.Query(
-		"SELECT timestamp, pid, comm, cmdline, cpu_ticks_delta, last_cpu FROM process_samples WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp",
-		from, to,
+		`SELECT * FROM (
+			SELECT MAX(timestamp), cpu_id, freq_khz, is_p_core FROM cpu_freq_samples
+			WHERE timestamp >= ? AND timestamp < ? GROUP BY cpu_id
+		)
+		UNION ALL
+		SELECT timestamp, cpu_id, freq_khz, is_p_core FROM cpu_freq_samples WHERE timestamp >= ? AND timestamp <= ?
+		ORDER BY 1, 2`,
+		from-max(lookback, 0), from, from, to,
 	)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var samples []collector.ProcessSample
-	for rows.Next() {
-		var s collector.ProcessSample
-		if err := rows.Scan(&s.Timestamp, &s.PID, &s.Comm, &s.Cmdline, &s.CPUTicksDelta, &s.LastCPU); err != nil {
-			return nil, err
+	return cpuFreqSamples.collect(rows)
+}
+
+var powerStateEvents = timeSeries[collector.PowerStateEvent]{
+	timeTable: timeTable{"power_state_events", "start_time"},
+	columns:   []string{"start_time", "end_time", "type", "subtype", "suspend_secs", "hibernate_secs", "suspect"},
+	args: func(e collector.PowerStateEvent) []any {
+		return []any{e.StartTime, e.EndTime, e.Type, e.Subtype, e.SuspendSecs, e.HibernateSecs, e.Suspect}
+	},
+	scan: func(r scanner) (collector.PowerStateEvent, error) {
+		var e collector.PowerStateEvent
+		err := r.Scan(&e.StartTime, &e.EndTime, &e.Type, &e.Subtype, &e.SuspendSecs, &e.HibernateSecs, &e.Suspect)
+		return e, err
+	},
+}
+
+// InsertPowerStateEvent stores a power state event unless an existing event
+// already covers it. State-log re-reads can report the same sleep with a
+// shifted start or a truncated end, so any stored event sharing the start time
+// or overlapping the new one's span is treated as the same sleep, and the
+// longer event wins: a longer new event replaces every event it overlaps.
+// It returns whether the new event was stored.
+func (d *DB) InsertPowerStateEvent(e collector.PowerStateEvent) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var longest sql.NullInt64
+	err = tx.QueryRow(
+		"SELECT MAX(end_time - start_time) FROM power_state_events WHERE start_time = ? OR (start_time < ? AND end_time > ?)",
+		e.StartTime, e.EndTime, e.StartTime,
+	).Scan(&longest)
+	if err != nil {
+		return false, err
+	}
+	if longest.Valid {
+		if longest.Int64 >= e.EndTime-e.StartTime {
+			return false, nil
+		}
+		if _, err := tx.Exec(
+			"DELETE FROM power_state_events WHERE start_time = ? OR (start_time < ? AND end_time > ?)",
+			e.StartTime, e.EndTime, e.StartTime,
+		); err != nil {
+			return false, err
 		}
-		samples = append(samples, s)
 	}
-	return samples, rows.Err()
+
+	if err := powerStateEvents.insert(tx, e); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
-// CPUFreqSamplesInRange returns CPU frequency samples within the given time range.
-func (d *DB) CPUFreqSamplesInRange(from, to int64) ([]collector.CPUFreqSample, error) {
-	rows, err := d.db.Query(
-		"SELECT timestamp, cpu_id, freq_khz, is_p_core FROM cpu_freq_samples WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp",
-		from, to,
+// PowerStateEventsInRange returns power state events overlapping the given
+// time range, including a sleep that began before from and ended inside it.
+func (d *DB) PowerStateEventsInRange(from, to int64) ([]collector.PowerStateEvent, error) {
+	// The battery samples bracketing each sleep are looked up in the same
+	// statement, as correlated index seeks on idx_battery_ts, rather than
+	// with two queries per event.
+	rows, err := d.db.Query(fmt.Sprintf(`SELECT %s,
+			(SELECT capacity_pct FROM battery_samples WHERE timestamp <= e.start_time AND timestamp >= e.start_time - ?1 ORDER BY timestamp DESC LIMIT 1),
+			(SELECT charge_now_uah FROM battery_samples WHERE timestamp <= e.start_time AND timestamp >= e.start_time - ?1 ORDER BY timestamp DESC LIMIT 1),
+			(SELECT capacity_pct FROM battery_samples WHERE timestamp >= e.end_time AND timestamp <= e.end_time + ?1 ORDER BY timestamp LIMIT 1),
+			(SELECT charge_now_uah FROM battery_samples WHERE timestamp >= e.end_time AND timestamp <= e.end_time + ?1 ORDER BY timestamp LIMIT 1)
+		FROM power_state_events e WHERE start_time <= ?3 AND end_time >= ?2 ORDER BY start_time`,
+		strings.Join(powerStateEvents.columns, ", ")),
+		sleepBracketSecs, from, to,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var samples []collector.CPUFreqSample
+	var events []collector.PowerStateEvent
 	for rows.Next() {
-		var s collector.CPUFreqSample
-		var isPCore int
-		if err := rows.Scan(&s.Timestamp, &s.CPUID, &s.FreqKHz, &isPCore); err != nil {
+		var e collector.PowerStateEvent
+		var beforePct, afterPct, beforeUAH, afterUAH sql.NullInt64
+		if err := rows.Scan(&e.StartTime, &e.EndTime, &e.Type, &e.Subtype, &e.SuspendSecs, &e.HibernateSecs, &e.Suspect,
+			&beforePct, &beforeUAH, &afterPct, &afterUAH); err != nil {
 			return nil, err
 		}
-		s.IsPCore = isPCore != 0
-		samples = append(samples, s)
+		// A suspect event's end was clamped, so the samples around it do
+		// not bracket the sleep.
+		if e.Type != "shutdown" && !e.Suspect && beforePct.Valid && afterPct.Valid {
+			e.DrainKnown = true
+			e.DrainPct = int(beforePct.Int64 - afterPct.Int64)
+			if beforeUAH.Int64 > 0 && afterUAH.Int64 > 0 {
+				e.DrainUAH = beforeUAH.Int64 - afterUAH.Int64
+			}
+		}
+		events = append(events, e)
 	}
-	return samples, rows.Err()
+	return events, rows.Err()
+}
+
+// sleepBracketSecs bounds how far the battery samples bracketing a sleep may
+// lie from it. A wider gap means the daemon was not collecting, and the
+// difference would include time spent awake.
+const sleepBracketSecs = 600
+
+var throttleEvents = timeSeries[collector.ThrottleEvent]{
+	timeTable: timeTable{"throttle_events", "start_time"},
+	columns:   []string{"start_time", "end_time", "reason"},
+	args: func(e collector.ThrottleEvent) []any {
+		return []any{e.StartTime, e.EndTime, e.Reason}
+	},
+	scan: func(r scanner) (collector.ThrottleEvent, error) {
+		var e collector.ThrottleEvent
+		err := r.Scan(&e.StartTime, &e.EndTime, &e.Reason)
+		return e, err
+	},
+}
+
+var batteryPresenceEvents = timeSeries[collector.BatteryPresenceEvent]{
+	timeTable: timeTable{"battery_presence_events", "timestamp"},
+	columns:   []string{"timestamp", "present", "battery"},
+	args: func(e collector.BatteryPresenceEvent) []any {
+		return []any{e.Timestamp, e.Present, e.Battery}
+	},
+	scan: func(r scanner) (collector.BatteryPresenceEvent, error) {
+		var e collector.BatteryPresenceEvent
+		err := r.Scan(&e.Timestamp, &e.Present, &e.Battery)
+		return e, err
+	},
+}
+
+var idleIntervals = timeSeries[collector.IdleInterval]{
+	timeTable: timeTable{"idle_intervals", "start_time"},
+	columns:   []string{"start_time", "end_time"},
+	args: func(iv collector.IdleInterval) []any {
+		return []any{iv.StartTime, iv.EndTime}
+	},
+	scan: func(r scanner) (collector.IdleInterval, error) {
+		var iv collector.IdleInterval
+		err := r.Scan(&iv.StartTime, &iv.EndTime)
+		return iv, err
+	},
+}
+
+var displayModelPoints = timeSeries[calibration.ModelPoint]{
+	timeTable: timeTable{"display_model_points", "timestamp"},
+	columns:   []string{"timestamp", "brightness_pct", "power_uw", "cpu_ticks", "samples"},
+	args: func(p calibration.ModelPoint) []any {
+		return []any{p.Timestamp, p.BrightnessPct, p.PowerUW, p.CPUTicks, p.Samples}
+	},
+	scan: func(r scanner) (calibration.ModelPoint, error) {
+		var p calibration.ModelPoint
+		err := r.Scan(&p.Timestamp, &p.BrightnessPct, &p.PowerUW, &p.CPUTicks, &p.Samples)
+		return p, err
+	},
+}
+
+// InsertThrottleEvent stores a CPU throttling interval.
+func (d *DB) InsertThrottleEvent(e collector.ThrottleEvent) error {
+	return throttleEvents.insert(d.db, e)
+}
+
+// ThrottleEventsInRange returns CPU throttling intervals overlapping the
+// given time range.
+func (d *DB) ThrottleEventsInRange(from, to int64) ([]collector.ThrottleEvent, error) {
+	return throttleEvents.query(d.db, "end_time >= ? AND start_time <= ?", from, to)
+}
+
+// InsertBatteryPresenceEvent stores a battery removal or reinsertion.
+func (d *DB) InsertBatteryPresenceEvent(e collector.BatteryPresenceEvent) error {
+	return batteryPresenceEvents.insert(d.db, e)
+}
+
+// BatteryPresenceEventsInRange returns battery removals and reinsertions
+// within the given time range.
+func (d *DB) BatteryPresenceEventsInRange(from, to int64) ([]collector.BatteryPresenceEvent, error) {
+	return batteryPresenceEvents.inRange(d.db, from, to)
+}
+
+// InsertIdleInterval stores a user-idle interval.
+func (d *DB) InsertIdleInterval(iv collector.IdleInterval) error {
+	return idleIntervals.insert(d.db, iv)
+}
+
+// IdleIntervalsInRange returns user-idle intervals overlapping the given time
+// range.
+func (d *DB) IdleIntervalsInRange(from, to int64) ([]collector.IdleInterval, error) {
+	return idleIntervals.query(d.db, "end_time >= ? AND start_time <= ?", from, to)
+}
+
+// InsertDisplayModelPoint stores one stable period for the background
+// display power model.
+func (d *DB) InsertDisplayModelPoint(p calibration.ModelPoint) error {
+	return displayModelPoints.insert(d.db, p)
+}
+
+// DisplayModelPointsInRange returns display model points within the given time range.
+func (d *DB) DisplayModelPointsInRange(from, to int64) ([]calibration.ModelPoint, error) {
+	return displayModelPoints.inRange(d.db, from, to)
 }
 
-// InsertPowerStateEvent inserts a power state event, deduplicating by start_time.
+// InsertBatteryHealthSnapshot stores a health snapshot if its capacity or cycle
+// count differs from the most recent stored snapshot, so the table only grows
+// when the battery's reported health actually changes.
 // It returns whether a new row was inserted.
-func (d *DB) InsertPowerStateEvent(e collector.PowerStateEvent) (bool, error) {
+func (d *DB) InsertBatteryHealthSnapshot(s collector.BatteryHealthSnapshot) (bool, error) {
 	res, err := d.db.Exec(
-		"INSERT INTO power_state_events (start_time, end_time, type, suspend_secs, hibernate_secs) SELECT ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM power_state_events WHERE start_time = ?)",
-		e.StartTime, e.EndTime, e.Type, e.SuspendSecs, e.HibernateSecs, e.StartTime,
+		`INSERT INTO battery_health_snapshots (timestamp, charge_full_uah, charge_full_design_uah, cycle_count)
+		SELECT ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM (SELECT charge_full_uah, cycle_count FROM battery_health_snapshots ORDER BY timestamp DESC, id DESC LIMIT 1)
+			WHERE charge_full_uah = ? AND cycle_count = ?
+		)`,
+		s.Timestamp, s.ChargeFullUAH, s.ChargeFullDesignUAH, s.CycleCount, s.ChargeFullUAH, s.CycleCount,
 	)
 	if err != nil {
 		return false, err
@@ -315,24 +1063,76 @@ func (d *DB) InsertPowerStateEvent(e collector.PowerStateEvent) (bool, error) {
 	return n > 0, nil
 }
 
-// PowerStateEventsInRange returns power state events within the given time range.
-func (d *DB) PowerStateEventsInRange(from, to int64) ([]collector.PowerStateEvent, error) {
+// BatteryHealthSnapshots returns all stored health snapshots in time order.
+// Snapshots are not subject to retention cleanup since they track long-term wear.
+func (d *DB) BatteryHealthSnapshots() ([]collector.BatteryHealthSnapshot, error) {
 	rows, err := d.db.Query(
-		"SELECT start_time, end_time, type, suspend_secs, hibernate_secs FROM power_state_events WHERE start_time >= ? AND start_time <= ? ORDER BY start_time",
+		"SELECT timestamp, charge_full_uah, charge_full_design_uah, cycle_count FROM battery_health_snapshots ORDER BY timestamp, id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var snapshots []collector.BatteryHealthSnapshot
+	for rows.Next() {
+		var s collector.BatteryHealthSnapshot
+		if err := rows.Scan(&s.Timestamp, &s.ChargeFullUAH, &s.ChargeFullDesignUAH, &s.CycleCount); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// InsertAnnotation stores a timeline annotation and returns its ID. An empty
+// source is stored as collector.AnnotationSourceUser. User annotations are
+// not subject to retention cleanup; automatic ones are pruned with the time
+// series by DeleteOlderThan.
+func (d *DB) InsertAnnotation(a collector.Annotation) (int64, error) {
+	if a.Source == "" {
+		a.Source = collector.AnnotationSourceUser
+	}
+	res, err := d.db.Exec(
+		"INSERT INTO annotations (timestamp, text, source) VALUES (?, ?, ?)",
+		a.Timestamp, a.Text, a.Source,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// AnnotationsInRange returns annotations within the given time range.
+func (d *DB) AnnotationsInRange(from, to int64) ([]collector.Annotation, error) {
+	rows, err := d.db.Query(
+		"SELECT id, timestamp, text, source FROM annotations WHERE timestamp >= ? AND timestamp <= ? ORDER BY timestamp, id",
 		from, to,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var events []collector.PowerStateEvent
+	var annotations []collector.Annotation
 	for rows.Next() {
-		var e collector.PowerStateEvent
-		if err := rows.Scan(&e.StartTime, &e.EndTime, &e.Type, &e.SuspendSecs, &e.HibernateSecs); err != nil {
+		var a collector.Annotation
+		if err := rows.Scan(&a.ID, &a.Timestamp, &a.Text, &a.Source); err != nil {
 			return nil, err
 		}
-		events = append(events, e)
+		annotations = append(annotations, a)
 	}
-	return events, rows.Err()
+	return annotations, rows.Err()
 }
 
+// DeleteAnnotation removes the annotation with the given ID.
+// It returns whether an annotation was deleted.
+func (d *DB) DeleteAnnotation(id int64) (bool, error) {
+	res, err := d.db.Exec("DELETE FROM annotations WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -1,9 +1,12 @@
 package storage
 
 import (
+	"database/sql"
 	"path/filepath"
+	"reflect"
 	"testing"
 
+	"github.com/cptspacemanspiff/gnome-power-display/internal/calibration"
 	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
 )
 
@@ -28,7 +31,7 @@ func TestBatteryRoundTrip(t *testing.T) {
 	db := openTestDB(t)
 
 	s1 := collector.BatterySample{Timestamp: 10, VoltageUV: 11000000, CurrentUA: 1000000, PowerUW: 1100000, SysfsPowerUW: 1100000, ChargeNowUAH: 5000000, CapacityPct: 80, Status: "Discharging"}
-	s2 := collector.BatterySample{Timestamp: 20, VoltageUV: 12000000, CurrentUA: 1000000, PowerUW: 1200000, SysfsPowerUW: 1150000, ChargeNowUAH: 4990000, CapacityPct: 79, Status: "Discharging"}
+	s2 := collector.BatterySample{Timestamp: 20, VoltageUV: 12000000, CurrentUA: 1000000, PowerUW: 1200000, PowerSmoothedUW: 1150000, SysfsPowerUW: 1150000, ChargeNowUAH: 4990000, CapacityPct: 79, Status: "Charging", ACSource: "AC", ChargerPowerUW: 65000000, PowerSource: collector.PowerSourceChargeDelta, CapacityLevel: "Normal", BatteryCount: 2}
 	if err := db.InsertBatterySample(s1); err != nil {
 		t.Fatalf("InsertBatterySample(s1) error = %v", err)
 	}
@@ -40,8 +43,8 @@ func TestBatteryRoundTrip(t *testing.T) {
 	if err != nil {
 		t.Fatalf("LatestBatterySample() error = %v", err)
 	}
-	if latest == nil || latest.Timestamp != 20 || latest.PowerUW != 1200000 {
-		t.Fatalf("LatestBatterySample() = %#v, want timestamp=20 power_uw=1200000", latest)
+	if latest == nil || latest.Timestamp != 20 || latest.PowerUW != 1200000 || latest.ACSource != "AC" || latest.ChargerPowerUW != 65000000 || latest.PowerSource != collector.PowerSourceChargeDelta || latest.CapacityLevel != "Normal" || latest.BatteryCount != 2 {
+		t.Fatalf("LatestBatterySample() = %#v, want timestamp=20 power_uw=1200000 ac_source=AC charger_power_uw=65000000 power_source=charge_delta capacity_level=Normal battery_count=2", latest)
 	}
 
 	ranged, err := db.BatterySamplesInRange(10, 15)
@@ -53,6 +56,297 @@ func TestBatteryRoundTrip(t *testing.T) {
 	}
 }
 
+func TestBatterySamples_OutOfOrderInsert(t *testing.T) {
+	db := openTestDB(t)
+
+	// The clock stepped back between the second and third sample.
+	for _, ts := range []int64{100, 110, 50} {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, CapacityPct: 80, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample(%d) error = %v", ts, err)
+		}
+	}
+
+	latest, err := db.LatestBatterySample()
+	if err != nil {
+		t.Fatalf("LatestBatterySample() error = %v", err)
+	}
+	if latest == nil || latest.Timestamp != 50 {
+		t.Fatalf("LatestBatterySample() = %#v, want the last inserted sample (ts=50)", latest)
+	}
+
+	ranged, err := db.BatterySamplesInRange(0, 200)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	if len(ranged) != 3 || ranged[0].Timestamp != 50 || ranged[1].Timestamp != 100 || ranged[2].Timestamp != 110 {
+		t.Fatalf("BatterySamplesInRange() = %#v, want ascending 50, 100, 110", ranged)
+	}
+}
+
+func TestBatteryBucketsInRange(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 95, CapacityPct: 99, PowerUW: 9000000, Status: "Discharging"}, // before range
+		{Timestamp: 100, CapacityPct: 80, PowerUW: 4000000, Status: "Discharging"},
+		{Timestamp: 130, CapacityPct: 70, PowerUW: 8000000, Status: "Discharging"},
+		{Timestamp: 159, CapacityPct: 75, PowerUW: 6000000, Status: "Charging"},
+		// 160-219 empty
+		{Timestamp: 225, CapacityPct: 90, PowerUW: 2000000, Status: "Charging"},
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+
+	buckets, err := db.BatteryBucketsInRange(100, 239, 60)
+	if err != nil {
+		t.Fatalf("BatteryBucketsInRange() error = %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("BatteryBucketsInRange() len = %d, want 2: %#v", len(buckets), buckets)
+	}
+	b := buckets[0]
+	if b.Timestamp != 100 || b.Count != 3 || b.MinCapacityPct != 70 || b.MaxCapacityPct != 80 ||
+		b.MinPowerUW != 4000000 || b.MaxPowerUW != 8000000 || b.AvgPowerUW != 6000000 || b.AvgCapacityPct != 75 {
+		t.Fatalf("first bucket = %#v, want ts=100 count=3 cap 70-80 avg 75 power 4-8 W avg 6 W", b)
+	}
+	if buckets[1].Timestamp != 220 || buckets[1].Count != 1 || buckets[1].MinCapacityPct != 90 {
+		t.Fatalf("second bucket = %#v, want single sample bucket at ts=220", buckets[1])
+	}
+
+	if _, err := db.BatteryBucketsInRange(0, 10, 0); err == nil {
+		t.Fatal("BatteryBucketsInRange(bucket=0) error = nil, want error")
+	}
+}
+
+func TestProcessCycleStatsRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+
+	in := []collector.ProcessCycleStats{
+		{Timestamp: 100, TotalTicks: 500, CapturedTicks: 450, TotalProcs: 12},
+		{Timestamp: 105, TotalTicks: 300, CapturedTicks: 120, TotalProcs: 80},
+		{Timestamp: 500, TotalTicks: 1, CapturedTicks: 1, TotalProcs: 1},
+	}
+	for _, s := range in {
+		if err := db.InsertProcessCycleStats(s); err != nil {
+			t.Fatalf("InsertProcessCycleStats() error = %v", err)
+		}
+	}
+
+	got, err := db.ProcessCycleStatsInRange(0, 200)
+	if err != nil {
+		t.Fatalf("ProcessCycleStatsInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, in[:2]) {
+		t.Fatalf("ProcessCycleStatsInRange() = %#v, want %#v", got, in[:2])
+	}
+}
+
+func TestPowerHistogram(t *testing.T) {
+	db := openTestDB(t)
+
+	if got, err := db.PowerHistogram(0, 100, 4); err != nil || got != nil {
+		t.Fatalf("PowerHistogram(empty) = %#v, %v; want nil, nil", got, err)
+	}
+
+	for i, p := range []int64{2000000, 2500000, 3000000, 5000000, 9999999, 10000000, 1000} {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: int64(10 + i), PowerUW: p, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	// Outside the range, or on AC: neither counts nor widens the bounds.
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 500, PowerUW: 50000000, Status: "Discharging"},
+		{Timestamp: 20, PowerUW: 40000000, Status: "Charging"},
+		{Timestamp: 21, PowerUW: 0, Status: "Full"},
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+
+	buckets, err := db.PowerHistogram(0, 100, 4)
+	if err != nil {
+		t.Fatalf("PowerHistogram() error = %v", err)
+	}
+	if len(buckets) != 4 {
+		t.Fatalf("PowerHistogram() len = %d, want 4", len(buckets))
+	}
+	// min=1000 max=10000000 -> width=2499751
+	if buckets[0].MinUW != 1000 || buckets[3].MaxUW <= 10000000 {
+		t.Fatalf("bounds = [%d, %d), want to span 1000..10000000", buckets[0].MinUW, buckets[3].MaxUW)
+	}
+	wantCounts := []int{3, 2, 0, 2}
+	total := 0
+	for i, b := range buckets {
+		total += b.Count
+		if b.Count != wantCounts[i] {
+			t.Fatalf("bucket %d = %#v, want count %d (all: %#v)", i, b, wantCounts[i], buckets)
+		}
+	}
+	if total != 7 {
+		t.Fatalf("total = %d, want 7", total)
+	}
+
+	if _, err := db.PowerHistogram(0, 100, 0); err == nil {
+		t.Fatal("PowerHistogram(buckets=0) error = nil, want error")
+	}
+}
+
+func TestDischargeInRange(t *testing.T) {
+	db := openTestDB(t)
+
+	if got, err := db.DischargeInRange(0, 1000); err != nil || got != (collector.Discharge{}) {
+		t.Fatalf("DischargeInRange(empty) = %#v, %v; want zero, nil", got, err)
+	}
+
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 90, ChargeNowUAH: 5000000, CapacityPct: 100, Status: "Discharging"}, // before range
+		{Timestamp: 100, ChargeNowUAH: 4000000, CapacityPct: 80, Status: "Discharging"},
+		{Timestamp: 110, ChargeNowUAH: 3000000, CapacityPct: 60, Status: "Discharging"},
+		{Timestamp: 120, ChargeNowUAH: 3500000, CapacityPct: 70, Status: "Charging"},
+		{Timestamp: 130, ChargeNowUAH: 4900000, CapacityPct: 98, Status: "Charging"},
+		{Timestamp: 140, ChargeNowUAH: 4800000, CapacityPct: 96, Status: "Full"}, // settling on AC
+		{Timestamp: 150, ChargeNowUAH: 5000000, CapacityPct: 100, Status: "Charging"},
+		{Timestamp: 160, ChargeNowUAH: 4500000, CapacityPct: 90, Status: "Discharging"},
+		{Timestamp: 300, ChargeNowUAH: 1000000, CapacityPct: 20, Status: "Discharging"}, // after range
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+
+	got, err := db.DischargeInRange(100, 200)
+	if err != nil {
+		t.Fatalf("DischargeInRange() error = %v", err)
+	}
+	want := collector.Discharge{ChargeUAH: 1500000, CapacityPct: 30, Samples: 7, HasCharge: true}
+	if got != want {
+		t.Fatalf("DischargeInRange() = %#v, want %#v", got, want)
+	}
+
+	// Removing one of two packs drops the summed charge without any drain.
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 400, ChargeNowUAH: 9000000, CapacityPct: 90, Status: "Discharging", BatteryCount: 2},
+		{Timestamp: 410, ChargeNowUAH: 8800000, CapacityPct: 88, Status: "Discharging", BatteryCount: 2},
+		{Timestamp: 420, ChargeNowUAH: 4400000, CapacityPct: 85, Status: "Discharging", BatteryCount: 1},
+		{Timestamp: 430, ChargeNowUAH: 4300000, CapacityPct: 84, Status: "Discharging", BatteryCount: 1},
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	got, err = db.DischargeInRange(400, 500)
+	if err != nil {
+		t.Fatalf("DischargeInRange() error = %v", err)
+	}
+	want = collector.Discharge{ChargeUAH: 300000, CapacityPct: 3, Samples: 4, HasCharge: true}
+	if got != want {
+		t.Fatalf("DischargeInRange(pack removed) = %#v, want %#v", got, want)
+	}
+}
+
+func TestSeriesBucketsInRange(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 100, PowerUW: 8000000, Status: "Discharging"},
+		{Timestamp: 120, PowerUW: 30000000, Status: "Charging"}, // on AC: skipped
+		{Timestamp: 150, PowerUW: 10000000, Status: "Discharging"},
+		{Timestamp: 200, PowerUW: 6000000, Status: "Discharging"},
+		{Timestamp: 300, PowerUW: 20000000, Status: "Full"},
+		{Timestamp: 400, PowerUW: 1000000, Status: "Discharging"}, // after range
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	for _, s := range []collector.BacklightSample{
+		{Timestamp: 100, Brightness: 400, MaxBrightness: 1000},
+		{Timestamp: 150, Brightness: 600, MaxBrightness: 1000},
+		{Timestamp: 160, Brightness: 0, MaxBrightness: 0}, // no maximum: skipped
+	} {
+		if err := db.InsertBacklightSample(s); err != nil {
+			t.Fatalf("InsertBacklightSample() error = %v", err)
+		}
+	}
+	for _, s := range []collector.ProcessCycleStats{
+		{Timestamp: 200, TotalTicks: 30},
+		{Timestamp: 250, TotalTicks: 50},
+		{Timestamp: 300, TotalTicks: 70}, // bucket without discharging samples
+	} {
+		if err := db.InsertProcessCycleStats(s); err != nil {
+			t.Fatalf("InsertProcessCycleStats() error = %v", err)
+		}
+	}
+
+	got, err := db.SeriesBucketsInRange(100, 399, 100)
+	if err != nil {
+		t.Fatalf("SeriesBucketsInRange() error = %v", err)
+	}
+	want := []collector.SeriesBucket{
+		{Timestamp: 100, PowerUW: 9000000, BrightnessPct: 50, HasBrightness: true},
+		{Timestamp: 200, PowerUW: 6000000, CPUTicks: 40, HasCPU: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("SeriesBucketsInRange() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPowerPercentiles(t *testing.T) {
+	db := openTestDB(t)
+
+	if got, err := db.PowerPercentiles(0, 1000); err != nil || got != (collector.PowerPercentiles{}) {
+		t.Fatalf("PowerPercentiles(empty) = %#v, %v; want zero, nil", got, err)
+	}
+
+	// Discharging readings of 1..100 W, inserted out of order.
+	for i := range 100 {
+		w := int64((i*37)%100 + 1)
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: int64(100 + i), PowerUW: w * 1000000, Status: "Discharging"}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	// Charging, and outside the range: both ignored.
+	for _, s := range []collector.BatterySample{
+		{Timestamp: 150, PowerUW: 500000000, Status: "Charging"},
+		{Timestamp: 5000, PowerUW: 500000000, Status: "Discharging"},
+	} {
+		if err := db.InsertBatterySample(s); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+
+	got, err := db.PowerPercentiles(0, 1000)
+	if err != nil {
+		t.Fatalf("PowerPercentiles() error = %v", err)
+	}
+	want := collector.PowerPercentiles{Count: 100, P50UW: 50000000, P90UW: 90000000, P99UW: 99000000}
+	if got != want {
+		t.Fatalf("PowerPercentiles() = %#v, want %#v", got, want)
+	}
+}
+
+func TestPercentileRank(t *testing.T) {
+	tests := []struct {
+		n, pct, want int
+	}{
+		{1, 50, 0},
+		{1, 99, 0},
+		{2, 50, 0},
+		{3, 50, 1},
+		{10, 90, 8},
+		{10, 99, 9},
+		{100, 99, 98},
+	}
+	for _, tt := range tests {
+		if got := percentileRank(tt.n, tt.pct); got != tt.want {
+			t.Fatalf("percentileRank(%d, %d) = %d, want %d", tt.n, tt.pct, got, tt.want)
+		}
+	}
+}
+
 func TestBacklightRoundTrip(t *testing.T) {
 	db := openTestDB(t)
 
@@ -109,7 +403,7 @@ func TestProcessAndCPUFreqRoundTrip(t *testing.T) {
 		t.Fatalf("ProcessSamplesInRange() = %#v, want two rows for pids 10,20", gotProcs)
 	}
 
-	gotFreqs, err := db.CPUFreqSamplesInRange(100, 100)
+	gotFreqs, err := db.CPUFreqSamplesInRange(100, 100, 0)
 	if err != nil {
 		t.Fatalf("CPUFreqSamplesInRange() error = %v", err)
 	}
@@ -124,7 +418,7 @@ func TestProcessAndCPUFreqRoundTrip(t *testing.T) {
 func TestInsertPowerStateEvent_DeduplicatesByStartTime(t *testing.T) {
 	db := openTestDB(t)
 
-	e1 := collector.PowerStateEvent{StartTime: 100, EndTime: 120, Type: "suspend", SuspendSecs: 20}
+	e1 := collector.PowerStateEvent{StartTime: 100, EndTime: 120, Type: "suspend", Subtype: "s2idle", SuspendSecs: 20}
 	inserted, err := db.InsertPowerStateEvent(e1)
 	if err != nil {
 		t.Fatalf("InsertPowerStateEvent(e1) error = %v", err)
@@ -133,13 +427,13 @@ func TestInsertPowerStateEvent_DeduplicatesByStartTime(t *testing.T) {
 		t.Fatal("InsertPowerStateEvent(e1) inserted = false, want true")
 	}
 
-	e2 := collector.PowerStateEvent{StartTime: 100, EndTime: 999, Type: "hibernate", HibernateSecs: 899}
+	e2 := collector.PowerStateEvent{StartTime: 100, EndTime: 110, Type: "suspend", SuspendSecs: 10}
 	inserted, err = db.InsertPowerStateEvent(e2)
 	if err != nil {
 		t.Fatalf("InsertPowerStateEvent(e2) error = %v", err)
 	}
 	if inserted {
-		t.Fatal("InsertPowerStateEvent(e2) inserted = true, want false for duplicate start_time")
+		t.Fatal("InsertPowerStateEvent(e2) inserted = true, want false for shorter event with duplicate start_time")
 	}
 
 	events, err := db.PowerStateEventsInRange(0, 1000)
@@ -149,8 +443,584 @@ func TestInsertPowerStateEvent_DeduplicatesByStartTime(t *testing.T) {
 	if len(events) != 1 {
 		t.Fatalf("PowerStateEventsInRange() len = %d, want 1", len(events))
 	}
-	if events[0].Type != "suspend" || events[0].EndTime != 120 {
+	if events[0].Type != "suspend" || events[0].Subtype != "s2idle" || events[0].EndTime != 120 {
 		t.Fatalf("stored event = %#v, want first event unchanged", events[0])
 	}
 }
 
+func TestPowerStateEventsInRange_SleepDrain(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, b := range []collector.BatterySample{
+		{Timestamp: 990, CapacityPct: 80, ChargeNowUAH: 4000000},
+		{Timestamp: 29010, CapacityPct: 76, ChargeNowUAH: 3800000},
+		{Timestamp: 50000, CapacityPct: 70},
+	} {
+		if err := db.InsertBatterySample(b); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	for _, e := range []collector.PowerStateEvent{
+		{StartTime: 1000, EndTime: 29000, Type: "suspend", SuspendSecs: 28000},
+		// No sample within reach after waking.
+		{StartTime: 40000, EndTime: 45000, Type: "suspend", SuspendSecs: 5000},
+		{StartTime: 60000, EndTime: 61000, Type: "shutdown"},
+	} {
+		if _, err := db.InsertPowerStateEvent(e); err != nil {
+			t.Fatalf("InsertPowerStateEvent() error = %v", err)
+		}
+	}
+
+	events, err := db.PowerStateEventsInRange(0, 100000)
+	if err != nil {
+		t.Fatalf("PowerStateEventsInRange() error = %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("PowerStateEventsInRange() len = %d, want 3", len(events))
+	}
+	if e := events[0]; !e.DrainKnown || e.DrainPct != 4 || e.DrainUAH != 200000 {
+		t.Fatalf("overnight suspend = %#v, want 4%% and 200000 uAh drained", e)
+	}
+	if events[1].DrainKnown {
+		t.Fatalf("suspend without a wake sample = %#v, want drain unknown", events[1])
+	}
+	if events[2].DrainKnown {
+		t.Fatalf("shutdown = %#v, want drain unknown", events[2])
+	}
+}
+
+func TestPowerStateEventsInRange_StraddlesRangeStart(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, b := range []collector.BatterySample{
+		{Timestamp: 990, CapacityPct: 80, ChargeNowUAH: 4000000},
+		{Timestamp: 29010, CapacityPct: 76, ChargeNowUAH: 3800000},
+	} {
+		if err := db.InsertBatterySample(b); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	for _, e := range []collector.PowerStateEvent{
+		{StartTime: 1000, EndTime: 29000, Type: "suspend", SuspendSecs: 28000},
+		// Ends before the range.
+		{StartTime: 100, EndTime: 500, Type: "suspend", SuspendSecs: 400},
+	} {
+		if _, err := db.InsertPowerStateEvent(e); err != nil {
+			t.Fatalf("InsertPowerStateEvent() error = %v", err)
+		}
+	}
+
+	// The range starts mid-sleep, as when the GUI shows the morning after.
+	events, err := db.PowerStateEventsInRange(20000, 40000)
+	if err != nil {
+		t.Fatalf("PowerStateEventsInRange() error = %v", err)
+	}
+	if len(events) != 1 || events[0].StartTime != 1000 {
+		t.Fatalf("PowerStateEventsInRange() = %#v, want the sleep straddling the range start", events)
+	}
+	if e := events[0]; !e.DrainKnown || e.DrainPct != 4 || e.DrainUAH != 200000 {
+		t.Fatalf("straddling suspend = %#v, want 4%% and 200000 uAh drained", e)
+	}
+}
+
+func TestPowerStateEventsInRange_SuspectSkipsDrain(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, b := range []collector.BatterySample{
+		{Timestamp: 990, CapacityPct: 80},
+		{Timestamp: 2010, CapacityPct: 60},
+	} {
+		if err := db.InsertBatterySample(b); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	want := collector.PowerStateEvent{StartTime: 1000, EndTime: 2000, Type: "suspend", SuspendSecs: 1000, Suspect: true}
+	if _, err := db.InsertPowerStateEvent(want); err != nil {
+		t.Fatalf("InsertPowerStateEvent() error = %v", err)
+	}
+
+	events, err := db.PowerStateEventsInRange(0, 10000)
+	if err != nil {
+		t.Fatalf("PowerStateEventsInRange() error = %v", err)
+	}
+	if len(events) != 1 || events[0] != want {
+		t.Fatalf("PowerStateEventsInRange() = %#v, want %#v with drain unknown", events, want)
+	}
+}
+
+func TestInsertPowerStateEvent_MergesOverlapping(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  []collector.PowerStateEvent
+		event     collector.PowerStateEvent
+		wantStore bool
+		want      []collector.PowerStateEvent
+	}{
+		{
+			name:      "contained in existing",
+			existing:  []collector.PowerStateEvent{{StartTime: 100, EndTime: 200, Type: "suspend", SuspendSecs: 100}},
+			event:     collector.PowerStateEvent{StartTime: 105, EndTime: 195, Type: "suspend", SuspendSecs: 90},
+			wantStore: false,
+			want:      []collector.PowerStateEvent{{StartTime: 100, EndTime: 200, Type: "suspend", SuspendSecs: 100}},
+		},
+		{
+			name:      "re-read with later resume replaces truncated event",
+			existing:  []collector.PowerStateEvent{{StartTime: 100, EndTime: 150, Type: "suspend", SuspendSecs: 50}},
+			event:     collector.PowerStateEvent{StartTime: 98, EndTime: 300, Type: "suspend-then-hibernate", SuspendSecs: 100, HibernateSecs: 102},
+			wantStore: true,
+			want:      []collector.PowerStateEvent{{StartTime: 98, EndTime: 300, Type: "suspend-then-hibernate", SuspendSecs: 100, HibernateSecs: 102}},
+		},
+		{
+			name: "longer event replaces every event it overlaps",
+			existing: []collector.PowerStateEvent{
+				{StartTime: 100, EndTime: 130, Type: "suspend", SuspendSecs: 30},
+				{StartTime: 140, EndTime: 170, Type: "suspend", SuspendSecs: 30},
+				{StartTime: 500, EndTime: 510, Type: "suspend", SuspendSecs: 10},
+			},
+			event:     collector.PowerStateEvent{StartTime: 100, EndTime: 180, Type: "suspend", SuspendSecs: 80},
+			wantStore: true,
+			want: []collector.PowerStateEvent{
+				{StartTime: 100, EndTime: 180, Type: "suspend", SuspendSecs: 80},
+				{StartTime: 500, EndTime: 510, Type: "suspend", SuspendSecs: 10},
+			},
+		},
+		{
+			name:      "adjacent events are kept apart",
+			existing:  []collector.PowerStateEvent{{StartTime: 100, EndTime: 200, Type: "suspend", SuspendSecs: 100}},
+			event:     collector.PowerStateEvent{StartTime: 200, EndTime: 260, Type: "suspend", SuspendSecs: 60},
+			wantStore: true,
+			want: []collector.PowerStateEvent{
+				{StartTime: 100, EndTime: 200, Type: "suspend", SuspendSecs: 100},
+				{StartTime: 200, EndTime: 260, Type: "suspend", SuspendSecs: 60},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			for _, e := range tt.existing {
+				if _, err := db.InsertPowerStateEvent(e); err != nil {
+					t.Fatalf("InsertPowerStateEvent(existing) error = %v", err)
+				}
+			}
+
+			stored, err := db.InsertPowerStateEvent(tt.event)
+			if err != nil {
+				t.Fatalf("InsertPowerStateEvent() error = %v", err)
+			}
+			if stored != tt.wantStore {
+				t.Fatalf("InsertPowerStateEvent() stored = %v, want %v", stored, tt.wantStore)
+			}
+
+			events, err := db.PowerStateEventsInRange(0, 1000)
+			if err != nil {
+				t.Fatalf("PowerStateEventsInRange() error = %v", err)
+			}
+			if !reflect.DeepEqual(events, tt.want) {
+				t.Fatalf("events = %#v, want %#v", events, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertBatteryHealthSnapshot_SkipsUnchanged(t *testing.T) {
+	db := openTestDB(t)
+
+	snapshots := []struct {
+		s    collector.BatteryHealthSnapshot
+		want bool
+	}{
+		{collector.BatteryHealthSnapshot{Timestamp: 100, ChargeFullUAH: 5000000, ChargeFullDesignUAH: 5200000, CycleCount: 10}, true},
+		{collector.BatteryHealthSnapshot{Timestamp: 200, ChargeFullUAH: 5000000, ChargeFullDesignUAH: 5200000, CycleCount: 10}, false},
+		{collector.BatteryHealthSnapshot{Timestamp: 300, ChargeFullUAH: 4800000, ChargeFullDesignUAH: 5200000, CycleCount: 10}, true},
+		{collector.BatteryHealthSnapshot{Timestamp: 400, ChargeFullUAH: 4800000, ChargeFullDesignUAH: 5200000, CycleCount: 11}, true},
+	}
+	for _, tt := range snapshots {
+		inserted, err := db.InsertBatteryHealthSnapshot(tt.s)
+		if err != nil {
+			t.Fatalf("InsertBatteryHealthSnapshot(ts=%d) error = %v", tt.s.Timestamp, err)
+		}
+		if inserted != tt.want {
+			t.Fatalf("InsertBatteryHealthSnapshot(ts=%d) inserted = %v, want %v", tt.s.Timestamp, inserted, tt.want)
+		}
+	}
+
+	got, err := db.BatteryHealthSnapshots()
+	if err != nil {
+		t.Fatalf("BatteryHealthSnapshots() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Timestamp != 100 || got[1].Timestamp != 300 || got[2].Timestamp != 400 {
+		t.Fatalf("BatteryHealthSnapshots() = %#v, want rows at ts=100,300,400", got)
+	}
+}
+
+func TestAnnotations_RoundTripAndDelete(t *testing.T) {
+	db := openTestDB(t)
+
+	var ids []int64
+	for _, a := range []collector.Annotation{
+		{Timestamp: 200, Text: "enabled TLP"},
+		{Timestamp: 100, Text: "started video call"},
+		{Timestamp: 900, Text: "out of range"},
+		{Timestamp: 300, Text: "AC unplugged", Source: collector.AnnotationSourceAuto},
+	} {
+		id, err := db.InsertAnnotation(a)
+		if err != nil {
+			t.Fatalf("InsertAnnotation(%q) error = %v", a.Text, err)
+		}
+		ids = append(ids, id)
+	}
+
+	got, err := db.AnnotationsInRange(0, 500)
+	if err != nil {
+		t.Fatalf("AnnotationsInRange() error = %v", err)
+	}
+	want := []collector.Annotation{
+		{ID: ids[1], Timestamp: 100, Text: "started video call", Source: collector.AnnotationSourceUser},
+		{ID: ids[0], Timestamp: 200, Text: "enabled TLP", Source: collector.AnnotationSourceUser},
+		{ID: ids[3], Timestamp: 300, Text: "AC unplugged", Source: collector.AnnotationSourceAuto},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("AnnotationsInRange() = %#v, want %#v", got, want)
+	}
+
+	deleted, err := db.DeleteAnnotation(ids[0])
+	if err != nil || !deleted {
+		t.Fatalf("DeleteAnnotation(%d) = %v, %v; want true, nil", ids[0], deleted, err)
+	}
+	deleted, err = db.DeleteAnnotation(ids[0])
+	if err != nil || deleted {
+		t.Fatalf("DeleteAnnotation(%d) again = %v, %v; want false, nil", ids[0], deleted, err)
+	}
+
+	got, err = db.AnnotationsInRange(0, 500)
+	if err != nil {
+		t.Fatalf("AnnotationsInRange() error = %v", err)
+	}
+	if len(got) != 2 || got[0].ID != ids[1] || got[1].ID != ids[3] {
+		t.Fatalf("AnnotationsInRange() after delete = %#v, want ids %d and %d", got, ids[1], ids[3])
+	}
+}
+
+func TestMigrate_AnnotationsDefaultToUserSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	if _, err := old.Exec(`CREATE TABLE annotations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		text TEXT NOT NULL
+	)`); err != nil {
+		t.Fatalf("create old table: %v", err)
+	}
+	if _, err := old.Exec("INSERT INTO annotations (timestamp, text) VALUES (100, 'enabled TLP')"); err != nil {
+		t.Fatalf("insert old row: %v", err)
+	}
+	old.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	got, err := db.AnnotationsInRange(0, 200)
+	if err != nil {
+		t.Fatalf("AnnotationsInRange() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Source != collector.AnnotationSourceUser {
+		t.Fatalf("AnnotationsInRange() = %+v, want one user annotation", got)
+	}
+}
+
+func TestMigrate_BatteryCountDefaultsToOne(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	if _, err := old.Exec(`CREATE TABLE battery_samples (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		voltage_uv INTEGER NOT NULL,
+		current_ua INTEGER NOT NULL,
+		power_uw INTEGER NOT NULL,
+		capacity_pct INTEGER NOT NULL,
+		status TEXT NOT NULL
+	)`); err != nil {
+		t.Fatalf("create old table: %v", err)
+	}
+	if _, err := old.Exec("INSERT INTO battery_samples (timestamp, voltage_uv, current_ua, power_uw, capacity_pct, status) VALUES (100, 12000000, 1000000, 12000000, 80, 'Discharging')"); err != nil {
+		t.Fatalf("insert old row: %v", err)
+	}
+	old.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+	latest, err := db.LatestBatterySample()
+	if err != nil {
+		t.Fatalf("LatestBatterySample() error = %v", err)
+	}
+	if latest == nil || latest.BatteryCount != 1 {
+		t.Fatalf("LatestBatterySample() = %+v, want battery_count=1", latest)
+	}
+}
+
+func TestThrottleEventsRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+
+	events := []collector.ThrottleEvent{
+		{StartTime: 300, EndTime: 320, Reason: collector.ThrottleReasonFreqCap},
+		{StartTime: 100, EndTime: 130, Reason: collector.ThrottleReasonThermal},
+		{StartTime: 900, EndTime: 910, Reason: collector.ThrottleReasonThermal},
+	}
+	for _, e := range events {
+		if err := db.InsertThrottleEvent(e); err != nil {
+			t.Fatalf("InsertThrottleEvent(%+v) error = %v", e, err)
+		}
+	}
+
+	got, err := db.ThrottleEventsInRange(0, 500)
+	if err != nil {
+		t.Fatalf("ThrottleEventsInRange() error = %v", err)
+	}
+	want := []collector.ThrottleEvent{events[1], events[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ThrottleEventsInRange() = %#v, want %#v", got, want)
+	}
+}
+
+func TestThrottleEventsInRange_ReturnsOverlapping(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, e := range []collector.ThrottleEvent{
+		{StartTime: 300, EndTime: 400, Reason: collector.ThrottleReasonThermal},
+		{StartTime: 50, EndTime: 120, Reason: collector.ThrottleReasonFreqCap},  // started before the range
+		{StartTime: 10, EndTime: 40, Reason: collector.ThrottleReasonThermal},   // ended before it
+		{StartTime: 450, EndTime: 700, Reason: collector.ThrottleReasonThermal}, // ends after it
+		{StartTime: 600, EndTime: 700, Reason: collector.ThrottleReasonThermal},
+	} {
+		if err := db.InsertThrottleEvent(e); err != nil {
+			t.Fatalf("InsertThrottleEvent(%+v) error = %v", e, err)
+		}
+	}
+
+	got, err := db.ThrottleEventsInRange(100, 500)
+	if err != nil {
+		t.Fatalf("ThrottleEventsInRange() error = %v", err)
+	}
+	want := []collector.ThrottleEvent{
+		{StartTime: 50, EndTime: 120, Reason: collector.ThrottleReasonFreqCap},
+		{StartTime: 300, EndTime: 400, Reason: collector.ThrottleReasonThermal},
+		{StartTime: 450, EndTime: 700, Reason: collector.ThrottleReasonThermal},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ThrottleEventsInRange() = %#v, want %#v", got, want)
+	}
+}
+
+func TestBatteryPresenceEventsRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+
+	events := []collector.BatteryPresenceEvent{
+		{Timestamp: 100, Present: false, Battery: "BAT1"},
+		{Timestamp: 400, Present: true, Battery: "BAT1"},
+		{Timestamp: 900, Present: false, Battery: "BAT1"},
+	}
+	for _, e := range events {
+		if err := db.InsertBatteryPresenceEvent(e); err != nil {
+			t.Fatalf("InsertBatteryPresenceEvent(%+v) error = %v", e, err)
+		}
+	}
+
+	got, err := db.BatteryPresenceEventsInRange(0, 500)
+	if err != nil {
+		t.Fatalf("BatteryPresenceEventsInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, events[:2]) {
+		t.Fatalf("BatteryPresenceEventsInRange() = %#v, want %#v", got, events[:2])
+	}
+}
+
+func TestCPUBusySamplesRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+
+	samples := []collector.CPUBusySample{
+		{Timestamp: 100, CPUID: 0, IsPCore: true, BusyFraction: 0.25, PeriodSecs: 30},
+		{Timestamp: 100, CPUID: 1, IsPCore: false, BusyFraction: 0.5, PeriodSecs: 30},
+		{Timestamp: 130, CPUID: 0, IsPCore: true, BusyFraction: 1, PeriodSecs: 30},
+	}
+	if err := db.InsertCPUBusySamples(samples); err != nil {
+		t.Fatalf("InsertCPUBusySamples() error = %v", err)
+	}
+
+	got, err := db.CPUBusySamplesInRange(100, 120)
+	if err != nil {
+		t.Fatalf("CPUBusySamplesInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, samples[:2]) {
+		t.Fatalf("CPUBusySamplesInRange() = %#v, want %#v", got, samples[:2])
+	}
+}
+
+func TestIdleIntervalsInRange_ReturnsOverlapping(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, iv := range []collector.IdleInterval{
+		{StartTime: 300, EndTime: 400},
+		{StartTime: 50, EndTime: 120}, // started before the range
+		{StartTime: 10, EndTime: 40},  // ended before it
+		{StartTime: 600, EndTime: 700},
+	} {
+		if err := db.InsertIdleInterval(iv); err != nil {
+			t.Fatalf("InsertIdleInterval(%+v) error = %v", iv, err)
+		}
+	}
+
+	got, err := db.IdleIntervalsInRange(100, 500)
+	if err != nil {
+		t.Fatalf("IdleIntervalsInRange() error = %v", err)
+	}
+	want := []collector.IdleInterval{{StartTime: 50, EndTime: 120}, {StartTime: 300, EndTime: 400}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("IdleIntervalsInRange() = %#v, want %#v", got, want)
+	}
+}
+
+func TestProcessLifetimes_UpsertWidensAndReturnsOverlapping(t *testing.T) {
+	db := openTestDB(t)
+
+	for _, batch := range [][]collector.ProcessLifetime{
+		{
+			{PID: 10, StartTime: 1000, Comm: "steady", FirstSeen: 100, LastSeen: 100},
+			{PID: 20, StartTime: 1000, Comm: "spike", FirstSeen: 50, LastSeen: 60}, // ended before the range
+		},
+		{{PID: 10, StartTime: 1000, Comm: "steady", FirstSeen: 100, LastSeen: 300}},
+		// Same pid, new process: a separate lifetime.
+		{{PID: 10, StartTime: 2000, Comm: "reused", FirstSeen: 400, LastSeen: 450}},
+	} {
+		if err := db.UpsertProcessLifetimes(batch); err != nil {
+			t.Fatalf("UpsertProcessLifetimes(%+v) error = %v", batch, err)
+		}
+	}
+	// A restarted daemon sees the running process again later; its first
+	// seen time is kept.
+	if err := db.UpsertProcessLifetimes([]collector.ProcessLifetime{{PID: 10, StartTime: 1000, Comm: "steady", FirstSeen: 350, LastSeen: 350}}); err != nil {
+		t.Fatalf("UpsertProcessLifetimes() error = %v", err)
+	}
+
+	got, err := db.ProcessLifetimesInRange(200, 500)
+	if err != nil {
+		t.Fatalf("ProcessLifetimesInRange() error = %v", err)
+	}
+	want := []collector.ProcessLifetime{
+		{PID: 10, StartTime: 1000, Comm: "steady", FirstSeen: 100, LastSeen: 350},
+		{PID: 10, StartTime: 2000, Comm: "reused", FirstSeen: 400, LastSeen: 450},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ProcessLifetimesInRange() = %+v, want %+v", got, want)
+	}
+	if n := countRows(t, db, "process_lifetimes"); n != 3 {
+		t.Fatalf("process_lifetimes rows = %d, want 3", n)
+	}
+}
+
+func TestCPUFreqSamplesInRange_CarriesForwardSparseSamples(t *testing.T) {
+	db := openTestDB(t)
+
+	// Sample-on-change data: core 0 last changed at 40, core 1 at 80 and 120,
+	// core 2 only long before the lookback window.
+	if err := db.InsertCPUFreqSamples([]collector.CPUFreqSample{
+		{Timestamp: 10, CPUID: 2, FreqKHz: 400000},
+		{Timestamp: 30, CPUID: 0, FreqKHz: 800000, IsPCore: true},
+		{Timestamp: 40, CPUID: 0, FreqKHz: 2400000, IsPCore: true},
+		{Timestamp: 80, CPUID: 1, FreqKHz: 1200000},
+		{Timestamp: 120, CPUID: 1, FreqKHz: 1800000},
+	}); err != nil {
+		t.Fatalf("InsertCPUFreqSamples() error = %v", err)
+	}
+
+	got, err := db.CPUFreqSamplesInRange(100, 200, 70)
+	if err != nil {
+		t.Fatalf("CPUFreqSamplesInRange() error = %v", err)
+	}
+	want := []collector.CPUFreqSample{
+		{Timestamp: 40, CPUID: 0, FreqKHz: 2400000, IsPCore: true},
+		{Timestamp: 80, CPUID: 1, FreqKHz: 1200000},
+		{Timestamp: 120, CPUID: 1, FreqKHz: 1800000},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CPUFreqSamplesInRange(lookback=70) = %#v, want %#v", got, want)
+	}
+
+	got, err = db.CPUFreqSamplesInRange(100, 200, 0)
+	if err != nil {
+		t.Fatalf("CPUFreqSamplesInRange() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Timestamp != 120 {
+		t.Fatalf("CPUFreqSamplesInRange(lookback=0) = %#v, want only the in-range sample", got)
+	}
+}
+
+func TestDisplayModelPointsRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+
+	want := []calibration.ModelPoint{
+		{Timestamp: 100, BrightnessPct: 25, PowerUW: 5500000, CPUTicks: 12.5, Samples: 13},
+		{Timestamp: 200, BrightnessPct: 62.5, PowerUW: 6400000, CPUTicks: 30, Samples: 13},
+	}
+	for _, p := range append(want, calibration.ModelPoint{Timestamp: 900, BrightnessPct: 90, PowerUW: 7000000, Samples: 13}) {
+		if err := db.InsertDisplayModelPoint(p); err != nil {
+			t.Fatalf("InsertDisplayModelPoint() error = %v", err)
+		}
+	}
+
+	got, err := db.DisplayModelPointsInRange(0, 500)
+	if err != nil {
+		t.Fatalf("DisplayModelPointsInRange() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DisplayModelPointsInRange() = %#v, want %#v", got, want)
+	}
+}
+
+// BenchmarkPowerStateEventsInRange queries a week of sleeps, each with its
+// drain lookup, out of a month of 5-second battery samples.
+func BenchmarkPowerStateEventsInRange(b *testing.B) {
+	db, err := Open(filepath.Join(b.TempDir(), "bench.db"))
+	if err != nil {
+		b.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	const month = 30 * 86400
+	samples := make([]collector.BatterySample, 0, month/5)
+	for ts := int64(0); ts < month; ts += 5 {
+		samples = append(samples, collector.BatterySample{Timestamp: ts, CapacityPct: 80, ChargeNowUAH: 4_000_000, Status: "Discharging"})
+	}
+	if err := batterySamples.insertBatch(db.db, samples); err != nil {
+		b.Fatalf("insert battery samples: %v", err)
+	}
+	// A 20-minute suspend every two hours, with no samples while asleep.
+	for start := int64(3600); start < month; start += 7200 {
+		e := collector.PowerStateEvent{StartTime: start, EndTime: start + 1200, Type: "suspend", SuspendSecs: 1200}
+		if _, err := db.InsertPowerStateEvent(e); err != nil {
+			b.Fatalf("InsertPowerStateEvent() error = %v", err)
+		}
+	}
+
+	from, to := int64(month-7*86400), int64(month)
+	for b.Loop() {
+		events, err := db.PowerStateEventsInRange(from, to)
+		if err != nil {
+			b.Fatalf("PowerStateEventsInRange() error = %v", err)
+		}
+		if len(events) != 84 || !events[0].DrainKnown {
+			b.Fatalf("got %d events (drain known %v), want 84 with drain", len(events), len(events) > 0 && events[0].DrainKnown)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// exportTables are the tables WriteTableCSV accepts: the retained time series
+// plus the long-lived tables not pruned as a whole.
+var exportTables = append(append([]timeTable(nil), retainedTables...),
+	timeTable{"battery_health_snapshots", "timestamp"},
+	timeTable{"annotations", "timestamp"},
+)
+
+// RetainedTables returns the names of the time-series tables subject to
+// retention cleanup.
+func RetainedTables() []string {
+	names := make([]string, len(retainedTables))
+	for i, t := range retainedTables {
+		names[i] = t.name
+	}
+	return names
+}
+
+// WriteTableCSV writes the rows of table with a timestamp at or after since
+// as CSV, preceded by a header row of column names, in time order. If
+// transform is non-nil every value passes through it before being written,
+// which lets callers redact columns.
+func (d *DB) WriteTableCSV(w io.Writer, table string, since int64, transform func(column, value string) string) error {
+	var tt *timeTable
+	for i := range exportTables {
+		if exportTables[i].name == table {
+			tt = &exportTables[i]
+		}
+	}
+	if tt == nil {
+		return fmt.Errorf("unknown table %q", table)
+	}
+
+	// Table and column names come from exportTables, never from the caller.
+	rows, err := d.db.Query(
+		fmt.Sprintf("SELECT * FROM %s WHERE %s >= ? ORDER BY %s, id", tt.name, tt.column, tt.column),
+		since,
+	)
+	if err != nil {
+		return fmt.Errorf("query %s: %w", table, err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	record := make([]string, len(columns))
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return fmt.Errorf("scan %s: %w", table, err)
+		}
+		for i, v := range values {
+			record[i] = formatValue(v)
+			if transform != nil {
+				record[i] = transform(columns[i], record[i])
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Schema returns the SQL statements that define the database's tables and
+// indexes, one per line.
+func (d *DB) Schema() (string, error) {
+	rows, err := d.db.Query("SELECT sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY type DESC, name")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var b strings.Builder
+	for rows.Next() {
+		var stmt string
+		if err := rows.Scan(&stmt); err != nil {
+			return "", err
+		}
+		b.WriteString(stmt)
+		b.WriteString(";\n")
+	}
+	return b.String(), rows.Err()
+}
+
+// formatValue renders a scanned SQLite value as CSV text.
+func formatValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestWriteTableCSV(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := db.InsertProcessSamples([]collector.ProcessSample{
+		{Timestamp: 100, PID: 1, Comm: "old", Cmdline: "/usr/bin/old", CPUTicksDelta: 5, LastCPU: 0},
+		{Timestamp: 200, PID: 2, Comm: "firefox", Cmdline: "/usr/lib/firefox, --private", CPUTicksDelta: 7, LastCPU: 3},
+	}); err != nil {
+		t.Fatalf("InsertProcessSamples() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := db.WriteTableCSV(&buf, "process_samples", 150, nil); err != nil {
+		t.Fatalf("WriteTableCSV() error = %v", err)
+	}
+	want := "id,timestamp,pid,comm,cmdline,cpu_ticks_delta,last_cpu\n" +
+		"2,200,2,firefox,\"/usr/lib/firefox, --private\",7,3\n"
+	if buf.String() != want {
+		t.Fatalf("WriteTableCSV() =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	redact := func(column, value string) string {
+		if column == "cmdline" {
+			return ""
+		}
+		return value
+	}
+	if err := db.WriteTableCSV(&buf, "process_samples", 0, redact); err != nil {
+		t.Fatalf("WriteTableCSV(redact) error = %v", err)
+	}
+	if strings.Contains(buf.String(), "/usr/") {
+		t.Fatalf("WriteTableCSV(redact) kept a cmdline:\n%s", buf.String())
+	}
+	if got := strings.Count(buf.String(), "\n"); got != 3 {
+		t.Fatalf("WriteTableCSV(redact) wrote %d lines, want header plus 2 rows", got)
+	}
+
+	if err := db.WriteTableCSV(&buf, "sqlite_master", 0, nil); err == nil {
+		t.Fatal("WriteTableCSV(unknown table) error = nil, want error")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	db := openTestDB(t)
+
+	schema, err := db.Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	for _, table := range append(RetainedTables(), "battery_health_snapshots", "annotations") {
+		if !strings.Contains(schema, "CREATE TABLE "+table) {
+			t.Errorf("Schema() is missing table %s", table)
+		}
+	}
+}
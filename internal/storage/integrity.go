@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrCorrupt is returned by Open when the database file fails SQLite's
+// integrity check or is not a database at all.
+var ErrCorrupt = errors.New("database is corrupt")
+
+// maxIntegrityMessages bounds how many quick_check problems are reported.
+const maxIntegrityMessages = 3
+
+// checkIntegrity runs PRAGMA quick_check, returning an error wrapping
+// ErrCorrupt if SQLite reports any problem with the file.
+func checkIntegrity(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA quick_check")
+	if err != nil {
+		if isCorruptionError(err) {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return fmt.Errorf("integrity check: %w", err)
+		}
+		if msg != "ok" && len(problems) < maxIntegrityMessages {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		if isCorruptionError(err) {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// isCorruptionError reports whether err is SQLite saying the file is
+// malformed or not a database.
+func isCorruptionError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.Code == sqlite3.ErrCorrupt || sqliteErr.Code == sqlite3.ErrNotADB
+}
+
+// OpenWithRecovery opens the database like Open, but if the file is corrupt
+// it moves it (and its WAL and shared-memory files) aside to
+// "<path>.corrupt-<unix time>" and starts a fresh database in its place.
+// It returns the path the corrupt file was moved to, or "" if the database
+// opened cleanly.
+func OpenWithRecovery(path string) (*DB, string, error) {
+	db, err := Open(path)
+	if err == nil || !errors.Is(err, ErrCorrupt) {
+		return db, "", err
+	}
+
+	moved := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, moved+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, "", fmt.Errorf("move corrupt database aside: %w", err)
+		}
+	}
+	db, err = Open(path)
+	if err != nil {
+		return nil, moved, fmt.Errorf("open fresh database: %w", err)
+	}
+	return db, moved, nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func writeGarbageDB(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	garbage := make([]byte, 8192)
+	for i := range garbage {
+		garbage[i] = byte(i * 7)
+	}
+	if err := os.WriteFile(path, garbage, 0o644); err != nil {
+		t.Fatalf("write garbage db: %v", err)
+	}
+	return path
+}
+
+func TestOpen_RejectsCorruptFile(t *testing.T) {
+	path := writeGarbageDB(t)
+
+	db, err := Open(path)
+	if err == nil {
+		db.Close()
+		t.Fatal("Open(corrupt) error = nil, want ErrCorrupt")
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Open(corrupt) error = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestOpenWithRecovery_MovesCorruptFileAside(t *testing.T) {
+	path := writeGarbageDB(t)
+
+	db, moved, err := OpenWithRecovery(path)
+	if err != nil {
+		t.Fatalf("OpenWithRecovery() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if moved == "" {
+		t.Fatal("OpenWithRecovery() moved = \"\", want corrupt copy path")
+	}
+	if _, err := os.Stat(moved); err != nil {
+		t.Fatalf("corrupt copy %s: %v", moved, err)
+	}
+	if err := db.InsertBatterySample(collector.BatterySample{Timestamp: 1, Status: "Discharging"}); err != nil {
+		t.Fatalf("InsertBatterySample() on fresh db error = %v", err)
+	}
+}
+
+func TestOpenWithRecovery_KeepsHealthyDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := db.InsertBatterySample(collector.BatterySample{Timestamp: 1, Status: "Discharging"}); err != nil {
+		t.Fatalf("InsertBatterySample() error = %v", err)
+	}
+	db.Close()
+
+	db, moved, err := OpenWithRecovery(path)
+	if err != nil {
+		t.Fatalf("OpenWithRecovery() error = %v", err)
+	}
+	defer db.Close()
+	if moved != "" {
+		t.Fatalf("OpenWithRecovery() moved = %q, want \"\" for healthy db", moved)
+	}
+	if s, err := db.LatestBatterySample(); err != nil || s == nil || s.Timestamp != 1 {
+		t.Fatalf("LatestBatterySample() = %#v, %v; want existing sample", s, err)
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// timeSeries maps a collector type T to a time-series table. It holds the
+// insert, range-query and latest-row SQL that every sensor table shares, so a
+// new table needs only its column list and two small conversion funcs.
+//
+// The embedded timeTable's column is the one range queries filter and order
+// on; the same timeTable is listed in retainedTables for cleanup.
+type timeSeries[T any] struct {
+	timeTable
+	// columns are written by insert and read back, in order, by the queries.
+	columns []string
+	// args returns the values of columns for v.
+	args func(v T) []any
+	// scan reads one row of columns into a T.
+	scan func(r scanner) (T, error)
+}
+
+func (ts *timeSeries[T]) insertSQL() string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		ts.name, strings.Join(ts.columns, ", "), strings.TrimSuffix(strings.Repeat("?, ", len(ts.columns)), ", "))
+}
+
+func (ts *timeSeries[T]) selectSQL(where, order string) string {
+	return fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s",
+		strings.Join(ts.columns, ", "), ts.name, where, order)
+}
+
+// insert stores one row.
+func (ts *timeSeries[T]) insert(db execer, v T) error {
+	_, err := db.Exec(ts.insertSQL(), ts.args(v)...)
+	return err
+}
+
+// insertBatch stores rows in a single transaction. An empty batch is a no-op.
+func (ts *timeSeries[T]) insertBatch(db *sql.DB, vs []T) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := ts.insertRows(tx, vs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertRows stores rows within tx, which the caller commits or rolls back.
+func (ts *timeSeries[T]) insertRows(tx *sql.Tx, vs []T) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(ts.insertSQL())
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, v := range vs {
+		if _, err := stmt.Exec(ts.args(v)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inRange returns rows whose time column lies within [from, to], ordered by
+// time and then insertion.
+func (ts *timeSeries[T]) inRange(db *sql.DB, from, to int64) ([]T, error) {
+	return ts.query(db, fmt.Sprintf("%s >= ? AND %s <= ?", ts.column, ts.column), from, to)
+}
+
+// query returns rows matching the where clause, ordered like inRange.
+func (ts *timeSeries[T]) query(db *sql.DB, where string, args ...any) ([]T, error) {
+	rows, err := db.Query(ts.selectSQL(where, ts.column+", id"), args...)
+	if err != nil {
+		return nil, err
+	}
+	return ts.collect(rows)
+}
+
+// collect scans and closes rows, which must select ts.columns in order.
+func (ts *timeSeries[T]) collect(rows *sql.Rows) ([]T, error) {
+	defer rows.Close()
+	var out []T
+	for rows.Next() {
+		v, err := ts.scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+// latest returns the most recently inserted row, or nil if the table is
+// empty. It orders by insertion rather than time so that a backward
+// wall-clock step doesn't leave an older, future-stamped row reported as
+// current.
+func (ts *timeSeries[T]) latest(db *sql.DB) (*T, error) {
+	v, err := ts.scan(db.QueryRow(ts.selectSQL("1", "id DESC LIMIT 1")))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
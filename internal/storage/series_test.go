@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testPoint struct {
+	Timestamp int64
+	Value     string
+}
+
+var testPoints = timeSeries[testPoint]{
+	timeTable: timeTable{"test_points", "timestamp"},
+	columns:   []string{"timestamp", "value"},
+	args: func(p testPoint) []any {
+		return []any{p.Timestamp, p.Value}
+	},
+	scan: func(r scanner) (testPoint, error) {
+		var p testPoint
+		err := r.Scan(&p.Timestamp, &p.Value)
+		return p, err
+	},
+}
+
+func openTestSeries(t *testing.T) *DB {
+	t.Helper()
+	db := openTestDB(t)
+	if _, err := db.db.Exec("CREATE TABLE test_points (id INTEGER PRIMARY KEY AUTOINCREMENT, timestamp INTEGER NOT NULL, value TEXT NOT NULL)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	return db
+}
+
+func TestTimeSeriesRoundTrip(t *testing.T) {
+	db := openTestSeries(t)
+
+	latest, err := testPoints.latest(db.db)
+	if err != nil || latest != nil {
+		t.Fatalf("latest() on empty table = %v, %v; want nil, nil", latest, err)
+	}
+
+	if err := testPoints.insertBatch(db.db, nil); err != nil {
+		t.Fatalf("insertBatch(nil) error = %v", err)
+	}
+	// Inserted out of time order: ranges sort by time, latest by insertion.
+	batch := []testPoint{{30, "c"}, {10, "a"}, {20, "b"}}
+	if err := testPoints.insertBatch(db.db, batch); err != nil {
+		t.Fatalf("insertBatch() error = %v", err)
+	}
+	if err := testPoints.insert(db.db, testPoint{20, "b2"}); err != nil {
+		t.Fatalf("insert() error = %v", err)
+	}
+
+	got, err := testPoints.inRange(db.db, 15, 30)
+	if err != nil {
+		t.Fatalf("inRange() error = %v", err)
+	}
+	want := []testPoint{{20, "b"}, {20, "b2"}, {30, "c"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("inRange(15, 30) = %v, want %v", got, want)
+	}
+
+	latest, err = testPoints.latest(db.db)
+	if err != nil {
+		t.Fatalf("latest() error = %v", err)
+	}
+	if latest == nil || *latest != (testPoint{20, "b2"}) {
+		t.Fatalf("latest() = %v, want {20 b2}", latest)
+	}
+}
+
+func TestTimeSeriesInsertBatchRollsBack(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.db.Exec("CREATE TABLE test_points (id INTEGER PRIMARY KEY AUTOINCREMENT, timestamp INTEGER NOT NULL, value TEXT NOT NULL UNIQUE)"); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	if err := testPoints.insertBatch(db.db, []testPoint{{1, "x"}, {2, "x"}}); err == nil {
+		t.Fatal("insertBatch() with a duplicate succeeded, want error")
+	}
+	got, err := testPoints.inRange(db.db, 0, 10)
+	if err != nil {
+		t.Fatalf("inRange() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Fatalf("inRange() after failed batch = %v, want empty", got)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Snapshot commits any buffered rows and writes a consistent copy of the
+// database to path with SQLite's online backup API. The copy is built in
+// "<path>.tmp", synced and renamed over path, so a crash mid-snapshot
+// leaves the previous snapshot intact.
+func (d *DB) Snapshot(path string) error {
+	if err := d.Flush(); err != nil {
+		return fmt.Errorf("flush: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.Remove(tmp); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := backupFile(d.db, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncFile(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return syncFile(filepath.Dir(path))
+}
+
+// RestoreSnapshot copies the snapshot at snapshot to live, where the daemon
+// keeps its working database, when live does not exist yet, as after a
+// reboot cleared the tmpfs. An existing live file is newer than any
+// snapshot and is kept. It reports whether a snapshot was restored; with no
+// snapshot either, Open starts a fresh database at live.
+func RestoreSnapshot(snapshot, live string) (bool, error) {
+	if _, err := os.Stat(live); err == nil {
+		return false, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if _, err := os.Stat(snapshot); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	src, err := sql.Open("sqlite3", "file:"+snapshot+"?mode=ro")
+	if err != nil {
+		return false, fmt.Errorf("open snapshot: %w", err)
+	}
+	defer src.Close()
+	if err := backupFile(src, live); err != nil {
+		os.Remove(live)
+		return false, err
+	}
+	return true, nil
+}
+
+// backupFile copies the main database of src into a new database file at
+// path in a single backup step.
+func backupFile(src *sql.DB, path string) error {
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("open backup target: %w", err)
+	}
+	defer dst.Close()
+
+	ctx := context.Background()
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("open backup target: %w", err)
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("open backup source: %w", err)
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(dstDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			to, ok := dstDriver.(*sqlite3.SQLiteConn)
+			from, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backup: not a sqlite3 connection")
+			}
+			b, err := to.Backup("main", from, "main")
+			if err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Close()
+				return fmt.Errorf("backup: %w", err)
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// syncFile flushes path, a file or directory, to disk.
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestSnapshotAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "shm", "data.db")
+	snapshot := filepath.Join(dir, "data.db")
+	if err := os.MkdirAll(filepath.Dir(live), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := Open(live)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	db.EnableWriteBuffer(1000)
+	for ts := int64(100); ts < 103; ts++ {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: ts, CapacityPct: 80}); err != nil {
+			t.Fatalf("InsertBatterySample() error = %v", err)
+		}
+	}
+	if err := db.Snapshot(snapshot); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	// A second snapshot replaces the first.
+	if err := db.InsertBatterySample(collector.BatterySample{Timestamp: 103, CapacityPct: 79}); err != nil {
+		t.Fatalf("InsertBatterySample() error = %v", err)
+	}
+	if err := db.Snapshot(snapshot); err != nil {
+		t.Fatalf("second Snapshot() error = %v", err)
+	}
+	if _, err := os.Stat(snapshot + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary snapshot left behind: %v", err)
+	}
+
+	// The live file survives a daemon restart and is kept.
+	if restored, err := RestoreSnapshot(snapshot, live); err != nil || restored {
+		t.Fatalf("RestoreSnapshot(existing live) = %v, %v; want false, nil", restored, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reboot clears the tmpfs; the snapshot is copied back.
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(live + suffix)
+	}
+	restored, err := RestoreSnapshot(snapshot, live)
+	if err != nil || !restored {
+		t.Fatalf("RestoreSnapshot() = %v, %v; want true, nil", restored, err)
+	}
+	db, err = Open(live)
+	if err != nil {
+		t.Fatalf("Open(restored) error = %v", err)
+	}
+	defer db.Close()
+	samples, err := db.BatterySamplesInRange(0, 1000)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	if len(samples) != 4 || samples[3].CapacityPct != 79 {
+		t.Fatalf("restored samples = %+v, want the 4 snapshotted samples", samples)
+	}
+}
+
+func TestRestoreSnapshot_NoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	live := filepath.Join(dir, "live.db")
+	restored, err := RestoreSnapshot(filepath.Join(dir, "missing.db"), live)
+	if err != nil || restored {
+		t.Fatalf("RestoreSnapshot(missing) = %v, %v; want false, nil", restored, err)
+	}
+	if _, err := os.Stat(live); !os.IsNotExist(err) {
+		t.Fatalf("live file created without a snapshot: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// batteryStatusNames interns the power_supply status strings the kernel
+// reports: battery_samples.status_code stores the index, so the text is not
+// repeated in every row. Code 0 means the status is not one of these and is
+// kept verbatim in the status column. Codes are stored, so only append.
+var batteryStatusNames = []string{
+	1: "Unknown",
+	2: "Charging",
+	3: "Discharging",
+	4: "Not charging",
+	5: "Full",
+}
+
+// statusDischarging is the status_code of "Discharging".
+const statusDischarging = 3
+
+// encodeBatteryStatus returns the status_code and status column values for
+// status: a code and "" for a known status, 0 and the text otherwise.
+func encodeBatteryStatus(status string) (code int, text string) {
+	for code, name := range batteryStatusNames {
+		if code != 0 && name == status {
+			return code, ""
+		}
+	}
+	return 0, status
+}
+
+// decodeBatteryStatus maps the stored status_code and status columns back to
+// the status string.
+func decodeBatteryStatus(code int, text string) string {
+	if code > 0 && code < len(batteryStatusNames) {
+		return batteryStatusNames[code]
+	}
+	return text
+}
+
+// addBatteryStatusCode adds the status_code column and moves the status of
+// the rows written before it into the column. Both happen in one transaction,
+// so a crash can't leave the column added with the rows still uninterned.
+func addBatteryStatusCode(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("ALTER TABLE battery_samples ADD COLUMN status_code INTEGER NOT NULL DEFAULT 0"); err != nil {
+		if isDuplicateColumnError(err) {
+			return nil
+		}
+		return fmt.Errorf("add status_code column: %w", err)
+	}
+	for code, name := range batteryStatusNames {
+		if code == 0 {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE battery_samples SET status_code = ?, status = '' WHERE status = ?", code, name); err != nil {
+			return fmt.Errorf("intern status %q: %w", name, err)
+		}
+	}
+	return tx.Commit()
+}
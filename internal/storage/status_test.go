@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/cptspacemanspiff/gnome-power-display/internal/collector"
+)
+
+func TestBatteryStatusRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+
+	statuses := []string{"Unknown", "Charging", "Discharging", "Not charging", "Full", "", "Overheated"}
+	for i, status := range statuses {
+		if err := db.InsertBatterySample(collector.BatterySample{Timestamp: int64(100 + i), Status: status}); err != nil {
+			t.Fatalf("InsertBatterySample(%q) error = %v", status, err)
+		}
+	}
+
+	samples, err := db.BatterySamplesInRange(0, 1000)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	if len(samples) != len(statuses) {
+		t.Fatalf("BatterySamplesInRange() len = %d, want %d", len(samples), len(statuses))
+	}
+	for i, s := range samples {
+		if s.Status != statuses[i] {
+			t.Fatalf("sample %d Status = %q, want %q", i, s.Status, statuses[i])
+		}
+	}
+	latest, err := db.LatestBatterySample()
+	if err != nil {
+		t.Fatalf("LatestBatterySample() error = %v", err)
+	}
+	if latest.Status != "Overheated" {
+		t.Fatalf("LatestBatterySample().Status = %q, want %q", latest.Status, "Overheated")
+	}
+
+	var textRows int
+	if err := db.db.QueryRow("SELECT COUNT(*) FROM battery_samples WHERE status != ''").Scan(&textRows); err != nil {
+		t.Fatalf("count text statuses: %v", err)
+	}
+	if textRows != 1 {
+		t.Fatalf("rows storing status text = %d, want only the unknown status", textRows)
+	}
+}
+
+func TestMigrate_InternsBatteryStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	old, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	// battery_samples as the first release created it.
+	if _, err := old.Exec(`CREATE TABLE battery_samples (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		timestamp INTEGER NOT NULL,
+		voltage_uv INTEGER NOT NULL,
+		current_ua INTEGER NOT NULL,
+		power_uw INTEGER NOT NULL,
+		capacity_pct INTEGER NOT NULL,
+		status TEXT NOT NULL
+	)`); err != nil {
+		t.Fatalf("create old table: %v", err)
+	}
+	for i, status := range []string{"Discharging", "Not charging", "Overheated"} {
+		if _, err := old.Exec("INSERT INTO battery_samples (timestamp, voltage_uv, current_ua, power_uw, capacity_pct, status) VALUES (?, 0, 0, 0, 50, ?)", 100+i, status); err != nil {
+			t.Fatalf("insert old row: %v", err)
+		}
+	}
+	old.Close()
+
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.db.Query("SELECT status, status_code FROM battery_samples ORDER BY timestamp")
+	if err != nil {
+		t.Fatalf("query migrated rows: %v", err)
+	}
+	defer rows.Close()
+	type stored struct {
+		text string
+		code int
+	}
+	want := []stored{{"", 3}, {"", 4}, {"Overheated", 0}}
+	var got []stored
+	for rows.Next() {
+		var s stored
+		if err := rows.Scan(&s.text, &s.code); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		got = append(got, s)
+	}
+	rows.Close()
+	if len(got) != len(want) {
+		t.Fatalf("migrated rows = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("migrated rows = %+v, want %+v", got, want)
+		}
+	}
+
+	samples, err := db.BatterySamplesInRange(0, 1000)
+	if err != nil {
+		t.Fatalf("BatterySamplesInRange() error = %v", err)
+	}
+	if samples[0].Status != "Discharging" || samples[1].Status != "Not charging" || samples[2].Status != "Overheated" {
+		t.Fatalf("migrated statuses = %q, %q, %q", samples[0].Status, samples[1].Status, samples[2].Status)
+	}
+}